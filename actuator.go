@@ -0,0 +1,194 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// actuatorMappings are the keys of the handler mappings in the mappings of
+// an application context: Spring MVC's dispatcher servlets and WebFlux's
+// dispatcher handlers.
+var actuatorMappings = []string{"dispatcherServlets", "dispatcherHandlers"}
+
+// isActuatorDoc reports whether root is the document of Spring Boot's
+// /actuator/mappings endpoint.
+func isActuatorDoc(root *yaml.Node) bool {
+	contexts := mappingValue(root, "contexts")
+	return contexts != nil && contexts.Kind == yaml.MappingNode
+}
+
+// parseActuator turns the request mappings reported by Spring Boot's
+// /actuator/mappings endpoint (Spring Boot 2 and later) into endpoint rows:
+// a row per method and pattern of every handler of the application, with
+// its header and parameter conditions as header and query parameter
+// matches. Handlers of Spring itself, such as the actuator endpoints and
+// the /error controller, are left out. Rows are numbered by the line of
+// their mapping.
+func parseActuator(ctx context.Context, path string) ([]Endpoint, error) {
+	data, err := readInput(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("invalid actuator mappings: %w", err)
+	}
+	if len(doc.Content) == 0 || !isActuatorDoc(doc.Content[0]) {
+		return nil, fmt.Errorf("not an actuator mappings document (missing contexts field)")
+	}
+	return actuatorEndpoints(path, doc.Content[0])
+}
+
+func actuatorEndpoints(path string, root *yaml.Node) ([]Endpoint, error) {
+	var endpoints []Endpoint
+	seen := make(map[string]bool)
+	contexts := mappingValue(root, "contexts")
+	for i := 1; i < len(contexts.Content); i += 2 {
+		mappings := mappingValue(contexts.Content[i], "mappings")
+		if mappings == nil {
+			continue
+		}
+		for _, key := range actuatorMappings {
+			dispatchers := mappingValue(mappings, key)
+			if dispatchers == nil || dispatchers.Kind != yaml.MappingNode {
+				continue
+			}
+			for j := 1; j < len(dispatchers.Content); j += 2 {
+				for _, mapping := range dispatchers.Content[j].Content {
+					rows, err := actuatorRows(mapping)
+					if err != nil {
+						return nil, fmt.Errorf("line %d: %w", mapping.Line, err)
+					}
+					for _, e := range rows {
+						key := e.Method + " " + e.URL + " " + e.Headers + " " + e.QueryParams
+						if !seen[key] {
+							seen[key] = true
+							endpoints = append(endpoints, e)
+						}
+					}
+				}
+			}
+		}
+	}
+	recordSkippedRows(path, 0)
+	return applyTagFilters(applyCutovers(endpoints)), nil
+}
+
+// actuatorRows are the rows of one handler mapping, none for mappings
+// without request conditions, such as resource handlers, or of Spring's
+// own handlers.
+func actuatorRows(mapping *yaml.Node) ([]Endpoint, error) {
+	details := mappingValue(mapping, "details")
+	if details == nil || details.Kind != yaml.MappingNode {
+		return nil, nil
+	}
+	conditions := mappingValue(details, "requestMappingConditions")
+	if conditions == nil || conditions.Kind != yaml.MappingNode {
+		return nil, nil
+	}
+	comment := ""
+	if h := mappingValue(mapping, "handler"); h != nil {
+		if strings.HasPrefix(h.Value, "Actuator ") {
+			return nil, nil
+		}
+		comment = h.Value
+	}
+	if method := mappingValue(details, "handlerMethod"); method != nil {
+		class := scalarValue(mappingValue(method, "className"))
+		if strings.HasPrefix(class, "org.springframework.") {
+			return nil, nil
+		}
+		if name := scalarValue(mappingValue(method, "name")); class != "" && name != "" {
+			comment = class[strings.LastIndexAny(class, ".$")+1:] + "#" + name
+		}
+	}
+
+	headers, err := actuatorPairs(mappingValue(conditions, "headers"))
+	if err != nil {
+		return nil, err
+	}
+	params, err := actuatorPairs(mappingValue(conditions, "params"))
+	if err != nil {
+		return nil, err
+	}
+	methods := scalarValues(mappingValue(conditions, "methods"))
+	if len(methods) == 0 {
+		methods = []string{""}
+	}
+	var rows []Endpoint
+	for _, pattern := range scalarValues(mappingValue(conditions, "patterns")) {
+		for _, method := range methods {
+			e, err := frameworkRow(method, pattern, map[string]string{"comment": comment, "headers": headers, "query_params": params})
+			if err != nil {
+				return nil, err
+			}
+			e.Line = mapping.Line
+			rows = append(rows, e)
+		}
+	}
+	return rows, nil
+}
+
+// actuatorPairs joins the header or parameter conditions of a mapping into
+// a headers or query_params cell. Conditions that only test for presence,
+// or negate, have no exact match and are left out.
+func actuatorPairs(conditions *yaml.Node) (string, error) {
+	if conditions == nil {
+		return "", nil
+	}
+	var pairs []string
+	for _, c := range conditions.Content {
+		name, value := scalarValue(mappingValue(c, "name")), scalarValue(mappingValue(c, "value"))
+		if name == "" || value == "" || scalarValue(mappingValue(c, "negated")) == "true" {
+			continue
+		}
+		if strings.ContainsAny(value, ";=") {
+			return "", fmt.Errorf("condition %s=%s cannot be written as a match", name, value)
+		}
+		pairs = append(pairs, name+"="+value)
+	}
+	return strings.Join(pairs, ";"), nil
+}
+
+// actuatorRouteName names the route of mappings fetched from a URL ending
+// in /actuator/mappings after the first label of its host, such as orders
+// for http://orders.shop:8080/actuator/mappings, rather than "mappings".
+func actuatorRouteName(path string) (string, bool) {
+	u, err := url.Parse(path)
+	if err != nil || u.Host == "" || !strings.HasSuffix(u.Path, "/mappings") {
+		return "", false
+	}
+	if net.ParseIP(u.Hostname()) != nil {
+		return "", false
+	}
+	host, _, _ := strings.Cut(u.Hostname(), ".")
+	return host, host != ""
+}
+
+// scalarValue is the value of a scalar node, "" for nil nodes, nulls and
+// collections.
+func scalarValue(n *yaml.Node) string {
+	if n == nil || n.Kind != yaml.ScalarNode || n.Tag == "!!null" {
+		return ""
+	}
+	return n.Value
+}
+
+// scalarValues are the non-empty scalar values of a sequence node.
+func scalarValues(n *yaml.Node) []string {
+	if n == nil {
+		return nil
+	}
+	var values []string
+	for _, c := range n.Content {
+		if v := scalarValue(c); v != "" {
+			values = append(values, v)
+		}
+	}
+	return values
+}
@@ -0,0 +1,266 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/arencloud/csv2httproute/pkg/router"
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/dynamic"
+)
+
+var (
+	// adoptNormalize is adopt --normalize: also rewrite the spec of adopted
+	// routes into the generated form.
+	adoptNormalize bool
+	// adoptDryRun is adopt --dry-run: report, but change nothing.
+	adoptDryRun bool
+)
+
+const (
+	// managedByLabel marks the routes adopted by this tool.
+	managedByLabel = "app.kubernetes.io/managed-by"
+	// adoptedAnnotationKey records when a route was adopted.
+	adoptedAnnotationKey = "csv2httproute/adopted-at"
+	// adoptFieldManager owns the adoption markers, so that --apply, which
+	// does not generate them, leaves them in place.
+	adoptFieldManager = "csv2httproute-adopt"
+)
+
+func newAdoptCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "adopt [NAME]...",
+		Short: "Take over existing HTTPRoutes that match the CSV inventory",
+		Long: `Generates the routes from --input in memory and takes over the HTTPRoutes of
+the same namespace and name that exist in the cluster but were not applied by
+this tool, such as routes written by hand before the inventory existed, so
+they can be brought under --apply without deleting and recreating them.
+
+A route is only adopted when it routes like its CSV source: the same
+hostnames, parent Gateways, matches, backends and filters, regardless of the
+order of its rules. csv2httproute then becomes the field manager of its spec,
+so --apply and diff treat it as its own, and it is labeled
+app.kubernetes.io/managed-by=csv2httproute and annotated with the time of
+adoption. Its spec is left as written unless --normalize replaces it with the
+generated one. Routes that differ are reported and left alone, and make the
+command exit non-zero; routes not in the cluster yet are created by --apply.
+
+NAME limits the adoption to the generated routes of that name or
+namespace/name.`,
+		RunE: runAdopt,
+	}
+	cmd.Flags().StringVarP(&serviceName, "service", "s", "my-service", "Default backend service name")
+	cmd.Flags().IntVarP(&servicePort, "port", "p", 80, "Default backend service port")
+	cmd.Flags().StringVar(&serviceNamespace, "service-namespace", "", "Namespace for the backend service")
+	cmd.Flags().BoolVar(&adoptNormalize, "normalize", false, "Also replace the spec of adopted routes with the generated one")
+	cmd.Flags().BoolVar(&adoptDryRun, "dry-run", false, "Report which routes would be adopted without changing them")
+	addGenerateFlags(cmd.Flags(), "generated")
+	return cmd
+}
+
+func runAdopt(cmd *cobra.Command, args []string) error {
+	tmp, err := os.MkdirTemp("", "csv2httproute-adopt-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmp)
+
+	// As in diff, kept hand-written rules from --output are part of the
+	// routes the cluster's are compared with.
+	output := outputDir
+	outputDir = tmp
+	noHeaderComment = true
+	generateOnly()
+	existingOutputDir = output
+	err = run(cmd, nil)
+	outputDir, existingOutputDir = output, ""
+	if err != nil {
+		return err
+	}
+	want, err := routesInDir(tmp)
+	if err != nil {
+		return err
+	}
+	keys, err := adoptKeys(want, args)
+	if err != nil {
+		return err
+	}
+
+	client, _, err := kubeDynamicClient()
+	if err != nil {
+		return err
+	}
+	live := &clusterRoutes{ctx: cmd.Context(), client: client}
+	adopted, differ := 0, 0
+	for _, key := range keys {
+		got, err := live.get(key)
+		if err != nil {
+			return err
+		}
+		if got == nil {
+			fmt.Printf("MISSING HTTPRoute %s (not in the cluster, --apply creates it)\n", key)
+			continue
+		}
+		if appliedByUs(unstructured.Unstructured{Object: got}) {
+			fmt.Printf("MANAGED HTTPRoute %s (already applied by csv2httproute)\n", key)
+			continue
+		}
+		diffs, err := routeDifferences(got, want[key])
+		if err != nil {
+			return fmt.Errorf("failed to compare HTTPRoute %s: %w", key, err)
+		}
+		if len(diffs) > 0 {
+			fmt.Printf("%s HTTPRoute %s (routes differently than its CSV source)\n", colorize(ansiYellow, "DIFFERS"), key)
+			for _, d := range diffs {
+				fmt.Printf("  - %s\n", d)
+			}
+			differ++
+			continue
+		}
+		adopted++
+		if adoptDryRun {
+			fmt.Printf("%s HTTPRoute %s\n", colorize(ansiGreen, "MATCHES"), key)
+			continue
+		}
+		if err := adoptRoute(cmd.Context(), client, key, got, want[key]); err != nil {
+			return fmt.Errorf("failed to adopt HTTPRoute %s: %w", key, err)
+		}
+		fmt.Printf("%s HTTPRoute %s\n", colorize(ansiGreen, "ADOPTED"), key)
+	}
+
+	if adoptDryRun {
+		fmt.Printf("%d HTTPRoute(s) would be adopted\n", adopted)
+	} else {
+		fmt.Printf("%d HTTPRoute(s) adopted\n", adopted)
+	}
+	if differ > 0 {
+		return fmt.Errorf("%d HTTPRoute(s) differ from the inventory and were not adopted", differ)
+	}
+	return nil
+}
+
+// adoptKeys lists the generated routes named by args, as namespace/name or
+// name, or all of them without args.
+func adoptKeys(want map[string]map[string]any, args []string) ([]string, error) {
+	var keys []string
+	for key := range want {
+		_, name, _ := strings.Cut(key, "/")
+		if len(args) == 0 || slices.Contains(args, key) || slices.Contains(args, name) {
+			keys = append(keys, key)
+		}
+	}
+	for _, arg := range args {
+		if !slices.ContainsFunc(keys, func(key string) bool { return key == arg || strings.HasSuffix(key, "/"+arg) }) {
+			return nil, fmt.Errorf("no generated HTTPRoute is named %s", arg)
+		}
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
+
+// routeDifferences describes how the routing of the live route differs
+// from the generated one, as compat classifies it, plus differences of the
+// parent Gateways it is attached to. None means adopting it changes
+// nothing that is routed.
+func routeDifferences(live, want map[string]any) ([]string, error) {
+	liveTable, err := singleRouteTable(live)
+	if err != nil {
+		return nil, err
+	}
+	wantTable, err := singleRouteTable(want)
+	if err != nil {
+		return nil, err
+	}
+	report := compareTables(liveTable, wantTable)
+	diffs := slices.Concat(report.Breaking, report.Additive, report.Neutral)
+	if got, generated := parentRefsKey(live), parentRefsKey(want); got != generated {
+		diffs = append(diffs, fmt.Sprintf("attached to %s instead of %s", got, generated))
+	}
+	return diffs, nil
+}
+
+func singleRouteTable(obj map[string]any) (*router.Table, error) {
+	data, err := yaml.Marshal(obj)
+	if err != nil {
+		return nil, err
+	}
+	return router.Load(bytes.NewReader(data))
+}
+
+// parentRefsKey renders the parentRefs of a route as namespace/name, with
+// the listener and kinds other than Gateway, in a stable order.
+func parentRefsKey(obj map[string]any) string {
+	spec, _ := obj["spec"].(map[string]any)
+	meta, _ := obj["metadata"].(map[string]any)
+	var refs []string
+	for _, ref := range listOfMaps(spec["parentRefs"]) {
+		ns, ok := ref["namespace"]
+		if !ok {
+			ns = meta["namespace"]
+		}
+		key := fmt.Sprintf("%v/%v", ns, ref["name"])
+		if section, ok := ref["sectionName"]; ok {
+			key += fmt.Sprintf(":%v", section)
+		}
+		if port, ok := ref["port"]; ok {
+			key += fmt.Sprintf(" port %v", port)
+		}
+		group, hasGroup := ref["group"]
+		kind, hasKind := ref["kind"]
+		if hasGroup && group != gatewaysGVR.Group || hasKind && kind != "Gateway" {
+			key += fmt.Sprintf(" (%v %v)", group, kind)
+		}
+		refs = append(refs, key)
+	}
+	sort.Strings(refs)
+	if len(refs) == 0 {
+		return "no parents"
+	}
+	return strings.Join(refs, ", ")
+}
+
+// adoptRoute makes csv2httproute the field manager of the spec of the live
+// route, as written or with --normalize as generated, and adds the
+// adoption markers under their own field manager.
+func adoptRoute(ctx context.Context, client dynamic.Interface, key string, live, want map[string]any) error {
+	ns, name, _ := strings.Cut(key, "/")
+	res := client.Resource(httpRoutesGVR).Namespace(ns)
+	owned := &unstructured.Unstructured{Object: want}
+	if !adoptNormalize {
+		owned = &unstructured.Unstructured{Object: map[string]any{"spec": live["spec"]}}
+	}
+	owned.SetAPIVersion(httpRoutesGVR.GroupVersion().String())
+	owned.SetKind("HTTPRoute")
+	owned.SetNamespace(ns)
+	owned.SetName(name)
+	markers := &unstructured.Unstructured{}
+	markers.SetAPIVersion(httpRoutesGVR.GroupVersion().String())
+	markers.SetKind("HTTPRoute")
+	markers.SetNamespace(ns)
+	markers.SetName(name)
+	markers.SetLabels(map[string]string{managedByLabel: applyFieldManager})
+	markers.SetAnnotations(map[string]string{adoptedAnnotationKey: time.Now().UTC().Format(time.RFC3339)})
+
+	for _, apply := range []struct {
+		obj     *unstructured.Unstructured
+		manager string
+	}{{owned, applyFieldManager}, {markers, adoptFieldManager}} {
+		err := retryCluster(ctx, "HTTPRoute "+key, 10*time.Second, func(ctx context.Context) error {
+			_, err := res.Apply(ctx, name, apply.obj, metav1.ApplyOptions{FieldManager: apply.manager, Force: true})
+			return err
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,290 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"gopkg.in/yaml.v3"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/dynamic"
+)
+
+// applyRoutes is --apply: server-side apply the generated manifests to the
+// cluster of the kubeconfig context after writing them, as --sink cluster.
+var applyRoutes bool
+
+// applyContexts is --contexts: the kubeconfig contexts --apply rolls the
+// manifests out to, in order, instead of the one of --context.
+var applyContexts []string
+
+// applyBatchSize is --apply-batch: the objects of a stage applied at the
+// same time, so large inventories are not applied one request after the
+// other.
+var applyBatchSize = 20
+
+// applyFieldManager owns the fields of the applied objects. Conflicts with
+// other managers are forced, as the CSV inventory is the source of truth.
+const applyFieldManager = "csv2httproute"
+
+// applyResults counts the outcome of --apply per result.
+type applyResults struct {
+	created, updated, unchanged int
+}
+
+// applyGeneratedObjects server-side applies the objects of the files written
+// in this run to every --contexts context, or the --context one. A
+// context that fails does not stop the rollout to the others.
+func applyGeneratedObjects(ctx context.Context, files []string) error {
+	if len(applyContexts) == 0 {
+		return applyToContext(ctx, files, "")
+	}
+	saved := kubeContext
+	defer func() { kubeContext = saved }()
+	var failed []string
+	for _, name := range applyContexts {
+		kubeContext = name
+		if err := applyToContext(ctx, files, name); err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			fmt.Fprintf(os.Stderr, "Error applying to context %s: %v\n", name, err)
+			failed = append(failed, name)
+		}
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("failed to apply to %d of %d context(s): %s", len(failed), len(applyContexts), strings.Join(failed, ", "))
+	}
+	return nil
+}
+
+// applyToContext server-side applies the objects of files, as written, so
+// routes include kept hand-written rules, to the cluster of the current
+// context; name labels the output when rolling out to several. Objects are
+// applied in the stages of applyStages, each one waiting for what the next
+// depends on, so a fresh cluster can be bootstrapped in one run. Transient
+// failures are retried per object; it applies every object before failing
+// on the ones that could not be applied, listed by reason.
+func applyToContext(ctx context.Context, files []string, name string) error {
+	client, _, err := kubeDynamicClient()
+	if err != nil {
+		return err
+	}
+	target, in := "", ""
+	if name != "" {
+		target, in = " to "+name, " in "+name
+	}
+	var objects []*unstructured.Unstructured
+	for _, path := range files {
+		// --template output and other files that are not manifests, and
+		// patches, which would replace the objects they patch.
+		if ext := filepath.Ext(path); (ext != ".yaml" && ext != ".yml") || isPatchFile(path) {
+			continue
+		}
+		objs, err := fileObjects(path)
+		if err != nil {
+			return err
+		}
+		objects = append(objects, objs...)
+	}
+	var created []string
+	for _, obj := range objects {
+		if obj.GetKind() == "Namespace" {
+			created = append(created, obj.GetName())
+		}
+	}
+	var results applyResults
+	var failures []string
+	done := 0
+	for _, stage := range stageObjects(objects) {
+		if err := waitForStage(ctx, client, stage, created); err != nil {
+			return err
+		}
+		for batch := range slices.Chunk(stage, applyBatchSize) {
+			outcomes := applyBatch(ctx, client, batch)
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			// Reported in the order of the objects, whichever finished first.
+			for i, obj := range batch {
+				ref, o := objectRef(obj), outcomes[i]
+				if o.err != nil {
+					failures = append(failures, fmt.Sprintf("%s (%s)", ref, failureReason(o.err)))
+					fmt.Fprintf(os.Stderr, "Error applying %s: %v\n", ref, o.err)
+					continue
+				}
+				switch o.result {
+				case "created":
+					results.created++
+				case "updated":
+					results.updated++
+				default:
+					results.unchanged++
+				}
+				if !quiet {
+					fmt.Printf("%s %s%s\n", ref, o.result, in)
+				}
+			}
+			done += len(batch)
+			if !quiet && len(objects) > applyBatchSize {
+				fmt.Fprintf(os.Stderr, "Applied %d of %d object(s)%s\n", done, len(objects), target)
+			}
+		}
+	}
+	fmt.Printf("Applied objects%s: %d created, %d updated, %d unchanged, %d failed\n", target, results.created, results.updated, results.unchanged, len(failures))
+	if len(failures) > 0 {
+		return fmt.Errorf("failed to apply %d object(s): %s", len(failures), strings.Join(failures, ", "))
+	}
+	return nil
+}
+
+// applyOutcome is the result of applying one object, or its error.
+type applyOutcome struct {
+	result string
+	err    error
+}
+
+// applyBatch applies the objects of batch at the same time, each retried on
+// its own, and returns their outcomes in order.
+func applyBatch(ctx context.Context, client dynamic.Interface, batch []*unstructured.Unstructured) []applyOutcome {
+	outcomes := make([]applyOutcome, len(batch))
+	var wg sync.WaitGroup
+	for i, obj := range batch {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			gvr, _ := meta.UnsafeGuessKindToResource(obj.GroupVersionKind())
+			res := client.Resource(gvr).Namespace(obj.GetNamespace())
+			outcomes[i].err = retryCluster(ctx, objectRef(obj), 30*time.Second, func(ctx context.Context) error {
+				var err error
+				outcomes[i].result, err = applyObject(ctx, res, obj)
+				return err
+			})
+		}()
+	}
+	wg.Wait()
+	return outcomes
+}
+
+func validateApplyBatch() error {
+	if applyBatchSize < 1 {
+		return fmt.Errorf("invalid --apply-batch %d (must be 1 or more)", applyBatchSize)
+	}
+	return nil
+}
+
+// failureReason names why a request failed, by the reason the API server
+// gave, such as Forbidden or Invalid.
+func failureReason(err error) string {
+	if reason := apierrors.ReasonForError(err); reason != metav1.StatusReasonUnknown {
+		return string(reason)
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return "Timeout"
+	}
+	return "Error"
+}
+
+// applyResource is the part of a dynamic client --apply uses.
+type applyResource interface {
+	Get(ctx context.Context, name string, opts metav1.GetOptions, subresources ...string) (*unstructured.Unstructured, error)
+	Apply(ctx context.Context, name string, obj *unstructured.Unstructured, opts metav1.ApplyOptions, subresources ...string) (*unstructured.Unstructured, error)
+}
+
+// applyObject applies obj and reports whether it was created, updated, or
+// unchanged, telling the latter two apart by the resource version.
+func applyObject(ctx context.Context, res applyResource, obj *unstructured.Unstructured) (string, error) {
+	current, err := res.Get(ctx, obj.GetName(), metav1.GetOptions{})
+	if err != nil && !apierrors.IsNotFound(err) {
+		return "", err
+	}
+	applied, err := res.Apply(ctx, obj.GetName(), obj, metav1.ApplyOptions{FieldManager: applyFieldManager, Force: true})
+	if err != nil {
+		return "", err
+	}
+	switch {
+	case current == nil:
+		return "created", nil
+	case applied.GetResourceVersion() != current.GetResourceVersion():
+		return "updated", nil
+	}
+	return "unchanged", nil
+}
+
+// routeObjects returns the HTTPRoutes among the YAML documents of path.
+func routeObjects(path string) ([]*unstructured.Unstructured, error) {
+	objects, err := fileObjects(path)
+	if err != nil {
+		return nil, err
+	}
+	return slices.DeleteFunc(objects, func(obj *unstructured.Unstructured) bool { return obj.GetKind() != "HTTPRoute" }), nil
+}
+
+// fileObjects returns the Kubernetes objects among the YAML documents of
+// path, leaving out the kustomization and Backstage catalog, which are not
+// applied. A document that is not valid YAML fails the whole file, so no
+// object of it goes missing unnoticed.
+func fileObjects(path string) ([]*unstructured.Unstructured, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var objects []*unstructured.Unstructured
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	for {
+		var doc map[string]any
+		err := dec.Decode(&doc)
+		if errors.Is(err, io.EOF) {
+			return objects, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		kind, _ := doc["kind"].(string)
+		apiVersion, _ := doc["apiVersion"].(string)
+		if kind == "" || notApplied(apiVersion) {
+			continue
+		}
+		// The JSON round trip gives the value types unstructured expects.
+		raw, err := json.Marshal(doc)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		obj := &unstructured.Unstructured{}
+		if err := obj.UnmarshalJSON(raw); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		objects = append(objects, obj)
+	}
+}
+
+// validateApplyContexts rejects --contexts combined with --context, which
+// it replaces, and contexts listed twice.
+func validateApplyContexts() error {
+	if len(applyContexts) > 0 && kubeContext != "" {
+		return fmt.Errorf("--contexts and --context are mutually exclusive")
+	}
+	seen := make(map[string]bool)
+	for _, name := range applyContexts {
+		if name == "" {
+			return fmt.Errorf("invalid --contexts: empty context name")
+		}
+		if seen[name] {
+			return fmt.Errorf("context %s listed twice in --contexts", name)
+		}
+		seen[name] = true
+	}
+	return nil
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+)
+
+// applyWait is --apply-wait: how long --apply waits for the Namespaces it
+// created to be active, and for the Gateways of the routes to exist, before
+// applying the objects depending on them.
+var applyWait = 2 * time.Minute
+
+// applyPollInterval is how often a wait of --apply checks again.
+const applyPollInterval = 2 * time.Second
+
+// applyStages are the kinds applied in each stage of --apply, in order:
+// every stage only depends on the ones before it. Other kinds, such as
+// policies attached to routes or Services, are applied last.
+var applyStages = [][]string{
+	{"Namespace"},
+	{"ServiceAccount", "Role", "RoleBinding", "Service", "Deployment"},
+	{"ReferenceGrant", "Backend"},
+	routeKinds,
+}
+
+// routeKinds are the kinds attached to parent Gateways.
+var routeKinds = []string{"HTTPRoute", "GRPCRoute", "TLSRoute"}
+
+// notApplied reports whether objects of apiVersion are configuration for
+// tools rather than cluster objects: the kustomization and the Backstage
+// catalog.
+func notApplied(apiVersion string) bool {
+	gv, err := schema.ParseGroupVersion(apiVersion)
+	return err == nil && (gv.Group == "kustomize.config.k8s.io" || gv.Group == "backstage.io")
+}
+
+// stageObjects groups objects by their stage of applyStages, keeping their
+// order within a stage, and leaves out empty stages.
+func stageObjects(objects []*unstructured.Unstructured) [][]*unstructured.Unstructured {
+	stages := make([][]*unstructured.Unstructured, len(applyStages)+1)
+	for _, obj := range objects {
+		i := slices.IndexFunc(applyStages, func(kinds []string) bool { return slices.Contains(kinds, obj.GetKind()) })
+		if i < 0 {
+			i = len(applyStages)
+		}
+		stages[i] = append(stages[i], obj)
+	}
+	return slices.DeleteFunc(stages, func(stage []*unstructured.Unstructured) bool { return len(stage) == 0 })
+}
+
+// objectRef names an object in the output of --apply, as Kind namespace/name.
+func objectRef(obj *unstructured.Unstructured) string {
+	if obj.GetNamespace() == "" {
+		return obj.GetKind() + " " + obj.GetName()
+	}
+	return obj.GetKind() + " " + obj.GetNamespace() + "/" + obj.GetName()
+}
+
+// waitForStage waits for what the objects of stage depend on: the
+// Namespaces among created, which were applied in an earlier stage, to be
+// active, and the parent Gateways of routes to exist. A wait that times out
+// or cannot read the objects it waits for, e.g. without RBAC to get
+// Gateways, is reported and the stage applied anyway, as the API server
+// accepts routes whose Gateway is missing.
+func waitForStage(ctx context.Context, client dynamic.Interface, stage []*unstructured.Unstructured, created []string) error {
+	var namespaces, gateways []string
+	for _, obj := range stage {
+		if ns := obj.GetNamespace(); slices.Contains(created, ns) && !slices.Contains(namespaces, ns) {
+			namespaces = append(namespaces, ns)
+		}
+		if slices.Contains(routeKinds, obj.GetKind()) {
+			for _, gw := range parentGateways(obj) {
+				if !slices.Contains(gateways, gw) {
+					gateways = append(gateways, gw)
+				}
+			}
+		}
+	}
+	for _, ns := range namespaces {
+		err := waitFor(ctx, "Namespace "+ns, func(ctx context.Context) (bool, error) {
+			obj, err := client.Resource(namespacesGVR).Get(ctx, ns, metav1.GetOptions{})
+			if apierrors.IsNotFound(err) {
+				return false, nil
+			}
+			if err != nil {
+				return false, err
+			}
+			phase, _, _ := unstructured.NestedString(obj.Object, "status", "phase")
+			return phase == "Active", nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	for _, gw := range gateways {
+		ns, name, _ := strings.Cut(gw, "/")
+		err := waitFor(ctx, "Gateway "+gw, func(ctx context.Context) (bool, error) {
+			_, err := client.Resource(gatewaysGVR).Namespace(ns).Get(ctx, name, metav1.GetOptions{})
+			if apierrors.IsNotFound(err) {
+				return false, nil
+			}
+			return err == nil, err
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// parentGateways lists the Gateways a route is attached to, as
+// namespace/name.
+func parentGateways(route *unstructured.Unstructured) []string {
+	refs, _, _ := unstructured.NestedSlice(route.Object, "spec", "parentRefs")
+	var gateways []string
+	for _, r := range refs {
+		ref, _ := r.(map[string]any)
+		group, hasGroup := ref["group"].(string)
+		kind, hasKind := ref["kind"].(string)
+		if hasGroup && group != gatewaysGVR.Group || hasKind && kind != "Gateway" {
+			continue
+		}
+		name, _ := ref["name"].(string)
+		ns, _ := ref["namespace"].(string)
+		if ns == "" {
+			ns = route.GetNamespace()
+		}
+		gateways = append(gateways, ns+"/"+name)
+	}
+	return gateways
+}
+
+// waitFor polls ready until it is, for at most --apply-wait. Giving up is
+// reported as a warning, not an error; only a canceled run fails.
+func waitFor(ctx context.Context, what string, ready func(context.Context) (bool, error)) error {
+	if applyWait <= 0 {
+		return nil
+	}
+	deadline := time.Now().Add(applyWait)
+	for waiting := false; ; waiting = true {
+		ok, err := ready(ctx)
+		switch {
+		case ctx.Err() != nil:
+			return ctx.Err()
+		case err != nil:
+			fmt.Fprintf(os.Stderr, "WARNING: cannot wait for %s: %v\n", what, err)
+			return nil
+		case ok:
+			return nil
+		case time.Now().After(deadline):
+			fmt.Fprintf(os.Stderr, "WARNING: %s not ready after %s, applying what depends on it anyway\n", what, applyWait)
+			return nil
+		case !waiting && !quiet:
+			fmt.Printf("Waiting for %s\n", what)
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(applyPollInterval):
+		}
+	}
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+var (
+	backstageCatalog   bool
+	backstageOwner     string
+	backstageLifecycle string
+	backstageSystem    string
+)
+
+// backstageEntities collects one API entity per generated route during a run.
+var backstageEntities []backstageEntity
+
+type backstageEntity struct {
+	APIVersion string            `yaml:"apiVersion"`
+	Kind       string            `yaml:"kind"`
+	Metadata   backstageMetadata `yaml:"metadata"`
+	Spec       backstageAPISpec  `yaml:"spec"`
+}
+
+type backstageMetadata struct {
+	Name        string            `yaml:"name"`
+	Namespace   string            `yaml:"namespace,omitempty"`
+	Description string            `yaml:"description,omitempty"`
+	Annotations map[string]string `yaml:"annotations,omitempty"`
+	Tags        []string          `yaml:"tags,omitempty"`
+}
+
+type backstageAPISpec struct {
+	Type       string `yaml:"type"`
+	Lifecycle  string `yaml:"lifecycle"`
+	Owner      string `yaml:"owner"`
+	System     string `yaml:"system,omitempty"`
+	Definition string `yaml:"definition"`
+}
+
+// collectBackstageEntity records an API entity describing the endpoints of
+// route, with a minimal OpenAPI document as its definition.
+func collectBackstageEntity(route HTTPRoute, endpoints []Endpoint, source string) error {
+	definition, err := openAPIDefinition(route, endpoints)
+	if err != nil {
+		return err
+	}
+	backstageEntities = append(backstageEntities, backstageEntity{
+		APIVersion: "backstage.io/v1alpha1",
+		Kind:       "API",
+		Metadata: backstageMetadata{
+			Name:        route.Metadata.Name,
+			Description: fmt.Sprintf("Endpoints exposed through gateway %s (generated from %s)", route.Spec.ParentRefs[0].Name, filepath.Base(source)),
+			Annotations: map[string]string{
+				"csv2httproute/httproute": route.Metadata.Namespace + "/" + route.Metadata.Name,
+			},
+			Tags: []string{"gateway-api"},
+		},
+		Spec: backstageAPISpec{
+			Type:       "openapi",
+			Lifecycle:  backstageLifecycle,
+			Owner:      backstageOwner,
+			System:     backstageSystem,
+			Definition: definition,
+		},
+	})
+	return nil
+}
+
+// openAPIDefinition renders the endpoints as an OpenAPI 3 document. Rows with
+// a prefix are listed both directly and under their rewritten prefix, since
+// the gateway serves both. Method-less rows only get a path-level description.
+func openAPIDefinition(route HTTPRoute, endpoints []Endpoint) (string, error) {
+	paths := make(map[string]map[string]any)
+	add := func(p string, e Endpoint) {
+		item, ok := paths[p]
+		if !ok {
+			item = make(map[string]any)
+			paths[p] = item
+		}
+		if e.Method == "" {
+			item["description"] = "Routed for all methods. " + e.Comment
+			return
+		}
+		op := map[string]any{
+			"responses": map[string]any{"default": map[string]any{"description": "Backend response"}},
+		}
+		if e.Comment != "" {
+			op["summary"] = e.Comment
+		}
+		if e.Description != "" {
+			op["description"] = e.Description
+		}
+		item[strings.ToLower(e.Method)] = op
+	}
+	for _, e := range endpoints {
+		add(e.URL, e)
+		if e.Prefix != "" {
+			add(path.Join(e.Prefix, e.URL), e)
+		}
+	}
+
+	doc := map[string]any{
+		"openapi": "3.0.3",
+		"info": map[string]any{
+			"title":   route.Metadata.Name,
+			"version": Version,
+		},
+		"paths": paths,
+	}
+	if len(route.Spec.Hostnames) > 0 {
+		var servers []map[string]string
+		for _, h := range route.Spec.Hostnames {
+			servers = append(servers, map[string]string{"url": "https://" + h})
+		}
+		doc["servers"] = servers
+	}
+	var buf bytes.Buffer
+	encoder := newYAMLEncoder(&buf)
+	if err := encoder.Encode(doc); err != nil {
+		return "", err
+	}
+	return buf.String(), encoder.Close()
+}
+
+// writeBackstageCatalog writes all collected entities as one multi-document
+// catalog-info.yaml in the output directory.
+func writeBackstageCatalog() error {
+	if len(backstageEntities) == 0 {
+		return nil
+	}
+	var buf bytes.Buffer
+	encoder := newYAMLEncoder(&buf)
+	for _, entity := range backstageEntities {
+		if err := encoder.Encode(entity); err != nil {
+			return err
+		}
+	}
+	if err := encoder.Close(); err != nil {
+		return err
+	}
+	outPath := outputPath("catalog-info", ".yaml")
+	if err := writeOutputFile(outPath, buf.Bytes()); err != nil {
+		return err
+	}
+	if !quiet {
+		fmt.Printf("Generated %s\n", outPath)
+	}
+	return nil
+}
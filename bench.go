@@ -0,0 +1,233 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+	"runtime/metrics"
+	"slices"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+var (
+	benchIterations  int
+	benchMaxDuration time.Duration
+	benchMaxMemory   string
+)
+
+// benchHeapMetric is the live heap sampled for the peak memory of a run.
+const benchHeapMetric = "/memory/classes/heap/objects:bytes"
+
+func newBenchCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "bench",
+		Short: "Measure parse and generation throughput and enforce a performance budget",
+		Long: `Parses the CSV inventory and generates its routes into a temporary directory
+--iterations times, then prints the minimum, median and maximum duration of
+each phase with the rows per second, the peak heap, and the bytes allocated
+per generation. Nothing is written to --output, applied, signed or published.
+
+With --max-duration the median generation must finish within the budget, and
+with --max-memory its peak heap must stay below it, so CI can catch
+performance regressions as the inventory grows.`,
+		RunE: runBench,
+	}
+	cmd.Flags().StringVarP(&serviceName, "service", "s", "my-service", "Default backend service name")
+	cmd.Flags().IntVarP(&servicePort, "port", "p", 80, "Default backend service port")
+	cmd.Flags().IntVar(&benchIterations, "iterations", 5, "Times each phase is run")
+	cmd.Flags().DurationVar(&benchMaxDuration, "max-duration", 0, "Fail when the median generation takes longer (e.g. 2s)")
+	cmd.Flags().StringVar(&benchMaxMemory, "max-memory", "", "Fail when the peak heap of a generation exceeds this size (e.g. 256Mi)")
+	addGenerateFlags(cmd.Flags(), "generated")
+	return cmd
+}
+
+// benchRun is the measurement of one run of a phase.
+type benchRun struct {
+	Duration  time.Duration
+	PeakHeap  uint64
+	Allocated uint64
+}
+
+func runBench(cmd *cobra.Command, args []string) error {
+	if benchIterations < 1 {
+		return fmt.Errorf("--iterations must be at least 1")
+	}
+	var maxMemory int64
+	if benchMaxMemory != "" {
+		q, err := resource.ParseQuantity(benchMaxMemory)
+		if err != nil {
+			return fmt.Errorf("invalid --max-memory %q: %w", benchMaxMemory, err)
+		}
+		maxMemory = q.Value()
+	}
+	if err := prepareGeneration(cmd.Context()); err != nil {
+		return err
+	}
+	files, _, err := inputFiles(cmd.Context())
+	if err != nil {
+		return err
+	}
+
+	rows := 0
+	var parseRuns []benchRun
+	for range benchIterations {
+		rows = 0
+		run, err := measure(func() error {
+			for _, path := range files {
+				endpoints, err := parseInput(cmd.Context(), path)
+				if err != nil {
+					return fmt.Errorf("%s: %w", path, err)
+				}
+				rows += len(endpoints)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		parseRuns = append(parseRuns, run)
+	}
+
+	tmp, err := os.MkdirTemp("", "csv2httproute-bench-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmp)
+	outputDir = tmp
+	generateOnly()
+	metricsFile, debugBundle = "", ""
+
+	routes := 0
+	var generateRuns []benchRun
+	for range benchIterations {
+		resetRunState()
+		run, err := measure(func() error { return generate(cmd) })
+		if err != nil {
+			return err
+		}
+		routes = runMetrics.routes
+		generateRuns = append(generateRuns, run)
+	}
+
+	fmt.Printf("Inventory: %d file(s), %d row(s), %d route(s); %d iteration(s)\n\n", len(files), rows, routes, benchIterations)
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "PHASE\tMIN\tMEDIAN\tMAX\tROWS/S\tPEAK HEAP\tALLOCATED")
+	for _, phase := range []struct {
+		name string
+		runs []benchRun
+	}{{"parse", parseRuns}, {"generate", generateRuns}} {
+		s := summarizeBench(phase.runs)
+		perSecond := "-"
+		if s.median > 0 {
+			perSecond = fmt.Sprintf("%.0f", float64(rows)/s.median.Seconds())
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n", phase.name, benchDuration(s.min), benchDuration(s.median), benchDuration(s.max),
+			perSecond, formatBytes(s.peakHeap), formatBytes(s.allocated))
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	generation := summarizeBench(generateRuns)
+	var over []string
+	if benchMaxDuration > 0 && generation.median > benchMaxDuration {
+		over = append(over, fmt.Sprintf("median generation took %s, over the --max-duration budget of %s", benchDuration(generation.median), benchMaxDuration))
+	}
+	if maxMemory > 0 && generation.peakHeap > uint64(maxMemory) {
+		over = append(over, fmt.Sprintf("generation peaked at %s of heap, over the --max-memory budget of %s", formatBytes(generation.peakHeap), benchMaxMemory))
+	}
+	for _, o := range over {
+		fmt.Fprintf(os.Stderr, "WARNING: %s\n", o)
+	}
+	if len(over) > 0 {
+		return fmt.Errorf("%d performance budget(s) exceeded", len(over))
+	}
+	return nil
+}
+
+// measure runs f after a garbage collection, so each run starts from the
+// same heap, and samples the live heap every millisecond for its peak.
+func measure(f func() error) (benchRun, error) {
+	runtime.GC()
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+
+	sample := []metrics.Sample{{Name: benchHeapMetric}}
+	var peak uint64
+	done := make(chan struct{})
+	sampled := make(chan struct{})
+	go func() {
+		defer close(sampled)
+		ticker := time.NewTicker(time.Millisecond)
+		defer ticker.Stop()
+		for {
+			metrics.Read(sample)
+			peak = max(peak, sample[0].Value.Uint64())
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+
+	start := time.Now()
+	err := f()
+	elapsed := time.Since(start)
+	close(done)
+	<-sampled
+	runtime.ReadMemStats(&after)
+	metrics.Read(sample)
+	peak = max(peak, sample[0].Value.Uint64())
+	return benchRun{Duration: elapsed, PeakHeap: peak, Allocated: after.TotalAlloc - before.TotalAlloc}, err
+}
+
+type benchSummary struct {
+	min, median, max    time.Duration
+	peakHeap, allocated uint64
+}
+
+// summarizeBench takes the duration spread of runs, their highest peak
+// heap, and the median of their allocations.
+func summarizeBench(runs []benchRun) benchSummary {
+	durations := make([]time.Duration, len(runs))
+	allocated := make([]uint64, len(runs))
+	var s benchSummary
+	for i, r := range runs {
+		durations[i], allocated[i] = r.Duration, r.Allocated
+		s.peakHeap = max(s.peakHeap, r.PeakHeap)
+	}
+	slices.Sort(durations)
+	slices.Sort(allocated)
+	s.min, s.median, s.max = durations[0], durations[len(durations)/2], durations[len(durations)-1]
+	s.allocated = allocated[len(allocated)/2]
+	return s
+}
+
+func benchDuration(d time.Duration) string {
+	switch {
+	case d >= time.Second:
+		return d.Round(time.Millisecond).String()
+	case d >= time.Millisecond:
+		return d.Round(10 * time.Microsecond).String()
+	}
+	return d.Round(time.Microsecond).String()
+}
+
+// formatBytes formats n in binary units, like the quantities of --max-memory.
+func formatBytes(n uint64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%dB", n)
+	}
+	div, exp := uint64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f%ci", float64(n)/float64(div), "KMGTPE"[exp])
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+)
+
+// --canary-service splits the traffic of every rule with a single Service
+// backend between that backend and the canary, for a release that
+// replaces one service behind the whole inventory. Rows with a backends
+// column keep their own split.
+
+var (
+	canaryService string
+	canaryWeight  int
+)
+
+func validateCanary() error {
+	if canaryService == "" {
+		if canaryWeight != 0 {
+			return fmt.Errorf("--canary-weight requires --canary-service")
+		}
+		return nil
+	}
+	if canaryWeight < 0 || canaryWeight > 100 {
+		return fmt.Errorf("invalid --canary-weight %d (must be 0-100)", canaryWeight)
+	}
+	if _, err := parseBackendSpec(canaryService); err != nil {
+		return fmt.Errorf("invalid --canary-service: %w", err)
+	}
+	return nil
+}
+
+// applyCanary adds the --canary-service backend to a rule routing every
+// row of endpoints to one Service, with --canary-weight percent of the
+// traffic. The canary runs in the namespace of the backend unless
+// --service-namespace is set. A weight of 0 keeps the canary on standby.
+func applyCanary(rule *HTTPRouteRule, endpoints []Endpoint) {
+	if canaryService == "" || len(rule.BackendRefs) != 1 || rule.BackendRefs[0].Kind != "Service" {
+		return
+	}
+	if slices.ContainsFunc(endpoints, func(e Endpoint) bool {
+		return e.Backends != "" || e.Fallback != "" || e.Gone || e.ScaleToZero || inMaintenance(e)
+	}) {
+		return
+	}
+	canary, _ := parseBackendSpec(canaryService)
+	primary := rule.BackendRefs[0]
+	if canary.Namespace == "" {
+		canary.Namespace = primary.Namespace
+	}
+	if primary.Name == canary.Name && primary.Namespace == canary.Namespace && primary.Port == canary.Port {
+		return
+	}
+	primary.Weight = 100 - canaryWeight
+	canary.Weight = canaryWeight
+	canary.Standby = canaryWeight == 0
+	rule.BackendRefs = []BackendRef{primary, canary}
+}
@@ -0,0 +1,244 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/arencloud/csv2httproute/pkg/convert"
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+)
+
+// Per-route limits of the HTTPRoute CRD (Gateway API v1.2+). Every
+// implementation enforces them, since the API server rejects larger routes.
+const (
+	maxRulesPerRoute   = convert.MaxRulesPerRoute
+	maxMatchesPerRule  = convert.MaxMatchesPerRule
+	maxMatchesPerRoute = convert.MaxMatchesPerRoute
+)
+
+// gatewayLimit is a quota of one Gateway, as enforced by its implementation
+// or managed offering. Zero means unlimited.
+type gatewayLimit struct {
+	// Gateway is namespace/name, name (any namespace), or "*" for every
+	// Gateway without a more specific entry.
+	Gateway string `yaml:"gateway"`
+	Routes  int    `yaml:"routes,omitempty"`
+	Rules   int    `yaml:"rules,omitempty"`
+	Matches int    `yaml:"matches,omitempty"`
+}
+
+type capacityLimitsFile struct {
+	Limits []gatewayLimit `yaml:"limits"`
+}
+
+var (
+	capacityLimits string
+	capacityBase   string
+	failOnExceed   bool
+)
+
+func newCapacityCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "capacity",
+		Short: "Report routes, rules and matches per Gateway against implementation limits",
+		Long: `Builds the routes from the CSV inventory without writing them and sums their
+routes, rules and matches per parent Gateway. Totals are compared against the
+quotas in --limits, and every route against the HTTPRoute CRD limits of 16
+rules, 64 matches per rule and 128 matches per route.
+
+With --base the totals of a base inventory are shown alongside, so a pending
+change can be checked before it exceeds a quota.`,
+		RunE: runCapacity,
+	}
+	cmd.Flags().StringVarP(&serviceName, "service", "s", "my-service", "Default backend service name")
+	cmd.Flags().IntVarP(&servicePort, "port", "p", 80, "Default backend service port")
+	cmd.Flags().StringVar(&capacityLimits, "limits", "", "YAML file with per-Gateway route, rule and match quotas")
+	cmd.Flags().StringVar(&capacityBase, "base", "", "Directory or CSV file of the base inventory to compare with")
+	cmd.Flags().BoolVar(&failOnExceed, "fail-on-exceed", false, "Exit non-zero when a limit is exceeded")
+	addGenerateFlags(cmd.Flags(), "generated")
+	return cmd
+}
+
+// gatewayUsage is the load the inventory puts on one Gateway.
+type gatewayUsage struct {
+	Routes, Rules, Matches int
+}
+
+func runCapacity(cmd *cobra.Command, args []string) error {
+	if err := prepareGeneration(cmd.Context()); err != nil {
+		return err
+	}
+	limits, err := loadCapacityLimits(cmd.Context(), capacityLimits)
+	if err != nil {
+		return err
+	}
+	routes, err := buildInventory(cmd.Context())
+	if err != nil {
+		return err
+	}
+	usage := capacityUsage(routes)
+	var base map[string]gatewayUsage
+	if capacityBase != "" {
+		input := inputDir
+		inputDir = capacityBase
+		baseRoutes, err := buildInventory(cmd.Context())
+		inputDir = input
+		if err != nil {
+			return fmt.Errorf("base: %w", err)
+		}
+		base = capacityUsage(baseRoutes)
+	}
+
+	var warnings []string
+	for _, r := range routes {
+		warnings = append(warnings, routeLimitWarnings(r)...)
+	}
+
+	gateways := make([]string, 0, len(usage))
+	for gw := range usage {
+		gateways = append(gateways, gw)
+	}
+	for gw := range base {
+		if _, ok := usage[gw]; !ok {
+			gateways = append(gateways, gw)
+		}
+	}
+	sort.Strings(gateways)
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "GATEWAY\tROUTES\tRULES\tMATCHES")
+	for _, gw := range gateways {
+		u, limit := usage[gw], limitFor(limits, gw)
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", gw,
+			capacityCell(base, gw, u.Routes, func(b gatewayUsage) int { return b.Routes }, limit.Routes),
+			capacityCell(base, gw, u.Rules, func(b gatewayUsage) int { return b.Rules }, limit.Rules),
+			capacityCell(base, gw, u.Matches, func(b gatewayUsage) int { return b.Matches }, limit.Matches))
+		for _, c := range []struct {
+			what       string
+			got, limit int
+		}{{"routes", u.Routes, limit.Routes}, {"rules", u.Rules, limit.Rules}, {"matches", u.Matches, limit.Matches}} {
+			if c.limit > 0 && c.got > c.limit {
+				warnings = append(warnings, fmt.Sprintf("gateway %s: %d %s exceed the quota of %d", gw, c.got, c.what, c.limit))
+			}
+		}
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	for _, warning := range warnings {
+		fmt.Fprintf(os.Stderr, "WARNING: %s\n", warning)
+	}
+	if failOnExceed && len(warnings) > 0 {
+		return fmt.Errorf("%d limit(s) exceeded", len(warnings))
+	}
+	return nil
+}
+
+func loadCapacityLimits(ctx context.Context, path string) ([]gatewayLimit, error) {
+	if path == "" {
+		return nil, nil
+	}
+	data, err := readInput(ctx, path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read limits: %w", err)
+	}
+	var f capacityLimitsFile
+	if err := yaml.Unmarshal(data, &f); err != nil {
+		return nil, fmt.Errorf("failed to parse limits %s: %w", path, err)
+	}
+	for i, l := range f.Limits {
+		if l.Gateway == "" {
+			return nil, fmt.Errorf("limits entry %d: gateway is required", i+1)
+		}
+	}
+	return f.Limits, nil
+}
+
+// limitFor returns the most specific quota of gateway (namespace/name):
+// an exact entry, then one naming the Gateway in any namespace, then "*".
+func limitFor(limits []gatewayLimit, gateway string) gatewayLimit {
+	name := gateway[strings.LastIndex(gateway, "/")+1:]
+	var byName, wildcard *gatewayLimit
+	for i := range limits {
+		switch limits[i].Gateway {
+		case gateway:
+			return limits[i]
+		case name:
+			byName = &limits[i]
+		case "*":
+			wildcard = &limits[i]
+		}
+	}
+	if byName != nil {
+		return *byName
+	}
+	if wildcard != nil {
+		return *wildcard
+	}
+	return gatewayLimit{}
+}
+
+// capacityUsage sums routes, rules and matches per parent Gateway. A route
+// attached to several Gateways counts against each.
+func capacityUsage(routes []HTTPRoute) map[string]gatewayUsage {
+	usage := make(map[string]gatewayUsage)
+	for _, r := range routes {
+		matches := 0
+		for _, rule := range r.Spec.Rules {
+			matches += max(len(rule.Matches), 1)
+		}
+		for _, p := range r.Spec.ParentRefs {
+			ns := p.Namespace
+			if ns == "" {
+				ns = r.Metadata.Namespace
+			}
+			key := ns + "/" + p.Name
+			u := usage[key]
+			u.Routes++
+			u.Rules += len(r.Spec.Rules)
+			u.Matches += matches
+			usage[key] = u
+		}
+	}
+	return usage
+}
+
+// routeLimitWarnings checks route against the HTTPRoute CRD limits.
+func routeLimitWarnings(r HTTPRoute) []string {
+	var warnings []string
+	if n := len(r.Spec.Rules); n > maxRulesPerRoute {
+		warnings = append(warnings, fmt.Sprintf("route %s: %d rules exceed the HTTPRoute limit of %d", r.Metadata.Name, n, maxRulesPerRoute))
+	}
+	total := 0
+	for i, rule := range r.Spec.Rules {
+		total += len(rule.Matches)
+		if n := len(rule.Matches); n > maxMatchesPerRule {
+			warnings = append(warnings, fmt.Sprintf("route %s rule %d: %d matches exceed the HTTPRoute limit of %d", r.Metadata.Name, i, n, maxMatchesPerRule))
+		}
+	}
+	if total > maxMatchesPerRoute {
+		warnings = append(warnings, fmt.Sprintf("route %s: %d matches exceed the HTTPRoute limit of %d", r.Metadata.Name, total, maxMatchesPerRoute))
+	}
+	return warnings
+}
+
+// capacityCell formats a usage count, with the base count and the quota
+// when known, e.g. "42 (was 40) / 50".
+func capacityCell(base map[string]gatewayUsage, gw string, got int, field func(gatewayUsage) int, limit int) string {
+	cell := fmt.Sprint(got)
+	if base != nil {
+		if b := field(base[gw]); b != got {
+			cell += fmt.Sprintf(" (was %d)", b)
+		}
+	}
+	if limit > 0 {
+		cell += fmt.Sprintf(" / %d", limit)
+	}
+	return cell
+}
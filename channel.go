@@ -0,0 +1,121 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// Gateway API release channels accepted by --channel.
+const (
+	channelStandard     = "standard"
+	channelExperimental = "experimental"
+)
+
+// defaultGatewayAPIVersion is the Gateway API release targeted without
+// --gateway-api-version.
+const defaultGatewayAPIVersion = "v1.2.1"
+
+// gatewayAPIVersion is --gateway-api-version, the Gateway API release of the
+// target CRDs, which picks the versions of the kinds that graduated between
+// releases.
+var gatewayAPIVersion = defaultGatewayAPIVersion
+
+// validateGatewayAPIVersion checks the --gateway-api-version flag value.
+func validateGatewayAPIVersion() error {
+	if _, _, ok := parseGatewayAPIVersion(gatewayAPIVersion); !ok {
+		return fmt.Errorf("invalid --gateway-api-version %q (want a release such as %s)", gatewayAPIVersion, defaultGatewayAPIVersion)
+	}
+	return nil
+}
+
+// parseGatewayAPIVersion returns the major and minor version of a release
+// such as v1.2.1 or v1.3.0-rc.1.
+func parseGatewayAPIVersion(v string) (major, minor int, ok bool) {
+	s, ok := strings.CutPrefix(v, "v")
+	parts := strings.SplitN(s, ".", 3)
+	if !ok || len(parts) < 2 {
+		return 0, 0, false
+	}
+	major, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return 0, 0, false
+	}
+	minor, err = strconv.Atoi(parts[1])
+	return major, minor, err == nil
+}
+
+// gatewayAPIAtLeast reports whether --gateway-api-version is release
+// major.minor or a later one.
+func gatewayAPIAtLeast(major, minor int) bool {
+	m, n, _ := parseGatewayAPIVersion(gatewayAPIVersion)
+	return m > major || (m == major && n >= minor)
+}
+
+// validateChannel checks the --channel flag value.
+func validateChannel(channel string) error {
+	switch channel {
+	case channelStandard, channelExperimental:
+		return nil
+	}
+	return fmt.Errorf("invalid --channel %q (must be %s or %s)", channel, channelStandard, channelExperimental)
+}
+
+// checkChannel rejects routes that set experimental-channel fields unless the
+// experimental channel was opted into. Standard-channel CRDs prune unknown
+// fields, so emitting them there would silently drop configuration.
+func checkChannel(route HTTPRoute) error {
+	if gatewayChannel == channelExperimental {
+		return nil
+	}
+	fields := experimentalFields(reflect.ValueOf(route), "")
+	if len(fields) == 0 {
+		return nil
+	}
+	return fmt.Errorf("route %s uses experimental-channel fields (%s); pass --channel %s to emit them",
+		route.Metadata.Name, strings.Join(fields, ", "), channelExperimental)
+}
+
+// experimentalFields walks v and returns the YAML paths of every non-zero
+// struct field tagged `gateway:"experimental"`.
+func experimentalFields(v reflect.Value, path string) []string {
+	switch v.Kind() {
+	case reflect.Pointer, reflect.Interface:
+		if v.IsNil() {
+			return nil
+		}
+		return experimentalFields(v.Elem(), path)
+	case reflect.Slice, reflect.Array:
+		var fields []string
+		for i := 0; i < v.Len(); i++ {
+			fields = append(fields, experimentalFields(v.Index(i), fmt.Sprintf("%s[%d]", path, i))...)
+		}
+		return fields
+	case reflect.Struct:
+		var fields []string
+		t := v.Type()
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			if !f.IsExported() {
+				continue
+			}
+			name, _, _ := strings.Cut(f.Tag.Get("yaml"), ",")
+			if name == "" {
+				name = strings.ToLower(f.Name)
+			}
+			fieldPath := name
+			if path != "" {
+				fieldPath = path + "." + name
+			}
+			fv := v.Field(i)
+			if f.Tag.Get("gateway") == "experimental" && !fv.IsZero() {
+				fields = append(fields, fieldPath)
+				continue
+			}
+			fields = append(fields, experimentalFields(fv, fieldPath)...)
+		}
+		return fields
+	}
+	return nil
+}
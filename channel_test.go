@@ -0,0 +1,58 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/arencloud/csv2httproute/pkg/convert"
+)
+
+func TestCheckChannel(t *testing.T) {
+	tests := []struct {
+		name  string
+		route HTTPRoute
+		field string
+	}{
+		{
+			name: "standard fields",
+			route: HTTPRoute{Spec: HTTPRouteSpec{
+				ParentRefs: []ParentRef{{Name: "public", SectionName: "https"}},
+				Rules:      []HTTPRouteRule{{BackendRefs: []BackendRef{{Name: "orders", Port: 80}}}},
+			}},
+		},
+		{
+			name: "retry",
+			route: HTTPRoute{Spec: HTTPRouteSpec{
+				Rules: []HTTPRouteRule{{Retry: &convert.HTTPRouteRetry{Attempts: 3}}},
+			}},
+			field: "spec.rules[0].retry",
+		},
+		{
+			name: "parent port",
+			route: HTTPRoute{Spec: HTTPRouteSpec{
+				ParentRefs: []ParentRef{{Name: "public", Port: 443}},
+			}},
+			field: "spec.parentRefs[0].port",
+		},
+	}
+	defer func(channel string) { gatewayChannel = channel }(gatewayChannel)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.route.Metadata.Name = "orders"
+			gatewayChannel = channelStandard
+			err := checkChannel(tt.route)
+			switch {
+			case tt.field == "" && err != nil:
+				t.Errorf("standard channel: unexpected error: %v", err)
+			case tt.field != "" && err == nil:
+				t.Errorf("standard channel: no error for %s", tt.field)
+			case tt.field != "" && !strings.Contains(err.Error(), tt.field):
+				t.Errorf("standard channel: error %q does not name %s", err, tt.field)
+			}
+			gatewayChannel = channelExperimental
+			if err := checkChannel(tt.route); err != nil {
+				t.Errorf("experimental channel: unexpected error: %v", err)
+			}
+		})
+	}
+}
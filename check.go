@@ -0,0 +1,127 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+// checkMode is --check: regenerate into a scratch directory and list the
+// committed files that differ, without touching the output directory.
+var checkMode bool
+
+// generatedMarker identifies files written by this tool in the output
+// directory; only those are reported as stale when no longer produced.
+const generatedMarker = "Code generated by csv2httproute"
+
+// regenerateLine is the header line recording the invocation, which differs
+// between equivalent runs (e.g. with and without -q).
+var regenerateLine = regexp.MustCompile(`(?m)^# Regenerate with: .*\n`)
+
+func stripRegenerateLine(content string) string {
+	return regenerateLine.ReplaceAllString(content, "")
+}
+
+// generateOnly turns off everything of a run beyond writing the route files,
+// for commands that regenerate into a temporary directory to compare.
+func generateOnly() {
+	generateOnlyFor()
+}
+
+// generateOnlyFor is generateOnly for one run of a process that goes on to
+// generate for real, such as a watch preview. The returned function
+// restores the flags.
+//
+// It holds the one list of side outputs, so a new one is turned off by
+// every command that only generates once it is added here.
+func generateOnlyFor() (restore func()) {
+	restores := []func(){
+		setFlag(&quiet, true),
+		setFlag(&signTool, ""),
+		setFlag(&pushOCI, ""),
+		setFlag(&resourceManifest, ""),
+		setFlag(&testVectorsFile, ""),
+		setFlag(&emitModel, ""),
+		setFlag(&grafanaDashboard, ""),
+		setFlag(&backstageCatalog, false),
+		setFlag(&rbacServiceAccount, ""),
+		setFlag(&createNamespaces, false),
+		setFlag(&kustomize, false),
+		setFlag(&applyRoutes, false),
+		setFlag(&sinkSpecs, []string{"files"}),
+		setFlag(&ownerFlag, ""),
+		setFlag(&historyReadOnly, true),
+		setFlag(&incremental, false),
+		setFlag(&prune, false),
+		setFlag(&runReportFormat, reportText),
+	}
+	return func() {
+		for _, restore := range restores {
+			restore()
+		}
+	}
+}
+
+// setFlag sets *flag to v and returns the function that sets it back.
+func setFlag[T any](flag *T, v T) (restore func()) {
+	old := *flag
+	*flag = v
+	return func() { *flag = old }
+}
+
+// runCheck regenerates into a temporary directory and prints the files of
+// the output directory whose content would change, one per line like
+// gofmt -l. Generated files that would no longer be produced are listed too.
+// It fails when any file is stale.
+func runCheck(cmd *cobra.Command, args []string) error {
+	committed := outputDir
+	tmp, err := os.MkdirTemp("", "csv2httproute-check-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmp)
+
+	checkMode = false
+	outputDir = tmp
+	generateOnly()
+	existingOutputDir = committed
+	err = run(cmd, args)
+	outputDir, existingOutputDir = committed, ""
+	if err != nil {
+		return err
+	}
+
+	got, err := readTree(tmp)
+	if err != nil {
+		return err
+	}
+	want, err := readTree(committed)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	var stale []string
+	for name, content := range got {
+		if old, ok := want[name]; !ok || stripRegenerateLine(old) != stripRegenerateLine(content) {
+			stale = append(stale, name)
+		}
+	}
+	for name, content := range want {
+		if _, ok := got[name]; !ok && !isSignatureFile(name) && strings.Contains(content, generatedMarker) {
+			stale = append(stale, name)
+		}
+	}
+	sort.Strings(stale)
+	for _, name := range stale {
+		fmt.Println(filepath.Join(committed, filepath.FromSlash(name)))
+	}
+	if len(stale) > 0 {
+		return fmt.Errorf("%d file(s) in %s are out of date with the CSV inventory", len(stale), committed)
+	}
+	return nil
+}
@@ -0,0 +1,21 @@
+package main
+
+import "testing"
+
+func TestGenerateOnlyFor(t *testing.T) {
+	defer func(b, k, n bool, rbac string) {
+		backstageCatalog, kustomize, createNamespaces, rbacServiceAccount = b, k, n, rbac
+	}(backstageCatalog, kustomize, createNamespaces, rbacServiceAccount)
+	backstageCatalog, kustomize, createNamespaces, rbacServiceAccount = true, true, true, "ci/deployer"
+
+	restore := generateOnlyFor()
+	if backstageCatalog || kustomize || createNamespaces || rbacServiceAccount != "" {
+		t.Errorf("side outputs left on: --backstage=%t --kustomize=%t --create-namespaces=%t --rbac-service-account=%q",
+			backstageCatalog, kustomize, createNamespaces, rbacServiceAccount)
+	}
+	restore()
+	if !backstageCatalog || !kustomize || !createNamespaces || rbacServiceAccount != "ci/deployer" {
+		t.Errorf("flags not restored: --backstage=%t --kustomize=%t --create-namespaces=%t --rbac-service-account=%q",
+			backstageCatalog, kustomize, createNamespaces, rbacServiceAccount)
+	}
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// noColor is --no-color: plain output even on a terminal.
+var noColor bool
+
+// ANSI SGR sequences of the pretty output.
+const (
+	ansiReset  = "\x1b[0m"
+	ansiBold   = "\x1b[1m"
+	ansiRed    = "\x1b[31m"
+	ansiGreen  = "\x1b[32m"
+	ansiYellow = "\x1b[33m"
+	ansiCyan   = "\x1b[36m"
+)
+
+// colorOutput reports whether stdout gets the pretty output: it is a
+// terminal, and neither --no-color nor the NO_COLOR convention
+// (https://no-color.org) turned colors off.
+func colorOutput() bool {
+	if noColor || os.Getenv("NO_COLOR") != "" || os.Getenv("TERM") == "dumb" {
+		return false
+	}
+	fi, err := os.Stdout.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice != 0
+}
+
+// colorize wraps s in the SGR sequence code when colors are on.
+func colorize(code, s string) string {
+	if !colorOutput() {
+		return s
+	}
+	return code + s + ansiReset
+}
+
+// colorDiff colors the lines of a unified diff: file headers bold, hunk
+// headers cyan, removals red and additions green.
+func colorDiff(diff string) string {
+	if diff == "" || !colorOutput() {
+		return diff
+	}
+	lines := strings.SplitAfter(diff, "\n")
+	for i, l := range lines {
+		code := ""
+		switch {
+		case strings.HasPrefix(l, "--- "), strings.HasPrefix(l, "+++ "):
+			code = ansiBold
+		case strings.HasPrefix(l, "@@"):
+			code = ansiCyan
+		case strings.HasPrefix(l, "-"):
+			code = ansiRed
+		case strings.HasPrefix(l, "+"):
+			code = ansiGreen
+		}
+		if code != "" {
+			lines[i] = code + strings.TrimSuffix(l, "\n") + ansiReset + "\n"
+		}
+	}
+	return strings.Join(lines, "")
+}
+
+// printGenerated prints the line for a generated route file. On a terminal
+// it is a summary with the rule and match counts of the route.
+func printGenerated(path string, route HTTPRoute) {
+	if !colorOutput() {
+		fmt.Printf("Generated %s\n", path)
+		return
+	}
+	matches := 0
+	for _, rule := range route.Spec.Rules {
+		matches += len(rule.Matches)
+	}
+	counts := fmt.Sprintf("(%d rule(s), %d match(es))", len(route.Spec.Rules), matches)
+	fmt.Printf("%s %s %s\n", colorize(ansiGreen, "Generated"), colorize(ansiBold, path), colorize(ansiCyan, counts))
+}
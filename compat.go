@@ -0,0 +1,502 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/arencloud/csv2httproute/pkg/router"
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+)
+
+var (
+	compatFormat   string
+	failOnBreaking bool
+)
+
+func newCompatCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "compat OLD NEW",
+		Short: "Classify the routing changes between two generated trees",
+		Long: `Compares the HTTPRoutes of two directories of generated YAML, such as the
+output of the last release and of the current inventory, by what they route
+rather than by their text, and classifies every change:
+
+  breaking  a match or hostname that is no longer served, or now only caught
+            by a broader rule
+  additive  a new match or hostname
+  neutral   a changed backend or filter of a match that is still served, or
+            matches moved between routes (renames, shards)
+
+The report is Markdown, ready for release notes, or JSON with --format json.
+
+With --risk every change is also scored low, medium or high by rules of its
+kind, path type, hostname, route and share of the traffic of --prometheus,
+the built-in ones or those of --risk-rules; --max-risk fails reports with a
+riskier change, so approval workflows can pass the others on their own.`,
+		Args: cobra.ExactArgs(2),
+		RunE: runCompat,
+	}
+	cmd.Flags().StringVar(&compatFormat, "format", "markdown", "Output format: markdown or json")
+	cmd.Flags().BoolVar(&failOnBreaking, "fail-on-breaking", false, "Exit non-zero if any change is breaking")
+	addRiskFlags(cmd.Flags())
+	return cmd
+}
+
+// compatReport lists the changes between two trees by class.
+type compatReport struct {
+	Breaking []string    `json:"breaking"`
+	Additive []string    `json:"additive"`
+	Neutral  []string    `json:"neutral"`
+	Risk     *riskReport `json:"risk,omitempty"`
+
+	// changes are the changes of all classes, for the risk rules.
+	changes []compatChange
+}
+
+// compatChange is a change of a report with what the risk rules match: its
+// kinds, hostname, route and match, which is that of the old tree when old.
+type compatChange struct {
+	text  string
+	kinds []string
+	host  string
+	route *router.HTTPRoute
+	match *compatMatch
+	old   bool
+}
+
+// add lists c under class.
+func (r *compatReport) add(class *[]string, c compatChange) {
+	*class = append(*class, c.text)
+	r.changes = append(r.changes, c)
+}
+
+// compatMatch is one match of a generated rule on one hostname; index is
+// its position in the matches of the rule.
+type compatMatch struct {
+	host  string
+	route *router.HTTPRoute
+	rule  *router.Rule
+	index int
+	match router.RouteMatch
+}
+
+func runCompat(cmd *cobra.Command, args []string) error {
+	if compatFormat != "markdown" && compatFormat != "json" {
+		return fmt.Errorf("invalid --format %q (must be markdown or json)", compatFormat)
+	}
+	if err := validateMaxRisk(); err != nil {
+		return err
+	}
+	if (prometheusURL == "") != (prometheusQuery == "") {
+		return fmt.Errorf("--prometheus and --query go together")
+	}
+	riskEnabled = riskEnabled || riskRulesFile != "" || maxRisk != "" || prometheusURL != ""
+	var rules riskRules
+	if riskEnabled {
+		var err error
+		if rules, err = loadRiskRules(cmd.Context()); err != nil {
+			return err
+		}
+	}
+	oldTable, err := loadRouteTree(args[0])
+	if err != nil {
+		return err
+	}
+	newTable, err := loadRouteTree(args[1])
+	if err != nil {
+		return err
+	}
+	report := compareTables(oldTable, newTable)
+	if riskEnabled {
+		var traffic []float64
+		if prometheusURL != "" {
+			if traffic, err = changeTraffic(cmd.Context(), report, oldTable, newTable); err != nil {
+				return err
+			}
+		}
+		report.Risk = scoreRisk(report, rules, traffic)
+	}
+
+	if compatFormat == "json" {
+		data, err := json.MarshalIndent(report, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(data))
+	} else {
+		printCompatReport(report)
+	}
+	if failOnBreaking && len(report.Breaking) > 0 {
+		return fmt.Errorf("%d breaking routing change(s)", len(report.Breaking))
+	}
+	if maxRisk != "" && riskRank(report.Risk.Level) > riskRank(maxRisk) {
+		return fmt.Errorf("routing changes of %s risk, above --max-risk %s", report.Risk.Level, maxRisk)
+	}
+	return nil
+}
+
+// loadRouteTree loads the HTTPRoutes of every YAML file below dir.
+func loadRouteTree(dir string) (*router.Table, error) {
+	if _, err := os.Stat(dir); err != nil {
+		return nil, err
+	}
+	var paths []string
+	err := filepath.WalkDir(dir, func(path string, d os.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		if ext := filepath.Ext(path); ext == ".yaml" || ext == ".yml" {
+			paths = append(paths, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return router.LoadFiles(paths...)
+}
+
+// compareTables classifies the changes from old to new. Every match of old
+// is replayed as a request against new: served by the same match it can
+// only have changed neutrally, served by another (broader) match or not at
+// all it broke. Matches of hostnames that appear or disappear entirely are
+// summarized per hostname.
+func compareTables(oldTable, newTable *router.Table) compatReport {
+	oldMatches, newMatches := tableMatches(oldTable), tableMatches(newTable)
+	oldHosts, newHosts := matchHosts(oldMatches), matchHosts(newMatches)
+	newByKey := make(map[string]compatMatch, len(newMatches))
+	for _, m := range newMatches {
+		newByKey[matchKey(m)] = m
+	}
+	oldKeys := make(map[string]bool, len(oldMatches))
+
+	report := compatReport{Breaking: []string{}, Additive: []string{}, Neutral: []string{}}
+	for host, n := range oldHosts {
+		if _, ok := newHosts[host]; !ok {
+			report.add(&report.Breaking, compatChange{
+				text:  fmt.Sprintf("%s is no longer served (%d match(es))", hostLabel(host), n),
+				kinds: []string{riskHostnameRemoved}, host: host,
+			})
+		}
+	}
+	for host, n := range newHosts {
+		if _, ok := oldHosts[host]; !ok {
+			report.add(&report.Additive, compatChange{
+				text:  fmt.Sprintf("%s is now served (%d match(es))", hostLabel(host), n),
+				kinds: []string{riskHostnameAdded}, host: host,
+			})
+		}
+	}
+
+	moves := make(map[string]int)
+	for i := range oldMatches {
+		m := &oldMatches[i]
+		key := matchKey(*m)
+		oldKeys[key] = true
+		if _, ok := newHosts[m.host]; !ok {
+			continue
+		}
+		if same, ok := newByKey[key]; ok {
+			if changes, kinds := ruleChanges(m.rule, same.rule); changes != "" {
+				report.add(&report.Neutral, compatChange{
+					text:  fmt.Sprintf("`%s`: %s", describeMatch(*m), changes),
+					kinds: kinds, host: m.host, route: same.route, match: &same,
+				})
+			}
+			if from, to := routeID(m.route), routeID(same.route); from != to {
+				moves[from+" to "+to]++
+			}
+			continue
+		}
+		removed := compatChange{
+			text:  fmt.Sprintf("Removed `%s` (route %s)", describeMatch(*m), routeID(m.route)),
+			kinds: []string{riskMatchRemoved}, host: m.host, route: m.route, match: m, old: true,
+		}
+		if req, ok := sampleRequest(*m); ok {
+			if res, ok := newTable.MatchRequest(req); ok {
+				now := compatMatch{host: m.host, route: res.Route, rule: res.Rule, match: matchAt(res)}
+				removed.text += fmt.Sprintf("; its requests now fall through to `%s` (route %s)", describeMatch(now), routeID(res.Route))
+			}
+		}
+		report.add(&report.Breaking, removed)
+	}
+	for i := range newMatches {
+		m := &newMatches[i]
+		if _, ok := oldHosts[m.host]; ok && !oldKeys[matchKey(*m)] {
+			report.add(&report.Additive, compatChange{
+				text:  fmt.Sprintf("Added `%s` (route %s)", describeMatch(*m), routeID(m.route)),
+				kinds: []string{riskMatchAdded}, host: m.host, route: m.route, match: m,
+			})
+		}
+	}
+	for move, n := range moves {
+		report.add(&report.Neutral, compatChange{
+			text:  fmt.Sprintf("%d match(es) moved from route %s", n, move),
+			kinds: []string{riskRouteMoved},
+		})
+	}
+	sort.Strings(report.Breaking)
+	sort.Strings(report.Additive)
+	sort.Strings(report.Neutral)
+	return report
+}
+
+// tableMatches lists every match of the table once per hostname; a route
+// without hostnames serves "*".
+func tableMatches(t *router.Table) []compatMatch {
+	var matches []compatMatch
+	for _, route := range t.Routes() {
+		hosts := route.Spec.Hostnames
+		if len(hosts) == 0 {
+			hosts = []string{"*"}
+		}
+		for i := range route.Spec.Rules {
+			rule := &route.Spec.Rules[i]
+			ms := rule.Matches
+			if len(ms) == 0 {
+				ms = []router.RouteMatch{{}}
+			}
+			for _, host := range hosts {
+				for j, m := range ms {
+					matches = append(matches, compatMatch{host: host, route: route, rule: rule, index: j, match: m})
+				}
+			}
+		}
+	}
+	return matches
+}
+
+// hostLabel names a hostname for the report; "*" stands for the routes
+// without hostnames.
+func hostLabel(host string) string {
+	if host == "*" {
+		return "Any hostname (routes without hostnames)"
+	}
+	return "Hostname `" + host + "`"
+}
+
+func matchHosts(matches []compatMatch) map[string]int {
+	hosts := make(map[string]int)
+	for _, m := range matches {
+		hosts[m.host]++
+	}
+	return hosts
+}
+
+func matchAt(res *router.Result) router.RouteMatch {
+	if res.MatchIndex < len(res.Rule.Matches) {
+		return res.Rule.Matches[res.MatchIndex]
+	}
+	return router.RouteMatch{}
+}
+
+// compatPath returns the path match of m with the defaults of the CRD.
+func compatPath(m router.RouteMatch) (typ, value string) {
+	typ, value = "PathPrefix", "/"
+	if m.Path != nil {
+		if m.Path.Type != "" {
+			typ = m.Path.Type
+		}
+		if m.Path.Value != "" {
+			value = m.Path.Value
+		}
+	}
+	return typ, value
+}
+
+// matchKey identifies a match on a hostname regardless of its route.
+func matchKey(m compatMatch) string {
+	typ, value := compatPath(m.match)
+	var headers, query []string
+	for _, h := range m.match.Headers {
+		headers = append(headers, strings.ToLower(h.Name)+"="+h.Value)
+	}
+	for _, q := range m.match.QueryParams {
+		query = append(query, q.Name+"="+q.Value)
+	}
+	sort.Strings(headers)
+	sort.Strings(query)
+	return strings.Join([]string{m.host, m.match.Method, typ, value, strings.Join(headers, ";"), strings.Join(query, "&")}, "\x00")
+}
+
+// describeMatch renders a match for the report, e.g.
+// "GET shop.example.com/api/users (PathPrefix)", or "ANY /api (PathPrefix)"
+// for any method on any hostname.
+func describeMatch(m compatMatch) string {
+	typ, value := compatPath(m.match)
+	method, host := m.match.Method, m.host
+	if method == "" {
+		method = "ANY"
+	}
+	if host == "*" {
+		host = ""
+	}
+	s := fmt.Sprintf("%s %s%s (%s)", method, host, value, typ)
+	var extra []string
+	for _, h := range m.match.Headers {
+		extra = append(extra, h.Name+": "+h.Value)
+	}
+	for _, q := range m.match.QueryParams {
+		extra = append(extra, "?"+q.Name+"="+q.Value)
+	}
+	if len(extra) > 0 {
+		s += " [" + strings.Join(extra, ", ") + "]"
+	}
+	return s
+}
+
+// sampleRequest derives a request that m matches, which regular
+// expression matches have none of.
+func sampleRequest(m compatMatch) (router.Request, bool) {
+	typ, value := compatPath(m.match)
+	if typ == "RegularExpression" {
+		return router.Request{}, false
+	}
+	req := router.Request{Method: m.match.Method, Host: m.host, Path: value, Headers: make(map[string][]string), Query: make(map[string][]string)}
+	if req.Method == "" {
+		req.Method = "GET"
+	}
+	if req.Host == "*" {
+		req.Host = ""
+	} else if strings.HasPrefix(req.Host, "*.") {
+		req.Host = "www" + req.Host[1:]
+	}
+	for _, h := range m.match.Headers {
+		if h.Type == "RegularExpression" {
+			return router.Request{}, false
+		}
+		req.Headers.Set(h.Name, h.Value)
+	}
+	for _, q := range m.match.QueryParams {
+		if q.Type == "RegularExpression" {
+			return router.Request{}, false
+		}
+		req.Query.Set(q.Name, q.Value)
+	}
+	return req, true
+}
+
+// ruleChanges describes how the outcome of a match changed between the
+// rules serving it, with the risk kinds of the changes, or returns "" when
+// it did not.
+func ruleChanges(old, new *router.Rule) (string, []string) {
+	var changes, kinds []string
+	if from, to := describeBackends(old.BackendRefs), describeBackends(new.BackendRefs); from != to {
+		changes = append(changes, fmt.Sprintf("backends %s → %s", from, to))
+		kinds = append(kinds, riskBackendsChanged)
+	}
+	if from, to := describeFilters(old.Filters), describeFilters(new.Filters); from != to {
+		changes = append(changes, fmt.Sprintf("filters %s → %s", from, to))
+		kinds = append(kinds, riskFiltersChanged)
+	}
+	return strings.Join(changes, "; "), kinds
+}
+
+func describeBackends(refs []router.BackendRef) string {
+	if len(refs) == 0 {
+		return "none"
+	}
+	var parts []string
+	for _, b := range refs {
+		s := fmt.Sprintf("%s:%d", b.Name, b.Port)
+		if b.Namespace != "" {
+			s = b.Namespace + "/" + s
+		}
+		if b.Kind != "" && b.Kind != "Service" {
+			s = b.Kind + " " + s
+		}
+		if len(refs) > 1 {
+			weight := b.Weight
+			if weight == 0 {
+				weight = 1
+			}
+			s += fmt.Sprintf(" (weight %d)", weight)
+		}
+		parts = append(parts, s)
+	}
+	slices.Sort(parts)
+	return strings.Join(parts, ", ")
+}
+
+// describeFilters renders filters as compact YAML, so any difference in
+// their configuration shows.
+func describeFilters(filters []map[string]any) string {
+	if len(filters) == 0 {
+		return "none"
+	}
+	var parts []string
+	for _, f := range filters {
+		var node yaml.Node
+		if err := node.Encode(f); err != nil {
+			parts = append(parts, fmt.Sprint(f))
+			continue
+		}
+		setFlowStyle(&node)
+		data, _ := yaml.Marshal(&node)
+		parts = append(parts, strings.TrimSpace(string(data)))
+	}
+	return strings.Join(parts, ", ")
+}
+
+func setFlowStyle(node *yaml.Node) {
+	node.Style |= yaml.FlowStyle
+	for _, child := range node.Content {
+		setFlowStyle(child)
+	}
+}
+
+func routeID(route *router.HTTPRoute) string {
+	ns := route.Metadata.Namespace
+	if ns == "" {
+		ns = "default"
+	}
+	return ns + "/" + route.Metadata.Name
+}
+
+func printCompatReport(report compatReport) {
+	risks := make(map[string]string)
+	if report.Risk != nil {
+		for _, c := range report.Risk.Changes {
+			risks[c.Change] = c.Risk
+		}
+	}
+	for _, section := range []struct {
+		title   string
+		changes []string
+	}{
+		{"Breaking changes", report.Breaking},
+		{"Additive changes", report.Additive},
+		{"Neutral changes", report.Neutral},
+	} {
+		if len(section.changes) == 0 {
+			continue
+		}
+		fmt.Printf("## %s\n\n", section.title)
+		for _, change := range section.changes {
+			if level, ok := risks[change]; ok {
+				fmt.Printf("- %s (**%s** risk)\n", change, level)
+				continue
+			}
+			fmt.Printf("- %s\n", change)
+		}
+		fmt.Println()
+	}
+	if len(report.Breaking)+len(report.Additive)+len(report.Neutral) == 0 {
+		fmt.Println("No routing changes.")
+		return
+	}
+	fmt.Printf("%d breaking, %d additive, %d neutral change(s)\n", len(report.Breaking), len(report.Additive), len(report.Neutral))
+	if report.Risk != nil {
+		counts := make(map[string]int)
+		for _, c := range report.Risk.Changes {
+			counts[c.Risk]++
+		}
+		fmt.Printf("Risk: %s (%d high, %d medium, %d low)\n", report.Risk.Level, counts["high"], counts["medium"], counts["low"])
+	}
+}
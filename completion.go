@@ -0,0 +1,64 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"github.com/spf13/cobra"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// completionTimeout bounds cluster lookups so an unreachable API server
+// never stalls the shell.
+const completionTimeout = 2 * time.Second
+
+// registerCompletions wires dynamic flag completions into cmd. Cluster-backed
+// completions use the current kubeconfig context and silently fall back to no
+// suggestions when it is unavailable.
+func registerCompletions(cmd *cobra.Command) {
+	_ = cmd.RegisterFlagCompletionFunc("input", func(*cobra.Command, []string, string) ([]string, cobra.ShellCompDirective) {
+		return []string{"csv"}, cobra.ShellCompDirectiveFilterFileExt
+	})
+
+	for _, name := range []string{"namespace", "service-namespace", "gateway-namespace"} {
+		_ = cmd.RegisterFlagCompletionFunc(name, completeCluster(namespacesGVR, func() string { return "" }))
+	}
+	for _, name := range []string{"service", "live-service"} {
+		if cmd.Flags().Lookup(name) != nil {
+			_ = cmd.RegisterFlagCompletionFunc(name, completeCluster(servicesGVR, func() string { return flagOr(serviceNamespace, namespace) }))
+		}
+	}
+	_ = cmd.RegisterFlagCompletionFunc("gateway", completeCluster(gatewaysGVR, func() string { return flagOr(gatewayNamespace, namespace) }))
+}
+
+// completeCluster completes names of gvr objects in the namespace returned by
+// ns, which is evaluated after the other flags on the line have been parsed.
+func completeCluster(gvr schema.GroupVersionResource, ns func() string) cobra.CompletionFunc {
+	return func(cmd *cobra.Command, _ []string, _ string) ([]string, cobra.ShellCompDirective) {
+		client, contextNamespace, err := kubeDynamicClient()
+		if err != nil {
+			return nil, cobra.ShellCompDirectiveNoFileComp
+		}
+		// Prefer the kubeconfig context's namespace over the --namespace default
+		namespace := ns()
+		if namespace == "default" && !cmd.Flags().Changed("namespace") {
+			namespace = contextNamespace
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), completionTimeout)
+		defer cancel()
+		names, err := listNames(ctx, client, gvr, namespace)
+		if err != nil {
+			return nil, cobra.ShellCompDirectiveNoFileComp
+		}
+		return names, cobra.ShellCompDirectiveNoFileComp
+	}
+}
+
+// flagOr returns value, or fallback when value is empty.
+func flagOr(value, fallback string) string {
+	if value != "" {
+		return value
+	}
+	return fallback
+}
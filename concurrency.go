@@ -0,0 +1,163 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"runtime"
+	"slices"
+	"sync"
+)
+
+var (
+	// concurrency is --concurrency, the number of input files read,
+	// fetched and decrypted at the same time (0 for one per CPU).
+	concurrency int
+	// runReportFormat is --report, the format of the summary of a run:
+	// text (the per-file error lines) or json.
+	runReportFormat string
+)
+
+// The --report formats.
+const (
+	reportText = "text"
+	reportJSON = "json"
+)
+
+// filesFailedError is the error of a run in which some input files failed
+// to convert, after the others were written.
+type filesFailedError struct{ failed, total int }
+
+func (e filesFailedError) Error() string {
+	return fmt.Sprintf("%d of %d input file(s) failed", e.failed, e.total)
+}
+
+// prefetchedInput is the content of an input file read ahead of its
+// conversion, or the error reading it.
+type prefetchedInput struct {
+	data []byte
+	err  error
+}
+
+// prefetchedInputs holds the input files of the current run, read by the
+// worker pool of prefetchInputs and consulted by readInput.
+var prefetchedInputs = make(map[string]prefetchedInput)
+
+// fileFailure is an input file that failed to convert in the current run.
+type fileFailure struct {
+	File  string `json:"file"`
+	Error string `json:"error"`
+}
+
+// fileFailures collects the failed input files of the current run, in
+// input order.
+var fileFailures []fileFailure
+
+func validateConcurrency() error {
+	if concurrency < 0 {
+		return fmt.Errorf("invalid --concurrency %d (must be 0 for one per CPU, or positive)", concurrency)
+	}
+	switch runReportFormat {
+	case reportText, reportJSON:
+	default:
+		return fmt.Errorf("invalid --report %q (must be %s or %s)", runReportFormat, reportText, reportJSON)
+	}
+	return nil
+}
+
+// workers is the size of the worker pool of prefetchInputs.
+func workers() int {
+	if concurrency == 0 {
+		return runtime.NumCPU()
+	}
+	return concurrency
+}
+
+// prefetchInputs reads, fetches and decrypts files in a pool of --concurrency
+// workers, which is where the time of a large inventory goes, in particular
+// with SOPS. The conversion itself stays serial and in input order, as it
+// shares the flag and run state of the process, so the outputs do not
+// depend on the pool.
+func prefetchInputs(ctx context.Context, files []string) {
+	prefetchedInputs = make(map[string]prefetchedInput)
+	n := min(workers(), len(files))
+	if n < 2 {
+		return
+	}
+	_, span := tracer.Start(ctx, "prefetch")
+	defer span.End()
+
+	results := make([]prefetchedInput, len(files))
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for range n {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				results[i].data, results[i].err = readInput(ctx, files[i])
+			}
+		}()
+	}
+	for i := range files {
+		if ctx.Err() != nil {
+			break
+		}
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+	if ctx.Err() != nil {
+		return
+	}
+	for i, path := range files {
+		prefetchedInputs[path] = results[i]
+	}
+}
+
+// recordFileFailure adds a failed input file to the report of the run.
+func recordFileFailure(path string, err error) {
+	runMetrics.failedFiles++
+	fileFailures = append(fileFailures, fileFailure{File: path, Error: err.Error()})
+}
+
+// filesFailed is the error of a run with failed input files, nil if all
+// of them converted.
+func filesFailed(total int) error {
+	if len(fileFailures) == 0 {
+		return nil
+	}
+	return filesFailedError{len(fileFailures), total}
+}
+
+// runReport is the --report json summary of a run.
+type runReport struct {
+	Files    int           `json:"files"`
+	Failed   int           `json:"failed"`
+	Routes   int           `json:"routes"`
+	Rows     int           `json:"rows"`
+	Failures []fileFailure `json:"failures"`
+}
+
+// writeRunReport prints the --report json summary of a run over total
+// files, to standard output unless the routes are streamed there.
+func writeRunReport(total int) error {
+	if runReportFormat != reportJSON {
+		return nil
+	}
+	var w io.Writer = os.Stdout
+	if slices.Contains(sinkSpecs, "stdout") {
+		w = os.Stderr
+	}
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(runReport{
+		Files:    total,
+		Failed:   len(fileFailures),
+		Routes:   runMetrics.routes,
+		Rows:     runMetrics.rows,
+		Failures: append([]fileFailure{}, fileFailures...),
+	})
+}
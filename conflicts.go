@@ -0,0 +1,223 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/arencloud/csv2httproute/pkg/convert"
+)
+
+// Modes of --conflict-strategy, deciding between rows that route the same
+// method and path on one hostname/gateway to different backends. Without a
+// decision, which backend wins depends on file and rule ordering.
+const (
+	conflictsAllow  = "allow"
+	conflictsFirst  = "first"
+	conflictsLast   = "last"
+	conflictsError  = "error"
+	conflictsSkip   = "skip"
+	conflictsPrompt = "prompt"
+)
+
+var conflictStrategy string
+
+func validateConflictStrategy(mode string) error {
+	switch mode {
+	case conflictsAllow, conflictsFirst, conflictsLast, conflictsError, conflictsSkip:
+		return nil
+	case conflictsPrompt:
+		if fi, err := os.Stdin.Stat(); err != nil || fi.Mode()&os.ModeCharDevice == 0 {
+			return fmt.Errorf("--conflict-strategy %s needs an interactive terminal; use first, last, error or skip in scripts", conflictsPrompt)
+		}
+		return nil
+	}
+	return fmt.Errorf("invalid --conflict-strategy %q (must be %s, %s, %s, %s, %s or %s)", mode,
+		conflictsAllow, conflictsFirst, conflictsLast, conflictsError, conflictsSkip, conflictsPrompt)
+}
+
+// conflictKey identifies the requests a row matches directly.
+type conflictKey struct {
+	Target      routeTarget
+	Method      string
+	URL         string
+	Headers     string
+	QueryParams string
+	Accept      string
+	ContentType string
+	Cookie      string
+}
+
+func (k conflictKey) String() string {
+	method := k.Method
+	if method == "" {
+		method = "*"
+	}
+	url := k.URL
+	if k.QueryParams != "" {
+		url += "?" + strings.ReplaceAll(k.QueryParams, ";", "&")
+	}
+	if k.Headers != "" {
+		url += " [" + k.Headers + "]"
+	}
+	if k.Accept != "" {
+		url += " [Accept: " + k.Accept + "]"
+	}
+	if k.ContentType != "" {
+		url += " [Content-Type: " + k.ContentType + "]"
+	}
+	if k.Cookie != "" {
+		url += " [Cookie: " + k.Cookie + "]"
+	}
+	return fmt.Sprintf("%s %s on %s", method, url, k.Target)
+}
+
+// conflictRow is one row of a conflict, in file and line order.
+type conflictRow struct {
+	Path  string
+	Index int
+	Row   Endpoint
+}
+
+func (r conflictRow) String() string {
+	return fmt.Sprintf("%s line %d: %s", filepath.Base(r.Path), r.Row.Line, convert.DescribeBackends(backendsFor(r.Row)))
+}
+
+// resolveConflicts finds rows of files that match the same requests with
+// different backends and keeps the ones chosen by --conflict-strategy. The
+// surviving rows replace the parsed rows of every file, as after a
+// duplicate-prefix merge. Files that fail to parse are left for processCSV
+// to report.
+func resolveConflicts(ctx context.Context, files []string) error {
+	if conflictStrategy == conflictsAllow {
+		return nil
+	}
+
+	parsed := make(map[string][]Endpoint)
+	rows := make(map[conflictKey][]conflictRow)
+	for _, path := range files {
+		endpoints, err := readEndpoints(ctx, path)
+		if err != nil {
+			continue
+		}
+		parsed[path] = endpoints
+		for i, e := range endpoints {
+			k := conflictKey{Target: claimOf(e).Target, Method: e.Method, URL: e.URL, Headers: e.Headers, QueryParams: e.QueryParams, Accept: e.Accept, ContentType: e.ContentType, Cookie: e.Cookie}
+			rows[k] = append(rows[k], conflictRow{Path: path, Index: i, Row: e})
+		}
+	}
+
+	var keys []conflictKey
+	for k, rs := range rows {
+		for _, r := range rs[1:] {
+			if !slices.Equal(backendsFor(r.Row), backendsFor(rs[0].Row)) {
+				keys = append(keys, k)
+				break
+			}
+		}
+	}
+	if len(keys) == 0 {
+		return nil
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].String() < keys[j].String() })
+
+	if conflictStrategy == conflictsError {
+		var report []string
+		for _, k := range keys {
+			var decls []string
+			for _, r := range rows[k] {
+				decls = append(decls, r.String())
+			}
+			report = append(report, fmt.Sprintf("  %s: %s", k, strings.Join(decls, ", ")))
+		}
+		return fmt.Errorf("%d conflicting row set(s) route the same requests to different backends:\n%s", len(keys), strings.Join(report, "\n"))
+	}
+
+	in := bufio.NewReader(os.Stdin)
+	dropped := make(map[string]map[int]bool)
+	for _, k := range keys {
+		rs := rows[k]
+		keep := -1
+		switch conflictStrategy {
+		case conflictsFirst:
+			keep = 0
+		case conflictsLast:
+			keep = len(rs) - 1
+		case conflictsPrompt:
+			var err error
+			if keep, err = promptConflict(in, k, rs); err != nil {
+				return err
+			}
+		}
+		for i, r := range rs {
+			if i == keep {
+				continue
+			}
+			if dropped[r.Path] == nil {
+				dropped[r.Path] = make(map[int]bool)
+			}
+			dropped[r.Path][r.Index] = true
+		}
+		if !quiet && conflictStrategy != conflictsPrompt {
+			if keep < 0 {
+				fmt.Printf("Skipped %s: conflicting rows %s\n", k, conflictRows(rs))
+			} else {
+				fmt.Printf("Resolved %s: kept %s\n", k, rs[keep])
+			}
+		}
+	}
+
+	if endpointOverrides == nil {
+		endpointOverrides = make(map[string][]Endpoint)
+	}
+	for path, endpoints := range parsed {
+		var kept []Endpoint
+		for i, e := range endpoints {
+			if !dropped[path][i] {
+				kept = append(kept, e)
+			}
+		}
+		endpointOverrides[path] = kept
+	}
+	return nil
+}
+
+// promptConflict asks which row of a conflict to keep. It returns -1 when
+// all of them are skipped.
+func promptConflict(in *bufio.Reader, k conflictKey, rs []conflictRow) (int, error) {
+	fmt.Fprintf(os.Stderr, "Conflict: %s\n", k)
+	for i, r := range rs {
+		fmt.Fprintf(os.Stderr, "  %d) %s\n", i+1, r)
+	}
+	for {
+		fmt.Fprintf(os.Stderr, "Keep [1-%d], s to skip all, q to abort: ", len(rs))
+		answer, err := in.ReadString('\n')
+		answer = strings.TrimSpace(answer)
+		switch answer {
+		case "s":
+			return -1, nil
+		case "q":
+			return 0, fmt.Errorf("aborted while resolving %s", k)
+		}
+		if n, convErr := strconv.Atoi(answer); convErr == nil && n >= 1 && n <= len(rs) {
+			return n - 1, nil
+		}
+		if err != nil {
+			return 0, fmt.Errorf("no answer for %s: %w", k, err)
+		}
+	}
+}
+
+func conflictRows(rs []conflictRow) string {
+	s := make([]string, len(rs))
+	for i, r := range rs {
+		s[i] = r.String()
+	}
+	return strings.Join(s, ", ")
+}
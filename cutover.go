@@ -0,0 +1,43 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/arencloud/csv2httproute/pkg/convert"
+)
+
+// renderAt is --render-at: the time the inventory is rendered as of,
+// so the routes after a scheduled cutover can be staged ahead of time.
+var renderAt string
+
+// renderTime is the parsed --render-at, or the start of the run.
+var renderTime time.Time
+
+func loadRenderAt(value string) error {
+	if value == "" {
+		renderTime = time.Now()
+		return nil
+	}
+	t, err := convert.ParseTimestamp(value)
+	if err != nil {
+		return fmt.Errorf("invalid --render-at: %w", err)
+	}
+	renderTime = t
+	// A rendering of another time is not a run to record for --grace-period.
+	historyReadOnly = true
+	return nil
+}
+
+// applyCutovers keeps the rows of a file in effect at --render-at.
+func applyCutovers(endpoints []Endpoint) []Endpoint {
+	if renderTime.IsZero() {
+		renderTime = time.Now()
+	}
+	if renderAt == "" {
+		for _, e := range endpoints {
+			sawCutover = sawCutover || !e.CutoverAt.IsZero()
+		}
+	}
+	return convert.ActiveAt(endpoints, renderTime)
+}
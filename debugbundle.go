@@ -0,0 +1,274 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/arencloud/csv2httproute/pkg/convert"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"gopkg.in/yaml.v3"
+)
+
+// debugBundle is --debug-bundle: the .tgz to write for bug reports.
+var debugBundle string
+
+// debugEndpoints and debugErrors record the intermediate model and per-file
+// errors of a run for the bundle.
+var (
+	debugEndpoints = make(map[string][]Endpoint)
+	debugErrors    []string
+)
+
+func recordDebugEndpoints(path string, endpoints []Endpoint) {
+	if debugBundle != "" {
+		debugEndpoints[path] = endpoints
+	}
+}
+
+func recordDebugError(path string, err error) {
+	if debugBundle != "" {
+		debugErrors = append(debugErrors, fmt.Sprintf("%s: %v", path, err))
+	}
+}
+
+// redactor replaces hostnames with stable placeholders so bundles can be
+// attached to public bug reports. Paths, methods and backends are kept since
+// conversion discrepancies are usually about them.
+type redactor struct {
+	pairs []string
+}
+
+func newRedactor() *redactor {
+	hosts := make(map[string]bool)
+	if hostname != "" {
+		hosts[hostname] = true
+	}
+	for _, d := range domainMap {
+		hosts[d.Hostname] = true
+	}
+	for _, p := range profiles {
+		if p.Hostname != "" {
+			hosts[p.Hostname] = true
+		}
+	}
+	for _, o := range ownerRules {
+		if o.Hostname != "" {
+			hosts[o.Hostname] = true
+		}
+	}
+	for _, endpoints := range debugEndpoints {
+		for _, e := range endpoints {
+			if e.Hostname != "" {
+				hosts[e.Hostname] = true
+			}
+		}
+	}
+	names := make([]string, 0, len(hosts))
+	for h := range hosts {
+		names = append(names, h)
+	}
+	// Longest first, so a.example.com is not half-replaced via example.com.
+	sort.Slice(names, func(i, j int) bool {
+		if len(names[i]) != len(names[j]) {
+			return len(names[i]) > len(names[j])
+		}
+		return names[i] < names[j]
+	})
+	r := &redactor{}
+	for i, h := range names {
+		placeholder := fmt.Sprintf("host-%d.example.invalid", i+1)
+		if strings.HasPrefix(h, "*.") {
+			placeholder = "*." + placeholder
+		}
+		r.pairs = append(r.pairs, h, placeholder)
+	}
+	return r
+}
+
+func (r *redactor) String(s string) string {
+	if len(r.pairs) == 0 {
+		return s
+	}
+	return strings.NewReplacer(r.pairs...).Replace(s)
+}
+
+// writeDebugBundle archives the effective configuration, sanitized inputs,
+// parsed endpoint model, and generated outputs of the run. It is written
+// even when the run failed, with runErr recorded.
+func writeDebugBundle(cmd *cobra.Command, runErr error) error {
+	red := newRedactor()
+	files := make(map[string][]byte)
+
+	flags := make(map[string]string)
+	cmd.Flags().VisitAll(func(f *pflag.Flag) {
+		flags[f.Name] = red.String(f.Value.String())
+	})
+	config := map[string]any{
+		"version": Version,
+		"go":      runtime.Version(),
+		"os":      runtime.GOOS + "/" + runtime.GOARCH,
+		"command": red.String(strings.Join(os.Args, " ")),
+		"flags":   flags,
+	}
+	if runErr != nil {
+		config["error"] = red.String(runErr.Error())
+	}
+	if len(debugErrors) > 0 {
+		config["fileErrors"] = strings.Split(red.String(strings.Join(debugErrors, "\n")), "\n")
+	}
+	data, err := yaml.Marshal(config)
+	if err != nil {
+		return err
+	}
+	files["config.yaml"] = data
+
+	for path, endpoints := range debugEndpoints {
+		sanitized := make([]Endpoint, len(endpoints))
+		for i, e := range endpoints {
+			e.Comment = ""
+			sanitized[i] = e
+		}
+		data, err := json.MarshalIndent(sanitized, "", "  ")
+		if err != nil {
+			return err
+		}
+		files["endpoints/"+csvBaseName(path)+".json"] = []byte(red.String(string(data)))
+
+		if data, err := sanitizedCSV(cmd.Context(), path, red); err == nil {
+			files["inputs/"+csvBaseName(path)+".csv"] = data
+		}
+	}
+	for _, path := range []string{configFile, domainMapFile, ownersFile, templateFile} {
+		if path == "" {
+			continue
+		}
+		data, err := readInput(cmd.Context(), path)
+		if err != nil {
+			return err
+		}
+		files["inputs/"+filepath.Base(plainName(path))] = []byte(red.String(string(data)))
+	}
+
+	for _, path := range writtenFiles {
+		data, err := os.ReadFile(path)
+		if os.IsNotExist(err) {
+			// Staged for sinks other than files and removed since.
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(outputDir, path)
+		if err != nil {
+			rel = filepath.Base(path)
+		}
+		files["outputs/"+filepath.ToSlash(rel)] = []byte(red.String(string(data)))
+	}
+
+	if err := writeTarGz(debugBundle, "csv2httproute-debug", files); err != nil {
+		return fmt.Errorf("failed to write debug bundle: %w", err)
+	}
+	fmt.Fprintf(os.Stderr, "Wrote debug bundle %s\n", debugBundle)
+	return nil
+}
+
+// sanitizedCSV returns the decrypted rows of path with hostnames redacted
+// and the free-text comment column cleared.
+func sanitizedCSV(ctx context.Context, path string, red *redactor) ([]byte, error) {
+	data, err := readInput(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+	reader := newCSVReader(bytes.NewReader(data))
+	reader.LazyQuotes = true
+	records, err := reader.ReadAll()
+	if err != nil {
+		// Keep the raw file: unparseable input is often the bug itself.
+		return []byte(red.String(string(data))), nil
+	}
+	comment, header := -1, noHeader
+	if noHeader {
+		comment = slices.Index(positionalHeader(), "comment")
+	}
+	for i, record := range records {
+		if !header && len(record) > 0 && !strings.HasPrefix(record[0], "#") {
+			for j, h := range mapHeader(record) {
+				if convert.CanonicalColumn(h) == "comment" {
+					comment = j
+				}
+			}
+			header = true
+			continue
+		}
+		for j := range record {
+			if j == comment {
+				record[j] = ""
+			} else {
+				record[j] = red.String(record[j])
+			}
+		}
+		records[i] = record
+	}
+	var buf bytes.Buffer
+	writer := csv.NewWriter(&buf)
+	writer.Comma = delimiter
+	if err := writer.WriteAll(records); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// writeTarGz writes files to a gzipped tarball at path, below the directory
+// root when it is not empty.
+func writeTarGz(path, root string, files map[string][]byte) error {
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	gz := gzip.NewWriter(f)
+	tw := tar.NewWriter(gz)
+	now := time.Now()
+	for _, name := range names {
+		entry := name
+		if root != "" {
+			entry = root + "/" + name
+		}
+		hdr := &tar.Header{Name: entry, Mode: 0644, Size: int64(len(files[name])), ModTime: now}
+		if err := tw.WriteHeader(hdr); err != nil {
+			f.Close()
+			return err
+		}
+		if _, err := tw.Write(files[name]); err != nil {
+			f.Close()
+			return err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := gz.Close(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
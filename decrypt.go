@@ -0,0 +1,167 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"filippo.io/age"
+	"filippo.io/age/armor"
+	"gopkg.in/yaml.v3"
+)
+
+// Encrypted inventories are decrypted in memory and never written back to
+// disk. age files are handled natively; SOPS files are handed to the sops
+// binary so every key source it supports (age, PGP, AWS/GCP/Azure KMS,
+// Vault) works without extra configuration here.
+
+const (
+	ageHeader   = "age-encryption.org/v1\n"
+	ageSuffix   = ".age"
+	sopsBinEnv  = "SOPS_BINARY"
+	ageKeyEnv   = "SOPS_AGE_KEY"
+	ageFileEnv  = "SOPS_AGE_KEY_FILE"
+	defaultSops = "sops"
+)
+
+// readInput returns the plaintext contents of an input file, decrypting it
+// first when it is age- or SOPS-encrypted. Cancelling ctx stops sops.
+func readInput(ctx context.Context, path string) ([]byte, error) {
+	if p, ok := prefetchedInputs[path]; ok {
+		return p.data, p.err
+	}
+	data, err := readSourceFile(path)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case isAgeEncrypted(data):
+		return decryptAge(path, data)
+	case isSopsEncrypted(data):
+		return decryptSops(ctx, path)
+	}
+	return data, nil
+}
+
+// plainName strips the .age suffix so encrypted inputs are named after the
+// file they decrypt to.
+func plainName(path string) string {
+	if strings.EqualFold(filepath.Ext(path), ageSuffix) {
+		return path[:len(path)-len(ageSuffix)]
+	}
+	return path
+}
+
+func isEncrypted(data []byte) bool {
+	return isAgeEncrypted(data) || isSopsEncrypted(data)
+}
+
+func isAgeEncrypted(data []byte) bool {
+	return bytes.HasPrefix(data, []byte(ageHeader)) ||
+		bytes.HasPrefix(bytes.TrimSpace(data), []byte(armor.Header))
+}
+
+// isSopsEncrypted looks for the top-level "sops" metadata block SOPS adds to
+// YAML and JSON files; CSVs are stored in its binary format, a JSON document
+// with the ciphertext under "data".
+func isSopsEncrypted(data []byte) bool {
+	if !bytes.Contains(data, []byte("sops")) {
+		return false
+	}
+	var doc map[string]any
+	if err := json.Unmarshal(data, &doc); err != nil {
+		if err := yaml.Unmarshal(data, &doc); err != nil {
+			return false
+		}
+	}
+	meta, ok := doc["sops"].(map[string]any)
+	if !ok {
+		return false
+	}
+	_, ok = meta["mac"]
+	return ok
+}
+
+func decryptAge(path string, data []byte) ([]byte, error) {
+	identities, err := ageIdentities()
+	if err != nil {
+		return nil, err
+	}
+	var src io.Reader = bytes.NewReader(data)
+	if !bytes.HasPrefix(data, []byte(ageHeader)) {
+		src = armor.NewReader(src)
+	}
+	r, err := age.Decrypt(src, identities...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt %s: %w", path, err)
+	}
+	return io.ReadAll(r)
+}
+
+// ageIdentities loads age keys the same way SOPS does: inline from
+// SOPS_AGE_KEY, from the file named by SOPS_AGE_KEY_FILE, or from the default
+// keys.txt in the user config directory.
+func ageIdentities() ([]age.Identity, error) {
+	if key := os.Getenv(ageKeyEnv); key != "" {
+		return age.ParseIdentities(strings.NewReader(key))
+	}
+	path := os.Getenv(ageFileEnv)
+	if path == "" {
+		dir, err := os.UserConfigDir()
+		if err != nil {
+			return nil, err
+		}
+		path = filepath.Join(dir, "sops", "age", "keys.txt")
+	}
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("no age identity: set %s or %s", ageKeyEnv, ageFileEnv)
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return age.ParseIdentities(bufio.NewReader(f))
+}
+
+func decryptSops(ctx context.Context, path string) ([]byte, error) {
+	bin := os.Getenv(sopsBinEnv)
+	if bin == "" {
+		bin = defaultSops
+	}
+	file := path
+	if data, ok := fetchedFiles[path]; ok {
+		// sops reads files only, and detects the format from the extension.
+		dir, err := os.MkdirTemp("", "csv2httproute-sops-")
+		if err != nil {
+			return nil, err
+		}
+		defer os.RemoveAll(dir)
+		file = filepath.Join(dir, filepath.Base(path))
+		if err := os.WriteFile(file, data, 0600); err != nil {
+			return nil, err
+		}
+	}
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, bin, "--decrypt", file)
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if errors.Is(err, exec.ErrNotFound) {
+		return nil, fmt.Errorf("%s is SOPS-encrypted but %s was not found in PATH", path, bin)
+	}
+	if err != nil && ctx.Err() != nil {
+		return nil, fmt.Errorf("failed to decrypt %s: %w", path, ctx.Err())
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt %s: %s", path, strings.TrimSpace(stderr.String()))
+	}
+	return out, nil
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestDecryptSopsCancelled(t *testing.T) {
+	dir := t.TempDir()
+	sops := filepath.Join(dir, "sops")
+	if err := os.WriteFile(sops, []byte("#!/bin/sh\nexec sleep 30\n"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv(sopsBinEnv, sops)
+	input := filepath.Join(dir, "orders.yaml")
+	if err := os.WriteFile(input, []byte("data: ENC[AES256_GCM]\nsops:\n  mac: ENC[AES256_GCM]\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	resetRunState()
+	prefetchedInputs = nil
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, err := readInput(ctx, input)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("readInput of a SOPS file after the deadline: %v, want the deadline error", err)
+	}
+	if elapsed := time.Since(start); elapsed > 10*time.Second {
+		t.Errorf("sops ran on for %s after the context ended", elapsed)
+	}
+}
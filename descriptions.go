@@ -0,0 +1,70 @@
+package main
+
+import (
+	"encoding/json"
+	"slices"
+	"strings"
+)
+
+// ruleDescriptionsAnnotationKey is the route annotation holding the
+// description column of the rows behind each match.
+const ruleDescriptionsAnnotationKey = "csv2httproute/rule-descriptions"
+
+// ruleDescriptions is the rule-descriptions annotation: Rules[i] is the
+// description of rule i, and Matches[i][j] that of match j in rule i, ""
+// for none, so dashboards can show the intent of a rule and export restores
+// the column row by row.
+type ruleDescriptions struct {
+	Rules   []string   `json:"rules"`
+	Matches [][]string `json:"matches"`
+}
+
+// ruleDescription joins the distinct descriptions of the matches of rule.
+func ruleDescription(rule HTTPRouteRule) string {
+	var descriptions []string
+	for _, m := range rule.Matches {
+		if m.Description != "" && !slices.Contains(descriptions, m.Description) {
+			descriptions = append(descriptions, m.Description)
+		}
+	}
+	return strings.Join(descriptions, "; ")
+}
+
+// annotateRuleDescriptions stores the descriptions of the rules of route as
+// its rule-descriptions annotation, if any row has one.
+func annotateRuleDescriptions(route *HTTPRoute) error {
+	var d ruleDescriptions
+	described := false
+	for _, rule := range route.Spec.Rules {
+		matches := make([]string, len(rule.Matches))
+		for j, m := range rule.Matches {
+			matches[j] = m.Description
+		}
+		description := ruleDescription(rule)
+		described = described || description != ""
+		d.Rules = append(d.Rules, description)
+		d.Matches = append(d.Matches, matches)
+	}
+	if !described {
+		return nil
+	}
+	data, err := json.Marshal(d)
+	if err != nil {
+		return err
+	}
+	if route.Metadata.Annotations == nil {
+		route.Metadata.Annotations = map[string]string{}
+	}
+	route.Metadata.Annotations[ruleDescriptionsAnnotationKey] = string(data)
+	return nil
+}
+
+// exportedDescriptions reads the rule-descriptions annotation of route back,
+// and returns nil without a readable one.
+func exportedDescriptions(route HTTPRoute) [][]string {
+	var d ruleDescriptions
+	if err := json.Unmarshal([]byte(route.Metadata.Annotations[ruleDescriptionsAnnotationKey]), &d); err != nil {
+		return nil
+	}
+	return d.Matches
+}
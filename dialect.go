@@ -0,0 +1,128 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/arencloud/csv2httproute/pkg/convert"
+)
+
+var (
+	// csvDelimiter is --delimiter, the field separator of the input CSVs.
+	csvDelimiter string
+	// columnMap is --column-map: column=header pairs naming the header cell
+	// that holds a column, or with --no-header its 1-based position.
+	columnMap []string
+	// noHeader is --no-header: the CSVs have no header row, and their
+	// columns are assigned by position.
+	noHeader bool
+)
+
+// defaultPositions are the columns of a CSV without header and without
+// --column-map: the original four-column format.
+var defaultPositions = []string{"method", "url", "prefix", "comment"}
+
+// delimiter is the parsed --delimiter.
+var delimiter = ','
+
+// mappedColumns is the parsed --column-map: the canonical header cell, or the
+// position with --no-header, of each mapped column.
+var mappedColumns = map[string]string{}
+
+func validateDialect() error {
+	switch d := csvDelimiter; {
+	case d == `\t` || strings.EqualFold(d, "tab"):
+		delimiter = '\t'
+	case utf8.RuneCountInString(d) == 1:
+		delimiter, _ = utf8.DecodeRuneInString(d)
+		if delimiter == '"' || delimiter == '\r' || delimiter == '\n' || delimiter == utf8.RuneError {
+			return fmt.Errorf("invalid --delimiter %q", d)
+		}
+	default:
+		return fmt.Errorf("invalid --delimiter %q (must be one character, or tab)", d)
+	}
+
+	mappedColumns = map[string]string{}
+	sources := map[string]string{}
+	for _, pair := range columnMap {
+		column, source, ok := strings.Cut(pair, "=")
+		column, source = convert.CanonicalColumn(column), strings.TrimSpace(source)
+		if !ok || source == "" {
+			return fmt.Errorf("invalid --column-map %q (want column=header, e.g. method=verb)", pair)
+		}
+		if !convert.IsColumn(column) {
+			return fmt.Errorf("invalid --column-map %q: unknown column %s", pair, column)
+		}
+		if noHeader {
+			if n, err := strconv.Atoi(source); err != nil || n < 1 {
+				return fmt.Errorf("invalid --column-map %q: with --no-header, columns are mapped to positions from 1", pair)
+			}
+		} else {
+			source = convert.CanonicalColumn(source)
+		}
+		if other, ok := sources[source]; ok {
+			return fmt.Errorf("invalid --column-map: %s and %s both map %s", other, column, source)
+		}
+		if _, ok := mappedColumns[column]; ok {
+			return fmt.Errorf("invalid --column-map: %s is mapped twice", column)
+		}
+		sources[source] = column
+		mappedColumns[column] = source
+	}
+	if _, ok := mappedColumns["url"]; noHeader && len(mappedColumns) > 0 && !ok {
+		return fmt.Errorf("--column-map with --no-header needs the position of url")
+	}
+	return nil
+}
+
+// newCSVReader reads the fields of r with the --delimiter.
+func newCSVReader(r io.Reader) *csv.Reader {
+	reader := csv.NewReader(r)
+	reader.Comma = delimiter
+	reader.FieldsPerRecord = -1 // Allow variable number of fields
+	return reader
+}
+
+// mapHeader renames the header cells named by --column-map to their
+// columns. A cell already naming a mapped column is dropped, so the
+// mapping wins.
+func mapHeader(header []string) []string {
+	if len(mappedColumns) == 0 {
+		return header
+	}
+	mapped := make([]string, len(header))
+	for i, h := range header {
+		name := convert.CanonicalColumn(h)
+		mapped[i] = h
+		if _, ok := mappedColumns[name]; ok {
+			mapped[i] = ""
+		}
+		for column, source := range mappedColumns {
+			if name == source {
+				mapped[i] = column
+			}
+		}
+	}
+	return mapped
+}
+
+// positionalHeader is the header of CSVs read with --no-header: the
+// columns of --column-map at their positions, or defaultPositions.
+func positionalHeader() []string {
+	if len(mappedColumns) == 0 {
+		return defaultPositions
+	}
+	var header []string
+	for column, source := range mappedColumns {
+		n, _ := strconv.Atoi(source)
+		for len(header) < n {
+			header = append(header, "")
+		}
+		header[n-1] = column
+	}
+	return header
+}
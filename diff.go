@@ -0,0 +1,163 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// diffContext is the number of unchanged lines shown around each change.
+const diffContext = 3
+
+type diffOp struct {
+	Kind byte // ' ', '-', or '+'
+	Line string
+}
+
+// unifiedDiff returns a unified diff turning a into b, or "" when they are
+// equal. The algorithm is Myers' O(ND) shortest edit script over lines.
+func unifiedDiff(aName, bName, a, b string) string {
+	if a == b {
+		return ""
+	}
+	ops := diffLines(splitLines(a), splitLines(b))
+
+	var out strings.Builder
+	fmt.Fprintf(&out, "--- %s\n+++ %s\n", aName, bName)
+	for start := 0; start < len(ops); {
+		// Find the next change and the extent of its hunk
+		for start < len(ops) && ops[start].Kind == ' ' {
+			start++
+		}
+		if start == len(ops) {
+			break
+		}
+		from := max(start-diffContext, 0)
+		end, unchanged := start, 0
+		for end < len(ops) && unchanged <= 2*diffContext {
+			if ops[end].Kind == ' ' {
+				unchanged++
+			} else {
+				unchanged = 0
+			}
+			end++
+		}
+		end -= max(unchanged-diffContext, 0)
+
+		aStart, bStart, aLen, bLen := 1, 1, 0, 0
+		for _, op := range ops[:from] {
+			if op.Kind != '+' {
+				aStart++
+			}
+			if op.Kind != '-' {
+				bStart++
+			}
+		}
+		for _, op := range ops[from:end] {
+			if op.Kind != '+' {
+				aLen++
+			}
+			if op.Kind != '-' {
+				bLen++
+			}
+		}
+		// An empty range is numbered after the line preceding it, as in diff -u
+		if aLen == 0 {
+			aStart--
+		}
+		if bLen == 0 {
+			bStart--
+		}
+		fmt.Fprintf(&out, "@@ -%s +%s @@\n", hunkRange(aStart, aLen), hunkRange(bStart, bLen))
+		for _, op := range ops[from:end] {
+			out.WriteByte(op.Kind)
+			out.WriteString(op.Line)
+			out.WriteByte('\n')
+		}
+		start = end
+	}
+	return out.String()
+}
+
+// hunkRange formats a hunk header range, omitting the length when it is 1.
+func hunkRange(start, length int) string {
+	if length == 1 {
+		return fmt.Sprint(start)
+	}
+	return fmt.Sprintf("%d,%d", start, length)
+}
+
+func splitLines(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(s, "\n"), "\n")
+}
+
+// diffLines computes the edit script between a and b.
+func diffLines(a, b []string) []diffOp {
+	n, m := len(a), len(b)
+	maxD := n + m
+	offset := maxD
+	v := make([]int, 2*maxD+2)
+	var trace [][]int
+
+	for d := 0; d <= maxD; d++ {
+		trace = append(trace, append([]int(nil), v...))
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+				x = v[offset+k+1]
+			} else {
+				x = v[offset+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			v[offset+k] = x
+			if x >= n && y >= m {
+				return backtrack(trace, a, b, offset, d)
+			}
+		}
+	}
+	return nil
+}
+
+func backtrack(trace [][]int, a, b []string, offset, d int) []diffOp {
+	var ops []diffOp
+	x, y := len(a), len(b)
+	for ; d > 0; d-- {
+		v := trace[d]
+		k := x - y
+		var prevK int
+		if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+			prevK = k + 1
+		} else {
+			prevK = k - 1
+		}
+		prevX := v[offset+prevK]
+		prevY := prevX - prevK
+		for x > prevX && y > prevY {
+			x--
+			y--
+			ops = append(ops, diffOp{' ', a[x]})
+		}
+		if x == prevX {
+			y--
+			ops = append(ops, diffOp{'+', b[y]})
+		} else {
+			x--
+			ops = append(ops, diffOp{'-', a[x]})
+		}
+	}
+	for x > 0 && y > 0 {
+		x--
+		y--
+		ops = append(ops, diffOp{' ', a[x]})
+	}
+	for i, j := 0, len(ops)-1; i < j; i, j = i+1, j-1 {
+		ops[i], ops[j] = ops[j], ops[i]
+	}
+	return ops
+}
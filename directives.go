@@ -0,0 +1,323 @@
+package main
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/arencloud/csv2httproute/pkg/convert"
+)
+
+// Directive rows start with "#!" and set defaults for the rows below them,
+// so inventories exported section by section can carry their own metadata:
+//
+//	#! hostname=api.example.com service=orders-svc port=8080
+//
+// A directive holds until the next directive for the same key; an empty
+// value ("service=") switches it off again.
+
+// targetDirectives are the directive keys that select the route target
+// rather than a column default.
+var targetDirectives = []string{"hostname", "namespace", "gateway", "gateway_namespace"}
+
+// columnDirectives are the columns a directive may default.
+var columnDirectives = []string{"prefix", "variant", "service", "port", "weight", "service_namespace", "owner", "backend_kind", "backend_group", "backend_protocol", "match_type", "headers", "query_params", "accept", "content_type", "cookie", "cache_ttl", "cacheability", "profile", "tier", "fallback", "redirect", "rewrite", "cutover_at", "tls", "protocol", "tags", "set_headers", "add_headers", "remove_headers", "set_response_headers", "add_response_headers", "remove_response_headers", "timeout", "backend_timeout", "retries", "labels", "annotations"}
+
+// directives is the directive state while reading one CSV file.
+type directives struct {
+	// defaults holds the directive values, parsed like a row so they are
+	// validated once, when the directive is read.
+	defaults Endpoint
+}
+
+// isDirectiveRow reports whether record is a "#!" directive row.
+func isDirectiveRow(record []string) bool {
+	return len(record) > 0 && strings.HasPrefix(strings.TrimSpace(record[0]), "#!")
+}
+
+// apply reads a directive row. The CSV reader splits the row at commas, so
+// the fields are joined back before the key=value pairs are split on
+// whitespace. Column values are parsed together like a row, so a
+// backend_kind can be given with its backend_group in either order.
+func (d *directives) apply(record []string) error {
+	text := strings.TrimPrefix(strings.TrimSpace(strings.Join(record, ",")), "#!")
+	var values []string
+	columns := make(map[string]int)
+	for _, pair := range strings.Fields(strings.TrimRight(text, ",")) {
+		key, value, ok := strings.Cut(pair, "=")
+		if !ok {
+			return fmt.Errorf("invalid directive %q (want key=value)", pair)
+		}
+		key = convert.CanonicalColumn(key)
+		switch {
+		case key == "hostname" && strings.Contains(value, ";"):
+			// Several hostnames work like the hostname column
+			hostnames, err := convert.NormalizeHostnames(value)
+			if err != nil {
+				return err
+			}
+			d.defaults.Hostname, d.defaults.Hostnames = "", hostnames
+		case key == "hostname":
+			d.defaults.Hostname, d.defaults.Hostnames = value, ""
+		case key == "namespace":
+			d.defaults.Namespace = value
+		case key == "gateway":
+			d.defaults.Gateway = value
+		case key == "gateway_namespace":
+			d.defaults.GatewayNamespace = value
+		case slices.Contains(columnDirectives, key):
+			columns[key] = len(values)
+			values = append(values, value)
+		default:
+			return fmt.Errorf("unknown directive %q (must be one of %s)", key, strings.Join(append(append([]string{}, targetDirectives...), columnDirectives...), ", "))
+		}
+	}
+	if len(columns) == 0 {
+		return nil
+	}
+	parsed, err := parseRecord(values, columns)
+	if err != nil {
+		return fmt.Errorf("directive: %w", err)
+	}
+	e := &d.defaults
+	for key := range columns {
+		switch key {
+		case "prefix":
+			e.Prefix = parsed.Prefix
+		case "variant":
+			e.Variant = parsed.Variant
+		case "service":
+			e.Service = parsed.Service
+		case "port":
+			e.Port, e.PortName = parsed.Port, parsed.PortName
+		case "weight":
+			e.Weight = parsed.Weight
+		case "service_namespace":
+			e.ServiceNamespace = parsed.ServiceNamespace
+		case "owner":
+			e.Owner = parsed.Owner
+		case "profile":
+			e.Profile = parsed.Profile
+		case "tier":
+			e.Tier = parsed.Tier
+		case "fallback":
+			e.Fallback = parsed.Fallback
+		case "redirect":
+			e.Redirect = parsed.Redirect
+		case "rewrite":
+			e.Rewrite = parsed.Rewrite
+		case "cutover_at":
+			e.CutoverAt = parsed.CutoverAt
+		case "tls":
+			e.TLS = parsed.TLS
+		case "protocol":
+			e.Protocol = parsed.Protocol
+		case "tags":
+			e.Tags = parsed.Tags
+		case "backend_kind", "backend_group":
+			if _, ok := columns["backend_kind"]; ok {
+				e.BackendKind = parsed.BackendKind
+			}
+			e.BackendGroup = parsed.BackendGroup
+		case "backend_protocol":
+			e.BackendProtocol = parsed.BackendProtocol
+		case "match_type":
+			e.MatchType = parsed.MatchType
+		case "headers":
+			e.Headers = parsed.Headers
+		case "query_params":
+			e.QueryParams = parsed.QueryParams
+		case "accept":
+			e.Accept = parsed.Accept
+		case "content_type":
+			e.ContentType = parsed.ContentType
+		case "cookie":
+			e.Cookie = parsed.Cookie
+		case "cache_ttl", "cacheability":
+			e.CacheControl = parsed.CacheControl
+		case "timeout":
+			e.Timeout = parsed.Timeout
+		case "backend_timeout":
+			e.BackendTimeout = parsed.BackendTimeout
+		case "retries":
+			e.Retries = parsed.Retries
+		case "labels":
+			e.Labels = parsed.Labels
+		case "annotations":
+			e.Annotations = parsed.Annotations
+		case "set_headers":
+			e.RequestHeaders.Set = parsed.RequestHeaders.Set
+		case "add_headers":
+			e.RequestHeaders.Add = parsed.RequestHeaders.Add
+		case "remove_headers":
+			e.RequestHeaders.Remove = parsed.RequestHeaders.Remove
+		case "set_response_headers":
+			e.ResponseHeaders.Set = parsed.ResponseHeaders.Set
+		case "add_response_headers":
+			e.ResponseHeaders.Add = parsed.ResponseHeaders.Add
+		case "remove_response_headers":
+			e.ResponseHeaders.Remove = parsed.ResponseHeaders.Remove
+		}
+	}
+	return nil
+}
+
+// fill sets the fields e leaves empty from the directives in effect. Backend
+// kind and group are taken together, so a row naming its own kind does not
+// inherit a directive group.
+func (d *directives) fill(e *Endpoint) {
+	def := d.defaults
+	if e.Prefix == "" {
+		e.Prefix = def.Prefix
+	}
+	if e.Variant == "" {
+		e.Variant = def.Variant
+	}
+	if e.Service == "" {
+		e.Service = def.Service
+	}
+	if e.Port == 0 && e.PortName == "" {
+		e.Port, e.PortName = def.Port, def.PortName
+	}
+	if e.Weight == 0 {
+		e.Weight = def.Weight
+	}
+	if e.ServiceNamespace == "" {
+		e.ServiceNamespace = def.ServiceNamespace
+	}
+	if e.Owner == "" {
+		e.Owner = def.Owner
+	}
+	if e.Profile == "" {
+		e.Profile = def.Profile
+	}
+	if e.Tier == "" {
+		e.Tier = def.Tier
+	}
+	if e.Fallback == "" {
+		e.Fallback = def.Fallback
+	}
+	if e.Redirect == "" {
+		e.Redirect = def.Redirect
+	}
+	if e.Rewrite == "" {
+		e.Rewrite = def.Rewrite
+	}
+	if e.CutoverAt.IsZero() {
+		e.CutoverAt = def.CutoverAt
+	}
+	if e.TLS == "" {
+		e.TLS = def.TLS
+	}
+	if e.Protocol == "" {
+		e.Protocol = def.Protocol
+	}
+	if len(e.Tags) == 0 {
+		e.Tags = def.Tags
+	}
+	if e.BackendKind == "" {
+		e.BackendKind = def.BackendKind
+		if e.BackendGroup == "" {
+			e.BackendGroup = def.BackendGroup
+		}
+	}
+	if e.BackendProtocol == "" {
+		e.BackendProtocol = def.BackendProtocol
+	}
+	if e.MatchType == "" {
+		e.MatchType = def.MatchType
+	}
+	if e.Headers == "" {
+		e.Headers = def.Headers
+	}
+	if e.QueryParams == "" {
+		e.QueryParams = def.QueryParams
+	}
+	if e.Accept == "" {
+		e.Accept = def.Accept
+	}
+	if e.ContentType == "" {
+		e.ContentType = def.ContentType
+	}
+	if e.Cookie == "" {
+		e.Cookie = def.Cookie
+	}
+	if e.Timeout == "" {
+		e.Timeout = def.Timeout
+	}
+	if e.BackendTimeout == "" {
+		e.BackendTimeout = def.BackendTimeout
+	}
+	if e.Retries == "" {
+		e.Retries = def.Retries
+	}
+	if e.Labels == "" {
+		e.Labels = def.Labels
+	}
+	if e.Annotations == "" {
+		e.Annotations = def.Annotations
+	}
+	fillHeaderEdits(&e.RequestHeaders, def.RequestHeaders)
+	fillHeaderEdits(&e.ResponseHeaders, def.ResponseHeaders)
+	// Caching directives only reach the rows that may carry a policy.
+	if e.CacheControl == "" && convert.CacheableMethod(e.Method) {
+		e.CacheControl = def.CacheControl
+	}
+	if e.Hostnames == "" {
+		e.Hostnames = def.Hostnames
+	}
+	e.Hostname = def.Hostname
+	if e.Namespace == "" {
+		e.Namespace = def.Namespace
+	}
+	if e.Gateway == "" {
+		e.Gateway = def.Gateway
+	}
+	if e.GatewayNamespace == "" {
+		e.GatewayNamespace = def.GatewayNamespace
+	}
+}
+
+// fillHeaderEdits sets the header modifier columns h leaves empty from def.
+func fillHeaderEdits(h *convert.HeaderEdits, def convert.HeaderEdits) {
+	if h.Set == "" {
+		h.Set = def.Set
+	}
+	if h.Add == "" {
+		h.Add = def.Add
+	}
+	if h.Remove == "" {
+		h.Remove = def.Remove
+	}
+}
+
+// directiveDomains interns the domain rules made from directive targets, so
+// rows under the same directives share one route.
+var directiveDomains = make(map[domainRule]*domainRule)
+
+// directiveDomain returns the rule for e's target, from its directives and
+// its namespace, gateway and gateway_namespace columns, or nil when e has
+// none. These take precedence over --domain-map; target fields they leave
+// unset fall back to the flags of the file.
+func directiveDomain(e Endpoint) *domainRule {
+	if e.Hostname == "" && e.Namespace == "" && e.Gateway == "" && e.GatewayNamespace == "" {
+		return nil
+	}
+	key := domainRule{Hostname: cmp.Or(e.Hostname, hostname), Namespace: e.Namespace, Gateway: e.Gateway, GatewayNamespace: e.GatewayNamespace}
+	d, ok := directiveDomains[key]
+	if !ok {
+		var parts []string
+		for _, p := range []string{e.Hostname, e.Namespace, e.GatewayNamespace, e.Gateway} {
+			if p != "" {
+				parts = append(parts, p)
+			}
+		}
+		rule := key
+		rule.name = strings.Join(parts, "-")
+		rule.namespaceOnly = e.Hostname == "" && e.Gateway == "" && e.GatewayNamespace == ""
+		d = &rule
+		directiveDomains[key] = d
+	}
+	return d
+}
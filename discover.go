@@ -0,0 +1,241 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// Annotations read by discover. Endpoints lists one "[METHOD] path" entry
+// per line or comma-separated; prefix and port are optional.
+const (
+	endpointsAnnotation = "csv2httproute/endpoints"
+	prefixAnnotation    = "csv2httproute/prefix"
+	portAnnotation      = "csv2httproute/port"
+)
+
+var (
+	discoverInventory     string
+	discoverAllNamespaces bool
+	discoverImportOnly    bool
+)
+
+func newDiscoverCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "discover",
+		Short: "Build routes from endpoints declared in Service annotations",
+		Long: `Scans the Services of --namespace (or every namespace with -A) in the current
+kubeconfig context for the csv2httproute/endpoints annotation, listing one
+"[METHOD] path" entry per line, e.g.
+
+  csv2httproute/endpoints: |
+    GET /orders
+    POST /orders
+  csv2httproute/prefix: /shop   # optional
+  csv2httproute/port: "8080"    # optional, defaults to the first port
+
+Every annotated Service becomes a CSV under --inventory/<namespace>, which is
+then converted like any other inventory into --output/<namespace>, with the
+routes in the Service's namespace. Services that lose the annotation lose
+their CSV, so the next run drops their route.`,
+		Args: cobra.NoArgs,
+		RunE: runDiscover,
+	}
+	flags := cmd.Flags()
+	flags.StringVar(&discoverInventory, "inventory", "discovered", "Directory the discovered CSVs are written to, one subdirectory per namespace")
+	flags.BoolVarP(&discoverAllNamespaces, "all-namespaces", "A", false, "Scan the Services of every namespace")
+	flags.BoolVar(&discoverImportOnly, "import-only", false, "Only write the discovered CSVs, without generating routes")
+	addSelectorFlags(flags, "Services")
+	addGenerateFlags(flags, "generated")
+	return cmd
+}
+
+// discoveredService is an annotated Service and the rows it declares.
+type discoveredService struct {
+	Namespace, Name string
+	Rows            [][]string
+}
+
+func runDiscover(cmd *cobra.Command, args []string) error {
+	opts, err := selectorOptions()
+	if err != nil {
+		return err
+	}
+	client, contextNamespace, err := kubeDynamicClient()
+	if err != nil {
+		return err
+	}
+	scan := namespace
+	if !cmd.Flags().Changed("namespace") {
+		scan = contextNamespace
+	}
+	if discoverAllNamespaces {
+		scan = ""
+	}
+	items, err := listObjects(cmd.Context(), client, servicesGVR, scan, opts, "Services")
+	if err != nil {
+		return fmt.Errorf("failed to list Services: %w", err)
+	}
+
+	byNamespace := make(map[string][]discoveredService)
+	for _, item := range items {
+		svc, ok, err := discoverService(item)
+		if err != nil {
+			return fmt.Errorf("service %s/%s: %w", item.GetNamespace(), item.GetName(), err)
+		}
+		if ok {
+			byNamespace[svc.Namespace] = append(byNamespace[svc.Namespace], svc)
+		}
+	}
+	namespaces := make([]string, 0, len(byNamespace))
+	for ns := range byNamespace {
+		namespaces = append(namespaces, ns)
+	}
+	sort.Strings(namespaces)
+
+	for _, ns := range namespaces {
+		if err := writeDiscoveredInventory(ns, byNamespace[ns]); err != nil {
+			return err
+		}
+	}
+	if err := pruneDiscoveredInventory(scan, byNamespace); err != nil {
+		return err
+	}
+	if discoverImportOnly {
+		return nil
+	}
+
+	// Every namespace is generated separately; the bundle is pushed once,
+	// with all of them.
+	output, input, push := outputDir, inputDir, pushOCI
+	defer func() { outputDir, inputDir, pushOCI = output, input, push }()
+	pushOCI = ""
+	for _, ns := range namespaces {
+		namespace = ns
+		inputDir = filepath.Join(discoverInventory, ns)
+		outputDir = filepath.Join(output, ns)
+		if err := generate(cmd); err != nil {
+			return fmt.Errorf("namespace %s: %w", ns, err)
+		}
+	}
+	if pushOCI = push; pushOCI != "" && len(namespaces) > 0 {
+		return pushBundle(cmd.Context(), output)
+	}
+	return nil
+}
+
+// discoverService reads the endpoints annotation of a Service. ok is false
+// for Services without one.
+func discoverService(item unstructured.Unstructured) (svc discoveredService, ok bool, err error) {
+	annotations := item.GetAnnotations()
+	value := strings.TrimSpace(annotations[endpointsAnnotation])
+	if value == "" {
+		return svc, false, nil
+	}
+	port := strings.TrimSpace(annotations[portAnnotation])
+	if port == "" {
+		ports, _, _ := unstructured.NestedSlice(item.Object, "spec", "ports")
+		if len(ports) == 0 {
+			return svc, false, fmt.Errorf("no ports; set the %s annotation", portAnnotation)
+		}
+		p, _ := ports[0].(map[string]any)
+		n, _, _ := unstructured.NestedInt64(p, "port")
+		port = strconv.FormatInt(n, 10)
+	}
+	prefix := strings.TrimSpace(annotations[prefixAnnotation])
+
+	svc = discoveredService{Namespace: item.GetNamespace(), Name: item.GetName()}
+	for _, entry := range strings.FieldsFunc(value, func(r rune) bool { return r == '\n' || r == ',' }) {
+		fields := strings.Fields(entry)
+		var method, url string
+		switch len(fields) {
+		case 0:
+			continue
+		case 1:
+			url = fields[0]
+		case 2:
+			method, url = fields[0], fields[1]
+		default:
+			return svc, false, fmt.Errorf("invalid %s entry %q (want [METHOD] path)", endpointsAnnotation, entry)
+		}
+		if !strings.HasPrefix(url, "/") {
+			return svc, false, fmt.Errorf("invalid %s entry %q: path must start with /", endpointsAnnotation, entry)
+		}
+		svc.Rows = append(svc.Rows, []string{method, url, prefix, svc.Name, port,
+			fmt.Sprintf("Discovered from Service %s/%s", svc.Namespace, svc.Name)})
+	}
+	return svc, len(svc.Rows) > 0, nil
+}
+
+// writeDiscoveredInventory writes one endpoints-<service>.csv per Service of
+// namespace ns.
+func writeDiscoveredInventory(ns string, services []discoveredService) error {
+	dir := filepath.Join(discoverInventory, ns)
+	if err := os.MkdirAll(dir, 0777); err != nil {
+		return fmt.Errorf("failed to create inventory directory: %w", err)
+	}
+	for _, svc := range services {
+		var buf bytes.Buffer
+		w := csv.NewWriter(&buf)
+		if err := w.Write([]string{"Method", "URL", "Prefix", "Service", "Port", "Comment"}); err != nil {
+			return err
+		}
+		if err := w.WriteAll(svc.Rows); err != nil {
+			return err
+		}
+		path := filepath.Join(dir, "endpoints-"+svc.Name+".csv")
+		if err := os.WriteFile(path, buf.Bytes(), 0666); err != nil {
+			return err
+		}
+		if !quiet {
+			fmt.Printf("Discovered %s (%d endpoint(s))\n", path, len(svc.Rows))
+		}
+	}
+	return nil
+}
+
+// pruneDiscoveredInventory removes the CSVs of Services that were scanned
+// but no longer carry the annotation. Namespaces outside the scan are kept.
+func pruneDiscoveredInventory(scan string, found map[string][]discoveredService) error {
+	dirs, err := os.ReadDir(discoverInventory)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	for _, d := range dirs {
+		if !d.IsDir() || (scan != "" && d.Name() != scan) {
+			continue
+		}
+		keep := make(map[string]bool)
+		for _, svc := range found[d.Name()] {
+			keep["endpoints-"+svc.Name+".csv"] = true
+		}
+		files, err := os.ReadDir(filepath.Join(discoverInventory, d.Name()))
+		if err != nil {
+			return err
+		}
+		for _, f := range files {
+			if f.IsDir() || keep[f.Name()] || !strings.HasPrefix(f.Name(), "endpoints-") || !isCSVFile(f.Name()) {
+				continue
+			}
+			path := filepath.Join(discoverInventory, d.Name(), f.Name())
+			if err := os.Remove(path); err != nil {
+				return err
+			}
+			if !quiet {
+				fmt.Printf("Removed %s (Service no longer annotated)\n", path)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,253 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	htmltemplate "html/template"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/template"
+
+	"github.com/spf13/cobra"
+)
+
+var docsFormat string
+
+func newDocsCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "docs",
+		Short: "Generate browsable Markdown or HTML documentation of the routing inventory",
+		Long: `Builds the routes from the CSV inventory without writing them and documents
+every endpoint: hostname, path, method, backend and comment. The output
+directory gets an index page listing every hostname, plus one page per team
+under teams/, with teams taken from --owners-file or the owner column.`,
+		Args: cobra.NoArgs,
+		RunE: runDocs,
+	}
+	cmd.Flags().StringVarP(&serviceName, "service", "s", "my-service", "Default backend service name")
+	cmd.Flags().IntVarP(&servicePort, "port", "p", 80, "Default backend service port")
+	cmd.Flags().StringVar(&docsFormat, "format", "markdown", "Output format: markdown or html")
+	addGenerateFlags(cmd.Flags(), "docs")
+	return cmd
+}
+
+// docsRow is one documented endpoint.
+type docsRow struct {
+	Hostname, Method, Path        string
+	Description, Backend, Comment string
+	Team, TeamSlug                string
+	// Route is the namespace/name of the HTTPRoute serving the endpoint.
+	Route string
+}
+
+type docsHost struct {
+	Hostname string
+	Rows     []docsRow
+}
+
+type docsTeam struct {
+	Name, Slug string
+	Endpoints  int
+}
+
+// docsPage is the data of one page: the index (Team empty) or a team page.
+type docsPage struct {
+	Title string
+	Team  string
+	Ext   string
+	Hosts []docsHost
+	Teams []docsTeam
+}
+
+func runDocs(cmd *cobra.Command, args []string) error {
+	if docsFormat != "markdown" && docsFormat != "html" {
+		return fmt.Errorf("invalid --format %q (must be markdown or html)", docsFormat)
+	}
+	if err := prepareGeneration(cmd.Context()); err != nil {
+		return err
+	}
+	routes, err := buildInventoryRoutes(cmd.Context())
+	if err != nil {
+		return err
+	}
+	rows := docsRows(routes)
+
+	ext := ".md"
+	if docsFormat == "html" {
+		ext = ".html"
+	}
+	teams := make(map[string]*docsTeam)
+	for _, r := range rows {
+		if r.Team == "" {
+			continue
+		}
+		if teams[r.TeamSlug] == nil {
+			teams[r.TeamSlug] = &docsTeam{Name: r.Team, Slug: r.TeamSlug}
+		}
+		teams[r.TeamSlug].Endpoints++
+	}
+	var teamList []docsTeam
+	for _, t := range teams {
+		teamList = append(teamList, *t)
+	}
+	sort.Slice(teamList, func(i, j int) bool { return teamList[i].Slug < teamList[j].Slug })
+
+	if err := ensureOutputDir(outputDir); err != nil {
+		return fmt.Errorf("failed to create output directory: %w", err)
+	}
+	index := docsPage{Title: "Routing inventory", Ext: ext, Hosts: docsHosts(rows), Teams: teamList}
+	if err := writeDocsPage(filepath.Join(outputDir, "index"+ext), index); err != nil {
+		return err
+	}
+	if len(teamList) > 0 {
+		if err := ensureOutputDir(filepath.Join(outputDir, "teams")); err != nil {
+			return fmt.Errorf("failed to create output directory: %w", err)
+		}
+	}
+	for _, t := range teamList {
+		var own []docsRow
+		for _, r := range rows {
+			if r.TeamSlug == t.Slug {
+				own = append(own, r)
+			}
+		}
+		page := docsPage{Title: "Endpoints of " + t.Name, Team: t.Name, Ext: ext, Hosts: docsHosts(own)}
+		if err := writeDocsPage(filepath.Join(outputDir, "teams", t.Slug+ext), page); err != nil {
+			return err
+		}
+	}
+	if !quiet {
+		fmt.Printf("Documented %d endpoint(s) of %d team(s) in %s\n", len(rows), len(teamList), outputDir)
+	}
+	return nil
+}
+
+// docsRows lists the endpoints of routes in inventory order.
+func docsRows(routes []generatedRoute) []docsRow {
+	var rows []docsRow
+	for _, gr := range routes {
+		host := "*"
+		if len(gr.Route.Spec.Hostnames) > 0 {
+			host = gr.Route.Spec.Hostnames[0]
+		}
+		for _, e := range gr.Endpoints {
+			var backends []string
+			for _, b := range backendsFor(e) {
+				backend := b.Name
+				if b.Namespace != "" {
+					backend = b.Namespace + "/" + backend
+				}
+				if b.Port != 0 {
+					backend += fmt.Sprintf(":%d", b.Port)
+				}
+				backends = append(backends, backend)
+			}
+			backend := strings.Join(backends, ", ")
+			method := e.Method
+			if method == "" {
+				method = "ANY"
+			}
+			team := e.Owner
+			if o := ownerOf(e); o != nil {
+				team = o.Team
+			}
+			rows = append(rows, docsRow{
+				Hostname:    host,
+				Method:      method,
+				Path:        e.URL,
+				Description: e.Description,
+				Backend:     backend,
+				Comment:     e.Comment,
+				Team:        team,
+				TeamSlug:    ownerSlug(team),
+				Route:       gr.Route.Metadata.Namespace + "/" + gr.Route.Metadata.Name,
+			})
+		}
+	}
+	return rows
+}
+
+// docsHosts groups rows by hostname, sorted by hostname and then path.
+func docsHosts(rows []docsRow) []docsHost {
+	byHost := make(map[string][]docsRow)
+	for _, r := range rows {
+		byHost[r.Hostname] = append(byHost[r.Hostname], r)
+	}
+	hosts := make([]docsHost, 0, len(byHost))
+	for host, rs := range byHost {
+		sort.SliceStable(rs, func(i, j int) bool {
+			if rs[i].Path != rs[j].Path {
+				return rs[i].Path < rs[j].Path
+			}
+			return rs[i].Method < rs[j].Method
+		})
+		hosts = append(hosts, docsHost{Hostname: host, Rows: rs})
+	}
+	sort.Slice(hosts, func(i, j int) bool { return hosts[i].Hostname < hosts[j].Hostname })
+	return hosts
+}
+
+// markdownCell escapes a value for a Markdown table cell, including HTML
+// that renderers would otherwise interpret.
+func markdownCell(s string) string {
+	s = strings.NewReplacer("|", `\|`, "<", "&lt;", ">", "&gt;").Replace(s)
+	return strings.Join(strings.Fields(s), " ")
+}
+
+var docsMarkdownTemplate = template.Must(template.New("docs").Funcs(template.FuncMap{"cell": markdownCell}).Parse(`# {{.Title}}
+{{if .Team}}
+[Back to the index](../index{{.Ext}})
+{{end}}{{if .Teams}}
+## Teams
+
+{{range .Teams}}- [{{.Name}}](teams/{{.Slug}}{{$.Ext}}) ({{.Endpoints}} endpoint(s))
+{{end}}{{end}}{{range .Hosts}}
+## {{.Hostname}}
+
+| Method | Path | Description | Backend | Team | Route | Comment |
+|--------|------|-------------|---------|------|-------|---------|
+{{range .Rows}}| {{.Method}} | ` + "`{{cell .Path}}`" + ` | {{cell .Description}} | {{cell .Backend}} | {{cell .Team}} | {{.Route}} | {{cell .Comment}} |
+{{end}}{{end}}`))
+
+var docsHTMLTemplate = htmltemplate.Must(htmltemplate.New("docs").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{.Title}}</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+table { border-collapse: collapse; }
+th, td { border: 1px solid #ccc; padding: 0.3em 0.6em; text-align: left; }
+code { font-size: 0.95em; }
+</style>
+</head>
+<body>
+<h1>{{.Title}}</h1>
+{{if .Team}}<p><a href="../index{{.Ext}}">Back to the index</a></p>
+{{end}}{{if .Teams}}<h2>Teams</h2>
+<ul>
+{{range .Teams}}<li><a href="teams/{{.Slug}}{{$.Ext}}">{{.Name}}</a> ({{.Endpoints}} endpoint(s))</li>
+{{end}}</ul>
+{{end}}{{range .Hosts}}<h2>{{.Hostname}}</h2>
+<table>
+<tr><th>Method</th><th>Path</th><th>Description</th><th>Backend</th><th>Team</th><th>Route</th><th>Comment</th></tr>
+{{range .Rows}}<tr><td>{{.Method}}</td><td><code>{{.Path}}</code></td><td>{{.Description}}</td><td>{{.Backend}}</td><td>{{.Team}}</td><td>{{.Route}}</td><td>{{.Comment}}</td></tr>
+{{end}}</table>
+{{end}}</body>
+</html>
+`))
+
+func writeDocsPage(path string, page docsPage) error {
+	var buf bytes.Buffer
+	var err error
+	if docsFormat == "html" {
+		err = docsHTMLTemplate.Execute(&buf, page)
+	} else {
+		err = docsMarkdownTemplate.Execute(&buf, page)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to render %s: %w", path, err)
+	}
+	return writeOutputFile(path, buf.Bytes())
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// domainRule maps endpoints under a path prefix to their own hostname and
+// parent gateway, letting a shared inventory be split by routing domain
+// without extra CSV columns.
+type domainRule struct {
+	Prefix           string `yaml:"prefix"`
+	Hostname         string `yaml:"hostname"`
+	Namespace        string `yaml:"namespace,omitempty"`
+	Gateway          string `yaml:"gateway,omitempty"`
+	GatewayNamespace string `yaml:"gatewayNamespace,omitempty"`
+	// name is the slug source of rules made from "#!" directives, which
+	// need not set a hostname.
+	name string
+	// namespaceOnly marks a rule of rows that only set their namespace, so
+	// they keep the hostname and gateway of their profile.
+	namespaceOnly bool
+}
+
+// domainMapConfig is the --domain-map file layout.
+type domainMapConfig struct {
+	Domains []domainRule `yaml:"domains"`
+}
+
+// domainMap holds the rules loaded from --domain-map.
+var domainMap []domainRule
+
+// domainGroup is a set of endpoints sharing one route target. Domain is nil
+// for endpoints that matched no rule.
+type domainGroup struct {
+	Domain    *domainRule
+	Target    routeTarget
+	Endpoints []Endpoint
+}
+
+var nonSlugChars = regexp.MustCompile(`[^a-z0-9-]+`)
+
+// slug derives the route name suffix for the rule's hostname, or for the
+// name of a directive rule.
+func (d domainRule) slug() string {
+	name := d.Hostname
+	if d.name != "" {
+		name = d.name
+	}
+	s := strings.ReplaceAll(strings.ToLower(name), "*", "wildcard")
+	return strings.Trim(nonSlugChars.ReplaceAllString(s, "-"), "-")
+}
+
+// target returns the rule's route target; unset gateway fields fall back to
+// the --gateway flags.
+func (d domainRule) target() routeTarget {
+	t := routeTarget{
+		Hostname:         d.Hostname,
+		Namespace:        d.Namespace,
+		Gateway:          d.Gateway,
+		GatewayNamespace: d.GatewayNamespace,
+	}
+	if t.Gateway == "" {
+		t.Gateway = gatewayName
+		if t.GatewayNamespace == "" {
+			t.GatewayNamespace = gatewayNamespace
+		}
+	}
+	return t
+}
+
+func loadDomainMap(ctx context.Context, path string) error {
+	domainMap = nil
+	if path == "" {
+		return nil
+	}
+	data, err := readInput(ctx, path)
+	if err != nil {
+		return fmt.Errorf("failed to read domain map: %w", err)
+	}
+	var cfg domainMapConfig
+	if err := yaml.Unmarshal(data, &cfg); err != nil {
+		return fmt.Errorf("failed to parse domain map %s: %w", path, err)
+	}
+	seen := make(map[string]bool)
+	for i, d := range cfg.Domains {
+		if !strings.HasPrefix(d.Prefix, "/") {
+			return fmt.Errorf("domain map entry %d: prefix %q must start with /", i+1, d.Prefix)
+		}
+		if d.Hostname == "" {
+			return fmt.Errorf("domain map entry %d: hostname is required", i+1)
+		}
+		if seen[d.Prefix] {
+			return fmt.Errorf("domain map entry %d: duplicate prefix %s", i+1, d.Prefix)
+		}
+		seen[d.Prefix] = true
+	}
+	domainMap = cfg.Domains
+	return nil
+}
+
+// matchDomain returns the domain rule with the longest prefix covering e, or
+// nil. A row matches by its Prefix column or, failing that, by its URL. Rows
+// under a target directive use the directive instead.
+func matchDomain(e Endpoint) *domainRule {
+	if d := directiveDomain(e); d != nil {
+		return d
+	}
+	var best *domainRule
+	for i := range domainMap {
+		d := &domainMap[i]
+		if !hasPathPrefix(e.Prefix, d.Prefix) && !hasPathPrefix(e.URL, d.Prefix) {
+			continue
+		}
+		if best == nil || len(d.Prefix) > len(best.Prefix) {
+			best = d
+		}
+	}
+	return best
+}
+
+// hasPathPrefix reports whether path lies under prefix on a segment boundary.
+func hasPathPrefix(path, prefix string) bool {
+	if path == "" || !strings.HasPrefix(path, prefix) {
+		return false
+	}
+	return len(path) == len(prefix) || strings.HasSuffix(prefix, "/") || path[len(prefix)] == '/'
+}
+
+// partitionByDomain splits endpoints by their domain rule, keeping the order
+// in which domains first appear. Endpoints matching no rule are grouped under
+// the default target.
+func partitionByDomain(endpoints []Endpoint) []domainGroup {
+	var groups []domainGroup
+	index := make(map[*domainRule]int)
+	for _, e := range endpoints {
+		d := matchDomain(e)
+		i, ok := index[d]
+		if !ok {
+			target := defaultTarget()
+			if d != nil {
+				target = d.target()
+			}
+			i = len(groups)
+			index[d] = i
+			groups = append(groups, domainGroup{Domain: d, Target: target})
+		}
+		groups[i].Endpoints = append(groups[i].Endpoints, e)
+	}
+	return groups
+}
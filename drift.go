@@ -0,0 +1,364 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/dynamic"
+)
+
+// diffAgainst is diff --against: "cluster" or a directory of previously
+// generated YAML.
+var diffAgainst string
+
+func newDiffCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "diff",
+		Short: "Diff the generated HTTPRoutes against the live cluster or a directory",
+		Long: `Generates the routes from --input in memory and prints a unified diff against
+the HTTPRoutes currently in the cluster (--against cluster, the default) or in
+a directory of previously generated YAML (--against DIR). Fields the API server
+manages or defaults are ignored, so only real drift is shown. It exits non-zero
+when any route differs, is missing, or was applied by this tool but is no
+longer generated.`,
+		RunE: runDiff,
+	}
+	cmd.Flags().StringVarP(&serviceName, "service", "s", "my-service", "Default backend service name")
+	cmd.Flags().IntVarP(&servicePort, "port", "p", 80, "Default backend service port")
+	cmd.Flags().StringVar(&serviceNamespace, "service-namespace", "", "Namespace for the backend service")
+	cmd.Flags().StringVar(&diffAgainst, "against", "cluster", "Compare against the cluster of the kubeconfig context, or a directory of generated YAML")
+	addGenerateFlags(cmd.Flags(), "generated")
+	return cmd
+}
+
+func runDiff(cmd *cobra.Command, args []string) error {
+	tmp, err := os.MkdirTemp("", "csv2httproute-diff-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmp)
+
+	// Routes are regenerated as files so kept hand-written rules from
+	// --output are part of the desired state, exactly as written.
+	output := outputDir
+	outputDir = tmp
+	noHeaderComment = true
+	generateOnly()
+	existingOutputDir = output
+	err = run(cmd, args)
+	outputDir, existingOutputDir = output, ""
+	if err != nil {
+		return err
+	}
+	want, err := routesInDir(tmp)
+	if err != nil {
+		return err
+	}
+
+	var live liveRoutes
+	if diffAgainst == "cluster" {
+		client, _, err := kubeDynamicClient()
+		if err != nil {
+			return err
+		}
+		live = &clusterRoutes{ctx: cmd.Context(), client: client}
+	} else {
+		routes, err := routesInDir(diffAgainst)
+		if err != nil {
+			return err
+		}
+		live = dirRoutes(routes)
+	}
+
+	keys := make([]string, 0, len(want))
+	for key := range want {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	drifted := 0
+	for _, key := range keys {
+		got, err := live.get(key)
+		if err != nil {
+			return err
+		}
+		desired, err := normalizedYAML(want[key])
+		if err != nil {
+			return err
+		}
+		if got == nil {
+			fmt.Printf("%s HTTPRoute %s (not in %s)\n", colorize(ansiGreen, "MISSING"), key, diffAgainst)
+			fmt.Print(colorDiff(unifiedDiff("/dev/null", "generated/"+key, "", desired)))
+			drifted++
+			continue
+		}
+		current, err := normalizedYAML(got)
+		if err != nil {
+			return err
+		}
+		if current == desired {
+			continue
+		}
+		fmt.Printf("%s HTTPRoute %s\n", colorize(ansiYellow, "DRIFTED"), key)
+		fmt.Print(colorDiff(unifiedDiff("live/"+key, "generated/"+key, current, desired)))
+		drifted++
+	}
+
+	extra, err := live.extra(want)
+	if err != nil {
+		return err
+	}
+	for _, key := range extra {
+		fmt.Printf("%s HTTPRoute %s (no longer generated)\n", colorize(ansiRed, "EXTRA  "), key)
+		drifted++
+	}
+
+	if drifted > 0 {
+		return fmt.Errorf("%d HTTPRoute(s) differ from %s", drifted, diffAgainst)
+	}
+	fmt.Printf("%d HTTPRoute(s) match %s\n", len(want), diffAgainst)
+	return nil
+}
+
+// liveRoutes is the current state routes are compared against, keyed by
+// namespace/name.
+type liveRoutes interface {
+	get(key string) (map[string]any, error)
+	// extra lists the routes of the current state that are not in want
+	// and belong to this tool.
+	extra(want map[string]map[string]any) ([]string, error)
+}
+
+// dirRoutes are the HTTPRoutes of a directory. Every route in it that is
+// not generated anymore is extra.
+type dirRoutes map[string]map[string]any
+
+func (d dirRoutes) get(key string) (map[string]any, error) {
+	return d[key], nil
+}
+
+func (d dirRoutes) extra(want map[string]map[string]any) ([]string, error) {
+	var keys []string
+	for key := range d {
+		if _, ok := want[key]; !ok {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
+
+// clusterRoutes are the HTTPRoutes of the cluster. Routes in the namespaces
+// of the generated ones that --apply manages are extra when not generated
+// anymore; others may belong to anyone. The routes of a namespace are
+// listed once, in pages, rather than read one request per route.
+type clusterRoutes struct {
+	ctx    context.Context
+	client dynamic.Interface
+	// listed are the routes of the namespaces listed so far, by namespace.
+	listed map[string][]unstructured.Unstructured
+}
+
+// namespace returns the routes of ns, listing them on first use.
+func (c *clusterRoutes) namespace(ns string) ([]unstructured.Unstructured, error) {
+	if items, ok := c.listed[ns]; ok {
+		return items, nil
+	}
+	items, err := listObjects(c.ctx, c.client, httpRoutesGVR, ns, metav1.ListOptions{}, "HTTPRoutes in "+ns)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list HTTPRoutes in %s: %w", ns, err)
+	}
+	if c.listed == nil {
+		c.listed = make(map[string][]unstructured.Unstructured)
+	}
+	c.listed[ns] = items
+	return items, nil
+}
+
+func (c *clusterRoutes) get(key string) (map[string]any, error) {
+	ns, name, _ := strings.Cut(key, "/")
+	items, err := c.namespace(ns)
+	if err != nil {
+		return nil, err
+	}
+	for _, item := range items {
+		if item.GetName() == name {
+			return item.Object, nil
+		}
+	}
+	return nil, nil
+}
+
+func (c *clusterRoutes) extra(want map[string]map[string]any) ([]string, error) {
+	var namespaces []string
+	for key := range want {
+		ns, _, _ := strings.Cut(key, "/")
+		if !slices.Contains(namespaces, ns) {
+			namespaces = append(namespaces, ns)
+		}
+	}
+	var keys []string
+	for _, ns := range namespaces {
+		items, err := c.namespace(ns)
+		if err != nil {
+			return nil, err
+		}
+		for _, item := range items {
+			key := ns + "/" + item.GetName()
+			if _, ok := want[key]; !ok && appliedByUs(item) {
+				keys = append(keys, key)
+			}
+		}
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
+
+// appliedByUs reports whether --apply manages fields of obj.
+func appliedByUs(obj unstructured.Unstructured) bool {
+	for _, entry := range obj.GetManagedFields() {
+		if entry.Manager == applyFieldManager {
+			return true
+		}
+	}
+	return false
+}
+
+// routesInDir returns the HTTPRoutes of the YAML files below dir by
+// namespace/name.
+func routesInDir(dir string) (map[string]map[string]any, error) {
+	routes := make(map[string]map[string]any)
+	err := filepath.WalkDir(dir, func(path string, d os.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		if ext := filepath.Ext(path); ext != ".yaml" && ext != ".yml" {
+			return nil
+		}
+		objs, err := routeObjects(path)
+		if err != nil {
+			return err
+		}
+		for _, obj := range objs {
+			ns := obj.GetNamespace()
+			if ns == "" {
+				ns = "default"
+			}
+			routes[ns+"/"+obj.GetName()] = obj.Object
+		}
+		return nil
+	})
+	return routes, err
+}
+
+// normalizedYAML renders the part of a route object this tool generates,
+// with the server-managed metadata and status removed and the defaults of
+// the HTTPRoute CRD filled in, so both sides of a diff compare equal unless
+// the route really differs.
+func normalizedYAML(obj map[string]any) (string, error) {
+	route := map[string]any{
+		"apiVersion": obj["apiVersion"],
+		"kind":       obj["kind"],
+	}
+	if meta, ok := obj["metadata"].(map[string]any); ok {
+		m := map[string]any{"name": meta["name"], "namespace": meta["namespace"]}
+		if m["namespace"] == nil {
+			m["namespace"] = "default"
+		}
+		if labels, ok := meta["labels"].(map[string]any); ok {
+			// The marker of adopted routes is not generated
+			kept := maps.Clone(labels)
+			if kept[managedByLabel] == applyFieldManager {
+				delete(kept, managedByLabel)
+			}
+			if len(kept) > 0 {
+				m["labels"] = kept
+			}
+		}
+		if annotations, ok := meta["annotations"].(map[string]any); ok {
+			kept := make(map[string]any)
+			for k, v := range annotations {
+				if k != "kubectl.kubernetes.io/last-applied-configuration" && k != adoptedAnnotationKey {
+					kept[k] = v
+				}
+			}
+			if len(kept) > 0 {
+				m["annotations"] = kept
+			}
+		}
+		route["metadata"] = m
+	}
+	if spec, ok := obj["spec"].(map[string]any); ok {
+		route["spec"] = defaultRouteSpec(spec)
+	}
+	data, err := yaml.Marshal(route)
+	return string(data), err
+}
+
+// defaultRouteSpec fills in the defaults the API server applies to an
+// HTTPRoute spec.
+func defaultRouteSpec(spec map[string]any) map[string]any {
+	for _, ref := range listOfMaps(spec["parentRefs"]) {
+		setDefault(ref, "group", "gateway.networking.k8s.io")
+		setDefault(ref, "kind", "Gateway")
+	}
+	rules := listOfMaps(spec["rules"])
+	if spec["rules"] == nil {
+		rule := map[string]any{}
+		spec["rules"] = []any{rule}
+		rules = []map[string]any{rule}
+	}
+	for _, rule := range rules {
+		if rule["matches"] == nil {
+			rule["matches"] = []any{map[string]any{}}
+		}
+		for _, m := range listOfMaps(rule["matches"]) {
+			if m["path"] == nil {
+				m["path"] = map[string]any{}
+			}
+			if path, ok := m["path"].(map[string]any); ok {
+				setDefault(path, "type", "PathPrefix")
+				setDefault(path, "value", "/")
+			}
+			for _, h := range listOfMaps(m["headers"]) {
+				setDefault(h, "type", "Exact")
+			}
+			for _, q := range listOfMaps(m["queryParams"]) {
+				setDefault(q, "type", "Exact")
+			}
+		}
+		for _, b := range listOfMaps(rule["backendRefs"]) {
+			setDefault(b, "group", "")
+			setDefault(b, "kind", "Service")
+			setDefault(b, "weight", 1)
+		}
+	}
+	return spec
+}
+
+func listOfMaps(v any) []map[string]any {
+	items, _ := v.([]any)
+	var maps []map[string]any
+	for _, item := range items {
+		if m, ok := item.(map[string]any); ok {
+			maps = append(maps, m)
+		}
+	}
+	return maps
+}
+
+func setDefault(m map[string]any, key string, value any) {
+	if _, ok := m[key]; !ok {
+		m[key] = value
+	}
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Modes of --duplicate-prefixes.
+const (
+	duplicatesAllow = "allow"
+	duplicatesFail  = "fail"
+	duplicatesMerge = "merge"
+)
+
+var duplicatePrefixMode string
+
+// endpointOverrides replaces the parsed rows of a file after duplicate
+// prefixes were merged across files.
+var endpointOverrides map[string][]Endpoint
+
+func validateDuplicatePrefixMode(mode string) error {
+	switch mode {
+	case duplicatesAllow, duplicatesFail, duplicatesMerge:
+		return nil
+	}
+	return fmt.Errorf("invalid --duplicate-prefixes %q (must be %s, %s or %s)", mode, duplicatesAllow, duplicatesFail, duplicatesMerge)
+}
+
+// prefixClaim identifies a prefix rule on a hostname and gateway. Two files
+// claiming the same one would produce competing HTTPRoutes whose precedence
+// is left to the implementation.
+type prefixClaim struct {
+	Target routeTarget
+	Prefix string
+}
+
+func (c prefixClaim) String() string {
+	return fmt.Sprintf("prefix %s on %s", c.Prefix, c.Target)
+}
+
+func (t routeTarget) String() string {
+	gw := t.Gateway
+	if t.GatewayNamespace != "" {
+		gw = t.GatewayNamespace + "/" + gw
+	}
+	host := t.Hostname
+	if host == "" {
+		host = "*"
+	}
+	return fmt.Sprintf("host %s (gateway %s)", host, gw)
+}
+
+// claimOf returns the claim of a prefixed row.
+func claimOf(e Endpoint) prefixClaim {
+	target := defaultTarget()
+	if d := matchDomain(e); d != nil {
+		target = d.target()
+	}
+	return prefixClaim{Target: target, Prefix: e.Prefix}
+}
+
+// resolveDuplicatePrefixes finds prefixes declared by more than one file.
+// In fail mode they are reported as one error; in merge mode the rows of
+// every later file are moved into the first file declaring the prefix, so
+// the prefix is served by a single route. Files that fail to parse are left
+// for processCSV to report.
+func resolveDuplicatePrefixes(ctx context.Context, files []string) error {
+	endpointOverrides = nil
+	if duplicatePrefixMode == duplicatesAllow || len(files) < 2 {
+		return nil
+	}
+
+	parsed := make(map[string][]Endpoint)
+	owners := make(map[prefixClaim][]string)
+	for _, path := range files {
+		endpoints, err := parseInput(ctx, path)
+		if err != nil {
+			continue
+		}
+		parsed[path] = endpoints
+		seen := make(map[prefixClaim]bool)
+		for _, e := range endpoints {
+			if e.Prefix == "" {
+				continue
+			}
+			c := claimOf(e)
+			if !seen[c] {
+				seen[c] = true
+				owners[c] = append(owners[c], path)
+			}
+		}
+	}
+
+	var claims []prefixClaim
+	for c, paths := range owners {
+		if len(paths) > 1 {
+			claims = append(claims, c)
+		}
+	}
+	if len(claims) == 0 {
+		return nil
+	}
+	sort.Slice(claims, func(i, j int) bool { return claims[i].String() < claims[j].String() })
+
+	if duplicatePrefixMode == duplicatesFail {
+		var report []string
+		for _, c := range claims {
+			var decls []string
+			for _, path := range owners[c] {
+				decls = append(decls, fmt.Sprintf("%s (%s)", filepath.Base(path), claimLines(parsed[path], c)))
+			}
+			report = append(report, fmt.Sprintf("  %s is declared in %s", c, strings.Join(decls, ", ")))
+		}
+		return fmt.Errorf("%d prefix(es) declared in more than one file:\n%s", len(claims), strings.Join(report, "\n"))
+	}
+
+	endpointOverrides = parsed
+	for _, c := range claims {
+		owner := owners[c][0]
+		for _, path := range owners[c][1:] {
+			var kept []Endpoint
+			for _, e := range endpointOverrides[path] {
+				if e.Prefix != "" && claimOf(e) == c {
+					endpointOverrides[owner] = append(endpointOverrides[owner], e)
+					continue
+				}
+				kept = append(kept, e)
+			}
+			endpointOverrides[path] = kept
+			if !quiet {
+				fmt.Printf("Merged %s from %s into %s\n", c, filepath.Base(path), filepath.Base(owner))
+			}
+		}
+	}
+	return nil
+}
+
+// readEndpoints returns the rows of path, after any duplicate-prefix merge.
+func readEndpoints(ctx context.Context, path string) ([]Endpoint, error) {
+	if endpoints, ok := endpointOverrides[path]; ok {
+		return endpoints, nil
+	}
+	return parseInput(ctx, path)
+}
+
+// claimLines lists the lines of endpoints that make claim c.
+func claimLines(endpoints []Endpoint, c prefixClaim) string {
+	var lines []string
+	for _, e := range endpoints {
+		if e.Prefix != "" && claimOf(e) == c {
+			lines = append(lines, fmt.Sprint(e.Line))
+		}
+	}
+	if len(lines) == 1 {
+		return "line " + lines[0]
+	}
+	return "lines " + strings.Join(lines, ", ")
+}
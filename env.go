@@ -0,0 +1,130 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+// envPrefix starts the name of the environment variable of every flag, e.g.
+// CSV2HTTPROUTE_GATEWAY_NAMESPACE for --gateway-namespace.
+const envPrefix = "CSV2HTTPROUTE_"
+
+// envFile is --env-file, the dotenv file whose variables fill in the
+// environment before the flags are read from it.
+var envFile string
+
+// envArgs are the flags set from the environment, as --name=value, for the
+// command line recorded in the generated files.
+var envArgs []string
+
+// defaultEnvFile is read when it exists and --env-file is not given.
+const defaultEnvFile = ".env"
+
+// flagEnvName is the environment variable setting the flag name.
+func flagEnvName(name string) string {
+	return envPrefix + strings.ToUpper(strings.ReplaceAll(name, "-", "_"))
+}
+
+// applyEnv sets the flags of cmd not given on the command line from their
+// CSV2HTTPROUTE_* environment variables, after loading the --env-file. A
+// flag set this way counts as given, so it still wins over the defaults
+// of --config, while the command line wins over the environment.
+func applyEnv(cmd *cobra.Command) error {
+	if err := loadEnvFile(cmd.Flags()); err != nil {
+		return err
+	}
+	envArgs = nil
+	var err error
+	cmd.Flags().VisitAll(func(f *pflag.Flag) {
+		value, ok := os.LookupEnv(flagEnvName(f.Name))
+		if !ok || f.Changed || err != nil || f.Name == "help" {
+			return
+		}
+		if setErr := cmd.Flags().Set(f.Name, value); setErr != nil {
+			err = fmt.Errorf("invalid %s %q: %w", flagEnvName(f.Name), value, setErr)
+			return
+		}
+		envArgs = append(envArgs, "--"+f.Name+"="+value)
+	})
+	return err
+}
+
+// loadEnvFile sets the variables of the --env-file, or of a .env in the
+// working directory, that are not in the environment yet: the real
+// environment wins, as with docker compose. Besides the CSV2HTTPROUTE_*
+// variables of the flags this covers the others read, such as SOPS_AGE_KEY.
+func loadEnvFile(flags *pflag.FlagSet) error {
+	path, explicit := envFile, flags.Changed("env-file")
+	if !explicit {
+		if p, ok := os.LookupEnv(flagEnvName("env-file")); ok {
+			path, explicit = p, true
+		}
+	}
+	if path == "" {
+		return nil
+	}
+	vars, err := readEnvFile(path)
+	if errors.Is(err, fs.ErrNotExist) && !explicit {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read --env-file: %w", err)
+	}
+	for _, v := range vars {
+		if _, ok := os.LookupEnv(v[0]); !ok {
+			os.Setenv(v[0], v[1])
+		}
+	}
+	return nil
+}
+
+// readEnvFile parses the KEY=VALUE lines of a dotenv file, in order. Blank
+// lines and # comments are skipped, an export prefix is allowed, and values
+// may be quoted: double-quoted ones with Go escapes such as \n, single-quoted
+// ones literally. Unquoted values end at a " #" comment.
+func readEnvFile(path string) ([][2]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var vars [][2]string
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		key, value, ok := strings.Cut(strings.TrimPrefix(line, "export "), "=")
+		key, value = strings.TrimSpace(key), strings.TrimSpace(value)
+		if !ok || key == "" || strings.ContainsAny(key, " \t") {
+			return nil, fmt.Errorf("%s:%d: want KEY=VALUE", path, n)
+		}
+		switch {
+		case strings.HasPrefix(value, `"`):
+			if value, err = strconv.Unquote(value); err != nil {
+				return nil, fmt.Errorf("%s:%d: invalid quoted value of %s", path, n, key)
+			}
+		case strings.HasPrefix(value, "'"):
+			if len(value) < 2 || !strings.HasSuffix(value, "'") {
+				return nil, fmt.Errorf("%s:%d: invalid quoted value of %s", path, n, key)
+			}
+			value = value[1 : len(value)-1]
+		default:
+			if i := strings.Index(value, " #"); i >= 0 {
+				value = strings.TrimSpace(value[:i])
+			}
+		}
+		vars = append(vars, [2]string{key, value})
+	}
+	return vars, scanner.Err()
+}
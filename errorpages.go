@@ -0,0 +1,213 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"mime"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/arencloud/csv2httproute/pkg/convert"
+)
+
+// Migrated hosts should answer unmatched requests, and failed ones, with
+// their own branded error pages rather than the gateway's default. Gateway
+// API can route the unmatched ones to an error page service; answering
+// them directly, or replacing the error responses of the backends, takes
+// the resources of the implementation, here those of Envoy Gateway.
+
+var (
+	// errorService is --error-service: the error page service the requests
+	// no rule matches are routed to.
+	errorService string
+	// errorPageFile is --error-page: the page Envoy Gateway answers the
+	// requests no rule matches with itself.
+	errorPageFile string
+	// errorCodes is --error-codes: the response codes of the backends
+	// Envoy Gateway replaces with the --error-page.
+	errorCodes []string
+)
+
+const (
+	// errorCodeHeader tells the --error-service the status of the page to
+	// render, as the custom error pages of ingress-nginx expect.
+	errorCodeHeader = "X-Code"
+	// errorPageFilterName is the Envoy Gateway HTTPRouteFilter answering
+	// with the --error-page, one per namespace of the routes.
+	errorPageFilterName = "error-page"
+)
+
+var (
+	// errorPage and errorPageType are the body and content type of the
+	// --error-page.
+	errorPage, errorPageType string
+	// errorStatusCodes are the parsed --error-codes, as Envoy Gateway
+	// status code matches.
+	errorStatusCodes []map[string]any
+	// errorPageNamespaces collects the namespaces of the routes using the
+	// error page filter during a run.
+	errorPageNamespaces = make(map[string]bool)
+)
+
+func validateErrorPages(ctx context.Context) error {
+	errorPage, errorPageType, errorStatusCodes = "", "", nil
+	if errorService != "" && errorPageFile != "" {
+		return fmt.Errorf("--error-service and --error-page are mutually exclusive")
+	}
+	if (errorService != "" || errorPageFile != "") && defaultBackend != "" {
+		return fmt.Errorf("--default-backend cannot be combined with --error-service or --error-page, which route the unmatched requests themselves")
+	}
+	if errorService != "" {
+		if _, err := parseBackendSpec(errorService); err != nil {
+			return fmt.Errorf("invalid --error-service: %w", err)
+		}
+	}
+	if len(errorCodes) > 0 && errorPageFile == "" {
+		return fmt.Errorf("--error-codes requires --error-page")
+	}
+	if errorPageFile == "" {
+		return nil
+	}
+	data, err := readInput(ctx, errorPageFile)
+	if err != nil {
+		return fmt.Errorf("failed to read --error-page: %w", err)
+	}
+	errorPage = string(data)
+	errorPageType = mime.TypeByExtension(filepath.Ext(errorPageFile))
+	if errorPageType == "" {
+		errorPageType = "text/html"
+	}
+	for _, spec := range errorCodes {
+		match, err := parseStatusCodes(strings.TrimSpace(spec))
+		if err != nil {
+			return fmt.Errorf("invalid --error-codes: %w", err)
+		}
+		errorStatusCodes = append(errorStatusCodes, match)
+	}
+	return nil
+}
+
+// parseStatusCodes reads a code, such as 404, or range, such as 500-599,
+// of --error-codes.
+func parseStatusCodes(spec string) (map[string]any, error) {
+	code := func(s string) (int, error) {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 100 || n > 599 {
+			return 0, fmt.Errorf("%q is not a status code (100-599)", s)
+		}
+		return n, nil
+	}
+	if from, to, ok := strings.Cut(spec, "-"); ok {
+		start, err := code(from)
+		if err != nil {
+			return nil, err
+		}
+		end, err := code(to)
+		if err != nil {
+			return nil, err
+		}
+		if end <= start {
+			return nil, fmt.Errorf("range %s is empty", spec)
+		}
+		return map[string]any{"type": "Range", "range": map[string]any{"start": start, "end": end}}, nil
+	}
+	n, err := code(spec)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]any{"type": "Value", "value": n}, nil
+}
+
+// errorCatchAll sets up the catch-all rule of opts for the unmatched
+// requests: to the --error-service, told the status by errorCodeHeader, or
+// answered with the --error-page by the error page filter.
+func errorCatchAll(opts *convert.Options) error {
+	switch {
+	case errorService != "":
+		backend, err := parseBackendSpec(errorService)
+		if err != nil {
+			return err
+		}
+		opts.CatchAll = &backend
+		opts.CatchAllFilters = []HTTPRouteFilter{{
+			Type:                  "RequestHeaderModifier",
+			RequestHeaderModifier: &HTTPHeaderFilter{Set: []HTTPHeader{{Name: errorCodeHeader, Value: "404"}}},
+		}}
+	case errorPageFile != "":
+		opts.CatchAllFilters = []HTTPRouteFilter{{
+			Type:         "ExtensionRef",
+			ExtensionRef: &LocalObjectReference{Group: "gateway.envoyproxy.io", Kind: "HTTPRouteFilter", Name: errorPageFilterName},
+		}}
+	}
+	return nil
+}
+
+// collectErrorPages records the namespace of route when a rule of it uses
+// the error page filter.
+func collectErrorPages(route HTTPRoute) {
+	for _, rule := range route.Spec.Rules {
+		for _, f := range rule.Filters {
+			if f.ExtensionRef != nil && f.ExtensionRef.Name == errorPageFilterName {
+				errorPageNamespaces[route.Metadata.Namespace] = true
+			}
+		}
+	}
+}
+
+// writeErrorPages writes errorpages.yaml with the Envoy Gateway
+// HTTPRouteFilter answering with the --error-page in every namespace of the
+// routes using it. The page is answered with 404, as the request matched no
+// rule.
+func writeErrorPages() error {
+	var names []string
+	for ns := range errorPageNamespaces {
+		names = append(names, ns)
+	}
+	if len(names) == 0 {
+		return nil
+	}
+	sort.Strings(names)
+
+	docs := make([]any, 0, len(names))
+	for _, ns := range names {
+		docs = append(docs, map[string]any{
+			"apiVersion": "gateway.envoyproxy.io/v1alpha1",
+			"kind":       "HTTPRouteFilter",
+			"metadata":   Metadata{Name: errorPageFilterName, Namespace: ns},
+			"spec": map[string]any{
+				"directResponse": map[string]any{
+					"contentType": errorPageType,
+					"statusCode":  404,
+					"body":        map[string]any{"type": "Inline", "inline": errorPage},
+				},
+			},
+		})
+	}
+	outPath := outputPath("errorpages", ".yaml")
+	if err := writeYAMLDocs(outPath, docs); err != nil {
+		return err
+	}
+	if !quiet {
+		fmt.Printf("Generated %s\n", outPath)
+	}
+	return nil
+}
+
+// errorResponseOverride is the Envoy Gateway responseOverride replacing the
+// --error-codes responses of the backends of a route with the --error-page,
+// keeping their status, or nil without --error-codes.
+func errorResponseOverride() []map[string]any {
+	if len(errorStatusCodes) == 0 {
+		return nil
+	}
+	return []map[string]any{{
+		"match": map[string]any{"statusCodes": slices.Clone(errorStatusCodes)},
+		"response": map[string]any{
+			"contentType": errorPageType,
+			"body":        map[string]any{"type": "Inline", "inline": errorPage},
+		},
+	}}
+}
@@ -0,0 +1,604 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/arencloud/csv2httproute/pkg/convert"
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+var (
+	exportFromCluster   bool
+	exportNamespace     string
+	exportAllNamespaces bool
+	exportInventory     string
+)
+
+// exportColumns are the columns of exported CSVs, in order. Columns that
+// no row of a route uses are left out.
+var exportColumns = []string{"method", "url", "prefix", "match_type", "headers", "query_params", "accept", "content_type", "cookie", "description", "service", "port", "service_namespace", "backend_kind", "backend_group", "weight", "backends", "fallback", "redirect", "rewrite", "variant", "cache_ttl", "cacheability", "set_headers", "add_headers", "remove_headers", "set_response_headers", "add_response_headers", "remove_response_headers", "timeout", "backend_timeout", "retries"}
+
+func newExportCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "export [FILE|DIR]...",
+		Short: "Write existing HTTPRoutes back out as inventory CSVs",
+		Long: `Reads HTTPRoutes from YAML manifests (files, or directories searched
+recursively) or, with --from-cluster, from the cluster of the kubeconfig
+context, and writes one CSV per route to --inventory, so hand-written routes
+can be onboarded into the CSV workflow and generated routes round-trip.
+
+Every match becomes a row. A rewriting PathPrefix rule becomes the prefix
+column of the direct matches on its backend, as the hybrid strategy
+generates it; variant, caching and other header filters, redirects and
+full-path rewrites become their columns. Hostnames and the parent Gateway
+have no column and are recorded in a comment row, with the flags to
+regenerate the route. Anything else without a CSV equivalent, such as
+redirects rewriting a prefix or header matches by regular expression, is
+reported and left out.`,
+		RunE: runExport,
+	}
+	flags := cmd.Flags()
+	flags.BoolVar(&exportFromCluster, "from-cluster", false, "Read the HTTPRoutes from the cluster instead of manifests")
+	flags.StringVarP(&exportNamespace, "namespace", "n", "", "Namespace read with --from-cluster (defaults to the kubeconfig context's)")
+	flags.BoolVarP(&exportAllNamespaces, "all-namespaces", "A", false, "With --from-cluster, read the HTTPRoutes of every namespace")
+	flags.StringVar(&exportInventory, "inventory", "exported", "Directory the CSVs are written to, with a subdirectory per namespace when routes span several")
+	addSelectorFlags(flags, "HTTPRoutes")
+	return cmd
+}
+
+func runExport(cmd *cobra.Command, args []string) error {
+	var objs []*unstructured.Unstructured
+	var err error
+	switch {
+	case exportFromCluster && len(args) > 0:
+		return fmt.Errorf("--from-cluster reads no manifests; drop the file arguments")
+	case exportFromCluster:
+		objs, err = clusterHTTPRoutes(cmd.Context())
+	case len(args) == 0:
+		return fmt.Errorf("name the manifest files or directories to export, or use --from-cluster")
+	default:
+		objs, err = manifestHTTPRoutes(args)
+	}
+	if err != nil {
+		return err
+	}
+	if len(objs) == 0 {
+		return fmt.Errorf("no HTTPRoutes found")
+	}
+
+	routes := make([]HTTPRoute, 0, len(objs))
+	namespaces := make(map[string]bool)
+	var problems []string
+	for _, obj := range objs {
+		if found := strictProblems(obj.Object, HTTPRoute{}); len(found) > 0 {
+			for _, p := range found {
+				problems = append(problems, fmt.Sprintf("HTTPRoute %s/%s: %s", obj.GetNamespace(), obj.GetName(), p))
+			}
+			continue
+		}
+		data, err := yaml.Marshal(obj.Object)
+		if err != nil {
+			return err
+		}
+		var route HTTPRoute
+		if err := yaml.Unmarshal(data, &route); err != nil {
+			return fmt.Errorf("HTTPRoute %s/%s: %w", obj.GetNamespace(), obj.GetName(), err)
+		}
+		if route.Metadata.Namespace == "" {
+			route.Metadata.Namespace = "default"
+		}
+		markStandby(obj, &route)
+		namespaces[route.Metadata.Namespace] = true
+		routes = append(routes, route)
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("the HTTPRoutes hold data the inventory cannot represent (%d problem(s)):\n  %s", len(problems), strings.Join(problems, "\n  "))
+	}
+	sort.Slice(routes, func(i, j int) bool {
+		return routeKey(routes[i]) < routeKey(routes[j])
+	})
+
+	for _, route := range routes {
+		dir := exportInventory
+		if len(namespaces) > 1 {
+			dir = filepath.Join(dir, route.Metadata.Namespace)
+		}
+		rows, warnings := exportRows(route)
+		for _, w := range warnings {
+			fmt.Fprintf(os.Stderr, "WARNING: HTTPRoute %s: %s\n", routeKey(route), w)
+		}
+		if len(rows) == 0 {
+			fmt.Fprintf(os.Stderr, "WARNING: HTTPRoute %s has no rows to export, skipped\n", routeKey(route))
+			continue
+		}
+		if err := os.MkdirAll(dir, 0777); err != nil {
+			return fmt.Errorf("failed to create inventory directory: %w", err)
+		}
+		path := filepath.Join(dir, route.Metadata.Name+".csv")
+		if err := writeExportCSV(path, route, rows); err != nil {
+			return err
+		}
+		if !quiet {
+			fmt.Printf("Exported %s (%d row(s))\n", path, len(rows))
+		}
+	}
+	return nil
+}
+
+func routeKey(route HTTPRoute) string {
+	return route.Metadata.Namespace + "/" + route.Metadata.Name
+}
+
+// manifestHTTPRoutes reads the HTTPRoutes of the YAML files among paths and
+// below the directories among them.
+func manifestHTTPRoutes(paths []string) ([]*unstructured.Unstructured, error) {
+	var objs []*unstructured.Unstructured
+	for _, root := range paths {
+		err := filepath.WalkDir(root, func(path string, d os.DirEntry, err error) error {
+			if err != nil || d.IsDir() {
+				return err
+			}
+			if ext := filepath.Ext(path); path != root && ext != ".yaml" && ext != ".yml" {
+				return nil
+			}
+			routes, err := routeObjects(path)
+			if err != nil {
+				return err
+			}
+			objs = append(objs, routes...)
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return objs, nil
+}
+
+// clusterHTTPRoutes lists the HTTPRoutes of --namespace, or of every
+// namespace with -A.
+func clusterHTTPRoutes(ctx context.Context) ([]*unstructured.Unstructured, error) {
+	opts, err := selectorOptions()
+	if err != nil {
+		return nil, err
+	}
+	client, contextNamespace, err := kubeDynamicClient()
+	if err != nil {
+		return nil, err
+	}
+	ns := exportNamespace
+	if ns == "" {
+		ns = contextNamespace
+	}
+	if exportAllNamespaces {
+		ns = ""
+	}
+	items, err := listObjects(ctx, client, httpRoutesGVR, ns, opts, "HTTPRoutes")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list HTTPRoutes: %w", err)
+	}
+	objs := make([]*unstructured.Unstructured, len(items))
+	for i := range items {
+		objs[i] = &items[i]
+	}
+	return objs, nil
+}
+
+// markStandby flags the backendRefs of route that obj lists with an
+// explicit weight of 0, which decoding cannot tell from an omitted weight.
+func markStandby(obj *unstructured.Unstructured, route *HTTPRoute) {
+	rules, _, _ := unstructured.NestedSlice(obj.Object, "spec", "rules")
+	for i, r := range rules {
+		rule, ok := r.(map[string]any)
+		if !ok || i >= len(route.Spec.Rules) {
+			continue
+		}
+		refs, _ := rule["backendRefs"].([]any)
+		for j, ref := range refs {
+			m, ok := ref.(map[string]any)
+			if !ok || j >= len(route.Spec.Rules[i].BackendRefs) {
+				continue
+			}
+			if w, ok := m["weight"]; ok && fmt.Sprint(w) == "0" {
+				route.Spec.Rules[i].BackendRefs[j].Standby = true
+			}
+		}
+	}
+}
+
+// exportRows turns the rules of route into CSV rows keyed by column, and
+// lists what could not be expressed.
+func exportRows(route HTTPRoute) ([]map[string]string, []string) {
+	var warnings []string
+	warnf := func(format string, args ...any) {
+		warnings = append(warnings, fmt.Sprintf(format, args...))
+	}
+
+	// Rewriting prefix rules are folded into the direct matches on their
+	// backend, which is only unambiguous with one prefix per backend.
+	prefixes := make(map[BackendRef][]string)
+	direct := make(map[BackendRef]bool)
+	isPrefix := make([]bool, len(route.Spec.Rules))
+	for i, rule := range route.Spec.Rules {
+		if prefix, ok := prefixRule(rule); ok {
+			isPrefix[i] = true
+			prefixes[plainBackend(rule.BackendRefs[0])] = append(prefixes[plainBackend(rule.BackendRefs[0])], prefix)
+		} else if len(rule.BackendRefs) > 0 {
+			direct[plainBackend(rule.BackendRefs[0])] = true
+		}
+	}
+
+	descriptions := exportedDescriptions(route)
+	description := func(rule, match int) string {
+		if rule < len(descriptions) && match < len(descriptions[rule]) {
+			return descriptions[rule][match]
+		}
+		return ""
+	}
+
+	var rows []map[string]string
+	for i, rule := range route.Spec.Rules {
+		n := i + 1
+		var backend BackendRef
+		var base map[string]string
+		switch {
+		case len(rule.BackendRefs) > 0:
+			backend = plainBackend(rule.BackendRefs[0])
+			base = backendColumns(route, rule.BackendRefs[0])
+		case hasFilter(rule, "RequestRedirect"):
+			base = make(map[string]string)
+		default:
+			warnf("rule %d has neither backendRefs nor a redirect, skipped", n)
+			continue
+		}
+		if isPrefix[i] {
+			if ps := prefixes[backend]; len(ps) == 1 && direct[backend] {
+				continue
+			}
+			prefix, _ := prefixRule(rule)
+			base["url"], base["prefix"] = prefix, prefix
+			base["description"] = description(i, 0)
+			warnf("rule %d rewrites prefix %s without direct matches of its own; generate its row with --strategy prefix to leave out the direct match", n, prefix)
+			for _, f := range rule.Filters {
+				if f.Type != "URLRewrite" && !filterColumns(f, base) {
+					warnf("rule %d: %s filter has no CSV column, left out", n, f.Type)
+				}
+			}
+			if !policyColumns(rule, base) {
+				warnf("rule %d: retry policy has no CSV equivalent, left out", n)
+			}
+			rows = append(rows, base)
+			continue
+		}
+		if ps := prefixes[backend]; len(ps) == 1 {
+			base["prefix"] = ps[0]
+		}
+		// A second backend on standby is a fallback; any other is a split,
+		// exported as the backends column when its backends differ only by
+		// name and port.
+		switch refs := rule.BackendRefs; {
+		case len(refs) <= 1:
+		case len(refs) == 2 && refs[1].Standby:
+			delete(base, "weight")
+			base["fallback"] = refs[1].Name + ":" + strconv.Itoa(refs[1].Port)
+		case sameBackendKind(refs):
+			splits := make([]convert.SplitBackend, len(refs))
+			for i, b := range refs {
+				splits[i] = convert.SplitBackend{Service: b.Name, Port: b.Port, Weight: b.Weight}
+			}
+			delete(base, "service")
+			delete(base, "port")
+			delete(base, "weight")
+			base["backends"] = convert.FormatBackends(splits)
+		default:
+			delete(base, "weight")
+			warnf("rule %d splits traffic between %d backends; only %s is exported", n, len(refs), backend.Name)
+		}
+		for _, f := range rule.Filters {
+			if !filterColumns(f, base) {
+				warnf("rule %d: %s filter has no CSV column, left out", n, f.Type)
+			}
+		}
+		if !policyColumns(rule, base) {
+			warnf("rule %d: retry policy has no CSV equivalent, left out", n)
+		}
+
+		matches := rule.Matches
+		if len(matches) == 0 {
+			matches = []HTTPRouteMatch{{}}
+		}
+		for j, m := range matches {
+			row := make(map[string]string, len(base)+4)
+			for k, v := range base {
+				row[k] = v
+			}
+			row["method"] = m.Method
+			row["description"] = description(i, j)
+			row["url"] = "/"
+			if m.Path != nil {
+				if m.Path.Value != "" {
+					row["url"] = m.Path.Value
+				}
+				if m.Path.Type != "" && m.Path.Type != "PathPrefix" {
+					row["match_type"] = m.Path.Type
+				}
+			}
+			var headers, query []string
+			for _, h := range m.Headers {
+				if column, list, ok := convert.MediaTypesOf(h); ok {
+					row[column] = list
+					continue
+				}
+				if cookie, ok := convert.CookieOf(h); ok {
+					row["cookie"] = cookie
+					continue
+				}
+				if h.Type == "RegularExpression" {
+					warnf("rule %d: header match %s by regular expression left out", n, h.Name)
+					continue
+				}
+				headers = append(headers, h.Name+"="+h.Value)
+			}
+			for _, q := range m.QueryParams {
+				if q.Type == "RegularExpression" {
+					warnf("rule %d: query parameter match %s by regular expression left out", n, q.Name)
+					continue
+				}
+				query = append(query, q.Name+"="+q.Value)
+			}
+			row["headers"] = strings.Join(headers, ";")
+			row["query_params"] = strings.Join(query, ";")
+			rows = append(rows, row)
+		}
+	}
+	return rows, warnings
+}
+
+// hasFilter reports whether rule has a filter of type filterType.
+func hasFilter(rule HTTPRouteRule, filterType string) bool {
+	for _, f := range rule.Filters {
+		if f.Type == filterType {
+			return true
+		}
+	}
+	return false
+}
+
+// prefixRule reports whether rule is a prefix rule as Build emits it: one
+// PathPrefix match whose prefix is rewritten to "/".
+func prefixRule(rule HTTPRouteRule) (string, bool) {
+	if len(rule.Matches) != 1 || len(rule.BackendRefs) != 1 {
+		return "", false
+	}
+	m := rule.Matches[0]
+	if m.Path == nil || m.Path.Type != "PathPrefix" || m.Method != "" || len(m.Headers) > 0 || len(m.QueryParams) > 0 {
+		return "", false
+	}
+	for _, f := range rule.Filters {
+		if f.Type == "URLRewrite" && f.URLRewrite != nil && f.URLRewrite.Path != nil &&
+			f.URLRewrite.Path.Type == "ReplacePrefixMatch" && f.URLRewrite.Path.ReplacePrefixMatch == "/" {
+			return m.Path.Value, true
+		}
+	}
+	return "", false
+}
+
+// plainBackend identifies a backend regardless of its weight.
+func plainBackend(b BackendRef) BackendRef {
+	b.Weight, b.Standby = 0, false
+	if b.Kind == "" {
+		b.Kind = "Service"
+	}
+	return b
+}
+
+// sameBackendKind reports whether refs are all in one namespace and of one
+// kind, as the backends of one row are.
+func sameBackendKind(refs []BackendRef) bool {
+	for _, b := range refs[1:] {
+		if plainBackend(b).Kind != plainBackend(refs[0]).Kind || b.Group != refs[0].Group || b.Namespace != refs[0].Namespace {
+			return false
+		}
+	}
+	return true
+}
+
+// backendColumns returns the backend columns of the rows of a rule.
+func backendColumns(route HTTPRoute, b BackendRef) map[string]string {
+	row := map[string]string{"service": b.Name}
+	if b.Port != 0 {
+		row["port"] = strconv.Itoa(b.Port)
+	}
+	if b.Namespace != "" && b.Namespace != route.Metadata.Namespace {
+		row["service_namespace"] = b.Namespace
+	}
+	if b.Kind != "" && b.Kind != "Service" {
+		row["backend_kind"] = b.Kind
+		if group, err := convert.ResolveBackendGroup(b.Kind, ""); err != nil || group != b.Group {
+			row["backend_group"] = b.Group
+		}
+	}
+	if b.Weight > 1 {
+		row["weight"] = strconv.Itoa(b.Weight)
+	}
+	return row
+}
+
+// filterColumns sets the columns that reproduce filter f, or reports that
+// no column does. The rewrite of prefix rules is handled by the prefix
+// column, full-path rewrites by the rewrite column.
+func filterColumns(f HTTPRouteFilter, row map[string]string) bool {
+	switch {
+	case f.Type == "RequestHeaderModifier" && f.RequestHeaderModifier != nil:
+		h := *f.RequestHeaderModifier
+		variant := ""
+		h.Set = slices.DeleteFunc(slices.Clone(h.Set), func(set HTTPHeader) bool {
+			if strings.EqualFold(set.Name, convert.VariantHeader) {
+				variant = set.Value
+				return true
+			}
+			return false
+		})
+		if !headerEditColumns(h, "headers", row) {
+			return false
+		}
+		if variant != "" {
+			row["variant"] = variant
+		}
+		return true
+	case f.Type == "RequestRedirect" && f.RequestRedirect != nil:
+		if redirect, ok := convert.FormatRedirect(*f.RequestRedirect); ok {
+			row["redirect"] = redirect
+			return true
+		}
+	case f.Type == "URLRewrite" && f.URLRewrite != nil:
+		if p := f.URLRewrite.Path; p != nil && p.Type == "ReplaceFullPath" {
+			row["rewrite"] = p.ReplaceFullPath
+			return true
+		}
+	case f.Type == "ResponseHeaderModifier" && f.ResponseHeaderModifier != nil:
+		h := *f.ResponseHeaderModifier
+		var cacheability, ttl string
+		h.Set = slices.DeleteFunc(slices.Clone(h.Set), func(set HTTPHeader) bool {
+			if !strings.EqualFold(set.Name, "Cache-Control") {
+				return false
+			}
+			c, maxAge, _ := strings.Cut(set.Value, ",")
+			c = strings.TrimSpace(c)
+			t, hasTTL := strings.CutPrefix(strings.TrimSpace(maxAge), "max-age=")
+			if _, err := convert.CacheControl(t, c); err != nil || (maxAge != "" && !hasTTL) {
+				return false
+			}
+			cacheability, ttl = c, t
+			return true
+		})
+		if !headerEditColumns(h, "response_headers", row) {
+			return false
+		}
+		if cacheability != "" {
+			row["cacheability"], row["cache_ttl"] = cacheability, ttl
+		}
+		return true
+	}
+	return false
+}
+
+// policyColumns sets the timeout, backend_timeout and retries columns of
+// rule, or reports that its retry policy has no retries cell.
+func policyColumns(rule HTTPRouteRule, row map[string]string) bool {
+	if t := rule.Timeouts; t != nil {
+		row["timeout"], row["backend_timeout"] = t.Request, t.BackendRequest
+	}
+	if rule.Retry == nil {
+		return true
+	}
+	retries := convert.FormatRetries(*rule.Retry)
+	if _, err := convert.ParseRetries(retries); err != nil || rule.Retry.Attempts == 0 {
+		return false
+	}
+	row["retries"] = retries
+	return true
+}
+
+// headerEditColumns sets the set_<kind>, add_<kind> and remove_<kind>
+// columns reproducing h, or reports that they cannot.
+func headerEditColumns(h HTTPHeaderFilter, kind string, row map[string]string) bool {
+	edits, ok := convert.FormatHeaderEdits(h)
+	if !ok {
+		return false
+	}
+	for column, value := range map[string]string{"set_" + kind: edits.Set, "add_" + kind: edits.Add, "remove_" + kind: edits.Remove} {
+		if value != "" {
+			row[column] = value
+		}
+	}
+	return true
+}
+
+// writeExportCSV writes the rows of route, headed by a comment row with the
+// route's hostnames and Gateway and the flags that regenerate it.
+func writeExportCSV(path string, route HTTPRoute, rows []map[string]string) error {
+	var header []string
+	for _, col := range exportColumns {
+		used := col == "method" || col == "url" || col == "service" || col == "port"
+		for _, row := range rows {
+			if row[col] != "" {
+				used = true
+				break
+			}
+		}
+		if used {
+			header = append(header, col)
+		}
+	}
+
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	if err := w.Write(header); err != nil {
+		return err
+	}
+	if err := w.Write([]string{"# " + exportProvenance(path, route)}); err != nil {
+		return err
+	}
+	for _, row := range rows {
+		record := make([]string, len(header))
+		for i, col := range header {
+			record[i] = row[col]
+		}
+		if err := w.Write(record); err != nil {
+			return err
+		}
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return err
+	}
+	return os.WriteFile(path, buf.Bytes(), 0666)
+}
+
+// exportProvenance describes where the rows of route came from and how to
+// generate the route again.
+func exportProvenance(path string, route HTTPRoute) string {
+	flags := []string{"-i", filepath.Dir(path), "-n", route.Metadata.Namespace}
+	if len(route.Spec.ParentRefs) > 0 {
+		parent := route.Spec.ParentRefs[0]
+		for _, p := range route.Spec.ParentRefs {
+			ref := p.Name
+			if p.Namespace != parent.Namespace {
+				ref += ":" + p.Namespace
+			} else if p.SectionName != "" {
+				ref += ":"
+			}
+			if p.SectionName != "" {
+				ref += ":" + p.SectionName
+			}
+			flags = append(flags, "-g", ref)
+		}
+		if parent.Namespace != "" && parent.Namespace != route.Metadata.Namespace {
+			flags = append(flags, "--gateway-namespace", parent.Namespace)
+		}
+		if parent.Port != 0 {
+			flags = append(flags, "--gateway-port", strconv.Itoa(parent.Port))
+		}
+	}
+	s := "Exported from HTTPRoute " + routeKey(route)
+	switch len(route.Spec.Hostnames) {
+	case 0:
+	case 1:
+		flags = append(flags, "--hostname", route.Spec.Hostnames[0])
+	default:
+		s += " serving " + strings.Join(route.Spec.Hostnames, " and ") + " (map them with --domain-map)"
+	}
+	return s + "; generate with: csv2httproute " + strings.Join(flags, " ")
+}
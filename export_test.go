@@ -0,0 +1,51 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const exportRoute = `apiVersion: gateway.networking.k8s.io/v1
+kind: HTTPRoute
+metadata:
+  name: orders
+  namespace: shop
+spec:
+  rules:
+    - backendRefs:
+        - name: orders
+          port: 8080
+`
+
+func TestManifestHTTPRoutes(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "orders.yaml"), []byte(exportRoute), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	objs, err := manifestHTTPRoutes([]string{dir})
+	if err != nil {
+		t.Fatalf("manifestHTTPRoutes: %v", err)
+	}
+	if len(objs) != 1 || objs[0].GetName() != "orders" {
+		t.Fatalf("got %d route(s), want orders", len(objs))
+	}
+}
+
+func TestManifestHTTPRoutesCorrupt(t *testing.T) {
+	dir := t.TempDir()
+	// A valid route followed by a truncated one: neither may be exported.
+	broken := filepath.Join(dir, "broken.yaml")
+	data := exportRoute + "---\n" + "apiVersion: gateway.networking.k8s.io/v1\nkind: HTTPRoute\nspec:\n  rules: [\n"
+	if err := os.WriteFile(broken, []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	objs, err := manifestHTTPRoutes([]string{dir})
+	if err == nil {
+		t.Fatalf("manifestHTTPRoutes returned %d route(s) and no error for a corrupt manifest", len(objs))
+	}
+	if !strings.Contains(err.Error(), broken) || !strings.Contains(err.Error(), "yaml:") {
+		t.Errorf("error %q does not name %s and the YAML error", err, broken)
+	}
+}
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"sort"
+)
+
+// Modes of --failover: how the fallback column of a row reaches its rules.
+// Gateway API has no health-based failover of its own, so the portable
+// modes leave the shift to the operator, and provider modes emit the
+// provider's failover resources.
+const (
+	// failoverWeighted lists the fallback next to the primary backend with
+	// --failover-weight percent of the traffic; the default of 0 keeps a
+	// hot standby that is shifted to by raising its weight.
+	failoverWeighted = "weighted"
+	// failoverMirror keeps the fallback warm with a copy of the traffic.
+	failoverMirror = "mirror"
+	// failoverEnvoyGateway references the fallback as an Envoy Gateway
+	// Backend marked fallback, used once passive health checks eject the
+	// primary.
+	failoverEnvoyGateway = "envoy-gateway"
+)
+
+var (
+	failoverMode   string
+	failoverWeight int
+)
+
+func validateFailover() error {
+	switch failoverMode {
+	case failoverWeighted, failoverMirror, failoverEnvoyGateway:
+	default:
+		return fmt.Errorf("invalid --failover %q (must be %s, %s or %s)", failoverMode, failoverWeighted, failoverMirror, failoverEnvoyGateway)
+	}
+	if failoverWeight < 0 || failoverWeight > 100 {
+		return fmt.Errorf("invalid --failover-weight %d (must be 0-100)", failoverWeight)
+	}
+	return nil
+}
+
+// fallbackFor returns the fallback backend of e, if it has one. The column
+// is validated when the row is parsed.
+func fallbackFor(e Endpoint) BackendRef {
+	if e.Fallback == "" {
+		return BackendRef{}
+	}
+	b, _ := parseBackendSpec(e.Fallback)
+	return b
+}
+
+// prefixFallback returns the fallback shared by all rows under prefix.
+func prefixFallback(prefix string, endpoints []Endpoint) (BackendRef, error) {
+	fallback := fallbackFor(endpoints[0])
+	for _, e := range endpoints[1:] {
+		if f := fallbackFor(e); f != fallback {
+			return BackendRef{}, fmt.Errorf("prefix %s has conflicting fallbacks %q (line %d) and %q (line %d)",
+				prefix, endpoints[0].Fallback, endpoints[0].Line, e.Fallback, e.Line)
+		}
+	}
+	return fallback, nil
+}
+
+// applyFallback adds fallback to a rule routing to a single primary backend.
+func applyFallback(rule *HTTPRouteRule, fallback BackendRef) {
+	if fallback.Name == "" || len(rule.BackendRefs) == 0 {
+		return
+	}
+	switch failoverMode {
+	case failoverMirror:
+		mirror := fallback
+		mirror.Weight = 0
+		rule.Filters = append(rule.Filters, HTTPRouteFilter{
+			Type:          "RequestMirror",
+			RequestMirror: &HTTPRequestMirrorFilter{BackendRef: mirror},
+		})
+	case failoverEnvoyGateway:
+		rule.BackendRefs = append(rule.BackendRefs, BackendRef{
+			Group:     "gateway.envoyproxy.io",
+			Kind:      "Backend",
+			Name:      fallbackBackendName(fallback),
+			Namespace: fallback.Namespace,
+			Weight:    1,
+		})
+	default:
+		rule.BackendRefs[0].Weight = 100 - failoverWeight
+		fallback.Weight = failoverWeight
+		fallback.Standby = failoverWeight == 0
+		rule.BackendRefs = append(rule.BackendRefs, fallback)
+	}
+}
+
+// fallbackBackendName names the Envoy Gateway Backend of a fallback.
+func fallbackBackendName(fallback BackendRef) string {
+	return fmt.Sprintf("%s-%d-fallback", fallback.Name, fallback.Port)
+}
+
+// writesFailoverPolicy reports whether writeFailover writes a
+// BackendTrafficPolicy for the route of endpoints.
+func writesFailoverPolicy(endpoints []Endpoint) bool {
+	return failoverMode == failoverEnvoyGateway && slices.ContainsFunc(endpoints, func(e Endpoint) bool { return fallbackFor(e).Name != "" })
+}
+
+// writeFailover writes <route>.failover.yaml with the Envoy Gateway Backends
+// of the fallbacks of route and a BackendTrafficPolicy whose passive health
+// checks eject failing primaries. Other modes need no extra resources.
+func writeFailover(route HTTPRoute, endpoints []Endpoint) error {
+	if failoverMode != failoverEnvoyGateway {
+		return nil
+	}
+	fallbacks := make(map[string]BackendRef)
+	for _, e := range endpoints {
+		if f := fallbackFor(e); f.Name != "" {
+			fallbacks[fallbackBackendName(f)] = f
+		}
+	}
+	if len(fallbacks) == 0 {
+		return nil
+	}
+	names := make([]string, 0, len(fallbacks))
+	for name := range fallbacks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var docs []any
+	for _, name := range names {
+		f := fallbacks[name]
+		ns := f.Namespace
+		if ns == "" {
+			ns = route.Metadata.Namespace
+		}
+		docs = append(docs, map[string]any{
+			"apiVersion": "gateway.envoyproxy.io/v1alpha1",
+			"kind":       "Backend",
+			"metadata":   Metadata{Name: name, Namespace: ns},
+			"spec": map[string]any{
+				"fallback": true,
+				"endpoints": []map[string]any{{
+					"fqdn": map[string]any{"hostname": fmt.Sprintf("%s.%s.svc.cluster.local", f.Name, ns), "port": f.Port},
+				}},
+			},
+		})
+	}
+	spec := map[string]any{
+		"targetRefs": []map[string]any{{"group": "gateway.networking.k8s.io", "kind": "HTTPRoute", "name": route.Metadata.Name}},
+		"healthCheck": map[string]any{
+			"passive": map[string]any{
+				"consecutive5XxErrors": 5,
+				"interval":             "2s",
+				"baseEjectionTime":     "30s",
+			},
+		},
+	}
+	maps.Copy(spec, trafficPolicyFields(endpoints))
+	docs = append(docs, map[string]any{
+		"apiVersion": "gateway.envoyproxy.io/v1alpha1",
+		"kind":       "BackendTrafficPolicy",
+		"metadata":   Metadata{Name: route.Metadata.Name + "-failover", Namespace: route.Metadata.Namespace},
+		"spec":       spec,
+	})
+	return writeYAMLDocs(outputPath(route.Metadata.Name, ".failover.yaml"), docs)
+}
+
+// trafficPolicyFields are the fields other features add to the Envoy
+// Gateway BackendTrafficPolicy of the route of endpoints: the rate limit of
+// its tier and the error page overrides of --error-codes.
+func trafficPolicyFields(endpoints []Endpoint) map[string]any {
+	fields := make(map[string]any)
+	if limit := tierRateLimit(endpoints); limit != nil {
+		fields["rateLimit"] = limit
+	}
+	if override := errorResponseOverride(); override != nil {
+		fields["responseOverride"] = override
+	}
+	return fields
+}
+
+// writeTrafficPolicy writes <route>.trafficpolicy.yaml with an Envoy
+// Gateway BackendTrafficPolicy of the trafficPolicyFields of the route.
+// Envoy Gateway applies a single BackendTrafficPolicy per route, so with
+// --failover envoy-gateway they are part of the failover policy instead.
+func writeTrafficPolicy(route HTTPRoute, endpoints []Endpoint) error {
+	fields := trafficPolicyFields(endpoints)
+	if len(fields) == 0 || writesFailoverPolicy(endpoints) {
+		return nil
+	}
+	fields["targetRefs"] = []map[string]any{{"group": "gateway.networking.k8s.io", "kind": "HTTPRoute", "name": route.Metadata.Name}}
+	doc := map[string]any{
+		"apiVersion": "gateway.envoyproxy.io/v1alpha1",
+		"kind":       "BackendTrafficPolicy",
+		"metadata":   Metadata{Name: route.Metadata.Name + "-traffic", Namespace: route.Metadata.Namespace},
+		"spec":       fields,
+	}
+	return writeYAMLDocs(outputPath(route.Metadata.Name, ".trafficpolicy.yaml"), []any{doc})
+}
@@ -0,0 +1,206 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+	"text/tabwriter"
+)
+
+// Gateway API features generated routes can rely on, named after the
+// conformance suite's extended features. Core features, which every
+// conformant implementation supports, are not tracked.
+const (
+	featureMethodMatching   = "HTTPRouteMethodMatching"
+	featureQueryParamMatch  = "HTTPRouteQueryParamMatching"
+	featurePathRewrite      = "HTTPRoutePathRewrite"
+	featurePathRedirect     = "HTTPRoutePathRedirect"
+	featureResponseHeaders  = "HTTPRouteResponseHeaderModification"
+	featureRequestMirror    = "HTTPRouteRequestMirror"
+	featureBackendH2C       = "HTTPRouteBackendProtocolH2C"
+	featureBackendWebSocket = "HTTPRouteBackendProtocolWebSocket"
+	featureBackendTLSPolicy = "BackendTLSPolicy"
+	featureRequestTimeout   = "HTTPRouteRequestTimeout"
+	featureBackendTimeout   = "HTTPRouteBackendTimeout"
+	featureRetry            = "HTTPRouteRetry"
+	featureParentRefPort    = "HTTPRouteParentRefPort"
+	// Regular expression path matches are implementation-specific rather
+	// than a conformance feature, but support varies just as much.
+	featurePathRegex = "HTTPRoutePathRegex"
+)
+
+// conformanceMatrix lists the tracked features each --provider supports,
+// from the conformance reports of their current releases. Features missing
+// from a provider's list are reported as unsupported.
+var conformanceMatrix = map[string][]string{
+	"envoy-gateway": {
+		featureMethodMatching, featureQueryParamMatch, featurePathRewrite, featurePathRedirect,
+		featureResponseHeaders, featureRequestMirror, featureBackendH2C, featureBackendWebSocket,
+		featureBackendTLSPolicy, featurePathRegex, featureRequestTimeout, featureBackendTimeout,
+		featureRetry, featureParentRefPort,
+	},
+	"istio": {
+		featureMethodMatching, featureQueryParamMatch, featurePathRewrite, featurePathRedirect,
+		featureResponseHeaders, featureRequestMirror, featureBackendH2C, featureBackendWebSocket,
+		featureBackendTLSPolicy, featurePathRegex, featureRequestTimeout, featureBackendTimeout,
+		featureRetry, featureParentRefPort,
+	},
+	"cilium": {
+		featureMethodMatching, featureQueryParamMatch, featurePathRewrite, featurePathRedirect,
+		featureResponseHeaders, featureRequestMirror, featureBackendH2C, featureBackendWebSocket,
+		featurePathRegex, featureRequestTimeout, featureBackendTimeout,
+	},
+	"nginx-gateway-fabric": {
+		featureMethodMatching, featureQueryParamMatch, featurePathRewrite, featurePathRedirect,
+		featureResponseHeaders, featureRequestMirror, featureBackendTLSPolicy,
+	},
+	"kong": {
+		featureMethodMatching, featureQueryParamMatch, featurePathRewrite, featurePathRedirect,
+		featureResponseHeaders, featurePathRegex,
+	},
+	"traefik": {
+		featureMethodMatching, featureQueryParamMatch, featurePathRewrite, featurePathRedirect,
+		featureResponseHeaders, featureRequestMirror, featureBackendH2C, featureBackendTLSPolicy,
+		featurePathRegex,
+	},
+}
+
+var (
+	provider      string
+	featureReport bool
+)
+
+// routeFeatures is the feature report line of one route.
+type routeFeatures struct {
+	Route       string
+	Features    []string
+	Unsupported []string
+}
+
+// featureReports collects the routes of a run for the --feature-report table.
+var featureReports []routeFeatures
+
+func validateProvider(p string) error {
+	if p == "" {
+		return nil
+	}
+	if _, ok := conformanceMatrix[p]; ok {
+		return nil
+	}
+	names := make([]string, 0, len(conformanceMatrix))
+	for name := range conformanceMatrix {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return fmt.Errorf("unknown --provider %q (must be one of %s)", p, strings.Join(names, ", "))
+}
+
+// usedFeatures lists the tracked features route relies on, sorted.
+func usedFeatures(route HTTPRoute, endpoints []Endpoint) []string {
+	used := make(map[string]bool)
+	for _, p := range route.Spec.ParentRefs {
+		if p.Port != 0 {
+			used[featureParentRefPort] = true
+		}
+	}
+	for _, rule := range route.Spec.Rules {
+		if t := rule.Timeouts; t != nil {
+			used[featureRequestTimeout] = used[featureRequestTimeout] || t.Request != ""
+			used[featureBackendTimeout] = used[featureBackendTimeout] || t.BackendRequest != ""
+		}
+		if rule.Retry != nil {
+			used[featureRetry] = true
+		}
+		for _, m := range rule.Matches {
+			if m.Method != "" {
+				used[featureMethodMatching] = true
+			}
+			if len(m.QueryParams) > 0 {
+				used[featureQueryParamMatch] = true
+			}
+			if m.Path != nil && m.Path.Type == "RegularExpression" {
+				used[featurePathRegex] = true
+			}
+		}
+		for _, f := range rule.Filters {
+			switch {
+			case f.URLRewrite != nil && f.URLRewrite.Path != nil:
+				used[featurePathRewrite] = true
+			case f.RequestRedirect != nil && f.RequestRedirect.Path != nil:
+				used[featurePathRedirect] = true
+			case f.ResponseHeaderModifier != nil:
+				used[featureResponseHeaders] = true
+			case f.RequestMirror != nil:
+				used[featureRequestMirror] = true
+			}
+		}
+	}
+	for _, e := range endpoints {
+		switch e.BackendProtocol {
+		case protocolH2C:
+			used[featureBackendH2C] = true
+		case protocolWS:
+			used[featureBackendWebSocket] = true
+		case protocolHTTPS:
+			used[featureBackendTLSPolicy] = true
+		}
+	}
+	features := make([]string, 0, len(used))
+	for f := range used {
+		features = append(features, f)
+	}
+	sort.Strings(features)
+	return features
+}
+
+// checkFeatures records the features of route for --feature-report and
+// warns about those --provider does not support.
+func checkFeatures(route HTTPRoute, endpoints []Endpoint) {
+	if provider == "" && !featureReport {
+		return
+	}
+	r := routeFeatures{Route: route.Metadata.Name, Features: usedFeatures(route, endpoints)}
+	if provider != "" {
+		for _, f := range r.Features {
+			if !slices.Contains(conformanceMatrix[provider], f) {
+				r.Unsupported = append(r.Unsupported, f)
+			}
+		}
+		if len(r.Unsupported) > 0 {
+			fmt.Fprintf(os.Stderr, "WARNING: route %s uses features %s does not support: %s\n", r.Route, provider, strings.Join(r.Unsupported, ", "))
+		}
+	}
+	if featureReport {
+		featureReports = append(featureReports, r)
+	}
+}
+
+// printFeatureReport prints the features of every route of the run.
+func printFeatureReport() error {
+	if !featureReport {
+		return nil
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	header := "ROUTE\tFEATURES"
+	if provider != "" {
+		header += "\tUNSUPPORTED BY " + strings.ToUpper(provider)
+	}
+	fmt.Fprintln(w, header)
+	for _, r := range featureReports {
+		line := r.Route + "\t" + featureList(r.Features)
+		if provider != "" {
+			line += "\t" + featureList(r.Unsupported)
+		}
+		fmt.Fprintln(w, line)
+	}
+	return w.Flush()
+}
+
+func featureList(features []string) string {
+	if len(features) == 0 {
+		return "-"
+	}
+	return strings.Join(features, ",")
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// filterTypes are the HTTPRoute filter types in their default order: the
+// path is rewritten before headers are modified, so header filters observe
+// the request as the backend will, and mirrors see the final request.
+var filterTypes = []string{
+	"URLRewrite",
+	"RequestHeaderModifier",
+	"ResponseHeaderModifier",
+	"RequestRedirect",
+	"CORS",
+	"RequestMirror",
+	"ExtensionRef",
+}
+
+// filterOrder is --filter-order. Types it omits keep their default relative
+// order after the listed ones.
+var filterOrder []string
+
+// filterRanks maps filter types to their position under --filter-order.
+var filterRanks map[string]int
+
+func loadFilterOrder(order []string) error {
+	filterRanks = make(map[string]int)
+	for _, name := range order {
+		t, ok := canonicalFilterType(strings.TrimSpace(name))
+		if !ok {
+			return fmt.Errorf("invalid --filter-order entry %q (known types: %s)", name, strings.Join(filterTypes, ", "))
+		}
+		if _, dup := filterRanks[t]; dup {
+			return fmt.Errorf("filter type %s listed twice in --filter-order", t)
+		}
+		filterRanks[t] = len(filterRanks)
+	}
+	for _, t := range filterTypes {
+		if _, ok := filterRanks[t]; !ok {
+			filterRanks[t] = len(filterRanks)
+		}
+	}
+	return nil
+}
+
+// canonicalFilterType accepts filter types case-insensitively.
+func canonicalFilterType(name string) (string, bool) {
+	for _, t := range filterTypes {
+		if strings.EqualFold(t, name) {
+			return t, true
+		}
+	}
+	return "", false
+}
+
+// orderFilters sorts the filters of every rule of route by --filter-order.
+// Implementations apply filters in list order, so the order is made
+// deterministic rather than depending on how the rule was assembled.
+func orderFilters(route *HTTPRoute) {
+	for i := range route.Spec.Rules {
+		filters := route.Spec.Rules[i].Filters
+		sort.SliceStable(filters, func(a, b int) bool {
+			return filterRanks[filters[a].Type] < filterRanks[filters[b].Type]
+		})
+	}
+}
@@ -0,0 +1,242 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Safe deletion: with --grace-period, rows removed from a CSV keep a rule
+// answering for their path for the grace period, sending clients to a "gone"
+// backend or redirect instead of whatever else would match. The rows seen by
+// each run are kept in the --history file, so removals can be detected and
+// aged across runs.
+
+var (
+	gracePeriodFlag string
+	historyFile     string
+	goneBackend     string
+	goneRedirect    string
+)
+
+var (
+	gracePeriod time.Duration
+	// history is the loaded --history file, updated as CSVs are processed
+	// and saved by finishRun.
+	history *generationHistory
+	// historyReadOnly keeps --check from recording the run it simulates.
+	historyReadOnly bool
+)
+
+// historyEndpoint identifies a row across runs by its match and route target.
+type historyEndpoint struct {
+	Method           string    `json:"method,omitempty"`
+	URL              string    `json:"url"`
+	MatchType        string    `json:"matchType,omitempty"`
+	Headers          string    `json:"headers,omitempty"`
+	QueryParams      string    `json:"queryParams,omitempty"`
+	Accept           string    `json:"accept,omitempty"`
+	ContentType      string    `json:"contentType,omitempty"`
+	Cookie           string    `json:"cookie,omitempty"`
+	Hostname         string    `json:"hostname,omitempty"`
+	Gateway          string    `json:"gateway,omitempty"`
+	GatewayNamespace string    `json:"gatewayNamespace,omitempty"`
+	Profile          string    `json:"profile,omitempty"`
+	Tier             string    `json:"tier,omitempty"`
+	Owner            string    `json:"owner,omitempty"`
+	RemovedAt        time.Time `json:"removedAt,omitzero"`
+}
+
+func (h historyEndpoint) key() string {
+	return strings.Join([]string{h.Method, h.URL, h.MatchType, h.Headers, h.QueryParams, h.Accept, h.ContentType, h.Cookie, h.Hostname, h.Gateway, h.GatewayNamespace, h.Profile, h.Tier}, "\x00")
+}
+
+// historyFileEntry is the state of one CSV: its rows in the last run, and
+// rows removed since, still within their grace period.
+type historyFileEntry struct {
+	Endpoints []historyEndpoint `json:"endpoints"`
+	Removed   []historyEndpoint `json:"removed,omitempty"`
+}
+
+type generationHistory struct {
+	Files map[string]*historyFileEntry `json:"files"`
+}
+
+// parseGracePeriod accepts Go durations plus a "d" suffix for days.
+func parseGracePeriod(s string) (time.Duration, error) {
+	if days, ok := strings.CutSuffix(s, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil || n < 0 {
+			return 0, fmt.Errorf("invalid --grace-period %q", s)
+		}
+		return time.Duration(n) * 24 * time.Hour, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("invalid --grace-period %q (want e.g. 14d or 72h)", s)
+	}
+	return d, nil
+}
+
+// loadHistory validates the grace mode flags and reads the --history file.
+func loadHistory() error {
+	history, gracePeriod = nil, 0
+	if gracePeriodFlag == "" {
+		if goneBackend != "" || goneRedirect != "" {
+			return fmt.Errorf("--gone-backend and --gone-redirect require --grace-period")
+		}
+		return nil
+	}
+	d, err := parseGracePeriod(gracePeriodFlag)
+	if err != nil {
+		return err
+	}
+	gracePeriod = d
+	if historyFile == "" {
+		return fmt.Errorf("--grace-period requires --history")
+	}
+	switch {
+	case goneBackend == "" && goneRedirect == "":
+		return fmt.Errorf("--grace-period requires --gone-backend or --gone-redirect")
+	case goneBackend != "" && goneRedirect != "":
+		return fmt.Errorf("--gone-backend and --gone-redirect are mutually exclusive")
+	case goneBackend != "":
+		if _, err := parseBackendSpec(goneBackend); err != nil {
+			return fmt.Errorf("invalid --gone-backend: %w", err)
+		}
+	case !strings.HasPrefix(goneRedirect, "/"):
+		return fmt.Errorf("--gone-redirect must be a path starting with /")
+	}
+
+	history = &generationHistory{Files: make(map[string]*historyFileEntry)}
+	data, err := os.ReadFile(historyFile)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read history: %w", err)
+	}
+	if err := json.Unmarshal(data, history); err != nil {
+		return fmt.Errorf("failed to parse history %s: %w", historyFile, err)
+	}
+	if history.Files == nil {
+		history.Files = make(map[string]*historyFileEntry)
+	}
+	return nil
+}
+
+func toHistory(e Endpoint) historyEndpoint {
+	return historyEndpoint{
+		Method:           e.Method,
+		URL:              e.URL,
+		MatchType:        e.MatchType,
+		Headers:          e.Headers,
+		QueryParams:      e.QueryParams,
+		Accept:           e.Accept,
+		ContentType:      e.ContentType,
+		Cookie:           e.Cookie,
+		Hostname:         e.Hostname,
+		Gateway:          e.Gateway,
+		GatewayNamespace: e.GatewayNamespace,
+		Profile:          e.Profile,
+		Tier:             e.Tier,
+		Owner:            e.Owner,
+	}
+}
+
+// applyGracePeriod records the rows of path in the history and returns them
+// followed by a gone row for every row removed within the grace period.
+// Gone rows keep the route target of the removed row.
+func applyGracePeriod(path string, endpoints []Endpoint, now time.Time) []Endpoint {
+	if history == nil {
+		return endpoints
+	}
+	name := csvBaseName(path)
+	entry := history.Files[name]
+	if entry == nil {
+		entry = &historyFileEntry{}
+		history.Files[name] = entry
+	}
+
+	current := make(map[string]bool)
+	var seen []historyEndpoint
+	for _, e := range endpoints {
+		h := toHistory(e)
+		if !current[h.key()] {
+			current[h.key()] = true
+			seen = append(seen, h)
+		}
+	}
+
+	var removed []historyEndpoint
+	for _, h := range entry.Removed {
+		if !current[h.key()] && now.Sub(h.RemovedAt) < gracePeriod {
+			removed = append(removed, h)
+		}
+	}
+	for _, h := range entry.Endpoints {
+		if !current[h.key()] && !containsHistory(removed, h) {
+			h.RemovedAt = now.UTC().Truncate(time.Second)
+			removed = append(removed, h)
+		}
+	}
+	sort.SliceStable(removed, func(i, j int) bool { return removed[i].RemovedAt.Before(removed[j].RemovedAt) })
+	entry.Endpoints, entry.Removed = seen, removed
+
+	for _, h := range removed {
+		endpoints = append(endpoints, Endpoint{
+			Method:           h.Method,
+			URL:              h.URL,
+			MatchType:        h.MatchType,
+			Headers:          h.Headers,
+			QueryParams:      h.QueryParams,
+			Accept:           h.Accept,
+			ContentType:      h.ContentType,
+			Cookie:           h.Cookie,
+			Hostname:         h.Hostname,
+			Gateway:          h.Gateway,
+			GatewayNamespace: h.GatewayNamespace,
+			Profile:          h.Profile,
+			Tier:             h.Tier,
+			Owner:            h.Owner,
+			Gone:             true,
+		})
+	}
+	return endpoints
+}
+
+func containsHistory(list []historyEndpoint, h historyEndpoint) bool {
+	for _, l := range list {
+		if l.key() == h.key() {
+			return true
+		}
+	}
+	return false
+}
+
+// saveHistory writes the updated --history file.
+func saveHistory() error {
+	if history == nil || historyReadOnly {
+		return nil
+	}
+	data, err := json.MarshalIndent(history, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(historyFile, append(data, '\n'), 0666)
+}
+
+// goneFilter redirects requests for removed rows to --gone-redirect.
+func goneFilter() HTTPRouteFilter {
+	return HTTPRouteFilter{
+		Type: "RequestRedirect",
+		RequestRedirect: &HTTPRequestRedirectFilter{
+			Path:       &PathRewrite{Type: "ReplaceFullPath", ReplaceFullPath: goneRedirect},
+			StatusCode: 302,
+		},
+	}
+}
@@ -0,0 +1,248 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"maps"
+	"slices"
+	"strings"
+	"text/template"
+)
+
+var (
+	// grafanaDashboard is --grafana-dashboard: a Grafana dashboard JSON file
+	// with a panel per rule of every generated HTTPRoute, so dashboards
+	// follow the inventory like the routes do.
+	grafanaDashboard string
+	// grafanaTitle is --grafana-title, the title of the dashboard, from
+	// which its uid is derived.
+	grafanaTitle string
+	// grafanaQueries are --grafana-query: the PromQL templates of the
+	// targets of every panel.
+	grafanaQueries []string
+)
+
+// defaultGrafanaQuery is the request rate of a rule by response code class
+// as Envoy Gateway reports it, whose xDS clusters are named after the route
+// and rule they serve.
+const defaultGrafanaQuery = `sum by (envoy_response_code_class) (rate(envoy_cluster_upstream_rq_xx{envoy_cluster_name="{{.Kind}}/{{.Namespace}}/{{.Name}}/rule/{{.Rule}}"}[$__rate_interval]))`
+
+// grafanaTemplates are the parsed --grafana-query templates.
+var grafanaTemplates []*template.Template
+
+// grafanaRows collects a dashboard row per generated route during a run.
+var grafanaRows []grafanaRow
+
+// grafanaRow is the row of one route and the panels of its rules.
+type grafanaRow struct {
+	Title  string
+	Panels []grafanaPanel
+}
+
+// grafanaQuery is what a --grafana-query template is executed with: the
+// route and rule a panel shows.
+type grafanaQuery struct {
+	// Kind is the lowercase route kind, httproute.
+	Kind      string
+	Namespace string
+	Name      string
+	// Rule is the index of the rule in the route.
+	Rule int
+	// Hostname is the first hostname of the route, "" for none.
+	Hostname  string
+	Hostnames []string
+	// Paths are the path values of the rule's matches.
+	Paths []string
+}
+
+type grafanaPanel struct {
+	Title       string
+	Description string
+	Exprs       []string
+}
+
+func validateGrafana() error {
+	grafanaTemplates = nil
+	if grafanaDashboard == "" {
+		if len(grafanaQueries) > 0 {
+			return fmt.Errorf("--grafana-query needs --grafana-dashboard")
+		}
+		return nil
+	}
+	if outputKind != outputHTTPRoute {
+		return fmt.Errorf("--grafana-dashboard needs --output-kind %s", outputHTTPRoute)
+	}
+	queries := grafanaQueries
+	if len(queries) == 0 {
+		queries = []string{defaultGrafanaQuery}
+	}
+	for i, q := range queries {
+		t, err := template.New(fmt.Sprintf("query %d", i+1)).Option("missingkey=error").Parse(q)
+		if err == nil {
+			// Fail unknown fields before any route is generated
+			err = t.Execute(io.Discard, grafanaQuery{})
+		}
+		if err != nil {
+			return fmt.Errorf("invalid --grafana-query: %w", err)
+		}
+		grafanaTemplates = append(grafanaTemplates, t)
+	}
+	return nil
+}
+
+// collectGrafanaRow records the row of route, with a panel per rule titled
+// by the methods and paths it matches and described by the description
+// column of its rows, its source and labels.
+func collectGrafanaRow(route HTTPRoute, source string) error {
+	row := grafanaRow{Title: route.Metadata.Namespace + "/" + route.Metadata.Name}
+	if len(route.Spec.Hostnames) > 0 {
+		row.Title += " (" + strings.Join(route.Spec.Hostnames, ", ") + ")"
+	}
+	var labels []string
+	for _, key := range slices.Sorted(maps.Keys(route.Metadata.Labels)) {
+		labels = append(labels, key+"="+route.Metadata.Labels[key])
+	}
+	for i, rule := range route.Spec.Rules {
+		q := grafanaQuery{
+			Kind:      "httproute",
+			Namespace: route.Metadata.Namespace,
+			Name:      route.Metadata.Name,
+			Rule:      i,
+			Hostnames: route.Spec.Hostnames,
+		}
+		if len(q.Hostnames) > 0 {
+			q.Hostname = q.Hostnames[0]
+		}
+		var matches []string
+		for _, m := range rule.Matches {
+			p := "/"
+			if m.Path != nil {
+				p = m.Path.Value
+			}
+			if !slices.Contains(q.Paths, p) {
+				q.Paths = append(q.Paths, p)
+			}
+			if match := strings.TrimSpace(m.Method + " " + p); !slices.Contains(matches, match) {
+				matches = append(matches, match)
+			}
+		}
+		if len(matches) == 0 {
+			matches = []string{"/"}
+		}
+		panel := grafanaPanel{
+			Title:       grafanaPanelTitle(matches),
+			Description: fmt.Sprintf("Rule %d of HTTPRoute %s/%s, generated from %s. Matches: %s.", i, q.Namespace, q.Name, source, strings.Join(matches, ", ")),
+		}
+		if description := ruleDescription(rule); description != "" {
+			panel.Description = description + "\n\n" + panel.Description
+		}
+		if len(labels) > 0 {
+			panel.Description += " Labels: " + strings.Join(labels, ", ") + "."
+		}
+		for _, t := range grafanaTemplates {
+			var expr strings.Builder
+			if err := t.Execute(&expr, q); err != nil {
+				return fmt.Errorf("invalid --grafana-query: %w", err)
+			}
+			panel.Exprs = append(panel.Exprs, expr.String())
+		}
+		row.Panels = append(row.Panels, panel)
+	}
+	grafanaRows = append(grafanaRows, row)
+	return nil
+}
+
+// grafanaPanelTitle lists the first three matches of a rule, and counts the
+// others.
+func grafanaPanelTitle(matches []string) string {
+	if len(matches) <= 3 {
+		return strings.Join(matches, ", ")
+	}
+	return fmt.Sprintf("%s (+%d more)", strings.Join(matches[:3], ", "), len(matches)-3)
+}
+
+// writeGrafanaDashboard writes the rows collected in this run to
+// --grafana-dashboard, two panels side by side, with a data source
+// variable. The uid is derived from the title, so the dashboard is
+// replaced rather than duplicated when provisioned again.
+func writeGrafanaDashboard() error {
+	sum := sha256.Sum256([]byte(grafanaTitle))
+	type gridPos struct {
+		H int `json:"h"`
+		W int `json:"w"`
+		X int `json:"x"`
+		Y int `json:"y"`
+	}
+	datasource := map[string]string{"type": "prometheus", "uid": "${datasource}"}
+	panels := []map[string]any{}
+	id, y := 1, 0
+	for _, row := range grafanaRows {
+		panels = append(panels, map[string]any{
+			"id":        id,
+			"type":      "row",
+			"title":     row.Title,
+			"collapsed": false,
+			"gridPos":   gridPos{H: 1, W: 24, Y: y},
+			"panels":    []any{},
+		})
+		id, y = id+1, y+1
+		for i, p := range row.Panels {
+			var targets []map[string]any
+			for j, expr := range p.Exprs {
+				target := map[string]any{"refId": string(rune('A' + j%26)), "datasource": datasource, "expr": expr, "legendFormat": "__auto"}
+				if len(grafanaQueries) == 0 {
+					target["legendFormat"] = "{{envoy_response_code_class}}xx"
+				}
+				targets = append(targets, target)
+			}
+			panels = append(panels, map[string]any{
+				"id":          id,
+				"type":        "timeseries",
+				"title":       p.Title,
+				"description": p.Description,
+				"datasource":  datasource,
+				"gridPos":     gridPos{H: 8, W: 12, X: 12 * (i % 2), Y: y + 8*(i/2)},
+				"fieldConfig": map[string]any{"defaults": map[string]any{"unit": "reqps"}, "overrides": []any{}},
+				"targets":     targets,
+			})
+			id++
+		}
+		y += 8 * ((len(row.Panels) + 1) / 2)
+	}
+	dashboard := map[string]any{
+		"uid":           "csv2httproute-" + hex.EncodeToString(sum[:6]),
+		"title":         grafanaTitle,
+		"description":   fmt.Sprintf("Generated by csv2httproute %s from the routing inventory. DO NOT EDIT.", Version),
+		"tags":          []string{"csv2httproute", "gateway-api"},
+		"editable":      true,
+		"schemaVersion": 39,
+		"time":          map[string]string{"from": "now-6h", "to": "now"},
+		"refresh":       "1m",
+		"templating": map[string]any{"list": []any{map[string]any{
+			"name":  "datasource",
+			"label": "Data source",
+			"type":  "datasource",
+			"query": "prometheus",
+		}}},
+		"panels": panels,
+	}
+	// PromQL compares with < and >, which should not turn into \u003c
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(dashboard); err != nil {
+		return err
+	}
+	if err := writeOutputFile(grafanaDashboard, buf.Bytes()); err != nil {
+		return err
+	}
+	if !quiet {
+		fmt.Printf("Generated %s\n", grafanaDashboard)
+	}
+	return nil
+}
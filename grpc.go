@@ -0,0 +1,264 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/arencloud/csv2httproute/pkg/convert"
+)
+
+// Rows with protocol=grpc, or every row under --kind GRPCRoute, name gRPC
+// methods as /package.Service/Method and are served by GRPCRoutes, which
+// match on the service and method instead of the path.
+
+// Route kinds of --kind.
+const (
+	kindHTTPRoute = "HTTPRoute"
+	kindGRPCRoute = "GRPCRoute"
+)
+
+// routeKind is --kind: the route kind of rows without a protocol column.
+var routeKind = kindHTTPRoute
+
+// maxGRPCRules is the rule limit of the GRPCRoute CRD.
+const maxGRPCRules = 16
+
+var (
+	grpcServiceName = regexp.MustCompile(`^(?i)\.?[a-z_][a-z_0-9]*(\.[a-z_][a-z_0-9]*)*$`)
+	grpcMethodName  = regexp.MustCompile(`^[A-Za-z_][A-Za-z_0-9]*$`)
+)
+
+// grpcRoute is a Gateway API GRPCRoute.
+type grpcRoute struct {
+	APIVersion string        `yaml:"apiVersion"`
+	Kind       string        `yaml:"kind"`
+	Metadata   Metadata      `yaml:"metadata"`
+	Spec       grpcRouteSpec `yaml:"spec"`
+}
+
+type grpcRouteSpec struct {
+	ParentRefs []ParentRef     `yaml:"parentRefs"`
+	Hostnames  []string        `yaml:"hostnames,omitempty"`
+	Rules      []grpcRouteRule `yaml:"rules"`
+}
+
+type grpcRouteRule struct {
+	Matches     []grpcRouteMatch  `yaml:"matches,omitempty"`
+	Filters     []HTTPRouteFilter `yaml:"filters,omitempty"`
+	BackendRefs []BackendRef      `yaml:"backendRefs"`
+}
+
+type grpcRouteMatch struct {
+	Method  *grpcMethodMatch          `yaml:"method,omitempty"`
+	Headers []convert.HTTPHeaderMatch `yaml:"headers,omitempty"`
+}
+
+type grpcMethodMatch struct {
+	Type    string `yaml:"type,omitempty"`
+	Service string `yaml:"service,omitempty"`
+	Method  string `yaml:"method,omitempty"`
+}
+
+func validateRouteKind(kind string) error {
+	if kind == kindHTTPRoute || kind == kindGRPCRoute {
+		return nil
+	}
+	return fmt.Errorf("invalid --kind %q (must be %s or %s)", kind, kindHTTPRoute, kindGRPCRoute)
+}
+
+// grpcRow reports whether e names a gRPC method.
+func grpcRow(e Endpoint) bool {
+	return e.Protocol == convert.RouteGRPC || (e.Protocol == "" && routeKind == kindGRPCRoute)
+}
+
+// splitGRPC separates the gRPC rows from the HTTP rows. Columns GRPCRoutes
+// have no equivalent for fail the row rather than being silently ignored.
+func splitGRPC(endpoints []Endpoint) (httpRows, grpcRows []Endpoint, err error) {
+	for _, e := range endpoints {
+		if !grpcRow(e) {
+			httpRows = append(httpRows, e)
+			continue
+		}
+		var unusable []string
+		for column, set := range map[string]bool{
+			"prefix":          e.Prefix != "",
+			"query_params":    e.QueryParams != "",
+			"accept":          e.Accept != "",
+			"content_type":    e.ContentType != "",
+			"cookie":          e.Cookie != "",
+			"cache_ttl":       e.CacheControl != "",
+			"scale_to_zero":   e.ScaleToZero,
+			"fallback":        e.Fallback != "",
+			"redirect":        e.Redirect != "",
+			"rewrite":         e.Rewrite != "",
+			"timeout":         e.Timeout != "",
+			"backend_timeout": e.BackendTimeout != "",
+			"retries":         e.Retries != "",
+		} {
+			if set {
+				unusable = append(unusable, column)
+			}
+		}
+		if len(unusable) > 0 {
+			slices.Sort(unusable)
+			return nil, nil, fmt.Errorf("line %d: protocol=grpc rows are matched by service and method and cannot set %s", e.Line, strings.Join(unusable, ", "))
+		}
+		if _, err := grpcMethod(e); err != nil {
+			return nil, nil, fmt.Errorf("line %d: %w", e.Line, err)
+		}
+		grpcRows = append(grpcRows, e)
+	}
+	return httpRows, grpcRows, nil
+}
+
+// grpcMethod is the method match of a gRPC row: its URL split into service
+// and method, matched exactly unless the match_type is RegularExpression.
+// A URL without a method, or with "*", matches every method of the service.
+func grpcMethod(e Endpoint) (grpcMethodMatch, error) {
+	service, method, _ := strings.Cut(strings.TrimPrefix(e.URL, "/"), "/")
+	if method == "*" {
+		method = ""
+	}
+	match := grpcMethodMatch{Type: "Exact", Service: service, Method: method}
+	switch e.MatchType {
+	case "", "Exact":
+		if !grpcServiceName.MatchString(service) || (method != "" && !grpcMethodName.MatchString(method)) {
+			return match, fmt.Errorf("invalid gRPC method %q (want /package.Service/Method or /package.Service)", e.URL)
+		}
+	case "RegularExpression":
+		match.Type = e.MatchType
+		for _, expr := range []string{service, method} {
+			if _, err := regexp.Compile(expr); err != nil {
+				return match, fmt.Errorf("invalid gRPC method expression %q: %w", expr, err)
+			}
+		}
+		if service == "" {
+			return match, fmt.Errorf("invalid gRPC method %q (missing service)", e.URL)
+		}
+	default:
+		return match, fmt.Errorf("match_type %s does not apply to gRPC methods (use Exact or RegularExpression)", e.MatchType)
+	}
+	return match, nil
+}
+
+// writeGRPCRoutes writes <route>-grpc.yaml for the gRPC rows of path: one
+// GRPCRoute per hostname and gateway, with a rule per backend and variant.
+func writeGRPCRoutes(path string, endpoints []Endpoint) error {
+	base, err := routeBaseName(path)
+	if err != nil {
+		return err
+	}
+	for _, group := range partitionByDomain(endpoints) {
+		name := base + "-grpc"
+		if group.Domain != nil {
+			name += "-" + group.Domain.slug()
+		}
+		route := grpcRoute{
+			APIVersion: "gateway.networking.k8s.io/v1",
+			Kind:       kindGRPCRoute,
+			Metadata:   Metadata{Name: name, Namespace: group.Target.routeNamespace()},
+			Spec: grpcRouteSpec{
+				ParentRefs: targetParents(group.Target),
+			},
+		}
+		route.Spec.Hostnames = routeHostnames(group.Target, group.Endpoints)
+		rules, err := grpcRules(group.Endpoints)
+		if err != nil {
+			return err
+		}
+		if len(rules) > maxGRPCRules {
+			return fmt.Errorf("GRPCRoute %s needs %d rules, more than the %d a GRPCRoute can hold; split the gRPC rows by backend or domain", name, len(rules), maxGRPCRules)
+		}
+		route.Spec.Rules = rules
+
+		if err := applyRouteMetadata(&route.Metadata, group.Endpoints); err != nil {
+			return err
+		}
+		if err := claimRouteName(&route.Metadata, path); err != nil {
+			return err
+		}
+		name = route.Metadata.Name
+		if err := lintRoute(name, route.Spec.Hostnames, path); err != nil {
+			return err
+		}
+		outPath, err := writeRouteDoc(route, name, path)
+		if err != nil {
+			return err
+		}
+		if emitModel != "" {
+			collectModelRoute(route.Kind, route.Metadata, route.Spec.Hostnames, modelParents(route.Spec.ParentRefs), group.Endpoints, path)
+		}
+		runMetrics.routes++
+		if !quiet {
+			fmt.Printf("Generated %s\n", outPath)
+		}
+	}
+	return nil
+}
+
+// grpcRules groups the method matches of endpoints into a rule per backend,
+// variant and header modifiers, in order of first appearance, split into rules of at most
+// --max-matches-per-rule matches.
+func grpcRules(endpoints []Endpoint) ([]grpcRouteRule, error) {
+	type ruleKey struct {
+		backend  BackendRef
+		variant  string
+		request  convert.HeaderEdits
+		response convert.HeaderEdits
+	}
+	var keys []ruleKey
+	matches := make(map[ruleKey][]grpcRouteMatch)
+	lines := make(map[ruleKey]int)
+	for _, e := range endpoints {
+		method, err := grpcMethod(e)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", e.Line, err)
+		}
+		match := grpcRouteMatch{Method: &method}
+		for _, pair := range strings.Split(e.Headers, ";") {
+			if name, value, ok := strings.Cut(pair, "="); ok {
+				match.Headers = append(match.Headers, convert.HTTPHeaderMatch{Type: "Exact", Name: name, Value: value})
+			}
+		}
+		key := ruleKey{backend: backendFor(e), variant: e.Variant, request: e.RequestHeaders, response: e.ResponseHeaders}
+		if _, ok := matches[key]; !ok {
+			keys = append(keys, key)
+			lines[key] = e.Line
+		}
+		matches[key] = append(matches[key], match)
+	}
+
+	var rules []grpcRouteRule
+	for _, key := range keys {
+		rule := grpcRouteRule{BackendRefs: []BackendRef{key.backend}}
+		if key.variant != "" {
+			rule.Filters = []HTTPRouteFilter{{
+				Type: convert.RequestHeaderModifier,
+				RequestHeaderModifier: &HTTPHeaderFilter{
+					Set: []HTTPHeader{{Name: convert.VariantHeader, Value: key.variant}},
+				},
+			}}
+		}
+		var err error
+		if rule.Filters, err = convert.MergeHeaderEdits(rule.Filters, convert.RequestHeaderModifier, key.request); err == nil {
+			rule.Filters, err = convert.MergeHeaderEdits(rule.Filters, convert.ResponseHeaderModifier, key.response)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", lines[key], err)
+		}
+		all := matches[key]
+		for len(all) > 0 {
+			n := len(all)
+			if matchesPerRuleLimit > 0 && n > matchesPerRuleLimit {
+				n = matchesPerRuleLimit
+			}
+			chunk := rule
+			chunk.Matches = all[:n]
+			rules = append(rules, chunk)
+			all = all[n:]
+		}
+	}
+	return rules, nil
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"reflect"
+	"slices"
+)
+
+// With --shard-by-hostname the routes of every hostname are merged across
+// the CSVs into one HTTPRoute named after the hostname, however the rows are
+// spread over files, since some gateways reconcile many small per-host
+// routes much faster than a few large routes covering several hosts.
+
+// shardByHostname is --shard-by-hostname.
+var shardByHostname bool
+
+// hostnameLineOffset separates the line numbers of the files merged into
+// one route while it is sharded, so each shard keeps the rows its matches
+// came from.
+const hostnameLineOffset = 1 << 24
+
+// hostnameRoutes are the routes of one hostname, namespace and set of
+// parent Gateways, in the order they were built, with the file each came
+// from.
+type hostnameRoutes struct {
+	Hostname string
+	Routes   []generatedRoute
+	Sources  []string
+}
+
+var (
+	// hostnameGroups collects the routes with a hostname during a run.
+	hostnameGroups []*hostnameRoutes
+	hostnameIndex  = make(map[string]int)
+)
+
+func validateShardByHostname() error {
+	if !shardByHostname {
+		return nil
+	}
+	switch {
+	case splitBy != splitFile:
+		return fmt.Errorf("--shard-by-hostname cannot be combined with --split-by %s", splitBy)
+	case partitionBy != "":
+		return fmt.Errorf("--shard-by-hostname cannot be combined with --partition-by")
+	case groupByVersion:
+		return fmt.Errorf("--shard-by-hostname cannot be combined with --group-by-version")
+	case matchMapMode != matchMapNone:
+		return fmt.Errorf("--shard-by-hostname cannot be combined with --match-map, whose lines are per CSV")
+	}
+	return nil
+}
+
+// stashHostnameRoutes keeps the routes built from path that have a
+// hostname for writeHostnameRoutes and returns the others. A route listing
+// several hostnames is split into one per hostname, each merged with the
+// other routes of its hostname.
+func stashHostnameRoutes(path string, routes []generatedRoute) []generatedRoute {
+	var rest []generatedRoute
+	for _, gr := range routes {
+		if len(gr.Route.Spec.Hostnames) == 0 {
+			rest = append(rest, gr)
+			continue
+		}
+		for _, h := range gr.Route.Spec.Hostnames {
+			host := gr
+			host.Route.Spec.Hostnames = []string{h}
+			key := fmt.Sprint(host.Route.Metadata.Namespace, h, host.Route.Spec.ParentRefs)
+			i, ok := hostnameIndex[key]
+			if !ok {
+				i = len(hostnameGroups)
+				hostnameIndex[key] = i
+				hostnameGroups = append(hostnameGroups, &hostnameRoutes{Hostname: h})
+			}
+			hostnameGroups[i].Routes = append(hostnameGroups[i].Routes, host)
+			hostnameGroups[i].Sources = append(hostnameGroups[i].Sources, path)
+		}
+	}
+	return rest
+}
+
+// writeHostnameRoutes writes the merged route of every hostname, sharded by
+// --max-rules-per-route. A route takes its metadata and per-CSV settings
+// from the first CSV with rows for the hostname. Hostnames served in several
+// namespaces or by several Gateways get one route each, numbered from -2.
+func writeHostnameRoutes(ctx context.Context) error {
+	used := make(map[string]bool)
+	for _, g := range hostnameGroups {
+		name := uniqueSuffix(domainRule{Hostname: g.Hostname}.slug(), used)
+		source := g.Sources[0]
+		restore, err := applyCSVSettings(ctx, source)
+		if err != nil {
+			return fmt.Errorf("hostname %s: %w", g.Hostname, err)
+		}
+		for _, gr := range mergeHostnameRoutes(name, g.Routes) {
+			if err := emitRoute(ctx, gr, source); err != nil {
+				restore()
+				return fmt.Errorf("hostname %s: %w", g.Hostname, err)
+			}
+		}
+		restore()
+	}
+	return nil
+}
+
+// mergeHostnameRoutes concatenates the rules of routes into a route called
+// name and shards it.
+func mergeHostnameRoutes(name string, routes []generatedRoute) []generatedRoute {
+	merged := routes[0].Route
+	merged.Metadata.Name = name
+	merged.Metadata.Labels = maps.Clone(merged.Metadata.Labels)
+	merged.Metadata.Annotations = maps.Clone(merged.Metadata.Annotations)
+	merged.Spec.Rules = nil
+	var endpoints []Endpoint
+	for i, gr := range routes {
+		offset := i * hostnameLineOffset
+		for _, rule := range gr.Route.Spec.Rules {
+			rule.Matches = slices.Clone(rule.Matches)
+			for j, m := range rule.Matches {
+				rule.Matches[j].SourceLines = make([]int, len(m.SourceLines))
+				for k, line := range m.SourceLines {
+					rule.Matches[j].SourceLines[k] = line + offset
+				}
+			}
+			// Rules from no row, such as the --default-backend catch-all,
+			// are added once.
+			if !slices.ContainsFunc(merged.Spec.Rules, func(r HTTPRouteRule) bool { return reflect.DeepEqual(r, rule) }) {
+				merged.Spec.Rules = append(merged.Spec.Rules, rule)
+			}
+		}
+		for _, e := range gr.Endpoints {
+			e.Line += offset
+			endpoints = append(endpoints, e)
+		}
+	}
+
+	shards := shardRoute(generatedRoute{Route: merged, Endpoints: endpoints})
+	for _, shard := range shards {
+		for _, rule := range shard.Route.Spec.Rules {
+			for _, m := range rule.Matches {
+				for k := range m.SourceLines {
+					m.SourceLines[k] %= hostnameLineOffset
+				}
+			}
+		}
+		for j := range shard.Endpoints {
+			shard.Endpoints[j].Line %= hostnameLineOffset
+		}
+	}
+	return shards
+}
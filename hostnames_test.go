@@ -0,0 +1,56 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestShardByHostnameSplitsMultiHostRoutes(t *testing.T) {
+	dir := t.TempDir()
+	input := filepath.Join(dir, "endpoints")
+	if err := os.Mkdir(input, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]string{
+		"shop.csv": "Method,URL,Service,hostname\nGET,/orders,orders,shop.example.com;shop.example.org\n",
+		"cart.csv": "Method,URL,Service,hostname\nGET,/cart,cart,shop.example.org\n",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(input, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	out := filepath.Join(dir, "generated")
+	if err := runCommand(t, "--input", input, "--output", out, "--shard-by-hostname", "--env-file", ""); err != nil {
+		t.Fatalf("generate: %v", err)
+	}
+
+	want := map[string][]string{
+		"shop-example-com": {"/orders"},
+		"shop-example-org": {"/cart", "/orders"},
+	}
+	for name, paths := range want {
+		data, err := os.ReadFile(filepath.Join(out, name+".yaml"))
+		if err != nil {
+			t.Fatalf("route of the hostname: %v", err)
+		}
+		var route HTTPRoute
+		if err := yaml.Unmarshal(data, &route); err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, rule := range route.Spec.Rules {
+			for _, m := range rule.Matches {
+				got = append(got, m.Path.Value)
+			}
+		}
+		slices.Sort(got)
+		if len(route.Spec.Hostnames) != 1 || !slices.Equal(got, paths) {
+			t.Errorf("%s serves %v on %v, want %v on one hostname", name, got, route.Spec.Hostnames, paths)
+		}
+	}
+}
@@ -0,0 +1,397 @@
+package main
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/arencloud/csv2httproute/pkg/convert"
+)
+
+// iisRule is a URL Rewrite rule of a web.config.
+type iisRule struct {
+	Name          string `xml:"name,attr"`
+	Enabled       string `xml:"enabled,attr"`
+	PatternSyntax string `xml:"patternSyntax,attr"`
+	Match         struct {
+		URL    string `xml:"url,attr"`
+		Negate string `xml:"negate,attr"`
+	} `xml:"match"`
+	Conditions struct {
+		LogicalGrouping string         `xml:"logicalGrouping,attr"`
+		Add             []iisCondition `xml:"add"`
+	} `xml:"conditions"`
+	Action struct {
+		Type         string `xml:"type,attr"`
+		URL          string `xml:"url,attr"`
+		RedirectType string `xml:"redirectType,attr"`
+	} `xml:"action"`
+}
+
+type iisCondition struct {
+	Input     string `xml:"input,attr"`
+	Pattern   string `xml:"pattern,attr"`
+	Negate    string `xml:"negate,attr"`
+	MatchType string `xml:"matchType,attr"`
+}
+
+// iisRedirectCodes are the status codes of the redirect types Gateway API
+// redirects can answer with.
+var iisRedirectCodes = map[string]string{"": "301", "permanent": "301", "found": "302"}
+
+// skippedRule marks a rule or route that has no route equivalent. It is
+// reported and left out rather than failing the file.
+type skippedRule struct{ error }
+
+// parseIIS turns the inbound URL Rewrite rules of a web.config into
+// endpoint rows, one per rule and method, numbered by the line of the rule:
+//
+//   - the match becomes the URL: a literal pattern such as ^api/orders$ an
+//     Exact match, a literal followed by (.*) a PathPrefix match, anything
+//     else a RegularExpression match;
+//   - {REQUEST_METHOD}, {HTTP_HOST} and {HTTP_<HEADER>} conditions become
+//     the methods, hostname and header matches of the row;
+//   - a Rewrite action to http://service:port/... becomes the backend, with
+//     the prefix rewritten away for .../{R:1} and kept for .../{R:0}, and a
+//     Redirect action without back-references the redirect column.
+//
+// Rules that cannot be expressed, such as negated matches, other
+// conditions, or actions interpolating captures into new paths, are left
+// out with a warning, as are disabled rules.
+func parseIIS(ctx context.Context, path string) ([]Endpoint, error) {
+	data, err := readInput(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+	d := xml.NewDecoder(bytes.NewReader(data))
+	var stack []string
+	var endpoints []Endpoint
+	skipped := 0
+	for {
+		tok, err := d.Token()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid web.config: %w", err)
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			inRules := len(stack) >= 2 && stack[len(stack)-1] == "rules" && stack[len(stack)-2] == "rewrite"
+			if t.Name.Local != "rule" || !inRules {
+				stack = append(stack, t.Name.Local)
+				continue
+			}
+			line, _ := d.InputPos()
+			var rule iisRule
+			if err := d.DecodeElement(&rule, &t); err != nil {
+				return nil, fmt.Errorf("line %d: %w", line, err)
+			}
+			if strings.EqualFold(rule.Enabled, "false") {
+				skipped++
+				continue
+			}
+			rows, err := iisRows(rule)
+			var skip skippedRule
+			if errors.As(err, &skip) {
+				fmt.Fprintf(os.Stderr, "WARNING: %s:%d: rewrite rule %q skipped: %v\n", path, line, rule.Name, skip.error)
+				skipped++
+				continue
+			}
+			if err != nil {
+				return nil, fmt.Errorf("line %d: rule %q: %w", line, rule.Name, err)
+			}
+			for _, e := range rows {
+				e.Line = line
+				endpoints = append(endpoints, e)
+			}
+		case xml.EndElement:
+			stack = stack[:len(stack)-1]
+		}
+	}
+	recordSkippedRows(path, skipped)
+	return applyTagFilters(applyCutovers(endpoints)), nil
+}
+
+// iisRows are the rows of one rule.
+func iisRows(rule iisRule) ([]Endpoint, error) {
+	if strings.EqualFold(rule.Match.Negate, "true") {
+		return nil, skippedRule{errors.New("negated match")}
+	}
+	match, err := iisMatch(rule.Match.URL, rule.PatternSyntax)
+	if err != nil {
+		return nil, err
+	}
+	record := map[string]string{"url": match.URL, "match_type": match.Type, "comment": rule.Name}
+	methods, host, err := iisConditions(rule, record)
+	if err != nil {
+		return nil, err
+	}
+	if err := iisAction(rule, match, record); err != nil {
+		return nil, err
+	}
+	if record["prefix"] != "" && (methods[0] != "" || record["headers"] != "") {
+		return nil, skippedRule{errors.New("the prefix rule rewriting {R:1} cannot match methods or headers")}
+	}
+
+	var header, values []string
+	for k, v := range record {
+		header = append(header, k)
+		values = append(values, v)
+	}
+	var rows []Endpoint
+	for _, method := range methods {
+		e, err := parseRecord(append(values, method), convert.ColumnIndex(append(header, "method")))
+		if err != nil {
+			return nil, err
+		}
+		e.Hostname = host
+		rows = append(rows, e)
+	}
+	return rows, nil
+}
+
+// iisPath is the path match of a rule, and the literal path before its
+// (.*) capture for prefix matches.
+type iisPath struct {
+	URL, Type string
+	// Prefix is set for PathPrefix matches whose rest is captured as {R:1}.
+	Prefix string
+}
+
+// regexMeta are the characters that make a pattern a regular expression.
+const regexMeta = `.^$*+?()[]{}|\`
+
+// iisCaptureTails are the pattern endings capturing the rest of the path
+// below a literal prefix as {R:1}.
+var iisCaptureTails = []string{"/(.*)", "(/.*)?", "(/.*)", "(.*)", "/.*", ".*"}
+
+// iisMatch converts the url pattern of a match. IIS matches the path
+// without its leading slash, case-insensitively by default; Gateway API
+// matches are case-sensitive.
+func iisMatch(pattern, syntax string) (iisPath, error) {
+	switch strings.ToLower(syntax) {
+	case "exactmatch":
+		return iisPath{URL: "/" + pattern, Type: "Exact"}, nil
+	case "wildcard":
+		lit, rest, wild := strings.Cut(pattern, "*")
+		switch {
+		case !wild && !strings.Contains(pattern, "?"):
+			return iisPath{URL: "/" + pattern, Type: "Exact"}, nil
+		case rest == "" && !strings.Contains(lit, "?"):
+			prefix := iisPrefix(lit)
+			return iisPath{URL: prefix, Type: "PathPrefix", Prefix: prefix}, nil
+		}
+		return iisPath{}, skippedRule{fmt.Errorf("wildcard pattern %q has no Gateway API match", pattern)}
+	case "", "ecmascript":
+	default:
+		return iisPath{}, fmt.Errorf("unknown patternSyntax %q", syntax)
+	}
+
+	body, anchored := strings.CutPrefix(pattern, "^")
+	body, exact := strings.CutSuffix(body, "$")
+	if exact && strings.HasSuffix(body, `\`) {
+		body, exact = body+"$", false
+	}
+	if !anchored {
+		if body == "" || body == ".*" || body == "(.*)" {
+			return iisPath{URL: "/", Type: "PathPrefix", Prefix: "/"}, nil
+		}
+		return iisPath{URL: "/.*" + body + iisRegexEnd(exact), Type: "RegularExpression"}, nil
+	}
+	if lit, ok := regexLiteral(body); ok {
+		if exact {
+			return iisPath{URL: "/" + lit, Type: "Exact"}, nil
+		}
+		return iisPath{URL: iisPrefix(lit), Type: "PathPrefix"}, nil
+	}
+	for _, tail := range iisCaptureTails {
+		if rest, ok := strings.CutSuffix(body, tail); ok {
+			if lit, ok := regexLiteral(rest); ok {
+				prefix := iisPrefix(lit)
+				return iisPath{URL: prefix, Type: "PathPrefix", Prefix: prefix}, nil
+			}
+		}
+	}
+	return iisPath{URL: "/" + body + iisRegexEnd(exact), Type: "RegularExpression"}, nil
+}
+
+// iisRegexEnd completes a pattern not anchored at its end, since Gateway
+// API expressions match the whole path.
+func iisRegexEnd(exact bool) string {
+	if exact {
+		return ""
+	}
+	return ".*"
+}
+
+// iisPrefix is the PathPrefix of the literal start of a pattern.
+func iisPrefix(lit string) string {
+	return "/" + strings.TrimSuffix(lit, "/")
+}
+
+// regexLiteral unescapes a pattern matching only itself.
+func regexLiteral(s string) (string, bool) {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == '\\' && i+1 < len(s) && strings.IndexByte(regexMeta+"/-", s[i+1]) >= 0:
+			i++
+			b.WriteByte(s[i])
+		case strings.IndexByte(regexMeta, c) >= 0:
+			return "", false
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return b.String(), true
+}
+
+// iisMethod matches the method conditions rows can express, such as ^GET$
+// or ^(GET|POST)$.
+var iisMethod = regexp.MustCompile(`^\^?\(?([A-Za-z]+(?:\|[A-Za-z]+)*)\)?\$?$`)
+
+// iisConditions reads the conditions of rule into the methods and hostname
+// of its rows and the headers cell of record. A rule without method
+// conditions matches every method.
+func iisConditions(rule iisRule, record map[string]string) ([]string, string, error) {
+	conds := rule.Conditions.Add
+	if len(conds) > 1 && strings.EqualFold(rule.Conditions.LogicalGrouping, "MatchAny") {
+		return nil, "", skippedRule{errors.New("conditions grouped with MatchAny")}
+	}
+	methods := []string{""}
+	host := ""
+	var headers []string
+	for _, c := range conds {
+		if strings.EqualFold(c.Negate, "true") || (c.MatchType != "" && !strings.EqualFold(c.MatchType, "Pattern")) {
+			return nil, "", skippedRule{fmt.Errorf("condition on %s cannot be matched", c.Input)}
+		}
+		input := strings.ToUpper(strings.Trim(c.Input, "{}"))
+		exact, isExact := regexLiteral(strings.TrimSuffix(strings.TrimPrefix(c.Pattern, "^"), "$"))
+		isExact = isExact && strings.HasPrefix(c.Pattern, "^") && strings.HasSuffix(c.Pattern, "$")
+		switch {
+		case input == "REQUEST_METHOD":
+			m := iisMethod.FindStringSubmatch(c.Pattern)
+			if m == nil {
+				return nil, "", skippedRule{fmt.Errorf("method condition %q is not a list of methods", c.Pattern)}
+			}
+			methods = strings.Split(strings.ToUpper(m[1]), "|")
+		case input == "HTTP_HOST" && isExact:
+			host = strings.ToLower(exact)
+		case strings.HasPrefix(input, "HTTP_") && input != "HTTP_HOST" && isExact:
+			headers = append(headers, iisHeaderName(input)+"="+exact)
+		default:
+			return nil, "", skippedRule{fmt.Errorf("condition %s %q cannot be matched", c.Input, c.Pattern)}
+		}
+	}
+	record["headers"] = strings.Join(headers, ";")
+	return methods, host, nil
+}
+
+// iisHeaderName is the header of an HTTP_<HEADER> server variable, such as
+// X-Api-Version for HTTP_X_API_VERSION.
+func iisHeaderName(variable string) string {
+	words := strings.Split(strings.ToLower(strings.TrimPrefix(variable, "HTTP_")), "_")
+	for i, w := range words {
+		if w != "" {
+			words[i] = strings.ToUpper(w[:1]) + w[1:]
+		}
+	}
+	return strings.Join(words, "-")
+}
+
+// iisAction reads the action of rule into the backend, prefix, rewrite or
+// redirect cells of record.
+func iisAction(rule iisRule, match iisPath, record map[string]string) error {
+	target := rule.Action.URL
+	switch strings.ToLower(rule.Action.Type) {
+	case "rewrite":
+	case "redirect":
+		code, ok := iisRedirectCodes[strings.ToLower(rule.Action.RedirectType)]
+		if !ok {
+			return skippedRule{fmt.Errorf("redirectType %s is neither Permanent nor Found", rule.Action.RedirectType)}
+		}
+		if strings.Contains(target, "{") {
+			return skippedRule{fmt.Errorf("redirect to %s interpolates the request", target)}
+		}
+		if !strings.Contains(target, "://") && !strings.HasPrefix(target, "/") {
+			target = "/" + target
+		}
+		record["redirect"] = code + " " + target
+		return nil
+	default:
+		return skippedRule{fmt.Errorf("%s action has no route equivalent", cmp.Or(rule.Action.Type, "None"))}
+	}
+
+	rest := target
+	if u, err := url.Parse(target); err == nil && u.Host != "" {
+		if u.RawQuery != "" {
+			return skippedRule{fmt.Errorf("rewrite to %s sets a query string", target)}
+		}
+		if !iisLocalHost(u.Hostname()) {
+			backendCells(u, record)
+		}
+		rest = u.Path
+	}
+	rest = "/" + strings.TrimPrefix(rest, "/")
+	switch {
+	case rest == "/{R:0}" || (match.Prefix != "" && rest == strings.TrimSuffix(match.Prefix, "/")+"/{R:1}"):
+		// The request is forwarded with its path.
+	case match.Prefix != "" && rest == "/{R:1}":
+		record["prefix"] = match.Prefix
+	case !strings.Contains(rest, "{"):
+		if rest != match.URL || match.Type != "Exact" {
+			record["rewrite"] = rest
+		}
+	default:
+		return skippedRule{fmt.Errorf("rewrite to %s builds a new path from the request", target)}
+	}
+	return nil
+}
+
+// backendCells sets the service, service_namespace and port cells of record
+// to the backend of a URL such as http://orders.shop.svc:8080: the Service
+// named by the first label of the host, in the namespace of the second for
+// cluster DNS names.
+func backendCells(u *url.URL, record map[string]string) {
+	labels := strings.Split(u.Hostname(), ".")
+	record["service"] = labels[0]
+	if len(labels) > 2 && labels[2] == "svc" {
+		record["service_namespace"] = labels[1]
+	}
+	port := u.Port()
+	if port == "" {
+		port = "80"
+		if u.Scheme == "https" || u.Scheme == "wss" {
+			port = "443"
+		}
+	}
+	record["port"] = port
+}
+
+// iisLocalHost reports whether a rewrite to host stays on the IIS site,
+// whose backend is the --service default.
+func iisLocalHost(host string) bool {
+	return host == "localhost" || net.ParseIP(host) != nil
+}
+
+// iisRouteName names the route of a web.config after its directory, since
+// every application of a site has a file of that name.
+func iisRouteName(path string) (string, bool) {
+	if !strings.EqualFold(filepath.Base(plainName(path)), "web.config") {
+		return "", false
+	}
+	dir := filepath.Base(filepath.Dir(plainName(path)))
+	return dir, dir != "." && dir != string(filepath.Separator)
+}
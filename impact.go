@@ -0,0 +1,261 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/arencloud/csv2httproute/pkg/router"
+	"github.com/spf13/cobra"
+)
+
+var (
+	impactBase      string
+	prometheusURL   string
+	prometheusQuery string
+	impactMethodKey string
+	impactPathKey   string
+	impactHostKey   string
+)
+
+// prometheusTokenEnv names the variable holding an optional bearer token.
+const prometheusTokenEnv = "PROMETHEUS_TOKEN"
+
+func newImpactCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "impact",
+		Short: "Estimate the share of live traffic affected by an inventory change",
+		Long: `Builds the routing tables of the --base inventory and of --input in memory,
+fetches current request rates from Prometheus, and replays each series against
+both tables. Every added, removed, or changed rule is reported with the share
+of traffic it serves, together with the total share of traffic whose routing
+outcome (backend or filters) changes.
+
+--query must return an instant vector with one series per method/path (and
+optionally host), for example:
+
+  sum by (method, path) (rate(http_requests_total[1h]))
+
+Set PROMETHEUS_TOKEN to send a bearer token.`,
+		RunE: runImpact,
+	}
+	cmd.Flags().StringVarP(&serviceName, "service", "s", "my-service", "Default backend service name")
+	cmd.Flags().IntVarP(&servicePort, "port", "p", 80, "Default backend service port")
+	cmd.Flags().StringVar(&impactBase, "base", "", "Directory or CSV file of the inventory before the change")
+	cmd.Flags().StringVar(&prometheusURL, "prometheus", "", "Base URL of the Prometheus API")
+	cmd.Flags().StringVar(&prometheusQuery, "query", "", "PromQL instant query returning request rates per method and path")
+	cmd.Flags().StringVar(&impactMethodKey, "method-label", "method", "Series label holding the request method")
+	cmd.Flags().StringVar(&impactPathKey, "path-label", "path", "Series label holding the request path")
+	cmd.Flags().StringVar(&impactHostKey, "host-label", "host", "Series label holding the request host, if any")
+	addGenerateFlags(cmd.Flags(), "generated")
+	_ = cmd.MarkFlagRequired("base")
+	_ = cmd.MarkFlagRequired("prometheus")
+	_ = cmd.MarkFlagRequired("query")
+	return cmd
+}
+
+// trafficSample is one Prometheus series interpreted as a request class.
+type trafficSample struct {
+	Request simRequest
+	Rate    float64
+}
+
+// ruleChange is a rule that differs between the base and new inventory.
+type ruleChange struct {
+	Kind string
+	Rule *simRule
+	Rate float64
+}
+
+func runImpact(cmd *cobra.Command, args []string) error {
+	if err := prepareGeneration(cmd.Context()); err != nil {
+		return err
+	}
+	newTable, err := loadRoutingTable(cmd.Context())
+	if err != nil {
+		return err
+	}
+	input := inputDir
+	inputDir = impactBase
+	oldTable, err := loadRoutingTable(cmd.Context())
+	inputDir = input
+	if err != nil {
+		return fmt.Errorf("base: %w", err)
+	}
+
+	samples, err := queryTraffic(cmd.Context())
+	if err != nil {
+		return err
+	}
+
+	var total, moved float64
+	oldRate := make(map[*simRule]float64)
+	newRate := make(map[*simRule]float64)
+	for _, s := range samples {
+		total += s.Rate
+		before := oldTable.match(s.Request)
+		after := newTable.match(s.Request)
+		if before != nil {
+			oldRate[before] += s.Rate
+		}
+		if after != nil {
+			newRate[after] += s.Rate
+		}
+		if ruleOutcome(before) != ruleOutcome(after) {
+			moved += s.Rate
+		}
+	}
+
+	changes := diffRules(oldTable.rules, newTable.rules)
+	for i := range changes {
+		if changes[i].Kind == "removed" {
+			changes[i].Rate = oldRate[changes[i].Rule]
+		} else {
+			changes[i].Rate = newRate[changes[i].Rule]
+		}
+	}
+	sort.SliceStable(changes, func(i, j int) bool { return changes[i].Rate > changes[j].Rate })
+
+	fmt.Printf("Series:          %d\n", len(samples))
+	fmt.Printf("Traffic:         %.2f\n", total)
+	fmt.Printf("Outcome changes: %.2f (%s)\n", moved, share(moved, total))
+	fmt.Printf("Changed rules:   %d\n", len(changes))
+	for _, c := range changes {
+		fmt.Printf("  %-8s %7s  %s\n", c.Kind, share(c.Rate, total), c.Rule)
+	}
+	return nil
+}
+
+func share(part, total float64) string {
+	if total == 0 {
+		return "0.0%"
+	}
+	return fmt.Sprintf("%.1f%%", 100*part/total)
+}
+
+// ruleKey identifies a rule across inventories by its route and matches, so
+// a rule whose backend changes is reported as changed rather than replaced.
+func ruleKey(r *simRule) string {
+	return r.Route + " " + r.matchesString()
+}
+
+// ruleOutcome describes what happens to a request served by r.
+func ruleOutcome(r *simRule) string {
+	if r == nil {
+		return "unmatched"
+	}
+	out, _ := json.Marshal(struct {
+		Filters     []map[string]any
+		BackendRefs []router.BackendRef
+	}{r.Rule.Filters, r.Rule.BackendRefs})
+	return string(out)
+}
+
+// diffRules classifies the rules added, removed, or changed between two
+// routing tables.
+func diffRules(oldRules, newRules []*simRule) []ruleChange {
+	old := make(map[string]*simRule)
+	for _, r := range oldRules {
+		old[ruleKey(r)] = r
+	}
+	var changes []ruleChange
+	seen := make(map[string]bool)
+	for _, r := range newRules {
+		key := ruleKey(r)
+		seen[key] = true
+		prev, ok := old[key]
+		switch {
+		case !ok:
+			changes = append(changes, ruleChange{Kind: "added", Rule: r})
+		case ruleOutcome(prev) != ruleOutcome(r):
+			changes = append(changes, ruleChange{Kind: "changed", Rule: r})
+		}
+	}
+	for _, r := range oldRules {
+		if !seen[ruleKey(r)] {
+			changes = append(changes, ruleChange{Kind: "removed", Rule: r})
+		}
+	}
+	return changes
+}
+
+// queryTraffic runs --query against Prometheus and turns each series of the
+// resulting vector into a traffic sample.
+func queryTraffic(ctx context.Context) ([]trafficSample, error) {
+	u, err := url.Parse(strings.TrimSuffix(prometheusURL, "/") + "/api/v1/query")
+	if err != nil {
+		return nil, fmt.Errorf("invalid --prometheus: %w", err)
+	}
+	u.RawQuery = url.Values{"query": {prometheusQuery}}.Encode()
+
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	if token := os.Getenv(prometheusTokenEnv); token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	var result struct {
+		Status string `json:"status"`
+		Error  string `json:"error"`
+		Data   struct {
+			ResultType string `json:"resultType"`
+			Result     []struct {
+				Metric map[string]string `json:"metric"`
+				Value  [2]any            `json:"value"`
+			} `json:"result"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(body, &result); err != nil {
+		return nil, fmt.Errorf("prometheus returned %s: %w", resp.Status, err)
+	}
+	if result.Status != "success" {
+		return nil, fmt.Errorf("prometheus query failed: %s", result.Error)
+	}
+	if result.Data.ResultType != "vector" {
+		return nil, fmt.Errorf("prometheus query returned a %s, want an instant vector", result.Data.ResultType)
+	}
+
+	var samples []trafficSample
+	for _, series := range result.Data.Result {
+		path, _, _ := strings.Cut(series.Metric[impactPathKey], "?")
+		if path == "" {
+			continue
+		}
+		value, _ := series.Value[1].(string)
+		rate, err := strconv.ParseFloat(value, 64)
+		if err != nil || math.IsNaN(rate) {
+			continue
+		}
+		method := strings.ToUpper(series.Metric[impactMethodKey])
+		if method == "" {
+			method = "GET"
+		}
+		samples = append(samples, trafficSample{
+			Request: simRequest{Method: method, Host: series.Metric[impactHostKey], Path: path},
+			Rate:    rate,
+		})
+	}
+	return samples, nil
+}
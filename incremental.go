@@ -0,0 +1,290 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime/debug"
+	"slices"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+// With --incremental a state file records the hash of every input file and
+// the files generated from it. Files unchanged since a run with the same
+// options and tool build are not processed again: their outputs are kept,
+// and the routes recorded for them feed the outputs aggregated over the run.
+
+var (
+	// incremental is --incremental: skip the input files unchanged since
+	// the last run.
+	incremental bool
+	// incrementalStateFile is --incremental-state (default
+	// <output>/.csv2httproute-state.json).
+	incrementalStateFile string
+)
+
+// incrementalStateName is the state file in --output by default.
+const incrementalStateName = ".csv2httproute-state.json"
+
+// incrementalInputFlags name files whose content, not just their path,
+// decides the generated routes.
+var incrementalInputFlags = []string{"config", "domain-map", "owners-file", "template"}
+
+// incrementalState is the content of the state file.
+type incrementalState struct {
+	// Fingerprint is the hash of the tool build and the options of the run.
+	// Every file is processed when it differs.
+	Fingerprint string                      `json:"fingerprint"`
+	Files       map[string]*incrementalFile `json:"files"`
+}
+
+// incrementalFile is the record of one input file processed without errors.
+type incrementalFile struct {
+	Hash    string   `json:"hash"`
+	Outputs []string `json:"outputs,omitempty"`
+	// Routes are the HTTPRoutes of the file, replayed into the run-wide
+	// outputs when the file is skipped.
+	Routes      []incrementalRoute `json:"routes,omitempty"`
+	RouteCount  int                `json:"routeCount"`
+	Rows        int                `json:"rows"`
+	SkippedRows int                `json:"skippedRows,omitempty"`
+	// Volatile files depend on more than their content: the time (cutover
+	// rows, rows in their grace period) or the other files (rows dropped
+	// or merged by --conflict-strategy and --duplicate-prefixes).
+	Volatile bool `json:"volatile,omitempty"`
+}
+
+type incrementalRoute struct {
+	Route     HTTPRoute  `json:"route"`
+	Endpoints []Endpoint `json:"endpoints"`
+}
+
+var (
+	// previousState is the state of the last run, nextState the one this
+	// run writes.
+	previousState, nextState *incrementalState
+	// recordingFile collects the routes of the file being processed.
+	recordingFile *incrementalFile
+	// sawCutover is set when the rows parsed since it was cleared had
+	// cutover_at times, which make the output depend on the current time.
+	sawCutover bool
+)
+
+// validateIncremental rejects --incremental where there are no kept output
+// files to skip regenerating.
+func validateIncremental() error {
+	if !incremental {
+		return nil
+	}
+	for _, spec := range sinkSpecs {
+		if name, _, _ := strings.Cut(spec, ":"); name == "files" || name == "git" {
+			return nil
+		}
+	}
+	return fmt.Errorf("--incremental needs the files or git sink, which keep the generated files between runs")
+}
+
+// incrementalStatePath is the state file of the run.
+func incrementalStatePath() string {
+	if incrementalStateFile != "" {
+		return incrementalStateFile
+	}
+	return filepath.Join(outputDir, incrementalStateName)
+}
+
+// loadIncrementalState reads the state of the last run. A missing,
+// unreadable or outdated state file leaves every file to be processed.
+func loadIncrementalState(cmd *cobra.Command) error {
+	previousState, nextState, recordingFile = nil, nil, nil
+	if !incremental {
+		return nil
+	}
+	fingerprint, err := incrementalFingerprint(cmd)
+	if err != nil {
+		return err
+	}
+	nextState = &incrementalState{Fingerprint: fingerprint, Files: make(map[string]*incrementalFile)}
+
+	data, err := os.ReadFile(incrementalStatePath())
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var state incrementalState
+	if err := json.Unmarshal(data, &state); err != nil {
+		fmt.Fprintf(os.Stderr, "WARNING: ignoring unreadable %s: %v\n", incrementalStatePath(), err)
+		return nil
+	}
+	if state.Fingerprint == fingerprint && !incrementalForcedFull() {
+		previousState = &state
+	}
+	return nil
+}
+
+// incrementalForcedFull reports whether options make every file depend on
+// more than the inputs, such as the state of the cluster or the other files.
+func incrementalForcedFull() bool {
+	return verifyImports || resolvePorts || unmanagedFromCluster || debugBundle != "" || shardByHostname || emitModel != ""
+}
+
+// incrementalFingerprint hashes the tool build, the flags given on the
+// command line and the content of the files they name.
+func incrementalFingerprint(cmd *cobra.Command) (string, error) {
+	h := sha256.New()
+	fmt.Fprintln(h, Version)
+	if info, ok := debug.ReadBuildInfo(); ok {
+		fmt.Fprintln(h, info.String())
+	}
+	var err error
+	cmd.Flags().Visit(func(f *pflag.Flag) {
+		if f.Name == "incremental-state" || f.Name == "quiet" {
+			return
+		}
+		fmt.Fprintf(h, "--%s=%s\n", f.Name, f.Value.String())
+		if slices.Contains(incrementalInputFlags, f.Name) && f.Value.String() != "" {
+			data, readErr := os.ReadFile(f.Value.String())
+			if readErr != nil && err == nil {
+				err = fmt.Errorf("failed to read --%s: %w", f.Name, readErr)
+			}
+			h.Write(data)
+		}
+	})
+	return hex.EncodeToString(h.Sum(nil)), err
+}
+
+// inputHash hashes the content of the input file at path and its schema
+// and settings sidecars.
+func inputHash(path string) (string, error) {
+	h := sha256.New()
+	data, err := readSourceFile(path)
+	if err != nil {
+		return "", err
+	}
+	h.Write(data)
+	for _, sidecar := range []struct{ kind, path string }{{"schema", sidecarSchemaPath(path)}, {"meta", sidecarMetaPath(path)}} {
+		data, err := readSourceFile(sidecar.path)
+		if err != nil && !os.IsNotExist(err) {
+			return "", err
+		}
+		if data != nil {
+			fmt.Fprintf(h, "\x00%s\x00", sidecar.kind)
+			h.Write(data)
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// processFile processes the input file at path, or with --incremental
+// keeps its outputs from the last run when it is unchanged.
+func processFile(ctx context.Context, path string) error {
+	if nextState == nil {
+		return processCSV(ctx, path)
+	}
+	hash, err := inputHash(path)
+	if err != nil {
+		return err
+	}
+	if prev := unchangedFile(path, hash); prev != nil {
+		nextState.Files[path] = prev
+		return replayFile(path, prev)
+	}
+
+	record := &incrementalFile{Hash: hash}
+	written, routes, rows := len(writtenFiles), runMetrics.routes, runMetrics.rows
+	recordingFile, sawCutover = record, false
+	err = processCSV(ctx, path)
+	recordingFile = nil
+	if err != nil {
+		delete(nextState.Files, path)
+		return err
+	}
+	record.Outputs = uniqueFiles(writtenFiles[written:])
+	record.RouteCount = runMetrics.routes - routes
+	record.Rows = runMetrics.rows - rows
+	record.SkippedRows = runMetrics.skipped[path]
+	_, overridden := endpointOverrides[path]
+	record.Volatile = sawCutover || overridden || inGracePeriod(path)
+	nextState.Files[path] = record
+	return nil
+}
+
+// unchangedFile returns the record of the last run for path if the file can
+// be skipped: its hash is the same, its output did not depend on anything
+// else, no rows were moved to or from it in this run, and its outputs are
+// all still there.
+func unchangedFile(path, hash string) *incrementalFile {
+	if previousState == nil {
+		return nil
+	}
+	prev := previousState.Files[path]
+	if prev == nil || prev.Hash != hash || prev.Volatile {
+		return nil
+	}
+	if _, ok := endpointOverrides[path]; ok {
+		return nil
+	}
+	for _, out := range prev.Outputs {
+		if _, err := os.Stat(out); err != nil {
+			return nil
+		}
+	}
+	return prev
+}
+
+// recordIncrementalRoute records a route generated from the file being
+// processed.
+func recordIncrementalRoute(route HTTPRoute, endpoints []Endpoint) {
+	if recordingFile != nil {
+		recordingFile.Routes = append(recordingFile.Routes, incrementalRoute{Route: route, Endpoints: endpoints})
+	}
+}
+
+// replayFile counts a skipped file as if it was processed and hands its
+// routes and outputs to the run-wide outputs.
+func replayFile(path string, rec *incrementalFile) error {
+	writtenFiles = append(writtenFiles, rec.Outputs...)
+	runMetrics.routes += rec.RouteCount
+	runMetrics.rows += rec.Rows
+	recordSkippedRows(path, rec.SkippedRows)
+	for _, r := range rec.Routes {
+		checkFeatures(r.Route, r.Endpoints)
+		if err := collectRoute(r.Route, r.Endpoints, path); err != nil {
+			return err
+		}
+	}
+	if !quiet {
+		fmt.Printf("Unchanged %s, kept %d file(s)\n", path, len(rec.Outputs))
+	}
+	return nil
+}
+
+// inGracePeriod reports whether rows removed from path are still kept as
+// gone rules, which expire with time.
+func inGracePeriod(path string) bool {
+	if history == nil {
+		return false
+	}
+	entry := history.Files[csvBaseName(path)]
+	return entry != nil && len(entry.Removed) > 0
+}
+
+// saveIncrementalState writes the state of a completed run.
+func saveIncrementalState() error {
+	if nextState == nil {
+		return nil
+	}
+	data, err := json.MarshalIndent(nextState, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(incrementalStatePath(), append(data, '\n'), 0666)
+}
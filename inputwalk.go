@@ -0,0 +1,170 @@
+package main
+
+import (
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+var (
+	// recursive is --recursive: read the CSVs of the subdirectories of an
+	// --input directory too.
+	recursive bool
+	// namespaceFromDir is --namespace-from-dir: the routes of the CSVs in a
+	// subdirectory of the input go into the namespace named by its first
+	// directory.
+	namespaceFromDir bool
+)
+
+func validateInputWalk() error {
+	if namespaceFromDir && !recursive && !isGlob(inputDir) {
+		return fmt.Errorf("--namespace-from-dir needs --recursive or a glob --input")
+	}
+	if (recursive || isGlob(inputDir)) && sourceScheme(inputDir) != "" {
+		return fmt.Errorf("--recursive and glob patterns need a local --input, not %s", inputDir)
+	}
+	return nil
+}
+
+// isGlob reports whether an --input value is a glob pattern rather than a
+// path.
+func isGlob(spec string) bool {
+	return sourceScheme(spec) == "" && strings.ContainsAny(spec, "*?[")
+}
+
+// globRoot is the directory a glob pattern is matched below: its leading
+// segments without wildcards.
+func globRoot(pattern string) string {
+	segments := strings.Split(filepath.ToSlash(pattern), "/")
+	for i, s := range segments {
+		if !strings.ContainsAny(s, "*?[") {
+			continue
+		}
+		switch root := strings.Join(segments[:i], "/"); {
+		case root != "":
+			return filepath.FromSlash(root)
+		case i > 0:
+			return string(filepath.Separator)
+		}
+		return "."
+	}
+	return filepath.FromSlash(pattern)
+}
+
+// walkInputs lists the input files below root that match keep given their
+// slash-separated path relative to root, skipping hidden files and
+// directories and the output directory.
+func walkInputs(root string, keep func(rel string) bool) ([]string, error) {
+	var files []string
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if path != root && (strings.HasPrefix(d.Name(), ".") || d.IsDir() && filepath.Clean(path) == filepath.Clean(outputDir)) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if d.IsDir() || !isInputFile(d.Name()) {
+			return nil
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		if keep(filepath.ToSlash(rel)) {
+			files = append(files, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read input directory: %w", err)
+	}
+	return files, nil
+}
+
+// globFiles lists the input files matching pattern, where ** matches any
+// number of directories, as in 'facts/**/api-*.csv'.
+func globFiles(pattern string) ([]string, error) {
+	root := globRoot(pattern)
+	rest, _ := filepath.Rel(root, pattern)
+	if _, err := filepath.Match(filepath.ToSlash(rest), ""); err != nil {
+		return nil, fmt.Errorf("invalid --input pattern %q: %w", pattern, err)
+	}
+	segments := strings.Split(filepath.ToSlash(rest), "/")
+	return walkInputs(root, func(rel string) bool {
+		return matchSegments(segments, strings.Split(rel, "/"))
+	})
+}
+
+// matchSegments matches a path against a glob, segment by segment.
+func matchSegments(pattern, path []string) bool {
+	if len(pattern) == 0 {
+		return len(path) == 0
+	}
+	if pattern[0] == "**" {
+		for i := 0; i <= len(path); i++ {
+			if matchSegments(pattern[1:], path[i:]) {
+				return true
+			}
+		}
+		return false
+	}
+	if len(path) == 0 {
+		return false
+	}
+	ok, _ := filepath.Match(pattern[0], path[0])
+	return ok && matchSegments(pattern[1:], path[1:])
+}
+
+// inputSubdir is the directory of the input file at path relative to the
+// directory or glob it was found in, "" at its top level or for inputs that
+// are not walked.
+func inputSubdir(path string) string {
+	root := inputDir
+	switch {
+	case isGlob(inputDir):
+		root = globRoot(inputDir)
+	case !recursive:
+		return ""
+	}
+	rel, err := filepath.Rel(root, filepath.Dir(path))
+	if err != nil || rel == "." || strings.HasPrefix(rel, "..") {
+		return ""
+	}
+	return rel
+}
+
+// applyInputSubdir writes the outputs of a CSV found in a subdirectory of
+// the input into the same subdirectory of --output, so CSVs of the same
+// name in different directories do not overwrite each other, and sets
+// --namespace to its first directory with --namespace-from-dir. The
+// returned function restores both.
+func applyInputSubdir(path string) (func(), error) {
+	sub := inputSubdir(path)
+	if sub == "" {
+		return func() {}, nil
+	}
+	output, existing, ns := outputDir, existingOutputDir, namespace
+	restore := func() { outputDir, existingOutputDir, namespace = output, existing, ns }
+	if namespaceFromDir {
+		first, _, _ := strings.Cut(filepath.ToSlash(sub), "/")
+		if errs := validation.IsDNS1123Label(first); len(errs) > 0 {
+			return nil, fmt.Errorf("directory %q is not a namespace name for --namespace-from-dir: %s", first, strings.Join(errs, "; "))
+		}
+		namespace = first
+	}
+	outputDir = filepath.Join(outputDir, sub)
+	if existingOutputDir != "" {
+		existingOutputDir = filepath.Join(existingOutputDir, sub)
+	}
+	if err := ensureOutputDir(outputDir); err != nil {
+		restore()
+		return nil, fmt.Errorf("failed to create output directory: %w", err)
+	}
+	return restore, nil
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/spf13/pflag"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+// Resources the tool reads from or writes to the cluster.
+var (
+	namespacesGVR = schema.GroupVersionResource{Version: "v1", Resource: "namespaces"}
+	servicesGVR   = schema.GroupVersionResource{Version: "v1", Resource: "services"}
+	configMapsGVR = schema.GroupVersionResource{Version: "v1", Resource: "configmaps"}
+	gatewaysGVR   = schema.GroupVersionResource{Group: "gateway.networking.k8s.io", Version: "v1", Resource: "gateways"}
+	httpRoutesGVR = schema.GroupVersionResource{Group: "gateway.networking.k8s.io", Version: "v1", Resource: "httproutes"}
+
+	serviceImportsGVR = schema.GroupVersionResource{Group: "multicluster.x-k8s.io", Version: "v1alpha1", Resource: "serviceimports"}
+)
+
+// kubeconfigPath and kubeContext are --kubeconfig and --context, which
+// override the kubeconfig file and context of every cluster access.
+var kubeconfigPath, kubeContext string
+
+// impersonateUser and impersonateGroups are --as and --as-group: the user
+// and groups every cluster request acts as, like kubectl's flags.
+var (
+	impersonateUser   string
+	impersonateGroups []string
+)
+
+// listPageSize is --page-size: the objects per page of the list requests, so
+// listing thousands of routes neither times out nor loads the API server
+// with one huge response. 0 lists everything at once.
+var listPageSize int64 = 500
+
+// labelSelector and fieldSelector are the --selector and --field-selector
+// of the subcommands reading objects from the cluster, like kubectl's.
+var labelSelector, fieldSelector string
+
+// The client-side rate limit of cluster requests, kubectl's, instead of the
+// 5 requests per second of client-go, which would take minutes to apply a
+// large inventory. API Priority and Fairness still protects the server.
+const (
+	clusterQPS   = 50
+	clusterBurst = 300
+)
+
+// kubeClientConfig resolves the kubeconfig context using the same rules as
+// kubectl (--kubeconfig, KUBECONFIG, then ~/.kube/config).
+func kubeClientConfig() clientcmd.ClientConfig {
+	rules := clientcmd.NewDefaultClientConfigLoadingRules()
+	rules.ExplicitPath = kubeconfigPath
+	overrides := &clientcmd.ConfigOverrides{CurrentContext: kubeContext}
+	overrides.AuthInfo.Impersonate = impersonateUser
+	overrides.AuthInfo.ImpersonateGroups = impersonateGroups
+	return clientcmd.NewNonInteractiveDeferredLoadingClientConfig(rules, overrides)
+}
+
+// validateImpersonation rejects groups without a user, which the API server
+// refuses to impersonate.
+func validateImpersonation() error {
+	if len(impersonateGroups) > 0 && impersonateUser == "" {
+		return fmt.Errorf("--as-group requires --as")
+	}
+	return nil
+}
+
+// addSelectorFlags registers --selector and --field-selector, selecting the
+// objects, what, a subcommand reads from the cluster.
+func addSelectorFlags(flags *pflag.FlagSet, what string) {
+	flags.StringVarP(&labelSelector, "selector", "l", "", "Label selector of the "+what+" read from the cluster (e.g. team=shop,env!=dev)")
+	flags.StringVar(&fieldSelector, "field-selector", "", "Field selector of the "+what+" read from the cluster (e.g. metadata.name!=legacy)")
+}
+
+// selectorOptions are the list options of --selector and --field-selector,
+// checked before they reach the API server.
+func selectorOptions() (metav1.ListOptions, error) {
+	if _, err := labels.Parse(labelSelector); err != nil {
+		return metav1.ListOptions{}, fmt.Errorf("invalid --selector: %w", err)
+	}
+	if _, err := fields.ParseSelector(fieldSelector); err != nil {
+		return metav1.ListOptions{}, fmt.Errorf("invalid --field-selector: %w", err)
+	}
+	return metav1.ListOptions{LabelSelector: labelSelector, FieldSelector: fieldSelector}, nil
+}
+
+func validatePageSize() error {
+	if listPageSize < 0 {
+		return fmt.Errorf("invalid --page-size %d (must be 0 for no pagination, or positive)", listPageSize)
+	}
+	return nil
+}
+
+// kubeDynamicClient returns a dynamic client for the current context and the
+// context's default namespace.
+func kubeDynamicClient() (dynamic.Interface, string, error) {
+	cc := kubeClientConfig()
+	cfg, err := cc.ClientConfig()
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to load kubeconfig: %w", err)
+	}
+	if offline {
+		if err := checkOfflineURL("cluster access", cfg.Host); err != nil {
+			return nil, "", err
+		}
+		cfg.Dial = offlineDial
+	}
+	if cfg.QPS == 0 {
+		cfg.QPS, cfg.Burst = clusterQPS, clusterBurst
+	}
+	ns, _, err := cc.Namespace()
+	if err != nil {
+		return nil, "", err
+	}
+	client, err := dynamic.NewForConfig(cfg)
+	if err != nil {
+		return nil, "", err
+	}
+	return client, ns, nil
+}
+
+// listObjects lists the gvr objects in namespace ("" for cluster-scoped
+// resources or all namespaces) selected by opts, in pages of --page-size,
+// retrying every page; what names them in the messages. When a listing
+// outlives the snapshot the API server keeps for it, the continue token
+// expires and the objects are listed again in one request, as the pager of
+// client-go does.
+func listObjects(ctx context.Context, client dynamic.Interface, gvr schema.GroupVersionResource, namespace string, opts metav1.ListOptions, what string) ([]unstructured.Unstructured, error) {
+	opts.Limit = listPageSize
+	var items []unstructured.Unstructured
+	for {
+		var list *unstructured.UnstructuredList
+		err := retryCluster(ctx, what, 30*time.Second, func(ctx context.Context) error {
+			var err error
+			list, err = client.Resource(gvr).Namespace(namespace).List(ctx, opts)
+			return err
+		})
+		if apierrors.IsResourceExpired(err) && opts.Continue != "" {
+			fmt.Fprintf(os.Stderr, "WARNING: listing %s took longer than the API server keeps the list, listing them again at once\n", what)
+			items, opts.Continue, opts.Limit = nil, "", 0
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, list.Items...)
+		if opts.Continue = list.GetContinue(); opts.Continue == "" {
+			return items, nil
+		}
+		if !quiet {
+			fmt.Fprintf(os.Stderr, "Listed %d %s so far\n", len(items), what)
+		}
+	}
+}
+
+// listNames returns the names of all gvr objects in namespace ("" for
+// cluster-scoped resources or all namespaces).
+func listNames(ctx context.Context, client dynamic.Interface, gvr schema.GroupVersionResource, namespace string) ([]string, error) {
+	items, err := listObjects(ctx, client, gvr, namespace, metav1.ListOptions{}, gvr.Resource)
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(items))
+	for _, item := range items {
+		names = append(names, item.GetName())
+	}
+	return names, nil
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+var (
+	// kustomize is --kustomize: write a kustomization.yaml listing the
+	// generated manifests, so the output directory is a kustomize base
+	// that kustomize build and Argo CD consume directly.
+	kustomize bool
+	// kustomizeNamespace and kustomizeLabels set the namespace and label
+	// transformers of the kustomization.
+	kustomizeNamespace string
+	kustomizeLabels    []string
+)
+
+// kustomizeLabelMap is the parsed --kustomize-label.
+var kustomizeLabelMap map[string]string
+
+type kustomization struct {
+	APIVersion string           `yaml:"apiVersion"`
+	Kind       string           `yaml:"kind"`
+	Namespace  string           `yaml:"namespace,omitempty"`
+	Labels     []kustomizeLabel `yaml:"labels,omitempty"`
+	Resources  []string         `yaml:"resources"`
+}
+
+// kustomizeLabel is a label transformer. Selectors are left alone, since
+// the generated objects select nothing.
+type kustomizeLabel struct {
+	Pairs map[string]string `yaml:"pairs"`
+}
+
+func validateKustomize() error {
+	if !kustomize && (kustomizeNamespace != "" || len(kustomizeLabels) > 0) {
+		return fmt.Errorf("--kustomize-namespace and --kustomize-label need --kustomize")
+	}
+	if kustomize && outputDir == streamOutput {
+		return fmt.Errorf("--kustomize needs an output directory, not --output -")
+	}
+	var err error
+	kustomizeLabelMap, err = parseLabelFlag("kustomize-label", kustomizeLabels)
+	return err
+}
+
+// writeKustomizationFile writes kustomization.yaml listing the manifests
+// written to the output directory in this run (or kept by --incremental),
+// relative to it. Files without Kubernetes objects, such as --template
+// output or the Backstage catalog, are left out, and so are patches: their
+// Services live elsewhere, and as resources they would replace them.
+func writeKustomizationFile() error {
+	k := kustomization{
+		APIVersion: "kustomize.config.k8s.io/v1beta1",
+		Kind:       "Kustomization",
+		Namespace:  kustomizeNamespace,
+		Resources:  []string{},
+	}
+	if len(kustomizeLabelMap) > 0 {
+		k.Labels = []kustomizeLabel{{Pairs: kustomizeLabelMap}}
+	}
+	outPath := outputPath("kustomization", ".yaml")
+	grants := false
+	for _, path := range uniqueFiles(writtenFiles) {
+		rel, err := filepath.Rel(outputDir, path)
+		ext := strings.ToLower(filepath.Ext(path))
+		if err != nil || strings.HasPrefix(rel, "..") || (ext != ".yaml" && ext != ".yml") || isPatchFile(path) || filepath.Clean(path) == filepath.Clean(outPath) {
+			continue
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		objects, err := manifestObjects(data)
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		if !slices.ContainsFunc(objects, func(o manifestObject) bool { return !strings.HasPrefix(o.APIVersion, "backstage.io/") }) {
+			continue
+		}
+		grants = grants || slices.ContainsFunc(objects, func(o manifestObject) bool { return o.Kind == "ReferenceGrant" })
+		k.Resources = append(k.Resources, filepath.ToSlash(rel))
+	}
+	slices.Sort(k.Resources)
+	if grants && kustomizeNamespace != "" {
+		fmt.Fprintf(os.Stderr, "WARNING: --kustomize-namespace also moves the ReferenceGrants into %s, but they only take effect in the namespaces of their backends\n", kustomizeNamespace)
+	}
+	if err := writeYAMLDocs(outPath, []any{k}); err != nil {
+		return err
+	}
+	if !quiet {
+		fmt.Printf("Generated %s\n", outPath)
+	}
+	return nil
+}
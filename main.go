@@ -1,89 +1,51 @@
 package main
 
 import (
-	"encoding/csv"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"io"
 	"os"
+	"os/signal"
 	"path/filepath"
+	"slices"
+	"strconv"
 	"strings"
+	"syscall"
+	"time"
 
+	"github.com/arencloud/csv2httproute/pkg/convert"
 	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	"gopkg.in/yaml.v3"
 )
 
-// HTTPRoute structs based on the CRD
-type HTTPRoute struct {
-	APIVersion string        `yaml:"apiVersion"`
-	Kind       string        `yaml:"kind"`
-	Metadata   Metadata      `yaml:"metadata"`
-	Spec       HTTPRouteSpec `yaml:"spec"`
-}
-
-type Metadata struct {
-	Name      string            `yaml:"name"`
-	Namespace string            `yaml:"namespace,omitempty"`
-	Labels    map[string]string `yaml:"labels,omitempty"`
-}
-
-type HTTPRouteSpec struct {
-	ParentRefs []ParentRef     `yaml:"parentRefs,omitempty"`
-	Hostnames  []string        `yaml:"hostnames,omitempty"`
-	Rules      []HTTPRouteRule `yaml:"rules,omitempty"`
-}
-
-type ParentRef struct {
-	Group     string `yaml:"group,omitempty"`
-	Kind      string `yaml:"kind,omitempty"`
-	Name      string `yaml:"name"`
-	Namespace string `yaml:"namespace,omitempty"`
-}
-
-type HTTPRouteRule struct {
-	Matches     []HTTPRouteMatch  `yaml:"matches,omitempty"`
-	Filters     []HTTPRouteFilter `yaml:"filters,omitempty"`
-	BackendRefs []BackendRef      `yaml:"backendRefs,omitempty"`
-}
-
-type HTTPRouteMatch struct {
-	Path   *HTTPPathMatch `yaml:"path,omitempty"`
-	Method string         `yaml:"method,omitempty"`
-}
-
-type HTTPPathMatch struct {
-	Type  string `yaml:"type,omitempty"`
-	Value string `yaml:"value,omitempty"`
-}
-
-type HTTPRouteFilter struct {
-	Type       string            `yaml:"type"`
-	URLRewrite *URLRewriteFilter `yaml:"urlRewrite,omitempty"`
-}
-
-type URLRewriteFilter struct {
-	Path *PathRewrite `yaml:"path,omitempty"`
-}
-
-type PathRewrite struct {
-	Type               string `yaml:"type,omitempty"`
-	ReplacePrefixMatch string `yaml:"replacePrefixMatch,omitempty"`
-}
-
-type BackendRef struct {
-	Group     string `yaml:"group,omitempty"`
-	Kind      string `yaml:"kind,omitempty"`
-	Name      string `yaml:"name"`
-	Namespace string `yaml:"namespace,omitempty"`
-	Port      int    `yaml:"port,omitempty"`
-	Weight    int    `yaml:"weight,omitempty"`
-}
-
-type Endpoint struct {
-	Method  string
-	URL     string
-	Prefix  string
-	Comment string
-}
+// The route model and the conversion live in pkg/convert; the command
+// wires its flags and inventory features into convert.Options.
+type (
+	HTTPRoute                 = convert.HTTPRoute
+	Metadata                  = convert.Metadata
+	HTTPRouteSpec             = convert.HTTPRouteSpec
+	ParentRef                 = convert.ParentRef
+	HTTPRouteRule             = convert.HTTPRouteRule
+	HTTPRouteMatch            = convert.HTTPRouteMatch
+	HTTPPathMatch             = convert.HTTPPathMatch
+	HTTPRouteFilter           = convert.HTTPRouteFilter
+	HTTPRequestRedirectFilter = convert.HTTPRequestRedirectFilter
+	HTTPHeaderFilter          = convert.HTTPHeaderFilter
+	HTTPHeader                = convert.HTTPHeader
+	URLRewriteFilter          = convert.URLRewriteFilter
+	PathRewrite               = convert.PathRewrite
+	BackendRef                = convert.BackendRef
+	HTTPRequestMirrorFilter   = convert.HTTPRequestMirrorFilter
+	LocalObjectReference      = convert.LocalObjectReference
+	Endpoint                  = convert.Endpoint
+)
 
 var (
 	Version = "v1.0.0"
@@ -95,253 +57,1320 @@ var (
 	serviceName      string
 	servicePort      int
 	serviceNamespace string
+	backendKind      string
+	backendGroup     string
 	gatewayName      string
 	gatewayNamespace string
 	namespace        string
 	hostname         string
+	failOnEmpty      bool
+	minRows          int
+	extraMethods     []string
+	otlpEndpoint     string
+	gatewayChannel   string
+	defaultBackend   string
+	noHeaderComment  bool
+	matchMapMode     string
+	requireMethod    bool
+	domainMapFile    string
+	templateFile     string
+	fileModeFlag     string
+	dirModeFlag      string
+	ownerFlag        string
+	quiet            bool
 )
 
+// errTooFewRows marks inputs that fall below the configured row thresholds.
+var errTooFewRows = errors.New("too few endpoint rows")
+
 func main() {
+	rootCmd := newRootCmd()
+
+	// SIGINT and SIGTERM cancel the context of the command, which stops
+	// between files and aborts cluster, network and external tool calls.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	err := rootCmd.ExecuteContext(ctx)
+	canceled := ctx.Err() != nil
+	stop()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		if canceled {
+			os.Exit(130)
+		}
+		os.Exit(1)
+	}
+}
+
+// newRootCmd returns the command line: the generating root command and its
+// subcommands, with their flags bound to the package variables.
+func newRootCmd() *cobra.Command {
 	var rootCmd = &cobra.Command{
 		Use:     "csv2httproute",
 		Short:   "Generate K8s HTTPRoute from CSV endpoints",
 		Version: Version,
 		RunE:    run,
+		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+			commandFlags = cmd.Flags()
+			if err := applyEnv(cmd); err != nil {
+				return err
+			}
+			if err := validateImpersonation(); err != nil {
+				return err
+			}
+			setupOffline()
+			if err := validatePageSize(); err != nil {
+				return err
+			}
+			return validateRetries()
+		},
 	}
 
-	rootCmd.Flags().StringVarP(&inputDir, "input", "i", "facts/endpoints", "Directory or CSV file to process")
-	rootCmd.Flags().StringVarP(&outputDir, "output", "o", "generated", "Output directory for YAML files")
 	rootCmd.Flags().StringVarP(&serviceName, "service", "s", "my-service", "Default backend service name")
 	rootCmd.Flags().IntVarP(&servicePort, "port", "p", 80, "Default backend service port")
 	rootCmd.Flags().StringVar(&serviceNamespace, "service-namespace", "", "Namespace for the backend service")
-	rootCmd.Flags().StringVarP(&gatewayName, "gateway", "g", "my-gateway", "Parent gateway name")
-	rootCmd.Flags().StringVar(&gatewayNamespace, "gateway-namespace", "", "Namespace for the parent gateway (defaults to --namespace)")
-	rootCmd.Flags().StringVarP(&namespace, "namespace", "n", "default", "Namespace for HTTPRoute")
-	rootCmd.Flags().StringVar(&hostname, "hostname", "", "Hostname for the HTTPRoute")
+	rootCmd.Flags().BoolVarP(&watchMode, "watch", "w", false, "Keep running and regenerate the outputs whenever the CSVs or conversion config files change")
+	rootCmd.Flags().BoolVar(&watchPreview, "watch-preview", false, "With --watch, print the diff of the outputs a change would produce and write them only once confirmed")
+	rootCmd.Flags().DurationVar(&watchConfirmAfter, "watch-confirm-after", 0, "With --watch-preview, write a previewed change left unanswered and unchanged this long (e.g. 10s)")
+	addGenerateFlags(rootCmd.Flags(), "generated")
+	rootCmd.PersistentFlags().StringVar(&kubeconfigPath, "kubeconfig", "", "Path to the kubeconfig file for cluster access (defaults to KUBECONFIG, then ~/.kube/config)")
+	rootCmd.PersistentFlags().StringVar(&kubeContext, "context", "", "Kubeconfig context for cluster access (defaults to the current context)")
+	rootCmd.PersistentFlags().StringVar(&impersonateUser, "as", "", "User to impersonate for cluster access")
+	rootCmd.PersistentFlags().StringArrayVar(&impersonateGroups, "as-group", nil, "Group to impersonate for cluster access, with --as (repeatable)")
+	rootCmd.PersistentFlags().IntVar(&clusterRetries, "retries", clusterRetries, "Retries of cluster requests failing transiently (conflicts, throttling, timeouts, server errors)")
+	rootCmd.PersistentFlags().Int64Var(&listPageSize, "page-size", listPageSize, "Objects per page of the cluster list requests (0 to list everything at once)")
+	rootCmd.PersistentFlags().DurationVar(&retryBackoff, "retry-backoff", retryBackoff, "Delay before the first retry of a cluster request, doubled for every further retry")
+	rootCmd.PersistentFlags().StringVar(&envFile, "env-file", defaultEnvFile, "Dotenv file of CSV2HTTPROUTE_* variables setting flags (and other variables), read when it exists; flags on the command line win")
+	rootCmd.PersistentFlags().BoolVar(&offline, "offline", false, "Refuse every connection but to loopback addresses, and the features needing the network, for air-gapped environments")
+	rootCmd.PersistentFlags().BoolVar(&noColor, "no-color", false, "Disable colored output (also off when stdout is not a terminal or NO_COLOR is set)")
 
-	if err := rootCmd.Execute(); err != nil {
-		fmt.Fprintln(os.Stderr, err)
-		os.Exit(1)
+	rootCmd.AddCommand(newMaintenanceCmd())
+	rootCmd.AddCommand(newInitCmd())
+	rootCmd.AddCommand(newSnapshotCmd())
+	rootCmd.AddCommand(newSimulateCmd())
+	rootCmd.AddCommand(newImpactCmd())
+	rootCmd.AddCommand(newUnusedCmd())
+	rootCmd.AddCommand(newSchemaCmd())
+	rootCmd.AddCommand(newRefactorCmd())
+	rootCmd.AddCommand(newCapacityCmd())
+	rootCmd.AddCommand(newBenchCmd())
+	rootCmd.AddCommand(newValidateCmd())
+	rootCmd.AddCommand(newDocsCmd())
+	rootCmd.AddCommand(newDiscoverCmd())
+	rootCmd.AddCommand(newScanCmd())
+	rootCmd.AddCommand(newVerifyCmd())
+	rootCmd.AddCommand(newDiffCmd())
+	rootCmd.AddCommand(newCompatCmd())
+	rootCmd.AddCommand(newExportCmd())
+	rootCmd.AddCommand(newAdoptCmd())
+	rootCmd.AddCommand(newVerifyClusterCmd())
+	rootCmd.AddCommand(newScrubCmd())
+	rootCmd.AddCommand(newServeCmd())
+	for _, cmd := range append([]*cobra.Command{rootCmd}, rootCmd.Commands()...) {
+		registerCompletions(cmd)
 	}
+	return rootCmd
+}
+
+// addGenerateFlags registers the flags shared by every command that converts
+// CSVs into routes. Backend flags are left to each command since their
+// meaning differs (maintenance swaps every backend for its own).
+func addGenerateFlags(flags *pflag.FlagSet, defaultOutput string) {
+	flags.StringVarP(&inputDir, "input", "i", "facts/endpoints", "Directory, CSV file or glob pattern (e.g. 'facts/**/api-*.csv') to process, - for stdin, or an http(s)://, s3://, gs://, git:: or configmap:// source")
+	flags.BoolVar(&recursive, "recursive", false, "Also read the CSVs in the subdirectories of the --input directory, writing their outputs to the same subdirectories of --output")
+	flags.BoolVar(&namespaceFromDir, "namespace-from-dir", false, "With --recursive or a glob --input, put the routes of CSVs in a subdirectory into the namespace named by its first directory")
+	flags.StringVar(&inputFormat, "input-format", formatCSV, "Format of the --input files: csv, openapi (OpenAPI 3 or Swagger 2 .yaml/.yml/.json documents), actuator (Spring Boot /actuator/mappings JSON), rails, django or aspnet (JSON route dumps), iis (web.config URL Rewrite rules), spring-gateway (Spring Cloud Gateway or Zuul application.yaml routes), or auto (CSVs, OpenAPI, and actuator mappings)")
+	flags.StringVarP(&outputDir, "output", "o", defaultOutput, "Output directory for YAML files, or - to write them to stdout as one multi-document stream")
+	gatewayName = "my-gateway"
+	flags.VarP(&gatewayFlag{}, "gateway", "g", "Parent gateway name, or name:namespace:sectionName; repeat to attach the routes to several gateways")
+	flags.StringVar(&backendKind, "backend-kind", "Service", "Kind of the backend referenced by every rule (e.g. ServiceImport)")
+	flags.StringVar(&backendGroup, "backend-group", "", "API group of --backend-kind (defaults for well-known kinds)")
+	flags.BoolVar(&multicluster, "multicluster", false, "Reference MCS ServiceImports instead of Services and validate them")
+	flags.BoolVar(&resolvePorts, "resolve-ports", false, "Look up the port names of the port column (e.g. http) in the Services of the cluster, before the ports of --config")
+	flags.BoolVar(&verifyImports, "verify-imports", false, "With --multicluster, check that every ServiceImport exists in the cluster and exposes the port")
+	flags.StringVar(&gatewayNamespace, "gateway-namespace", "", "Namespace for the parent gateway (defaults to --namespace)")
+	flags.StringVar(&gatewaySection, "section-name", "", "Listener of the parent gateways to attach to (sectionName of the parentRefs)")
+	flags.IntVar(&gatewayPort, "gateway-port", 0, "Listener port of the parent gateways to attach to (port of the parentRefs)")
+	flags.StringVarP(&namespace, "namespace", "n", "default", "Namespace for HTTPRoute")
+	flags.StringVar(&nameTemplate, "name-template", "", "Go template of the route names of each input, with .File, .Dir, .Namespace and .Service (e.g. '{{.Namespace}}-{{.File}}'); defaults to the file name without endpoints-")
+	flags.StringVar(&nameCollision, "name-collision", collisionError, "How a route named like another of the run is renamed: error, numeric-suffix (-2, -3, ...), hash-suffix (a hash of its input), or namespace-prefix")
+	flags.StringSliceVar(&routeLabels, "label", nil, "Label of every generated route as key=value (e.g. team=payments); repeat for several")
+	flags.StringArrayVar(&routeAnnotations, "annotation", nil, "Annotation of every generated route as key=value (e.g. argocd.argoproj.io/sync-wave=2); repeat for several")
+	flags.StringVar(&hostname, "hostname", "", "Hostname for the HTTPRoute")
+	flags.StringVar(&domainMapFile, "domain-map", "", "YAML file mapping prefixes to hostnames and gateways")
+	flags.StringVar(&configFile, "config", "", "YAML config file defining named conversion profiles, SLA tiers, port names, defaults, and per-CSV settings")
+	flags.StringVar(&defaultProfile, "profile", "", "Profile from --config applied to rows without a profile column")
+	flags.StringVar(&ownersFile, "owners-file", "", "YAML file mapping prefixes (and hostnames) to teams; rows under another team's prefix fail")
+	flags.StringVar(&defaultBackend, "default-backend", "", "Append a catch-all / rule routing unmatched traffic to svc:port")
+	flags.StringVar(&errorService, "error-service", "", "Route unmatched traffic to this error page service:port, with an X-Code: 404 request header")
+	flags.StringVar(&errorPageFile, "error-page", "", "Answer unmatched traffic with this page and status 404 through an Envoy Gateway HTTPRouteFilter")
+	flags.StringSliceVar(&errorCodes, "error-codes", nil, "With --error-page, also replace backend responses with these status codes or ranges by it (e.g. 404,500-599; Envoy Gateway)")
+	flags.StringVar(&templateFile, "template", "", "Render each route through this Go template instead of emitting YAML")
+	flags.BoolVar(&backstageCatalog, "backstage", false, "Also write a Backstage catalog-info.yaml with one API entity per route")
+	flags.StringVar(&backstageOwner, "backstage-owner", "unknown", "Owner of the generated Backstage API entities")
+	flags.StringVar(&backstageLifecycle, "backstage-lifecycle", "production", "Lifecycle of the generated Backstage API entities")
+	flags.StringVar(&backstageSystem, "backstage-system", "", "System the generated Backstage API entities belong to")
+	flags.StringVar(&rbacServiceAccount, "rbac-service-account", "", "Also write Role/RoleBindings letting [namespace/]name manage only the generated routes")
+	flags.BoolVar(&noReferenceGrants, "no-reference-grants", false, "Do not write a referencegrants.yaml with the ReferenceGrants that backends in other namespaces need")
+	flags.BoolVar(&createNamespaces, "create-namespaces", false, "Also write a namespaces.yaml with a Namespace for every namespace of the generated routes and backends")
+	flags.StringSliceVar(&namespaceLabels, "namespace-label", nil, "Label of the generated Namespaces as key=value (e.g. shared-gateway-access=true)")
+	flags.StringSliceVar(&existingNamespaces, "existing-namespace", nil, "Namespace created elsewhere that --create-namespaces leaves out")
+	flags.StringVar(&scaleInterceptor, "scale-to-zero-interceptor", "keda/keda-add-ons-http-interceptor-proxy:8080", "KEDA HTTP add-on interceptor serving scale_to_zero rows, as [namespace/]service:port")
+	flags.StringVar(&routeKind, "kind", kindHTTPRoute, "Route kind of rows without a protocol column: HTTPRoute, or GRPCRoute for inventories of gRPC methods")
+	flags.StringVar(&outputKind, "output-kind", outputHTTPRoute, "Manifests the routes are written as: httproute, ingress (networking.k8s.io/v1), or virtualservice (Istio)")
+	flags.StringVar(&ingressClass, "ingress-class", "", "ingressClassName of the Ingresses of --output-kind ingress (default: the cluster default class)")
+	flags.StringVar(&tlsPassthroughListener, "tls-passthrough-listener", "", "Gateway listener (sectionName) the TLSRoutes of tls=passthrough rows attach to")
+	flags.StringVar(&failoverMode, "failover", failoverWeighted, "How rows with a fallback column reach their standby backend: weighted, mirror, or envoy-gateway")
+	flags.IntVar(&failoverWeight, "failover-weight", 0, "Percent of traffic sent to fallback backends with --failover weighted (0 keeps them on standby)")
+	flags.StringVar(&rateLimits, "rate-limits", rateLimitsEnvoyGateway, "How the rate limits of the tiers from --config are enforced: envoy-gateway, or none")
+	flags.StringVar(&canaryService, "canary-service", "", "Canary service:port given --canary-weight percent of the traffic of every rule with a single Service backend")
+	flags.IntVar(&canaryWeight, "canary-weight", 0, "Percent of traffic sent to --canary-service (0 keeps it on standby)")
+	flags.IntVar(&scaleMaxReplicas, "scale-to-zero-max-replicas", 10, "Maximum replicas of the HTTPScaledObjects generated for scale_to_zero rows")
+	flags.StringVar(&signTool, "sign", "", "Write a detached signature for each generated file with cosign or gpg")
+	flags.StringVar(&signKey, "sign-key", "", "cosign private key or KMS URI, or GPG key id (default: keyless cosign / default GPG key)")
+	flags.StringVar(&pushOCI, "push-oci", "", "Push the generated manifests as a Flux-compatible OCI artifact to oci://registry/repository:tag")
+	flags.BoolVar(&applyRoutes, "apply", false, "Also server-side apply the generated manifests to the cluster of the kubeconfig context, in dependency order (same as --sink cluster)")
+	flags.DurationVar(&applyWait, "apply-wait", applyWait, "How long --apply waits for created Namespaces and the Gateways of the routes before applying what depends on them (0 to not wait)")
+	flags.IntVar(&applyBatchSize, "apply-batch", applyBatchSize, "Objects --apply applies at the same time, within each stage of dependencies")
+	flags.StringSliceVar(&applyContexts, "contexts", nil, "Kubeconfig contexts --apply applies the generated manifests to, one after the other, instead of --context")
+	flags.StringSliceVar(&sinkSpecs, "sink", sinkSpecs, "Destinations of the generated files: files (--output), cluster, stdout, archive:FILE.tgz, or git[:MESSAGE]; repeatable")
+	flags.StringVar(&ociTool, "oci-tool", ociFlux, "CLI pushing --push-oci artifacts: flux or oras")
+	flags.StringVar(&ociSource, "oci-source", "csv2httproute", "Source recorded in the metadata of pushed OCI artifacts, e.g. the inventory's git URL")
+	flags.StringVar(&fileModeFlag, "file-mode", "", "Octal permissions for generated files, applied exactly (default 0666 minus umask)")
+	flags.StringVar(&dirModeFlag, "dir-mode", "", "Octal permissions for created output directories (default 0777 minus umask)")
+	flags.StringVar(&ownerFlag, "owner", "", "Owner for generated files and directories as user[:group] (names or ids)")
+	flags.BoolVar(&noHeaderComment, "no-header-comment", false, "Omit the generation metadata comment at the top of each YAML file")
+	flags.IntVar(&yamlIndent, "yaml-indent", yamlIndent, "Spaces per indentation level of the generated YAML (2-8)")
+	flags.IntVar(&yamlFlowLists, "yaml-flow-lists", 0, "Write lists of at most this many scalars in flow style, as [a, b] (0 keeps every list in block style)")
+	flags.StringVar(&yamlQuotePaths, "yaml-quote-paths", yamlQuotePaths, "Quoting of path strings in the generated YAML: plain (only where needed), single, or double")
+	flags.StringVar(&splitBy, "split-by", splitFile, "HTTPRoutes per CSV: file (one), prefix (one per prefix group), or endpoint (one per row)")
+	flags.BoolVar(&shardByHostname, "shard-by-hostname", false, "Merge the routes of each hostname across all CSVs into one HTTPRoute named after the hostname")
+	flags.StringVar(&partitionBy, "partition-by", "", "Split routes and output subdirectories by a CSV column (owner)")
+	flags.BoolVar(&groupByVersion, "group-by-version", false, "Generate one route per API version (/v1/, /v2/, ...) found in the URLs")
+	flags.StringSliceVar(&versionBackends, "version-backend", nil, "Backend of an API version as version=service[:port], for rows without their own service")
+	flags.StringVar(&ruleStrategy, "strategy", strategyHybrid, "Rule sets to emit: prefix (rewriting prefix rules), exact (direct matches only), or hybrid (both)")
+	flags.BoolVar(&noDirectMatches, "no-direct-matches", false, "Omit the direct matches of rows that have a prefix (same as --strategy prefix)")
+	flags.StringVar(&directMatchType, "default-match-type", "PathPrefix", "Path match type of direct matches without a match_type column: PathPrefix, Exact, or RegularExpression")
+	flags.IntVar(&matchesPerRuleLimit, "max-matches-per-rule", convert.LegacyMatchesPerRule, "Split direct-match rules with more matches into several rules (at most 64, the Gateway API v1.2+ limit)")
+	flags.IntVar(&rulesPerRouteLimit, "max-rules-per-route", convert.MaxRulesPerRoute, "Shard routes with more rules into routes named -1, -2, ... (at most 16)")
+	flags.StringVar(&defaultTimeout, "default-timeout", "", "Request timeout of rows without a timeout column, e.g. 30s (rules.timeouts.request)")
+	flags.StringVar(&defaultBackendTimeout, "default-backend-timeout", "", "Timeout of each backend request of rows without a backend_timeout column (rules.timeouts.backendRequest)")
+	flags.StringVar(&defaultRetries, "default-retries", "", "Retries of rows without a retries column, as attempts[:backoff[:codes]] (experimental channel)")
+	flags.StringVar(&pathSyntax, "path-syntax", "plain", "Syntax of the URL column: plain, template (/users/{id}), glob (/static/**), or regex")
+	flags.StringVar(&duplicatePrefixMode, "duplicate-prefixes", duplicatesAllow, "Prefixes declared by several CSVs for one hostname/gateway: allow, fail, or merge into one route")
+	flags.StringVar(&conflictStrategy, "conflict-strategy", conflictsAllow, "Rows routing the same method and path to different backends: allow, first, last, error, skip, or prompt")
+	flags.StringSliceVar(&includeTags, "tags", nil, "Only generate the rows carrying one of these tags (tags column)")
+	flags.StringSliceVar(&excludeTags, "exclude-tags", nil, "Leave out the rows carrying one of these tags (tags column)")
+	flags.StringVar(&renderAt, "render-at", "", "Render the inventory as of this time (RFC 3339 or YYYY-MM-DD[THH:MM] in UTC), applying the cutover_at rows due by then (default now)")
+	flags.StringSliceVar(&filterOrder, "filter-order", nil, "Order of filters within a rule as a list of filter types (default URLRewrite,RequestHeaderModifier,...)")
+	flags.StringVar(&gracePeriodFlag, "grace-period", "", "Keep rows removed from a CSV as gone rules for this long (e.g. 14d), tracked in --history")
+	flags.StringVar(&historyFile, "history", "", "JSON file recording the rows of each run, for --grace-period")
+	flags.StringVar(&goneBackend, "gone-backend", "", "Backend (svc:port) answering removed rows during the grace period, e.g. one returning 410")
+	flags.StringVar(&goneRedirect, "gone-redirect", "", "Path removed rows redirect to during the grace period")
+	flags.BoolVar(&unmanagedFromCluster, "unmanaged-from-cluster", false, "Read the hand-written rules to keep from the cluster instead of the existing output files")
+	flags.StringVar(&matchMapMode, "match-map", matchMapNone, "Record which CSV lines produced each match: none, annotation, or file")
+	flags.BoolVar(&failOnEmpty, "fail-on-empty", false, "Fail when a CSV file (or the input directory) contains no endpoint rows")
+	flags.IntVar(&minRows, "min-rows", 0, "Fail when a CSV file contains fewer than N endpoint rows")
+	flags.StringVar(&provider, "provider", "", "Gateway implementation (e.g. envoy-gateway, istio); warn about route features it does not support")
+	flags.BoolVar(&featureReport, "feature-report", false, "Print the Gateway API features each generated route relies on")
+	flags.StringVar(&gatewayChannel, "channel", channelStandard, "Gateway API release channel of the target CRDs (standard or experimental)")
+	flags.StringVar(&gatewayAPIVersion, "gateway-api-version", defaultGatewayAPIVersion, "Gateway API release of the target CRDs (and those verify-cluster installs)")
+	flags.StringVar(&metricsFile, "metrics-file", "", "Write run metrics (routes generated, rows skipped, duration) to this OpenMetrics text file, e.g. for the node-exporter textfile collector")
+	flags.StringVar(&testVectorsFile, "test-vectors", "", "Write JSON test vectors (request and expected upstream request) for the rules with rewrites or header filters to this file")
+	flags.BoolVar(&strictInputs, "strict", false, "Fail CSVs with validate findings: invalid paths, URLs outside their prefix, duplicate rows, invalid hostnames, overlong resource names, or match values the HTTPRoute CRD rejects")
+	flags.BoolVar(&portability, "portability", false, "Warn about constructs whose behavior varies across Gateway API implementations: regular expression matches, header names differing only in case, rewrites combined with redirects, and weights above 1000")
+	flags.StringVar(&emitModel, "emit-model", "", "Write the parsed and normalized endpoint model behind the generated routes to this JSON file, for downstream tooling")
+	flags.StringVar(&grafanaDashboard, "grafana-dashboard", "", "Write a Grafana dashboard JSON with a row per generated HTTPRoute and a panel per rule to this file")
+	flags.StringVar(&grafanaTitle, "grafana-title", "HTTP routes", "Title of the --grafana-dashboard, from which its uid is derived")
+	flags.StringArrayVar(&grafanaQueries, "grafana-query", nil, "PromQL template of the panels of --grafana-dashboard, with {{.Kind}}, {{.Namespace}}, {{.Name}}, {{.Rule}}, {{.Hostname}} and {{.Paths}}; repeat for several (default: Envoy Gateway request rate by response code class)")
+	flags.BoolVar(&kustomize, "kustomize", false, "Also write a kustomization.yaml listing the generated manifests, so the output directory is a kustomize base")
+	flags.StringVar(&kustomizeNamespace, "kustomize-namespace", "", "Namespace transformer of the kustomization.yaml (with --kustomize)")
+	flags.StringSliceVar(&kustomizeLabels, "kustomize-label", nil, "Label transformer of the kustomization.yaml as key=value (with --kustomize)")
+	flags.StringVar(&resourceManifest, "resource-manifest", "", "Write a JSON inventory of the generated files and objects (kind, namespace, name, hash) to this file, for ownership tracking and pruning")
+	flags.StringVar(&debugBundle, "debug-bundle", "", "Write sanitized inputs, configuration, endpoint model and outputs to this .tgz for bug reports")
+	flags.BoolVar(&incremental, "incremental", false, "Only process the CSV files changed since the last run, tracked in --incremental-state; the outputs of the others are kept")
+	flags.StringVar(&incrementalStateFile, "incremental-state", "", "State file of --incremental recording the hash and outputs of every input file (default <output>/"+incrementalStateName+")")
+	flags.BoolVar(&prune, "prune", false, "Delete the generated files in --output whose source CSV is gone, or that their input no longer produces")
+	flags.BoolVar(&sortRules, "sort-rules", false, "Order rules by prefix, URL, method and matches instead of by first row, so reordering rows changes no output")
+	flags.BoolVar(&checkMode, "check", false, "Write nothing; list output files that are stale relative to the CSVs and fail if any")
+	flags.StringVar(&csvDelimiter, "delimiter", ",", "Field separator of the input CSVs: one character such as ; or |, or tab")
+	flags.StringSliceVar(&columnMap, "column-map", nil, "Header cells holding columns under other names, as column=header (e.g. method=verb,url=path); with --no-header, column=position from 1")
+	flags.BoolVar(&noHeader, "no-header", false, "The input CSVs have no header row; columns are method,url,prefix,comment by position, or as --column-map assigns them")
+	flags.IntVar(&concurrency, "concurrency", 0, "Input files read, fetched and decrypted in parallel (0 for one per CPU); conversion stays in input order")
+	flags.StringVar(&runReportFormat, "report", reportText, "Summary of the run: text (a line per failed file) or json (files, routes and failures on standard output)")
+	flags.BoolVarP(&quiet, "quiet", "q", false, "Do not print a line for every generated file")
+	flags.StringVar(&otlpEndpoint, "otlp-endpoint", "", "OTLP/HTTP endpoint URL for trace export (defaults to OTEL_EXPORTER_OTLP_* variables)")
+	flags.BoolVar(&requireMethod, "require-method", false, "Fail rows with an empty method instead of matching all methods")
+	flags.StringSliceVar(&extraMethods, "extra-methods", nil, "Additional HTTP methods to accept besides the RFC 9110 set, for --output-kind virtualservice (HTTPRoutes cannot match them)")
 }
 
 func run(cmd *cobra.Command, args []string) error {
-	if _, err := os.Stat(outputDir); os.IsNotExist(err) {
-		if err := os.MkdirAll(outputDir, 0755); err != nil {
-			return fmt.Errorf("failed to create output directory: %w", err)
+	if checkMode && watchMode {
+		return fmt.Errorf("--check and --watch are mutually exclusive")
+	}
+	if checkMode {
+		return runCheck(cmd, args)
+	}
+	if watchMode {
+		return runWatch(cmd, args)
+	}
+	if err := validateWatchPreview(); err != nil {
+		return err
+	}
+	return generateOnce(cmd)
+}
+
+// generateOnce runs one generation with its metrics file and debug bundle.
+func generateOnce(cmd *cobra.Command) error {
+	start := time.Now()
+	err := generate(cmd)
+	if metricsFile != "" {
+		if metricsErr := writeMetricsFile(start, err); metricsErr != nil && err == nil {
+			err = metricsErr
 		}
 	}
+	if debugBundle != "" {
+		if bundleErr := writeDebugBundle(cmd, err); bundleErr != nil && err == nil {
+			err = bundleErr
+		}
+	}
+	return err
+}
+
+// generate converts the selected CSV files into routes.
+func generate(cmd *cobra.Command) error {
+	if err := prepareGeneration(cmd.Context()); err != nil {
+		return err
+	}
 
-	info, err := os.Stat(inputDir)
+	shutdown, err := setupTracing(cmd.Context())
 	if err != nil {
-		return fmt.Errorf("failed to access input: %w", err)
+		return err
 	}
+	defer shutdown(context.Background())
 
-	if !info.IsDir() {
-		if !strings.HasSuffix(inputDir, ".csv") {
-			return fmt.Errorf("input file must be a CSV file")
-		}
-		return processCSV(inputDir)
+	ctx, span := tracer.Start(cmd.Context(), "run")
+	defer span.End()
+
+	if err := configureOutputPermissions(); err != nil {
+		return err
+	}
+	// The JSON report is the only output besides the routes
+	if runReportFormat == reportJSON {
+		wasQuiet := quiet
+		quiet = true
+		defer func() { quiet = wasQuiet }()
+	}
+	restoreOutput, err := openSinks()
+	if err != nil {
+		return err
+	}
+	defer restoreOutput()
+	if err := ensureOutputDir(outputDir); err != nil {
+		return fmt.Errorf("failed to create output directory: %w", err)
 	}
 
-	files, err := os.ReadDir(inputDir)
+	files, single, err := inputFiles(ctx)
 	if err != nil {
-		return fmt.Errorf("failed to read input directory: %w", err)
+		return err
+	}
+	fileFailures = nil
+	resetRouteNames()
+	prefetchInputs(ctx, files)
+	if err := resolveDuplicatePrefixes(ctx, files); err != nil {
+		return err
+	}
+	if err := resolveConflicts(ctx, files); err != nil {
+		return err
+	}
+	if err := loadIncrementalState(cmd); err != nil {
+		return err
+	}
+	if single {
+		if err := processFile(ctx, files[0]); err != nil && !reportFileError(files[0], err) {
+			recordFileFailure(files[0], err)
+			if reportErr := writeRunReport(1); reportErr != nil {
+				return reportErr
+			}
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return interrupted(1, 1, err)
+		}
+		if err := pruneRun(files); err != nil {
+			return err
+		}
+		return finishRun(ctx)
 	}
 
-	for _, file := range files {
-		if !file.IsDir() && strings.HasSuffix(file.Name(), ".csv") {
-			if err := processCSV(filepath.Join(inputDir, file.Name())); err != nil {
-				fmt.Printf("Error processing %s: %v\n", file.Name(), err)
+	for i, path := range files {
+		// Stop between files, so every written file is complete
+		if err := ctx.Err(); err != nil {
+			return interrupted(i, len(files), err)
+		}
+		if err := processFile(ctx, path); err != nil && !reportFileError(path, err) {
+			recordDebugError(path, err)
+			recordFileFailure(path, err)
+			if runReportFormat == reportText {
+				fmt.Printf("Error processing %s: %v\n", filepath.Base(path), err)
 			}
 		}
 	}
+	if err := writeRunReport(len(files)); err != nil {
+		return err
+	}
+	if err := pruneRun(files); err != nil {
+		return err
+	}
+	if err := finishRun(ctx); err != nil {
+		return err
+	}
+
+	if failOnEmpty && len(files) == 0 {
+		return fmt.Errorf("no CSV files found in %s", inputDir)
+	}
+	return filesFailed(len(files))
+}
+
+// interrupted is the error of a run canceled after done of total files. The
+// outputs aggregated over all files, signing, publishing and the history
+// are skipped, since they would describe a partial inventory.
+func interrupted(done, total int, err error) error {
+	return fmt.Errorf("interrupted after %d of %d CSV file(s), skipping the run-wide outputs: %w", done, total, err)
+}
+
+// finishRun writes the outputs aggregated over all files of a run.
+func finishRun(ctx context.Context) error {
+	if err := writeHostnameRoutes(ctx); err != nil {
+		return err
+	}
+	if backstageCatalog {
+		if err := writeBackstageCatalog(); err != nil {
+			return fmt.Errorf("failed to write Backstage catalog: %w", err)
+		}
+	}
+	if rbacServiceAccount != "" {
+		if err := writeRBAC(); err != nil {
+			return fmt.Errorf("failed to write RBAC manifests: %w", err)
+		}
+	}
+	if createNamespaces {
+		if err := writeNamespaces(); err != nil {
+			return fmt.Errorf("failed to write Namespace manifests: %w", err)
+		}
+	}
+	if errorPageFile != "" {
+		if err := writeErrorPages(); err != nil {
+			return fmt.Errorf("failed to write error pages: %w", err)
+		}
+	}
+	if !noReferenceGrants {
+		if err := writeReferenceGrants(); err != nil {
+			return fmt.Errorf("failed to write ReferenceGrants: %w", err)
+		}
+	}
+	if testVectorsFile != "" {
+		if err := writeTestVectors(); err != nil {
+			return fmt.Errorf("failed to write test vectors: %w", err)
+		}
+	}
+	if emitModel != "" {
+		if err := writeModel(); err != nil {
+			return fmt.Errorf("failed to write endpoint model: %w", err)
+		}
+	}
+	if grafanaDashboard != "" {
+		if err := writeGrafanaDashboard(); err != nil {
+			return fmt.Errorf("failed to write Grafana dashboard: %w", err)
+		}
+	}
+	if kustomize {
+		if err := writeKustomizationFile(); err != nil {
+			return fmt.Errorf("failed to write kustomization.yaml: %w", err)
+		}
+	}
+	if resourceManifest != "" {
+		if err := writeResourceManifest(); err != nil {
+			return fmt.Errorf("failed to write resource manifest: %w", err)
+		}
+	}
+	if signTool != "" {
+		if err := signOutputs(ctx); err != nil {
+			return err
+		}
+	}
+	if pushOCI != "" {
+		if err := pushBundle(ctx, outputDir); err != nil {
+			return err
+		}
+	}
+	if err := publishSinks(ctx); err != nil {
+		return err
+	}
+	if err := printFeatureReport(); err != nil {
+		return err
+	}
+	if err := saveHistory(); err != nil {
+		return fmt.Errorf("failed to write history: %w", err)
+	}
+	if err := saveIncrementalState(); err != nil {
+		return fmt.Errorf("failed to write incremental state: %w", err)
+	}
+	return nil
+}
+
+// prepareGeneration validates and loads the options shared by every command
+// that builds routes.
+func prepareGeneration(ctx context.Context) error {
+	if err := validateStreamOutput(); err != nil {
+		return err
+	}
+	if err := validateYAMLStyle(); err != nil {
+		return err
+	}
+	if err := validateChannel(gatewayChannel); err != nil {
+		return err
+	}
+	if err := validateGatewayAPIVersion(); err != nil {
+		return err
+	}
+	if err := validateKustomize(); err != nil {
+		return err
+	}
+	if err := validateRouteMetadata(); err != nil {
+		return err
+	}
+	if err := validateNames(); err != nil {
+		return err
+	}
+	if err := validateDialect(); err != nil {
+		return err
+	}
+	if err := validateConcurrency(); err != nil {
+		return err
+	}
+	if err := validateInputWalk(); err != nil {
+		return err
+	}
+	if err := validatePrune(); err != nil {
+		return err
+	}
+	if err := validateGrafana(); err != nil {
+		return err
+	}
+	if err := validateParentRefs(); err != nil {
+		return err
+	}
+	if err := validateRulePolicy(); err != nil {
+		return err
+	}
+	if err := validateInputFormat(inputFormat); err != nil {
+		return err
+	}
+	if err := validateRouteKind(routeKind); err != nil {
+		return err
+	}
+	if err := validateApplyContexts(); err != nil {
+		return err
+	}
+	if err := validateApplyBatch(); err != nil {
+		return err
+	}
+	if err := validateIncremental(); err != nil {
+		return err
+	}
+	if err := validateOutputKind(); err != nil {
+		return err
+	}
+	if err := validateShardByHostname(); err != nil {
+		return err
+	}
+	if err := validateTagFilters(); err != nil {
+		return err
+	}
+	if err := validateMatchMapMode(matchMapMode); err != nil {
+		return err
+	}
+	if err := validateSignTool(signTool); err != nil {
+		return err
+	}
+	if err := validatePushOCI(); err != nil {
+		return err
+	}
+	if err := validateDuplicatePrefixMode(duplicatePrefixMode); err != nil {
+		return err
+	}
+	if err := validateConflictStrategy(conflictStrategy); err != nil {
+		return err
+	}
+	if err := resolveStrategy(); err != nil {
+		return err
+	}
+	if err := loadPathSyntax(pathSyntax); err != nil {
+		return err
+	}
+	if err := validateFailover(); err != nil {
+		return err
+	}
+	if err := validateRateLimits(); err != nil {
+		return err
+	}
+	if err := validateCanary(); err != nil {
+		return err
+	}
+	if err := validateProvider(provider); err != nil {
+		return err
+	}
+	if err := validatePartitionBy(partitionBy); err != nil {
+		return err
+	}
+	if err := validateSplitBy(splitBy); err != nil {
+		return err
+	}
+	if err := loadFilterOrder(filterOrder); err != nil {
+		return err
+	}
+	if err := loadVersionBackends(versionBackends); err != nil {
+		return err
+	}
+	if err := loadNamespaceLabels(namespaceLabels); err != nil {
+		return err
+	}
+	if err := loadScaleInterceptor(scaleInterceptor); err != nil {
+		return err
+	}
+	if rbacServiceAccount != "" {
+		if _, _, err := parseServiceAccount(rbacServiceAccount); err != nil {
+			return err
+		}
+	}
+	if err := loadDomainMap(ctx, domainMapFile); err != nil {
+		return err
+	}
+	if err := loadOwnersFile(ctx, ownersFile); err != nil {
+		return err
+	}
+	if err := loadConfigFile(ctx, configFile); err != nil {
+		return err
+	}
+	if err := validateRouteLimits(); err != nil {
+		return err
+	}
+	if err := loadRenderAt(renderAt); err != nil {
+		return err
+	}
+	if err := loadHistory(); err != nil {
+		return err
+	}
+	if err := loadTemplate(ctx, templateFile); err != nil {
+		return err
+	}
+	if verifyImports && !multicluster {
+		return fmt.Errorf("--verify-imports requires --multicluster")
+	}
+	applyMulticlusterDefaults()
+	group, err := convert.ResolveBackendGroup(backendKind, backendGroup)
+	if err != nil {
+		return fmt.Errorf("invalid --backend-kind: %w", err)
+	}
+	backendGroup = group
+	if defaultBackend != "" {
+		if _, err := parseBackendSpec(defaultBackend); err != nil {
+			return fmt.Errorf("invalid --default-backend: %w", err)
+		}
+	}
+	if err := validateErrorPages(ctx); err != nil {
+		return err
+	}
+	return nil
+}
+
+// inputFiles lists the CSV files of the --input source. single reports that
+// --input named one file, whose errors should fail the run directly.
+func inputFiles(ctx context.Context) (files []string, single bool, err error) {
+	src, err := openSource(ctx, inputDir)
+	if err != nil {
+		return nil, false, err
+	}
+	return src.Files()
+}
+
+func processCSV(ctx context.Context, path string) error {
+	ctx, span := tracer.Start(ctx, "processCSV", trace.WithAttributes(attribute.String("csv.path", path)))
+	defer span.End()
+	restoreSettings, err := applyCSVSettings(ctx, path)
+	if err != nil {
+		return recordError(span, err)
+	}
+	defer restoreSettings()
+	restoreSubdir, err := applyInputSubdir(path)
+	if err != nil {
+		return recordError(span, err)
+	}
+	defer restoreSubdir()
+
+	_, parseSpan := tracer.Start(ctx, "parse")
+	endpoints, err := readEndpoints(ctx, path)
+	recordDebugEndpoints(path, endpoints)
+	parseSpan.SetAttributes(attribute.Int("csv.rows", len(endpoints)))
+	endSpan(parseSpan, err)
+	if err != nil {
+		return recordError(span, parseFailure{err})
+	}
 
+	_, validateSpan := tracer.Start(ctx, "validate")
+	err = checkRowThresholds(len(endpoints))
+	if err == nil {
+		err = checkOwnership(endpoints)
+	}
+	if err == nil {
+		err = lintRows(path, endpoints)
+	}
+	endSpan(validateSpan, err)
+	if err != nil {
+		return recordError(span, err)
+	}
+	endpoints = applyGracePeriod(path, endpoints, time.Now())
+	runMetrics.rows += len(endpoints)
+
+	endpoints, passthrough, err := splitPassthrough(endpoints)
+	if err == nil {
+		err = writeTLSRoutes(path, passthrough)
+	}
+	var grpcRows []Endpoint
+	if err == nil {
+		endpoints, grpcRows, err = splitGRPC(endpoints)
+	}
+	if err == nil {
+		err = checkOutputKindRows(passthrough, grpcRows)
+	}
+	if err == nil {
+		err = writeGRPCRoutes(path, grpcRows)
+	}
+	if err != nil {
+		return recordError(span, err)
+	}
+	if len(endpoints) == 0 {
+		return nil
+	}
+
+	_, buildSpan := tracer.Start(ctx, "build")
+	routes, err := buildRoutes(path, endpoints)
+	if err == nil {
+		routes, err = checkMatchValues(path, endpoints, routes)
+	}
+	buildSpan.SetAttributes(attribute.Int("routes", len(routes)))
+	endSpan(buildSpan, err)
+	if err != nil {
+		return recordError(span, err)
+	}
+
+	if shardByHostname {
+		routes = stashHostnameRoutes(path, routes)
+	}
+	for _, gr := range routes {
+		if err := emitRoute(ctx, gr, path); err != nil {
+			return recordError(span, err)
+		}
+	}
 	return nil
 }
 
-func processCSV(path string) error {
-	f, err := os.Open(path)
+// emitRoute validates and writes a route built from the CSV at path, with
+// its companion manifests, and hands it to the run-wide outputs.
+func emitRoute(ctx context.Context, gr generatedRoute, path string) error {
+	route := gr.Route
+	applyFileLabels(&route)
+	if err := applyRouteMetadata(&route.Metadata, gr.Endpoints); err != nil {
+		return err
+	}
+	if err := claimRouteName(&route.Metadata, path); err != nil {
+		return err
+	}
+	validateCtx, channelSpan := tracer.Start(ctx, "validate")
+	err := checkChannel(route)
+	if err == nil {
+		err = checkMethods(route)
+	}
+	if err == nil {
+		err = checkMulticluster(validateCtx, route)
+	}
+	if err == nil {
+		err = lintRoute(route.Metadata.Name, route.Spec.Hostnames, path)
+	}
+	if err == nil {
+		err = lintPortability(route, path)
+	}
+	endSpan(channelSpan, err)
 	if err != nil {
 		return err
 	}
-	defer f.Close()
 
-	reader := csv.NewReader(f)
-	reader.FieldsPerRecord = -1 // Allow variable number of fields
-	// Read header
-	header, err := reader.Read()
+	if err := annotateRuleDescriptions(&route); err != nil {
+		return err
+	}
+	if matchMapMode == matchMapAnnotation {
+		if err := annotateMatchMap(&route, path); err != nil {
+			return err
+		}
+	}
+
+	_, writeSpan := tracer.Start(ctx, "write")
+	var outPath string
+	err = ensureRouteDir(route.Metadata.Name)
+	if err == nil {
+		switch {
+		case routeTemplate != nil:
+			outPath, err = renderTemplate(route, gr.Endpoints, path)
+		case outputKind != outputHTTPRoute:
+			outPath, err = writeOutputKind(route, path)
+		default:
+			outPath, err = writeRoute(ctx, route, path)
+		}
+	}
+	if err == nil && matchMapMode == matchMapFile {
+		err = writeMatchMap(route, path)
+	}
+	if err == nil {
+		err = writeBackendHints(route, gr.Endpoints)
+	}
+	if err == nil {
+		err = writeScaleToZero(route, gr.Endpoints)
+	}
+	if err == nil {
+		err = writeFailover(route, gr.Endpoints)
+	}
+	if err == nil {
+		err = writeTrafficPolicy(route, gr.Endpoints)
+	}
+	endSpan(writeSpan, err)
 	if err != nil {
 		return err
 	}
 
-	headerMap := make(map[string]int)
-	for i, h := range header {
-		headerMap[strings.ToLower(strings.TrimSpace(h))] = i
+	runMetrics.routes++
+	checkFeatures(route, gr.Endpoints)
+	if !quiet {
+		printGenerated(outPath, route)
 	}
 
-	var endpoints []Endpoint
-	for {
-		record, err := reader.Read()
-		if err == io.EOF {
-			break
+	if err := collectRoute(route, gr.Endpoints, path); err != nil {
+		return err
+	}
+	recordIncrementalRoute(route, gr.Endpoints)
+	return nil
+}
+
+// collectRoute hands a generated route to the outputs aggregated over the
+// run.
+func collectRoute(route HTTPRoute, endpoints []Endpoint, path string) error {
+	if backstageCatalog {
+		if err := collectBackstageEntity(route, endpoints, path); err != nil {
+			return err
 		}
-		if err != nil {
+	}
+	if rbacServiceAccount != "" {
+		collectRBACRoute(route)
+	}
+	if createNamespaces {
+		collectNamespaces(route)
+	}
+	if errorPageFile != "" {
+		collectErrorPages(route)
+	}
+	if !noReferenceGrants && outputKind == outputHTTPRoute {
+		collectReferenceGrants(route)
+	}
+	if testVectorsFile != "" {
+		collectTestVectors(route)
+	}
+	if emitModel != "" {
+		collectModelRoute(kindHTTPRoute, route.Metadata, route.Spec.Hostnames, modelParents(route.Spec.ParentRefs), endpoints, path)
+	}
+	if grafanaDashboard != "" {
+		if err := collectGrafanaRow(route, path); err != nil {
 			return err
 		}
+	}
+	return nil
+}
+
+// parseCSV reads the endpoint rows of a single CSV file.
+func parseCSV(ctx context.Context, path string) ([]Endpoint, error) {
+	data, err := readInput(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+
+	schema, err := loadSidecarSchema(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+
+	// Spreadsheets often save CSVs with a UTF-8 byte order mark
+	data = bytes.TrimPrefix(data, []byte("\ufeff"))
+	reader := newCSVReader(bytes.NewReader(data))
+	// Read header; a completely empty file is treated as having no rows
+	header, err := reader.Read()
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	// An optional "#schema: N" row precedes the header
+	if version, ok, err := parseSchemaRow(header); err != nil {
+		return nil, err
+	} else if ok {
+		if schema == nil {
+			schema = &inventorySchema{}
+		} else if schema.Version != 0 && schema.Version != version {
+			return nil, fmt.Errorf("schema row declares version %d but %s declares %d", version, sidecarSchemaPath(path), schema.Version)
+		}
+		schema.Version = version
+		if header, err = reader.Read(); err != nil && err != io.EOF {
+			return nil, err
+		}
+	}
+	// Without a header the row read as one is the first endpoint row
+	var first []string
+	if noHeader && len(header) > 0 {
+		first, header = header, positionalHeader()
+	} else {
+		header = mapHeader(header)
+	}
+	if schema != nil {
+		if schema.Version == 0 {
+			schema.Version = currentSchemaVersion
+		}
+		if _, err := migrateHeader(schema.Version, header); err != nil {
+			return nil, err
+		}
+	}
+
+	headerMap := convert.ColumnIndex(header)
+	if schema != nil && len(header) > 0 {
+		if err := schema.checkColumns(header, headerMap); err != nil {
+			return nil, err
+		}
+	}
+	if _, ok := headerMap["url"]; !ok && len(header) > 0 {
+		err := fmt.Errorf("missing required column url")
+		if unknown := convert.UnknownColumns(header); unknown != "" {
+			err = fmt.Errorf("%w; unrecognized columns: %s", err, unknown)
+		}
+		return nil, err
+	}
+
+	var endpoints []Endpoint
+	var dirs directives
+	skipped := 0
+	for {
+		record := first
+		first = nil
+		if record == nil {
+			if record, err = reader.Read(); err == io.EOF {
+				break
+			} else if err != nil {
+				return nil, err
+			}
+		}
 
+		if isDirectiveRow(record) {
+			if err := dirs.apply(record); err != nil {
+				line, _ := reader.FieldPos(0)
+				return nil, fmt.Errorf("line %d: %w", line, err)
+			}
+			continue
+		}
 		if len(record) == 0 || (len(record) > 0 && strings.HasPrefix(strings.TrimSpace(record[0]), "#")) {
 			continue
 		}
 
-		endpoint := parseRecord(record, headerMap)
+		line, _ := reader.FieldPos(0)
+		if schema != nil {
+			if err := schema.checkRecord(record, headerMap); err != nil {
+				return nil, fmt.Errorf("line %d: %w", line, err)
+			}
+		}
+		endpoint, err := parseRecord(record, headerMap)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
 		if endpoint.URL == "" {
+			skipped++
 			continue
 		}
+		endpoint.Line = line
+		dirs.fill(&endpoint)
 		endpoints = append(endpoints, endpoint)
 	}
+	recordSkippedRows(path, skipped)
 
-	if len(endpoints) == 0 {
-		return nil
+	endpoints, err = resolvePortNames(context.Background(), endpoints)
+	if err != nil {
+		return nil, err
 	}
+	return applyTagFilters(applyCutovers(expandHostnames(endpoints))), nil
+}
 
-	baseName := strings.TrimSuffix(filepath.Base(path), ".csv")
-	// Clean up name for K8s resource
-	resourceName := strings.ReplaceAll(baseName, "endpoints-", "")
-	resourceName = strings.ReplaceAll(resourceName, "_", "-")
+// routeTarget describes the hostname and parent gateway a route attaches to.
+type routeTarget struct {
+	Hostname string
+	// Namespace is the namespace of the route, --namespace when empty.
+	Namespace        string
+	Gateway          string
+	GatewayNamespace string
+}
 
-	effectiveGatewayNamespace := gatewayNamespace
-	if effectiveGatewayNamespace == "" {
-		effectiveGatewayNamespace = namespace
+// defaultTarget is the target configured by --hostname and --gateway flags.
+func defaultTarget() routeTarget {
+	return routeTarget{
+		Hostname:         hostname,
+		Gateway:          gatewayName,
+		GatewayNamespace: gatewayNamespace,
 	}
+}
 
-	route := HTTPRoute{
-		APIVersion: "gateway.networking.k8s.io/v1",
-		Kind:       "HTTPRoute",
-		Metadata: Metadata{
-			Name:      resourceName,
-			Namespace: namespace,
-		},
-		Spec: HTTPRouteSpec{
-			ParentRefs: []ParentRef{
-				{
-					Group:     "gateway.networking.k8s.io",
-					Kind:      "Gateway",
-					Name:      gatewayName,
-					Namespace: effectiveGatewayNamespace,
-				},
-			},
-		},
+// generatedRoute pairs a built route with the endpoints it was built from.
+type generatedRoute struct {
+	Route     HTTPRoute
+	Endpoints []Endpoint
+}
+
+// buildRoutes assembles the HTTPRoutes for the endpoints parsed from path:
+// one for the default target plus one per --domain-map entry in use.
+func buildRoutes(path string, endpoints []Endpoint) ([]generatedRoute, error) {
+	resourceName, err := routeBaseName(path)
+	if err != nil {
+		return nil, err
+	}
+	profileGroups, err := partitionByProfile(endpoints)
+	if err != nil {
+		return nil, err
+	}
+	var routes []generatedRoute
+	for _, pg := range profileGroups {
+		profileName := resourceName
+		if pg.Name != "" && pg.Name != defaultProfile {
+			profileName = resourceName + "-" + pg.Name
+		}
+		tierGroups, err := partitionByTier(pg.Endpoints)
+		if err != nil {
+			return nil, err
+		}
+		for _, tg := range tierGroups {
+			tierName := profileName
+			if tg.Name != "" {
+				tierName = profileName + "-" + tg.Name
+			}
+			pg.Endpoints = tg.Endpoints
+			built, err := buildProfileRoutes(tierName, pg)
+			if err != nil {
+				return nil, err
+			}
+			routes = append(routes, built...)
+		}
 	}
+	return routes, nil
+}
 
-	if hostname != "" {
-		route.Spec.Hostnames = []string{hostname}
+// buildProfileRoutes builds the routes of the endpoints of one profile,
+// split by domain, owner, version, and --split-by.
+func buildProfileRoutes(resourceName string, pg profileGroup) ([]generatedRoute, error) {
+	var routes []generatedRoute
+	for _, group := range partitionByDomain(pg.Endpoints) {
+		domainName := resourceName
+		if group.Domain != nil {
+			domainName = resourceName + "-" + group.Domain.slug()
+		}
+		target := group.Target
+		if pg.Profile != nil {
+			target = pg.Profile.target(group)
+		}
+		for _, owned := range partitionByOwner(group.Endpoints) {
+			ownerName := domainName
+			slug := ownerSlug(owned.Owner)
+			if slug != "" {
+				ownerName = domainName + "-" + slug
+			}
+			for _, versioned := range partitionByVersion(owned.Endpoints) {
+				name := ownerName
+				if versioned.Version != "" {
+					name = ownerName + "-" + versioned.Version
+				}
+				route, err := buildRoute(name, target, versioned.Endpoints)
+				if err != nil {
+					return nil, err
+				}
+				if pg.Profile != nil {
+					pg.Profile.apply(&route)
+					orderFilters(&route)
+				}
+				for _, split := range splitRoute(generatedRoute{Route: route, Endpoints: versioned.Endpoints}) {
+					for _, shard := range shardRoute(split) {
+						if slug != "" {
+							partitionDirs[shard.Route.Metadata.Name] = slug
+						}
+						routes = append(routes, shard)
+					}
+				}
+			}
+		}
 	}
+	return routes, nil
+}
 
-	// Group endpoints by prefix
-	prefixGroups := make(map[string][]Endpoint)
-	var prefixes []string // To maintain order if needed, but map is fine for now
+// buildRoute assembles a single HTTPRoute named name for target.
+func buildRoute(name string, target routeTarget, endpoints []Endpoint) (HTTPRoute, error) {
+	opts := convertOptions()
+	opts.Hostname = target.Hostname
+	opts.Namespace = target.routeNamespace()
+	opts.Gateway = target.Gateway
+	opts.GatewayNamespace = target.GatewayNamespace
+	if !target.usesGatewayFlags() {
+		opts.SectionName, opts.Port, opts.ExtraParents = "", 0, nil
+	}
+	if defaultBackend != "" {
+		backend, err := parseBackendSpec(defaultBackend)
+		if err != nil {
+			return HTTPRoute{}, err
+		}
+		opts.CatchAll = &backend
+	}
+	if err := errorCatchAll(&opts); err != nil {
+		return HTTPRoute{}, err
+	}
+	if sortRules {
+		endpoints = sortedEndpoints(endpoints)
+	}
+	route, err := convert.Build(name, endpoints, opts)
+	if err != nil {
+		return HTTPRoute{}, err
+	}
+	route.Spec.Hostnames = routeHostnames(target, endpoints)
+	orderFilters(&route)
+	return route, nil
+}
 
-	for _, e := range endpoints {
-		if e.Prefix != "" {
-			if _, ok := prefixGroups[e.Prefix]; !ok {
-				prefixes = append(prefixes, e.Prefix)
-			}
-			prefixGroups[e.Prefix] = append(prefixGroups[e.Prefix], e)
-		}
-	}
-
-	// Create rules for prefixes
-	for _, prefix := range prefixes {
-		// Rule 1: Match Prefix and Rewrite to /
-		rule1 := HTTPRouteRule{
-			Matches: []HTTPRouteMatch{
-				{
-					Path: &HTTPPathMatch{
-						Type:  "PathPrefix",
-						Value: prefix,
-					},
-				},
-			},
-			Filters: []HTTPRouteFilter{
-				{
-					Type: "URLRewrite",
-					URLRewrite: &URLRewriteFilter{
-						Path: &PathRewrite{
-							Type:               "ReplacePrefixMatch",
-							ReplacePrefixMatch: "/",
-						},
-					},
-				},
-			},
-			BackendRefs: []BackendRef{
-				{
-					Group:     "",
-					Kind:      "Service",
-					Name:      serviceName,
-					Namespace: serviceNamespace,
-					Port:      servicePort,
-					Weight:    1,
-				},
-			},
-		}
-		route.Spec.Rules = append(route.Spec.Rules, rule1)
-	}
-
-	// Rule 2: Direct matches for all URLs (from all prefixes and no-prefix)
-	rule2 := HTTPRouteRule{
-		BackendRefs: []BackendRef{
-			{
-				Group:     "",
-				Kind:      "Service",
-				Name:      serviceName,
-				Namespace: serviceNamespace,
-				Port:      servicePort,
-				Weight:    1,
-			},
+// convertOptions maps the generation flags to convert.Options. The hooks
+// add the features of the command that go beyond the CSV columns.
+func convertOptions() convert.Options {
+	return convert.Options{
+		Namespace:        namespace,
+		Hostname:         hostname,
+		Gateway:          gatewayName,
+		GatewayNamespace: gatewayNamespace,
+		SectionName:      primarySection,
+		Port:             gatewayPort,
+		ExtraParents:     extraParents,
+		Service: BackendRef{
+			Group:     backendGroup,
+			Kind:      backendKind,
+			Name:      serviceName,
+			Namespace: serviceNamespace,
+			Port:      servicePort,
 		},
+		Strategy:          convert.Strategy(ruleStrategy),
+		DirectMatchType:   directMatchType,
+		MaxMatchesPerRule: matchesPerRuleLimit,
+		ExtraMethods:      extraMethods,
+		RequireMethod:     requireMethod,
+		Timeout:           defaultTimeout,
+		BackendTimeout:    defaultBackendTimeout,
+		Retries:           defaultRetries,
+		ResolveBackend:    backendFor,
+		CompilePath:       compilePath,
+		RuleKey:           directRuleKey,
+		DecorateRule:      decorateRule,
 	}
-	for _, e := range endpoints {
-		rule2.Matches = append(rule2.Matches, HTTPRouteMatch{
-			Path: &HTTPPathMatch{
-				Type:  "PathPrefix",
-				Value: e.URL,
-			},
-			Method: strings.ToUpper(e.Method),
-		})
-	}
-	route.Spec.Rules = append(route.Spec.Rules, rule2)
+}
 
-	outPath := filepath.Join(outputDir, resourceName+".yaml")
-	outFile, err := os.Create(outPath)
+// directRuleKey gives rows in their grace period and rows with different
+// fallbacks direct-match rules of their own.
+func directRuleKey(e Endpoint) string {
+	return fmt.Sprint(e.Gone, fallbackFor(e))
+}
+
+// decorateRule redirects the direct matches of gone rows with
+// --gone-redirect and adds the fallback backend of the rule's rows.
+func decorateRule(rule *HTTPRouteRule, prefix string, endpoints []Endpoint) error {
+	if prefix == "" {
+		if endpoints[0].Gone && goneRedirect != "" {
+			rule.BackendRefs = nil
+			// The gone redirect replaces the row's own redirect or rewrite.
+			rule.Filters = slices.DeleteFunc(rule.Filters, func(f HTTPRouteFilter) bool {
+				return f.Type == "RequestRedirect" || f.Type == "URLRewrite"
+			})
+			rule.Filters = append([]HTTPRouteFilter{goneFilter()}, rule.Filters...)
+		}
+		applyCanary(rule, endpoints)
+		applyFallback(rule, fallbackFor(endpoints[0]))
+		return nil
+	}
+	fallback, err := prefixFallback(prefix, endpoints)
 	if err != nil {
 		return err
 	}
-	defer outFile.Close()
+	applyCanary(rule, endpoints)
+	applyFallback(rule, fallback)
+	return nil
+}
 
-	encoder := yaml.NewEncoder(outFile)
-	encoder.SetIndent(2)
-	if err := encoder.Encode(route); err != nil {
-		return err
+// parseBackendSpec parses a "service:port" flag value into a Service
+// backend in --service-namespace. The port defaults to --port when omitted.
+func parseBackendSpec(spec string) (BackendRef, error) {
+	return convert.ParseBackend(spec, convertOptions())
+}
+
+// backendFor resolves the backend of an endpoint, falling back to the
+// --service and --port defaults for rows without their own columns.
+func backendFor(e Endpoint) BackendRef {
+	opts := convertOptions()
+	if b, ok := versionBackendMap[apiVersion(e)]; ok {
+		opts.Service.Name, opts.Service.Port = b.Name, b.Port
+	}
+	backend := convert.BackendFor(e, opts)
+	if e.ScaleToZero {
+		backend = interceptorTarget
+	}
+	if e.Gone && goneBackend != "" {
+		backend, _ = parseBackendSpec(goneBackend)
+	}
+	if inMaintenance(e) {
+		backend.Group, backend.Kind = "", "Service"
+		backend.Name = maintenanceService
+		backend.Port = maintenancePort
+	}
+	return backend
+}
+
+// backendsFor is the backendRefs of e: its backend, or those of its
+// backends column.
+func backendsFor(e Endpoint) []BackendRef {
+	return convert.BackendsOf(e, convertOptions())
+}
+
+// writeRoute encodes route into the output directory and returns the file
+// path. Unless --no-header-comment is set the document is prefixed with a
+// comment describing how it was generated from source.
+func writeRoute(ctx context.Context, route HTTPRoute, source string) (string, error) {
+	node, err := mergeUnmanaged(ctx, &route, func() (*yaml.Node, error) {
+		var node yaml.Node
+		return &node, node.Encode(route)
+	})
+	if err != nil {
+		return "", err
+	}
+	if !noHeaderComment {
+		header, err := headerComment(source)
+		if err != nil {
+			return "", err
+		}
+		node.HeadComment = header
+	}
+
+	outPath := outputPath(route.Metadata.Name, ".yaml")
+	outFile, err := createOutputFile(outPath)
+	if err != nil {
+		return "", err
+	}
+	defer outFile.Discard()
+
+	encoder := newYAMLEncoder(outFile)
+	if err := encoder.Encode(node); err != nil {
+		return "", err
 	}
+	return outPath, outFile.Close()
+}
+
+// headerComment describes the generator, source file, and command line of a
+// generated manifest. It contains no timestamps so unchanged inputs
+// regenerate byte-identical output.
+func headerComment(source string) (string, error) {
+	data, err := readSourceFile(source)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+
+	// Flags set from the environment are written out, so the command
+	// alone regenerates the file
+	command := append(slices.Clone(os.Args), envArgs...)
+	args := make([]string, len(command))
+	for i, a := range command {
+		if i == 0 {
+			a = strings.TrimSuffix(filepath.Base(a), ".exe")
+		}
+		if a == "" || strings.ContainsAny(a, " \t'\"") {
+			a = strconv.Quote(a)
+		}
+		args[i] = a
+	}
+
+	lines := []string{
+		fmt.Sprintf("Code generated by csv2httproute %s. DO NOT EDIT.", Version),
+		fmt.Sprintf("Source: %s (sha256:%s)", filepath.ToSlash(source), hex.EncodeToString(sum[:])),
+	}
+	// A served conversion has no command line that would regenerate it
+	if !serving {
+		lines = append(lines, "Regenerate with: "+strings.Join(args, " "))
+	}
+	return strings.Join(lines, "\n"), nil
+}
+
+// parseRecord reads one CSV row with the column and method flags.
+func parseRecord(record []string, headerMap map[string]int) (Endpoint, error) {
+	e, err := convert.ParseRecord(record, headerMap, convertOptions())
+	return e, withFlagHint(err)
+}
 
-	fmt.Printf("Generated %s\n", outPath)
+// checkRowThresholds enforces --fail-on-empty and --min-rows for a single file.
+func checkRowThresholds(rows int) error {
+	if failOnEmpty && rows == 0 {
+		return fmt.Errorf("no endpoint rows found: %w", errTooFewRows)
+	}
+	if minRows > 0 && rows < minRows {
+		return fmt.Errorf("found %d endpoint rows, expected at least %d: %w", rows, minRows, errTooFewRows)
+	}
 	return nil
 }
 
-func parseRecord(record []string, headerMap map[string]int) Endpoint {
-	e := Endpoint{}
-	if idx, ok := headerMap["method"]; ok && idx < len(record) {
-		e.Method = strings.TrimSpace(record[idx])
+// normalizeMethod checks a method against the standard methods and
+// --extra-methods; see convert.NormalizeMethod.
+func normalizeMethod(method string) (string, error) {
+	m, err := convert.NormalizeMethod(method, convertOptions())
+	return m, withFlagHint(err)
+}
+
+// checkMethods rejects a route written as an HTTPRoute that matches a
+// method of --extra-methods, which the API server would refuse.
+func checkMethods(route HTTPRoute) error {
+	if outputKind != outputHTTPRoute {
+		return nil
 	}
-	if idx, ok := headerMap["url"]; ok && idx < len(record) {
-		e.URL = strings.TrimSpace(record[idx])
+	for _, rule := range route.Spec.Rules {
+		for _, m := range rule.Matches {
+			if m.Method == "" || slices.Contains(convert.StandardMethods, m.Method) {
+				continue
+			}
+			err := fmt.Errorf("%w (only --output-kind %s can match it)", &convert.MethodError{Method: m.Method, Extra: true}, outputVirtualService)
+			if len(m.SourceLines) > 0 {
+				return fmt.Errorf("line %d: %w", m.SourceLines[0], err)
+			}
+			return err
+		}
 	}
-	if idx, ok := headerMap["prefix"]; ok && idx < len(record) {
-		e.Prefix = strings.TrimSpace(record[idx])
+	return nil
+}
+
+// withFlagHint points method errors at the flag that changes the outcome.
+func withFlagHint(err error) error {
+	var me *convert.MethodError
+	if !errors.As(err, &me) {
+		return err
 	}
-	if idx, ok := headerMap["comment"]; ok && idx < len(record) {
-		e.Comment = strings.TrimSpace(record[idx])
+	switch {
+	case me.Method == "":
+		return fmt.Errorf("%w (--require-method is set)", err)
+	case me.Suggestion == "":
+		return fmt.Errorf("%w (use --extra-methods to allow it)", err)
 	}
-	return e
+	return err
 }
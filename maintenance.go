@@ -0,0 +1,43 @@
+package main
+
+import (
+	"slices"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	maintenanceService  string
+	maintenancePort     int
+	maintenancePrefixes []string
+)
+
+func newMaintenanceCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "maintenance",
+		Short: "Generate HTTPRoutes with backends swapped to a maintenance service",
+		Long: `Regenerates the routes from the CSV inventory with every backend replaced by
+a maintenance service, producing the "site down" routing config in one step.
+
+With --prefix only rows under the given prefixes are swapped; all other rows keep
+their own Service/Port columns or fall back to --live-service and --live-port.`,
+		RunE: run,
+	}
+
+	cmd.Flags().StringVarP(&maintenanceService, "service", "s", "", "Maintenance backend service name")
+	cmd.Flags().IntVarP(&maintenancePort, "port", "p", 80, "Maintenance backend service port")
+	cmd.Flags().StringSliceVar(&maintenancePrefixes, "prefix", nil, "Only swap rows under these prefixes (repeatable)")
+	cmd.Flags().StringVar(&serviceName, "live-service", "my-service", "Backend for rows that are not swapped")
+	cmd.Flags().IntVar(&servicePort, "live-port", 80, "Backend port for rows that are not swapped")
+	addGenerateFlags(cmd.Flags(), "generated-maintenance")
+	_ = cmd.MarkFlagRequired("service")
+	return cmd
+}
+
+// inMaintenance reports whether e should be routed to the maintenance service.
+func inMaintenance(e Endpoint) bool {
+	if maintenanceService == "" {
+		return false
+	}
+	return len(maintenancePrefixes) == 0 || slices.Contains(maintenancePrefixes, e.Prefix)
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+)
+
+// Values accepted by --match-map.
+const (
+	matchMapNone       = "none"
+	matchMapAnnotation = "annotation"
+	matchMapFile       = "file"
+)
+
+// matchMapAnnotationKey is the route annotation holding the match map.
+const matchMapAnnotationKey = "csv2httproute/match-map"
+
+// matchMap links every match of a route back to the CSV lines that produced
+// it: Rules[i][j] lists the source lines of match j in rule i. Matches not
+// derived from a row (such as the default backend) have no lines.
+type matchMap struct {
+	Source string    `json:"source"`
+	Rules  [][][]int `json:"rules"`
+}
+
+func validateMatchMapMode(mode string) error {
+	switch mode {
+	case matchMapNone, matchMapAnnotation, matchMapFile:
+		return nil
+	}
+	return fmt.Errorf("invalid --match-map %q (must be %s, %s, or %s)", mode, matchMapNone, matchMapAnnotation, matchMapFile)
+}
+
+func buildMatchMap(route HTTPRoute, source string) matchMap {
+	m := matchMap{Source: filepath.ToSlash(source)}
+	for _, rule := range route.Spec.Rules {
+		lines := make([][]int, len(rule.Matches))
+		for j, match := range rule.Matches {
+			lines[j] = match.SourceLines
+			if lines[j] == nil {
+				lines[j] = []int{}
+			}
+		}
+		m.Rules = append(m.Rules, lines)
+	}
+	return m
+}
+
+// annotateMatchMap stores the compact match map as a route annotation.
+func annotateMatchMap(route *HTTPRoute, source string) error {
+	data, err := json.Marshal(buildMatchMap(*route, source))
+	if err != nil {
+		return err
+	}
+	if route.Metadata.Annotations == nil {
+		route.Metadata.Annotations = map[string]string{}
+	}
+	route.Metadata.Annotations[matchMapAnnotationKey] = string(data)
+	return nil
+}
+
+// writeMatchMap writes the match map to a <route>.matchmap.json sidecar file
+// next to the route manifest.
+func writeMatchMap(route HTTPRoute, source string) error {
+	data, err := json.Marshal(buildMatchMap(route, source))
+	if err != nil {
+		return err
+	}
+	path := outputPath(route.Metadata.Name, ".matchmap.json")
+	return writeOutputFile(path, append(data, '\n'))
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"unicode"
+
+	"github.com/arencloud/csv2httproute/pkg/convert"
+)
+
+// matchValueProblem describes what makes the value of a match, what names
+// it, unacceptable to the HTTPRoute CRD: more than max bytes or a control
+// character. It returns "" for a valid value.
+func matchValueProblem(what, value string, max int) string {
+	if len(value) > max {
+		return fmt.Sprintf("%s %q... is %d bytes, more than the %d Gateway API allows", what, value[:40], len(value), max)
+	}
+	if i := strings.IndexFunc(value, unicode.IsControl); i >= 0 {
+		return fmt.Sprintf("%s %q contains the control character %U", what, value, []rune(value[i:])[0])
+	}
+	return ""
+}
+
+// matchProblems lists the problems of the values of m.
+func matchProblems(m HTTPRouteMatch) []string {
+	var problems []string
+	add := func(what, value string, max int) {
+		if p := matchValueProblem(what, value, max); p != "" {
+			problems = append(problems, p)
+		}
+	}
+	if m.Path != nil {
+		add("path", m.Path.Value, convert.MaxPathValue)
+	}
+	for _, h := range m.Headers {
+		add("header name", h.Name, convert.MaxHeaderName)
+		add("header "+h.Name+" value", h.Value, convert.MaxHeaderValue)
+	}
+	for _, q := range m.QueryParams {
+		add("query parameter name", q.Name, convert.MaxQueryParamName)
+		add("query parameter "+q.Name+" value", q.Value, convert.MaxQueryParamValue)
+	}
+	return problems
+}
+
+// checkMatchValues finds the matches of the routes built from the rows of
+// path whose values the HTTPRoute CRD would reject at apply time: overlong
+// paths, header and query parameter values, and control characters. The
+// validate report lists them and --strict fails the file; otherwise the
+// rows behind them are skipped with a warning and the routes are built
+// again from the others.
+func checkMatchValues(path string, endpoints []Endpoint, routes []generatedRoute) ([]generatedRoute, error) {
+	var findings []finding
+	bad := make(map[int]bool)
+	for _, gr := range routes {
+		for _, rule := range gr.Route.Spec.Rules {
+			for _, m := range rule.Matches {
+				for _, p := range matchProblems(m) {
+					line := 0
+					if len(m.SourceLines) == 1 {
+						line = m.SourceLines[0]
+					}
+					findings = append(findings, finding{File: path, Line: line, Check: checkMatchValue, Message: p})
+					for _, l := range m.SourceLines {
+						bad[l] = true
+					}
+				}
+			}
+		}
+	}
+	if len(findings) == 0 {
+		return routes, nil
+	}
+	if validationRun != nil || strictInputs {
+		return routes, reportFindings(findings)
+	}
+
+	for _, f := range findings {
+		fmt.Fprintf(os.Stderr, "WARNING: %s, skipping its rows\n", f)
+	}
+	kept := slices.DeleteFunc(slices.Clone(endpoints), func(e Endpoint) bool { return bad[e.Line] })
+	runMetrics.skipped[path] += len(endpoints) - len(kept)
+	runMetrics.rows -= len(endpoints) - len(kept)
+	if len(kept) == 0 {
+		return nil, nil
+	}
+	return buildRoutes(path, kept)
+}
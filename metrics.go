@@ -0,0 +1,77 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// metricsFile is --metrics-file: an OpenMetrics text file describing the
+// run, for the node-exporter textfile collector.
+var metricsFile string
+
+// runMetrics counts what a generation run did. Rows skipped are keyed by
+// path since a CSV may be parsed more than once per run.
+var runMetrics = struct {
+	routes      int
+	rows        int
+	failedFiles int
+	skipped     map[string]int
+}{skipped: make(map[string]int)}
+
+func recordSkippedRows(path string, n int) {
+	runMetrics.skipped[path] = n
+}
+
+// writeMetricsFile writes the metrics of the run that started at start and
+// ended with err. The file is replaced atomically so the collector never
+// reads a partial one.
+func writeMetricsFile(start time.Time, err error) error {
+	skipped := 0
+	for _, n := range runMetrics.skipped {
+		skipped += n
+	}
+	success := 1
+	if err != nil {
+		success = 0
+	}
+	var b strings.Builder
+	for _, m := range []struct {
+		name, help string
+		value      any
+	}{
+		{"csv2httproute_routes_generated", "Routes written by the last run.", runMetrics.routes},
+		{"csv2httproute_rows_processed", "Endpoint rows converted by the last run.", runMetrics.rows},
+		{"csv2httproute_rows_skipped", "CSV rows without a URL skipped by the last run.", skipped},
+		{"csv2httproute_files_failed", "CSV files that failed to convert in the last run.", runMetrics.failedFiles},
+		{"csv2httproute_last_run_success", "Whether the last run succeeded (1) or failed (0).", success},
+		{"csv2httproute_last_run_duration_seconds", "Duration of the last run.", time.Since(start).Seconds()},
+		{"csv2httproute_last_run_timestamp_seconds", "Unix time the last run finished.", time.Now().Unix()},
+	} {
+		fmt.Fprintf(&b, "# HELP %s %s\n# TYPE %s gauge\n%s %v\n", m.name, m.help, m.name, m.name, m.value)
+	}
+	b.WriteString("# EOF\n")
+
+	tmp, err := os.CreateTemp(filepath.Dir(metricsFile), ".metrics-*")
+	if err != nil {
+		return fmt.Errorf("failed to write metrics file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.WriteString(b.String()); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write metrics file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write metrics file: %w", err)
+	}
+	// CreateTemp uses 0600; the collector usually runs as another user.
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return fmt.Errorf("failed to write metrics file: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), metricsFile); err != nil {
+		return fmt.Errorf("failed to write metrics file: %w", err)
+	}
+	return nil
+}
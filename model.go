@@ -0,0 +1,247 @@
+package main
+
+import (
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/arencloud/csv2httproute/pkg/convert"
+)
+
+// emitModel is --emit-model: a JSON file of the endpoint model the routes
+// were generated from, after directives, profiles, tag filters, cutovers,
+// conflict resolution and grouping into routes, for downstream tools such
+// as API portals and firewall rule generators.
+var emitModel string
+
+// modelRoutes collects the routes of the model during a run.
+var modelRoutes []modelRoute
+
+// modelDoc is the document written to --emit-model.
+type modelDoc struct {
+	Generator string       `json:"generator"`
+	Version   string       `json:"version"`
+	Routes    []modelRoute `json:"routes"`
+}
+
+// modelRoute is one generated route and the rows it serves.
+type modelRoute struct {
+	Kind       string           `json:"kind"`
+	Name       string           `json:"name"`
+	Namespace  string           `json:"namespace"`
+	Source     string           `json:"source"`
+	Hostnames  []string         `json:"hostnames,omitempty"`
+	ParentRefs []modelParentRef `json:"parentRefs"`
+	Endpoints  []modelEndpoint  `json:"endpoints"`
+}
+
+// modelEndpoint is one row with the defaults of the run filled in and its
+// backends resolved.
+type modelEndpoint struct {
+	Line            int               `json:"line"`
+	Method          string            `json:"method,omitempty"`
+	URL             string            `json:"url"`
+	MatchType       string            `json:"matchType,omitempty"`
+	PathSyntax      string            `json:"pathSyntax,omitempty"`
+	Prefix          string            `json:"prefix,omitempty"`
+	Description     string            `json:"description,omitempty"`
+	Headers         map[string]string `json:"headers,omitempty"`
+	QueryParams     map[string]string `json:"queryParams,omitempty"`
+	Accept          []string          `json:"accept,omitempty"`
+	ContentType     []string          `json:"contentType,omitempty"`
+	Cookie          map[string]string `json:"cookie,omitempty"`
+	Backends        []modelBackend    `json:"backends,omitempty"`
+	BackendProtocol string            `json:"backendProtocol,omitempty"`
+	Fallback        string            `json:"fallback,omitempty"`
+	Redirect        string            `json:"redirect,omitempty"`
+	Rewrite         string            `json:"rewrite,omitempty"`
+	Variant         string            `json:"variant,omitempty"`
+	CacheControl    string            `json:"cacheControl,omitempty"`
+	RequestHeaders  *modelHeaderEdits `json:"requestHeaders,omitempty"`
+	ResponseHeaders *modelHeaderEdits `json:"responseHeaders,omitempty"`
+	Timeout         string            `json:"timeout,omitempty"`
+	BackendTimeout  string            `json:"backendTimeout,omitempty"`
+	Retry           *modelRetry       `json:"retry,omitempty"`
+	Owner           string            `json:"owner,omitempty"`
+	Profile         string            `json:"profile,omitempty"`
+	Tier            string            `json:"tier,omitempty"`
+	Tags            []string          `json:"tags,omitempty"`
+	ScaleToZero     bool              `json:"scaleToZero,omitempty"`
+	Gone            bool              `json:"gone,omitempty"`
+	CutoverAt       *time.Time        `json:"cutoverAt,omitempty"`
+}
+
+// modelHeaderEdits are the header modifier columns of one direction.
+type modelHeaderEdits struct {
+	Set    map[string]string `json:"set,omitempty"`
+	Add    map[string]string `json:"add,omitempty"`
+	Remove []string          `json:"remove,omitempty"`
+}
+
+type modelRetry struct {
+	Attempts int    `json:"attempts"`
+	Backoff  string `json:"backoff,omitempty"`
+	Codes    []int  `json:"codes,omitempty"`
+}
+
+type modelParentRef struct {
+	Group     string `json:"group"`
+	Kind      string `json:"kind"`
+	Name      string `json:"name"`
+	Namespace string `json:"namespace"`
+	// SectionName and Port select the listener.
+	SectionName string `json:"sectionName,omitempty"`
+	Port        int    `json:"port,omitempty"`
+}
+
+type modelBackend struct {
+	Group     string `json:"group,omitempty"`
+	Kind      string `json:"kind"`
+	Name      string `json:"name"`
+	Namespace string `json:"namespace"`
+	Port      int    `json:"port,omitempty"`
+	Weight    int    `json:"weight"`
+}
+
+// collectModelRoute adds a route of kind with the endpoints it serves to
+// the model.
+func collectModelRoute(kind string, meta Metadata, hostnames []string, parentRefs []modelParentRef, endpoints []Endpoint, source string) {
+	r := modelRoute{
+		Kind:       kind,
+		Name:       meta.Name,
+		Namespace:  meta.Namespace,
+		Source:     source,
+		Hostnames:  hostnames,
+		ParentRefs: parentRefs,
+		Endpoints:  make([]modelEndpoint, 0, len(endpoints)),
+	}
+	for _, e := range endpoints {
+		r.Endpoints = append(r.Endpoints, modelEndpointOf(e, meta.Namespace))
+	}
+	modelRoutes = append(modelRoutes, r)
+}
+
+func modelEndpointOf(e Endpoint, routeNamespace string) modelEndpoint {
+	m := modelEndpoint{
+		Line:            e.Line,
+		Method:          e.Method,
+		URL:             e.URL,
+		MatchType:       e.MatchType,
+		Prefix:          e.Prefix,
+		Description:     e.Description,
+		Headers:         modelPairs(e.Headers),
+		QueryParams:     modelPairs(e.QueryParams),
+		Accept:          modelList(e.Accept),
+		ContentType:     modelList(e.ContentType),
+		Cookie:          modelPairs(e.Cookie),
+		BackendProtocol: e.BackendProtocol,
+		Fallback:        e.Fallback,
+		Redirect:        e.Redirect,
+		Rewrite:         e.Rewrite,
+		Variant:         e.Variant,
+		CacheControl:    e.CacheControl,
+		Owner:           e.Owner,
+		Profile:         e.Profile,
+		Tier:            e.Tier,
+		Tags:            e.Tags,
+		ScaleToZero:     e.ScaleToZero,
+		Gone:            e.Gone,
+		RequestHeaders:  modelEdits(e.RequestHeaders),
+		ResponseHeaders: modelEdits(e.ResponseHeaders),
+	}
+	// URLs without a match type are plain paths or in the --path-syntax.
+	if m.MatchType == "" {
+		if pathSyntax == "plain" {
+			m.MatchType = directMatchType
+		} else {
+			m.PathSyntax = pathSyntax
+		}
+	}
+	if !e.CutoverAt.IsZero() {
+		m.CutoverAt = &e.CutoverAt
+	}
+	// The default timeouts and retries only apply to HTTPRoutes.
+	if !grpcRow(e) && e.TLS != convert.TLSPassthrough {
+		m.Timeout, m.BackendTimeout = cmp.Or(e.Timeout, defaultTimeout), cmp.Or(e.BackendTimeout, defaultBackendTimeout)
+		if r := convert.RetryOf(cmp.Or(e.Retries, defaultRetries)); r != nil {
+			m.Retry = &modelRetry{Attempts: r.Attempts, Backoff: r.Backoff, Codes: r.Codes}
+		}
+	}
+	if e.Redirect == "" {
+		for _, b := range backendsFor(e) {
+			mb := modelBackend{Group: b.Group, Kind: b.Kind, Name: b.Name, Namespace: b.Namespace, Port: b.Port, Weight: b.Weight}
+			if mb.Kind == "" {
+				mb.Kind = "Service"
+			}
+			if mb.Namespace == "" {
+				mb.Namespace = routeNamespace
+			}
+			m.Backends = append(m.Backends, mb)
+		}
+	}
+	return m
+}
+
+// modelParents is parentRefs in the model.
+func modelParents(parentRefs []ParentRef) []modelParentRef {
+	parents := make([]modelParentRef, len(parentRefs))
+	for i, p := range parentRefs {
+		parents[i] = modelParentRef{Group: p.Group, Kind: p.Kind, Name: p.Name, Namespace: p.Namespace, SectionName: p.SectionName, Port: p.Port}
+	}
+	return parents
+}
+
+func modelEdits(h convert.HeaderEdits) *modelHeaderEdits {
+	if h.IsZero() {
+		return nil
+	}
+	m := &modelHeaderEdits{Set: modelPairs(h.Set), Add: modelPairs(h.Add)}
+	if h.Remove != "" {
+		m.Remove = strings.Split(h.Remove, ";")
+	}
+	return m
+}
+
+// modelList splits an accept or content_type cell into its media types.
+func modelList(cell string) []string {
+	if cell == "" {
+		return nil
+	}
+	return strings.Split(cell, ",")
+}
+
+// modelPairs splits a headers or query_params cell into its name=value
+// pairs.
+func modelPairs(cell string) map[string]string {
+	if cell == "" {
+		return nil
+	}
+	pairs := make(map[string]string)
+	for _, pair := range strings.Split(cell, ";") {
+		if name, value, ok := strings.Cut(pair, "="); ok {
+			pairs[strings.TrimSpace(name)] = strings.TrimSpace(value)
+		}
+	}
+	return pairs
+}
+
+// writeModel writes the model collected in this run to --emit-model.
+func writeModel() error {
+	doc := modelDoc{Generator: "csv2httproute", Version: Version, Routes: modelRoutes}
+	if doc.Routes == nil {
+		doc.Routes = []modelRoute{}
+	}
+	data, err := json.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := writeOutputFile(emitModel, append(data, '\n')); err != nil {
+		return err
+	}
+	if !quiet {
+		fmt.Printf("Generated %s\n", emitModel)
+	}
+	return nil
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/dynamic"
+)
+
+// Multi-Cluster Services (KEP-1645) backends: in --multicluster mode routes
+// reference ServiceImports, which the MCS controller derives from the
+// Services exported by every member cluster.
+
+const (
+	kindServiceImport = "ServiceImport"
+	mcsGroup          = "multicluster.x-k8s.io"
+)
+
+var (
+	multicluster  bool
+	verifyImports bool
+)
+
+// dns1035Label is the name format of Services, and therefore of the
+// ServiceImports the MCS controller creates for them.
+var dns1035Label = regexp.MustCompile(`^[a-z]([-a-z0-9]{0,61}[a-z0-9])?$`)
+
+// importClient and importPorts cache cluster lookups across routes.
+var (
+	importClient dynamic.Interface
+	importPorts  = make(map[string][]int64)
+)
+
+// applyMulticlusterDefaults makes ServiceImport the default backend kind in
+// --multicluster mode. Rows and an explicit non-Service --backend-kind keep
+// their own kind.
+func applyMulticlusterDefaults() {
+	if multicluster && backendKind == "Service" && backendGroup == "" {
+		backendKind, backendGroup = kindServiceImport, mcsGroup
+	}
+}
+
+// checkMulticluster validates the ServiceImport backends of route against
+// the MCS API: names must be valid Service names, and with --verify-imports
+// every ServiceImport must exist in the cluster and expose the port.
+func checkMulticluster(ctx context.Context, route HTTPRoute) error {
+	if !multicluster {
+		return nil
+	}
+	for i, rule := range route.Spec.Rules {
+		for _, b := range rule.BackendRefs {
+			if b.Kind != kindServiceImport {
+				continue
+			}
+			if b.Group != mcsGroup {
+				return fmt.Errorf("route %s rule %d: ServiceImport %s must use group %s, not %q", route.Metadata.Name, i, b.Name, mcsGroup, b.Group)
+			}
+			if !dns1035Label.MatchString(b.Name) {
+				return fmt.Errorf("route %s rule %d: %q is not a valid ServiceImport name (must be a DNS-1035 label)", route.Metadata.Name, i, b.Name)
+			}
+			if !verifyImports {
+				continue
+			}
+			ns := b.Namespace
+			if ns == "" {
+				ns = route.Metadata.Namespace
+			}
+			if err := verifyServiceImport(ctx, ns, b.Name, b.Port); err != nil {
+				return fmt.Errorf("route %s rule %d: %w", route.Metadata.Name, i, err)
+			}
+		}
+	}
+	return nil
+}
+
+// verifyServiceImport checks that namespace/name exists and exposes port.
+func verifyServiceImport(ctx context.Context, namespace, name string, port int) error {
+	key := namespace + "/" + name
+	ports, ok := importPorts[key]
+	if !ok {
+		if importClient == nil {
+			client, _, err := kubeDynamicClient()
+			if err != nil {
+				return err
+			}
+			importClient = client
+		}
+		var obj *unstructured.Unstructured
+		err := retryCluster(ctx, "ServiceImport "+key, 10*time.Second, func(ctx context.Context) error {
+			var err error
+			obj, err = importClient.Resource(serviceImportsGVR).Namespace(namespace).Get(ctx, name, metav1.GetOptions{})
+			return err
+		})
+		if apierrors.IsNotFound(err) {
+			return fmt.Errorf("ServiceImport %s not found; is the Service exported from a member cluster?", key)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to get ServiceImport %s: %w", key, err)
+		}
+		items, _, _ := unstructured.NestedSlice(obj.Object, "spec", "ports")
+		for _, item := range items {
+			if p, ok := item.(map[string]any); ok {
+				if v, ok := p["port"].(int64); ok {
+					ports = append(ports, v)
+				}
+			}
+		}
+		importPorts[key] = ports
+	}
+	for _, p := range ports {
+		if p == int64(port) {
+			return nil
+		}
+	}
+	return fmt.Errorf("ServiceImport %s does not expose port %d (ports: %v)", key, port, ports)
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+)
+
+var (
+	// nameTemplate is --name-template, the Go template the route names of a
+	// CSV are rendered from, or "" for its file name without endpoints-.
+	nameTemplate string
+	// nameCollision is --name-collision: what to do when two inputs of a
+	// run would get the same route name.
+	nameCollision string
+)
+
+// The --name-collision strategies.
+const (
+	collisionError           = "error"
+	collisionNumericSuffix   = "numeric-suffix"
+	collisionHashSuffix      = "hash-suffix"
+	collisionNamespacePrefix = "namespace-prefix"
+)
+
+// nameData is the value a --name-template is executed with, once per input.
+type nameData struct {
+	// File is the file name of the input without its extension.
+	File string
+	// Dir is its subdirectory of the --input directory or glob, "" at its
+	// top level.
+	Dir       string
+	Namespace string
+	Service   string
+}
+
+// routeNameTemplate is the parsed --name-template, or nil.
+var routeNameTemplate *template.Template
+
+// routeNames maps the output files claimed by the routes of the current
+// run, by outputPath without extension, to the input whose route claimed
+// them.
+var routeNames = make(map[string]string)
+
+func validateNames() error {
+	switch nameCollision {
+	case collisionError, collisionNumericSuffix, collisionHashSuffix, collisionNamespacePrefix:
+	default:
+		return fmt.Errorf("invalid --name-collision %q (must be %s, %s, %s or %s)", nameCollision, collisionError, collisionNumericSuffix, collisionHashSuffix, collisionNamespacePrefix)
+	}
+	routeNameTemplate = nil
+	if nameTemplate == "" {
+		return nil
+	}
+	tmpl, err := template.New("name").Funcs(templateFuncs).Option("missingkey=error").Parse(nameTemplate)
+	if err == nil {
+		// Fail unknown fields before any route is generated
+		err = tmpl.Execute(io.Discard, nameData{})
+	}
+	if err != nil {
+		return fmt.Errorf("invalid --name-template: %w", err)
+	}
+	routeNameTemplate = tmpl
+	return nil
+}
+
+// resetRouteNames forgets the names claimed by a previous run, and claims
+// the files aggregated over the whole run that this one will write, so no
+// route overwrites them.
+func resetRouteNames() {
+	routeNames = make(map[string]string)
+	reserved := map[string]bool{
+		"catalog-info":    backstageCatalog,
+		"rbac":            rbacServiceAccount != "",
+		"namespaces":      createNamespaces,
+		"errorpages":      errorPageFile != "",
+		"referencegrants": !noReferenceGrants,
+		"kustomization":   kustomize,
+	}
+	for name, written := range reserved {
+		if written {
+			routeNames[outputPath(name, "")] = "the generated " + name + ".yaml"
+		}
+	}
+}
+
+// routeBaseName is the name of the routes generated from path: its
+// --name-template, or file name without endpoints-, made a valid resource
+// name.
+func routeBaseName(path string) (string, error) {
+	raw := strings.ReplaceAll(csvBaseName(path), "endpoints-", "")
+	if routeNameTemplate != nil {
+		var b strings.Builder
+		data := nameData{File: csvBaseName(path), Dir: filepath.ToSlash(inputSubdir(path)), Namespace: namespace, Service: serviceName}
+		if err := routeNameTemplate.Execute(&b, data); err != nil {
+			return "", fmt.Errorf("failed to render --name-template: %w", err)
+		}
+		raw = b.String()
+	}
+	name := resourceName(raw)
+	if name == "" {
+		return "", fmt.Errorf("%q has no characters valid in a route name", raw)
+	}
+	return name, nil
+}
+
+// claimRouteName claims the output file of the route of meta, built from
+// path, for the current run. Routes are claimed as they are written, after
+// every split, shard and merge gave them their final names, so a route
+// named like one written before, from another file or the same, is caught
+// whichever mode named it, and renamed by --name-collision or failed.
+func claimRouteName(meta *Metadata, path string) error {
+	if owner, taken := routeNames[outputPath(meta.Name, "")]; taken {
+		name, err := resolveCollision(*meta, path, owner)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(os.Stderr, "WARNING: route name %s of %s is already used by %s, naming it %s\n", meta.Name, path, owner, name)
+		if dir := partitionDirs[meta.Name]; dir != "" {
+			partitionDirs[name] = dir
+		}
+		meta.Name = name
+	}
+	routeNames[outputPath(meta.Name, "")] = path
+	return nil
+}
+
+// resolveCollision renames the route of meta, built from path, whose name
+// owner already uses, by the --name-collision strategy.
+func resolveCollision(meta Metadata, path, owner string) (string, error) {
+	taken := func(name string) bool {
+		_, ok := routeNames[outputPath(name, "")]
+		return ok
+	}
+	var name string
+	switch nameCollision {
+	case collisionError:
+		return "", fmt.Errorf("route name %s is already used by %s; set --name-template, or --name-collision to rename it", meta.Name, owner)
+	case collisionNumericSuffix:
+		for n := 2; name == "" || taken(name); n++ {
+			name = fmt.Sprintf("%s-%d", meta.Name, n)
+		}
+		return name, nil
+	case collisionHashSuffix:
+		// Unlike a number, the hash of the input does not depend on the
+		// order the inputs are read in.
+		sum := sha256.Sum256([]byte(filepath.ToSlash(path)))
+		name = meta.Name + "-" + hex.EncodeToString(sum[:4])
+	case collisionNamespacePrefix:
+		name = meta.Namespace + "-" + meta.Name
+	}
+	if name = resourceName(name); taken(name) {
+		return "", fmt.Errorf("route name %s is already used by %s, and so is %s that --name-collision %s renames it to", meta.Name, owner, name, nameCollision)
+	}
+	return name, nil
+}
+
+// resourceName makes s a DNS subdomain (RFC 1123), the names accepted for
+// routes: lowercase, with any character but letters, digits and dots
+// replaced by dashes, no dashes at the ends of its dot-separated labels,
+// and at most 253 characters.
+func resourceName(s string) string {
+	mapped := strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9', r == '.':
+			return r
+		case r >= 'A' && r <= 'Z':
+			return r + 'a' - 'A'
+		}
+		return '-'
+	}, s)
+	var labels []string
+	for _, label := range strings.Split(mapped, ".") {
+		if label = strings.Trim(label, "-"); label != "" {
+			labels = append(labels, label)
+		}
+	}
+	name := strings.Join(labels, ".")
+	if len(name) > 253 {
+		name = strings.TrimRight(name[:253], "-.")
+	}
+	return name
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+)
+
+var (
+	// createNamespaces writes a Namespace manifest for every namespace the
+	// generated routes and their backends live in.
+	createNamespaces bool
+	// namespaceLabels are the --namespace-label key=value pairs set on the
+	// generated Namespaces, e.g. the label a shared Gateway's allowedRoutes
+	// selects.
+	namespaceLabels []string
+	// existingNamespaces are left out of the Namespace manifests since they
+	// are created elsewhere.
+	existingNamespaces []string
+)
+
+// namespaceLabelMap is the parsed --namespace-label.
+var namespaceLabelMap map[string]string
+
+// referencedNamespaces collects the namespaces of the generated routes and
+// their backends during a run.
+var referencedNamespaces = make(map[string]bool)
+
+func loadNamespaceLabels(specs []string) error {
+	var err error
+	namespaceLabelMap, err = parseLabelFlag("namespace-label", specs)
+	return err
+}
+
+// parseLabelFlag reads the key=value labels of a flag, nil for none.
+func parseLabelFlag(flag string, specs []string) (map[string]string, error) {
+	var labels map[string]string
+	for _, spec := range specs {
+		key, value, ok := strings.Cut(spec, "=")
+		if !ok || key == "" {
+			return nil, fmt.Errorf("invalid --%s %q (want key=value)", flag, spec)
+		}
+		if labels == nil {
+			labels = make(map[string]string)
+		}
+		labels[key] = value
+	}
+	return labels, nil
+}
+
+// collectNamespaces records the namespace of route and of every service its
+// rules send traffic or mirrored traffic to.
+func collectNamespaces(route HTTPRoute) {
+	referencedNamespaces[route.Metadata.Namespace] = true
+	for _, rule := range route.Spec.Rules {
+		for _, b := range rule.BackendRefs {
+			if b.Namespace != "" {
+				referencedNamespaces[b.Namespace] = true
+			}
+		}
+		for _, f := range rule.Filters {
+			if f.RequestMirror != nil && f.RequestMirror.BackendRef.Namespace != "" {
+				referencedNamespaces[f.RequestMirror.BackendRef.Namespace] = true
+			}
+		}
+	}
+}
+
+// writeNamespaces writes namespaces.yaml with a Namespace per referenced
+// namespace. Namespaces every cluster has (default and kube-*) and those
+// listed in --existing-namespace are skipped, so the manifests never take
+// over namespaces another tool manages.
+func writeNamespaces() error {
+	var names []string
+	for ns := range referencedNamespaces {
+		if ns == "" || ns == "default" || strings.HasPrefix(ns, "kube-") || slices.Contains(existingNamespaces, ns) {
+			continue
+		}
+		names = append(names, ns)
+	}
+	if len(names) == 0 {
+		return nil
+	}
+	sort.Strings(names)
+
+	docs := make([]any, 0, len(names))
+	for _, ns := range names {
+		docs = append(docs, map[string]any{
+			"apiVersion": "v1",
+			"kind":       "Namespace",
+			"metadata":   Metadata{Name: ns, Labels: namespaceLabelMap},
+		})
+	}
+	outPath := outputPath("namespaces", ".yaml")
+	if err := writeYAMLDocs(outPath, docs); err != nil {
+		return err
+	}
+	if !quiet {
+		fmt.Printf("Generated %s\n", outPath)
+	}
+	return nil
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Generated manifests can be pushed as an OCI artifact in the Flux format
+// (a single tar+gzip layer), so clusters pull route bundles with an
+// OCIRepository instead of syncing a git directory. Pushing is delegated to
+// the flux or oras CLI, which own registry credentials like docker does.
+
+const (
+	ociFlux = "flux"
+	ociORAS = "oras"
+
+	fluxConfigMediaType  = "application/vnd.cncf.flux.config.v1+json"
+	fluxContentMediaType = "application/vnd.cncf.flux.content.v1.tar+gzip"
+)
+
+var (
+	pushOCI   string
+	ociTool   string
+	ociSource string
+)
+
+func validatePushOCI() error {
+	if pushOCI == "" {
+		return nil
+	}
+	if !strings.HasPrefix(pushOCI, "oci://") || len(pushOCI) == len("oci://") {
+		return fmt.Errorf("invalid --push-oci %q (want oci://registry/repository:tag)", pushOCI)
+	}
+	if err := checkOffline("--push-oci"); err != nil {
+		return err
+	}
+	switch ociTool {
+	case ociFlux, ociORAS:
+		return nil
+	}
+	return fmt.Errorf("invalid --oci-tool %q: must be %s or %s", ociTool, ociFlux, ociORAS)
+}
+
+// ociTarball packs the files under dir into a reproducible tar.gz: sorted
+// names and no timestamps, so unchanged manifests give the same digest.
+func ociTarball(dir string) ([]byte, error) {
+	files, err := readTree(dir)
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	for _, name := range names {
+		hdr := &tar.Header{Name: name, Mode: 0644, Size: int64(len(files[name])), Format: tar.FormatPAX}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return nil, err
+		}
+		if _, err := tw.Write([]byte(files[name])); err != nil {
+			return nil, err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return nil, err
+	}
+	if err := gz.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// pushBundle pushes the manifests under dir to --push-oci, tagged with the
+// digest of their tarball as the revision.
+func pushBundle(ctx context.Context, dir string) error {
+	tarball, err := ociTarball(dir)
+	if err != nil {
+		return fmt.Errorf("failed to package %s: %w", dir, err)
+	}
+	sum := sha256.Sum256(tarball)
+	revision := "sha256:" + hex.EncodeToString(sum[:])
+
+	switch ociTool {
+	case ociFlux:
+		_, err = runSigner(ctx, ociTool, "push", "artifact", pushOCI, "--path", dir, "--source", ociSource, "--revision", revision)
+	case ociORAS:
+		err = orasPush(tarball, revision)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to push %s with %s: %w", pushOCI, ociTool, err)
+	}
+	if !quiet {
+		fmt.Printf("Pushed %s to %s (%s)\n", dir, pushOCI, revision)
+	}
+	return nil
+}
+
+// orasPush pushes tarball as the single layer of a Flux artifact. oras
+// names layers after the path given, so it runs next to the tarball.
+func orasPush(tarball []byte, revision string) error {
+	tmp, err := os.MkdirTemp("", "csv2httproute-oci-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmp)
+	if err := os.WriteFile(filepath.Join(tmp, "manifests.tgz"), tarball, 0644); err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(tmp, "config.json"), []byte("{}"), 0644); err != nil {
+		return err
+	}
+	var stderr bytes.Buffer
+	cmd := exec.Command(ociTool, "push", strings.TrimPrefix(pushOCI, "oci://"),
+		"--config", "config.json:"+fluxConfigMediaType,
+		"--annotation", "org.opencontainers.image.source="+ociSource,
+		"--annotation", "org.opencontainers.image.revision="+revision,
+		"manifests.tgz:"+fluxContentMediaType)
+	cmd.Dir = tmp
+	cmd.Stderr = &stderr
+	err = cmd.Run()
+	if errors.Is(err, exec.ErrNotFound) {
+		return fmt.Errorf("%s was not found in PATH", ociTool)
+	}
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return errors.New(msg)
+		}
+		return err
+	}
+	return nil
+}
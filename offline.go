@@ -0,0 +1,95 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+)
+
+// Air-gapped build environments need the guarantee that a run reaches
+// nothing beyond the machine. With --offline every connection the tool
+// opens itself, over HTTP or to a cluster, is refused unless it goes to a
+// loopback address, such as an envtest control plane, and the features
+// handing the network to another tool (git and bucket inputs, --push-oci,
+// keyless signing) fail up front. What such runs need from the network is
+// built in: the conformance matrix of the providers, the example templates
+// of init and the Gateway API CRDs of verify-cluster, for the releases
+// embedded at build time.
+
+// offline is --offline.
+var offline bool
+
+// setupOffline routes the HTTP requests of an --offline run through
+// offlineDial. The transport stays an *http.Transport, which clients such as
+// the OTLP exporter clone for their own.
+func setupOffline() {
+	if !offline {
+		return
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = offlineDial
+	http.DefaultTransport = transport
+}
+
+// checkOffline fails what, a feature needing the network, in an --offline
+// run.
+func checkOffline(what string) error {
+	if offline {
+		return fmt.Errorf("%s needs network access, which --offline rules out", what)
+	}
+	return nil
+}
+
+// checkOfflineURL fails what, a connection to rawURL, in an --offline run
+// unless rawURL is on a loopback address.
+func checkOfflineURL(what, rawURL string) error {
+	if !offline {
+		return nil
+	}
+	u, err := url.Parse(rawURL)
+	if err == nil && isLoopback(u.Hostname()) {
+		return nil
+	}
+	return checkOffline(fmt.Sprintf("%s (%s)", what, rawURL))
+}
+
+// offlineDial is the dialer of an --offline run: it connects to loopback
+// addresses and refuses everything else, without resolving names first.
+func offlineDial(ctx context.Context, network, address string) (net.Conn, error) {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		host = address
+	}
+	if !isLoopback(host) {
+		return nil, fmt.Errorf("--offline: refusing to connect to %s", address)
+	}
+	var d net.Dialer
+	return d.DialContext(ctx, network, address)
+}
+
+// isLoopback reports whether host, a name or an address, is this machine.
+func isLoopback(host string) bool {
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// offlineTracingEndpoint fails an --offline run exporting traces anywhere
+// but to a collector on a loopback address.
+func offlineTracingEndpoint() error {
+	for _, endpoint := range []string{otlpEndpoint, os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT"), os.Getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT")} {
+		if endpoint == "" {
+			continue
+		}
+		if err := checkOfflineURL("trace export", endpoint); err != nil {
+			return err
+		}
+	}
+	return nil
+}
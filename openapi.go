@@ -0,0 +1,297 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/arencloud/csv2httproute/pkg/convert"
+	"gopkg.in/yaml.v3"
+)
+
+// Values of --input-format.
+const (
+	formatCSV      = "csv"
+	formatOpenAPI  = "openapi"
+	formatActuator = "actuator"
+	formatRails    = "rails"
+	formatDjango   = "django"
+	formatIIS      = "iis"
+	formatASPNet   = "aspnet"
+	formatSpring   = "spring-gateway"
+	formatAuto     = "auto"
+)
+
+// inputFormat is --input-format: which files of --input are read, CSVs,
+// OpenAPI documents, Spring Boot actuator mappings, Rails, Django or ASP.NET
+// route dumps, IIS web.config files, Spring Cloud Gateway or Zuul
+// application.yaml files, or CSVs, OpenAPI documents and actuator mappings
+// together.
+var inputFormat = formatCSV
+
+// openAPIExtension is the vendor extension setting CSV columns for the
+// operations of a document, a path, or one operation, e.g.
+// x-csv2httproute: {service: users, port: 8080, prefix: /users}.
+const openAPIExtension = "x-csv2httproute"
+
+// openAPIMethods are the operations of an OpenAPI path item.
+var openAPIMethods = []string{"get", "put", "post", "delete", "options", "head", "patch", "trace"}
+
+func validateInputFormat(format string) error {
+	switch format {
+	case formatCSV, formatOpenAPI, formatActuator, formatRails, formatDjango, formatASPNet, formatIIS, formatSpring, formatAuto:
+		return nil
+	}
+	return fmt.Errorf("invalid --input-format %q (must be csv, openapi, actuator, rails, django, aspnet, iis, spring-gateway, or auto)", format)
+}
+
+// isSpecFile reports whether name looks like an OpenAPI document: a YAML or
+// JSON file other than a schema sidecar.
+func isSpecFile(name string) bool {
+	name = plainName(name)
+	if isSidecarFile(name) {
+		return false
+	}
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".yaml", ".yml", ".json":
+		return true
+	}
+	return false
+}
+
+// isInputFile reports whether name is read with the --input-format.
+func isInputFile(name string) bool {
+	switch inputFormat {
+	case formatOpenAPI:
+		return isSpecFile(name)
+	case formatActuator, formatRails, formatDjango, formatASPNet:
+		return strings.EqualFold(filepath.Ext(plainName(name)), ".json")
+	case formatIIS:
+		return strings.EqualFold(filepath.Ext(plainName(name)), ".config")
+	case formatSpring:
+		ext := strings.ToLower(filepath.Ext(plainName(name)))
+		return ext == ".yaml" || ext == ".yml"
+	case formatAuto:
+		return isCSVFile(name) || isSpecFile(name)
+	}
+	return isCSVFile(name)
+}
+
+// inputFileKind describes the files of the --input-format for messages.
+func inputFileKind() string {
+	switch inputFormat {
+	case formatOpenAPI:
+		return "an OpenAPI document (.yaml, .yml, or .json)"
+	case formatActuator:
+		return "an actuator mappings document (.json)"
+	case formatRails, formatDjango, formatASPNet:
+		return "a route dump (.json)"
+	case formatIIS:
+		return "an IIS web.config file (.config)"
+	case formatSpring:
+		return "an application.yaml (.yaml or .yml)"
+	case formatAuto:
+		return "a CSV file, an OpenAPI document, or actuator mappings"
+	}
+	return "a CSV file"
+}
+
+// parseInput reads the endpoints of an input file.
+func parseInput(ctx context.Context, path string) ([]Endpoint, error) {
+	switch {
+	case inputFormat == formatActuator:
+		return parseActuator(ctx, path)
+	case inputFormat == formatRails || inputFormat == formatDjango || inputFormat == formatASPNet:
+		return parseRouteDump(ctx, path)
+	case inputFormat == formatIIS:
+		return parseIIS(ctx, path)
+	case inputFormat == formatSpring:
+		return parseSpringGateway(ctx, path)
+	case isSpecFile(path) && inputFormat != formatCSV:
+		return parseOpenAPI(ctx, path)
+	}
+	return parseCSV(ctx, path)
+}
+
+// parseOpenAPI turns every operation of an OpenAPI 3 or Swagger 2 document
+// into an endpoint row, as if the CSV had a method and url column: the URL
+// is the path of the first server (or the basePath) followed by the path of
+// the operation, and the summary is its comment. Path parameters such as
+// /users/{id} match one segment each. Further columns come from the
+// x-csv2httproute extension of the document, the path, and the operation,
+// the innermost winning, and the tags column from the tags of the
+// operation unless the extension sets it. Rows are numbered by the line of their operation.
+// With --input-format auto, actuator mappings are read as such, and other
+// YAML and JSON files that are not OpenAPI documents are ignored.
+func parseOpenAPI(ctx context.Context, path string) ([]Endpoint, error) {
+	data, err := readInput(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("invalid OpenAPI document: %w", err)
+	}
+	var root *yaml.Node
+	if len(doc.Content) > 0 && doc.Content[0].Kind == yaml.MappingNode {
+		root = doc.Content[0]
+	}
+	if root == nil || (mappingValue(root, "openapi") == nil && mappingValue(root, "swagger") == nil) {
+		if inputFormat == formatAuto && root != nil && isActuatorDoc(root) {
+			return actuatorEndpoints(path, root)
+		}
+		if inputFormat == formatAuto {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("not an OpenAPI document (missing openapi or swagger field)")
+	}
+
+	base, err := specBasePath(root)
+	if err != nil {
+		return nil, err
+	}
+	docColumns, err := extensionColumns(root, nil)
+	if err != nil {
+		return nil, err
+	}
+	var endpoints []Endpoint
+	paths := mappingValue(root, "paths")
+	if paths == nil || paths.Kind != yaml.MappingNode {
+		return nil, nil
+	}
+	for i := 0; i+1 < len(paths.Content); i += 2 {
+		pathKey, item := paths.Content[i], paths.Content[i+1]
+		if item.Kind != yaml.MappingNode || !strings.HasPrefix(pathKey.Value, "/") {
+			continue
+		}
+		pathColumns, err := extensionColumns(item, docColumns)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", pathKey.Line, err)
+		}
+		for j := 0; j+1 < len(item.Content); j += 2 {
+			methodKey, op := item.Content[j], item.Content[j+1]
+			if !slices.Contains(openAPIMethods, methodKey.Value) || op.Kind != yaml.MappingNode {
+				continue
+			}
+			columns, err := extensionColumns(op, pathColumns)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", methodKey.Line, err)
+			}
+			urlPath := base + pathKey.Value
+			if base != "" && pathKey.Value == "/" {
+				urlPath = base
+			}
+			endpoint, err := specEndpoint(urlPath, methodKey.Value, op, columns)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %s %s: %w", methodKey.Line, strings.ToUpper(methodKey.Value), pathKey.Value, err)
+			}
+			endpoint.Line = methodKey.Line
+			endpoints = append(endpoints, endpoint)
+		}
+	}
+	recordSkippedRows(path, 0)
+	return applyTagFilters(applyCutovers(endpoints)), nil
+}
+
+// specEndpoint parses a synthetic row for one operation through the same
+// column handling as CSV rows.
+func specEndpoint(urlPath, method string, op *yaml.Node, columns map[string]string) (Endpoint, error) {
+	comment := ""
+	for _, key := range []string{"summary", "operationId"} {
+		if v := mappingValue(op, key); v != nil && v.Value != "" {
+			comment = v.Value
+			break
+		}
+	}
+	header := []string{"method", "url", "comment"}
+	record := []string{method, urlPath, comment}
+	names := make([]string, 0, len(columns))
+	for name := range columns {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		header = append(header, name)
+		record = append(record, columns[name])
+	}
+	if tags := mappingValue(op, "tags"); tags != nil && tags.Kind == yaml.SequenceNode && columns["tags"] == "" {
+		var names []string
+		for _, t := range tags.Content {
+			names = append(names, t.Value)
+		}
+		header = append(header, "tags")
+		record = append(record, strings.Join(names, ";"))
+	}
+	if strings.Contains(urlPath, "{") && columns["match_type"] == "" {
+		matches, err := compileTemplatePath(urlPath)
+		if err != nil {
+			return Endpoint{}, err
+		}
+		header = append(header, "match_type")
+		record = append(record, matches[0].Type)
+		record[1] = matches[0].Value
+	}
+	return parseRecord(record, convert.ColumnIndex(header))
+}
+
+// specBasePath is the path all operations of the document live under: the
+// path of the first server URL (with its variables at their defaults) in
+// OpenAPI 3, the basePath in Swagger 2.
+func specBasePath(root *yaml.Node) (string, error) {
+	base := ""
+	if v := mappingValue(root, "basePath"); v != nil {
+		base = v.Value
+	}
+	if servers := mappingValue(root, "servers"); servers != nil && servers.Kind == yaml.SequenceNode && len(servers.Content) > 0 {
+		server := servers.Content[0]
+		raw := ""
+		if v := mappingValue(server, "url"); v != nil {
+			raw = v.Value
+		}
+		if vars := mappingValue(server, "variables"); vars != nil && vars.Kind == yaml.MappingNode {
+			for i := 0; i+1 < len(vars.Content); i += 2 {
+				if def := mappingValue(vars.Content[i+1], "default"); def != nil {
+					raw = strings.ReplaceAll(raw, "{"+vars.Content[i].Value+"}", def.Value)
+				}
+			}
+		}
+		u, err := url.Parse(raw)
+		if err != nil {
+			return "", fmt.Errorf("invalid server URL %q: %w", raw, err)
+		}
+		base = u.Path
+	}
+	return strings.TrimSuffix(base, "/"), nil
+}
+
+// extensionColumns returns inherited overlaid with the columns set by the
+// x-csv2httproute extension of node. Only the columns a directive row may
+// set are allowed.
+func extensionColumns(node *yaml.Node, inherited map[string]string) (map[string]string, error) {
+	columns := make(map[string]string, len(inherited))
+	for k, v := range inherited {
+		columns[k] = v
+	}
+	ext := mappingValue(node, openAPIExtension)
+	if ext == nil {
+		return columns, nil
+	}
+	if ext.Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("%s must be a mapping of columns", openAPIExtension)
+	}
+	for i := 0; i+1 < len(ext.Content); i += 2 {
+		name, value := ext.Content[i].Value, ext.Content[i+1]
+		if !slices.Contains(columnDirectives, name) {
+			return nil, fmt.Errorf("%s: unknown column %q (must be one of %s)", openAPIExtension, name, strings.Join(columnDirectives, ", "))
+		}
+		if value.Kind != yaml.ScalarNode {
+			return nil, fmt.Errorf("%s: column %s must be a string or number", openAPIExtension, name)
+		}
+		columns[name] = value.Value
+	}
+	return columns, nil
+}
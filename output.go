@@ -0,0 +1,222 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Output permissions resolved from --file-mode, --dir-mode, and --owner.
+// Without explicit modes files and directories are created with 0666/0777 and
+// the process umask applies, as with any other tool.
+var (
+	outputFileMode os.FileMode = 0666
+	outputDirMode  os.FileMode = 0777
+	explicitFile   bool
+	explicitDir    bool
+	outputUID      = -1
+	outputGID      = -1
+)
+
+// configureOutputPermissions parses the permission flags.
+func configureOutputPermissions() error {
+	if fileModeFlag != "" {
+		m, err := parseMode(fileModeFlag)
+		if err != nil {
+			return fmt.Errorf("invalid --file-mode: %w", err)
+		}
+		outputFileMode, explicitFile = m, true
+	}
+	if dirModeFlag != "" {
+		m, err := parseMode(dirModeFlag)
+		if err != nil {
+			return fmt.Errorf("invalid --dir-mode: %w", err)
+		}
+		outputDirMode, explicitDir = m, true
+	}
+	if ownerFlag != "" {
+		uid, gid, err := parseOwner(ownerFlag)
+		if err != nil {
+			return fmt.Errorf("invalid --owner: %w", err)
+		}
+		outputUID, outputGID = uid, gid
+	}
+	return nil
+}
+
+func parseMode(s string) (os.FileMode, error) {
+	m, err := strconv.ParseUint(s, 8, 32)
+	if err != nil || m > 0777 {
+		return 0, fmt.Errorf("%q is not an octal permission like 0644", s)
+	}
+	return os.FileMode(m), nil
+}
+
+// parseOwner resolves "user[:group]", where each part is a name or numeric id.
+func parseOwner(s string) (int, int, error) {
+	userPart, groupPart, hasGroup := strings.Cut(s, ":")
+	uid, gid := -1, -1
+	if userPart != "" {
+		id, err := strconv.Atoi(userPart)
+		if err != nil {
+			u, lookupErr := user.Lookup(userPart)
+			if lookupErr != nil {
+				return 0, 0, lookupErr
+			}
+			id, _ = strconv.Atoi(u.Uid)
+		}
+		uid = id
+	}
+	if hasGroup && groupPart != "" {
+		id, err := strconv.Atoi(groupPart)
+		if err != nil {
+			g, lookupErr := user.LookupGroup(groupPart)
+			if lookupErr != nil {
+				return 0, 0, lookupErr
+			}
+			id, _ = strconv.Atoi(g.Gid)
+		}
+		gid = id
+	}
+	return uid, gid, nil
+}
+
+// ensureOutputDir creates dir (and parents) with the configured mode and owner.
+func ensureOutputDir(dir string) error {
+	if _, err := os.Stat(dir); err == nil {
+		return nil
+	}
+	if err := os.MkdirAll(dir, outputDirMode); err != nil {
+		return err
+	}
+	if explicitDir {
+		if err := os.Chmod(dir, outputDirMode); err != nil {
+			return err
+		}
+	}
+	return chownOutput(dir)
+}
+
+// outputFile is a generated file being written. It is written next to its
+// path and renamed into place by Close, so an interrupted or failed run
+// never leaves a truncated file behind.
+type outputFile struct {
+	*os.File
+	path string
+	done bool
+}
+
+// createOutputFile starts writing path; Close replaces the file, Discard
+// drops what was written. An explicit --file-mode is applied exactly,
+// otherwise an existing file keeps its permissions.
+func createOutputFile(path string) (*outputFile, error) {
+	tmp := filepath.Join(filepath.Dir(path), fmt.Sprintf(".%s.%d.tmp", filepath.Base(path), os.Getpid()))
+	f, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, outputFileMode)
+	if err != nil {
+		return nil, err
+	}
+	out := &outputFile{File: f, path: path}
+	mode, chmod := outputFileMode, explicitFile
+	if info, err := os.Stat(path); err == nil && !explicitFile {
+		mode, chmod = info.Mode().Perm(), true
+	}
+	if chmod {
+		if err := f.Chmod(mode); err != nil {
+			out.Discard()
+			return nil, err
+		}
+	}
+	if err := chownOutput(tmp); err != nil {
+		out.Discard()
+		return nil, err
+	}
+	return out, nil
+}
+
+// Close finishes the file and moves it to its path. A file with the content
+// path already has is dropped instead, so unchanged outputs keep their
+// modification time.
+func (f *outputFile) Close() error {
+	if f.done {
+		return nil
+	}
+	f.done = true
+	if err := f.File.Close(); err != nil {
+		os.Remove(f.File.Name())
+		return err
+	}
+	if sameContent(f.File.Name(), f.path) {
+		os.Remove(f.File.Name())
+		if err := applyOutputPermissions(f.path); err != nil {
+			return err
+		}
+		writtenFiles = append(writtenFiles, f.path)
+		return nil
+	}
+	if err := os.Rename(f.File.Name(), f.path); err != nil {
+		os.Remove(f.File.Name())
+		return err
+	}
+	writtenFiles = append(writtenFiles, f.path)
+	return nil
+}
+
+// sameContent reports whether the files a and b both exist with the same
+// content.
+func sameContent(a, b string) bool {
+	x, err := os.ReadFile(a)
+	if err != nil {
+		return false
+	}
+	y, err := os.ReadFile(b)
+	return err == nil && bytes.Equal(x, y)
+}
+
+// Discard removes the unfinished file, leaving path as it was. It does
+// nothing after Close, so it can be deferred.
+func (f *outputFile) Discard() {
+	if f.done {
+		return
+	}
+	f.done = true
+	f.File.Close()
+	os.Remove(f.File.Name())
+}
+
+// applyOutputPermissions applies --file-mode and --owner to a file written by
+// an external tool.
+func applyOutputPermissions(path string) error {
+	if explicitFile {
+		if err := os.Chmod(path, outputFileMode); err != nil {
+			return err
+		}
+	}
+	return chownOutput(path)
+}
+
+// writeOutputFile is os.WriteFile honoring the output permission flags.
+func writeOutputFile(path string, data []byte) error {
+	f, err := createOutputFile(path)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Discard()
+		return err
+	}
+	return f.Close()
+}
+
+func chownOutput(path string) error {
+	if outputUID == -1 && outputGID == -1 {
+		return nil
+	}
+	if err := os.Chown(path, outputUID, outputGID); err != nil {
+		return fmt.Errorf("failed to set owner of %s: %w", path, err)
+	}
+	return nil
+}
@@ -0,0 +1,603 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Clusters without the Gateway API can be served from the same inventory:
+// --output-kind renders every built HTTPRoute as an Ingress or an Istio
+// VirtualService instead. Rules the target cannot express fail the route
+// rather than being approximated.
+
+// Kinds of --output-kind.
+const (
+	outputHTTPRoute      = "httproute"
+	outputIngress        = "ingress"
+	outputVirtualService = "virtualservice"
+)
+
+var (
+	// outputKind is --output-kind: the manifests the routes are written as.
+	outputKind = outputHTTPRoute
+	// ingressClass is --ingress-class, the ingressClassName of the Ingresses.
+	ingressClass string
+)
+
+func validateOutputKind() error {
+	switch outputKind {
+	case outputHTTPRoute:
+		return nil
+	case outputIngress, outputVirtualService:
+	default:
+		return fmt.Errorf("invalid --output-kind %q (must be %s, %s, or %s)", outputKind, outputHTTPRoute, outputIngress, outputVirtualService)
+	}
+	switch {
+	case templateFile != "":
+		return fmt.Errorf("--template renders HTTPRoutes and cannot be combined with --output-kind %s", outputKind)
+	case applyRoutes || slices.Contains(sinkSpecs, "cluster"):
+		return fmt.Errorf("--apply only applies HTTPRoutes and cannot be combined with --output-kind %s", outputKind)
+	case rbacServiceAccount != "":
+		return fmt.Errorf("--rbac-service-account grants access to HTTPRoutes and cannot be combined with --output-kind %s", outputKind)
+	case failoverMode == failoverEnvoyGateway:
+		return fmt.Errorf("--failover %s attaches policies to HTTPRoutes and cannot be combined with --output-kind %s", failoverEnvoyGateway, outputKind)
+	}
+	return nil
+}
+
+// checkOutputKindRows rejects rows only Gateway API routes can serve.
+func checkOutputKindRows(passthrough, grpcRows []Endpoint) error {
+	if outputKind == outputHTTPRoute {
+		return nil
+	}
+	if len(passthrough) > 0 {
+		return fmt.Errorf("line %d: tls=passthrough rows need a TLSRoute and cannot be written with --output-kind %s", passthrough[0].Line, outputKind)
+	}
+	if len(grpcRows) > 0 {
+		return fmt.Errorf("line %d: protocol=grpc rows need a GRPCRoute and cannot be written with --output-kind %s", grpcRows[0].Line, outputKind)
+	}
+	return nil
+}
+
+// writeOutputKind writes route as the manifest of --output-kind.
+func writeOutputKind(route HTTPRoute, source string) (string, error) {
+	var doc any
+	var err error
+	if outputKind == outputIngress {
+		doc, err = toIngress(route)
+	} else {
+		doc, err = toVirtualService(route)
+	}
+	if err != nil {
+		return "", fmt.Errorf("route %s: %w", route.Metadata.Name, err)
+	}
+	return writeRouteDoc(doc, route.Metadata.Name, source)
+}
+
+// ingress is a networking.k8s.io/v1 Ingress.
+type ingress struct {
+	APIVersion string      `yaml:"apiVersion"`
+	Kind       string      `yaml:"kind"`
+	Metadata   Metadata    `yaml:"metadata"`
+	Spec       ingressSpec `yaml:"spec"`
+}
+
+type ingressSpec struct {
+	IngressClassName string        `yaml:"ingressClassName,omitempty"`
+	Rules            []ingressRule `yaml:"rules"`
+}
+
+type ingressRule struct {
+	Host string          `yaml:"host,omitempty"`
+	HTTP ingressRuleHTTP `yaml:"http"`
+}
+
+type ingressRuleHTTP struct {
+	Paths []ingressPath `yaml:"paths"`
+}
+
+type ingressPath struct {
+	Path     string         `yaml:"path"`
+	PathType string         `yaml:"pathType"`
+	Backend  ingressBackend `yaml:"backend"`
+}
+
+type ingressBackend struct {
+	Service ingressService `yaml:"service"`
+}
+
+type ingressService struct {
+	Name string             `yaml:"name"`
+	Port ingressServicePort `yaml:"port"`
+}
+
+type ingressServicePort struct {
+	Number int `yaml:"number"`
+}
+
+// ingressPathTypes maps Gateway API path match types to Ingress path types.
+// Both match prefixes by path segment; regular expressions are left to the
+// controller.
+var ingressPathTypes = map[string]string{
+	"Exact":             "Exact",
+	"PathPrefix":        "Prefix",
+	"RegularExpression": "ImplementationSpecific",
+}
+
+// toIngress converts route to an Ingress with one path per distinct path
+// match. Ingresses match on the path alone: method matches are dropped with
+// a warning, and paths whose methods reach different backends fail, as do
+// header and query parameter matches, filters, weighted or several
+// backends, and backends in other namespaces.
+func toIngress(route HTTPRoute) (ingress, error) {
+	ing := ingress{
+		APIVersion: "networking.k8s.io/v1",
+		Kind:       "Ingress",
+		Metadata:   route.Metadata,
+		Spec:       ingressSpec{IngressClassName: ingressClass},
+	}
+	rule := ingressRule{}
+	if len(route.Spec.Hostnames) > 0 {
+		rule.Host = route.Spec.Hostnames[0]
+	}
+	type pathKey struct{ Type, Value string }
+	backends := make(map[pathKey]BackendRef)
+	methods := 0
+	for i, r := range route.Spec.Rules {
+		if len(r.Filters) > 0 {
+			return ing, fmt.Errorf("rule %d uses a %s filter, which Ingresses cannot express (prefix rows rewrite paths; try --strategy exact)", i, r.Filters[0].Type)
+		}
+		if r.Timeouts != nil || r.Retry != nil {
+			return ing, fmt.Errorf("rule %d sets timeouts or retries, which Ingresses cannot express", i)
+		}
+		if len(r.BackendRefs) != 1 {
+			return ing, fmt.Errorf("rule %d has %d backends; an Ingress path has exactly one", i, len(r.BackendRefs))
+		}
+		b := r.BackendRefs[0]
+		if b.Kind != "" && b.Kind != "Service" {
+			return ing, fmt.Errorf("rule %d references a %s; Ingresses only reference Services", i, b.Kind)
+		}
+		if b.Namespace != "" && b.Namespace != route.Metadata.Namespace {
+			return ing, fmt.Errorf("rule %d references service %s/%s; Ingresses only reference Services in their own namespace", i, b.Namespace, b.Name)
+		}
+		matches := r.Matches
+		if len(matches) == 0 {
+			matches = []HTTPRouteMatch{{Path: &HTTPPathMatch{Type: "PathPrefix", Value: "/"}}}
+		}
+		for _, m := range matches {
+			if len(m.Headers) > 0 || len(m.QueryParams) > 0 {
+				return ing, fmt.Errorf("rule %d matches headers or query parameters, which Ingresses cannot match", i)
+			}
+			if m.Method != "" {
+				methods++
+			}
+			path := HTTPPathMatch{Type: "PathPrefix", Value: "/"}
+			if m.Path != nil {
+				path = *m.Path
+			}
+			key := pathKey{ingressPathTypes[path.Type], path.Value}
+			if prev, ok := backends[key]; ok {
+				if prev.Name != b.Name || prev.Port != b.Port {
+					return ing, fmt.Errorf("path %s is routed to both %s:%d and %s:%d by method; Ingresses cannot match methods", path.Value, prev.Name, prev.Port, b.Name, b.Port)
+				}
+				continue
+			}
+			backends[key] = b
+			rule.HTTP.Paths = append(rule.HTTP.Paths, ingressPath{
+				Path:     path.Value,
+				PathType: key.Type,
+				Backend:  ingressBackend{Service: ingressService{Name: b.Name, Port: ingressServicePort{Number: b.Port}}},
+			})
+		}
+	}
+	if methods > 0 {
+		fmt.Fprintf(os.Stderr, "WARNING: Ingress %s cannot match methods; %d method match(es) match every method\n", route.Metadata.Name, methods)
+	}
+	ing.Spec.Rules = []ingressRule{rule}
+	return ing, nil
+}
+
+// virtualService is an Istio networking.istio.io/v1 VirtualService.
+type virtualService struct {
+	APIVersion string             `yaml:"apiVersion"`
+	Kind       string             `yaml:"kind"`
+	Metadata   Metadata           `yaml:"metadata"`
+	Spec       virtualServiceSpec `yaml:"spec"`
+}
+
+type virtualServiceSpec struct {
+	Hosts    []string    `yaml:"hosts"`
+	Gateways []string    `yaml:"gateways,omitempty"`
+	HTTP     []istioHTTP `yaml:"http"`
+}
+
+type istioHTTP struct {
+	Match    []istioMatch        `yaml:"match,omitempty"`
+	Rewrite  *istioRewrite       `yaml:"rewrite,omitempty"`
+	Redirect *istioRedirect      `yaml:"redirect,omitempty"`
+	Mirror   *istioDestination   `yaml:"mirror,omitempty"`
+	Headers  *istioHeaders       `yaml:"headers,omitempty"`
+	Route    []istioRouteBackend `yaml:"route,omitempty"`
+	Timeout  string              `yaml:"timeout,omitempty"`
+	Retries  *istioRetries       `yaml:"retries,omitempty"`
+}
+
+// istioRetries is the retry policy of an HTTP route. An attempts of 0
+// would disable retries, so it is left out for a per-try timeout alone.
+type istioRetries struct {
+	Attempts      int    `yaml:"attempts,omitempty"`
+	PerTryTimeout string `yaml:"perTryTimeout,omitempty"`
+	RetryOn       string `yaml:"retryOn,omitempty"`
+}
+
+type istioMatch struct {
+	URI         istioStringMatch            `yaml:"uri"`
+	Method      *istioStringMatch           `yaml:"method,omitempty"`
+	Headers     map[string]istioStringMatch `yaml:"headers,omitempty"`
+	QueryParams map[string]istioStringMatch `yaml:"queryParams,omitempty"`
+}
+
+type istioStringMatch struct {
+	Exact  string `yaml:"exact,omitempty"`
+	Prefix string `yaml:"prefix,omitempty"`
+	Regex  string `yaml:"regex,omitempty"`
+}
+
+type istioRewrite struct {
+	URI             string             `yaml:"uri,omitempty"`
+	URIRegexRewrite *istioRegexRewrite `yaml:"uriRegexRewrite,omitempty"`
+}
+
+type istioRegexRewrite struct {
+	Match   string `yaml:"match"`
+	Rewrite string `yaml:"rewrite"`
+}
+
+type istioRedirect struct {
+	URI          string `yaml:"uri,omitempty"`
+	Authority    string `yaml:"authority,omitempty"`
+	Scheme       string `yaml:"scheme,omitempty"`
+	Port         int    `yaml:"port,omitempty"`
+	RedirectCode int    `yaml:"redirectCode,omitempty"`
+}
+
+type istioHeaders struct {
+	Request  *istioHeaderOps `yaml:"request,omitempty"`
+	Response *istioHeaderOps `yaml:"response,omitempty"`
+}
+
+type istioHeaderOps struct {
+	Set    map[string]string `yaml:"set,omitempty"`
+	Add    map[string]string `yaml:"add,omitempty"`
+	Remove []string          `yaml:"remove,omitempty"`
+}
+
+type istioRouteBackend struct {
+	Destination istioDestination `yaml:"destination"`
+	Weight      *int             `yaml:"weight,omitempty"`
+}
+
+type istioDestination struct {
+	Host string    `yaml:"host"`
+	Port istioPort `yaml:"port"`
+}
+
+type istioPort struct {
+	Number int `yaml:"number"`
+}
+
+// istioEntry is an HTTP route of a VirtualService with the Gateway API
+// precedence of its match, since Istio applies the first route that matches
+// while Gateway API prefers the most specific match.
+type istioEntry struct {
+	http  istioHTTP
+	match HTTPRouteMatch
+}
+
+// toVirtualService converts route to a VirtualService bound to the Istio
+// Gateways named by its parentRefs. Every match becomes its own HTTP route,
+// ordered by Gateway API precedence. A PathPrefix match is split into an
+// exact match and a match of the prefix with a trailing slash, since Istio
+// prefixes are not segment-aware.
+func toVirtualService(route HTTPRoute) (virtualService, error) {
+	vs := virtualService{
+		APIVersion: "networking.istio.io/v1",
+		Kind:       "VirtualService",
+		Metadata:   route.Metadata,
+		Spec:       virtualServiceSpec{Hosts: route.Spec.Hostnames},
+	}
+	if len(vs.Spec.Hosts) == 0 {
+		vs.Spec.Hosts = []string{"*"}
+	}
+	for _, p := range route.Spec.ParentRefs {
+		if p.SectionName != "" || p.Port != 0 {
+			return vs, fmt.Errorf("parent %s: VirtualServices attach to whole Gateways and cannot select a listener (drop --section-name and --gateway-port)", p.Name)
+		}
+		ns := p.Namespace
+		if ns == "" {
+			ns = route.Metadata.Namespace
+		}
+		vs.Spec.Gateways = append(vs.Spec.Gateways, ns+"/"+p.Name)
+	}
+
+	var entries []istioEntry
+	for i, r := range route.Spec.Rules {
+		base, rewrite, err := istioRule(r, route.Metadata.Namespace)
+		if err != nil {
+			return vs, fmt.Errorf("rule %d: %w", i, err)
+		}
+		matches := r.Matches
+		if len(matches) == 0 {
+			matches = []HTTPRouteMatch{{Path: &HTTPPathMatch{Type: "PathPrefix", Value: "/"}}}
+		}
+		for _, m := range matches {
+			for _, im := range istioMatches(m, rewrite) {
+				http := base
+				http.Match = []istioMatch{im.match}
+				http.Rewrite = im.rewrite
+				entries = append(entries, istioEntry{http: http, match: m})
+			}
+		}
+	}
+	sort.SliceStable(entries, func(i, j int) bool {
+		return istioPrecedes(entries[i].match, entries[j].match)
+	})
+	for _, e := range entries {
+		vs.Spec.HTTP = append(vs.Spec.HTTP, e.http)
+	}
+	return vs, nil
+}
+
+// istioRule converts the filters and backends of r, and returns its path
+// rewrite, which depends on the match it applies to.
+func istioRule(r HTTPRouteRule, namespace string) (istioHTTP, *PathRewrite, error) {
+	var http istioHTTP
+	var rewrite *PathRewrite
+	for _, f := range r.Filters {
+		switch {
+		case f.URLRewrite != nil && f.URLRewrite.Path != nil:
+			rewrite = f.URLRewrite.Path
+		case f.RequestHeaderModifier != nil:
+			if http.Headers == nil {
+				http.Headers = &istioHeaders{}
+			}
+			http.Headers.Request = istioHeaderOpsOf(f.RequestHeaderModifier)
+		case f.ResponseHeaderModifier != nil:
+			if http.Headers == nil {
+				http.Headers = &istioHeaders{}
+			}
+			http.Headers.Response = istioHeaderOpsOf(f.ResponseHeaderModifier)
+		case f.RequestRedirect != nil:
+			rd := f.RequestRedirect
+			if rd.Path != nil && rd.Path.Type != "ReplaceFullPath" {
+				return http, nil, fmt.Errorf("redirect %s has no VirtualService equivalent", rd.Path.Type)
+			}
+			http.Redirect = &istioRedirect{Authority: rd.Hostname, Scheme: rd.Scheme, Port: rd.Port, RedirectCode: rd.StatusCode}
+			if rd.Path != nil {
+				http.Redirect.URI = rd.Path.ReplaceFullPath
+			}
+		case f.RequestMirror != nil:
+			dest, err := istioDestinationOf(f.RequestMirror.BackendRef, namespace)
+			if err != nil {
+				return http, nil, err
+			}
+			http.Mirror = &dest
+		default:
+			return http, nil, fmt.Errorf("filter %s has no VirtualService equivalent", f.Type)
+		}
+	}
+	if http.Redirect != nil {
+		return http, rewrite, nil
+	}
+	if err := istioPolicy(&http, r); err != nil {
+		return http, nil, err
+	}
+	weights := istioWeights(r.BackendRefs)
+	for i, b := range r.BackendRefs {
+		dest, err := istioDestinationOf(b, namespace)
+		if err != nil {
+			return http, nil, err
+		}
+		backend := istioRouteBackend{Destination: dest}
+		if len(r.BackendRefs) > 1 {
+			backend.Weight = &weights[i]
+		}
+		http.Route = append(http.Route, backend)
+	}
+	return http, rewrite, nil
+}
+
+// istioPolicy sets the timeouts and retries of r on http. The backend
+// request timeout is Istio's per-try timeout; Istio has no retry backoff.
+func istioPolicy(http *istioHTTP, r HTTPRouteRule) error {
+	if t := r.Timeouts; t != nil {
+		http.Timeout = t.Request
+		if t.BackendRequest != "" {
+			http.Retries = &istioRetries{PerTryTimeout: t.BackendRequest}
+		}
+	}
+	if r.Retry == nil {
+		return nil
+	}
+	if r.Retry.Backoff != "" {
+		return fmt.Errorf("retry backoff %s has no VirtualService equivalent", r.Retry.Backoff)
+	}
+	if http.Retries == nil {
+		http.Retries = &istioRetries{}
+	}
+	http.Retries.Attempts = r.Retry.Attempts
+	codes := make([]string, len(r.Retry.Codes))
+	for i, c := range r.Retry.Codes {
+		codes[i] = strconv.Itoa(c)
+	}
+	http.Retries.RetryOn = strings.Join(codes, ",")
+	return nil
+}
+
+// istioMatchRewrite is one Istio match of a Gateway API match, with the
+// path rewrite that applies to it.
+type istioMatchRewrite struct {
+	match   istioMatch
+	rewrite *istioRewrite
+}
+
+// istioMatches converts m, splitting a PathPrefix into the exact path and
+// the prefix below it so "/api" does not match "/apix".
+func istioMatches(m HTTPRouteMatch, rewrite *PathRewrite) []istioMatchRewrite {
+	base := istioMatch{}
+	if m.Method != "" {
+		base.Method = &istioStringMatch{Exact: m.Method}
+	}
+	for _, h := range m.Headers {
+		if base.Headers == nil {
+			base.Headers = make(map[string]istioStringMatch)
+		}
+		base.Headers[strings.ToLower(h.Name)] = istioValueMatch(h.Type, h.Value)
+	}
+	for _, q := range m.QueryParams {
+		if base.QueryParams == nil {
+			base.QueryParams = make(map[string]istioStringMatch)
+		}
+		base.QueryParams[q.Name] = istioValueMatch(q.Type, q.Value)
+	}
+
+	path := HTTPPathMatch{Type: "PathPrefix", Value: "/"}
+	if m.Path != nil {
+		path = *m.Path
+	}
+	fullPath := func() *istioRewrite {
+		if rewrite == nil {
+			return nil
+		}
+		if rewrite.Type == "ReplaceFullPath" {
+			return &istioRewrite{URIRegexRewrite: &istioRegexRewrite{Match: ".*", Rewrite: rewrite.ReplaceFullPath}}
+		}
+		return &istioRewrite{URI: rewrite.ReplacePrefixMatch}
+	}
+	switch path.Type {
+	case "Exact":
+		base.URI = istioStringMatch{Exact: path.Value}
+	case "RegularExpression":
+		base.URI = istioStringMatch{Regex: path.Value}
+	default:
+		if strings.HasSuffix(path.Value, "/") {
+			base.URI = istioStringMatch{Prefix: path.Value}
+			return []istioMatchRewrite{{base, fullPath()}}
+		}
+		exact, below := base, base
+		exact.URI = istioStringMatch{Exact: path.Value}
+		below.URI = istioStringMatch{Prefix: path.Value + "/"}
+		belowRewrite := fullPath()
+		if rewrite != nil && rewrite.Type != "ReplaceFullPath" {
+			belowRewrite = &istioRewrite{URI: strings.TrimSuffix(rewrite.ReplacePrefixMatch, "/") + "/"}
+		}
+		return []istioMatchRewrite{{exact, fullPath()}, {below, belowRewrite}}
+	}
+	return []istioMatchRewrite{{base, fullPath()}}
+}
+
+func istioValueMatch(matchType, value string) istioStringMatch {
+	if matchType == "RegularExpression" {
+		return istioStringMatch{Regex: value}
+	}
+	return istioStringMatch{Exact: value}
+}
+
+func istioHeaderOpsOf(f *HTTPHeaderFilter) *istioHeaderOps {
+	ops := &istioHeaderOps{Remove: f.Remove}
+	for _, h := range f.Set {
+		if ops.Set == nil {
+			ops.Set = make(map[string]string)
+		}
+		ops.Set[h.Name] = h.Value
+	}
+	for _, h := range f.Add {
+		if ops.Add == nil {
+			ops.Add = make(map[string]string)
+		}
+		ops.Add[h.Name] = h.Value
+	}
+	return ops
+}
+
+// istioDestinationOf addresses the Service of b by its cluster DNS name.
+func istioDestinationOf(b BackendRef, namespace string) (istioDestination, error) {
+	if b.Kind != "" && b.Kind != "Service" {
+		return istioDestination{}, fmt.Errorf("backend %s is a %s; VirtualService destinations are Services", b.Name, b.Kind)
+	}
+	if b.Namespace != "" {
+		namespace = b.Namespace
+	}
+	return istioDestination{Host: b.Name + "." + namespace + ".svc.cluster.local", Port: istioPort{Number: b.Port}}, nil
+}
+
+// istioWeights converts the weights of backends, 1 when unset and 0 for
+// standby backends, into the percentages Istio requires, which add up to
+// 100. Remainders go to the largest fractions first.
+func istioWeights(backends []BackendRef) []int {
+	weights := make([]int, len(backends))
+	total := 0
+	for i, b := range backends {
+		switch {
+		case b.Standby:
+		case b.Weight == 0:
+			weights[i] = 1
+		default:
+			weights[i] = b.Weight
+		}
+		total += weights[i]
+	}
+	if total == 0 {
+		return weights
+	}
+	percents := make([]int, len(backends))
+	order := make([]int, len(backends))
+	left := 100
+	for i, w := range weights {
+		percents[i] = w * 100 / total
+		left -= percents[i]
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool {
+		return weights[order[a]]*100%total > weights[order[b]]*100%total
+	})
+	for _, i := range order[:left] {
+		percents[i]++
+	}
+	return percents
+}
+
+// istioPrecedes orders matches as Gateway API does: exact paths, then
+// regular expressions, then the longest prefixes, then matches with a
+// method, more headers, and more query parameters.
+func istioPrecedes(a, b HTTPRouteMatch) bool {
+	rank := func(m HTTPRouteMatch) (int, int) {
+		if m.Path == nil {
+			return 2, 1
+		}
+		switch m.Path.Type {
+		case "Exact":
+			return 0, len(m.Path.Value)
+		case "RegularExpression":
+			return 1, len(m.Path.Value)
+		}
+		return 2, len(m.Path.Value)
+	}
+	ra, la := rank(a)
+	rb, lb := rank(b)
+	switch {
+	case ra != rb:
+		return ra < rb
+	case la != lb:
+		return la > lb
+	case (a.Method != "") != (b.Method != ""):
+		return a.Method != ""
+	case len(a.Headers) != len(b.Headers):
+		return len(a.Headers) > len(b.Headers)
+	}
+	return len(a.QueryParams) > len(b.QueryParams)
+}
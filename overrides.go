@@ -0,0 +1,219 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/pflag"
+	"gopkg.in/yaml.v3"
+)
+
+// csvSettings are the settings of the --config file that apply to whole
+// CSVs, replacing the flags of the same name.
+type csvSettings struct {
+	Service          string            `yaml:"service,omitempty"`
+	Port             int               `yaml:"port,omitempty"`
+	ServiceNamespace string            `yaml:"serviceNamespace,omitempty"`
+	Namespace        string            `yaml:"namespace,omitempty"`
+	Gateway          string            `yaml:"gateway,omitempty"`
+	GatewayNamespace string            `yaml:"gatewayNamespace,omitempty"`
+	Hostname         string            `yaml:"hostname,omitempty"`
+	Labels           map[string]string `yaml:"labels,omitempty"`
+}
+
+// fileOverride is an entry of the files section of the --config file: the
+// settings of the CSVs whose file name matches Pattern.
+type fileOverride struct {
+	Pattern  string
+	Settings csvSettings
+}
+
+var (
+	// configDefaults replace the defaults of the flags not given on the
+	// command line.
+	configDefaults csvSettings
+	// fileOverrides are the files section, in the order of the file.
+	fileOverrides []fileOverride
+	// commandFlags are the flags of the running command, to tell the flags
+	// given on the command line from their defaults.
+	commandFlags *pflag.FlagSet
+	// fileLabels are the labels of the routes of the CSV being processed.
+	fileLabels map[string]string
+)
+
+// loadCSVSettings reads the defaults and files sections of the config file.
+// files is a mapping kept in document order, since later entries win.
+func loadCSVSettings(defaults csvSettings, files yaml.Node) error {
+	configDefaults, fileOverrides = csvSettings{}, nil
+	if err := defaults.validate("defaults"); err != nil {
+		return err
+	}
+	configDefaults = defaults
+	if files.Kind == 0 {
+		return nil
+	}
+	if files.Kind != yaml.MappingNode {
+		return fmt.Errorf("config file: files must map CSV names or globs to settings")
+	}
+	for i := 0; i+1 < len(files.Content); i += 2 {
+		pattern := files.Content[i].Value
+		if _, err := filepath.Match(pattern, ""); err != nil {
+			return fmt.Errorf("config file: files: invalid pattern %q", pattern)
+		}
+		var settings csvSettings
+		if err := files.Content[i+1].Decode(&settings); err != nil {
+			return fmt.Errorf("config file: files: %s: %w", pattern, err)
+		}
+		if err := settings.validate("files: " + pattern); err != nil {
+			return err
+		}
+		fileOverrides = append(fileOverrides, fileOverride{Pattern: pattern, Settings: settings})
+	}
+	return nil
+}
+
+func (s csvSettings) validate(section string) error {
+	if s.Port != 0 && (s.Port < 1 || s.Port > 65535) {
+		return fmt.Errorf("config file: %s: invalid port %d", section, s.Port)
+	}
+	return nil
+}
+
+// matches reports whether the CSV at path is selected by the override.
+func (o fileOverride) matches(path string) bool {
+	ok, _ := filepath.Match(o.Pattern, filepath.Base(path))
+	return ok
+}
+
+// metaSuffix ends the name of the settings sidecar of a CSV, such as
+// payments.meta.yaml for payments.csv.
+const metaSuffix = ".meta.yaml"
+
+// sidecarMetaPath returns the settings sidecar of a CSV, named like its
+// schema sidecar.
+func sidecarMetaPath(csvPath string) string {
+	return csvPath[:len(csvPath)-len(filepath.Base(csvPath))] + csvBaseName(csvPath) + metaSuffix
+}
+
+// isSidecarFile reports whether name is the schema or settings sidecar of a
+// CSV rather than an input.
+func isSidecarFile(name string) bool {
+	name = strings.ToLower(plainName(name))
+	return strings.HasSuffix(name, ".schema.yaml") || strings.HasSuffix(name, metaSuffix)
+}
+
+// loadSidecarMeta reads the settings sidecar of csvPath, or returns nil when
+// there is none.
+func loadSidecarMeta(ctx context.Context, csvPath string) (*csvSettings, error) {
+	path := sidecarMetaPath(csvPath)
+	data, err := readInput(ctx, path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var settings csvSettings
+	if err := yaml.Unmarshal(data, &settings); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	if settings.Port != 0 && (settings.Port < 1 || settings.Port > 65535) {
+		return nil, fmt.Errorf("%s: invalid port %d", path, settings.Port)
+	}
+	return &settings, nil
+}
+
+// applyCSVSettings sets the flags for the CSV at path: the config defaults
+// for the flags not given on the command line, then every matching files
+// entry in order, as profiles do, then the settings sidecar of the CSV. A
+// gateway without a namespace is looked up in the namespace of the route.
+// The returned function restores the flags.
+func applyCSVSettings(ctx context.Context, path string) (func(), error) {
+	sidecar, err := loadSidecarMeta(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+	saved := []*string{&serviceName, &serviceNamespace, &namespace, &gatewayName, &gatewayNamespace, &hostname}
+	values := make([]string, len(saved))
+	for i, p := range saved {
+		values[i] = *p
+	}
+	port := servicePort
+
+	configDefaults.apply(true)
+	fileLabels = maps.Clone(configDefaults.Labels)
+	for _, o := range fileOverrides {
+		if !o.matches(path) {
+			continue
+		}
+		o.Settings.apply(false)
+		if len(o.Settings.Labels) > 0 && fileLabels == nil {
+			fileLabels = make(map[string]string)
+		}
+		maps.Copy(fileLabels, o.Settings.Labels)
+	}
+	if sidecar != nil {
+		sidecar.apply(false)
+		if len(sidecar.Labels) > 0 && fileLabels == nil {
+			fileLabels = make(map[string]string)
+		}
+		maps.Copy(fileLabels, sidecar.Labels)
+	}
+
+	return func() {
+		for i, p := range saved {
+			*p = values[i]
+		}
+		servicePort = port
+		fileLabels = nil
+	}, nil
+}
+
+// apply sets the flags to the settings s has. Defaults leave the flags
+// given on the command line alone.
+func (s csvSettings) apply(defaults bool) {
+	set := func(flag string, value *string, v string) {
+		if v != "" && !(defaults && flagGiven(flag)) {
+			*value = v
+		}
+	}
+	set("service", &serviceName, s.Service)
+	set("service-namespace", &serviceNamespace, s.ServiceNamespace)
+	set("namespace", &namespace, s.Namespace)
+	set("hostname", &hostname, s.Hostname)
+	if s.Gateway != "" && !(defaults && flagGiven("gateway")) {
+		gatewayName = s.Gateway
+		if !defaults || !flagGiven("gateway-namespace") {
+			gatewayNamespace = ""
+		}
+	}
+	set("gateway-namespace", &gatewayNamespace, s.GatewayNamespace)
+	if s.Port != 0 && !(defaults && flagGiven("port")) {
+		servicePort = s.Port
+	}
+}
+
+// flagGiven reports whether the flag was set on the command line.
+func flagGiven(name string) bool {
+	return commandFlags != nil && commandFlags.Changed(name)
+}
+
+// applyFileLabels adds the labels of the CSV's settings to route. Labels a
+// profile already set are kept, since the profile is the more specific.
+func applyFileLabels(route *HTTPRoute) {
+	if len(fileLabels) == 0 {
+		return
+	}
+	if route.Metadata.Labels == nil {
+		route.Metadata.Labels = make(map[string]string)
+	}
+	for k, v := range fileLabels {
+		if _, ok := route.Metadata.Labels[k]; !ok {
+			route.Metadata.Labels[k] = v
+		}
+	}
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ownerRule assigns a path prefix, optionally on one hostname, to a team.
+type ownerRule struct {
+	Prefix   string `yaml:"prefix"`
+	Hostname string `yaml:"hostname,omitempty"`
+	Team     string `yaml:"team"`
+}
+
+// ownersConfig is the --owners-file layout.
+type ownersConfig struct {
+	Owners []ownerRule `yaml:"owners"`
+}
+
+var (
+	ownersFile string
+	ownerRules []ownerRule
+)
+
+func loadOwnersFile(ctx context.Context, path string) error {
+	ownerRules = nil
+	if path == "" {
+		return nil
+	}
+	data, err := readInput(ctx, path)
+	if err != nil {
+		return fmt.Errorf("failed to read owners file: %w", err)
+	}
+	var cfg ownersConfig
+	if err := yaml.Unmarshal(data, &cfg); err != nil {
+		return fmt.Errorf("failed to parse owners file %s: %w", path, err)
+	}
+	seen := make(map[string]bool)
+	for i, o := range cfg.Owners {
+		if !strings.HasPrefix(o.Prefix, "/") {
+			return fmt.Errorf("owners file entry %d: prefix %q must start with /", i+1, o.Prefix)
+		}
+		if ownerSlug(o.Team) == "" {
+			return fmt.Errorf("owners file entry %d: team is required", i+1)
+		}
+		key := o.Hostname + o.Prefix
+		if seen[key] {
+			return fmt.Errorf("owners file entry %d: duplicate prefix %s", i+1, key)
+		}
+		seen[key] = true
+	}
+	ownerRules = cfg.Owners
+	return nil
+}
+
+// ownerOf returns the rule with the longest prefix covering e on its route
+// hostname, or nil. Rules without a hostname apply to every hostname; a rule
+// for the row's hostname wins over one without at the same prefix length.
+func ownerOf(e Endpoint) *ownerRule {
+	host := claimOf(e).Target.Hostname
+	var best *ownerRule
+	for i := range ownerRules {
+		o := &ownerRules[i]
+		if o.Hostname != "" && o.Hostname != host {
+			continue
+		}
+		if !hasPathPrefix(e.Prefix, o.Prefix) && !hasPathPrefix(e.URL, o.Prefix) {
+			continue
+		}
+		if best == nil || len(o.Prefix) > len(best.Prefix) || (len(o.Prefix) == len(best.Prefix) && o.Hostname != "") {
+			best = o
+		}
+	}
+	return best
+}
+
+// checkOwnership fails rows under a prefix owned by another team than the
+// row's owner column, so a CSV cannot take over routes of the shared gateway
+// by accident. Owners compare by slug, so "@acme/payments" owns what
+// "payments" does.
+func checkOwnership(endpoints []Endpoint) error {
+	for _, e := range endpoints {
+		o := ownerOf(e)
+		if o == nil {
+			continue
+		}
+		where := o.Prefix
+		if o.Hostname != "" {
+			where = o.Hostname + o.Prefix
+		}
+		if e.Owner == "" {
+			return fmt.Errorf("line %d: %s is owned by %s; set the owner column to claim it", e.Line, where, o.Team)
+		}
+		if ownerSlug(e.Owner) != ownerSlug(o.Team) {
+			return fmt.Errorf("line %d: %s is owned by %s, not %s", e.Line, where, o.Team, e.Owner)
+		}
+	}
+	return nil
+}
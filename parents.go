@@ -0,0 +1,133 @@
+package main
+
+import (
+	"cmp"
+	"fmt"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+var (
+	// gatewaySection and gatewayPort are --section-name and --gateway-port:
+	// the listener of the --gateway parents without a section of their own.
+	gatewaySection string
+	gatewayPort    int
+	// extraGateways are the values of repeated --gateway flags, resolved
+	// into extraParents by validateParentRefs.
+	extraGateways []string
+	extraParents  []ParentRef
+	// primarySection is the listener of the first --gateway parent.
+	primarySection string
+)
+
+// gatewayFlag is the value of --gateway. The first value replaces the
+// default parent Gateway, and each repetition adds one more.
+type gatewayFlag struct{ changed bool }
+
+func (f *gatewayFlag) Set(v string) error {
+	if !f.changed {
+		gatewayName, f.changed = v, true
+		return nil
+	}
+	extraGateways = append(extraGateways, v)
+	return nil
+}
+
+func (f *gatewayFlag) String() string {
+	return strings.Join(append([]string{gatewayName}, extraGateways...), ",")
+}
+
+func (f *gatewayFlag) Type() string { return "string" }
+
+// parseGatewayRef reads a --gateway value, name[:namespace[:sectionName]].
+// An empty namespace, as in "public::https", is the gateway namespace.
+func parseGatewayRef(v string) (ParentRef, error) {
+	parts := strings.Split(v, ":")
+	if len(parts) > 3 || parts[0] == "" {
+		return ParentRef{}, fmt.Errorf("invalid --gateway %q (want name[:namespace[:sectionName]])", v)
+	}
+	ref := ParentRef{Group: "gateway.networking.k8s.io", Kind: "Gateway", Name: parts[0]}
+	if len(parts) > 1 {
+		ref.Namespace = parts[1]
+	}
+	if len(parts) > 2 {
+		ref.SectionName = parts[2]
+		if ref.SectionName == "" {
+			return ParentRef{}, fmt.Errorf("invalid --gateway %q: empty sectionName", v)
+		}
+	}
+	for _, s := range []string{ref.Name, ref.Namespace, ref.SectionName} {
+		if s != "" && len(validation.IsDNS1123Subdomain(s)) > 0 {
+			return ParentRef{}, fmt.Errorf("invalid --gateway %q: %q is not a valid name", v, s)
+		}
+	}
+	return ref, nil
+}
+
+// validateParentRefs resolves the --gateway values into the parent Gateway
+// and the extra parents, and checks --section-name and --gateway-port.
+func validateParentRefs() error {
+	if gatewaySection != "" && len(validation.IsDNS1123Subdomain(gatewaySection)) > 0 {
+		return fmt.Errorf("invalid --section-name %q (must be a listener name)", gatewaySection)
+	}
+	if gatewayPort < 0 || gatewayPort > 65535 {
+		return fmt.Errorf("invalid --gateway-port %d (must be 1-65535)", gatewayPort)
+	}
+	primary, err := parseGatewayRef(gatewayName)
+	if err != nil {
+		return err
+	}
+	gatewayName = primary.Name
+	if primary.Namespace != "" {
+		gatewayNamespace = primary.Namespace
+	}
+	primarySection = cmp.Or(primary.SectionName, gatewaySection)
+
+	extraParents = nil
+	seen := map[ParentRef]bool{{Name: gatewayName, Namespace: gatewayNamespace, SectionName: primarySection}: true}
+	for _, v := range extraGateways {
+		ref, err := parseGatewayRef(v)
+		if err != nil {
+			return err
+		}
+		ref.SectionName = cmp.Or(ref.SectionName, gatewaySection)
+		ref.Port = gatewayPort
+		key := ParentRef{Name: ref.Name, Namespace: cmp.Or(ref.Namespace, gatewayNamespace), SectionName: ref.SectionName}
+		if seen[key] {
+			return fmt.Errorf("--gateway %s is given twice", v)
+		}
+		seen[key] = true
+		extraParents = append(extraParents, ref)
+	}
+	return nil
+}
+
+// usesGatewayFlags reports whether target attaches to the parent Gateway
+// of the flags or the config, rather than to one of a --domain-map entry,
+// a directive, or a profile. Only those routes have the listener and the
+// extra parents of the flags.
+func (t routeTarget) usesGatewayFlags() bool {
+	return t.Gateway == gatewayName && t.GatewayNamespace == gatewayNamespace
+}
+
+// routeNamespace is the namespace of the routes of target.
+func (t routeTarget) routeNamespace() string {
+	return cmp.Or(t.Namespace, namespace)
+}
+
+// targetParents are the parentRefs of a GRPCRoute or TLSRoute for target,
+// as convert.Build attaches HTTPRoutes.
+func targetParents(target routeTarget) []ParentRef {
+	ns := cmp.Or(target.GatewayNamespace, target.routeNamespace())
+	parents := []ParentRef{{Group: "gateway.networking.k8s.io", Kind: "Gateway", Name: target.Gateway, Namespace: ns}}
+	if !target.usesGatewayFlags() {
+		return parents
+	}
+	parents[0].SectionName, parents[0].Port = primarySection, gatewayPort
+	for _, p := range extraParents {
+		p.Namespace = cmp.Or(p.Namespace, ns)
+		parents = append(parents, p)
+	}
+	return parents
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// partitionOwner is the only --partition-by key so far.
+const partitionOwner = "owner"
+
+var partitionBy string
+
+// partitionDirs maps generated route names to their subdirectory of the
+// output directory, so every file written for a route lands in its team's
+// directory.
+var partitionDirs = make(map[string]string)
+
+func validatePartitionBy(key string) error {
+	if key == "" || key == partitionOwner {
+		return nil
+	}
+	return fmt.Errorf("invalid --partition-by %q (must be %s)", key, partitionOwner)
+}
+
+// ownerGroup is the endpoints of one owner, in first-appearance order.
+type ownerGroup struct {
+	Owner     string
+	Endpoints []Endpoint
+}
+
+// partitionByOwner splits endpoints by their owner column. Without
+// --partition-by all endpoints form one group with no owner.
+func partitionByOwner(endpoints []Endpoint) []ownerGroup {
+	if partitionBy != partitionOwner {
+		return []ownerGroup{{Endpoints: endpoints}}
+	}
+	var groups []ownerGroup
+	index := make(map[string]int)
+	for _, e := range endpoints {
+		i, ok := index[e.Owner]
+		if !ok {
+			i = len(groups)
+			index[e.Owner] = i
+			groups = append(groups, ownerGroup{Owner: e.Owner})
+		}
+		groups[i].Endpoints = append(groups[i].Endpoints, e)
+	}
+	return groups
+}
+
+// ownerSlug turns an owner such as "Team Payments" or "@org/payments" into a
+// name usable in route names and directories.
+func ownerSlug(owner string) string {
+	s := strings.TrimPrefix(strings.ToLower(owner), "@")
+	if i := strings.LastIndex(s, "/"); i >= 0 {
+		s = s[i+1:]
+	}
+	return strings.Trim(nonSlugChars.ReplaceAllString(s, "-"), "-")
+}
+
+// ensureRouteDir creates the partition directory of a route, if it has one.
+func ensureRouteDir(name string) error {
+	if dir := partitionDirs[name]; dir != "" {
+		return ensureOutputDir(filepath.Join(outputDir, dir))
+	}
+	return nil
+}
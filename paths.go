@@ -0,0 +1,73 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// windowsReserved are device names Windows refuses as file names, with or
+// without an extension.
+var windowsReserved = map[string]bool{
+	"CON": true, "PRN": true, "AUX": true, "NUL": true,
+	"COM1": true, "COM2": true, "COM3": true, "COM4": true, "COM5": true,
+	"COM6": true, "COM7": true, "COM8": true, "COM9": true,
+	"LPT1": true, "LPT2": true, "LPT3": true, "LPT4": true, "LPT5": true,
+	"LPT6": true, "LPT7": true, "LPT8": true, "LPT9": true,
+}
+
+// isCSVFile reports whether name has a .csv extension, ignoring case so
+// exports named FILE.CSV on Windows are picked up too. age-encrypted
+// inventories named FILE.csv.age count as well.
+func isCSVFile(name string) bool {
+	return strings.EqualFold(filepath.Ext(plainName(name)), ".csv")
+}
+
+// csvBaseName returns the file name of path without its .csv (or .csv.age)
+// extension, or the .yaml, .yml or .json extension of an OpenAPI document.
+// A web.config is named after its directory.
+func csvBaseName(path string) string {
+	if name, ok := actuatorRouteName(path); ok && inputFormat == formatActuator {
+		return name
+	}
+	if name, ok := iisRouteName(path); ok && inputFormat == formatIIS {
+		return name
+	}
+	base := filepath.Base(plainName(path))
+	if isCSVFile(base) || isSpecFile(base) || (inputFormat == formatIIS && isInputFile(base)) {
+		base = base[:len(base)-len(filepath.Ext(base))]
+	}
+	return base
+}
+
+// outputPath joins a generated file name onto the output directory. The name
+// is made safe on every platform, since output produced on Linux is routinely
+// checked out on Windows: separators and characters Windows rejects are
+// replaced, trailing dots and spaces are dropped, and reserved device names
+// such as CON get an underscore suffix. Routes split by --partition-by go
+// into their partition's subdirectory.
+func outputPath(name, ext string) string {
+	if dir := partitionDirs[name]; dir != "" {
+		return filepath.Join(outputDir, dir, safeFileName(name)+ext)
+	}
+	return filepath.Join(outputDir, safeFileName(name)+ext)
+}
+
+func safeFileName(name string) string {
+	var b strings.Builder
+	for _, r := range name {
+		if r < 0x20 || strings.ContainsRune(`<>:"/\|?*`, r) {
+			b.WriteRune('_')
+			continue
+		}
+		b.WriteRune(r)
+	}
+	s := strings.TrimRight(b.String(), ". ")
+	if s == "" {
+		s = "_"
+	}
+	stem, _, _ := strings.Cut(s, ".")
+	if windowsReserved[strings.ToUpper(stem)] {
+		s = stem + "_" + s[len(stem):]
+	}
+	return s
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// pathCompiler turns the URL cell of a row into the path matches of its
+// direct-match rule. New syntaxes are added by registering a compiler in
+// init; the generator only sees the matches.
+type pathCompiler interface {
+	Compile(url string) ([]HTTPPathMatch, error)
+}
+
+// pathCompilerFunc adapts a function to pathCompiler.
+type pathCompilerFunc func(url string) ([]HTTPPathMatch, error)
+
+func (f pathCompilerFunc) Compile(url string) ([]HTTPPathMatch, error) { return f(url) }
+
+// pathCompilers is the registry of --path-syntax values.
+var pathCompilers = make(map[string]pathCompiler)
+
+func registerPathCompiler(name string, c pathCompiler) {
+	if _, dup := pathCompilers[name]; dup {
+		panic("path syntax registered twice: " + name)
+	}
+	pathCompilers[name] = c
+}
+
+func init() {
+	registerPathCompiler("plain", pathCompilerFunc(compilePlainPath))
+	registerPathCompiler("template", pathCompilerFunc(compileTemplatePath))
+	registerPathCompiler("glob", pathCompilerFunc(compileGlobPath))
+	registerPathCompiler("regex", pathCompilerFunc(compileRegexPath))
+}
+
+var (
+	pathSyntax         string
+	activePathCompiler pathCompiler
+)
+
+// loadPathSyntax selects the compiler named by --path-syntax.
+func loadPathSyntax(name string) error {
+	c, ok := pathCompilers[name]
+	if !ok {
+		names := make([]string, 0, len(pathCompilers))
+		for n := range pathCompilers {
+			names = append(names, n)
+		}
+		sort.Strings(names)
+		return fmt.Errorf("invalid --path-syntax %q (must be one of %s)", name, strings.Join(names, ", "))
+	}
+	activePathCompiler = c
+	return nil
+}
+
+// compilePath compiles the URL of a row with the selected syntax.
+func compilePath(url string) ([]HTTPPathMatch, error) {
+	if activePathCompiler == nil {
+		return compilePlainPath(url)
+	}
+	return activePathCompiler.Compile(url)
+}
+
+// compilePlainPath matches the URL literally, with --default-match-type.
+func compilePlainPath(url string) ([]HTTPPathMatch, error) {
+	return []HTTPPathMatch{{Type: directMatchType, Value: url}}, nil
+}
+
+// pathRegex wraps the expression of a whole path. Gateway API expressions
+// match the full path, so a PathPrefix direct match also accepts anything
+// below it, as a plain PathPrefix match would.
+func pathRegex(expr string) []HTTPPathMatch {
+	if directMatchType != "Exact" {
+		expr += "(/.*)?"
+	}
+	return []HTTPPathMatch{{Type: "RegularExpression", Value: expr}}
+}
+
+// templateParam is a "{name}" path template parameter.
+var templateParam = regexp.MustCompile(`\{[A-Za-z_][A-Za-z0-9_]*\}`)
+
+// compileTemplatePath turns parameters such as /users/{id} into a regular
+// expression matching one path segment each. URLs without parameters stay
+// plain matches.
+func compileTemplatePath(url string) ([]HTTPPathMatch, error) {
+	locs := templateParam.FindAllStringIndex(url, -1)
+	if locs == nil {
+		if strings.ContainsAny(url, "{}") {
+			return nil, fmt.Errorf("invalid path template %q (parameters look like {name})", url)
+		}
+		return compilePlainPath(url)
+	}
+	var b strings.Builder
+	last := 0
+	for _, loc := range locs {
+		literal := url[last:loc[0]]
+		if strings.ContainsAny(literal, "{}") {
+			return nil, fmt.Errorf("invalid path template %q (parameters look like {name})", url)
+		}
+		b.WriteString(regexp.QuoteMeta(literal))
+		b.WriteString("[^/]+")
+		last = loc[1]
+	}
+	rest := url[last:]
+	if strings.ContainsAny(rest, "{}") {
+		return nil, fmt.Errorf("invalid path template %q (parameters look like {name})", url)
+	}
+	b.WriteString(regexp.QuoteMeta(rest))
+	return pathRegex(b.String()), nil
+}
+
+// compileGlobPath supports "*" (within one segment), "**" (any number of
+// segments) and "?" (one character). URLs without wildcards stay plain
+// matches.
+func compileGlobPath(url string) ([]HTTPPathMatch, error) {
+	if !strings.ContainsAny(url, "*?") {
+		return compilePlainPath(url)
+	}
+	var b strings.Builder
+	for i := 0; i < len(url); i++ {
+		switch {
+		case strings.HasPrefix(url[i:], "**"):
+			b.WriteString(".*")
+			i++
+		case url[i] == '*':
+			b.WriteString("[^/]*")
+		case url[i] == '?':
+			b.WriteString("[^/]")
+		default:
+			b.WriteString(regexp.QuoteMeta(url[i : i+1]))
+		}
+	}
+	return pathRegex(b.String()), nil
+}
+
+// compileRegexPath uses the URL as a RE2 expression over the whole path.
+func compileRegexPath(url string) ([]HTTPPathMatch, error) {
+	if _, err := regexp.Compile(url); err != nil {
+		return nil, fmt.Errorf("invalid path expression %q: %w", url, err)
+	}
+	return []HTTPPathMatch{{Type: "RegularExpression", Value: url}}, nil
+}
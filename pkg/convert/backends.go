@@ -0,0 +1,119 @@
+package convert
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// SplitBackend is one entry of the backends column: a Service of the row's
+// namespace and kind, and its share of the traffic.
+type SplitBackend struct {
+	Service string
+	Port    int
+	Weight  int
+}
+
+// ParseBackends parses a backends cell: service:port[:weight] entries
+// separated by ";", such as "svc-v1:80:90;svc-v2:80:10". The weight
+// defaults to 1; a weight of 0 keeps the backend on standby.
+func ParseBackends(v string) ([]SplitBackend, error) {
+	var backends []SplitBackend
+	for _, entry := range strings.Split(v, ";") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		parts := strings.Split(entry, ":")
+		if len(parts) < 2 || len(parts) > 3 || parts[0] == "" {
+			return nil, fmt.Errorf("invalid backends entry %q (want service:port[:weight])", entry)
+		}
+		b := SplitBackend{Service: parts[0], Weight: 1}
+		port, err := strconv.Atoi(parts[1])
+		if err != nil || port < 1 || port > 65535 {
+			return nil, fmt.Errorf("invalid port in backends entry %q", entry)
+		}
+		b.Port = port
+		if len(parts) == 3 {
+			weight, err := strconv.Atoi(parts[2])
+			if err != nil || weight < 0 || weight > 1000000 {
+				return nil, fmt.Errorf("invalid weight in backends entry %q (must be 0-1000000)", entry)
+			}
+			b.Weight = weight
+		}
+		if slices.ContainsFunc(backends, func(o SplitBackend) bool { return o.Service == b.Service && o.Port == b.Port }) {
+			return nil, fmt.Errorf("backends lists %s:%d twice", b.Service, b.Port)
+		}
+		backends = append(backends, b)
+	}
+	if len(backends) < 2 {
+		return nil, fmt.Errorf("invalid backends %q (want at least two service:port:weight entries; use the service column for one)", v)
+	}
+	if !slices.ContainsFunc(backends, func(b SplitBackend) bool { return b.Weight > 0 }) {
+		return nil, fmt.Errorf("invalid backends %q (every weight is 0)", v)
+	}
+	return backends, nil
+}
+
+// FormatBackends is the backends cell of backends, in the form
+// ParseBackends reads.
+func FormatBackends(backends []SplitBackend) string {
+	entries := make([]string, len(backends))
+	for i, b := range backends {
+		entries[i] = fmt.Sprintf("%s:%d:%d", b.Service, b.Port, b.Weight)
+	}
+	return strings.Join(entries, ";")
+}
+
+// checkBackends rejects the columns the backends column replaces or cannot
+// be combined with.
+func checkBackends(e Endpoint) error {
+	if e.Backends == "" {
+		return nil
+	}
+	switch {
+	case e.Service != "" || e.Port != 0 || e.Weight != 0:
+		return fmt.Errorf("line %d: backends replaces the service, port and weight columns", e.Line)
+	case e.Redirect != "":
+		return fmt.Errorf("line %d: redirect cannot be combined with backends", e.Line)
+	case e.Fallback != "":
+		return fmt.Errorf("line %d: fallback cannot be combined with backends", e.Line)
+	case e.ScaleToZero:
+		return fmt.Errorf("line %d: scale_to_zero cannot be combined with backends", e.Line)
+	}
+	return nil
+}
+
+// BackendsOf is the backendRefs of e: its backend, or one per entry of its
+// backends column, each resolved like the row's own backend. Entries that
+// resolve to one backend, such as every backend of a row in maintenance,
+// are merged.
+func BackendsOf(e Endpoint, opts Options) []BackendRef {
+	if e.Backends == "" {
+		return []BackendRef{backendOf(e, opts)}
+	}
+	splits, _ := ParseBackends(e.Backends)
+	var refs []BackendRef
+	for _, s := range splits {
+		row := e
+		row.Backends, row.Service, row.Port, row.Weight = "", s.Service, s.Port, s.Weight
+		b := backendOf(row, opts)
+		b.Weight = s.Weight
+		i := slices.IndexFunc(refs, func(r BackendRef) bool {
+			return r.Group == b.Group && r.Kind == b.Kind && r.Name == b.Name && r.Namespace == b.Namespace && r.Port == b.Port
+		})
+		if i >= 0 {
+			refs[i].Weight += b.Weight
+		} else {
+			refs = append(refs, b)
+		}
+	}
+	if len(refs) == 1 {
+		refs[0].Weight = 1
+	}
+	for i := range refs {
+		refs[i].Standby = refs[i].Weight == 0
+	}
+	return refs
+}
@@ -0,0 +1,374 @@
+package convert
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// VariantHeader is the request header injected for rows with a variant.
+const VariantHeader = "X-Route-Variant"
+
+// directRuleKey identifies the direct-match rule an endpoint belongs to.
+// Backends is the backends column, which Backend alone does not capture.
+type directRuleKey struct {
+	Variant  string
+	Cache    string
+	Redirect string
+	Rewrite  string
+	Backend  BackendRef
+	Backends string
+	Request  HeaderEdits
+	Response HeaderEdits
+	Policy   rulePolicy
+	Extra    string
+}
+
+// Build assembles the HTTPRoute named name for endpoints: a rule per prefix
+// matching everything below it and rewriting the prefix away, plus the
+// direct matches of the rows, one rule per backend, variant, caching policy,
+// header modifiers, timeouts and retries, redirect and rewrite so each
+// carries its own filters, policy and refs.
+// Direct-match rules are split to stay within opts.MaxMatchesPerRule.
+func Build(name string, endpoints []Endpoint, opts Options) (HTTPRoute, error) {
+	gatewayNamespace := opts.GatewayNamespace
+	if gatewayNamespace == "" {
+		gatewayNamespace = opts.Namespace
+	}
+
+	route := HTTPRoute{
+		APIVersion: "gateway.networking.k8s.io/v1",
+		Kind:       "HTTPRoute",
+		Metadata: Metadata{
+			Name:      name,
+			Namespace: opts.Namespace,
+		},
+		Spec: HTTPRouteSpec{
+			ParentRefs: []ParentRef{
+				{
+					Group:       "gateway.networking.k8s.io",
+					Kind:        "Gateway",
+					Name:        opts.Gateway,
+					Namespace:   gatewayNamespace,
+					SectionName: opts.SectionName,
+					Port:        opts.Port,
+				},
+			},
+		},
+	}
+	for _, p := range opts.ExtraParents {
+		if p.Namespace == "" {
+			p.Namespace = gatewayNamespace
+		}
+		route.Spec.ParentRefs = append(route.Spec.ParentRefs, p)
+	}
+
+	if opts.Hostname != "" {
+		route.Spec.Hostnames = []string{opts.Hostname}
+	}
+
+	// Group endpoints by prefix, in order of first appearance
+	prefixGroups := make(map[string][]Endpoint)
+	var prefixes []string
+	for _, e := range endpoints {
+		if err := checkRedirect(e); err != nil {
+			return HTTPRoute{}, err
+		}
+		if err := checkBackends(e); err != nil {
+			return HTTPRoute{}, err
+		}
+		if e.Prefix != "" && opts.Strategy != StrategyExact {
+			if _, ok := prefixGroups[e.Prefix]; !ok {
+				prefixes = append(prefixes, e.Prefix)
+			}
+			prefixGroups[e.Prefix] = append(prefixGroups[e.Prefix], e)
+		}
+	}
+
+	// Rule 1: Match Prefix and Rewrite to /
+	for _, prefix := range prefixes {
+		group := prefixGroups[prefix]
+		rule := HTTPRouteRule{
+			Matches: []HTTPRouteMatch{
+				{
+					Path: &HTTPPathMatch{
+						Type:  "PathPrefix",
+						Value: prefix,
+					},
+				},
+			},
+			Filters: []HTTPRouteFilter{
+				{
+					Type: "URLRewrite",
+					URLRewrite: &URLRewriteFilter{
+						Path: &PathRewrite{
+							Type:               "ReplacePrefixMatch",
+							ReplacePrefixMatch: "/",
+						},
+					},
+				},
+			},
+		}
+		backends, err := prefixBackends(prefix, group, opts)
+		if err != nil {
+			return HTTPRoute{}, err
+		}
+		rule.BackendRefs = backends
+		variant, err := prefixVariant(prefix, group)
+		if err != nil {
+			return HTTPRoute{}, err
+		}
+		if variant != "" {
+			rule.Filters = append(rule.Filters, variantFilter(variant))
+		}
+		if policy := prefixCache(group); policy != "" {
+			rule.Filters = append(rule.Filters, cacheFilter(policy))
+		}
+		for _, response := range []bool{false, true} {
+			edits, err := prefixHeaderEdits(prefix, group, response)
+			if err != nil {
+				return HTTPRoute{}, err
+			}
+			if rule.Filters, err = mergeHeaderEdits(rule.Filters, edits, response); err != nil {
+				return HTTPRoute{}, fmt.Errorf("prefix %s: %w", prefix, err)
+			}
+		}
+		policy, err := prefixPolicy(prefix, group, opts)
+		if err != nil {
+			return HTTPRoute{}, err
+		}
+		policy.apply(&rule)
+		var descriptions []string
+		for _, e := range group {
+			rule.Matches[0].SourceLines = append(rule.Matches[0].SourceLines, e.Line)
+			if e.Description != "" && !slices.Contains(descriptions, e.Description) {
+				descriptions = append(descriptions, e.Description)
+			}
+		}
+		rule.Matches[0].Description = strings.Join(descriptions, "; ")
+		if opts.DecorateRule != nil {
+			if err := opts.DecorateRule(&rule, prefix, group); err != nil {
+				return HTTPRoute{}, err
+			}
+		}
+		route.Spec.Rules = append(route.Spec.Rules, rule)
+	}
+
+	// Rule 2: Direct matches for all URLs (from all prefixes and no-prefix)
+	directGroups := make(map[directRuleKey][]Endpoint)
+	var keys []directRuleKey
+	for _, e := range endpoints {
+		if opts.Strategy == StrategyPrefix && e.Prefix != "" {
+			continue
+		}
+		key := directRuleKey{Variant: e.Variant, Cache: e.CacheControl, Redirect: e.Redirect, Rewrite: e.Rewrite, Backends: e.Backends, Request: e.RequestHeaders, Response: e.ResponseHeaders}
+		// Redirected requests reach no backend, so its columns do not matter.
+		if e.Redirect == "" {
+			key.Backend = backendOf(e, opts)
+		}
+		if opts.RuleKey != nil {
+			key.Extra = opts.RuleKey(e)
+		}
+		policy, err := policyOf(e, opts)
+		if err != nil {
+			return HTTPRoute{}, fmt.Errorf("line %d: %w", e.Line, err)
+		}
+		key.Policy = policy
+		if _, ok := directGroups[key]; !ok {
+			keys = append(keys, key)
+		}
+		directGroups[key] = append(directGroups[key], e)
+	}
+
+	for _, key := range keys {
+		rule := HTTPRouteRule{
+			BackendRefs: BackendsOf(directGroups[key][0], opts),
+		}
+		if key.Redirect != "" {
+			filter, err := redirectFilter(key.Redirect)
+			if err != nil {
+				return HTTPRoute{}, fmt.Errorf("line %d: %w", directGroups[key][0].Line, err)
+			}
+			rule.BackendRefs = nil
+			rule.Filters = append(rule.Filters, filter)
+		}
+		if key.Rewrite != "" {
+			rule.Filters = append(rule.Filters, rewriteFilter(key.Rewrite))
+		}
+		if key.Variant != "" {
+			rule.Filters = append(rule.Filters, variantFilter(key.Variant))
+		}
+		if key.Cache != "" {
+			rule.Filters = append(rule.Filters, cacheFilter(key.Cache))
+		}
+		var err error
+		if rule.Filters, err = mergeHeaderEdits(rule.Filters, key.Request, false); err == nil {
+			rule.Filters, err = mergeHeaderEdits(rule.Filters, key.Response, true)
+		}
+		if err != nil {
+			return HTTPRoute{}, fmt.Errorf("line %d: %w", directGroups[key][0].Line, err)
+		}
+		key.Policy.apply(&rule)
+		for _, e := range directGroups[key] {
+			paths, err := compilePath(e, opts)
+			if err != nil {
+				return HTTPRoute{}, fmt.Errorf("line %d: %w", e.Line, err)
+			}
+			headers, query, err := requestMatches(e)
+			if err != nil {
+				return HTTPRoute{}, fmt.Errorf("line %d: %w", e.Line, err)
+			}
+			for i := range paths {
+				rule.Matches = append(rule.Matches, HTTPRouteMatch{
+					Path:        &paths[i],
+					Headers:     headers,
+					QueryParams: query,
+					Method:      e.Method,
+					SourceLines: []int{e.Line},
+					Description: e.Description,
+				})
+			}
+		}
+		if opts.DecorateRule != nil {
+			if err := opts.DecorateRule(&rule, "", directGroups[key]); err != nil {
+				return HTTPRoute{}, err
+			}
+		}
+		route.Spec.Rules = append(route.Spec.Rules, chunkRule(rule, opts.MaxMatchesPerRule)...)
+	}
+
+	// Catch-all: "/" is the shortest possible prefix, so Gateway API
+	// precedence only sends traffic here when nothing else matched
+	if opts.CatchAll != nil || len(opts.CatchAllFilters) > 0 {
+		rule := HTTPRouteRule{
+			Matches: []HTTPRouteMatch{
+				{
+					Path: &HTTPPathMatch{
+						Type:  "PathPrefix",
+						Value: "/",
+					},
+				},
+			},
+			Filters: slices.Clone(opts.CatchAllFilters),
+		}
+		if opts.CatchAll != nil {
+			rule.BackendRefs = []BackendRef{*opts.CatchAll}
+		}
+		route.Spec.Rules = append(route.Spec.Rules, rule)
+	}
+	return route, nil
+}
+
+// BackendFor resolves the backend of an endpoint from its service, port,
+// weight, service namespace and backend kind columns, falling back to opts.Service for the ones it leaves
+// empty.
+func BackendFor(e Endpoint, opts Options) BackendRef {
+	backend := opts.Service
+	if backend.Kind == "" {
+		backend.Kind = "Service"
+	}
+	backend.Weight = 1
+	if e.Service != "" {
+		backend.Name = e.Service
+	}
+	if e.Port != 0 {
+		backend.Port = e.Port
+	}
+	if e.Weight != 0 {
+		backend.Weight = e.Weight
+	}
+	if e.ServiceNamespace != "" {
+		backend.Namespace = e.ServiceNamespace
+	}
+	if e.BackendKind != "" {
+		backend.Kind, backend.Group = e.BackendKind, e.BackendGroup
+	} else if e.BackendGroup != "" {
+		backend.Group = e.BackendGroup
+	}
+	return backend
+}
+
+// backendOf is the backend of e under opts.ResolveBackend.
+func backendOf(e Endpoint, opts Options) BackendRef {
+	if opts.ResolveBackend != nil {
+		return opts.ResolveBackend(e)
+	}
+	return BackendFor(e, opts)
+}
+
+// compilePath is the direct matches of e: its URL with its own match type,
+// or compiled by opts.CompilePath.
+func compilePath(e Endpoint, opts Options) ([]HTTPPathMatch, error) {
+	if e.MatchType == "RegularExpression" {
+		if _, err := regexp.Compile(e.URL); err != nil {
+			return nil, fmt.Errorf("invalid path expression %q: %w", e.URL, err)
+		}
+	}
+	if e.MatchType != "" {
+		return []HTTPPathMatch{{Type: e.MatchType, Value: e.URL}}, nil
+	}
+	if opts.CompilePath != nil {
+		return opts.CompilePath(e.URL)
+	}
+	matchType := opts.DirectMatchType
+	if matchType == "" {
+		matchType = "PathPrefix"
+	}
+	return []HTTPPathMatch{{Type: matchType, Value: e.URL}}, nil
+}
+
+// prefixBackends returns the backends shared by all rows under prefix. A
+// prefix rule strips the prefix for every path below it, so rows that
+// disagree on the backends cannot be expressed as one rule and are reported
+// instead.
+func prefixBackends(prefix string, endpoints []Endpoint, opts Options) ([]BackendRef, error) {
+	backends := BackendsOf(endpoints[0], opts)
+	for _, e := range endpoints[1:] {
+		if bs := BackendsOf(e, opts); !slices.Equal(bs, backends) {
+			return nil, fmt.Errorf("prefix %s routes to conflicting backends %s (line %d) and %s (line %d)",
+				prefix, DescribeBackends(backends), endpoints[0].Line, DescribeBackends(bs), e.Line)
+		}
+	}
+	return backends, nil
+}
+
+// DescribeBackends names backends as service:port, with the weights of a
+// split.
+func DescribeBackends(backends []BackendRef) string {
+	if len(backends) == 1 {
+		return fmt.Sprintf("%s:%d", backends[0].Name, backends[0].Port)
+	}
+	names := make([]string, len(backends))
+	for i, b := range backends {
+		names[i] = fmt.Sprintf("%s:%d:%d", b.Name, b.Port, b.Weight)
+	}
+	return strings.Join(names, ";")
+}
+
+// prefixVariant returns the variant shared by all rows under prefix. Rows
+// without a variant are ignored; disagreeing variants are an error since a
+// single prefix rule can only inject one header value.
+func prefixVariant(prefix string, endpoints []Endpoint) (string, error) {
+	variant := ""
+	for _, e := range endpoints {
+		if e.Variant == "" {
+			continue
+		}
+		if variant != "" && variant != e.Variant {
+			return "", fmt.Errorf("prefix %s has conflicting variants %q and %q", prefix, variant, e.Variant)
+		}
+		variant = e.Variant
+	}
+	return variant, nil
+}
+
+// variantFilter builds the RequestHeaderModifier that tags requests with variant.
+func variantFilter(variant string) HTTPRouteFilter {
+	return HTTPRouteFilter{
+		Type: "RequestHeaderModifier",
+		RequestHeaderModifier: &HTTPHeaderFilter{
+			Set: []HTTPHeader{{Name: VariantHeader, Value: variant}},
+		},
+	}
+}
@@ -0,0 +1,87 @@
+package convert
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Cacheability values of the cacheability column.
+const (
+	cachePublic  = "public"
+	cachePrivate = "private"
+	cacheNoStore = "no-store"
+)
+
+// CacheControl builds the Cache-Control response header value from the
+// cache_ttl and cacheability columns. A TTL without cacheability is public;
+// both empty means the row sets no caching policy.
+func CacheControl(ttl, cacheability string) (string, error) {
+	cacheability = strings.ToLower(cacheability)
+	switch cacheability {
+	case "", cachePublic, cachePrivate, cacheNoStore:
+	default:
+		return "", fmt.Errorf("invalid cacheability %q (must be %s, %s or %s)", cacheability, cachePublic, cachePrivate, cacheNoStore)
+	}
+	if ttl == "" {
+		return cacheability, nil
+	}
+	seconds, err := parseTTL(ttl)
+	if err != nil {
+		return "", err
+	}
+	if cacheability == cacheNoStore {
+		return "", fmt.Errorf("cache_ttl %s contradicts cacheability %s", ttl, cacheNoStore)
+	}
+	if cacheability == "" {
+		cacheability = cachePublic
+	}
+	return fmt.Sprintf("%s, max-age=%d", cacheability, seconds), nil
+}
+
+// parseTTL accepts whole seconds ("300") or a Go duration ("5m", "1h30m").
+func parseTTL(ttl string) (int, error) {
+	if n, err := strconv.Atoi(ttl); err == nil {
+		if n < 0 {
+			return 0, fmt.Errorf("invalid cache_ttl %q", ttl)
+		}
+		return n, nil
+	}
+	d, err := time.ParseDuration(ttl)
+	if err != nil || d < 0 || d%time.Second != 0 {
+		return 0, fmt.Errorf("invalid cache_ttl %q (want seconds or a duration such as 5m)", ttl)
+	}
+	return int(d / time.Second), nil
+}
+
+// CacheableMethod reports whether responses to method may carry a caching
+// policy. Caches only store responses to safe methods, so policies on other
+// rows would be misleading.
+func CacheableMethod(method string) bool {
+	return method == "GET" || method == "HEAD"
+}
+
+// prefixCache returns the caching policy of a prefix rule. The rule also
+// serves paths below the prefix that are not in the CSV, so it only carries
+// a policy all of its rows agree on.
+func prefixCache(endpoints []Endpoint) string {
+	policy := endpoints[0].CacheControl
+	for _, e := range endpoints[1:] {
+		if e.CacheControl != policy {
+			return ""
+		}
+	}
+	return policy
+}
+
+// cacheFilter builds the ResponseHeaderModifier setting Cache-Control, which
+// CDNs and gateway-level caches use to decide what to store at the edge.
+func cacheFilter(policy string) HTTPRouteFilter {
+	return HTTPRouteFilter{
+		Type: "ResponseHeaderModifier",
+		ResponseHeaderModifier: &HTTPHeaderFilter{
+			Set: []HTTPHeader{{Name: "Cache-Control", Value: policy}},
+		},
+	}
+}
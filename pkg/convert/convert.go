@@ -0,0 +1,164 @@
+// Package convert turns endpoint inventories into Gateway API HTTPRoutes.
+// It is the conversion behind the csv2httproute command, for Go tooling
+// that wants the same routes without running the CLI:
+//
+//	endpoints, err := convert.Parse(f, convert.DefaultOptions())
+//	if err != nil {
+//		return err
+//	}
+//	opts := convert.DefaultOptions()
+//	opts.Hostname = "shop.example.com"
+//	route, err := convert.Build("orders", endpoints, opts)
+//
+// Parse reads the plain CSV format: a header row naming the columns (see
+// Columns) and one endpoint per row, with "#" rows ignored. The inventory
+// features of the command, such as "#!" directive rows, schema versions,
+// domain maps and profiles, are layered on top through the hooks of Options.
+package convert
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Strategy selects which of the two rule sets a route gets.
+type Strategy string
+
+const (
+	// StrategyHybrid emits a rewriting PathPrefix rule per prefix plus the
+	// direct matches of every row.
+	StrategyHybrid Strategy = "hybrid"
+	// StrategyPrefix emits the prefix rules only; rows without a prefix
+	// keep their direct match, since nothing else would route them.
+	StrategyPrefix Strategy = "prefix"
+	// StrategyExact emits the direct matches only, without any rewrite.
+	StrategyExact Strategy = "exact"
+)
+
+// Options configure parsing and route generation.
+type Options struct {
+	// Namespace of the generated routes.
+	Namespace string
+	// Hostname the routes serve; empty for all hostnames.
+	Hostname string
+	// Gateway and GatewayNamespace name the parent Gateway. The gateway
+	// namespace defaults to Namespace.
+	Gateway          string
+	GatewayNamespace string
+	// SectionName and Port select a listener of the parent Gateway.
+	// ExtraParents are further parents of the routes; those without a
+	// namespace take the gateway namespace.
+	SectionName  string
+	Port         int
+	ExtraParents []ParentRef
+
+	// Service is the backend of rows without their own service and port
+	// columns. Its Namespace and Port also apply to ParseBackend.
+	Service BackendRef
+	// CatchAll, when set, gets a final "/" rule for unmatched traffic.
+	CatchAll *BackendRef
+	// CatchAllFilters are the filters of the catch-all rule. With them, the
+	// rule is added even without CatchAll, e.g. for a filter answering the
+	// requests itself.
+	CatchAllFilters []HTTPRouteFilter
+
+	// Strategy selects the rule sets; DirectMatchType is the path match
+	// type of direct matches without a match_type column, one of
+	// MatchTypes.
+	Strategy        Strategy
+	DirectMatchType string
+	// MaxMatchesPerRule splits direct-match rules with more matches into
+	// several rules; zero means no limit.
+	MaxMatchesPerRule int
+
+	// ExtraMethods are accepted besides StandardMethods. RequireMethod
+	// rejects rows with an empty method instead of matching all methods.
+	ExtraMethods  []string
+	RequireMethod bool
+
+	// Timeout, BackendTimeout and Retries are the timeout, backend_timeout
+	// and retries of rows that leave them empty, in the form of the
+	// Endpoint fields.
+	Timeout        string
+	BackendTimeout string
+	Retries        string
+
+	// ResolveBackend replaces BackendFor as the backend of a row.
+	ResolveBackend func(e Endpoint) BackendRef
+	// CompilePath turns the URL of a row into its direct matches. By
+	// default the URL is matched literally with DirectMatchType.
+	CompilePath func(url string) ([]HTTPPathMatch, error)
+	// RuleKey separates direct matches that need rules of their own
+	// beyond their backend, variant and caching policy.
+	RuleKey func(e Endpoint) string
+	// DecorateRule adjusts every generated rule. prefix is the prefix of
+	// a prefix rule and empty for direct-match rules.
+	DecorateRule func(rule *HTTPRouteRule, prefix string, endpoints []Endpoint) error
+}
+
+// DefaultOptions returns the defaults of the csv2httproute command.
+func DefaultOptions() Options {
+	return Options{
+		Namespace:         "default",
+		Gateway:           "my-gateway",
+		Service:           BackendRef{Kind: "Service", Name: "my-service", Port: 80},
+		Strategy:          StrategyHybrid,
+		DirectMatchType:   "PathPrefix",
+		MaxMatchesPerRule: LegacyMatchesPerRule,
+	}
+}
+
+// Parse reads the endpoint rows of a CSV. Rows without a URL are skipped.
+func Parse(r io.Reader, opts Options) ([]Endpoint, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	// Spreadsheets often save CSVs with a UTF-8 byte order mark
+	data = bytes.TrimPrefix(data, []byte("\ufeff"))
+	reader := csv.NewReader(bytes.NewReader(data))
+	reader.FieldsPerRecord = -1 // Allow variable number of fields
+	// Read header; a completely empty input is treated as having no rows
+	header, err := reader.Read()
+	if err == io.EOF {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	columns := ColumnIndex(header)
+	if _, ok := columns["url"]; !ok {
+		err := fmt.Errorf("missing required column url")
+		if unknown := UnknownColumns(header); unknown != "" {
+			err = fmt.Errorf("%w; unrecognized columns: %s", err, unknown)
+		}
+		return nil, err
+	}
+
+	var endpoints []Endpoint
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			return endpoints, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if len(record) == 0 || strings.HasPrefix(strings.TrimSpace(record[0]), "#") {
+			continue
+		}
+		line, _ := reader.FieldPos(0)
+		e, err := ParseRecord(record, columns, opts)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		if e.URL == "" {
+			continue
+		}
+		e.Line = line
+		endpoints = append(endpoints, e)
+	}
+}
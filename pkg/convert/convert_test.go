@@ -0,0 +1,223 @@
+package convert_test
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/arencloud/csv2httproute/pkg/convert"
+	"gopkg.in/yaml.v3"
+)
+
+const usersCSV = `Method,URL,Prefix,Service,Port
+GET,/api/v1/users,/api/v1,users-svc,8080
+POST,/api/v1/login,/api/v1,users-svc,8080
+GET,/health,,,
+`
+
+func parse(t *testing.T, csv string, opts convert.Options) []convert.Endpoint {
+	t.Helper()
+	endpoints, err := convert.Parse(strings.NewReader(csv), opts)
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	return endpoints
+}
+
+func build(t *testing.T, endpoints []convert.Endpoint, opts convert.Options) convert.HTTPRoute {
+	t.Helper()
+	route, err := convert.Build("users", endpoints, opts)
+	if err != nil {
+		t.Fatalf("Build: %v", err)
+	}
+	return route
+}
+
+func TestParse(t *testing.T) {
+	endpoints := parse(t, usersCSV, convert.DefaultOptions())
+	if len(endpoints) != 3 {
+		t.Fatalf("parsed %d row(s), want 3", len(endpoints))
+	}
+	e := endpoints[0]
+	if e.Method != "GET" || e.URL != "/api/v1/users" || e.Prefix != "/api/v1" || e.Service != "users-svc" || e.Port != 8080 || e.Line != 2 {
+		t.Errorf("first row parsed as %+v", e)
+	}
+	if e := endpoints[2]; e.Service != "" || e.Port != 0 || e.Line != 4 {
+		t.Errorf("row without a service parsed as %+v", e)
+	}
+}
+
+func TestParseEmpty(t *testing.T) {
+	endpoints, err := convert.Parse(strings.NewReader(""), convert.DefaultOptions())
+	if err != nil || len(endpoints) != 0 {
+		t.Errorf("Parse of an empty input: %d row(s), %v", len(endpoints), err)
+	}
+}
+
+func TestBuild(t *testing.T) {
+	opts := convert.DefaultOptions()
+	route := build(t, parse(t, usersCSV, opts), opts)
+	if route.Kind != "HTTPRoute" || route.Metadata.Name != "users" || route.Metadata.Namespace != "default" {
+		t.Fatalf("built %s %s/%s", route.Kind, route.Metadata.Namespace, route.Metadata.Name)
+	}
+	if len(route.Spec.ParentRefs) != 1 || route.Spec.ParentRefs[0].Name != "my-gateway" {
+		t.Errorf("parentRefs %+v", route.Spec.ParentRefs)
+	}
+	rules := route.Spec.Rules
+	if len(rules) != 3 {
+		t.Fatalf("built %d rule(s), want the prefix rule and a direct-match rule per backend", len(rules))
+	}
+
+	prefix := rules[0]
+	if len(prefix.Matches) != 1 || prefix.Matches[0].Path.Type != "PathPrefix" || prefix.Matches[0].Path.Value != "/api/v1" {
+		t.Errorf("prefix rule matches %+v", prefix.Matches)
+	}
+	if len(prefix.Filters) != 1 || prefix.Filters[0].URLRewrite == nil || prefix.Filters[0].URLRewrite.Path.ReplacePrefixMatch != "/" {
+		t.Errorf("prefix rule filters %+v, want a rewrite of the prefix to /", prefix.Filters)
+	}
+
+	var direct []string
+	for _, rule := range rules[1:] {
+		for _, m := range rule.Matches {
+			direct = append(direct, fmt.Sprintf("%s %s %s -> %s:%d", m.Method, m.Path.Type, m.Path.Value, rule.BackendRefs[0].Name, rule.BackendRefs[0].Port))
+		}
+	}
+	want := []string{
+		"GET PathPrefix /api/v1/users -> users-svc:8080",
+		"POST PathPrefix /api/v1/login -> users-svc:8080",
+		"GET PathPrefix /health -> my-service:80",
+	}
+	if strings.Join(direct, "\n") != strings.Join(want, "\n") {
+		t.Errorf("direct matches:\n%s\nwant:\n%s", strings.Join(direct, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+// TestBuildYAMLRoundTrip checks that a built route survives being written
+// and read back as YAML, as the manifests are.
+func TestBuildYAMLRoundTrip(t *testing.T) {
+	opts := convert.DefaultOptions()
+	opts.Hostname = "shop.example.com"
+	route := build(t, parse(t, usersCSV, opts), opts)
+	data, err := yaml.Marshal(route)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded convert.HTTPRoute
+	if err := yaml.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("reading back the route: %v", err)
+	}
+	again, err := yaml.Marshal(decoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(again) != string(data) {
+		t.Errorf("route changed in the round trip:\n%s\nwant:\n%s", again, data)
+	}
+	if len(decoded.Spec.Hostnames) != 1 || decoded.Spec.Hostnames[0] != "shop.example.com" {
+		t.Errorf("hostnames %v", decoded.Spec.Hostnames)
+	}
+}
+
+// rowsCSV returns n GET rows of distinct paths on the default backend.
+func rowsCSV(n int) string {
+	var b strings.Builder
+	b.WriteString("Method,URL\n")
+	for i := range n {
+		fmt.Fprintf(&b, "GET,/items/%d\n", i)
+	}
+	return b.String()
+}
+
+func TestBuildMatchesPerRule(t *testing.T) {
+	tests := []struct {
+		name  string
+		limit int
+		rows  int
+		want  []int
+	}{
+		{"before v1.2 at the limit", convert.LegacyMatchesPerRule, 8, []int{8}},
+		{"before v1.2 over the limit", convert.LegacyMatchesPerRule, 9, []int{8, 1}},
+		{"v1.2 at the limit", convert.MaxMatchesPerRule, 64, []int{64}},
+		{"v1.2 over the limit", convert.MaxMatchesPerRule, 65, []int{64, 1}},
+		{"no limit", 0, 65, []int{65}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := convert.DefaultOptions()
+			opts.MaxMatchesPerRule = tt.limit
+			route := build(t, parse(t, rowsCSV(tt.rows), opts), opts)
+			var got []int
+			for _, rule := range route.Spec.Rules {
+				got = append(got, len(rule.Matches))
+				if len(rule.BackendRefs) != 1 || rule.BackendRefs[0].Name != "my-service" {
+					t.Errorf("rule backends %+v", rule.BackendRefs)
+				}
+			}
+			if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+				t.Errorf("matches per rule %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// rulesOf returns rules with the given numbers of matches.
+func rulesOf(matches ...int) []convert.HTTPRouteRule {
+	rules := make([]convert.HTTPRouteRule, len(matches))
+	for i, n := range matches {
+		for j := range n {
+			rules[i].Matches = append(rules[i].Matches, convert.HTTPRouteMatch{
+				Path: &convert.HTTPPathMatch{Type: "Exact", Value: fmt.Sprintf("/r%d/m%d", i, j)},
+			})
+		}
+	}
+	return rules
+}
+
+func TestShard(t *testing.T) {
+	repeat := func(n, matches int) []int {
+		counts := make([]int, n)
+		for i := range counts {
+			counts[i] = matches
+		}
+		return counts
+	}
+	tests := []struct {
+		name     string
+		matches  []int
+		maxRules int
+		want     [][]int
+	}{
+		{"16 rules fit", repeat(16, 1), 0, [][]int{repeat(16, 1)}},
+		{"17 rules", repeat(17, 1), 0, [][]int{repeat(16, 1), {1}}},
+		{"128 matches fit", []int{64, 64}, 0, [][]int{{64, 64}}},
+		{"129 matches", []int{64, 64, 1}, 0, [][]int{{64, 64}, {1}}},
+		{"rules without matches count one", append(repeat(1, 64), 63, 0, 0), 0, [][]int{{64, 63, 0}, {0}}},
+		{"lower rule limit", repeat(5, 1), 2, [][]int{{1, 1}, {1, 1}, {1}}},
+		{"rule limit above the CRD's", repeat(17, 1), 32, [][]int{repeat(16, 1), {1}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			route := convert.HTTPRoute{Metadata: convert.Metadata{Name: "big", Labels: map[string]string{"team": "shop"}}}
+			route.Spec.Rules = rulesOf(tt.matches...)
+			shards := convert.Shard(route, tt.maxRules)
+			var got [][]int
+			for i, shard := range shards {
+				var counts []int
+				for _, rule := range shard.Spec.Rules {
+					counts = append(counts, len(rule.Matches))
+				}
+				got = append(got, counts)
+				name := "big"
+				if len(tt.want) > 1 {
+					name = fmt.Sprintf("big-%d", i+1)
+				}
+				if shard.Metadata.Name != name || shard.Metadata.Labels["team"] != "shop" {
+					t.Errorf("shard %d is %s with labels %v, want %s with the labels of the route", i, shard.Metadata.Name, shard.Metadata.Labels, name)
+				}
+			}
+			if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+				t.Errorf("shards %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
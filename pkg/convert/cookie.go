@@ -0,0 +1,65 @@
+package convert
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+const cookieHeader = "Cookie"
+
+// cookieValue is the cookie-octet syntax of RFC 6265: no whitespace, quotes,
+// commas, semicolons or backslashes.
+var cookieValue = regexp.MustCompile(`^[\x21\x23-\x2B\x2D-\x3A\x3C-\x5B\x5D-\x7E]*$`)
+
+// Around the name=value of a cookie match. A Cookie header lists the
+// cookies of a request separated by "; ", so the pattern matches the pair
+// as one of them, in any position, as the whole header value. Cookie names
+// and values are case-sensitive.
+const (
+	cookiePrefix = `(.*;\s*)?`
+	cookieSuffix = `(\s*;.*)?`
+)
+
+// normalizeCookie validates a cookie cell, one name=value pair, and returns
+// it without the whitespace around the name and value.
+func normalizeCookie(spec string) (string, error) {
+	pairs, err := parseMatchPairs(spec, "cookie", false)
+	if err != nil {
+		return "", err
+	}
+	if len(pairs) != 1 {
+		return "", fmt.Errorf("invalid cookie %q (want one name=value pair)", spec)
+	}
+	if !cookieValue.MatchString(pairs[0].Value) {
+		return "", fmt.Errorf("invalid cookie %q: the value may not contain whitespace, quotes, commas, semicolons or backslashes", spec)
+	}
+	return pairs[0].Name + "=" + pairs[0].Value, nil
+}
+
+// cookieMatches are the header matches of the cookie column of e: requests
+// carrying the cookie with exactly its value among their cookies.
+func cookieMatches(e Endpoint) []HTTPHeaderMatch {
+	if e.Cookie == "" {
+		return nil
+	}
+	return []HTTPHeaderMatch{{Type: "RegularExpression", Name: cookieHeader, Value: cookiePrefix + regexp.QuoteMeta(e.Cookie) + cookieSuffix}}
+}
+
+// CookieOf reverses cookieMatches: it returns the cookie cell of a header
+// match generated from one, and false for other matches.
+func CookieOf(m HTTPHeaderMatch) (string, bool) {
+	if !strings.EqualFold(m.Name, cookieHeader) || m.Type != "RegularExpression" {
+		return "", false
+	}
+	inner, hasPrefix := strings.CutPrefix(m.Value, cookiePrefix)
+	inner, hasSuffix := strings.CutSuffix(inner, cookieSuffix)
+	if !hasPrefix || !hasSuffix {
+		return "", false
+	}
+	cookie := strings.ReplaceAll(inner, `\`, "")
+	if normalized, err := normalizeCookie(cookie); err != nil || normalized != cookie || regexp.QuoteMeta(cookie) != inner {
+		return "", false
+	}
+	return cookie, true
+}
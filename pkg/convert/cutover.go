@@ -0,0 +1,55 @@
+package convert
+
+import (
+	"fmt"
+	"time"
+)
+
+// timestampLayouts are the accepted forms of cutover_at values. Values
+// without a zone are UTC.
+var timestampLayouts = []string{time.RFC3339, "2006-01-02T15:04:05", "2006-01-02T15:04", "2006-01-02 15:04", "2006-01-02"}
+
+// ParseTimestamp parses a cutover_at value: RFC 3339, or a date with an
+// optional time of day in UTC.
+func ParseTimestamp(s string) (time.Time, error) {
+	for _, layout := range timestampLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid timestamp %q (want RFC 3339, e.g. 2026-11-01T02:00:00Z, or YYYY-MM-DD[THH:MM])", s)
+}
+
+// cutoverKey identifies the requests a row matches directly.
+type cutoverKey struct {
+	Method, URL, Headers, QueryParams              string
+	Accept, ContentType, Cookie                    string
+	Hostname, Namespace, Gateway, GatewayNamespace string
+}
+
+// ActiveAt returns the rows of endpoints in effect at t. A row with a
+// cutover_at takes effect at that time and from then on replaces the rows
+// for the same method, URL, headers, query parameters, media types and
+// cookie that took effect
+// before it, so an inventory can hold the routing of both sides of a
+// planned migration.
+func ActiveAt(endpoints []Endpoint, t time.Time) []Endpoint {
+	latest := make(map[cutoverKey]time.Time)
+	for _, e := range endpoints {
+		if e.CutoverAt.After(t) {
+			continue
+		}
+		k := cutoverKey{e.Method, e.URL, e.Headers, e.QueryParams, e.Accept, e.ContentType, e.Cookie, e.Hostname, e.Namespace, e.Gateway, e.GatewayNamespace}
+		if e.CutoverAt.After(latest[k]) {
+			latest[k] = e.CutoverAt
+		}
+	}
+	var active []Endpoint
+	for _, e := range endpoints {
+		k := cutoverKey{e.Method, e.URL, e.Headers, e.QueryParams, e.Accept, e.ContentType, e.Cookie, e.Hostname, e.Namespace, e.Gateway, e.GatewayNamespace}
+		if !e.CutoverAt.After(t) && e.CutoverAt.Equal(latest[k]) {
+			active = append(active, e)
+		}
+	}
+	return active
+}
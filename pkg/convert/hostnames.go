@@ -0,0 +1,27 @@
+package convert
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// NormalizeHostnames validates a hostname cell, hostnames separated by ";",
+// and returns it in lower case without whitespace or duplicates, in the
+// order given.
+func NormalizeHostnames(spec string) (string, error) {
+	var hostnames []string
+	for _, h := range strings.Split(spec, ";") {
+		h = strings.ToLower(strings.TrimSpace(h))
+		if h == "" {
+			continue
+		}
+		if strings.ContainsAny(h, ":/ \t") {
+			return "", fmt.Errorf("invalid hostname %q (want hostnames such as api.example.com separated by ;, without scheme or port)", h)
+		}
+		if !slices.Contains(hostnames, h) {
+			hostnames = append(hostnames, h)
+		}
+	}
+	return strings.Join(hostnames, ";"), nil
+}
@@ -0,0 +1,92 @@
+package convert
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+)
+
+// Limits of the HTTPRoute CRD (Gateway API v1.2+), which the API server
+// enforces. CRDs before v1.2 allow only LegacyMatchesPerRule matches per
+// rule.
+const (
+	MaxRulesPerRoute     = 16
+	MaxMatchesPerRule    = 64
+	MaxMatchesPerRoute   = 128
+	LegacyMatchesPerRule = 8
+)
+
+// Limits of the values of HTTPRoute matches, in bytes.
+const (
+	MaxPathValue       = 1024
+	MaxHeaderName      = 256
+	MaxHeaderValue     = 4096
+	MaxQueryParamName  = 256
+	MaxQueryParamValue = 1024
+)
+
+// chunkRule splits rule into rules of at most max matches, each with the
+// filters and backends of rule. Zero means no limit.
+func chunkRule(rule HTTPRouteRule, max int) []HTTPRouteRule {
+	if max <= 0 || len(rule.Matches) <= max {
+		return []HTTPRouteRule{rule}
+	}
+	var rules []HTTPRouteRule
+	for matches := range slices.Chunk(rule.Matches, max) {
+		chunk := rule
+		chunk.Matches = matches
+		chunk.Filters = slices.Clone(rule.Filters)
+		chunk.BackendRefs = slices.Clone(rule.BackendRefs)
+		rules = append(rules, chunk)
+	}
+	return rules
+}
+
+// Shard splits route into routes of at most maxRules rules and
+// MaxMatchesPerRoute matches, keeping the order of the rules. Routes that
+// fit are returned as is; shards are named after route with the suffixes
+// -1, -2, and so on. Gateway API precedence ranks the matches of all routes
+// attached to a listener together, so sharding does not change routing.
+func Shard(route HTTPRoute, maxRules int) []HTTPRoute {
+	if maxRules <= 0 || maxRules > MaxRulesPerRoute {
+		maxRules = MaxRulesPerRoute
+	}
+	if len(route.Spec.Rules) <= maxRules && routeMatches(route.Spec.Rules) <= MaxMatchesPerRoute {
+		return []HTTPRoute{route}
+	}
+	var groups [][]HTTPRouteRule
+	var current []HTTPRouteRule
+	for _, rule := range route.Spec.Rules {
+		if len(current) > 0 && (len(current) == maxRules || routeMatches(current)+ruleMatches(rule) > MaxMatchesPerRoute) {
+			groups = append(groups, current)
+			current = nil
+		}
+		current = append(current, rule)
+	}
+	groups = append(groups, current)
+
+	shards := make([]HTTPRoute, len(groups))
+	for i, rules := range groups {
+		shard := route
+		shard.Metadata.Name = fmt.Sprintf("%s-%d", route.Metadata.Name, i+1)
+		shard.Metadata.Labels = maps.Clone(route.Metadata.Labels)
+		shard.Metadata.Annotations = maps.Clone(route.Metadata.Annotations)
+		shard.Spec.Rules = rules
+		shards[i] = shard
+	}
+	return shards
+}
+
+// ruleMatches counts the matches of rule toward the route limit; a rule
+// without matches has the implicit match of every request.
+func ruleMatches(rule HTTPRouteRule) int {
+	return max(len(rule.Matches), 1)
+}
+
+func routeMatches(rules []HTTPRouteRule) int {
+	n := 0
+	for _, rule := range rules {
+		n += ruleMatches(rule)
+	}
+	return n
+}
@@ -0,0 +1,56 @@
+package convert
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestChunkRule(t *testing.T) {
+	tests := []struct {
+		matches, max int
+		want         []int
+	}{
+		{8, LegacyMatchesPerRule, []int{8}},
+		{17, LegacyMatchesPerRule, []int{8, 8, 1}},
+		{64, MaxMatchesPerRule, []int{64}},
+		{65, MaxMatchesPerRule, []int{64, 1}},
+		{128, MaxMatchesPerRule, []int{64, 64}},
+		{100, 0, []int{100}},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("%d matches by %d", tt.matches, tt.max), func(t *testing.T) {
+			rule := HTTPRouteRule{
+				Filters:     []HTTPRouteFilter{{Type: "RequestHeaderModifier"}},
+				BackendRefs: []BackendRef{{Name: "orders", Port: 80}},
+			}
+			for i := range tt.matches {
+				rule.Matches = append(rule.Matches, HTTPRouteMatch{Path: &HTTPPathMatch{Type: "Exact", Value: fmt.Sprintf("/m%d", i)}})
+			}
+			chunks := chunkRule(rule, tt.max)
+			var got []int
+			next := 0
+			for _, chunk := range chunks {
+				got = append(got, len(chunk.Matches))
+				for _, m := range chunk.Matches {
+					if want := fmt.Sprintf("/m%d", next); m.Path.Value != want {
+						t.Fatalf("match %s where %s was expected: chunks must keep the order", m.Path.Value, want)
+					}
+					next++
+				}
+				if len(chunk.Filters) != 1 || len(chunk.BackendRefs) != 1 || chunk.BackendRefs[0].Name != "orders" {
+					t.Errorf("chunk lost the filters or backends of the rule: %+v", chunk)
+				}
+			}
+			if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+				t.Errorf("chunks of %v matches, want %v", got, tt.want)
+			}
+			if len(chunks) > 1 {
+				// Chunks must not share the slices they could be edited through.
+				chunks[0].BackendRefs[0].Name = "changed"
+				if chunks[1].BackendRefs[0].Name != "orders" || rule.BackendRefs[0].Name != "orders" {
+					t.Errorf("chunks share their backendRefs")
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,106 @@
+package convert
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// matchName is the token syntax of header and query parameter names.
+var matchName = regexp.MustCompile("^[A-Za-z0-9!#$%&'*+\\-.^_`|~]+$")
+
+// matchPair is one name=value pair of a headers or query_params cell.
+type matchPair struct {
+	Name, Value string
+}
+
+// parseMatchPairs splits a headers or query_params cell into its
+// "name=value" pairs, separated by ";". Names must be unique within the
+// cell; header names compare case-insensitively, as in HTTP.
+func parseMatchPairs(spec, column string, foldCase bool) ([]matchPair, error) {
+	var pairs []matchPair
+	seen := make(map[string]bool)
+	for _, part := range strings.Split(spec, ";") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		name, value, ok := strings.Cut(part, "=")
+		name, value = strings.TrimSpace(name), strings.TrimSpace(value)
+		if !ok || !matchName.MatchString(name) {
+			return nil, fmt.Errorf("invalid %s %q (want name=value pairs separated by ;)", column, spec)
+		}
+		key := name
+		if foldCase {
+			key = strings.ToLower(name)
+		}
+		if seen[key] {
+			return nil, fmt.Errorf("invalid %s %q: %s is given twice", column, spec, name)
+		}
+		seen[key] = true
+		pairs = append(pairs, matchPair{name, value})
+	}
+	return pairs, nil
+}
+
+// normalizeMatchList validates a headers or query_params cell and returns it
+// with the whitespace around names and values removed, so equal cells
+// compare equal.
+func normalizeMatchList(spec, column string, foldCase bool) (string, error) {
+	pairs, err := parseMatchPairs(spec, column, foldCase)
+	if err != nil {
+		return "", err
+	}
+	parts := make([]string, len(pairs))
+	for i, p := range pairs {
+		parts[i] = p.Name + "=" + p.Value
+	}
+	return strings.Join(parts, ";"), nil
+}
+
+// requestMatches returns the header and query parameter matches of e,
+// including those of its accept, content_type and cookie columns.
+func requestMatches(e Endpoint) ([]HTTPHeaderMatch, []HTTPQueryParamMatch, error) {
+	if err := checkHeaderColumns(e); err != nil {
+		return nil, nil, err
+	}
+	headerPairs, err := parseMatchPairs(e.Headers, "headers", true)
+	if err != nil {
+		return nil, nil, err
+	}
+	queryPairs, err := parseMatchPairs(e.QueryParams, "query_params", false)
+	if err != nil {
+		return nil, nil, err
+	}
+	var headers []HTTPHeaderMatch
+	for _, p := range headerPairs {
+		headers = append(headers, HTTPHeaderMatch{Type: "Exact", Name: p.Name, Value: p.Value})
+	}
+	headers = append(headers, mediaTypeMatches(e)...)
+	headers = append(headers, cookieMatches(e)...)
+	var query []HTTPQueryParamMatch
+	for _, p := range queryPairs {
+		query = append(query, HTTPQueryParamMatch{Type: "Exact", Name: p.Name, Value: p.Value})
+	}
+	return headers, query, nil
+}
+
+// checkHeaderColumns rejects headers cells matching a header the accept,
+// content_type or cookie column of the row matches too, since the names of
+// the header matches of a match must be unique.
+func checkHeaderColumns(e Endpoint) error {
+	pairs, err := parseMatchPairs(e.Headers, "headers", true)
+	if err != nil {
+		return err
+	}
+	for _, p := range pairs {
+		for _, c := range []struct {
+			column, header, value string
+		}{{"accept", acceptHeader, e.Accept}, {"content_type", contentTypeHeader, e.ContentType}, {"cookie", cookieHeader, e.Cookie}} {
+			if c.value != "" && strings.EqualFold(p.Name, c.header) {
+				return fmt.Errorf("headers match %s, which the %s column matches too", p.Name, c.column)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,102 @@
+package convert
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// mediaType is the type/subtype syntax of the accept and content_type
+// columns, without parameters or wildcards.
+var mediaType = regexp.MustCompile("^[a-z0-9!#$&^_.+-]+/[a-z0-9!#$&^_.+-]+$")
+
+// The headers the accept and content_type columns match.
+const (
+	acceptHeader      = "Accept"
+	contentTypeHeader = "Content-Type"
+)
+
+// Around the alternatives of the media type matches. An Accept header lists
+// media ranges separated by commas, each with optional parameters such as
+// q=0.9; a Content-Type header is one media type with optional parameters
+// such as charset=utf-8. The patterns match the whole value, as Gateway
+// implementations apply header regular expressions, and media types compare
+// case-insensitively.
+const (
+	acceptPrefix      = `(?i)(.*,)?\s*(`
+	acceptSuffix      = `)\s*(;[^,]*)?(,.*)?`
+	contentTypePrefix = `(?i)(`
+	contentTypeSuffix = `)\s*(;.*)?`
+)
+
+// normalizeMediaTypes validates an accept or content_type cell, media types
+// separated by ",", and returns it lowercased without whitespace or
+// duplicates.
+func normalizeMediaTypes(spec, column string) (string, error) {
+	var types []string
+	for _, t := range strings.Split(spec, ",") {
+		t = strings.ToLower(strings.TrimSpace(t))
+		if t == "" {
+			continue
+		}
+		if !mediaType.MatchString(t) {
+			return "", fmt.Errorf("invalid %s %q (want media types such as application/json separated by commas, without parameters or wildcards)", column, spec)
+		}
+		if !slices.Contains(types, t) {
+			types = append(types, t)
+		}
+	}
+	return strings.Join(types, ","), nil
+}
+
+// mediaTypeMatches are the header matches of the accept and content_type
+// columns of e: requests whose Accept lists one of the accept media types,
+// and whose Content-Type is one of the content_type ones.
+func mediaTypeMatches(e Endpoint) []HTTPHeaderMatch {
+	var matches []HTTPHeaderMatch
+	if e.Accept != "" {
+		matches = append(matches, HTTPHeaderMatch{Type: "RegularExpression", Name: acceptHeader, Value: acceptPrefix + mediaTypeAlternatives(e.Accept) + acceptSuffix})
+	}
+	if e.ContentType != "" {
+		matches = append(matches, HTTPHeaderMatch{Type: "RegularExpression", Name: contentTypeHeader, Value: contentTypePrefix + mediaTypeAlternatives(e.ContentType) + contentTypeSuffix})
+	}
+	return matches
+}
+
+func mediaTypeAlternatives(list string) string {
+	types := strings.Split(list, ",")
+	for i, t := range types {
+		types[i] = regexp.QuoteMeta(t)
+	}
+	return strings.Join(types, "|")
+}
+
+// MediaTypesOf reverses mediaTypeMatches: it returns the column (accept or
+// content_type) and cell of a header match generated from one, and false
+// for other matches.
+func MediaTypesOf(m HTTPHeaderMatch) (column, list string, ok bool) {
+	prefix, suffix := acceptPrefix, acceptSuffix
+	switch {
+	case strings.EqualFold(m.Name, acceptHeader):
+		column = "accept"
+	case strings.EqualFold(m.Name, contentTypeHeader):
+		column, prefix, suffix = "content_type", contentTypePrefix, contentTypeSuffix
+	default:
+		return "", "", false
+	}
+	inner, hasPrefix := strings.CutPrefix(m.Value, prefix)
+	inner, hasSuffix := strings.CutSuffix(inner, suffix)
+	if !hasPrefix || !hasSuffix || m.Type != "RegularExpression" {
+		return "", "", false
+	}
+	types := strings.Split(inner, "|")
+	for i, t := range types {
+		types[i] = strings.ReplaceAll(t, `\`, "")
+	}
+	list = strings.Join(types, ",")
+	if normalized, err := normalizeMediaTypes(list, column); err != nil || normalized != list || mediaTypeAlternatives(list) != inner {
+		return "", "", false
+	}
+	return column, list, true
+}
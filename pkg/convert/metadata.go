@@ -0,0 +1,45 @@
+package convert
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// ParseMetadataPairs splits a labels or annotations cell into its
+// "key=value" pairs, separated by ";". Keys must be unique within the cell.
+// Kubernetes syntax of keys and values is left to the caller.
+func ParseMetadataPairs(spec, column string) (map[string]string, error) {
+	pairs := make(map[string]string)
+	for _, part := range strings.Split(spec, ";") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		key, value, ok := strings.Cut(part, "=")
+		key, value = strings.TrimSpace(key), strings.TrimSpace(value)
+		if !ok || key == "" {
+			return nil, fmt.Errorf("invalid %s %q (want key=value pairs separated by ;)", column, spec)
+		}
+		if _, dup := pairs[key]; dup {
+			return nil, fmt.Errorf("invalid %s %q: %s is given twice", column, spec, key)
+		}
+		pairs[key] = value
+	}
+	return pairs, nil
+}
+
+// normalizeMetadataList validates a labels or annotations cell and returns
+// it sorted by key, with the whitespace around keys and values removed.
+func normalizeMetadataList(spec, column string) (string, error) {
+	pairs, err := ParseMetadataPairs(spec, column)
+	if err != nil {
+		return "", err
+	}
+	var parts []string
+	for key, value := range pairs {
+		parts = append(parts, key+"="+value)
+	}
+	slices.Sort(parts)
+	return strings.Join(parts, ";"), nil
+}
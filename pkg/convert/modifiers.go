@@ -0,0 +1,213 @@
+package convert
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Filter types of the header modifier columns.
+const (
+	RequestHeaderModifier  = "RequestHeaderModifier"
+	ResponseHeaderModifier = "ResponseHeaderModifier"
+)
+
+// maxHeaderEdits is the most entries the Gateway API allows in each of the
+// set, add and remove lists of a header filter.
+const maxHeaderEdits = 16
+
+// HeaderEdits are the header modifier columns of one direction: Set and Add
+// are "name=value" pairs separated by ";", Remove is header names separated
+// by ";". They are kept normalized, so rows with equal edits share a rule.
+type HeaderEdits struct {
+	Set    string
+	Add    string
+	Remove string
+}
+
+// IsZero reports whether h edits no header.
+func (h HeaderEdits) IsZero() bool {
+	return h == HeaderEdits{}
+}
+
+// parseHeaderEdits reads the set_<kind>, add_<kind> and remove_<kind>
+// columns of one direction, kind "headers" or "response_headers". A header
+// may not be both removed and set or added, which implementations resolve
+// differently.
+func parseHeaderEdits(set, add, remove, kind string) (HeaderEdits, error) {
+	var h HeaderEdits
+	var err error
+	if h.Set, err = normalizeHeaderPairs(set, "set_"+kind); err != nil {
+		return h, err
+	}
+	if h.Add, err = normalizeHeaderPairs(add, "add_"+kind); err != nil {
+		return h, err
+	}
+	names, err := parseHeaderNames(remove, "remove_"+kind)
+	if err != nil {
+		return h, err
+	}
+	h.Remove = strings.Join(names, ";")
+	for _, name := range names {
+		for _, pairs := range []string{h.Set, h.Add} {
+			for _, p := range splitHeaderPairs(pairs) {
+				if strings.EqualFold(p.Name, name) {
+					return h, fmt.Errorf("remove_%s removes %s, which the row also sets or adds", kind, p.Name)
+				}
+			}
+		}
+	}
+	return h, nil
+}
+
+// normalizeHeaderPairs validates a set or add cell like a headers cell.
+func normalizeHeaderPairs(spec, column string) (string, error) {
+	pairs, err := parseMatchPairs(spec, column, true)
+	if err != nil {
+		return "", err
+	}
+	if len(pairs) > maxHeaderEdits {
+		return "", fmt.Errorf("%s lists %d headers, more than the %d a filter may set", column, len(pairs), maxHeaderEdits)
+	}
+	return normalizeMatchList(spec, column, true)
+}
+
+// parseHeaderNames splits a remove cell into its header names.
+func parseHeaderNames(spec, column string) ([]string, error) {
+	var names []string
+	seen := make(map[string]bool)
+	for _, name := range strings.Split(spec, ";") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		if !matchName.MatchString(name) {
+			return nil, fmt.Errorf("invalid %s %q (want header names separated by ;)", column, spec)
+		}
+		if seen[strings.ToLower(name)] {
+			return nil, fmt.Errorf("invalid %s %q: %s is given twice", column, spec, name)
+		}
+		seen[strings.ToLower(name)] = true
+		names = append(names, name)
+	}
+	if len(names) > maxHeaderEdits {
+		return nil, fmt.Errorf("%s lists %d headers, more than the %d a filter may remove", column, len(names), maxHeaderEdits)
+	}
+	return names, nil
+}
+
+// splitHeaderPairs splits a normalized set or add cell.
+func splitHeaderPairs(cell string) []HTTPHeader {
+	var headers []HTTPHeader
+	for _, pair := range strings.Split(cell, ";") {
+		if name, value, ok := strings.Cut(pair, "="); ok {
+			headers = append(headers, HTTPHeader{Name: name, Value: value})
+		}
+	}
+	return headers
+}
+
+// FormatHeaderEdits is the header modifier columns reproducing f, or false
+// if the columns cannot represent it, such as a value holding a ";".
+func FormatHeaderEdits(f HTTPHeaderFilter) (HeaderEdits, bool) {
+	format := func(headers []HTTPHeader) (string, bool) {
+		pairs := make([]string, len(headers))
+		for i, h := range headers {
+			if strings.Contains(h.Value, ";") {
+				return "", false
+			}
+			pairs[i] = h.Name + "=" + h.Value
+		}
+		return strings.Join(pairs, ";"), true
+	}
+	set, okSet := format(f.Set)
+	add, okAdd := format(f.Add)
+	if !okSet || !okAdd {
+		return HeaderEdits{}, false
+	}
+	h, err := parseHeaderEdits(set, add, strings.Join(f.Remove, ";"), "headers")
+	return h, err == nil
+}
+
+// MergeHeaderEdits adds edits to the header filter of kind in filters,
+// creating the filter if there is none, since a filter type may appear only
+// once per rule. Headers the filter already sets, such as the variant
+// header or Cache-Control, cannot be set again.
+func MergeHeaderEdits(filters []HTTPRouteFilter, kind string, edits HeaderEdits) ([]HTTPRouteFilter, error) {
+	if edits.IsZero() {
+		return filters, nil
+	}
+	setBy := "variant column"
+	if kind == ResponseHeaderModifier {
+		setBy = "cache_ttl and cacheability columns"
+	}
+	var filter *HTTPHeaderFilter
+	for i := range filters {
+		switch {
+		case filters[i].Type != kind:
+		case kind == RequestHeaderModifier:
+			filter = filters[i].RequestHeaderModifier
+		default:
+			filter = filters[i].ResponseHeaderModifier
+		}
+	}
+	if filter == nil {
+		filter = &HTTPHeaderFilter{}
+		f := HTTPRouteFilter{Type: kind}
+		if kind == RequestHeaderModifier {
+			f.RequestHeaderModifier = filter
+		} else {
+			f.ResponseHeaderModifier = filter
+		}
+		filters = append(filters, f)
+	}
+	for _, list := range [][]HTTPHeader{splitHeaderPairs(edits.Set), splitHeaderPairs(edits.Add)} {
+		for _, h := range list {
+			for _, existing := range filter.Set {
+				if strings.EqualFold(existing.Name, h.Name) {
+					return nil, fmt.Errorf("header %s is already set by the %s", h.Name, setBy)
+				}
+			}
+		}
+	}
+	filter.Set = append(filter.Set, splitHeaderPairs(edits.Set)...)
+	filter.Add = append(filter.Add, splitHeaderPairs(edits.Add)...)
+	if edits.Remove != "" {
+		filter.Remove = append(filter.Remove, strings.Split(edits.Remove, ";")...)
+	}
+	return filters, nil
+}
+
+// mergeHeaderEdits merges the request or response edits of a rule into its
+// filters.
+func mergeHeaderEdits(filters []HTTPRouteFilter, edits HeaderEdits, response bool) ([]HTTPRouteFilter, error) {
+	if response {
+		return MergeHeaderEdits(filters, ResponseHeaderModifier, edits)
+	}
+	return MergeHeaderEdits(filters, RequestHeaderModifier, edits)
+}
+
+// prefixHeaderEdits returns the header edits of the rows under prefix, of
+// the request or of the response. Rows without edits are ignored, as for
+// variants; rows with different edits cannot share the prefix rule.
+func prefixHeaderEdits(prefix string, endpoints []Endpoint, response bool) (HeaderEdits, error) {
+	var edits HeaderEdits
+	line := 0
+	for _, e := range endpoints {
+		h := e.RequestHeaders
+		if response {
+			h = e.ResponseHeaders
+		}
+		if h.IsZero() {
+			continue
+		}
+		if line != 0 && h != edits {
+			direction := "request"
+			if response {
+				direction = "response"
+			}
+			return HeaderEdits{}, fmt.Errorf("prefix %s has conflicting %s header modifiers (lines %d and %d)", prefix, direction, line, e.Line)
+		}
+		edits, line = h, e.Line
+	}
+	return edits, nil
+}
@@ -0,0 +1,493 @@
+package convert
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Columns lists every column the parser understands, in canonical
+// lower-case form.
+var Columns = []string{"method", "url", "prefix", "comment", "description", "variant", "service", "port", "weight", "backends", "service_namespace", "backend_kind", "backend_group", "backend_protocol", "match_type", "headers", "query_params", "accept", "content_type", "cookie", "owner", "cache_ttl", "cacheability", "scale_to_zero", "tls", "protocol", "profile", "tier", "fallback", "redirect", "rewrite", "cutover_at", "tags", "hostname", "namespace", "gateway", "gateway_namespace", "set_headers", "add_headers", "remove_headers", "set_response_headers", "add_response_headers", "remove_response_headers", "timeout", "backend_timeout", "retries", "labels", "annotations"}
+
+// columnAliases map alternative spellings to their column.
+var columnAliases = map[string]string{"matchtype": "match_type", "queryparams": "query_params", "contenttype": "content_type"}
+
+// portName is the format of named Service ports (IANA service names), such
+// as http or grpc-web.
+var portName = regexp.MustCompile(`^[a-z0-9]([-a-z0-9]*[a-z0-9])?$`)
+
+// IsPortName reports whether v names a Service port rather than numbering
+// it: at most 15 characters, without "--", and not only digits.
+func IsPortName(v string) bool {
+	if _, err := strconv.Atoi(v); err == nil {
+		return false
+	}
+	return len(v) <= 15 && portName.MatchString(v) && !strings.Contains(v, "--")
+}
+
+// MatchTypes are the path match types of the match_type column.
+var MatchTypes = []string{"PathPrefix", "Exact", "RegularExpression"}
+
+// StandardMethods are the methods defined by RFC 9110 plus PATCH (RFC 5789),
+// matching the HTTPMethod enum of the Gateway API.
+var StandardMethods = []string{"GET", "HEAD", "POST", "PUT", "DELETE", "CONNECT", "OPTIONS", "TRACE", "PATCH"}
+
+// Backend protocols accepted in the backend_protocol column.
+const (
+	ProtocolHTTP  = "http"
+	ProtocolH2C   = "h2c"
+	ProtocolHTTPS = "https"
+	ProtocolWS    = "ws"
+)
+
+// Route protocols of the protocol column.
+const (
+	RouteHTTP = "http"
+	RouteGRPC = "grpc"
+)
+
+// TLS modes of the tls column.
+const (
+	TLSTerminate   = "terminate"
+	TLSPassthrough = "passthrough"
+)
+
+// CanonicalColumn normalizes a header cell, so "URL", "Url " and "url"
+// preceded by a byte order mark all name the url column. Spreadsheets add
+// invisible characters (BOMs, non-breaking and zero-width spaces) to
+// exported headers; inner spaces and dashes become underscores, so
+// "Backend Kind" is backend_kind.
+func CanonicalColumn(h string) string {
+	h = strings.Map(func(r rune) rune {
+		switch {
+		case r == '\ufeff' || r == '\u200b' || r == '\u200c' || r == '\u200d' || r == '\u2060':
+			return -1
+		case unicode.IsSpace(r) || r == '-' || r == '_':
+			return ' '
+		}
+		return unicode.ToLower(r)
+	}, h)
+	h = strings.Join(strings.Fields(h), "_")
+	if alias, ok := columnAliases[h]; ok {
+		return alias
+	}
+	return h
+}
+
+// ColumnIndex maps the canonical names of a header row to their positions.
+func ColumnIndex(header []string) map[string]int {
+	columns := make(map[string]int)
+	for i, h := range header {
+		columns[CanonicalColumn(h)] = i
+	}
+	return columns
+}
+
+// IsColumn reports whether name is one of Columns.
+func IsColumn(name string) bool {
+	for _, c := range Columns {
+		if c == name {
+			return true
+		}
+	}
+	return false
+}
+
+// UnknownColumns lists the header cells that name no known column, with the
+// closest known column when one is near enough to be a typo.
+func UnknownColumns(header []string) string {
+	var unknown []string
+	for _, h := range header {
+		name := CanonicalColumn(h)
+		if name == "" || IsColumn(name) {
+			continue
+		}
+		desc := fmt.Sprintf("%q", h)
+		if closest, ok := closestColumn(name); ok {
+			desc += fmt.Sprintf(" (did you mean %s?)", closest)
+		}
+		unknown = append(unknown, desc)
+	}
+	return strings.Join(unknown, ", ")
+}
+
+// closestColumn returns the known column with the smallest edit distance to
+// name, if it is at most 2 edits away.
+func closestColumn(name string) (string, bool) {
+	best, bestDist := "", 3
+	for _, c := range Columns {
+		if d := editDistance(name, c); d < bestDist {
+			best, bestDist = c, d
+		}
+	}
+	return best, best != ""
+}
+
+// ParseRecord reads one CSV row, with columns mapping canonical column
+// names to positions. Rows without a URL are returned without checking the
+// method, so callers can skip them.
+func ParseRecord(record []string, columns map[string]int, opts Options) (Endpoint, error) {
+	e := Endpoint{}
+	cell := func(name string) (string, bool) {
+		idx, ok := columns[name]
+		if !ok || idx >= len(record) {
+			return "", false
+		}
+		return strings.TrimSpace(record[idx]), true
+	}
+	e.Method, _ = cell("method")
+	e.URL, _ = cell("url")
+	e.Prefix, _ = cell("prefix")
+	e.Comment, _ = cell("comment")
+	e.Description, _ = cell("description")
+	e.Variant, _ = cell("variant")
+	e.Service, _ = cell("service")
+	if v, _ := cell("port"); v != "" {
+		port, err := strconv.Atoi(v)
+		switch {
+		case err != nil && IsPortName(v):
+			e.PortName = v
+		case err != nil || port < 1 || port > 65535:
+			return e, fmt.Errorf("invalid port %q (must be 1-65535 or a port name such as http)", v)
+		default:
+			e.Port = port
+		}
+	}
+	if v, _ := cell("weight"); v != "" {
+		weight, err := strconv.Atoi(v)
+		if err != nil || weight < 1 || weight > 1000000 {
+			return e, fmt.Errorf("invalid weight %q (must be 1-1000000)", v)
+		}
+		e.Weight = weight
+	}
+	if v, _ := cell("backends"); v != "" {
+		backends, err := ParseBackends(v)
+		if err != nil {
+			return e, err
+		}
+		e.Backends = FormatBackends(backends)
+	}
+	e.ServiceNamespace, _ = cell("service_namespace")
+	e.Namespace, _ = cell("namespace")
+	e.Gateway, _ = cell("gateway")
+	e.GatewayNamespace, _ = cell("gateway_namespace")
+	e.BackendKind, _ = cell("backend_kind")
+	e.BackendGroup, _ = cell("backend_group")
+	e.Owner, _ = cell("owner")
+	e.Profile, _ = cell("profile")
+	e.Tier, _ = cell("tier")
+	if v, ok := cell("backend_protocol"); ok {
+		e.BackendProtocol = strings.ToLower(v)
+		if err := ValidateProtocol(e.BackendProtocol); err != nil {
+			return e, err
+		}
+	}
+	if e.Fallback, _ = cell("fallback"); e.Fallback != "" {
+		if _, err := ParseBackend(e.Fallback, opts); err != nil {
+			return e, fmt.Errorf("invalid fallback: %w", err)
+		}
+	}
+	if v, _ := cell("redirect"); v != "" {
+		redirect, err := ParseRedirect(v)
+		if err != nil {
+			return e, err
+		}
+		e.Redirect, _ = FormatRedirect(redirect)
+	}
+	if v, _ := cell("rewrite"); v != "" {
+		rewrite, err := ParseRewrite(v)
+		if err != nil {
+			return e, err
+		}
+		e.Rewrite = rewrite
+	}
+	if v, _ := cell("scale_to_zero"); v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return e, fmt.Errorf("invalid scale_to_zero %q (must be true or false)", v)
+		}
+		e.ScaleToZero = b
+	}
+	if v, _ := cell("tls"); v != "" {
+		e.TLS = strings.ToLower(v)
+		if e.TLS != TLSTerminate && e.TLS != TLSPassthrough {
+			return e, fmt.Errorf("invalid tls %q (must be %s or %s)", v, TLSTerminate, TLSPassthrough)
+		}
+	}
+	if v, _ := cell("protocol"); v != "" {
+		e.Protocol = strings.ToLower(v)
+		if e.Protocol != RouteHTTP && e.Protocol != RouteGRPC {
+			return e, fmt.Errorf("invalid protocol %q (must be %s or %s)", v, RouteHTTP, RouteGRPC)
+		}
+	}
+	if v, _ := cell("tags"); v != "" {
+		e.Tags = ParseTags(v)
+	}
+	if v, _ := cell("cutover_at"); v != "" {
+		t, err := ParseTimestamp(v)
+		if err != nil {
+			return e, fmt.Errorf("invalid cutover_at: %w", err)
+		}
+		e.CutoverAt = t
+	}
+	if v, _ := cell("match_type"); v != "" {
+		matchType, err := NormalizeMatchType(v)
+		if err != nil {
+			return e, err
+		}
+		e.MatchType = matchType
+	}
+	if v, _ := cell("headers"); v != "" {
+		headers, err := normalizeMatchList(v, "headers", true)
+		if err != nil {
+			return e, err
+		}
+		e.Headers = headers
+	}
+	if v, _ := cell("query_params"); v != "" {
+		query, err := normalizeMatchList(v, "query_params", false)
+		if err != nil {
+			return e, err
+		}
+		e.QueryParams = query
+	}
+	if v, _ := cell("hostname"); v != "" {
+		hostnames, err := NormalizeHostnames(v)
+		if err != nil {
+			return e, err
+		}
+		e.Hostnames = hostnames
+	}
+	if v, _ := cell("accept"); v != "" {
+		accept, err := normalizeMediaTypes(v, "accept")
+		if err != nil {
+			return e, err
+		}
+		e.Accept = accept
+	}
+	if v, _ := cell("cookie"); v != "" {
+		cookie, err := normalizeCookie(v)
+		if err != nil {
+			return e, err
+		}
+		e.Cookie = cookie
+	}
+	if v, _ := cell("content_type"); v != "" {
+		contentType, err := normalizeMediaTypes(v, "content_type")
+		if err != nil {
+			return e, err
+		}
+		e.ContentType = contentType
+	}
+	set, _ := cell("set_headers")
+	add, _ := cell("add_headers")
+	remove, _ := cell("remove_headers")
+	requestHeaders, err := parseHeaderEdits(set, add, remove, "headers")
+	if err != nil {
+		return e, err
+	}
+	e.RequestHeaders = requestHeaders
+	set, _ = cell("set_response_headers")
+	add, _ = cell("add_response_headers")
+	remove, _ = cell("remove_response_headers")
+	responseHeaders, err := parseHeaderEdits(set, add, remove, "response_headers")
+	if err != nil {
+		return e, err
+	}
+	e.ResponseHeaders = responseHeaders
+	if v, _ := cell("timeout"); v != "" {
+		if e.Timeout, err = ParseTimeout(v, "timeout"); err != nil {
+			return e, err
+		}
+	}
+	if v, _ := cell("backend_timeout"); v != "" {
+		if e.BackendTimeout, err = ParseTimeout(v, "backend_timeout"); err != nil {
+			return e, err
+		}
+	}
+	if v, _ := cell("retries"); v != "" {
+		if e.Retries, err = ParseRetries(v); err != nil {
+			return e, err
+		}
+	}
+	if v, _ := cell("labels"); v != "" {
+		if e.Labels, err = normalizeMetadataList(v, "labels"); err != nil {
+			return e, err
+		}
+	}
+	if v, _ := cell("annotations"); v != "" {
+		if e.Annotations, err = normalizeMetadataList(v, "annotations"); err != nil {
+			return e, err
+		}
+	}
+	ttl, _ := cell("cache_ttl")
+	cacheability, _ := cell("cacheability")
+	policy, err := CacheControl(ttl, cacheability)
+	if err != nil {
+		return e, err
+	}
+	e.CacheControl = policy
+	if e.BackendKind != "" {
+		group, err := ResolveBackendGroup(e.BackendKind, e.BackendGroup)
+		if err != nil {
+			return e, err
+		}
+		e.BackendGroup = group
+	}
+	if e.URL == "" {
+		return e, nil
+	}
+
+	method, err := NormalizeMethod(e.Method, opts)
+	if err != nil {
+		return e, err
+	}
+	e.Method = method
+	if e.CacheControl != "" && !CacheableMethod(method) {
+		return e, fmt.Errorf("caching policy requires a GET or HEAD row")
+	}
+	return e, nil
+}
+
+// MethodError reports a method cell that is missing while methods are
+// required, or names an unknown method.
+type MethodError struct {
+	Method string
+	// Suggestion is the standard method Method is probably a typo of.
+	Suggestion string
+	// Extra marks a method of opts.ExtraMethods in an HTTPRoute match,
+	// which the CRD rejects: it only accepts StandardMethods.
+	Extra bool
+}
+
+func (e *MethodError) Error() string {
+	switch {
+	case e.Method == "":
+		return "missing method"
+	case e.Extra:
+		return fmt.Sprintf("HTTP method %q cannot be matched by an HTTPRoute, which only accepts %s", e.Method, strings.Join(StandardMethods, ", "))
+	case e.Suggestion != "":
+		return fmt.Sprintf("unknown HTTP method %q (did you mean %s?)", e.Method, e.Suggestion)
+	}
+	return fmt.Sprintf("unknown HTTP method %q", e.Method)
+}
+
+// NormalizeMethod upper-cases a method and checks it against StandardMethods
+// and opts.ExtraMethods. An empty method (or "*") matches every method and
+// is emitted without a method field, unless opts.RequireMethod is set.
+// The methods of opts.ExtraMethods pass, but the HTTPRoute CRD rejects
+// them in a match, so callers writing HTTPRoutes must refuse them.
+func NormalizeMethod(method string, opts Options) (string, error) {
+	if method == "" || method == "*" {
+		if opts.RequireMethod {
+			return "", &MethodError{}
+		}
+		return "", nil
+	}
+	m := strings.ToUpper(method)
+	known := append(append([]string{}, StandardMethods...), opts.ExtraMethods...)
+	for _, k := range known {
+		if m == strings.ToUpper(strings.TrimSpace(k)) {
+			return m, nil
+		}
+	}
+
+	best, bestDist := "", 3
+	for _, k := range StandardMethods {
+		if d := editDistance(m, k); d < bestDist {
+			best, bestDist = k, d
+		}
+	}
+	return "", &MethodError{Method: method, Suggestion: best}
+}
+
+// NormalizeMatchType returns the path match type named by v, one of
+// MatchTypes in any case.
+func NormalizeMatchType(v string) (string, error) {
+	for _, t := range MatchTypes {
+		if strings.EqualFold(v, t) {
+			return t, nil
+		}
+	}
+	return "", fmt.Errorf("invalid match_type %q (must be %s)", v, strings.Join(MatchTypes, ", "))
+}
+
+// ParseBackend parses a "service:port" value into a Service backend in the
+// namespace of opts.Service. The port defaults to opts.Service.Port.
+func ParseBackend(spec string, opts Options) (BackendRef, error) {
+	name, portStr, hasPort := strings.Cut(spec, ":")
+	if name == "" {
+		return BackendRef{}, fmt.Errorf("missing service name in %q", spec)
+	}
+	port := opts.Service.Port
+	if hasPort {
+		p, err := strconv.Atoi(portStr)
+		if err != nil || p < 1 || p > 65535 {
+			return BackendRef{}, fmt.Errorf("invalid port in %q", spec)
+		}
+		port = p
+	}
+	return BackendRef{
+		Group:     "",
+		Kind:      "Service",
+		Name:      name,
+		Namespace: opts.Service.Namespace,
+		Port:      port,
+		Weight:    1,
+	}, nil
+}
+
+// wellKnownBackendGroups are the API groups assumed for backend kinds given
+// without a group.
+var wellKnownBackendGroups = map[string]string{
+	"Service":       "",
+	"ServiceImport": "multicluster.x-k8s.io",
+	"Backend":       "gateway.envoyproxy.io",
+}
+
+// ResolveBackendGroup returns the group of a backend kind, filling in the
+// group of well-known kinds. Only Service lives in the core group, so any
+// other kind needs an explicit group.
+func ResolveBackendGroup(kind, group string) (string, error) {
+	if group != "" {
+		return group, nil
+	}
+	known, ok := wellKnownBackendGroups[kind]
+	if !ok {
+		return "", fmt.Errorf("backend kind %q needs a group", kind)
+	}
+	return known, nil
+}
+
+// ValidateProtocol checks a backend_protocol value.
+func ValidateProtocol(p string) error {
+	switch p {
+	case "", ProtocolHTTP, ProtocolH2C, ProtocolHTTPS, ProtocolWS:
+		return nil
+	}
+	return fmt.Errorf("invalid backend_protocol %q (must be %s, %s, %s or %s)", p, ProtocolHTTP, ProtocolH2C, ProtocolHTTPS, ProtocolWS)
+}
+
+// editDistance returns the Levenshtein distance between a and b.
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur := make([]int, len(b)+1)
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev = cur
+	}
+	return prev[len(b)]
+}
@@ -0,0 +1,144 @@
+package convert
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// RedirectStatusCodes are the status codes of the redirect column, the ones
+// every Gateway API implementation supports. The first is the default, as
+// in the Gateway API.
+var RedirectStatusCodes = []int{302, 301}
+
+// ParseRedirect parses a redirect cell: an optional status code followed by
+// the target, "scheme://hostname:port/path" with any part left out, such as
+// "https://" to only change the scheme, "//new.example.com" to only change
+// the hostname, or "/new" to only change the path.
+func ParseRedirect(v string) (HTTPRequestRedirectFilter, error) {
+	redirect := HTTPRequestRedirectFilter{StatusCode: RedirectStatusCodes[0]}
+	target := strings.TrimSpace(v)
+	if code, rest, ok := strings.Cut(target, " "); ok {
+		n, err := strconv.Atoi(code)
+		if err != nil || !validRedirectStatus(n) {
+			return redirect, fmt.Errorf("invalid redirect %q (status code must be 301 or 302)", v)
+		}
+		redirect.StatusCode, target = n, strings.TrimSpace(rest)
+	}
+	u, err := url.Parse(target)
+	if err != nil || target == "" || u.Opaque != "" || u.User != nil || u.RawQuery != "" || u.Fragment != "" || strings.HasSuffix(target, "?") {
+		return redirect, fmt.Errorf("invalid redirect %q (want [301|302] scheme://hostname:port/path, any part optional)", v)
+	}
+	switch strings.ToLower(u.Scheme) {
+	case "", "http", "https":
+		redirect.Scheme = strings.ToLower(u.Scheme)
+	default:
+		return redirect, fmt.Errorf("invalid redirect %q (scheme must be http or https)", v)
+	}
+	redirect.Hostname = strings.ToLower(u.Hostname())
+	if p := u.Port(); p != "" {
+		port, err := strconv.Atoi(p)
+		if err != nil || port < 1 || port > 65535 {
+			return redirect, fmt.Errorf("invalid redirect %q (invalid port %s)", v, p)
+		}
+		redirect.Port = port
+	} else if strings.HasSuffix(u.Host, ":") {
+		return redirect, fmt.Errorf("invalid redirect %q (missing port)", v)
+	}
+	if strings.Contains(redirect.Hostname, "*") {
+		return redirect, fmt.Errorf("invalid redirect %q (hostname cannot be a wildcard)", v)
+	}
+	if u.Path != "" {
+		redirect.Path = &PathRewrite{Type: "ReplaceFullPath", ReplaceFullPath: u.Path}
+	}
+	if redirect.Scheme == "" && redirect.Hostname == "" && redirect.Port == 0 && redirect.Path == nil {
+		return redirect, fmt.Errorf("invalid redirect %q (no scheme, hostname, port or path to redirect to)", v)
+	}
+	return redirect, nil
+}
+
+// FormatRedirect is the redirect cell of redirect, in the form ParseRedirect
+// reads; the status code is left out when it is the default. It reports
+// false for redirects the column cannot express, such as prefix rewrites.
+func FormatRedirect(redirect HTTPRequestRedirectFilter) (string, bool) {
+	if redirect.Path != nil && redirect.Path.Type != "ReplaceFullPath" {
+		return "", false
+	}
+	var b strings.Builder
+	switch redirect.StatusCode {
+	case 0, RedirectStatusCodes[0]:
+	default:
+		if !validRedirectStatus(redirect.StatusCode) {
+			return "", false
+		}
+		fmt.Fprintf(&b, "%d ", redirect.StatusCode)
+	}
+	if redirect.Scheme != "" {
+		b.WriteString(redirect.Scheme + ":")
+	}
+	if redirect.Scheme != "" || redirect.Hostname != "" || redirect.Port != 0 {
+		b.WriteString("//" + redirect.Hostname)
+		if redirect.Port != 0 {
+			b.WriteString(":" + strconv.Itoa(redirect.Port))
+		}
+	}
+	if redirect.Path != nil {
+		b.WriteString(redirect.Path.ReplaceFullPath)
+	}
+	return b.String(), b.Len() > 0
+}
+
+func validRedirectStatus(code int) bool {
+	for _, c := range RedirectStatusCodes {
+		if c == code {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseRewrite checks a rewrite cell: the full path requests are rewritten
+// to before they reach the backend.
+func ParseRewrite(v string) (string, error) {
+	if !strings.HasPrefix(v, "/") || strings.ContainsAny(v, "?# \t") {
+		return "", fmt.Errorf("invalid rewrite %q (want an absolute path such as /v2/users)", v)
+	}
+	return v, nil
+}
+
+// checkRedirect rejects the columns a redirect or rewrite row cannot be
+// combined with: a prefix rule already rewrites the path, and a redirected
+// request never reaches a fallback.
+func checkRedirect(e Endpoint) error {
+	switch {
+	case e.Redirect != "" && e.Rewrite != "":
+		return fmt.Errorf("line %d: redirect and rewrite cannot be combined", e.Line)
+	case e.Redirect != "" && e.Prefix != "":
+		return fmt.Errorf("line %d: redirect cannot be combined with prefix", e.Line)
+	case e.Rewrite != "" && e.Prefix != "":
+		return fmt.Errorf("line %d: rewrite cannot be combined with prefix", e.Line)
+	case e.Redirect != "" && e.Fallback != "":
+		return fmt.Errorf("line %d: redirect cannot be combined with fallback", e.Line)
+	}
+	return nil
+}
+
+// redirectFilter is the RequestRedirect filter of a redirect column value.
+func redirectFilter(v string) (HTTPRouteFilter, error) {
+	redirect, err := ParseRedirect(v)
+	if err != nil {
+		return HTTPRouteFilter{}, err
+	}
+	return HTTPRouteFilter{Type: "RequestRedirect", RequestRedirect: &redirect}, nil
+}
+
+// rewriteFilter is the URLRewrite filter replacing the full path with path.
+func rewriteFilter(path string) HTTPRouteFilter {
+	return HTTPRouteFilter{
+		Type: "URLRewrite",
+		URLRewrite: &URLRewriteFilter{
+			Path: &PathRewrite{Type: "ReplaceFullPath", ReplaceFullPath: path},
+		},
+	}
+}
@@ -0,0 +1,50 @@
+package convert
+
+import (
+	"slices"
+	"strings"
+)
+
+// ParseTags splits a tags cell into its tags, which may be separated by
+// ";", "," or spaces. Tags are compared case-insensitively and returned in
+// lower case, without duplicates.
+func ParseTags(v string) []string {
+	var tags []string
+	for _, t := range strings.FieldsFunc(v, func(r rune) bool {
+		return r == ';' || r == ',' || r == ' ' || r == '\t'
+	}) {
+		t = strings.ToLower(t)
+		if !slices.Contains(tags, t) {
+			tags = append(tags, t)
+		}
+	}
+	return tags
+}
+
+// FilterTags returns the rows of endpoints that carry at least one tag of
+// include (any row when include is empty) and no tag of exclude.
+func FilterTags(endpoints []Endpoint, include, exclude []string) []Endpoint {
+	if len(include) == 0 && len(exclude) == 0 {
+		return endpoints
+	}
+	var kept []Endpoint
+	for _, e := range endpoints {
+		if len(include) > 0 && !hasAnyTag(e, include) {
+			continue
+		}
+		if hasAnyTag(e, exclude) {
+			continue
+		}
+		kept = append(kept, e)
+	}
+	return kept
+}
+
+func hasAnyTag(e Endpoint, tags []string) bool {
+	for _, t := range tags {
+		if slices.Contains(e.Tags, strings.ToLower(t)) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,204 @@
+package convert
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// HTTPRouteTimeouts are the timeouts of a rule, as Gateway API durations.
+// Request bounds the whole request, retries included; BackendRequest
+// bounds each request to a backend.
+type HTTPRouteTimeouts struct {
+	Request        string `yaml:"request,omitempty"`
+	BackendRequest string `yaml:"backendRequest,omitempty"`
+}
+
+// HTTPRouteRetry is the retry policy of a rule.
+type HTTPRouteRetry struct {
+	Codes    []int  `yaml:"codes,omitempty"`
+	Attempts int    `yaml:"attempts,omitempty"`
+	Backoff  string `yaml:"backoff,omitempty"`
+}
+
+// rulePolicy is the timeout, backend_timeout and retries of a row with the
+// defaults of Options filled in.
+type rulePolicy struct {
+	Timeout        string
+	BackendTimeout string
+	Retries        string
+}
+
+// policyOf is the rule policy of e, checking that a backend request can
+// finish within the request timeout.
+func policyOf(e Endpoint, opts Options) (rulePolicy, error) {
+	p := rulePolicy{Timeout: e.Timeout, BackendTimeout: e.BackendTimeout, Retries: e.Retries}
+	if p.Timeout == "" {
+		p.Timeout = opts.Timeout
+	}
+	if p.BackendTimeout == "" {
+		p.BackendTimeout = opts.BackendTimeout
+	}
+	if p.Retries == "" {
+		p.Retries = opts.Retries
+	}
+	if p.Timeout != "" && p.BackendTimeout != "" {
+		request, _ := time.ParseDuration(p.Timeout)
+		backend, _ := time.ParseDuration(p.BackendTimeout)
+		if request != 0 && (backend == 0 || backend > request) {
+			return p, fmt.Errorf("backend_timeout %s exceeds timeout %s", p.BackendTimeout, p.Timeout)
+		}
+	}
+	return p, nil
+}
+
+// apply sets the timeouts and retry policy of p on rule.
+func (p rulePolicy) apply(rule *HTTPRouteRule) {
+	if p.Timeout != "" || p.BackendTimeout != "" {
+		rule.Timeouts = &HTTPRouteTimeouts{Request: p.Timeout, BackendRequest: p.BackendTimeout}
+	}
+	rule.Retry = RetryOf(p.Retries)
+}
+
+// prefixPolicy returns the policy of the rows under prefix. Rows without
+// one are ignored, as for variants; rows with different policies cannot
+// share the prefix rule.
+func prefixPolicy(prefix string, endpoints []Endpoint, opts Options) (rulePolicy, error) {
+	var policy rulePolicy
+	line := 0
+	for _, e := range endpoints {
+		p, err := policyOf(e, opts)
+		if err != nil {
+			return rulePolicy{}, fmt.Errorf("line %d: %w", e.Line, err)
+		}
+		if p == (rulePolicy{}) {
+			continue
+		}
+		if line != 0 && p != policy {
+			return rulePolicy{}, fmt.Errorf("prefix %s has conflicting timeouts or retries (lines %d and %d)", prefix, line, e.Line)
+		}
+		policy, line = p, e.Line
+	}
+	return policy, nil
+}
+
+// ParseTimeout reads a timeout or backend_timeout cell: whole seconds
+// ("30") or a duration ("1m30s", "500ms"), returned as a Gateway API
+// duration. "0s" disables the timeout.
+func ParseTimeout(v, column string) (string, error) {
+	d, err := time.ParseDuration(v)
+	if n, nerr := strconv.Atoi(v); nerr == nil {
+		d, err = time.Duration(n)*time.Second, nil
+	}
+	if err != nil || d < 0 {
+		return "", fmt.Errorf("invalid %s %q (want seconds or a duration such as 30s or 500ms)", column, v)
+	}
+	s, ok := FormatDuration(d)
+	if !ok {
+		return "", fmt.Errorf("invalid %s %q (must be whole milliseconds, below 100000h)", column, v)
+	}
+	return s, nil
+}
+
+// FormatDuration writes d as a Gateway API duration, such as "1m30s", or
+// reports that it has none: durations are whole milliseconds with at most
+// five digits per unit.
+func FormatDuration(d time.Duration) (string, bool) {
+	if d%time.Millisecond != 0 || d >= 100000*time.Hour {
+		return "", false
+	}
+	if d == 0 {
+		return "0s", true
+	}
+	var b strings.Builder
+	for _, unit := range []struct {
+		size time.Duration
+		name string
+	}{{time.Hour, "h"}, {time.Minute, "m"}, {time.Second, "s"}, {time.Millisecond, "ms"}} {
+		if n := d / unit.size; n > 0 {
+			fmt.Fprintf(&b, "%d%s", n, unit.name)
+			d -= n * unit.size
+		}
+	}
+	return b.String(), true
+}
+
+// ParseRetries reads a retries cell, attempts[:backoff[:codes]], such as
+// "3", "3:100ms" or "3:100ms:502;503": the retries of a failed request, the
+// backoff between them, and the response codes retried (400-599) besides
+// the connection errors implementations retry anyway. "0" disables the
+// retries of a default.
+func ParseRetries(v string) (string, error) {
+	parts := strings.Split(v, ":")
+	attempts, err := strconv.Atoi(strings.TrimSpace(parts[0]))
+	if len(parts) > 3 || err != nil || attempts < 0 {
+		return "", fmt.Errorf("invalid retries %q (want attempts[:backoff[:codes]], e.g. 3:100ms:502;503)", v)
+	}
+	if attempts == 0 {
+		if len(parts) > 1 {
+			return "", fmt.Errorf("invalid retries %q (0 disables retries and takes no backoff or codes)", v)
+		}
+		return "0", nil
+	}
+	out := []string{strconv.Itoa(attempts)}
+	if len(parts) > 1 {
+		backoff := strings.TrimSpace(parts[1])
+		if backoff != "" {
+			if backoff, err = ParseTimeout(backoff, "retries backoff"); err != nil {
+				return "", err
+			}
+		}
+		out = append(out, backoff)
+	}
+	if len(parts) > 2 {
+		var codes []string
+		for _, c := range strings.Split(parts[2], ";") {
+			c = strings.TrimSpace(c)
+			if c == "" {
+				continue
+			}
+			code, err := strconv.Atoi(c)
+			if err != nil || code < 400 || code > 599 {
+				return "", fmt.Errorf("invalid retries code %q (must be 400-599)", c)
+			}
+			if slices.Contains(codes, c) {
+				return "", fmt.Errorf("invalid retries %q: code %s is given twice", v, c)
+			}
+			codes = append(codes, c)
+		}
+		out = append(out, strings.Join(codes, ";"))
+	}
+	return strings.TrimRight(strings.Join(out, ":"), ":"), nil
+}
+
+// RetryOf is the retry policy of a retries cell as ParseRetries returns
+// it, nil for none.
+func RetryOf(retries string) *HTTPRouteRetry {
+	if retries == "" || retries == "0" {
+		return nil
+	}
+	parts := strings.Split(retries, ":")
+	r := &HTTPRouteRetry{}
+	r.Attempts, _ = strconv.Atoi(parts[0])
+	if len(parts) > 1 {
+		r.Backoff = parts[1]
+	}
+	if len(parts) > 2 {
+		for _, c := range strings.Split(parts[2], ";") {
+			code, _ := strconv.Atoi(c)
+			r.Codes = append(r.Codes, code)
+		}
+	}
+	return r
+}
+
+// FormatRetries is the retries cell of r, in the form ParseRetries reads.
+func FormatRetries(r HTTPRouteRetry) string {
+	codes := make([]string, len(r.Codes))
+	for i, c := range r.Codes {
+		codes[i] = strconv.Itoa(c)
+	}
+	return strings.TrimRight(fmt.Sprintf("%d:%s:%s", r.Attempts, r.Backoff, strings.Join(codes, ";")), ":")
+}
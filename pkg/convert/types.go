@@ -0,0 +1,264 @@
+package convert
+
+import "time"
+
+// HTTPRoute structs based on the CRD. Fields that only exist in the
+// experimental channel are tagged `gateway:"experimental"`.
+type HTTPRoute struct {
+	APIVersion string        `yaml:"apiVersion"`
+	Kind       string        `yaml:"kind"`
+	Metadata   Metadata      `yaml:"metadata"`
+	Spec       HTTPRouteSpec `yaml:"spec"`
+}
+
+type Metadata struct {
+	Name        string            `yaml:"name"`
+	Namespace   string            `yaml:"namespace,omitempty"`
+	Labels      map[string]string `yaml:"labels,omitempty"`
+	Annotations map[string]string `yaml:"annotations,omitempty"`
+}
+
+type HTTPRouteSpec struct {
+	ParentRefs []ParentRef     `yaml:"parentRefs,omitempty"`
+	Hostnames  []string        `yaml:"hostnames,omitempty"`
+	Rules      []HTTPRouteRule `yaml:"rules,omitempty"`
+}
+
+type ParentRef struct {
+	Group     string `yaml:"group,omitempty"`
+	Kind      string `yaml:"kind,omitempty"`
+	Name      string `yaml:"name"`
+	Namespace string `yaml:"namespace,omitempty"`
+	// SectionName and Port select a listener of the parent Gateway.
+	SectionName string `yaml:"sectionName,omitempty"`
+	Port        int    `yaml:"port,omitempty" gateway:"experimental"`
+}
+
+type HTTPRouteRule struct {
+	Matches     []HTTPRouteMatch   `yaml:"matches,omitempty"`
+	Filters     []HTTPRouteFilter  `yaml:"filters,omitempty"`
+	BackendRefs []BackendRef       `yaml:"backendRefs,omitempty"`
+	Timeouts    *HTTPRouteTimeouts `yaml:"timeouts,omitempty"`
+	Retry       *HTTPRouteRetry    `yaml:"retry,omitempty" gateway:"experimental"`
+}
+
+type HTTPRouteMatch struct {
+	Path        *HTTPPathMatch        `yaml:"path,omitempty"`
+	Headers     []HTTPHeaderMatch     `yaml:"headers,omitempty"`
+	QueryParams []HTTPQueryParamMatch `yaml:"queryParams,omitempty"`
+	Method      string                `yaml:"method,omitempty"`
+
+	// SourceLines are the CSV lines that produced this match; not emitted.
+	SourceLines []int `yaml:"-"`
+	// Description is the description column of the rows of this match;
+	// not emitted.
+	Description string `yaml:"-"`
+}
+
+type HTTPPathMatch struct {
+	Type  string `yaml:"type,omitempty"`
+	Value string `yaml:"value,omitempty"`
+}
+
+type HTTPHeaderMatch struct {
+	Type  string `yaml:"type,omitempty"`
+	Name  string `yaml:"name"`
+	Value string `yaml:"value"`
+}
+
+type HTTPQueryParamMatch struct {
+	Type  string `yaml:"type,omitempty"`
+	Name  string `yaml:"name"`
+	Value string `yaml:"value"`
+}
+
+type HTTPRouteFilter struct {
+	Type                   string                     `yaml:"type"`
+	RequestHeaderModifier  *HTTPHeaderFilter          `yaml:"requestHeaderModifier,omitempty"`
+	ResponseHeaderModifier *HTTPHeaderFilter          `yaml:"responseHeaderModifier,omitempty"`
+	URLRewrite             *URLRewriteFilter          `yaml:"urlRewrite,omitempty"`
+	RequestRedirect        *HTTPRequestRedirectFilter `yaml:"requestRedirect,omitempty"`
+	RequestMirror          *HTTPRequestMirrorFilter   `yaml:"requestMirror,omitempty"`
+	ExtensionRef           *LocalObjectReference      `yaml:"extensionRef,omitempty"`
+}
+
+// LocalObjectReference names an object in the namespace of the route, such
+// as the implementation-specific filter of an ExtensionRef.
+type LocalObjectReference struct {
+	Group string `yaml:"group"`
+	Kind  string `yaml:"kind"`
+	Name  string `yaml:"name"`
+}
+
+type HTTPRequestRedirectFilter struct {
+	Scheme     string       `yaml:"scheme,omitempty"`
+	Hostname   string       `yaml:"hostname,omitempty"`
+	Path       *PathRewrite `yaml:"path,omitempty"`
+	Port       int          `yaml:"port,omitempty"`
+	StatusCode int          `yaml:"statusCode,omitempty"`
+}
+
+type HTTPHeaderFilter struct {
+	Set    []HTTPHeader `yaml:"set,omitempty"`
+	Add    []HTTPHeader `yaml:"add,omitempty"`
+	Remove []string     `yaml:"remove,omitempty"`
+}
+
+type HTTPHeader struct {
+	Name  string `yaml:"name"`
+	Value string `yaml:"value"`
+}
+
+type URLRewriteFilter struct {
+	Path *PathRewrite `yaml:"path,omitempty"`
+}
+
+type PathRewrite struct {
+	Type               string `yaml:"type,omitempty"`
+	ReplacePrefixMatch string `yaml:"replacePrefixMatch,omitempty"`
+	ReplaceFullPath    string `yaml:"replaceFullPath,omitempty"`
+}
+
+type BackendRef struct {
+	Group     string `yaml:"group,omitempty"`
+	Kind      string `yaml:"kind,omitempty"`
+	Name      string `yaml:"name"`
+	Namespace string `yaml:"namespace,omitempty"`
+	Port      int    `yaml:"port,omitempty"`
+	Weight    int    `yaml:"weight,omitempty"`
+	// Standby emits a zero Weight, which omitempty would drop.
+	Standby bool `yaml:"-"`
+}
+
+// MarshalYAML emits BackendRef with an explicit weight of 0 for standby
+// backends; an omitted weight means 1.
+func (b BackendRef) MarshalYAML() (any, error) {
+	type plain BackendRef
+	if !b.Standby {
+		return plain(b), nil
+	}
+	return struct {
+		Group     string `yaml:"group,omitempty"`
+		Kind      string `yaml:"kind,omitempty"`
+		Name      string `yaml:"name"`
+		Namespace string `yaml:"namespace,omitempty"`
+		Port      int    `yaml:"port,omitempty"`
+		Weight    int    `yaml:"weight"`
+	}{b.Group, b.Kind, b.Name, b.Namespace, b.Port, b.Weight}, nil
+}
+
+type HTTPRequestMirrorFilter struct {
+	BackendRef BackendRef `yaml:"backendRef"`
+}
+
+// Endpoint is one row of an inventory CSV.
+type Endpoint struct {
+	Method  string
+	URL     string
+	Prefix  string
+	Comment string
+	// Description is the description column: the human-readable intent of
+	// the row, carried to the rule-descriptions annotation of its route.
+	Description string
+	Variant     string
+	Service     string
+	Port        int
+	// PortName is a named port of the Service in the port column, such as
+	// http, instead of its number. Port stays 0 until the caller resolves
+	// it.
+	PortName string
+	// Weight is the weight column: the weight of the row's backendRef, 1
+	// when unset. ServiceNamespace overrides the namespace of Options.Service.
+	Weight           int
+	ServiceNamespace string
+	// Backends is the backends column, as FormatBackends writes it: the
+	// Services the row's traffic is split between, replacing Service, Port
+	// and Weight.
+	Backends string
+	// BackendKind and BackendGroup override the backend kind and group of
+	// Options.Service.
+	BackendKind  string
+	BackendGroup string
+	// BackendProtocol is the backend_protocol column (h2c, https, ws).
+	BackendProtocol string
+	// MatchType is the match_type column: the path match type of the row's
+	// direct match, taking the URL literally. Empty for Options.CompilePath.
+	MatchType string
+	// Headers and QueryParams are the headers and query_params columns:
+	// "name=value" pairs separated by ";" that requests must also carry to
+	// take the row's direct match.
+	Headers     string
+	QueryParams string
+	// Accept and ContentType are the accept and content_type columns:
+	// media types separated by ",", one of which the Accept header must
+	// list, or the Content-Type header be, to take the row's direct match.
+	Accept      string
+	ContentType string
+	// Cookie is the cookie column: the name=value of a cookie requests must
+	// carry, among any others, to take the row's direct match.
+	Cookie string
+	// Owner is the team owning the row.
+	Owner string
+	// Profile names the conversion profile of the row.
+	Profile string
+	// Tier names the SLA tier of the row, whose timeouts, retries and rate
+	// limit the command applies.
+	Tier string
+	// ScaleToZero routes the row through the KEDA HTTP interceptor.
+	ScaleToZero bool
+	// TLS is the tls column: TLSTerminate (or empty) for rows the gateway
+	// terminates TLS for, TLSPassthrough for rows it forwards encrypted by
+	// SNI. Build serves every row over HTTP; the command moves passthrough
+	// rows into TLSRoutes.
+	TLS string
+	// Protocol is the protocol column: RouteHTTP (or empty) for rows served
+	// by HTTPRoutes, RouteGRPC for gRPC methods, which the command moves
+	// into GRPCRoutes.
+	Protocol string
+	// Gone marks a row removed from the CSV that is still within its grace
+	// period.
+	Gone bool
+	// Fallback is the fallback column: the service:port traffic can shift
+	// to when the primary backend fails.
+	Fallback string
+	// Redirect is the redirect column, as FormatRedirect writes it: the row
+	// answers with a redirect instead of reaching a backend. Rewrite is the
+	// rewrite column: the full path the row's requests are rewritten to.
+	Redirect string
+	Rewrite  string
+	// CacheControl is the Cache-Control value built from the cache_ttl and
+	// cacheability columns.
+	CacheControl string
+	// RequestHeaders are the set_headers, add_headers and remove_headers
+	// columns, ResponseHeaders their set_response_headers,
+	// add_response_headers and remove_response_headers counterparts.
+	RequestHeaders  HeaderEdits
+	ResponseHeaders HeaderEdits
+	// Timeout and BackendTimeout are the timeout and backend_timeout
+	// columns, as Gateway API durations. Retries is the retries column, as
+	// ParseRetries returns it.
+	Timeout        string
+	BackendTimeout string
+	Retries        string
+	// Labels and Annotations are the labels and annotations columns:
+	// "key=value" pairs separated by ";", sorted by key, added to the
+	// metadata of the row's route.
+	Labels      string
+	Annotations string
+	// Tags are the tags column, in lower case; see FilterTags.
+	Tags []string
+	// CutoverAt is the cutover_at column: the time the row takes effect,
+	// see ActiveAt. Zero for rows that are always in effect.
+	CutoverAt time.Time
+	// Hostnames is the hostname column: the hostnames serving the row
+	// instead of those of its route target, separated by ";".
+	Hostnames string
+	// Hostname is set by "#!" directive rows; Namespace, Gateway and
+	// GatewayNamespace by the namespace, gateway and gateway_namespace
+	// columns or directives. They select the route target of the row.
+	Hostname         string
+	Namespace        string
+	Gateway          string
+	GatewayNamespace string
+	Line             int
+}
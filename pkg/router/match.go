@@ -0,0 +1,144 @@
+package router
+
+import (
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// Path match kinds in precedence order.
+const (
+	pathKindRegex  = 1
+	pathKindPrefix = 2
+	pathKindExact  = 3
+)
+
+// rank orders candidate matches by Gateway API precedence; larger wins.
+type rank struct {
+	host      int
+	pathKind  int
+	pathLen   int
+	hasMethod bool
+	headers   int
+	query     int
+}
+
+func (a rank) better(b rank) bool {
+	if a.host != b.host {
+		return a.host > b.host
+	}
+	if a.pathKind != b.pathKind {
+		return a.pathKind > b.pathKind
+	}
+	if a.pathLen != b.pathLen {
+		return a.pathLen > b.pathLen
+	}
+	if a.hasMethod != b.hasMethod {
+		return a.hasMethod
+	}
+	if a.headers != b.headers {
+		return a.headers > b.headers
+	}
+	return a.query > b.query
+}
+
+// matchOne applies one RouteMatch to req.
+func matchOne(m RouteMatch, req Request) (rank, bool) {
+	if m.Method != "" && m.Method != req.Method {
+		return rank{}, false
+	}
+	kind, length, ok := matchPath(m.Path, req.Path)
+	if !ok {
+		return rank{}, false
+	}
+	for _, h := range m.Headers {
+		if !matchValue(h.Type, h.Value, req.Headers.Values(http.CanonicalHeaderKey(h.Name))) {
+			return rank{}, false
+		}
+	}
+	for _, q := range m.QueryParams {
+		if !matchValue(q.Type, q.Value, req.Query[q.Name]) {
+			return rank{}, false
+		}
+	}
+	return rank{
+		pathKind:  kind,
+		pathLen:   length,
+		hasMethod: m.Method != "",
+		headers:   len(m.Headers),
+		query:     len(m.QueryParams),
+	}, true
+}
+
+// matchHost reports whether host is served by a route with hostnames and how
+// specific the match is. Routes without hostnames, and requests without a
+// host, match with the lowest specificity.
+func matchHost(hostnames []string, host string) (int, bool) {
+	if len(hostnames) == 0 || host == "" {
+		return 0, true
+	}
+	host = strings.ToLower(host)
+	best, ok := 0, false
+	for _, h := range hostnames {
+		h = strings.ToLower(h)
+		switch {
+		case h == host:
+			best, ok = max(best, 2000+len(h)), true
+		case strings.HasPrefix(h, "*.") && len(host) > len(h)-1 && strings.HasSuffix(host, h[1:]):
+			best, ok = max(best, 1000+len(h)), true
+		}
+	}
+	return best, ok
+}
+
+// matchPath applies a PathMatch to path. A nil match is PathPrefix "/", and
+// prefixes match on whole path segments as the spec requires.
+func matchPath(m *PathMatch, path string) (kind, length int, ok bool) {
+	typ, value := "PathPrefix", "/"
+	if m != nil {
+		typ, value = m.Type, m.Value
+	}
+	switch typ {
+	case "Exact":
+		return pathKindExact, len(value), path == value
+	case "RegularExpression":
+		re := compile(value)
+		return pathKindRegex, len(value), re != nil && re.MatchString(path)
+	default:
+		prefix := strings.TrimSuffix(value, "/")
+		ok := prefix == "" || path == prefix || strings.HasPrefix(path, prefix+"/")
+		return pathKindPrefix, len(prefix), ok
+	}
+}
+
+// matchValue reports whether any of values matches an Exact or
+// RegularExpression header or query parameter match.
+func matchValue(typ, want string, values []string) bool {
+	for _, v := range values {
+		if typ == "RegularExpression" {
+			if re := compile(want); re != nil && re.MatchString(v) {
+				return true
+			}
+		} else if v == want {
+			return true
+		}
+	}
+	return false
+}
+
+// regexps caches compiled expressions; invalid ones are cached as nil so
+// they never match.
+var regexps sync.Map
+
+func compile(expr string) *regexp.Regexp {
+	if re, ok := regexps.Load(expr); ok {
+		return re.(*regexp.Regexp)
+	}
+	re, err := regexp.Compile("^(?:" + expr + ")$")
+	if err != nil {
+		re = nil
+	}
+	regexps.Store(expr, re)
+	return re
+}
@@ -0,0 +1,245 @@
+// Package router is an in-memory Gateway API routing table. It loads
+// HTTPRoutes, such as the manifests generated by csv2httproute, and answers
+// which rule would serve a request using the match precedence of the
+// HTTPRoute specification, so application teams can unit-test that their
+// requests route where they expect:
+//
+//	table, err := router.LoadFiles("k8s/routes/orders.yaml")
+//	if err != nil {
+//		t.Fatal(err)
+//	}
+//	res, ok := table.Match("GET", "shop.example.com", "/orders/42")
+//	if !ok || res.Rule.BackendRefs[0].Name != "orders-svc" {
+//		t.Errorf("GET /orders/42 routed to %v", res)
+//	}
+//
+// Only the fields that affect matching and the routing outcome are modelled.
+// Filters are kept as generic maps.
+package router
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+
+	"gopkg.in/yaml.v3"
+)
+
+// HTTPRoute is the subset of a gateway.networking.k8s.io HTTPRoute used for
+// routing.
+type HTTPRoute struct {
+	APIVersion string   `yaml:"apiVersion"`
+	Kind       string   `yaml:"kind"`
+	Metadata   Metadata `yaml:"metadata"`
+	Spec       Spec     `yaml:"spec"`
+}
+
+// Metadata identifies a route.
+type Metadata struct {
+	Name      string `yaml:"name"`
+	Namespace string `yaml:"namespace,omitempty"`
+}
+
+// Spec holds the hostnames and rules of a route.
+type Spec struct {
+	Hostnames []string `yaml:"hostnames,omitempty"`
+	Rules     []Rule   `yaml:"rules,omitempty"`
+}
+
+// Rule is one HTTPRoute rule.
+type Rule struct {
+	Matches     []RouteMatch     `yaml:"matches,omitempty"`
+	Filters     []map[string]any `yaml:"filters,omitempty"`
+	BackendRefs []BackendRef     `yaml:"backendRefs,omitempty"`
+}
+
+// RouteMatch is one HTTPRouteMatch. A match without a path matches
+// PathPrefix "/".
+type RouteMatch struct {
+	Path        *PathMatch        `yaml:"path,omitempty"`
+	Headers     []HeaderMatch     `yaml:"headers,omitempty"`
+	QueryParams []QueryParamMatch `yaml:"queryParams,omitempty"`
+	Method      string            `yaml:"method,omitempty"`
+}
+
+// PathMatch matches the request path by Exact, PathPrefix or
+// RegularExpression type.
+type PathMatch struct {
+	Type  string `yaml:"type"`
+	Value string `yaml:"value"`
+}
+
+// HeaderMatch matches a request header by Exact (default) or
+// RegularExpression type.
+type HeaderMatch struct {
+	Type  string `yaml:"type,omitempty"`
+	Name  string `yaml:"name"`
+	Value string `yaml:"value"`
+}
+
+// QueryParamMatch matches a query parameter by Exact (default) or
+// RegularExpression type.
+type QueryParamMatch struct {
+	Type  string `yaml:"type,omitempty"`
+	Name  string `yaml:"name"`
+	Value string `yaml:"value"`
+}
+
+// BackendRef is a backend a rule forwards to.
+type BackendRef struct {
+	Group     string `yaml:"group,omitempty"`
+	Kind      string `yaml:"kind,omitempty"`
+	Name      string `yaml:"name"`
+	Namespace string `yaml:"namespace,omitempty"`
+	Port      int    `yaml:"port,omitempty"`
+	Weight    int    `yaml:"weight,omitempty"`
+}
+
+// Request is a request to route. Host may be empty to match routes of any
+// hostname.
+type Request struct {
+	Method  string
+	Host    string
+	Path    string
+	Headers http.Header
+	Query   url.Values
+}
+
+// Result is the rule selected for a request.
+type Result struct {
+	Route     *HTTPRoute
+	RuleIndex int
+	Rule      *Rule
+	// MatchIndex is the index of the winning match within Rule.Matches.
+	MatchIndex int
+}
+
+func (r *Result) String() string {
+	if r == nil {
+		return "<no match>"
+	}
+	return fmt.Sprintf("%s/%s rule %d", r.Route.Metadata.Namespace, r.Route.Metadata.Name, r.RuleIndex)
+}
+
+// Table is a set of HTTPRoutes attached to the same listener.
+type Table struct {
+	routes []*HTTPRoute
+}
+
+// New returns a table of routes.
+func New(routes ...HTTPRoute) *Table {
+	t := &Table{}
+	for _, r := range routes {
+		t.Add(r)
+	}
+	return t
+}
+
+// Add adds a route to the table.
+func (t *Table) Add(route HTTPRoute) {
+	r := route
+	t.routes = append(t.routes, &r)
+	// The spec breaks ties between routes by creation time, then by
+	// "{namespace}/{name}". Loaded manifests carry no creation time, so the
+	// alphabetical order is used.
+	sort.SliceStable(t.routes, func(i, j int) bool {
+		a, b := t.routes[i].Metadata, t.routes[j].Metadata
+		if a.Namespace != b.Namespace {
+			return a.Namespace < b.Namespace
+		}
+		return a.Name < b.Name
+	})
+}
+
+// Routes returns the routes of the table in precedence tie-break order.
+func (t *Table) Routes() []*HTTPRoute {
+	return t.routes
+}
+
+// Load reads multi-document YAML and adds every HTTPRoute in it to a new
+// table. Documents of other kinds are ignored.
+func Load(r io.Reader) (*Table, error) {
+	t := &Table{}
+	if err := t.load(r); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// LoadFiles loads the HTTPRoutes of every file into one table.
+func LoadFiles(paths ...string) (*Table, error) {
+	t := &Table{}
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		if err := t.load(bytes.NewReader(data)); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+	}
+	return t, nil
+}
+
+func (t *Table) load(r io.Reader) error {
+	dec := yaml.NewDecoder(r)
+	for {
+		var route HTTPRoute
+		err := dec.Decode(&route)
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if route.Kind == "HTTPRoute" {
+			t.Add(route)
+		}
+	}
+}
+
+// Match returns the rule that would serve a request without headers or
+// query parameters.
+func (t *Table) Match(method, host, path string) (*Result, bool) {
+	return t.MatchRequest(Request{Method: method, Host: host, Path: path})
+}
+
+// MatchRequest returns the rule that would serve req. Among all matching
+// rules the most specific wins: the most specific hostname, then an Exact
+// path over a prefix, the longest prefix, a method match, the most header
+// matches, and the most query parameter matches. Remaining ties keep the
+// earliest route and rule.
+func (t *Table) MatchRequest(req Request) (*Result, bool) {
+	var best *Result
+	var bestRank rank
+	for _, route := range t.routes {
+		host, ok := matchHost(route.Spec.Hostnames, req.Host)
+		if !ok {
+			continue
+		}
+		for i := range route.Spec.Rules {
+			rule := &route.Spec.Rules[i]
+			matches := rule.Matches
+			if len(matches) == 0 {
+				matches = []RouteMatch{{}}
+			}
+			for j, m := range matches {
+				r, ok := matchOne(m, req)
+				if !ok {
+					continue
+				}
+				r.host = host
+				if best == nil || r.better(bestRank) {
+					best = &Result{Route: route, RuleIndex: i, Rule: rule, MatchIndex: j}
+					bestRank = r
+				}
+			}
+		}
+	}
+	return best, best != nil
+}
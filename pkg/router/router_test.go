@@ -0,0 +1,268 @@
+package router_test
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/arencloud/csv2httproute/pkg/router"
+)
+
+// rule returns a rule forwarding matches to the Service backend.
+func rule(backend string, matches ...router.RouteMatch) router.Rule {
+	return router.Rule{Matches: matches, BackendRefs: []router.BackendRef{{Name: backend, Port: 80}}}
+}
+
+func path(typ, value string) *router.PathMatch {
+	return &router.PathMatch{Type: typ, Value: value}
+}
+
+func route(name string, hostnames []string, rules ...router.Rule) router.HTTPRoute {
+	return router.HTTPRoute{
+		APIVersion: "gateway.networking.k8s.io/v1",
+		Kind:       "HTTPRoute",
+		Metadata:   router.Metadata{Name: name, Namespace: "shop"},
+		Spec:       router.Spec{Hostnames: hostnames, Rules: rules},
+	}
+}
+
+func TestMatchPrecedence(t *testing.T) {
+	tests := []struct {
+		name   string
+		routes []router.HTTPRoute
+		req    router.Request
+		want   string
+	}{
+		{
+			name: "exact beats prefix",
+			routes: []router.HTTPRoute{route("r", nil,
+				rule("prefix", router.RouteMatch{Path: path("PathPrefix", "/orders")}),
+				rule("exact", router.RouteMatch{Path: path("Exact", "/orders")}),
+			)},
+			req:  router.Request{Method: "GET", Path: "/orders"},
+			want: "exact",
+		},
+		{
+			name: "exact only matches its path",
+			routes: []router.HTTPRoute{route("r", nil,
+				rule("prefix", router.RouteMatch{Path: path("PathPrefix", "/orders")}),
+				rule("exact", router.RouteMatch{Path: path("Exact", "/orders")}),
+			)},
+			req:  router.Request{Method: "GET", Path: "/orders/42"},
+			want: "prefix",
+		},
+		{
+			name: "longest prefix wins",
+			routes: []router.HTTPRoute{route("r", nil,
+				rule("short", router.RouteMatch{Path: path("PathPrefix", "/api")}),
+				rule("long", router.RouteMatch{Path: path("PathPrefix", "/api/orders")}),
+			)},
+			req:  router.Request{Method: "GET", Path: "/api/orders/42"},
+			want: "long",
+		},
+		{
+			name: "prefix matches whole segments",
+			routes: []router.HTTPRoute{route("r", nil,
+				rule("short", router.RouteMatch{Path: path("PathPrefix", "/api")}),
+				rule("long", router.RouteMatch{Path: path("PathPrefix", "/api/orders")}),
+			)},
+			req:  router.Request{Method: "GET", Path: "/api/ordersx"},
+			want: "short",
+		},
+		{
+			name: "method breaks a path tie",
+			routes: []router.HTTPRoute{route("r", nil,
+				rule("any", router.RouteMatch{Path: path("PathPrefix", "/orders")}),
+				rule("post", router.RouteMatch{Path: path("PathPrefix", "/orders"), Method: "POST"}),
+			)},
+			req:  router.Request{Method: "POST", Path: "/orders"},
+			want: "post",
+		},
+		{
+			name: "method must match",
+			routes: []router.HTTPRoute{route("r", nil,
+				rule("any", router.RouteMatch{Path: path("PathPrefix", "/orders")}),
+				rule("post", router.RouteMatch{Path: path("PathPrefix", "/orders"), Method: "POST"}),
+			)},
+			req:  router.Request{Method: "GET", Path: "/orders"},
+			want: "any",
+		},
+		{
+			name: "path beats method",
+			routes: []router.HTTPRoute{route("r", nil,
+				rule("get", router.RouteMatch{Path: path("PathPrefix", "/api"), Method: "GET"}),
+				rule("longer", router.RouteMatch{Path: path("PathPrefix", "/api/orders")}),
+			)},
+			req:  router.Request{Method: "GET", Path: "/api/orders"},
+			want: "longer",
+		},
+		{
+			name: "more headers win",
+			routes: []router.HTTPRoute{route("r", nil,
+				rule("one", router.RouteMatch{Path: path("PathPrefix", "/"), Headers: []router.HeaderMatch{{Name: "x-env", Value: "canary"}}}),
+				rule("two", router.RouteMatch{Path: path("PathPrefix", "/"), Headers: []router.HeaderMatch{{Name: "x-env", Value: "canary"}, {Name: "x-team", Value: "shop"}}}),
+			)},
+			req:  router.Request{Path: "/", Headers: http.Header{"X-Env": {"canary"}, "X-Team": {"shop"}}},
+			want: "two",
+		},
+		{
+			name: "method beats headers",
+			routes: []router.HTTPRoute{route("r", nil,
+				rule("header", router.RouteMatch{Path: path("PathPrefix", "/"), Headers: []router.HeaderMatch{{Name: "x-env", Value: "canary"}}}),
+				rule("method", router.RouteMatch{Path: path("PathPrefix", "/"), Method: "GET"}),
+			)},
+			req:  router.Request{Method: "GET", Path: "/", Headers: http.Header{"X-Env": {"canary"}}},
+			want: "method",
+		},
+		{
+			name: "regex header match",
+			routes: []router.HTTPRoute{route("r", nil,
+				rule("plain", router.RouteMatch{Path: path("PathPrefix", "/")}),
+				rule("regex", router.RouteMatch{Path: path("PathPrefix", "/"), Headers: []router.HeaderMatch{{Type: "RegularExpression", Name: "x-version", Value: "v[0-9]+"}}}),
+			)},
+			req:  router.Request{Path: "/", Headers: http.Header{"X-Version": {"v2"}}},
+			want: "regex",
+		},
+		{
+			name: "headers beat query parameters",
+			routes: []router.HTTPRoute{route("r", nil,
+				rule("query", router.RouteMatch{Path: path("PathPrefix", "/"), QueryParams: []router.QueryParamMatch{{Name: "debug", Value: "1"}}}),
+				rule("header", router.RouteMatch{Path: path("PathPrefix", "/"), Headers: []router.HeaderMatch{{Name: "x-env", Value: "canary"}}}),
+			)},
+			req:  router.Request{Path: "/", Headers: http.Header{"X-Env": {"canary"}}, Query: url.Values{"debug": {"1"}}},
+			want: "header",
+		},
+		{
+			name: "more query parameters win",
+			routes: []router.HTTPRoute{route("r", nil,
+				rule("none", router.RouteMatch{Path: path("PathPrefix", "/")}),
+				rule("query", router.RouteMatch{Path: path("PathPrefix", "/"), QueryParams: []router.QueryParamMatch{{Name: "debug", Value: "1"}}}),
+			)},
+			req:  router.Request{Path: "/", Query: url.Values{"debug": {"1"}}},
+			want: "query",
+		},
+		{
+			name: "query parameter must match",
+			routes: []router.HTTPRoute{route("r", nil,
+				rule("none", router.RouteMatch{Path: path("PathPrefix", "/")}),
+				rule("query", router.RouteMatch{Path: path("PathPrefix", "/"), QueryParams: []router.QueryParamMatch{{Name: "debug", Value: "1"}}}),
+			)},
+			req:  router.Request{Path: "/", Query: url.Values{"debug": {"0"}}},
+			want: "none",
+		},
+		{
+			name: "exact hostname beats wildcard",
+			routes: []router.HTTPRoute{
+				route("wildcard", []string{"*.example.com"}, rule("wildcard", router.RouteMatch{Path: path("Exact", "/orders")})),
+				route("exact", []string{"shop.example.com"}, rule("exact", router.RouteMatch{Path: path("PathPrefix", "/")})),
+			},
+			req:  router.Request{Host: "shop.example.com", Path: "/orders"},
+			want: "exact",
+		},
+		{
+			name: "wildcard hostname",
+			routes: []router.HTTPRoute{
+				route("other", []string{"admin.example.org"}, rule("other")),
+				route("wildcard", []string{"*.example.com"}, rule("wildcard")),
+			},
+			req:  router.Request{Host: "Shop.Example.com", Path: "/"},
+			want: "wildcard",
+		},
+		{
+			name: "hostname beats route without hostnames",
+			routes: []router.HTTPRoute{
+				route("any", nil, rule("any", router.RouteMatch{Path: path("Exact", "/orders")})),
+				route("host", []string{"shop.example.com"}, rule("host")),
+			},
+			req:  router.Request{Host: "shop.example.com", Path: "/orders"},
+			want: "host",
+		},
+		{
+			name: "regex ranks below prefix",
+			routes: []router.HTTPRoute{route("r", nil,
+				rule("regex", router.RouteMatch{Path: path("RegularExpression", "/orders/[0-9]+")}),
+				rule("prefix", router.RouteMatch{Path: path("PathPrefix", "/")}),
+			)},
+			req:  router.Request{Path: "/orders/42"},
+			want: "prefix",
+		},
+		{
+			name: "regex matches the whole path",
+			routes: []router.HTTPRoute{route("r", nil,
+				rule("regex", router.RouteMatch{Path: path("RegularExpression", "/orders/[0-9]+")}),
+				rule("other", router.RouteMatch{Path: path("Exact", "/other")}),
+			)},
+			req:  router.Request{Path: "/orders/42"},
+			want: "regex",
+		},
+		{
+			name: "ties keep the earliest rule",
+			routes: []router.HTTPRoute{route("r", nil,
+				rule("first", router.RouteMatch{Path: path("PathPrefix", "/orders")}),
+				rule("second", router.RouteMatch{Path: path("PathPrefix", "/orders")}),
+			)},
+			req:  router.Request{Path: "/orders"},
+			want: "first",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res, ok := router.New(tt.routes...).MatchRequest(tt.req)
+			if !ok {
+				t.Fatalf("no rule matched %+v", tt.req)
+			}
+			if got := res.Rule.BackendRefs[0].Name; got != tt.want {
+				t.Errorf("routed to %s (%s), want %s", got, res, tt.want)
+			}
+		})
+	}
+}
+
+func TestMatchMisses(t *testing.T) {
+	table := router.New(route("r", []string{"shop.example.com"},
+		rule("orders", router.RouteMatch{Path: path("PathPrefix", "/orders"), Method: "GET"}),
+	))
+	for _, req := range []router.Request{
+		{Method: "GET", Host: "admin.example.com", Path: "/orders"},
+		{Method: "POST", Host: "shop.example.com", Path: "/orders"},
+		{Method: "GET", Host: "shop.example.com", Path: "/users"},
+	} {
+		if res, ok := table.MatchRequest(req); ok {
+			t.Errorf("%+v routed to %s, want no match", req, res)
+		}
+	}
+}
+
+func TestLoad(t *testing.T) {
+	manifest := `apiVersion: gateway.networking.k8s.io/v1
+kind: HTTPRoute
+metadata:
+  name: orders
+  namespace: shop
+spec:
+  hostnames: [shop.example.com]
+  rules:
+    - matches:
+        - path: {type: Exact, value: /orders}
+      backendRefs:
+        - name: orders-svc
+          port: 8080
+---
+apiVersion: v1
+kind: Service
+metadata:
+  name: orders-svc
+`
+	table, err := router.Load(strings.NewReader(manifest))
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if n := len(table.Routes()); n != 1 {
+		t.Fatalf("loaded %d route(s), want the HTTPRoute only", n)
+	}
+	res, ok := table.Match("GET", "shop.example.com", "/orders")
+	if !ok || res.Rule.BackendRefs[0].Name != "orders-svc" || res.MatchIndex != 0 {
+		t.Errorf("GET /orders routed to %s", res)
+	}
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+)
+
+// portability is --portability: flag the constructs of the generated routes
+// whose behavior varies across Gateway API implementations.
+var portability bool
+
+// maxPortableWeight is the largest backend weight --portability accepts.
+// Implementations map weights onto ranges of their own, such as percentages,
+// so the split of larger ones can differ.
+const maxPortableWeight = 1000
+
+// Where Gateway API leaves a construct to the implementations, named in
+// the findings of --portability like the features of --feature-report.
+const (
+	implementationSpecific = "implementation-specific"
+	// Core conformance tests of the constructs whose edge cases vary.
+	conformanceHeaderMatching = "HTTPRouteHeaderMatching"
+	conformanceWeight         = "HTTPRouteWeight"
+)
+
+// portabilityFindings lists the constructs of route, generated from path,
+// that implementations handle differently: regular expression matches,
+// header names spelled in different cases, rewrites combined with redirects or
+// non-prefix matches, and large weights.
+func portabilityFindings(route HTTPRoute, path string) []finding {
+	var findings []finding
+	add := func(line int, feature, format string, args ...any) {
+		msg := fmt.Sprintf("route %s: %s (Gateway API: %s)", route.Metadata.Name, fmt.Sprintf(format, args...), feature)
+		findings = append(findings, finding{File: path, Line: line, Check: checkPortability, Message: msg})
+	}
+	var headers []string
+	headerLines := make(map[string]int)
+	for _, rule := range route.Spec.Rules {
+		line := ruleLine(rule)
+		prefixOnly := true
+		for _, m := range rule.Matches {
+			mLine := 0
+			if len(m.SourceLines) == 1 {
+				mLine = m.SourceLines[0]
+			}
+			if m.Path != nil && m.Path.Type == "RegularExpression" {
+				add(mLine, featurePathRegex, "regular expression path %q: the regex dialect and anchoring vary", m.Path.Value)
+			}
+			if m.Path != nil && m.Path.Type != "" && m.Path.Type != "PathPrefix" {
+				prefixOnly = false
+			}
+			for _, h := range m.Headers {
+				if h.Type == "RegularExpression" {
+					add(mLine, implementationSpecific, "regular expression match of header %s: the regex dialect and anchoring vary", h.Name)
+				}
+				if !slices.Contains(headers, h.Name) {
+					headers = append(headers, h.Name)
+					headerLines[h.Name] = mLine
+				}
+			}
+			for _, q := range m.QueryParams {
+				if q.Type == "RegularExpression" {
+					add(mLine, implementationSpecific, "regular expression match of query parameter %s: the regex dialect and anchoring vary", q.Name)
+				}
+			}
+		}
+
+		var rewrite, redirect bool
+		for _, f := range rule.Filters {
+			switch {
+			case f.URLRewrite != nil:
+				rewrite = true
+				if p := f.URLRewrite.Path; p != nil && p.Type == "ReplacePrefixMatch" && !prefixOnly {
+					add(line, featurePathRewrite, "ReplacePrefixMatch rewrite of a match other than PathPrefix: which prefix is replaced varies")
+				}
+			case f.RequestRedirect != nil:
+				redirect = true
+			}
+		}
+		if rewrite && redirect {
+			add(line, featurePathRewrite+", "+featurePathRedirect, "rule both rewrites and redirects; the CRD rejects it, and implementations accepting it differ in which applies")
+		}
+		if redirect && len(rule.BackendRefs) > 0 {
+			add(line, featurePathRedirect, "redirecting rule also has backends; whether they are still resolved and reported varies")
+		}
+		for _, b := range rule.BackendRefs {
+			if b.Weight > maxPortableWeight {
+				add(line, conformanceWeight, "backend %s weight %d: implementations map weights onto ranges of their own, such as percentages, so the split of weights above %d can differ", b.Name, b.Weight, maxPortableWeight)
+			}
+		}
+	}
+	// Header names are case-insensitive, but implementations that match
+	// them as written treat the spellings as different headers.
+	if a, b, ok := caseVariants(headers); ok {
+		add(headerLines[b], conformanceHeaderMatching, "header %s is also matched as %s; implementations differ in whether the spellings match the same header", a, b)
+	}
+	return findings
+}
+
+// ruleLine is the first CSV line behind rule, 0 for a rule from no row.
+func ruleLine(rule HTTPRouteRule) int {
+	line := 0
+	for _, m := range rule.Matches {
+		for _, l := range m.SourceLines {
+			if line == 0 || l < line {
+				line = l
+			}
+		}
+	}
+	return line
+}
+
+// caseVariants finds two of names that are equal but for case.
+func caseVariants(names []string) (string, string, bool) {
+	for i, a := range names {
+		for _, b := range names[i+1:] {
+			if a != b && strings.EqualFold(a, b) {
+				return a, b, true
+			}
+		}
+	}
+	return "", "", false
+}
+
+// lintPortability flags the constructs of route whose behavior varies
+// across implementations, with --portability. The validate report lists
+// them and --strict fails the file; otherwise they are warnings.
+func lintPortability(route HTTPRoute, path string) error {
+	if !portability {
+		return nil
+	}
+	findings := portabilityFindings(route, path)
+	if validationRun != nil || strictInputs {
+		return reportFindings(findings)
+	}
+	for _, f := range findings {
+		fmt.Fprintf(os.Stderr, "WARNING: %s\n", f)
+	}
+	return nil
+}
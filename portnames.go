@@ -0,0 +1,148 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/arencloud/csv2httproute/pkg/convert"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/dynamic"
+)
+
+// Services standardizing on named ports change their numbers without the
+// inventory noticing, so the port column may name a port instead. A
+// backendRef takes the number, which is looked up in the cluster with
+// --resolve-ports, or else in the ports table of the --config file.
+
+var (
+	// resolvePorts is --resolve-ports: look up the port names of the port
+	// column in the Services of the cluster.
+	resolvePorts bool
+	// portNames is the ports table of the --config file: the numbers of
+	// port names, by name or by service/name.
+	portNames map[string]int
+)
+
+// serviceClient and servicePorts cache the lookups of --resolve-ports
+// across files; a nil entry is a Service missing from the cluster.
+var (
+	serviceClient dynamic.Interface
+	servicePorts  = make(map[string]map[string]int)
+)
+
+// loadPortNames checks the ports table of the --config file.
+func loadPortNames(cfg map[string]int) error {
+	portNames = nil
+	for key, port := range cfg {
+		service, name, ok := strings.Cut(key, "/")
+		if !ok {
+			service, name = "", key
+		}
+		if (ok && service == "") || strings.Contains(name, "/") || !convert.IsPortName(name) {
+			return fmt.Errorf("config file: port %q must be a port name such as http, or service/name", key)
+		}
+		if port < 1 || port > 65535 {
+			return fmt.Errorf("config file: port %s: %d is not a port number (1-65535)", key, port)
+		}
+	}
+	portNames = cfg
+	return nil
+}
+
+// resolvePortNames replaces the port names of endpoints with the numbers of
+// the ports of their Services: from the cluster with --resolve-ports, for
+// Services it has, otherwise from the ports table of the --config file,
+// where service/name wins over name.
+func resolvePortNames(ctx context.Context, endpoints []Endpoint) ([]Endpoint, error) {
+	for i, e := range endpoints {
+		if e.PortName == "" {
+			continue
+		}
+		service := flagOr(e.Service, serviceName)
+		ns := flagOr(e.ServiceNamespace, flagOr(serviceNamespace, flagOr(e.Namespace, namespace)))
+		if resolvePorts {
+			ports, err := clusterServicePorts(ctx, ns, service)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", e.Line, err)
+			}
+			if ports != nil {
+				port, ok := ports[e.PortName]
+				if !ok {
+					return nil, fmt.Errorf("line %d: Service %s/%s has no port named %q (ports: %s)", e.Line, ns, service, e.PortName, formatPortNames(ports))
+				}
+				endpoints[i].Port = port
+				continue
+			}
+		}
+		port, ok := portNames[service+"/"+e.PortName]
+		if !ok {
+			port, ok = portNames[e.PortName]
+		}
+		if !ok {
+			return nil, fmt.Errorf("line %d: port %q of service %s is not a number; add it to the ports of --config, or look it up with --resolve-ports", e.Line, e.PortName, service)
+		}
+		endpoints[i].Port = port
+	}
+	return endpoints, nil
+}
+
+// clusterServicePorts returns the numbers of the named ports of the Service
+// namespace/name, or nil when the cluster has no such Service.
+func clusterServicePorts(ctx context.Context, namespace, name string) (map[string]int, error) {
+	key := namespace + "/" + name
+	if ports, ok := servicePorts[key]; ok {
+		return ports, nil
+	}
+	if serviceClient == nil {
+		client, _, err := kubeDynamicClient()
+		if err != nil {
+			return nil, err
+		}
+		serviceClient = client
+	}
+	var obj *unstructured.Unstructured
+	err := retryCluster(ctx, "Service "+key, 10*time.Second, func(ctx context.Context) error {
+		var err error
+		obj, err = serviceClient.Resource(servicesGVR).Namespace(namespace).Get(ctx, name, metav1.GetOptions{})
+		return err
+	})
+	if apierrors.IsNotFound(err) {
+		servicePorts[key] = nil
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get Service %s: %w", key, err)
+	}
+	ports := make(map[string]int)
+	items, _, _ := unstructured.NestedSlice(obj.Object, "spec", "ports")
+	for _, item := range items {
+		p, ok := item.(map[string]any)
+		if !ok {
+			continue
+		}
+		name, _ := p["name"].(string)
+		if port, ok := p["port"].(int64); ok && name != "" {
+			ports[name] = int(port)
+		}
+	}
+	servicePorts[key] = ports
+	return ports, nil
+}
+
+// formatPortNames lists ports as name=number, sorted by name.
+func formatPortNames(ports map[string]int) string {
+	names := make([]string, 0, len(ports))
+	for name, port := range ports {
+		names = append(names, fmt.Sprintf("%s=%d", name, port))
+	}
+	if len(names) == 0 {
+		return "none named"
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
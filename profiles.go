@@ -0,0 +1,205 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// profile is a named option set from the --config file, bundling the
+// settings that otherwise differ per CSV on the command line.
+type profile struct {
+	Gateway          string            `yaml:"gateway,omitempty"`
+	GatewayNamespace string            `yaml:"gatewayNamespace,omitempty"`
+	Hostname         string            `yaml:"hostname,omitempty"`
+	Namespace        string            `yaml:"namespace,omitempty"`
+	Labels           map[string]string `yaml:"labels,omitempty"`
+	RequestHeaders   map[string]string `yaml:"requestHeaders,omitempty"`
+	ResponseHeaders  map[string]string `yaml:"responseHeaders,omitempty"`
+}
+
+// configFileLayout is the --config file layout.
+type configFileLayout struct {
+	Profiles map[string]profile    `yaml:"profiles"`
+	Tiers    map[string]tierPolicy `yaml:"tiers"`
+	Ports    map[string]int        `yaml:"ports"`
+	Defaults csvSettings           `yaml:"defaults"`
+	Files    yaml.Node             `yaml:"files"`
+}
+
+var (
+	configFile     string
+	defaultProfile string
+	profiles       map[string]profile
+)
+
+func loadConfigFile(ctx context.Context, path string) error {
+	profiles, tiers, portNames = nil, nil, nil
+	configDefaults, fileOverrides = csvSettings{}, nil
+	if path == "" {
+		if defaultProfile != "" {
+			return fmt.Errorf("--profile requires --config")
+		}
+		return nil
+	}
+	data, err := readInput(ctx, path)
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %w", err)
+	}
+	var cfg configFileLayout
+	if err := yaml.Unmarshal(data, &cfg); err != nil {
+		return fmt.Errorf("failed to parse config file %s: %w", path, err)
+	}
+	for name := range cfg.Profiles {
+		if slug := ownerSlug(name); slug != name {
+			return fmt.Errorf("config file: profile name %q must be lower-case letters, digits and dashes", name)
+		}
+	}
+	profiles = cfg.Profiles
+	if err := loadTiers(cfg.Tiers); err != nil {
+		return err
+	}
+	if err := loadPortNames(cfg.Ports); err != nil {
+		return err
+	}
+	if err := loadCSVSettings(cfg.Defaults, cfg.Files); err != nil {
+		return err
+	}
+	if defaultProfile != "" {
+		if _, ok := profiles[defaultProfile]; !ok {
+			return fmt.Errorf("unknown --profile %q", defaultProfile)
+		}
+	}
+	return nil
+}
+
+// profileGroup is the endpoints using one profile, in first-appearance
+// order. Name is empty when no profile applies.
+type profileGroup struct {
+	Name      string
+	Profile   *profile
+	Endpoints []Endpoint
+}
+
+// partitionByProfile splits endpoints by their profile column, falling back
+// to --profile.
+func partitionByProfile(endpoints []Endpoint) ([]profileGroup, error) {
+	var groups []profileGroup
+	index := make(map[string]int)
+	for _, e := range endpoints {
+		name := e.Profile
+		if name == "" {
+			name = defaultProfile
+		}
+		i, ok := index[name]
+		if !ok {
+			g := profileGroup{Name: name}
+			if name != "" {
+				p, found := profiles[name]
+				if !found {
+					return nil, fmt.Errorf("line %d: unknown profile %q", e.Line, name)
+				}
+				g.Profile = &p
+			}
+			i = len(groups)
+			index[name] = i
+			groups = append(groups, g)
+		}
+		groups[i].Endpoints = append(groups[i].Endpoints, e)
+	}
+	return groups, nil
+}
+
+// target returns the route target of group under the profile. Domain map and
+// directive targets other than a namespace win over the profile's hostname
+// and gateway; unset fields fall back to the flags. A gateway without a
+// namespace is looked up in the namespace of the routes, as it would be in
+// --namespace.
+func (p *profile) target(group domainGroup) routeTarget {
+	t := group.Target
+	if group.Domain == nil || group.Domain.namespaceOnly {
+		if p.Hostname != "" {
+			t.Hostname = p.Hostname
+		}
+		if p.Gateway != "" {
+			t.Gateway, t.GatewayNamespace = p.Gateway, ""
+		}
+		if p.GatewayNamespace != "" {
+			t.GatewayNamespace = p.GatewayNamespace
+		}
+	}
+	// The namespace of the rows wins over that of the profile.
+	if t.Namespace == "" {
+		t.Namespace = p.Namespace
+	}
+	if t.GatewayNamespace == "" && p.Namespace != "" {
+		t.GatewayNamespace = t.Namespace
+	}
+	return t
+}
+
+// apply sets the labels of the profile on route and adds its headers to
+// every rule, merging them into header filters the rule already has since a
+// filter type may appear only once per rule.
+func (p *profile) apply(route *HTTPRoute) {
+	if len(p.Labels) > 0 {
+		if route.Metadata.Labels == nil {
+			route.Metadata.Labels = make(map[string]string)
+		}
+		for k, v := range p.Labels {
+			route.Metadata.Labels[k] = v
+		}
+	}
+	for i := range route.Spec.Rules {
+		rule := &route.Spec.Rules[i]
+		addHeaders(rule, "RequestHeaderModifier", p.RequestHeaders)
+		addHeaders(rule, "ResponseHeaderModifier", p.ResponseHeaders)
+	}
+}
+
+// addHeaders sets headers with a filter of type kind on rule.
+func addHeaders(rule *HTTPRouteRule, kind string, headers map[string]string) {
+	if len(headers) == 0 {
+		return
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var filter *HTTPHeaderFilter
+	for i := range rule.Filters {
+		if rule.Filters[i].Type != kind {
+			continue
+		}
+		if kind == "RequestHeaderModifier" {
+			filter = rule.Filters[i].RequestHeaderModifier
+		} else {
+			filter = rule.Filters[i].ResponseHeaderModifier
+		}
+	}
+	if filter == nil {
+		filter = &HTTPHeaderFilter{}
+		f := HTTPRouteFilter{Type: kind}
+		if kind == "RequestHeaderModifier" {
+			f.RequestHeaderModifier = filter
+		} else {
+			f.ResponseHeaderModifier = filter
+		}
+		rule.Filters = append(rule.Filters, f)
+	}
+	for _, name := range names {
+		// Headers from the CSV win over the profile.
+		set := false
+		for _, h := range filter.Set {
+			set = set || strings.EqualFold(h.Name, name)
+		}
+		if !set {
+			filter.Set = append(filter.Set, HTTPHeader{Name: name, Value: headers[name]})
+		}
+	}
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/arencloud/csv2httproute/pkg/convert"
+)
+
+// Backend protocols accepted in the backend_protocol column. Gateway API
+// has no per-rule protocol field: TLS to the backend is configured with a
+// BackendTLSPolicy, and cleartext HTTP/2 and WebSocket with the appProtocol
+// of the Service port.
+const (
+	protocolHTTP  = convert.ProtocolHTTP
+	protocolH2C   = convert.ProtocolH2C
+	protocolHTTPS = convert.ProtocolHTTPS
+	protocolWS    = convert.ProtocolWS
+)
+
+// appProtocols maps protocols to the Service port appProtocol that selects them.
+var appProtocols = map[string]string{
+	protocolH2C: "kubernetes.io/h2c",
+	protocolWS:  "kubernetes.io/ws",
+}
+
+func protocolName(p string) string {
+	if p == "" {
+		return protocolHTTP
+	}
+	return p
+}
+
+// backendKey identifies a backend port independently of its weight.
+type backendKey struct {
+	Namespace string
+	Name      string
+	Port      int
+}
+
+// backendProtocols returns the non-default protocol of every backend used by
+// endpoints. All rows routing to one backend port must agree on its protocol.
+func backendProtocols(route HTTPRoute, endpoints []Endpoint) (map[backendKey]string, error) {
+	protocols := make(map[backendKey]string)
+	lines := make(map[backendKey]int)
+	for _, e := range endpoints {
+		for _, b := range backendsFor(e) {
+			ns := b.Namespace
+			if ns == "" {
+				ns = route.Metadata.Namespace
+			}
+			key := backendKey{Namespace: ns, Name: b.Name, Port: b.Port}
+			p := e.BackendProtocol
+			if p == protocolHTTP {
+				p = ""
+			}
+			if prev, ok := lines[key]; ok {
+				if protocols[key] != p {
+					return nil, fmt.Errorf("backend %s:%d has conflicting protocols %s (line %d) and %s (line %d)",
+						b.Name, b.Port, protocolName(protocols[key]), prev, protocolName(p), e.Line)
+				}
+				continue
+			}
+			if p != "" && b.Kind != "Service" {
+				return nil, fmt.Errorf("line %d: backend_protocol requires a Service backend, not %s", e.Line, b.Kind)
+			}
+			lines[key], protocols[key] = e.Line, p
+		}
+	}
+	for key, p := range protocols {
+		if p == "" {
+			delete(protocols, key)
+		}
+	}
+	return protocols, nil
+}
+
+// writeBackendHints writes the companion manifests for backends with a
+// protocol: <route>.backendtls.yaml with a BackendTLSPolicy per https backend
+// (validated against the system CAs and the Service DNS name), and
+// <route>.appprotocol-patch.yaml with strategic-merge patches setting the
+// appProtocol of h2c and ws Service ports. Services are not generated here,
+// so the patches are meant for kustomize or kubectl patch.
+func writeBackendHints(route HTTPRoute, endpoints []Endpoint) error {
+	protocols, err := backendProtocols(route, endpoints)
+	if err != nil || len(protocols) == 0 {
+		return err
+	}
+	keys := make([]backendKey, 0, len(protocols))
+	for key := range protocols {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		a, b := keys[i], keys[j]
+		if a.Namespace != b.Namespace {
+			return a.Namespace < b.Namespace
+		}
+		if a.Name != b.Name {
+			return a.Name < b.Name
+		}
+		return a.Port < b.Port
+	})
+
+	// A BackendTLSPolicy applies to the whole Service, so https ports of
+	// one Service share a policy.
+	var policies, patches []any
+	var policyVersion string
+	tlsServices := make(map[string]bool)
+	for _, key := range keys {
+		p := protocols[key]
+		if p == protocolHTTPS {
+			if tlsServices[key.Namespace+"/"+key.Name] {
+				continue
+			}
+			tlsServices[key.Namespace+"/"+key.Name] = true
+			if policyVersion == "" {
+				if policyVersion, err = backendTLSPolicyVersion(); err != nil {
+					return fmt.Errorf("route %s: %w", route.Metadata.Name, err)
+				}
+			}
+			policies = append(policies, map[string]any{
+				"apiVersion": policyVersion,
+				"kind":       "BackendTLSPolicy",
+				"metadata":   Metadata{Name: key.Name, Namespace: key.Namespace},
+				"spec": map[string]any{
+					"targetRefs": []map[string]any{{"group": "", "kind": "Service", "name": key.Name}},
+					"validation": map[string]any{
+						"hostname":                fmt.Sprintf("%s.%s.svc", key.Name, key.Namespace),
+						"wellKnownCACertificates": "System",
+					},
+				},
+			})
+			continue
+		}
+		patches = append(patches, map[string]any{
+			"apiVersion": "v1",
+			"kind":       "Service",
+			"metadata":   Metadata{Name: key.Name, Namespace: key.Namespace},
+			"spec": map[string]any{
+				"ports": []map[string]any{{"port": key.Port, "appProtocol": appProtocols[p]}},
+			},
+		})
+	}
+	if err := writeYAMLDocs(outputPath(route.Metadata.Name, ".backendtls.yaml"), policies); err != nil {
+		return err
+	}
+	return writeYAMLDocs(outputPath(route.Metadata.Name, ".appprotocol-patch.yaml"), patches)
+}
+
+// backendTLSPolicyVersion returns the apiVersion of BackendTLSPolicy in the
+// --gateway-api-version release: v1 in the standard channel since v1.4, and
+// before that v1alpha3, which is in the experimental channel only.
+func backendTLSPolicyVersion() (string, error) {
+	switch {
+	case gatewayAPIAtLeast(1, 4):
+		return "gateway.networking.k8s.io/v1", nil
+	case !gatewayAPIAtLeast(1, 1):
+		return "", fmt.Errorf("https backends need BackendTLSPolicy v1alpha3, which Gateway API %s does not have; target v1.1 or later with --gateway-api-version", gatewayAPIVersion)
+	case gatewayChannel != channelExperimental:
+		return "", fmt.Errorf("https backends need BackendTLSPolicy, which is in the experimental channel of Gateway API %s; pass --channel %s", gatewayAPIVersion, channelExperimental)
+	}
+	return "gateway.networking.k8s.io/v1alpha3", nil
+}
+
+// isPatchFile reports whether path holds patches of objects the run does not
+// generate, such as <route>.appprotocol-patch.yaml, rather than objects.
+func isPatchFile(path string) bool {
+	return strings.HasSuffix(path, "-patch.yaml")
+}
+
+// writeYAMLDocs writes docs as a multi-document YAML file, or nothing when
+// there are none.
+func writeYAMLDocs(path string, docs []any) error {
+	if len(docs) == 0 {
+		return nil
+	}
+	var buf bytes.Buffer
+	encoder := newYAMLEncoder(&buf)
+	for _, doc := range docs {
+		if err := encoder.Encode(doc); err != nil {
+			return err
+		}
+	}
+	if err := encoder.Close(); err != nil {
+		return err
+	}
+	return writeOutputFile(path, buf.Bytes())
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// prune is --prune: delete the generated files of the output directory
+// whose source no longer produces them.
+var prune bool
+
+// sourceLine matches the Source line of a header comment.
+var sourceLine = regexp.MustCompile(`(?m)^# Source: (.+) \(sha256:[0-9a-f]+\)$`)
+
+func validatePrune() error {
+	if prune && outputDir == streamOutput {
+		return fmt.Errorf("--prune needs an output directory, not --output -")
+	}
+	return nil
+}
+
+// pruneOutputs deletes the files of the output directory that carry the
+// generated header of a source that is gone, or of one of the run's inputs
+// files that the run did not write again, such as a route whose rows were
+// all removed. Files without a header, or generated from sources that
+// still exist and were not part of the run, are left alone, as are the
+// outputs of remote sources and stdin. Their signatures go with them.
+func pruneOutputs(inputs []string) error {
+	written := make(map[string]bool)
+	for _, path := range writtenFiles {
+		written[filepath.Clean(path)] = true
+	}
+	var stale []string
+	err := filepath.WalkDir(outputDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if strings.HasPrefix(d.Name(), ".") && path != outputDir {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if d.IsDir() || written[filepath.Clean(path)] || isSignatureFile(path) {
+			return nil
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		if !strings.Contains(string(data), generatedMarker) {
+			return nil
+		}
+		m := sourceLine.FindStringSubmatch(string(data))
+		if m != nil && sourceGone(m[1], inputs) {
+			stale = append(stale, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for _, path := range stale {
+		if err := os.Remove(path); err != nil {
+			return err
+		}
+		if !quiet {
+			fmt.Printf("Removed %s\n", path)
+		}
+		for _, ext := range []string{cosignBundleExt, gpgSignatureExt} {
+			if err := os.Remove(path + ext); err != nil && !errors.Is(err, fs.ErrNotExist) {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// sourceGone reports whether the outputs of source, as a Source line names
+// it, are no longer produced: it is one of the run's inputs, or a local file
+// that does not exist anymore.
+func sourceGone(source string, inputs []string) bool {
+	if slices.ContainsFunc(inputs, func(in string) bool { return filepath.ToSlash(in) == source }) {
+		return true
+	}
+	if sourceScheme(source) != "" || !strings.ContainsAny(source, "/") && strings.HasPrefix(source, "stdin.") {
+		return false
+	}
+	_, err := os.Stat(filepath.FromSlash(source))
+	return errors.Is(err, fs.ErrNotExist)
+}
+
+// pruneRun runs pruneOutputs for --prune once all inputs of the run were
+// converted; a run with failed files leaves the output directory alone.
+func pruneRun(inputs []string) error {
+	if !prune || runMetrics.failedFiles > 0 {
+		return nil
+	}
+	if err := pruneOutputs(inputs); err != nil {
+		return fmt.Errorf("failed to prune outputs: %w", err)
+	}
+	return nil
+}
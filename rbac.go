@@ -0,0 +1,129 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// rbacServiceAccount is the --rbac-service-account to grant access to the
+// generated routes, as [namespace/]name.
+var rbacServiceAccount string
+
+// rbacRoutes collects the generated route names per namespace during a run.
+var rbacRoutes = make(map[string][]string)
+
+type rbacObject struct {
+	APIVersion string       `yaml:"apiVersion"`
+	Kind       string       `yaml:"kind"`
+	Metadata   Metadata     `yaml:"metadata"`
+	Rules      []rbacRule   `yaml:"rules,omitempty"`
+	RoleRef    *rbacRoleRef `yaml:"roleRef,omitempty"`
+	Subjects   []rbacRef    `yaml:"subjects,omitempty"`
+}
+
+type rbacRule struct {
+	APIGroups     []string `yaml:"apiGroups"`
+	Resources     []string `yaml:"resources"`
+	ResourceNames []string `yaml:"resourceNames,omitempty"`
+	Verbs         []string `yaml:"verbs"`
+}
+
+type rbacRoleRef struct {
+	APIGroup string `yaml:"apiGroup"`
+	Kind     string `yaml:"kind"`
+	Name     string `yaml:"name"`
+}
+
+type rbacRef struct {
+	Kind      string `yaml:"kind"`
+	Name      string `yaml:"name"`
+	Namespace string `yaml:"namespace"`
+}
+
+// parseServiceAccount splits [namespace/]name, defaulting to --namespace.
+func parseServiceAccount(spec string) (ns, name string, err error) {
+	ns, name, ok := strings.Cut(spec, "/")
+	if !ok {
+		ns, name = namespace, spec
+	}
+	if ns == "" || name == "" || strings.Contains(name, "/") {
+		return "", "", fmt.Errorf("invalid --rbac-service-account %q: want [namespace/]name", spec)
+	}
+	return ns, name, nil
+}
+
+func collectRBACRoute(route HTTPRoute) {
+	ns := route.Metadata.Namespace
+	rbacRoutes[ns] = append(rbacRoutes[ns], route.Metadata.Name)
+}
+
+// writeRBAC writes a Role and RoleBinding per namespace that let the service
+// account manage only the generated HTTPRoutes. Kubernetes cannot restrict
+// create by name, so create is granted on httproutes as a whole; every other
+// verb is limited to the generated names.
+func writeRBAC() error {
+	if len(rbacRoutes) == 0 {
+		return nil
+	}
+	saNamespace, saName, err := parseServiceAccount(rbacServiceAccount)
+	if err != nil {
+		return err
+	}
+	name := "csv2httproute-" + saName
+
+	namespaces := make([]string, 0, len(rbacRoutes))
+	for ns := range rbacRoutes {
+		namespaces = append(namespaces, ns)
+	}
+	sort.Strings(namespaces)
+
+	var buf bytes.Buffer
+	encoder := newYAMLEncoder(&buf)
+	for _, ns := range namespaces {
+		routes := append([]string(nil), rbacRoutes[ns]...)
+		sort.Strings(routes)
+		role := rbacObject{
+			APIVersion: "rbac.authorization.k8s.io/v1",
+			Kind:       "Role",
+			Metadata:   Metadata{Name: name, Namespace: ns},
+			Rules: []rbacRule{
+				{
+					APIGroups: []string{"gateway.networking.k8s.io"},
+					Resources: []string{"httproutes"},
+					Verbs:     []string{"create"},
+				},
+				{
+					APIGroups:     []string{"gateway.networking.k8s.io"},
+					Resources:     []string{"httproutes"},
+					ResourceNames: routes,
+					Verbs:         []string{"get", "update", "patch", "delete"},
+				},
+			},
+		}
+		binding := rbacObject{
+			APIVersion: "rbac.authorization.k8s.io/v1",
+			Kind:       "RoleBinding",
+			Metadata:   Metadata{Name: name, Namespace: ns},
+			RoleRef:    &rbacRoleRef{APIGroup: "rbac.authorization.k8s.io", Kind: "Role", Name: name},
+			Subjects:   []rbacRef{{Kind: "ServiceAccount", Name: saName, Namespace: saNamespace}},
+		}
+		for _, obj := range []rbacObject{role, binding} {
+			if err := encoder.Encode(obj); err != nil {
+				return err
+			}
+		}
+	}
+	if err := encoder.Close(); err != nil {
+		return err
+	}
+	outPath := outputPath("rbac", ".yaml")
+	if err := writeOutputFile(outPath, buf.Bytes()); err != nil {
+		return err
+	}
+	if !quiet {
+		fmt.Printf("Generated %s\n", outPath)
+	}
+	return nil
+}
@@ -0,0 +1,248 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/arencloud/csv2httproute/pkg/convert"
+	"github.com/spf13/cobra"
+)
+
+var (
+	refactorFrom      string
+	refactorTo        string
+	refactorDryRun    bool
+	refactorRedirects bool
+	redirectStatus    int
+)
+
+func newRefactorCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "refactor --from PREFIX --to PREFIX",
+		Short: "Move endpoints from one path prefix to another in the CSV inventory",
+		Long: `Rewrites the URL and Prefix columns (and "#!" prefix directives) of every CSV
+under --input, replacing the path prefix --from with --to on segment
+boundaries, so /api/v1/users becomes /api/v2/users but /api/v10 is kept.
+
+With --redirects an HTTPRoute redirecting the old prefix to the new one is
+written to --output, to keep old clients working during the migration.`,
+		Args: cobra.NoArgs,
+		RunE: runRefactor,
+	}
+	flags := cmd.Flags()
+	flags.StringVarP(&inputDir, "input", "i", "facts/endpoints", "Directory or CSV file to rewrite")
+	flags.StringVar(&refactorFrom, "from", "", "Path prefix to move away from")
+	flags.StringVar(&refactorTo, "to", "", "Path prefix to move to")
+	flags.BoolVar(&refactorDryRun, "dry-run", false, "Print a diff of the changes instead of rewriting the files")
+	flags.BoolVar(&refactorRedirects, "redirects", false, "Also write an HTTPRoute redirecting --from to --to")
+	flags.IntVar(&redirectStatus, "redirect-status", 301, "Status code of the transitional redirects (301 or 302)")
+	flags.StringVarP(&outputDir, "output", "o", "generated", "Output directory for the redirect route")
+	flags.StringVarP(&gatewayName, "gateway", "g", "my-gateway", "Parent gateway of the redirect route")
+	flags.StringVar(&gatewayNamespace, "gateway-namespace", "", "Namespace for the parent gateway (defaults to --namespace)")
+	flags.StringVarP(&namespace, "namespace", "n", "default", "Namespace for the redirect route")
+	flags.StringVar(&hostname, "hostname", "", "Hostname of the redirect route")
+	_ = cmd.MarkFlagRequired("from")
+	_ = cmd.MarkFlagRequired("to")
+	return cmd
+}
+
+func runRefactor(cmd *cobra.Command, args []string) error {
+	from, to := cleanPrefix(refactorFrom), cleanPrefix(refactorTo)
+	if !strings.HasPrefix(from, "/") || !strings.HasPrefix(to, "/") {
+		return fmt.Errorf("--from and --to must start with /")
+	}
+	if from == to {
+		return fmt.Errorf("--from and --to are the same prefix")
+	}
+	if redirectStatus != 301 && redirectStatus != 302 {
+		return fmt.Errorf("invalid --redirect-status %d (must be 301 or 302)", redirectStatus)
+	}
+	if sourceScheme(inputDir) != "" {
+		return fmt.Errorf("refactor rewrites files in place and needs a local --input")
+	}
+	files, _, err := inputFiles(cmd.Context())
+	if err != nil {
+		return err
+	}
+	total := 0
+	for _, path := range files {
+		n, err := refactorFile(path, from, to)
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		total += n
+	}
+	if total == 0 {
+		return fmt.Errorf("no URL or Prefix under %s found", from)
+	}
+	if refactorRedirects && !refactorDryRun {
+		return writeRedirectRoute(from, to)
+	}
+	return nil
+}
+
+// cleanPrefix drops a trailing slash so prefixes compare on segments.
+func cleanPrefix(p string) string {
+	if len(p) > 1 {
+		p = strings.TrimRight(p, "/")
+	}
+	return p
+}
+
+// movePrefix returns path with from replaced by to, if path lies under from.
+func movePrefix(path, from, to string) (string, bool) {
+	if !hasPathPrefix(path, from) {
+		return path, false
+	}
+	rest := path[len(from):]
+	if to == "/" && strings.HasPrefix(rest, "/") {
+		return rest, true
+	}
+	return to + rest, true
+}
+
+// refactorFile rewrites path in place and returns the number of changed
+// cells. Encrypted inventories are refused like in schema migrate.
+func refactorFile(path, from, to string) (int, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	if isEncrypted(data) {
+		return 0, fmt.Errorf("encrypted inventories cannot be refactored in place; decrypt, refactor and re-encrypt it")
+	}
+	reader := csv.NewReader(bytes.NewReader(data))
+	reader.FieldsPerRecord = -1
+	reader.LazyQuotes = true
+	// Rows are re-encoded only when they change; all other lines, including
+	// comments and blank lines, are copied verbatim.
+	var records [][]string
+	var starts []int
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return 0, err
+		}
+		line, _ := reader.FieldPos(0)
+		records = append(records, record)
+		starts = append(starts, line-1)
+	}
+	lines := strings.SplitAfter(string(data), "\n")
+
+	changed := 0
+	var columns []int
+	header := false
+	var buf bytes.Buffer
+	for i, record := range records {
+		before := changed
+		switch {
+		case isDirectiveRow(record):
+			for j, field := range record {
+				words := strings.Fields(field)
+				moved := false
+				for k, w := range words {
+					key, value, ok := strings.Cut(w, "=")
+					if !ok || convert.CanonicalColumn(strings.TrimPrefix(key, "#!")) != "prefix" {
+						continue
+					}
+					if v, ok := movePrefix(value, from, to); ok {
+						words[k] = key + "=" + v
+						moved = true
+						changed++
+					}
+				}
+				if moved {
+					record[j] = strings.Join(words, " ")
+				}
+			}
+		case len(record) == 0 || strings.HasPrefix(strings.TrimSpace(record[0]), "#"):
+		case !header:
+			header = true
+			for j, h := range record {
+				if c := convert.CanonicalColumn(h); c == "url" || c == "prefix" {
+					columns = append(columns, j)
+				}
+			}
+		default:
+			for _, j := range columns {
+				if j >= len(record) {
+					continue
+				}
+				if moved, ok := movePrefix(strings.TrimSpace(record[j]), from, to); ok {
+					record[j] = moved
+					changed++
+				}
+			}
+		}
+		end := len(lines)
+		if i+1 < len(starts) {
+			end = starts[i+1]
+		}
+		if changed == before {
+			buf.WriteString(strings.Join(lines[starts[i]:end], ""))
+			continue
+		}
+		writer := csv.NewWriter(&buf)
+		if err := writer.Write(record); err != nil {
+			return 0, err
+		}
+		writer.Flush()
+		// Keep blank lines that followed the original row.
+		for _, l := range lines[starts[i]:end] {
+			if strings.TrimSpace(l) == "" {
+				buf.WriteString(l)
+			}
+		}
+	}
+	if changed == 0 {
+		return 0, nil
+	}
+	if refactorDryRun {
+		fmt.Print(colorDiff(unifiedDiff(path, path, string(data), buf.String())))
+		return changed, nil
+	}
+	if err := os.WriteFile(path, buf.Bytes(), 0666); err != nil {
+		return 0, err
+	}
+	fmt.Printf("Rewrote %s (%d value(s) moved to %s)\n", path, changed, to)
+	return changed, nil
+}
+
+// writeRedirectRoute writes redirect-<from>.yaml, redirecting everything
+// under from to the same path under to.
+func writeRedirectRoute(from, to string) error {
+	if err := ensureOutputDir(outputDir); err != nil {
+		return fmt.Errorf("failed to create output directory: %w", err)
+	}
+	name := "redirect"
+	if slug := strings.Trim(nonSlugChars.ReplaceAllString(strings.ToLower(from), "-"), "-"); slug != "" {
+		name += "-" + slug
+	}
+	route, err := buildRoute(name, defaultTarget(), nil)
+	if err != nil {
+		return err
+	}
+	route.Spec.Rules = []HTTPRouteRule{{
+		Matches: []HTTPRouteMatch{{Path: &HTTPPathMatch{Type: "PathPrefix", Value: from}}},
+		Filters: []HTTPRouteFilter{{
+			Type: "RequestRedirect",
+			RequestRedirect: &HTTPRequestRedirectFilter{
+				Path:       &PathRewrite{Type: "ReplacePrefixMatch", ReplacePrefixMatch: to},
+				StatusCode: redirectStatus,
+			},
+		}},
+	}}
+	path := outputPath(name, ".yaml")
+	if err := writeYAMLDocs(path, []any{route}); err != nil {
+		return err
+	}
+	fmt.Printf("Generated %s\n", path)
+	return nil
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Gateway API only lets a route reference a backend in another namespace
+// when a ReferenceGrant in the backend's namespace allows it, so the grants
+// the generated routes need are written with them.
+
+// noReferenceGrants is --no-reference-grants: leave the ReferenceGrants of
+// cross-namespace backends to be managed elsewhere.
+var noReferenceGrants bool
+
+// grantKey identifies a ReferenceGrant: the namespace of the backends it
+// opens up and the namespace of the routes it lets in.
+type grantKey struct {
+	Namespace, From string
+}
+
+// grantTarget is a backend a ReferenceGrant allows referencing.
+type grantTarget struct {
+	Group, Kind, Name string
+}
+
+// referenceGrants collects the backends each grant allows during a run.
+// Routes sharing a namespace share their grants.
+var referenceGrants = make(map[grantKey]map[grantTarget]bool)
+
+// collectReferenceGrants records the backends of route outside its
+// namespace, whether traffic is sent or mirrored to them. The interceptor of
+// scale-to-zero rows is granted with the KEDA manifests.
+func collectReferenceGrants(route HTTPRoute) {
+	from := route.Metadata.Namespace
+	add := func(b BackendRef) {
+		if b.Namespace == "" || b.Namespace == from || (b.Name == interceptorTarget.Name && b.Namespace == interceptorTarget.Namespace) {
+			return
+		}
+		key := grantKey{Namespace: b.Namespace, From: from}
+		if referenceGrants[key] == nil {
+			referenceGrants[key] = make(map[grantTarget]bool)
+		}
+		kind := b.Kind
+		if kind == "" {
+			kind = "Service"
+		}
+		referenceGrants[key][grantTarget{Group: b.Group, Kind: kind, Name: b.Name}] = true
+	}
+	for _, rule := range route.Spec.Rules {
+		for _, b := range rule.BackendRefs {
+			add(b)
+		}
+		for _, f := range rule.Filters {
+			if f.RequestMirror != nil {
+				add(f.RequestMirror.BackendRef)
+			}
+		}
+	}
+}
+
+// writeReferenceGrants writes referencegrants.yaml with a ReferenceGrant per
+// backend namespace and route namespace, each allowing HTTPRoutes of the
+// route namespace to reference just the backends they use.
+func writeReferenceGrants() error {
+	keys := make([]grantKey, 0, len(referenceGrants))
+	for key := range referenceGrants {
+		keys = append(keys, key)
+	}
+	if len(keys) == 0 {
+		return nil
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].Namespace != keys[j].Namespace {
+			return keys[i].Namespace < keys[j].Namespace
+		}
+		return keys[i].From < keys[j].From
+	})
+
+	docs := make([]any, 0, len(keys))
+	for _, key := range keys {
+		targets := make([]grantTarget, 0, len(referenceGrants[key]))
+		for t := range referenceGrants[key] {
+			targets = append(targets, t)
+		}
+		sort.Slice(targets, func(i, j int) bool {
+			if targets[i].Kind != targets[j].Kind {
+				return targets[i].Kind < targets[j].Kind
+			}
+			return targets[i].Name < targets[j].Name
+		})
+		to := make([]map[string]any, len(targets))
+		for i, t := range targets {
+			to[i] = map[string]any{"group": t.Group, "kind": t.Kind, "name": t.Name}
+		}
+		docs = append(docs, map[string]any{
+			"apiVersion": "gateway.networking.k8s.io/v1beta1",
+			"kind":       "ReferenceGrant",
+			"metadata":   Metadata{Name: "httproutes-from-" + key.From, Namespace: key.Namespace},
+			"spec": map[string]any{
+				"from": []map[string]any{{"group": "gateway.networking.k8s.io", "kind": "HTTPRoute", "namespace": key.From}},
+				"to":   to,
+			},
+		})
+	}
+	outPath := outputPath("referencegrants", ".yaml")
+	if err := writeYAMLDocs(outPath, docs); err != nil {
+		return err
+	}
+	if !quiet {
+		fmt.Printf("Generated %s\n", outPath)
+	}
+	return nil
+}
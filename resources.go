@@ -0,0 +1,117 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"gopkg.in/yaml.v3"
+)
+
+// resourceManifest is --resource-manifest: a JSON inventory of every object
+// generated in the run, so deployment tooling can tell which resources this
+// generator owns and prune the ones it no longer writes, even when several
+// tools write into the same repository.
+var resourceManifest string
+
+// manifestDoc is the document written to --resource-manifest.
+type manifestDoc struct {
+	Generator string         `json:"generator"`
+	Version   string         `json:"version"`
+	Files     []manifestFile `json:"files"`
+}
+
+// manifestFile is one generated file. Paths are relative to the directory
+// of the manifest.
+type manifestFile struct {
+	Path    string           `json:"path"`
+	SHA256  string           `json:"sha256"`
+	Objects []manifestObject `json:"objects,omitempty"`
+}
+
+// manifestObject identifies one Kubernetes object of a file. Its hash covers
+// the object's content, not its formatting or the header comment.
+type manifestObject struct {
+	APIVersion string `json:"apiVersion"`
+	Kind       string `json:"kind"`
+	Namespace  string `json:"namespace,omitempty"`
+	Name       string `json:"name"`
+	SHA256     string `json:"sha256"`
+}
+
+// writeResourceManifest writes the manifest of the files generated in this
+// run.
+func writeResourceManifest() error {
+	base := filepath.Dir(resourceManifest)
+	doc := manifestDoc{Generator: "csv2httproute", Version: Version, Files: []manifestFile{}}
+	seen := make(map[string]bool)
+	for _, path := range writtenFiles {
+		if seen[path] || filepath.Clean(path) == filepath.Clean(resourceManifest) {
+			continue
+		}
+		seen[path] = true
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(base, path)
+		if err != nil {
+			rel = path
+		}
+		objects, err := manifestObjects(data)
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		doc.Files = append(doc.Files, manifestFile{Path: filepath.ToSlash(rel), SHA256: sha256Hex(data), Objects: objects})
+	}
+	sort.Slice(doc.Files, func(i, j int) bool { return doc.Files[i].Path < doc.Files[j].Path })
+
+	data, err := json.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeOutputFile(resourceManifest, append(data, '\n'))
+}
+
+// manifestObjects lists the Kubernetes objects of a YAML file. Files that
+// are not YAML, such as --template output, have none.
+func manifestObjects(data []byte) ([]manifestObject, error) {
+	var objects []manifestObject
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	for {
+		var obj map[string]any
+		err := dec.Decode(&obj)
+		if errors.Is(err, io.EOF) {
+			return objects, nil
+		}
+		if err != nil {
+			return nil, nil
+		}
+		kind, _ := obj["kind"].(string)
+		if kind == "" {
+			continue
+		}
+		apiVersion, _ := obj["apiVersion"].(string)
+		meta, _ := obj["metadata"].(map[string]any)
+		name, _ := meta["name"].(string)
+		ns, _ := meta["namespace"].(string)
+		// encoding/json sorts map keys, giving a canonical form to hash.
+		canonical, err := json.Marshal(obj)
+		if err != nil {
+			return nil, err
+		}
+		objects = append(objects, manifestObject{APIVersion: apiVersion, Kind: kind, Namespace: ns, Name: name, SHA256: sha256Hex(canonical)})
+	}
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
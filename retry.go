@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"os"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	utilnet "k8s.io/apimachinery/pkg/util/net"
+)
+
+// clusterRetries and retryBackoff are --retries and --retry-backoff: how
+// often a cluster request failing transiently is retried, and the delay
+// before the first retry, doubled for every further one.
+var (
+	clusterRetries = 4
+	retryBackoff   = 500 * time.Millisecond
+)
+
+// maxRetryBackoff caps the delay between two attempts.
+const maxRetryBackoff = 30 * time.Second
+
+// retryCluster runs op, giving each attempt timeout, until it succeeds, fails
+// for good, or --retries retries of transient failures are used up. what
+// names the object in the retry messages. The error of the last attempt is
+// returned wrapped, so apierrors checks such as IsNotFound still apply.
+func retryCluster(ctx context.Context, what string, timeout time.Duration, op func(context.Context) error) error {
+	for attempt := 1; ; attempt++ {
+		attemptCtx, cancel := context.WithTimeout(ctx, timeout)
+		err := op(attemptCtx)
+		cancel()
+		if err == nil || ctx.Err() != nil || !transientClusterError(err) {
+			return err
+		}
+		if attempt > clusterRetries {
+			return fmt.Errorf("%w (gave up after %d attempts)", err, attempt)
+		}
+		delay := retryDelay(attempt, err)
+		if !quiet {
+			fmt.Fprintf(os.Stderr, "Retrying %s in %s: %v\n", what, delay.Round(time.Millisecond), err)
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(delay):
+		}
+	}
+}
+
+// transientClusterError reports whether a request failing with err may
+// succeed when repeated: conflicts, throttling, timeouts, server errors and
+// dropped connections.
+func transientClusterError(err error) bool {
+	switch {
+	case apierrors.IsConflict(err), apierrors.IsTooManyRequests(err), apierrors.IsServerTimeout(err),
+		apierrors.IsTimeout(err), apierrors.IsServiceUnavailable(err), apierrors.IsInternalError(err),
+		apierrors.IsUnexpectedServerError(err):
+		return true
+	case errors.Is(err, context.DeadlineExceeded):
+		return true
+	}
+	return utilnet.IsConnectionReset(err) || utilnet.IsConnectionRefused(err) || utilnet.IsProbableEOF(err)
+}
+
+// retryDelay is the delay before retry attempt: exponential with up to 20%
+// jitter, so parallel runs spread out, and at least the delay the server
+// asked for. A zero --retry-backoff retries at once.
+func retryDelay(attempt int, err error) time.Duration {
+	delay := retryBackoff
+	// Doubling stops at the cap, before it could overflow
+	for i := 1; i < attempt && delay < maxRetryBackoff; i++ {
+		delay *= 2
+	}
+	delay = min(delay, maxRetryBackoff)
+	if delay > 0 {
+		delay += rand.N(delay/5 + 1)
+	}
+	if seconds, ok := apierrors.SuggestsClientDelay(err); ok {
+		if suggested := time.Duration(seconds) * time.Second; suggested > delay {
+			delay = suggested
+		}
+	}
+	return delay
+}
+
+func validateRetries() error {
+	if clusterRetries < 0 {
+		return fmt.Errorf("invalid --retries %d (must be 0 or more)", clusterRetries)
+	}
+	if retryBackoff < 0 {
+		return fmt.Errorf("invalid --retry-backoff %s", retryBackoff)
+	}
+	return nil
+}
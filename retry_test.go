@@ -0,0 +1,34 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestRetryDelay(t *testing.T) {
+	tests := []struct {
+		backoff  time.Duration
+		attempt  int
+		min, max time.Duration
+	}{
+		{0, 1, 0, 0},
+		{0, 10, 0, 0},
+		{500 * time.Millisecond, 1, 500 * time.Millisecond, 600 * time.Millisecond},
+		{500 * time.Millisecond, 3, 2 * time.Second, 2400 * time.Millisecond},
+		{500 * time.Millisecond, 10, maxRetryBackoff, maxRetryBackoff * 6 / 5},
+		{time.Hour, 1, maxRetryBackoff, maxRetryBackoff * 6 / 5},
+		// Shifting by the attempt would overflow
+		{time.Second, 100, maxRetryBackoff, maxRetryBackoff * 6 / 5},
+	}
+	defer func(backoff time.Duration) { retryBackoff = backoff }(retryBackoff)
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("%s attempt %d", tt.backoff, tt.attempt), func(t *testing.T) {
+			retryBackoff = tt.backoff
+			if d := retryDelay(tt.attempt, errors.New("connection reset")); d < tt.min || d > tt.max {
+				t.Errorf("delay %s, want %s to %s", d, tt.min, tt.max)
+			}
+		})
+	}
+}
@@ -0,0 +1,318 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/arencloud/csv2httproute/pkg/router"
+	"github.com/spf13/pflag"
+	"gopkg.in/yaml.v3"
+)
+
+// Approval workflows want to let routing changes that cannot hurt through
+// on their own and send the others to a human. compat --risk scores every
+// change it reports by rules of its kind, path type, hostname, route and
+// the share of live traffic it touches, and --max-risk makes the score an
+// exit code.
+
+// The kinds of changes the risk rules match.
+const (
+	riskHostnameRemoved = "hostname-removed"
+	riskHostnameAdded   = "hostname-added"
+	riskMatchRemoved    = "match-removed"
+	riskMatchAdded      = "match-added"
+	riskBackendsChanged = "backends-changed"
+	riskFiltersChanged  = "filters-changed"
+	riskRouteMoved      = "route-moved"
+)
+
+var riskKinds = []string{riskHostnameRemoved, riskHostnameAdded, riskMatchRemoved, riskMatchAdded, riskBackendsChanged, riskFiltersChanged, riskRouteMoved}
+
+// riskLevels are the risks of changes, from the lowest.
+var riskLevels = []string{"low", "medium", "high"}
+
+var (
+	// riskEnabled is compat --risk.
+	riskEnabled bool
+	// riskRulesFile is compat --risk-rules, replacing defaultRiskRules.
+	riskRulesFile string
+	// maxRisk is compat --max-risk: the highest risk passing.
+	maxRisk string
+)
+
+// riskRule gives the changes of kind Change it matches Risk. The other
+// fields match everything when empty; MinTraffic matches a change touching
+// at least that share of the traffic, or any when the traffic is not known.
+type riskRule struct {
+	Change     string `yaml:"change"`
+	PathType   string `yaml:"pathType,omitempty"`
+	Hostname   string `yaml:"hostname,omitempty"`
+	Route      string `yaml:"route,omitempty"`
+	MinTraffic string `yaml:"minTraffic,omitempty"`
+	Risk       string `yaml:"risk"`
+
+	// minShare is MinTraffic as a fraction.
+	minShare float64
+}
+
+// riskRules is a --risk-rules file: the rules, of which the first matching
+// a change gives its risk, and the risk of changes none matches.
+type riskRules struct {
+	Default string     `yaml:"default"`
+	Rules   []riskRule `yaml:"rules"`
+}
+
+// defaultRiskRules are the rules without --risk-rules: losing a hostname,
+// or a match with traffic, is high risk, while new exact matches, new
+// hostnames and renames are low.
+var defaultRiskRules = riskRules{
+	Default: "medium",
+	Rules: []riskRule{
+		{Change: riskHostnameRemoved, Risk: "high"},
+		{Change: riskMatchRemoved, MinTraffic: "1%", Risk: "high"},
+		{Change: riskMatchRemoved, Risk: "medium"},
+		{Change: riskMatchAdded, MinTraffic: "1%", Risk: "medium"},
+		{Change: riskMatchAdded, PathType: "Exact", Risk: "low"},
+		{Change: riskMatchAdded, PathType: "RegularExpression", Risk: "medium"},
+		{Change: riskMatchAdded, Risk: "low"},
+		{Change: riskBackendsChanged, MinTraffic: "1%", Risk: "medium"},
+		{Change: riskBackendsChanged, Risk: "low"},
+		{Change: riskFiltersChanged, Risk: "medium"},
+		{Change: riskHostnameAdded, Risk: "low"},
+		{Change: riskRouteMoved, Risk: "low"},
+	},
+}
+
+// addRiskFlags registers the flags of the risk analysis of compat, with the
+// Prometheus flags of impact for the traffic of the changes.
+func addRiskFlags(flags *pflag.FlagSet) {
+	flags.BoolVar(&riskEnabled, "risk", false, "Score the risk of every change (low, medium or high)")
+	flags.StringVar(&riskRulesFile, "risk-rules", "", "YAML file of the rules scoring the changes, replacing the built-in ones; implies --risk")
+	flags.StringVar(&maxRisk, "max-risk", "", "Exit non-zero if any change has a higher risk than this: low or medium; implies --risk")
+	flags.StringVar(&prometheusURL, "prometheus", "", "Base URL of the Prometheus API, for the traffic of the changes the risk rules score")
+	flags.StringVar(&prometheusQuery, "query", "", "PromQL instant query returning request rates per method and path, with --prometheus")
+	flags.StringVar(&impactMethodKey, "method-label", "method", "Series label holding the request method")
+	flags.StringVar(&impactPathKey, "path-label", "path", "Series label holding the request path")
+	flags.StringVar(&impactHostKey, "host-label", "host", "Series label holding the request host, if any")
+}
+
+// loadRiskRules reads and checks the --risk-rules, or returns the built-in
+// rules.
+func loadRiskRules(ctx context.Context) (riskRules, error) {
+	rules := defaultRiskRules
+	if riskRulesFile != "" {
+		data, err := readInput(ctx, riskRulesFile)
+		if err != nil {
+			return rules, fmt.Errorf("failed to read risk rules: %w", err)
+		}
+		rules = riskRules{}
+		if err := yaml.Unmarshal(data, &rules); err != nil {
+			return rules, fmt.Errorf("failed to parse risk rules %s: %w", riskRulesFile, err)
+		}
+	}
+	rules.Rules = slices.Clone(rules.Rules)
+	if rules.Default == "" {
+		rules.Default = "medium"
+	}
+	if !slices.Contains(riskLevels, rules.Default) {
+		return rules, fmt.Errorf("risk rules: invalid default %q (must be %s)", rules.Default, strings.Join(riskLevels, ", "))
+	}
+	for i := range rules.Rules {
+		r := &rules.Rules[i]
+		switch {
+		case !slices.Contains(riskKinds, r.Change):
+			return rules, fmt.Errorf("risk rule %d: invalid change %q (must be one of %s)", i+1, r.Change, strings.Join(riskKinds, ", "))
+		case !slices.Contains(riskLevels, r.Risk):
+			return rules, fmt.Errorf("risk rule %d: invalid risk %q (must be %s)", i+1, r.Risk, strings.Join(riskLevels, ", "))
+		case r.PathType != "" && !slices.Contains([]string{"Exact", "PathPrefix", "RegularExpression"}, r.PathType):
+			return rules, fmt.Errorf("risk rule %d: invalid pathType %q (must be Exact, PathPrefix or RegularExpression)", i+1, r.PathType)
+		}
+		for _, pattern := range []string{r.Hostname, r.Route} {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return rules, fmt.Errorf("risk rule %d: invalid pattern %q", i+1, pattern)
+			}
+		}
+		if r.MinTraffic != "" {
+			share, err := parseTrafficShare(r.MinTraffic)
+			if err != nil {
+				return rules, fmt.Errorf("risk rule %d: %w", i+1, err)
+			}
+			r.minShare = share
+		}
+	}
+	return rules, nil
+}
+
+// parseTrafficShare reads a share of the traffic, as a percentage such as
+// 5% or a fraction such as 0.05.
+func parseTrafficShare(v string) (float64, error) {
+	s, percent := strings.CutSuffix(strings.TrimSpace(v), "%")
+	share, err := strconv.ParseFloat(s, 64)
+	if percent {
+		share /= 100
+	}
+	if err != nil || share < 0 || share > 1 {
+		return 0, fmt.Errorf("invalid minTraffic %q (want a percentage such as 5%%, or a fraction from 0 to 1)", v)
+	}
+	return share, nil
+}
+
+// matches reports whether r applies to c as a change of kind, touching
+// share of the traffic when known.
+func (r riskRule) matches(kind string, c compatChange, share float64, known bool) bool {
+	if r.Change != kind {
+		return false
+	}
+	if r.PathType != "" {
+		if c.match == nil {
+			return false
+		}
+		if typ, _ := compatPath(c.match.match); typ != r.PathType {
+			return false
+		}
+	}
+	if r.Hostname != "" {
+		if ok, _ := path.Match(r.Hostname, c.host); !ok {
+			return false
+		}
+	}
+	if r.Route != "" {
+		if c.route == nil {
+			return false
+		}
+		if ok, _ := path.Match(r.Route, routeID(c.route)); !ok {
+			return false
+		}
+	}
+	return r.MinTraffic == "" || !known || share >= r.minShare
+}
+
+// riskReport is the risk analysis of a compat report: the highest risk of
+// its changes, none without changes, and the risk of every change.
+type riskReport struct {
+	Level   string         `json:"level"`
+	Changes []riskedChange `json:"changes"`
+}
+
+type riskedChange struct {
+	Change string `json:"change"`
+	Risk   string `json:"risk"`
+	// Rule is the number of the rule giving the risk, 0 for the default.
+	Rule int `json:"rule"`
+	// Traffic is the share of the traffic the change touches, with
+	// --prometheus.
+	Traffic *float64 `json:"traffic,omitempty"`
+}
+
+// scoreRisk gives every change of report the risk of the first rule
+// matching its kind, the highest of its kinds when it has several. traffic
+// is the share of the traffic of each change, or nil when not known.
+func scoreRisk(report compatReport, rules riskRules, traffic []float64) *riskReport {
+	risk := &riskReport{Level: "none", Changes: []riskedChange{}}
+	for i, c := range report.changes {
+		var share float64
+		if traffic != nil {
+			share = traffic[i]
+		}
+		var rc riskedChange
+		for _, kind := range c.kinds {
+			level, rule := rules.Default, 0
+			for j, r := range rules.Rules {
+				if r.matches(kind, c, share, traffic != nil) {
+					level, rule = r.Risk, j+1
+					break
+				}
+			}
+			if riskRank(level) > riskRank(rc.Risk) {
+				rc.Risk, rc.Rule = level, rule
+			}
+		}
+		rc.Change = c.text
+		if traffic != nil {
+			rc.Traffic = &share
+		}
+		if riskRank(rc.Risk) > riskRank(risk.Level) {
+			risk.Level = rc.Risk
+		}
+		risk.Changes = append(risk.Changes, rc)
+	}
+	slices.SortFunc(risk.Changes, func(a, b riskedChange) int {
+		if a.Risk != b.Risk {
+			return riskRank(b.Risk) - riskRank(a.Risk)
+		}
+		return strings.Compare(a.Change, b.Change)
+	})
+	return risk
+}
+
+// riskRank orders the risk levels, with none, and unknown ones, lowest.
+func riskRank(level string) int {
+	return slices.Index(riskLevels, level)
+}
+
+// validateMaxRisk checks --max-risk; high would pass everything.
+func validateMaxRisk() error {
+	if maxRisk == "" || maxRisk == "low" || maxRisk == "medium" {
+		return nil
+	}
+	return fmt.Errorf("invalid --max-risk %q (must be low or medium)", maxRisk)
+}
+
+// changeTraffic replays the --query series against both trees and returns
+// the share of the traffic each change of report touches: a removed match
+// its requests before, and any other match those it serves now. A match
+// counts its requests on every hostname of its route, and a hostname the
+// requests of its matches.
+func changeTraffic(ctx context.Context, report compatReport, oldTable, newTable *router.Table) ([]float64, error) {
+	samples, err := queryTraffic(ctx)
+	if err != nil {
+		return nil, err
+	}
+	type ruleMatch struct {
+		rule  *router.Rule
+		index int
+	}
+	var total float64
+	oldRate, newRate := make(map[ruleMatch]float64), make(map[ruleMatch]float64)
+	for _, s := range samples {
+		total += s.Rate
+		req := router.Request{Method: s.Request.Method, Host: s.Request.Host, Path: s.Request.Path}
+		if res, ok := oldTable.MatchRequest(req); ok {
+			oldRate[ruleMatch{res.Rule, res.MatchIndex}] += s.Rate
+		}
+		if res, ok := newTable.MatchRequest(req); ok {
+			newRate[ruleMatch{res.Rule, res.MatchIndex}] += s.Rate
+		}
+	}
+	hostRate := func(table *router.Table, rates map[ruleMatch]float64, host string) float64 {
+		var rate float64
+		for _, m := range tableMatches(table) {
+			if m.host == host {
+				rate += rates[ruleMatch{m.rule, m.index}]
+			}
+		}
+		return rate
+	}
+	traffic := make([]float64, len(report.changes))
+	for i, c := range report.changes {
+		var rate float64
+		switch {
+		case c.match != nil && c.old:
+			rate = oldRate[ruleMatch{c.match.rule, c.match.index}]
+		case c.match != nil:
+			rate = newRate[ruleMatch{c.match.rule, c.match.index}]
+		case slices.Contains(c.kinds, riskHostnameRemoved):
+			rate = hostRate(oldTable, oldRate, c.host)
+		case slices.Contains(c.kinds, riskHostnameAdded):
+			rate = hostRate(newTable, newRate, c.host)
+		}
+		if total > 0 {
+			traffic[i] = rate / total
+		}
+	}
+	return traffic, nil
+}
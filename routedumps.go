@@ -0,0 +1,182 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"maps"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/arencloud/csv2httproute/pkg/convert"
+	"gopkg.in/yaml.v3"
+)
+
+// railsOptional matches the optional groups of a Rails route path, such as
+// the "(.:format)" of every resource route.
+var railsOptional = regexp.MustCompile(`\([^()]*\)`)
+
+// aspnetOptional matches the optional and defaulted parameters of an
+// ASP.NET route template, {id?} and {page=1}, which end the URL like a
+// catch-all, since the path may stop before them.
+var aspnetOptional = regexp.MustCompile(`\{\*{0,2}([A-Za-z_][A-Za-z0-9_]*)(?::[^}=?]*)?(?:=[^}]*|\?)\}`)
+
+// parseRouteDump turns the JSON route dump of a Rails, Django or ASP.NET
+// application into endpoint rows, one per method and route, numbered by the
+// line of the route:
+//
+//   - rails: the output of rails routes --json, objects with a verb
+//     ("GET", "GET|POST", or empty for any), a path such as
+//     /users/:id(.:format), and the controller#action as reqs.
+//   - django: the output of django-extensions' show_urls --format json,
+//     objects with a url such as /users/<int:pk>/ and the view as module.
+//   - aspnet: the routes of attribute-routed controllers as ApiExplorer
+//     describes them, objects with an httpMethod (or httpMethods), a
+//     relativePath (or routePattern) such as api/orders/{id:int}, and the
+//     action as displayName.
+//
+// Parameters become {name} templates matching one segment, globs such as
+// *path and <path:rest> become prefix matches, and optional groups are
+// dropped. The framework's own routes (Rails' /rails/ routes, Django's
+// static file views) are left out.
+func parseRouteDump(ctx context.Context, path string) ([]Endpoint, error) {
+	data, err := readInput(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("invalid %s route dump: %w", inputFormat, err)
+	}
+	if len(doc.Content) == 0 || doc.Content[0].Kind != yaml.SequenceNode {
+		return nil, fmt.Errorf("not a %s route dump (want a JSON array of routes)", inputFormat)
+	}
+	var endpoints []Endpoint
+	seen := make(map[string]bool)
+	for _, route := range doc.Content[0].Content {
+		var rows []Endpoint
+		switch inputFormat {
+		case formatRails:
+			rows, err = railsRows(route)
+		case formatDjango:
+			rows, err = djangoRows(route)
+		default:
+			rows, err = aspnetRows(route)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", route.Line, err)
+		}
+		for _, e := range rows {
+			if key := e.Method + " " + e.URL; !seen[key] {
+				seen[key] = true
+				endpoints = append(endpoints, e)
+			}
+		}
+	}
+	recordSkippedRows(path, 0)
+	return applyTagFilters(applyCutovers(endpoints)), nil
+}
+
+// railsRows are the rows of one route of a Rails dump.
+func railsRows(route *yaml.Node) ([]Endpoint, error) {
+	path := scalarValue(mappingValue(route, "path"))
+	if path == "" {
+		return nil, fmt.Errorf("route without a path field")
+	}
+	if strings.HasPrefix(path, "/rails/") {
+		return nil, nil
+	}
+	for p := ""; p != path; {
+		p, path = path, railsOptional.ReplaceAllString(path, "")
+	}
+	handler := scalarValue(mappingValue(route, "reqs"))
+	if controller := scalarValue(mappingValue(route, "controller")); handler == "" && controller != "" {
+		handler = controller + "#" + scalarValue(mappingValue(route, "action"))
+	}
+	methods := strings.Split(scalarValue(mappingValue(route, "verb")), "|")
+	var rows []Endpoint
+	for _, method := range methods {
+		e, err := frameworkRow(strings.TrimSpace(method), path, map[string]string{"comment": handler})
+		if err != nil {
+			return nil, err
+		}
+		e.Line = route.Line
+		rows = append(rows, e)
+	}
+	return rows, nil
+}
+
+// djangoRows are the rows of one URL pattern of a Django dump. Django routes
+// every method to the view, so rows match all of them.
+func djangoRows(route *yaml.Node) ([]Endpoint, error) {
+	url := scalarValue(mappingValue(route, "url"))
+	view := scalarValue(mappingValue(route, "module"))
+	if url == "" {
+		return nil, fmt.Errorf("URL pattern without a url field")
+	}
+	if strings.HasPrefix(view, "django.views.static.") || strings.HasPrefix(view, "django.contrib.staticfiles.") {
+		return nil, nil
+	}
+	e, err := frameworkRow("", "/"+strings.TrimPrefix(url, "/"), map[string]string{"comment": view})
+	if err != nil {
+		return nil, err
+	}
+	e.Line = route.Line
+	return []Endpoint{e}, nil
+}
+
+// aspnetRows are the rows of one route of an ASP.NET dump. Constraints such
+// as {id:int} match any segment, and {**slug} catch-alls and optional
+// parameters end the URL.
+func aspnetRows(route *yaml.Node) ([]Endpoint, error) {
+	path := cmp.Or(scalarValue(mappingValue(route, "relativePath")), scalarValue(mappingValue(route, "routePattern")))
+	if path == "" {
+		return nil, fmt.Errorf("route without a relativePath or routePattern field")
+	}
+	path = aspnetOptional.ReplaceAllString(strings.ReplaceAll(path, "{**", "{*"), "{*$1}")
+	methods := scalarValues(mappingValue(route, "httpMethods"))
+	if m := scalarValue(mappingValue(route, "httpMethod")); m != "" {
+		methods = append(methods, m)
+	}
+	if len(methods) == 0 {
+		methods = []string{""}
+	}
+	comment := scalarValue(mappingValue(route, "displayName"))
+	var rows []Endpoint
+	for _, method := range methods {
+		e, err := frameworkRow(method, "/"+strings.TrimPrefix(path, "/"), map[string]string{"comment": comment})
+		if err != nil {
+			return nil, err
+		}
+		e.Line = route.Line
+		rows = append(rows, e)
+	}
+	return rows, nil
+}
+
+// frameworkRow is the row of a route pattern registered with a framework,
+// with its parameters normalized by scannedURL and matched as templates,
+// and the other columns set from cells.
+func frameworkRow(method, pattern string, cells map[string]string) (Endpoint, error) {
+	header := []string{"method", "url"}
+	record := []string{method, scannedURL(pattern)}
+	if strings.Contains(record[1], "{") {
+		matches, err := compileTemplatePath(record[1])
+		if err != nil {
+			return Endpoint{}, fmt.Errorf("%s: %w", pattern, err)
+		}
+		header = append(header, "match_type")
+		record = append(record, matches[0].Type)
+		record[1] = matches[0].Value
+	}
+	for _, column := range slices.Sorted(maps.Keys(cells)) {
+		header = append(header, column)
+		record = append(record, cells[column])
+	}
+	e, err := parseRecord(record, convert.ColumnIndex(header))
+	if err != nil {
+		return Endpoint{}, fmt.Errorf("%s %s: %w", method, pattern, err)
+	}
+	return e, nil
+}
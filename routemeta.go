@@ -0,0 +1,101 @@
+package main
+
+import (
+	"fmt"
+	"maps"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/util/validation"
+
+	"github.com/arencloud/csv2httproute/pkg/convert"
+)
+
+var (
+	// routeLabels and routeAnnotations are --label and --annotation:
+	// metadata of every generated route, such as ownership labels or Argo
+	// CD sync waves.
+	routeLabels      []string
+	routeAnnotations []string
+)
+
+// routeLabelMap and routeAnnotationMap are the parsed --label and
+// --annotation.
+var routeLabelMap, routeAnnotationMap map[string]string
+
+func validateRouteMetadata() error {
+	var err error
+	if routeLabelMap, err = parseLabelFlag("label", routeLabels); err != nil {
+		return err
+	}
+	if err := checkMetadata("--label", routeLabelMap, true); err != nil {
+		return err
+	}
+	if routeAnnotationMap, err = parseLabelFlag("annotation", routeAnnotations); err != nil {
+		return err
+	}
+	return checkMetadata("--annotation", routeAnnotationMap, false)
+}
+
+// checkMetadata rejects the label or annotation keys, and label values, the
+// API server would.
+func checkMetadata(what string, pairs map[string]string, labels bool) error {
+	for key, value := range pairs {
+		if errs := validation.IsQualifiedName(key); len(errs) > 0 {
+			return fmt.Errorf("invalid %s key %q: %s", what, key, strings.Join(errs, "; "))
+		}
+		if !labels {
+			continue
+		}
+		if errs := validation.IsValidLabelValue(value); len(errs) > 0 {
+			return fmt.Errorf("invalid %s value %q of %s: %s", what, value, key, strings.Join(errs, "; "))
+		}
+	}
+	return nil
+}
+
+// applyRouteMetadata adds the labels and annotations columns of the rows of
+// a route to its metadata, then the --label and --annotation values it has
+// no value for. A row's column wins over profiles, the --config labels, and
+// the flags; rows of one route giving a key different values fail.
+func applyRouteMetadata(meta *Metadata, endpoints []Endpoint) error {
+	for _, column := range []struct {
+		name  string
+		cell  func(Endpoint) string
+		dst   *map[string]string
+		flags map[string]string
+	}{
+		{"labels", func(e Endpoint) string { return e.Labels }, &meta.Labels, routeLabelMap},
+		{"annotations", func(e Endpoint) string { return e.Annotations }, &meta.Annotations, routeAnnotationMap},
+	} {
+		rows := make(map[string]string)
+		lines := make(map[string]int)
+		for _, e := range endpoints {
+			pairs, err := convert.ParseMetadataPairs(column.cell(e), column.name)
+			if err != nil {
+				return fmt.Errorf("line %d: %w", e.Line, err)
+			}
+			if err := checkMetadata(column.name, pairs, column.name == "labels"); err != nil {
+				return fmt.Errorf("line %d: %w", e.Line, err)
+			}
+			for key, value := range pairs {
+				if prev, ok := rows[key]; ok && prev != value {
+					return fmt.Errorf("line %d: %s %s=%s conflicts with %s=%s of line %d in route %s", e.Line, column.name, key, value, key, prev, lines[key], meta.Name)
+				}
+				rows[key], lines[key] = value, e.Line
+			}
+		}
+		if len(rows) == 0 && len(column.flags) == 0 {
+			continue
+		}
+		if *column.dst == nil {
+			*column.dst = make(map[string]string)
+		}
+		maps.Copy(*column.dst, rows)
+		for key, value := range column.flags {
+			if _, ok := (*column.dst)[key]; !ok {
+				(*column.dst)[key] = value
+			}
+		}
+	}
+	return nil
+}
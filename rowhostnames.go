@@ -0,0 +1,62 @@
+package main
+
+import (
+	"cmp"
+	"slices"
+	"strings"
+)
+
+// expandHostnames resolves the hostname column (and "#! hostname=" directives
+// listing several) of the rows of one file. When every row with a hostname
+// serves the same set of them, the rows keep the set and their route lists
+// all of it, see routeHostnames. Rows serving different sets conflict, since
+// a route's hostnames apply to all of its rules; each of their hostnames
+// then gets a copy of the row, routed like under a hostname directive.
+func expandHostnames(endpoints []Endpoint) []Endpoint {
+	sets := make(map[string]bool)
+	first := ""
+	for _, e := range endpoints {
+		switch {
+		case e.Hostnames != "":
+			hostnames := strings.Split(e.Hostnames, ";")
+			slices.Sort(hostnames)
+			sets[strings.Join(hostnames, ";")] = true
+			first = cmp.Or(first, e.Hostnames)
+		case e.Hostname != "":
+			sets[e.Hostname] = true
+		}
+	}
+	if first == "" {
+		return endpoints
+	}
+	var expanded []Endpoint
+	for _, e := range endpoints {
+		if e.Hostnames == "" {
+			expanded = append(expanded, e)
+			continue
+		}
+		if len(sets) == 1 {
+			e.Hostnames = first
+			e.Hostname, _, _ = strings.Cut(first, ";")
+			expanded = append(expanded, e)
+			continue
+		}
+		for _, h := range strings.Split(e.Hostnames, ";") {
+			e.Hostname, e.Hostnames = h, ""
+			expanded = append(expanded, e)
+		}
+	}
+	return expanded
+}
+
+// routeHostnames are the hostnames of a route for target serving endpoints:
+// the hostname set the rows share, or the target's hostname.
+func routeHostnames(target routeTarget, endpoints []Endpoint) []string {
+	if len(endpoints) > 0 && endpoints[0].Hostnames != "" && !slices.ContainsFunc(endpoints, func(e Endpoint) bool { return e.Hostnames != endpoints[0].Hostnames }) {
+		return strings.Split(endpoints[0].Hostnames, ";")
+	}
+	if target.Hostname != "" {
+		return []string{target.Hostname}
+	}
+	return nil
+}
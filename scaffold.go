@@ -0,0 +1,118 @@
+package main
+
+import (
+	"embed"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+
+	"github.com/spf13/cobra"
+)
+
+var initForce bool
+
+// scaffoldFile is a file of the starter workspace, by its path relative to
+// the target directory.
+type scaffoldFile struct {
+	Path    string
+	Content string
+}
+
+// scaffoldFiles is the starter workspace written by `init`.
+var scaffoldFiles = []scaffoldFile{
+	{"facts/endpoints/example.csv", `Method,URL,Prefix,Service,Port,Variant,Comment
+# Lines starting with # are ignored.
+GET,/api/v1/users,/api/v1,users-svc,8080,,List users
+POST,/api/v1/login,/api/v1,users-svc,8080,,Authentication
+GET,/api/v2/orders,,orders-svc,80,v2,Orders served by the v2 rollout
+,/health,,,,,Empty method matches all methods; service falls back to --service
+`},
+	{"domain-map.yaml", `# Optional: split routes by routing domain (pass with --domain-map).
+# Rows whose Prefix (or URL) falls under an entry are emitted as a separate
+# HTTPRoute for that hostname and gateway.
+domains: []
+#  - prefix: /api/v1
+#    hostname: users.example.com
+#    gateway: public-gw        # defaults to --gateway
+#    gatewayNamespace: infra   # defaults to --gateway-namespace
+`},
+	{"Makefile", `# Defaults for csv2httproute; override on the command line, e.g.
+#   make routes NAMESPACE=production
+# ROUTE_HOSTNAME rather than HOSTNAME, which shells and CI runners export.
+CSV2HTTPROUTE    ?= csv2httproute
+INPUT            ?= facts/endpoints
+OUTPUT           ?= generated
+SERVICE          ?= my-service
+PORT             ?= 80
+GATEWAY          ?= my-gateway
+NAMESPACE        ?= default
+# ROUTE_HOSTNAME ?= api.example.com
+# DOMAIN_MAP     ?= domain-map.yaml
+
+FLAGS = --input $(INPUT) --output $(OUTPUT) --service $(SERVICE) --port $(PORT) \
+	--gateway $(GATEWAY) --namespace $(NAMESPACE) --fail-on-empty \
+	$(if $(ROUTE_HOSTNAME),--hostname $(ROUTE_HOSTNAME)) $(if $(DOMAIN_MAP),--domain-map $(DOMAIN_MAP))
+
+.PHONY: routes clean-routes
+routes:
+	$(CSV2HTTPROUTE) $(FLAGS)
+
+clean-routes:
+	rm -rf $(OUTPUT)
+`},
+}
+
+// exampleTemplates are the example --template files, written by init to
+// templates/ next to the scaffold.
+//
+//go:embed templates
+var exampleTemplates embed.FS
+
+func newInitCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "init [dir]",
+		Short: "Scaffold a starter inventory workspace",
+		Long: `Creates a starter layout in dir (default: current directory): an example CSV
+using every supported column, a commented domain map, a Makefile with the
+common flag defaults, and example --template files in templates/. Existing
+files are left untouched unless --force is set.`,
+		Args: cobra.MaximumNArgs(1),
+		RunE: runInit,
+	}
+	cmd.Flags().BoolVarP(&initForce, "force", "f", false, "Overwrite existing files")
+	return cmd
+}
+
+func runInit(cmd *cobra.Command, args []string) error {
+	dir := "."
+	if len(args) == 1 {
+		dir = args[0]
+	}
+
+	files := slices.Clone(scaffoldFiles)
+	templates, _ := fs.Glob(exampleTemplates, "templates/*")
+	for _, name := range templates {
+		data, err := exampleTemplates.ReadFile(name)
+		if err != nil {
+			return err
+		}
+		files = append(files, scaffoldFile{name, string(data)})
+	}
+	for _, f := range files {
+		path := filepath.Join(dir, filepath.FromSlash(f.Path))
+		if _, err := os.Stat(path); err == nil && !initForce {
+			fmt.Printf("Skipped %s (already exists)\n", path)
+			continue
+		}
+		if err := os.MkdirAll(filepath.Dir(path), 0777); err != nil {
+			return err
+		}
+		if err := os.WriteFile(path, []byte(f.Content), 0666); err != nil {
+			return err
+		}
+		fmt.Printf("Created %s\n", path)
+	}
+	return nil
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// runCommand runs the command line args in-process, as a fresh process
+// would.
+func runCommand(t *testing.T, args ...string) error {
+	t.Helper()
+	resetRunState()
+	cmd := newRootCmd()
+	cmd.SetArgs(args)
+	return cmd.Execute()
+}
+
+func TestInitScaffoldValidates(t *testing.T) {
+	dir := t.TempDir()
+	if err := runCommand(t, "init", dir); err != nil {
+		t.Fatalf("init: %v", err)
+	}
+	input := filepath.Join(dir, "facts", "endpoints")
+	if err := runCommand(t, "validate", "--input", input, "--env-file", ""); err != nil {
+		t.Errorf("validate of the scaffold: %v", err)
+	}
+	out := filepath.Join(dir, "generated")
+	if err := runCommand(t, "--input", input, "--output", out, "--strict", "--env-file", ""); err != nil {
+		t.Errorf("--strict generation of the scaffold: %v", err)
+	}
+}
+
+func TestInitMakefileHostname(t *testing.T) {
+	for _, f := range scaffoldFiles {
+		if f.Path != "Makefile" {
+			continue
+		}
+		// HOSTNAME is set by shells and CI runners, and would become the
+		// --hostname of every route.
+		if strings.Contains(f.Content, "$(HOSTNAME)") {
+			t.Errorf("the scaffolded Makefile reads HOSTNAME")
+		}
+	}
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Scale-to-zero backends are served through the KEDA HTTP add-on: the
+// interceptor holds requests while the workload scales up from zero, so rows
+// flagged scale_to_zero route to the interceptor instead of their Service,
+// and an HTTPScaledObject tells the interceptor where to forward them.
+
+var (
+	scaleInterceptor  string
+	scaleMaxReplicas  int
+	interceptorTarget BackendRef
+)
+
+// loadScaleInterceptor parses --scale-to-zero-interceptor, given as
+// [namespace/]service:port.
+func loadScaleInterceptor(spec string) error {
+	ns, svc, ok := strings.Cut(spec, "/")
+	if !ok {
+		ns, svc = "", spec
+	}
+	name, portStr, hasPort := strings.Cut(svc, ":")
+	if name == "" || !hasPort {
+		return fmt.Errorf("invalid --scale-to-zero-interceptor %q (want [namespace/]service:port)", spec)
+	}
+	b, err := parseBackendSpec(name + ":" + portStr)
+	if err != nil {
+		return fmt.Errorf("invalid --scale-to-zero-interceptor: %w", err)
+	}
+	b.Namespace = ns
+	interceptorTarget = b
+	return nil
+}
+
+// writeScaleToZero writes <route>.keda.yaml for the scale-to-zero rows of
+// route: an HTTPScaledObject per backend Service, scoped to the route's
+// hostname and the rows' paths, plus the ReferenceGrant letting the route
+// reach an interceptor in another namespace.
+func writeScaleToZero(route HTTPRoute, endpoints []Endpoint) error {
+	type target struct {
+		backend BackendRef
+		paths   []string
+	}
+	targets := make(map[backendKey]*target)
+	for _, e := range endpoints {
+		if !e.ScaleToZero || inMaintenance(e) {
+			continue
+		}
+		e.ScaleToZero = false
+		b := backendFor(e)
+		if b.Kind != "Service" {
+			return fmt.Errorf("line %d: scale_to_zero requires a Service backend, not %s", e.Line, b.Kind)
+		}
+		if b.Namespace == "" {
+			b.Namespace = route.Metadata.Namespace
+		}
+		key := backendKey{Namespace: b.Namespace, Name: b.Name, Port: b.Port}
+		t, ok := targets[key]
+		if !ok {
+			t = &target{backend: b}
+			targets[key] = t
+		}
+		t.paths = append(t.paths, e.URL)
+	}
+	if len(targets) == 0 {
+		return nil
+	}
+	keys := make([]backendKey, 0, len(targets))
+	for key := range targets {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].Namespace != keys[j].Namespace {
+			return keys[i].Namespace < keys[j].Namespace
+		}
+		if keys[i].Name != keys[j].Name {
+			return keys[i].Name < keys[j].Name
+		}
+		return keys[i].Port < keys[j].Port
+	})
+
+	var docs []any
+	for _, key := range keys {
+		t := targets[key]
+		spec := map[string]any{
+			"pathPrefixes": dedupe(t.paths),
+			// The workload is assumed to be a Deployment named after its
+			// Service, matching the convention of the add-on's examples.
+			"scaleTargetRef": map[string]any{
+				"apiVersion": "apps/v1",
+				"kind":       "Deployment",
+				"name":       key.Name,
+				"service":    key.Name,
+				"port":       key.Port,
+			},
+			"replicas": map[string]any{"min": 0, "max": scaleMaxReplicas},
+		}
+		if len(route.Spec.Hostnames) > 0 {
+			spec["hosts"] = route.Spec.Hostnames
+		}
+		docs = append(docs, map[string]any{
+			"apiVersion": "http.keda.sh/v1alpha1",
+			"kind":       "HTTPScaledObject",
+			"metadata":   Metadata{Name: key.Name, Namespace: key.Namespace},
+			"spec":       spec,
+		})
+	}
+	if ns := interceptorTarget.Namespace; ns != "" && ns != route.Metadata.Namespace {
+		docs = append(docs, map[string]any{
+			"apiVersion": "gateway.networking.k8s.io/v1beta1",
+			"kind":       "ReferenceGrant",
+			"metadata":   Metadata{Name: route.Metadata.Name + "-interceptor", Namespace: ns},
+			"spec": map[string]any{
+				"from": []map[string]any{{"group": "gateway.networking.k8s.io", "kind": "HTTPRoute", "namespace": route.Metadata.Namespace}},
+				"to":   []map[string]any{{"group": "", "kind": "Service", "name": interceptorTarget.Name}},
+			},
+		})
+	}
+	return writeYAMLDocs(outputPath(route.Metadata.Name, ".keda.yaml"), docs)
+}
+
+// dedupe returns values without repeats, keeping first-appearance order.
+func dedupe(values []string) []string {
+	seen := make(map[string]bool)
+	var out []string
+	for _, v := range values {
+		if !seen[v] {
+			seen[v] = true
+			out = append(out, v)
+		}
+	}
+	return out
+}
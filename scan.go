@@ -0,0 +1,583 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"io/fs"
+	"maps"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/arencloud/csv2httproute/pkg/convert"
+)
+
+var (
+	scanInventory string
+	scanService   string
+	scanPort      int
+)
+
+// scanSkipDirs are directories of dependencies, build output and tooling
+// that never hold the routes of the service itself.
+var scanSkipDirs = map[string]bool{
+	".git": true, "vendor": true, "node_modules": true, "testdata": true,
+	"target": true, "build": true, "__pycache__": true, ".venv": true, "venv": true,
+}
+
+func newScanCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "scan [DIR...]",
+		Short: "Build the CSV inventory from route registrations in source code",
+		Long: `Reads the source trees given as arguments (default .) for the routes their
+code registers and writes one CSV per tree to --inventory, named after its
+Service, so the inventory of services whose code is available no longer
+has to be maintained by hand:
+
+  Go      net/http (HandleFunc, "GET /path" patterns), chi (Get, Route,
+          Group, Method), gin and echo (GET, Group, Any, Handle)
+  Java    Spring (@GetMapping, @RequestMapping, ...) and JAX-RS (@Path with
+          @GET, ...), also in Kotlin
+  Python  Flask (@app.route, Blueprint url_prefix) and FastAPI
+          (@router.get, APIRouter prefix)
+
+Class-level mappings, route groups and router prefixes declared in the same
+file are joined with the paths below them. Path parameters are written as
+{name}, for generation with --path-syntax template; a catch-all parameter
+ends the URL, whose PathPrefix match covers everything below it. Every row
+records the file and line it was found at in its comment column.`,
+		RunE: runScan,
+	}
+	flags := cmd.Flags()
+	flags.StringVar(&scanInventory, "inventory", "scanned", "Directory the scanned CSVs are written to")
+	flags.StringVarP(&scanService, "service", "s", "", "Service column of the rows (default: the name of each source tree)")
+	flags.IntVarP(&scanPort, "port", "p", 0, "Port column of the rows (default: empty, for --port at generation)")
+	return cmd
+}
+
+// scannedRoute is one route registration found in source code.
+type scannedRoute struct {
+	Method string
+	Path   string
+	File   string
+	Line   int
+}
+
+func runScan(cmd *cobra.Command, args []string) error {
+	if len(args) == 0 {
+		args = []string{"."}
+	}
+	if scanService != "" && len(args) > 1 {
+		return fmt.Errorf("--service names the Service of one source tree; scan the trees one at a time")
+	}
+	if err := os.MkdirAll(scanInventory, 0777); err != nil {
+		return fmt.Errorf("failed to create inventory directory: %w", err)
+	}
+	for _, root := range args {
+		abs, err := filepath.Abs(root)
+		if err != nil {
+			return err
+		}
+		service := scanService
+		if service == "" {
+			service = strings.Trim(nonSlugChars.ReplaceAllString(strings.ToLower(filepath.Base(abs)), "-"), "-")
+		}
+		routes, err := scanTree(root)
+		if err != nil {
+			return err
+		}
+		if err := writeScannedInventory(service, routes); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// scanTree scans the source files below root, in lexical order.
+func scanTree(root string) ([]scannedRoute, error) {
+	var routes []scannedRoute
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if path != root && scanSkipDirs[d.Name()] {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		var scan func(string, []byte) ([]scannedRoute, error)
+		switch filepath.Ext(path) {
+		case ".go":
+			if !strings.HasSuffix(path, "_test.go") {
+				scan = scanGo
+			}
+		case ".java", ".kt":
+			scan = scanJava
+		case ".py":
+			scan = scanPython
+		}
+		if scan == nil {
+			return nil
+		}
+		src, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			rel = path
+		}
+		found, err := scan(filepath.ToSlash(rel), src)
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		routes = append(routes, found...)
+		return nil
+	})
+	return routes, err
+}
+
+// writeScannedInventory writes the routes of one source tree as
+// <service>.csv, without repeating a method and URL.
+func writeScannedInventory(service string, routes []scannedRoute) error {
+	var rows [][]string
+	seen := make(map[string]bool)
+	templated := false
+	for _, r := range routes {
+		url := scannedURL(r.Path)
+		key := r.Method + " " + url
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		templated = templated || templateParam.MatchString(url)
+		port := ""
+		if scanPort != 0 {
+			port = strconv.Itoa(scanPort)
+		}
+		rows = append(rows, []string{r.Method, url, service, port, fmt.Sprintf("Scanned from %s:%d", r.File, r.Line)})
+	}
+
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	if err := w.Write([]string{"Method", "URL", "Service", "Port", "Comment"}); err != nil {
+		return err
+	}
+	if templated {
+		if err := w.Write([]string{"# Path parameters are {name} templates; generate with --path-syntax template"}); err != nil {
+			return err
+		}
+	}
+	if err := w.WriteAll(rows); err != nil {
+		return err
+	}
+	path := filepath.Join(scanInventory, service+".csv")
+	if err := os.WriteFile(path, buf.Bytes(), 0666); err != nil {
+		return err
+	}
+	if !quiet {
+		fmt.Printf("Scanned %s (%d endpoint(s))\n", path, len(rows))
+	}
+	return nil
+}
+
+// scanParam matches the path parameters of the supported frameworks:
+// {id} and {id:[0-9]+} (Spring, JAX-RS, chi, FastAPI), :id and *path (gin,
+// echo), <id> and <int:id> (Flask), {path...} (net/http).
+var scanParam = regexp.MustCompile(`\{\*?[A-Za-z_][A-Za-z0-9_]*(?:\.\.\.|:[^}]*)?\}|[:*][A-Za-z_][A-Za-z0-9_]*|<(?:[a-z]+:)?[A-Za-z_][A-Za-z0-9_]*>|\*\*?`)
+
+// scannedURL normalizes the parameters of path to {name} templates and
+// cuts it at a catch-all parameter.
+func scannedURL(path string) string {
+	segments := strings.Split(path, "/")
+	for i, seg := range segments {
+		catchAll := false
+		seg = scanParam.ReplaceAllStringFunc(seg, func(p string) string {
+			name := strings.Trim(p, "{}<>:*")
+			if j := strings.IndexByte(name, ':'); j >= 0 {
+				if strings.HasPrefix(p, "<") {
+					if name[:j] == "path" {
+						catchAll = true
+					}
+					name = name[j+1:]
+				} else {
+					name = name[:j]
+				}
+			}
+			if strings.HasPrefix(p, "*") || strings.HasPrefix(p, "{*") || strings.HasSuffix(name, "...") || name == "" {
+				catchAll = true
+			}
+			return "{" + name + "}"
+		})
+		if catchAll {
+			return joinRoutePath(strings.Join(segments[:i], "/"), "")
+		}
+		segments[i] = seg
+	}
+	return joinRoutePath(strings.Join(segments, "/"), "")
+}
+
+// joinRoutePath joins a route prefix and the path registered below it.
+func joinRoutePath(prefix, path string) string {
+	p := "/" + strings.Trim(prefix, "/")
+	if rest := strings.Trim(path, "/"); rest != "" {
+		p = strings.TrimSuffix(p, "/") + "/" + rest
+	}
+	return p
+}
+
+// goRouteMethods are the router methods registering a route for a method,
+// or for every method ("").
+var goRouteMethods = map[string]string{
+	"Get": "GET", "Post": "POST", "Put": "PUT", "Delete": "DELETE", "Patch": "PATCH",
+	"Head": "HEAD", "Options": "OPTIONS", "Connect": "CONNECT", "Trace": "TRACE",
+	"GET": "GET", "POST": "POST", "PUT": "PUT", "DELETE": "DELETE", "PATCH": "PATCH",
+	"HEAD": "HEAD", "OPTIONS": "OPTIONS", "CONNECT": "CONNECT", "TRACE": "TRACE",
+	"Any": "", "Handle": "", "HandleFunc": "", "Method": "", "MethodFunc": "",
+}
+
+// scanGo finds the route registrations of a Go file. Prefixes are tracked
+// per router variable: chi Route and Group callbacks, and gin and echo
+// groups assigned to a variable.
+func scanGo(file string, src []byte) ([]scannedRoute, error) {
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, file, src, parser.SkipObjectResolution)
+	if err != nil {
+		return nil, err
+	}
+	s := &goScanner{fset: fset, file: file}
+	s.walk(f, make(map[string]string))
+	return s.routes, nil
+}
+
+type goScanner struct {
+	fset   *token.FileSet
+	file   string
+	routes []scannedRoute
+}
+
+// walk scans n with prefixes mapping router variables to their prefix.
+func (s *goScanner) walk(n ast.Node, prefixes map[string]string) {
+	ast.Inspect(n, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.AssignStmt:
+			if len(n.Lhs) != 1 || len(n.Rhs) != 1 {
+				return true
+			}
+			call, ok := n.Rhs[0].(*ast.CallExpr)
+			if !ok {
+				return true
+			}
+			if recv, name, ok := goSelectorCall(call); ok && name == "Group" {
+				if p, ok := goStringArg(call, 0); ok {
+					prefixes[goExprName(n.Lhs[0])] = joinRoutePath(prefixes[recv], p)
+				}
+			}
+		case *ast.CallExpr:
+			recv, name, ok := goSelectorCall(n)
+			if !ok {
+				return true
+			}
+			if name == "Route" || name == "Group" {
+				fn, ok := n.Args[len(n.Args)-1].(*ast.FuncLit)
+				if !ok || fn.Type.Params.NumFields() != 1 || len(fn.Type.Params.List[0].Names) != 1 {
+					return true
+				}
+				prefix := prefixes[recv]
+				if p, ok := goStringArg(n, 0); ok && name == "Route" {
+					prefix = joinRoutePath(prefix, p)
+				}
+				inner := maps.Clone(prefixes)
+				inner[fn.Type.Params.List[0].Names[0].Name] = prefix
+				s.walk(fn.Body, inner)
+				return false
+			}
+			method, ok := goRouteMethods[name]
+			if !ok || len(n.Args) < 2 {
+				return true
+			}
+			path, ok := goStringArg(n, 0)
+			if !ok {
+				return true
+			}
+			if second, ok := goStringArg(n, 1); ok && (name == "Method" || name == "MethodFunc" || name == "Handle") && !strings.HasPrefix(path, "/") {
+				// chi Method("GET", "/path", h), gin Handle("GET", "/path", h)
+				method, path = strings.ToUpper(path), second
+			} else if m, rest, ok := strings.Cut(path, " "); ok && (name == "Handle" || name == "HandleFunc") {
+				// net/http patterns: "GET /path", "GET host/path"
+				i := strings.IndexByte(rest, '/')
+				if !slices.Contains(convert.StandardMethods, m) || i < 0 {
+					return true
+				}
+				method, path = m, strings.TrimSuffix(rest[i:], "{$}")
+			}
+			_, known := prefixes[recv]
+			if !strings.HasPrefix(path, "/") && !(path == "" && known) {
+				return true
+			}
+			s.routes = append(s.routes, scannedRoute{Method: method, Path: joinRoutePath(prefixes[recv], path), File: s.file, Line: s.fset.Position(n.Pos()).Line})
+		}
+		return true
+	})
+}
+
+// goSelectorCall splits a call recv.Name(...) into the receiver and name.
+func goSelectorCall(call *ast.CallExpr) (string, string, bool) {
+	sel, ok := call.Fun.(*ast.SelectorExpr)
+	if !ok || len(call.Args) == 0 {
+		return "", "", false
+	}
+	return goExprName(sel.X), sel.Sel.Name, true
+}
+
+// goExprName names a router variable or field, such as r or s.router.
+func goExprName(e ast.Expr) string {
+	switch e := e.(type) {
+	case *ast.Ident:
+		return e.Name
+	case *ast.SelectorExpr:
+		return goExprName(e.X) + "." + e.Sel.Name
+	}
+	return ""
+}
+
+// goStringArg returns the i-th argument of call if it is a string literal.
+func goStringArg(call *ast.CallExpr, i int) (string, bool) {
+	if i >= len(call.Args) {
+		return "", false
+	}
+	lit, ok := call.Args[i].(*ast.BasicLit)
+	if !ok || lit.Kind != token.STRING {
+		return "", false
+	}
+	s, err := strconv.Unquote(lit.Value)
+	return s, err == nil
+}
+
+var (
+	// javaAnnotation is an annotation at the start of a line, possibly
+	// qualified.
+	javaAnnotation = regexp.MustCompile(`^@([\w.]+)`)
+	// javaMappings maps the Spring mapping annotations to their method.
+	javaMappings = map[string]string{
+		"GetMapping": "GET", "PostMapping": "POST", "PutMapping": "PUT",
+		"DeleteMapping": "DELETE", "PatchMapping": "PATCH", "RequestMapping": "",
+	}
+	javaVerbs       = map[string]bool{"GET": true, "POST": true, "PUT": true, "DELETE": true, "PATCH": true, "HEAD": true, "OPTIONS": true}
+	javaNonPathArgs = regexp.MustCompile(`\b(produces|consumes|name|params|headers)\s*=\s*(\{[^}]*\}|"[^"]*")`)
+	javaString      = regexp.MustCompile(`"((?:[^"\\]|\\.)*)"`)
+	javaMethodArg   = regexp.MustCompile(`RequestMethod\.([A-Z]+)`)
+	javaType        = regexp.MustCompile(`\b(class|interface|object)\s+\w+`)
+)
+
+// javaAnnot is one annotation with its arguments.
+type javaAnnot struct {
+	Name string
+	Args string
+	Line int
+}
+
+// scanJava finds the Spring and JAX-RS routes of a Java or Kotlin file.
+// The annotations before a declaration are collected: on a class they set
+// the base path of its methods, on a method they declare its routes.
+func scanJava(file string, src []byte) ([]scannedRoute, error) {
+	var routes []scannedRoute
+	var pending []javaAnnot
+	var base []string
+	scanner := bufio.NewScanner(bytes.NewReader(src))
+	scanner.Buffer(nil, 1<<20)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := scanner.Text()
+		trimmed := strings.TrimSpace(text)
+		if trimmed == "" || strings.HasPrefix(trimmed, "//") || strings.HasPrefix(trimmed, "*") || strings.HasPrefix(trimmed, "/*") {
+			continue
+		}
+		// A line may carry several annotations, and the declaration they
+		// annotate after them.
+		rest := trimmed
+		for m := javaAnnotation.FindStringSubmatch(rest); m != nil; m = javaAnnotation.FindStringSubmatch(rest) {
+			name := m[1][strings.LastIndexByte(m[1], '.')+1:]
+			a := javaAnnot{Name: name, Line: line}
+			rest = strings.TrimSpace(rest[len(m[0]):])
+			if strings.HasPrefix(rest, "(") {
+				// Arguments may span several lines.
+				end := javaArgsEnd(rest)
+				for end < 0 && scanner.Scan() {
+					line++
+					rest += " " + strings.TrimSpace(scanner.Text())
+					end = javaArgsEnd(rest)
+				}
+				if end < 0 {
+					break
+				}
+				a.Args = rest[1:end]
+				rest = strings.TrimSpace(rest[end+1:])
+			}
+			pending = append(pending, a)
+		}
+		if rest == "" {
+			continue
+		}
+		if len(pending) == 0 {
+			continue
+		}
+		if javaType.MatchString(rest) {
+			base = nil
+			for _, a := range pending {
+				if a.Name == "RequestMapping" || a.Name == "Path" {
+					base = javaPaths(a.Args)
+				}
+			}
+		} else {
+			routes = append(routes, javaRoutes(file, pending, base)...)
+		}
+		pending = nil
+	}
+	return routes, scanner.Err()
+}
+
+// javaArgsEnd returns the index of the parenthesis closing the one s starts
+// with, outside of string literals, or -1 if s does not close it.
+func javaArgsEnd(s string) int {
+	depth, inString := 0, false
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case inString && c == '\\':
+			i++
+		case c == '"':
+			inString = !inString
+		case inString:
+		case c == '(':
+			depth++
+		case c == ')':
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// javaRoutes are the routes declared by the annotations of one method.
+func javaRoutes(file string, annots []javaAnnot, base []string) []scannedRoute {
+	if len(base) == 0 {
+		base = []string{""}
+	}
+	var routes []scannedRoute
+	add := func(methods, paths []string, line int) {
+		if len(methods) == 0 {
+			methods = []string{""}
+		}
+		if len(paths) == 0 {
+			paths = []string{""}
+		}
+		for _, b := range base {
+			for _, p := range paths {
+				for _, m := range methods {
+					routes = append(routes, scannedRoute{Method: m, Path: joinRoutePath(b, p), File: file, Line: line})
+				}
+			}
+		}
+	}
+	// JAX-RS: a resource method carries an HTTP method annotation and
+	// an optional @Path.
+	var jaxMethods, jaxPaths []string
+	jaxLine := 0
+	for _, a := range annots {
+		if method, ok := javaMappings[a.Name]; ok {
+			var methods []string
+			if method != "" {
+				methods = []string{method}
+			}
+			for _, m := range javaMethodArg.FindAllStringSubmatch(a.Args, -1) {
+				methods = append(methods, m[1])
+			}
+			add(methods, javaPaths(a.Args), a.Line)
+		}
+		if javaVerbs[a.Name] {
+			jaxMethods = append(jaxMethods, a.Name)
+			if jaxLine == 0 {
+				jaxLine = a.Line
+			}
+		}
+		if a.Name == "Path" {
+			jaxPaths = javaPaths(a.Args)
+		}
+	}
+	if len(jaxMethods) > 0 {
+		add(jaxMethods, jaxPaths, jaxLine)
+	}
+	return routes
+}
+
+// javaPaths returns the path strings of annotation arguments: the value
+// or path attribute, or the positional strings.
+func javaPaths(args string) []string {
+	args = javaNonPathArgs.ReplaceAllString(args, "")
+	var paths []string
+	for _, m := range javaString.FindAllStringSubmatch(args, -1) {
+		paths = append(paths, m[1])
+	}
+	return paths
+}
+
+var (
+	pythonRoute    = regexp.MustCompile(`^\s*@(\w+)\.route\(\s*(?:rule\s*=\s*)?['"]([^'"]*)['"](.*)`)
+	pythonVerb     = regexp.MustCompile(`^\s*@(\w+)\.(get|post|put|delete|patch|head|options)\(\s*(?:path\s*=\s*)?['"]([^'"]*)['"]`)
+	pythonMethods  = regexp.MustCompile(`methods\s*=\s*[\[\(]([^\]\)]*)`)
+	pythonWord     = regexp.MustCompile(`['"](\w+)['"]`)
+	pythonRouter   = regexp.MustCompile(`^\s*(\w+)\s*=\s*(?:\w+\.)*(?:Blueprint|APIRouter)\((.*)`)
+	pythonPrefixes = regexp.MustCompile(`\b(?:url_prefix|prefix)\s*=\s*['"]([^'"]*)['"]`)
+)
+
+// scanPython finds the Flask and FastAPI routes of a Python file, with the
+// url_prefix of Blueprints and the prefix of APIRouters created in it.
+func scanPython(file string, src []byte) ([]scannedRoute, error) {
+	var routes []scannedRoute
+	prefixes := make(map[string]string)
+	scanner := bufio.NewScanner(bytes.NewReader(src))
+	scanner.Buffer(nil, 1<<20)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := scanner.Text()
+		if m := pythonRouter.FindStringSubmatch(text); m != nil {
+			if p := pythonPrefixes.FindStringSubmatch(m[2]); p != nil {
+				prefixes[m[1]] = p[1]
+			}
+			continue
+		}
+		if m := pythonRoute.FindStringSubmatch(text); m != nil {
+			// Flask routes answer GET unless they list their methods.
+			methods := []string{"GET"}
+			if mm := pythonMethods.FindStringSubmatch(m[3]); mm != nil {
+				methods = nil
+				for _, w := range pythonWord.FindAllStringSubmatch(mm[1], -1) {
+					methods = append(methods, strings.ToUpper(w[1]))
+				}
+			}
+			for _, method := range methods {
+				routes = append(routes, scannedRoute{Method: method, Path: joinRoutePath(prefixes[m[1]], m[2]), File: file, Line: line})
+			}
+			continue
+		}
+		if m := pythonVerb.FindStringSubmatch(text); m != nil {
+			routes = append(routes, scannedRoute{Method: strings.ToUpper(m[2]), Path: joinRoutePath(prefixes[m[1]], m[3]), File: file, Line: line})
+		}
+	}
+	return routes, scanner.Err()
+}
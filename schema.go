@@ -0,0 +1,243 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/arencloud/csv2httproute/pkg/convert"
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+)
+
+// currentSchemaVersion is the inventory format version this build writes and
+// understands. Adding optional columns does not bump it; renaming or removing
+// columns does, together with an entry in schemaMigrations.
+const currentSchemaVersion = 1
+
+// schemaMigrations maps a version to the column renames that bring a file of
+// that version to the next one.
+var schemaMigrations = map[int]map[string]string{}
+
+// schemaRowPrefix starts the optional first row declaring a file's version,
+// e.g. "#schema: 1".
+const schemaRowPrefix = "#schema:"
+
+// Column types accepted in sidecar schema files.
+var columnTypes = map[string]func(string) error{
+	"string": func(string) error { return nil },
+	"int": func(v string) error {
+		_, err := strconv.Atoi(v)
+		return err
+	},
+	"bool": func(v string) error {
+		_, err := strconv.ParseBool(v)
+		return err
+	},
+	"path": func(v string) error {
+		if !strings.HasPrefix(v, "/") {
+			return fmt.Errorf("must start with /")
+		}
+		return nil
+	},
+	"method": func(v string) error {
+		_, err := normalizeMethod(v)
+		return err
+	},
+}
+
+// inventorySchema declares the format of an inventory, either through a
+// schema row or a <file>.schema.yaml sidecar.
+type inventorySchema struct {
+	Version int                   `yaml:"version"`
+	Columns map[string]columnSpec `yaml:"columns,omitempty"`
+}
+
+type columnSpec struct {
+	Type     string `yaml:"type,omitempty"`
+	Required bool   `yaml:"required,omitempty"`
+}
+
+// sidecarSchemaPath returns the schema file that accompanies a CSV. It is
+// built on the text of the path so the names of fetched inputs keep their
+// scheme.
+func sidecarSchemaPath(csvPath string) string {
+	return csvPath[:len(csvPath)-len(filepath.Base(csvPath))] + csvBaseName(csvPath) + ".schema.yaml"
+}
+
+// loadSidecarSchema reads the sidecar schema of csvPath, or returns nil when
+// there is none.
+func loadSidecarSchema(ctx context.Context, csvPath string) (*inventorySchema, error) {
+	path := sidecarSchemaPath(csvPath)
+	data, err := readInput(ctx, path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var schema inventorySchema
+	if err := yaml.Unmarshal(data, &schema); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	for name, col := range schema.Columns {
+		if col.Type != "" && columnTypes[col.Type] == nil {
+			return nil, fmt.Errorf("%s: column %s has unknown type %q", path, name, col.Type)
+		}
+	}
+	return &schema, nil
+}
+
+// parseSchemaRow recognizes a "#schema: N" row and returns its version.
+func parseSchemaRow(record []string) (int, bool, error) {
+	if len(record) == 0 {
+		return 0, false, nil
+	}
+	cell := strings.TrimSpace(record[0])
+	if !strings.HasPrefix(strings.ToLower(cell), schemaRowPrefix) {
+		return 0, false, nil
+	}
+	v, err := strconv.Atoi(strings.TrimSpace(cell[len(schemaRowPrefix):]))
+	if err != nil {
+		return 0, true, fmt.Errorf("invalid schema row %q", cell)
+	}
+	return v, true, nil
+}
+
+// migrateHeader checks a declared version and rewrites header names from
+// older versions to the current one. It returns the renames applied.
+func migrateHeader(version int, header []string) (map[string]string, error) {
+	if version < 1 {
+		return nil, fmt.Errorf("invalid schema version %d", version)
+	}
+	if version > currentSchemaVersion {
+		return nil, fmt.Errorf("schema version %d requires a newer csv2httproute (supports up to %d)", version, currentSchemaVersion)
+	}
+	applied := make(map[string]string)
+	for v := version; v < currentSchemaVersion; v++ {
+		for i, h := range header {
+			if to, ok := schemaMigrations[v][convert.CanonicalColumn(h)]; ok {
+				header[i] = to
+				applied[h] = to
+			}
+		}
+	}
+	return applied, nil
+}
+
+// checkColumns validates the header of a file that declares a schema: every
+// column must be known and every required column present.
+func (s *inventorySchema) checkColumns(header []string, headerMap map[string]int) error {
+	if unknown := convert.UnknownColumns(header); unknown != "" {
+		return fmt.Errorf("unknown columns for schema version %d: %s", s.Version, unknown)
+	}
+	if _, ok := headerMap["url"]; !ok {
+		return fmt.Errorf("missing required column url")
+	}
+	for name, col := range s.Columns {
+		if _, ok := headerMap[convert.CanonicalColumn(name)]; col.Required && !ok {
+			return fmt.Errorf("missing required column %s", name)
+		}
+	}
+	return nil
+}
+
+// checkRecord validates the typed and required columns of one row.
+func (s *inventorySchema) checkRecord(record []string, headerMap map[string]int) error {
+	for name, col := range s.Columns {
+		idx, ok := headerMap[convert.CanonicalColumn(name)]
+		value := ""
+		if ok && idx < len(record) {
+			value = strings.TrimSpace(record[idx])
+		}
+		if value == "" {
+			if col.Required {
+				return fmt.Errorf("column %s is required", name)
+			}
+			continue
+		}
+		if check := columnTypes[col.Type]; check != nil {
+			if err := check(value); err != nil {
+				return fmt.Errorf("column %s: invalid %s %q: %v", name, col.Type, value, err)
+			}
+		}
+	}
+	return nil
+}
+
+func newSchemaCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "schema",
+		Short: "Inspect and migrate inventory schema versions",
+	}
+	cmd.AddCommand(&cobra.Command{
+		Use:   "migrate FILE...",
+		Short: "Rewrite CSV files to the current schema version",
+		Long: `Applies the column renames between each file's declared schema version and the
+current one, then rewrites the file with an up-to-date "#schema:" row. Files
+without a schema row are treated as version 1.`,
+		Args: cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			for _, path := range args {
+				if err := migrateFile(path); err != nil {
+					return fmt.Errorf("%s: %w", path, err)
+				}
+			}
+			return nil
+		},
+	})
+	return cmd
+}
+
+// migrateFile rewrites path in the current schema version.
+func migrateFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	if isEncrypted(data) {
+		return fmt.Errorf("encrypted inventories cannot be migrated in place; decrypt, migrate and re-encrypt it")
+	}
+	reader := csv.NewReader(bytes.NewReader(data))
+	reader.FieldsPerRecord = -1
+	reader.LazyQuotes = true
+	records, err := reader.ReadAll()
+	if err != nil {
+		return err
+	}
+	if len(records) == 0 {
+		return fmt.Errorf("file is empty")
+	}
+
+	version := 1
+	if v, ok, err := parseSchemaRow(records[0]); err != nil {
+		return err
+	} else if ok {
+		version = v
+		records = records[1:]
+	}
+	if len(records) == 0 {
+		return fmt.Errorf("missing header row")
+	}
+	applied, err := migrateHeader(version, records[0])
+	if err != nil {
+		return err
+	}
+
+	var buf bytes.Buffer
+	writer := csv.NewWriter(&buf)
+	_ = writer.Write([]string{fmt.Sprintf("%s %d", schemaRowPrefix, currentSchemaVersion)})
+	if err := writer.WriteAll(records); err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, buf.Bytes(), 0666); err != nil {
+		return err
+	}
+	fmt.Printf("Migrated %s from version %d to %d (%d column(s) renamed)\n", path, version, currentSchemaVersion, len(applied))
+	return nil
+}
@@ -0,0 +1,261 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/arencloud/csv2httproute/pkg/convert"
+	"github.com/spf13/cobra"
+)
+
+var (
+	// scrubOutput is the --output of scrub, kept apart from that of the
+	// generated files for its own default.
+	scrubOutput string
+	// scrubSalt is --salt, the key of the pseudonyms.
+	scrubSalt string
+)
+
+func newScrubCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "scrub",
+		Short: "Export a copy of the CSV inventory with hostnames, services and comments pseudonymized",
+		Long: `Writes a copy of every CSV under --input to --output with the internal details
+replaced by pseudonyms, so a problematic inventory can be attached to a bug
+report. Replaced are:
+
+  - hostnames, in the hostname column, redirect targets and "#! hostname="
+    directives, label by label, so api.example.com becomes something like
+    h-3f2a1c9e.h-9b8d7e01.invalid and stays under *.h-9b8d7e01.invalid
+  - service names and namespaces, in the service, service_namespace,
+    backends and fallback columns and their directives, keeping the ports
+    and weights
+  - the comment and description columns and # comment lines
+
+Pseudonyms are consistent: the same value gets the same pseudonym in every
+file and every run with the same --salt, so rows sharing a service or host
+still do after scrubbing. Paths, methods, matches and all other columns are
+kept, since conversion bugs are usually about them. Encrypted inventories
+are decrypted first, and the copies are written in plain text.`,
+		Args: cobra.NoArgs,
+		RunE: runScrub,
+	}
+	flags := cmd.Flags()
+	flags.StringVarP(&inputDir, "input", "i", "facts/endpoints", "Directory, CSV file or glob pattern of the inventory to scrub")
+	flags.BoolVar(&recursive, "recursive", false, "Also scrub the CSVs in the subdirectories of the --input directory, into the same subdirectories of --output")
+	flags.StringVarP(&scrubOutput, "output", "o", "scrubbed", "Directory the scrubbed copies are written to")
+	flags.StringVar(&scrubSalt, "salt", "", "Secret key of the pseudonyms; without one, short names can be recovered by hashing guesses")
+	flags.StringVar(&csvDelimiter, "delimiter", ",", "Field separator of the input CSVs: one character such as ; or |, or tab")
+	flags.StringSliceVar(&columnMap, "column-map", nil, "Header cells holding columns under other names, as column=header (e.g. method=verb,url=path); with --no-header, column=position from 1")
+	flags.BoolVar(&noHeader, "no-header", false, "The input CSVs have no header row; columns are method,url,prefix,comment by position, or as --column-map assigns them")
+	flags.BoolVarP(&quiet, "quiet", "q", false, "Do not print a line for every scrubbed file")
+	return cmd
+}
+
+func runScrub(cmd *cobra.Command, args []string) error {
+	if err := validateDialect(); err != nil {
+		return err
+	}
+	files, _, err := inputFiles(cmd.Context())
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(scrubOutput, 0755); err != nil {
+		return err
+	}
+	for _, path := range files {
+		data, err := scrubCSV(cmd.Context(), path)
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		outPath := filepath.Join(scrubOutput, scrubName(path))
+		if err := os.MkdirAll(filepath.Dir(outPath), 0755); err != nil {
+			return err
+		}
+		if err := writeOutputFile(outPath, data); err != nil {
+			return err
+		}
+		if !quiet {
+			fmt.Printf("Scrubbed %s to %s\n", path, outPath)
+		}
+	}
+	return nil
+}
+
+// scrubName is the path of the copy of path below --output: its path below
+// the --input directory, without the .age suffix of encrypted inventories.
+func scrubName(path string) string {
+	if sourceScheme(inputDir) == "" {
+		if rel, err := filepath.Rel(inputDir, path); err == nil && rel != "." && !strings.HasPrefix(rel, "..") {
+			return plainName(rel)
+		}
+	}
+	return filepath.Base(plainName(path))
+}
+
+// scrubCSV returns the rows of path with their hostnames, service names and
+// comments pseudonymized. The header and schema rows are kept as they are.
+func scrubCSV(ctx context.Context, path string) ([]byte, error) {
+	data, err := readInput(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+	reader := newCSVReader(bytes.NewReader(data))
+	reader.LazyQuotes = true
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	var columns []string
+	if noHeader {
+		columns = positionalHeader()
+	}
+	for i, record := range records {
+		switch {
+		case isDirectiveRow(record):
+			records[i] = scrubDirective(record)
+		case len(record) > 0 && strings.HasPrefix(strings.TrimSpace(record[0]), schemaRowPrefix):
+		case len(record) > 0 && strings.HasPrefix(strings.TrimSpace(record[0]), "#"):
+			records[i] = []string{"# " + pseudonym("text", strings.Join(record, string(delimiter)))}
+		case columns == nil:
+			columns = mapHeader(record)
+			for j, h := range columns {
+				columns[j] = convert.CanonicalColumn(h)
+			}
+		default:
+			for j := range record {
+				if j < len(columns) {
+					record[j] = scrubCell(columns[j], record[j])
+				}
+			}
+		}
+	}
+	var buf bytes.Buffer
+	writer := csv.NewWriter(&buf)
+	writer.Comma = delimiter
+	if err := writer.WriteAll(records); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// scrubDirective pseudonymizes the values of the key=value pairs of a "#!"
+// directive row, which it joins into one field like directives.apply.
+func scrubDirective(record []string) []string {
+	text := strings.TrimPrefix(strings.TrimSpace(strings.Join(record, string(delimiter))), "#!")
+	words := strings.Fields(strings.TrimRight(text, string(delimiter)))
+	for i, w := range words {
+		if key, value, ok := strings.Cut(w, "="); ok {
+			words[i] = key + "=" + scrubCell(convert.CanonicalColumn(key), value)
+		}
+	}
+	return []string{"#! " + strings.Join(words, " ")}
+}
+
+// scrubCell pseudonymizes the value of a cell of column.
+func scrubCell(column, value string) string {
+	v := strings.TrimSpace(value)
+	if v == "" {
+		return value
+	}
+	switch column {
+	case "hostname":
+		hosts := strings.Split(v, ";")
+		for i, h := range hosts {
+			hosts[i] = pseudonymHost(strings.TrimSpace(h))
+		}
+		return strings.Join(hosts, ";")
+	case "service":
+		return pseudonym("svc", v)
+	case "service_namespace":
+		return pseudonym("ns", v)
+	case "fallback":
+		return scrubBackend(v)
+	case "backends":
+		entries := strings.Split(v, ";")
+		for i, entry := range entries {
+			entries[i] = scrubBackend(strings.TrimSpace(entry))
+		}
+		return strings.Join(entries, ";")
+	case "redirect":
+		return scrubRedirect(v)
+	case "comment", "description":
+		return pseudonym("text", v)
+	}
+	return value
+}
+
+// scrubBackend pseudonymizes the service of a service[:port[:weight]]
+// backend entry.
+func scrubBackend(entry string) string {
+	if entry == "" {
+		return entry
+	}
+	service, rest, ok := strings.Cut(entry, ":")
+	if !ok {
+		return pseudonym("svc", service)
+	}
+	return pseudonym("svc", service) + ":" + rest
+}
+
+// scrubRedirect pseudonymizes the hostname of a redirect target, keeping its
+// status code, scheme, port and path.
+func scrubRedirect(v string) string {
+	status, target := "", v
+	if code, rest, ok := strings.Cut(v, " "); ok {
+		status, target = code+" ", strings.TrimSpace(rest)
+	}
+	u, err := url.Parse(target)
+	if err != nil || u.Hostname() == "" {
+		return v
+	}
+	host := pseudonymHost(u.Hostname())
+	if port := u.Port(); port != "" {
+		host += ":" + port
+	}
+	u.Host = host
+	return status + u.String()
+}
+
+// pseudonymHost replaces every label of hostname but a leading wildcard,
+// with the top-level domain becoming invalid, so the hostnames keep their
+// depth and the domains they share.
+func pseudonymHost(hostname string) string {
+	if hostname == "" {
+		return hostname
+	}
+	labels := strings.Split(strings.ToLower(hostname), ".")
+	wildcard := labels[0] == "*"
+	if wildcard {
+		labels = labels[1:]
+	}
+	if len(labels) > 1 {
+		labels = labels[:len(labels)-1]
+	}
+	for i, l := range labels {
+		labels[i] = pseudonym("h", l)
+	}
+	if wildcard {
+		labels = slices.Insert(labels, 0, "*")
+	}
+	return strings.Join(append(labels, "invalid"), ".")
+}
+
+// pseudonym is the consistent replacement of value: prefix, which keeps the
+// kinds of values apart, and a hash of value keyed by --salt. Prefixes of
+// letters keep service names valid DNS labels.
+func pseudonym(prefix, value string) string {
+	mac := hmac.New(sha256.New, []byte(scrubSalt))
+	mac.Write([]byte(prefix + "\x00" + value))
+	return prefix + "-" + hex.EncodeToString(mac.Sum(nil))[:8]
+}
@@ -0,0 +1,268 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/spf13/cobra"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+var (
+	// serveListen is --listen, the address the conversion endpoint listens
+	// on.
+	serveListen string
+	// serveMaxUpload is --max-upload, the largest request body accepted, in
+	// bytes.
+	serveMaxUpload int64
+)
+
+// serving is set by serve, whose conversions are not reproducible from the
+// command line.
+var serving bool
+
+// serveMu serializes conversions, which share the flag and run state of
+// the process.
+var serveMu sync.Mutex
+
+func newServeCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "serve",
+		Short: "Convert uploaded CSVs to routes over HTTP",
+		Long: `Listens on --listen and converts the CSV of every POST /convert request,
+returning the generated YAML as one multi-document stream. The CSV is the
+request body, sent as text/csv or as the "file" field of a multipart form.
+
+The generate flags apply to every conversion. The query parameters service,
+port, gateway, namespace and hostname override --service, --port, --gateway,
+--namespace and --hostname for one request, and name names the route of a
+text/csv body (default "upload"). Nothing is written to disk besides
+temporary files, and side outputs such as signing, --apply and the history
+are turned off.
+
+GET /healthz answers 200 once the server is up.`,
+		Args: cobra.NoArgs,
+		RunE: runServe,
+	}
+	cmd.Flags().StringVarP(&serviceName, "service", "s", "my-service", "Default backend service name")
+	cmd.Flags().IntVarP(&servicePort, "port", "p", 80, "Default backend service port")
+	cmd.Flags().StringVar(&serveListen, "listen", ":8080", "Address to listen on, host:port")
+	cmd.Flags().Int64Var(&serveMaxUpload, "max-upload", 10<<20, "Largest accepted request body in bytes")
+	addGenerateFlags(cmd.Flags(), "generated")
+	return cmd
+}
+
+func runServe(cmd *cobra.Command, args []string) error {
+	if serveMaxUpload <= 0 {
+		return fmt.Errorf("invalid --max-upload %d (must be positive)", serveMaxUpload)
+	}
+	generateOnly()
+	serving = true
+	// Fail invalid flags before listening
+	if err := prepareGeneration(cmd.Context()); err != nil {
+		return err
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /healthz", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, "ok")
+	})
+	mux.HandleFunc("POST /convert", func(w http.ResponseWriter, r *http.Request) {
+		serveConvert(cmd, w, r)
+	})
+	server := &http.Server{Addr: serveListen, Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+
+	ctx := cmd.Context()
+	done := make(chan error, 1)
+	go func() {
+		<-ctx.Done()
+		shutdown, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		done <- server.Shutdown(shutdown)
+	}()
+	fmt.Fprintf(os.Stderr, "Listening on %s\n", serveListen)
+	if err := server.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return <-done
+}
+
+// badRequestError is an error of the request rather than of its CSV.
+type badRequestError struct{ error }
+
+func badRequest(format string, args ...any) error {
+	return badRequestError{fmt.Errorf(format, args...)}
+}
+
+// serveConvert answers one conversion: 400 for an unusable request, 422 for
+// a CSV that fails to convert, and the YAML stream otherwise.
+func serveConvert(cmd *cobra.Command, w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, serveMaxUpload)
+	name, data, err := readUpload(r)
+	if err == nil {
+		var out []byte
+		if out, err = convertUpload(cmd, r, name, data); err == nil {
+			w.Header().Set("Content-Type", "application/yaml")
+			w.Write(out)
+			return
+		}
+	}
+	status := http.StatusUnprocessableEntity
+	var tooLarge *http.MaxBytesError
+	switch {
+	case errors.As(err, &tooLarge):
+		status = http.StatusRequestEntityTooLarge
+	case errors.As(err, new(badRequestError)):
+		status = http.StatusBadRequest
+	}
+	http.Error(w, err.Error(), status)
+}
+
+// readUpload returns the input file name and content of a request: the
+// "file" field of a multipart form, or a text/csv body named by the name
+// query parameter.
+func readUpload(r *http.Request) (string, []byte, error) {
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil && r.Header.Get("Content-Type") != "" {
+		return "", nil, badRequestError{err}
+	}
+	switch mediaType {
+	case "multipart/form-data":
+		file, header, err := r.FormFile("file")
+		if err != nil {
+			return "", nil, badRequest("no \"file\" field in the form: %v", err)
+		}
+		defer file.Close()
+		data, err := io.ReadAll(file)
+		if err != nil {
+			return "", nil, err
+		}
+		// Browsers may send a client path; the route is named after the base
+		name := path.Base(filepath.ToSlash(header.Filename))
+		if !isInputFile(name) {
+			return "", nil, badRequest("uploaded file %q must be %s", header.Filename, inputFileKind())
+		}
+		return name, data, nil
+	case "", "text/csv", "text/plain", "application/octet-stream":
+		data, err := io.ReadAll(r.Body)
+		if err != nil {
+			return "", nil, err
+		}
+		base := r.URL.Query().Get("name")
+		if base == "" {
+			base = "upload"
+		}
+		if strings.ContainsAny(base, `/\`) || strings.HasPrefix(base, ".") {
+			return "", nil, badRequest("invalid name %q", base)
+		}
+		return inputFileName(base), data, nil
+	}
+	return "", nil, badRequest("unsupported Content-Type %q (want text/csv or multipart/form-data)", mediaType)
+}
+
+// convertUpload generates the routes of one uploaded file into a scratch
+// directory, with the query parameters of r overriding their flags, and
+// returns the YAML files as one stream, as --output - prints them.
+func convertUpload(cmd *cobra.Command, r *http.Request, name string, data []byte) ([]byte, error) {
+	serveMu.Lock()
+	defer serveMu.Unlock()
+
+	defer saveServeFlags()()
+	if err := applyServeQuery(r); err != nil {
+		return nil, err
+	}
+
+	tmp, err := os.MkdirTemp("", "csv2httproute-serve-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(tmp)
+
+	resetRunState()
+	fetchedFiles[name] = data
+	openedSources[name] = &fetchedSource{files: []string{name}, single: true}
+	inputDir, outputDir, existingOutputDir = name, tmp, tmp
+	defer func() { existingOutputDir = "" }()
+	ctx := cmd.Context()
+	cmd.SetContext(r.Context())
+	err = generate(cmd)
+	cmd.SetContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	files, err := readTree(tmp)
+	if err != nil {
+		return nil, err
+	}
+	var out []byte
+	for _, file := range slices.Sorted(maps.Keys(files)) {
+		if ext := path.Ext(file); ext != ".yaml" && ext != ".yml" {
+			continue
+		}
+		if len(out) > 0 {
+			out = append(out, "---\n"...)
+		}
+		out = append(out, files[file]...)
+	}
+	return out, nil
+}
+
+// saveServeFlags saves the flags a conversion changes, from the query
+// parameters and from resolving --gateway, and returns the function that
+// restores them, so that no request sees those of an earlier one.
+func saveServeFlags() func() {
+	svc, port, gw, gwNS, section, ns, host, input, output := serviceName, servicePort, gatewayName, gatewayNamespace, gatewaySection, namespace, hostname, inputDir, outputDir
+	primary, gateways, parents := primarySection, slices.Clone(extraGateways), slices.Clone(extraParents)
+	return func() {
+		serviceName, servicePort, gatewayName, gatewayNamespace, gatewaySection, namespace, hostname, inputDir, outputDir = svc, port, gw, gwNS, section, ns, host, input, output
+		primarySection, extraGateways, extraParents = primary, gateways, parents
+	}
+}
+
+// applyServeQuery sets the flags the query parameters of r override.
+func applyServeQuery(r *http.Request) error {
+	query := r.URL.Query()
+	if v := query.Get("service"); v != "" {
+		if errs := validation.IsDNS1123Label(v); len(errs) > 0 {
+			return badRequest("invalid service %q: %s", v, strings.Join(errs, "; "))
+		}
+		serviceName = v
+	}
+	if v := query.Get("port"); v != "" {
+		p, err := strconv.Atoi(v)
+		if err != nil || p < 1 || p > 65535 {
+			return badRequest("invalid port %q (want 1-65535)", v)
+		}
+		servicePort = p
+	}
+	if v := query.Get("gateway"); v != "" {
+		if _, err := parseGatewayRef(v); err != nil {
+			return badRequestError{err}
+		}
+		gatewayName = v
+	}
+	if v := query.Get("namespace"); v != "" {
+		if errs := validation.IsDNS1123Label(v); len(errs) > 0 {
+			return badRequest("invalid namespace %q: %s", v, strings.Join(errs, "; "))
+		}
+		namespace = v
+	}
+	if v := query.Get("hostname"); v != "" {
+		hostname = v
+	}
+	return nil
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"context"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestServeRequestsDoNotLeak(t *testing.T) {
+	root := newRootCmd()
+	cmd, _, err := root.Find([]string{"serve"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cmd.ParseFlags(nil); err != nil {
+		t.Fatal(err)
+	}
+	defer generateOnlyFor()()
+	defer func() { serving = false }()
+	serving = true
+	if err := prepareGeneration(context.Background()); err != nil {
+		t.Fatalf("prepareGeneration: %v", err)
+	}
+	cmd.SetContext(context.Background())
+
+	convert := func(query string) string {
+		t.Helper()
+		req := httptest.NewRequest("POST", "/convert"+query, strings.NewReader("Method,URL\nGET,/orders\n"))
+		req.Header.Set("Content-Type", "text/csv")
+		rec := httptest.NewRecorder()
+		serveConvert(cmd, rec, req)
+		if rec.Code != 200 {
+			t.Fatalf("POST /convert%s: %d %s", query, rec.Code, rec.Body)
+		}
+		return rec.Body.String()
+	}
+	if out := convert("?gateway=public:infra:https"); !strings.Contains(out, "namespace: infra") || !strings.Contains(out, "sectionName: https") {
+		t.Fatalf("route of ?gateway=public:infra:https is not attached to it:\n%s", out)
+	}
+	out := convert("")
+	if strings.Contains(out, "infra") || strings.Contains(out, "sectionName") || !strings.Contains(out, "name: my-gateway") {
+		t.Errorf("route of a plain request kept the gateway of the one before:\n%s", out)
+	}
+}
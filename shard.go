@@ -0,0 +1,58 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/arencloud/csv2httproute/pkg/convert"
+)
+
+var (
+	// matchesPerRuleLimit is --max-matches-per-rule: direct-match rules with
+	// more matches are split. It defaults to the limit of the CRDs before
+	// Gateway API v1.2, so the routes apply on every cluster.
+	matchesPerRuleLimit int
+	// rulesPerRouteLimit is --max-rules-per-route: routes with more rules are
+	// sharded into routes named -1, -2, and so on.
+	rulesPerRouteLimit int
+)
+
+func validateRouteLimits() error {
+	if matchesPerRuleLimit < 1 || matchesPerRuleLimit > convert.MaxMatchesPerRule {
+		return fmt.Errorf("invalid --max-matches-per-rule %d (must be 1-%d)", matchesPerRuleLimit, convert.MaxMatchesPerRule)
+	}
+	if rulesPerRouteLimit < 1 || rulesPerRouteLimit > convert.MaxRulesPerRoute {
+		return fmt.Errorf("invalid --max-rules-per-route %d (must be 1-%d)", rulesPerRouteLimit, convert.MaxRulesPerRoute)
+	}
+	return nil
+}
+
+// shardRoute splits gr into routes within --max-rules-per-route and the
+// match limit of a route. Each shard keeps the endpoints its matches came
+// from, so per-route outputs such as backend hints are not duplicated.
+func shardRoute(gr generatedRoute) []generatedRoute {
+	shards := convert.Shard(gr.Route, rulesPerRouteLimit)
+	if len(shards) == 1 {
+		return []generatedRoute{gr}
+	}
+	lineShard := make(map[int]int)
+	for i, shard := range shards {
+		for _, rule := range shard.Spec.Rules {
+			for _, m := range rule.Matches {
+				for _, line := range m.SourceLines {
+					if _, ok := lineShard[line]; !ok {
+						lineShard[line] = i
+					}
+				}
+			}
+		}
+	}
+	routes := make([]generatedRoute, len(shards))
+	for i, shard := range shards {
+		routes[i].Route = shard
+	}
+	for _, e := range gr.Endpoints {
+		i := lineShard[e.Line]
+		routes[i].Endpoints = append(routes[i].Endpoints, e)
+	}
+	return routes
+}
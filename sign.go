@@ -0,0 +1,234 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+// Generated files can be signed with detached signatures so an admission
+// pipeline can require that applied routes came from the sanctioned
+// generator. Signing is delegated to cosign or gpg, which own the key
+// material (local keys, KMS URIs, keyless OIDC, or a GPG keyring).
+
+const (
+	signCosign = "cosign"
+	signGPG    = "gpg"
+
+	cosignBundleExt = ".sigstore.json"
+	gpgSignatureExt = ".asc"
+)
+
+var (
+	signTool string
+	signKey  string
+
+	verifyKey            string
+	verifyCertIdentity   string
+	verifyCertOIDCIssuer string
+)
+
+// writtenFiles lists every file created in outputDir during this run, in
+// creation order, so they can be signed once generation finishes.
+var writtenFiles []string
+
+func validateSignTool(tool string) error {
+	switch tool {
+	case signCosign:
+		// Keyless signing gets its certificate from Fulcio, and KMS keys
+		// sign in their KMS.
+		if signKey == "" {
+			return checkOffline("--sign cosign without --sign-key")
+		}
+		if strings.Contains(signKey, "://") {
+			return checkOffline("--sign-key " + signKey)
+		}
+		return nil
+	case "", signGPG:
+		return nil
+	}
+	return fmt.Errorf("invalid --sign %q: must be %s or %s", tool, signCosign, signGPG)
+}
+
+// signatureExt is the sidecar extension tool writes next to a signed file.
+func signatureExt(tool string) string {
+	if tool == signGPG {
+		return gpgSignatureExt
+	}
+	return cosignBundleExt
+}
+
+func isSignatureFile(name string) bool {
+	return strings.HasSuffix(name, cosignBundleExt) || strings.HasSuffix(name, gpgSignatureExt)
+}
+
+// signOutputs writes a detached signature for every file generated in this run.
+func signOutputs(ctx context.Context) error {
+	for _, path := range writtenFiles {
+		sig := path + signatureExt(signTool)
+		var args []string
+		switch signTool {
+		case signCosign:
+			args = []string{"sign-blob", "--yes", "--bundle", sig}
+			if signKey != "" {
+				args = append(args, "--key", signKey)
+			}
+			if offline {
+				args = append(args, "--tlog-upload=false")
+			}
+		case signGPG:
+			args = []string{"--batch", "--yes", "--armor", "--detach-sign", "--output", sig}
+			if signKey != "" {
+				args = append(args, "--local-user", signKey)
+			}
+		}
+		if _, err := runSigner(ctx, signTool, append(args, path)...); err != nil {
+			return fmt.Errorf("failed to sign %s: %w", path, err)
+		}
+		if err := applyOutputPermissions(sig); err != nil {
+			return err
+		}
+		if !quiet {
+			fmt.Printf("Signed %s\n", path)
+		}
+	}
+	return nil
+}
+
+// runSigner runs a signing tool and returns its stdout, folding stderr into
+// the error on failure.
+func runSigner(ctx context.Context, tool string, args ...string) ([]byte, error) {
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, tool, args...)
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if errors.Is(err, exec.ErrNotFound) {
+		return nil, fmt.Errorf("%s was not found in PATH", tool)
+	}
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return nil, errors.New(msg)
+		}
+		return nil, err
+	}
+	return out, nil
+}
+
+func newVerifyCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "verify [DIR|FILE]...",
+		Short: "Verify the detached signatures of generated manifests",
+		Long: `Checks every generated file against the signature written next to it by
+--sign. A file without a signature fails verification, so a directory only
+passes if all of its manifests were produced by a signing run.
+
+cosign bundles (*.sigstore.json) are verified with --key, or for keyless
+signatures with --certificate-identity and --certificate-oidc-issuer. GPG
+signatures (*.asc) are verified against the local keyring; --key pins the
+signing key fingerprint.`,
+		RunE: runVerify,
+	}
+	cmd.Flags().StringVar(&verifyKey, "key", "", "cosign public key or KMS URI, or GPG key fingerprint to require")
+	cmd.Flags().StringVar(&verifyCertIdentity, "certificate-identity", "", "Expected signer identity for keyless cosign signatures")
+	cmd.Flags().StringVar(&verifyCertOIDCIssuer, "certificate-oidc-issuer", "", "Expected OIDC issuer for keyless cosign signatures")
+	return cmd
+}
+
+func runVerify(cmd *cobra.Command, args []string) error {
+	if len(args) == 0 {
+		args = []string{"generated"}
+	}
+	files, err := signedFiles(args)
+	if err != nil {
+		return err
+	}
+	failed := 0
+	for _, path := range files {
+		if err := verifyFile(cmd.Context(), path); err != nil {
+			fmt.Fprintf(os.Stderr, "FAIL %s: %v\n", path, err)
+			failed++
+			continue
+		}
+		fmt.Printf("OK   %s\n", path)
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d file(s) failed verification", failed, len(files))
+	}
+	return nil
+}
+
+// signedFiles expands args into the generated files to verify, including
+// --partition-by subdirectories, skipping the signatures themselves.
+func signedFiles(args []string) ([]string, error) {
+	var files []string
+	for _, arg := range args {
+		info, err := os.Stat(arg)
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			files = append(files, arg)
+			continue
+		}
+		err = filepath.WalkDir(arg, func(path string, d os.DirEntry, err error) error {
+			if err == nil && d.Type().IsRegular() && !isSignatureFile(d.Name()) {
+				files = append(files, path)
+			}
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+func verifyFile(ctx context.Context, path string) error {
+	if _, err := os.Stat(path + cosignBundleExt); err == nil {
+		args := []string{"verify-blob", "--bundle", path + cosignBundleExt}
+		if offline {
+			args = append(args, "--offline")
+		}
+		if verifyKey != "" {
+			args = append(args, "--key", verifyKey)
+		} else {
+			args = append(args, "--certificate-identity", verifyCertIdentity, "--certificate-oidc-issuer", verifyCertOIDCIssuer)
+		}
+		_, err := runSigner(ctx, signCosign, append(args, path)...)
+		return err
+	}
+	if _, err := os.Stat(path + gpgSignatureExt); err == nil {
+		out, err := runSigner(ctx, signGPG, "--batch", "--status-fd", "1", "--verify", path+gpgSignatureExt, path)
+		if err != nil {
+			return err
+		}
+		if verifyKey != "" && !gpgSignedBy(out, verifyKey) {
+			return fmt.Errorf("not signed by %s", verifyKey)
+		}
+		return nil
+	}
+	return errors.New("no signature found")
+}
+
+// gpgSignedBy reports whether gpg status output contains a valid signature
+// from the key whose fingerprint (or primary key fingerprint) ends in key.
+func gpgSignedBy(status []byte, key string) bool {
+	key = strings.ToUpper(strings.ReplaceAll(key, " ", ""))
+	for _, line := range strings.Split(string(status), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) >= 3 && fields[0] == "[GNUPG:]" && fields[1] == "VALIDSIG" &&
+			(strings.HasSuffix(fields[2], key) || strings.HasSuffix(fields[len(fields)-1], key)) {
+			return true
+		}
+	}
+	return false
+}
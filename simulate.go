@@ -0,0 +1,314 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"maps"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/arencloud/csv2httproute/pkg/router"
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+)
+
+var (
+	trafficFile     string
+	failOnUnmatched bool
+)
+
+func newSimulateCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "simulate",
+		Short: "Replay a traffic file against the generated routes in memory",
+		Long: `Builds the routes from the CSV inventory without writing them and replays every
+request in --traffic against them using Gateway API match precedence. Reports
+the match rate, every unmatched request, and rules that were never hit.
+
+Each traffic line is "METHOD PATH", "METHOD URL", or just "PATH" (GET); a URL of
+the form http://host/path also selects the hostname, and a query string the
+query parameters. Fields after the path of the form Name:value are request
+headers. Blank lines and lines starting with # are ignored.`,
+		RunE: runSimulate,
+	}
+	cmd.Flags().StringVarP(&serviceName, "service", "s", "my-service", "Default backend service name")
+	cmd.Flags().IntVarP(&servicePort, "port", "p", 80, "Default backend service port")
+	cmd.Flags().StringVarP(&trafficFile, "traffic", "t", "", "File listing the requests to replay")
+	cmd.Flags().BoolVar(&failOnUnmatched, "fail-on-unmatched", false, "Exit non-zero if any request matches no rule")
+	addGenerateFlags(cmd.Flags(), "generated")
+	_ = cmd.MarkFlagRequired("traffic")
+	return cmd
+}
+
+// simRequest is one replayed request.
+type simRequest struct {
+	Method  string
+	Host    string
+	Path    string
+	Query   url.Values
+	Headers http.Header
+	Line    int
+}
+
+// simRule is a rule of the in-memory routing table and its hit count.
+type simRule struct {
+	Route string
+	Index int
+	Rule  *router.Rule
+	Hits  int
+}
+
+// routingTable is the generated routes loaded into a router.Table, with
+// every rule tracked for reporting.
+type routingTable struct {
+	table  *router.Table
+	rules  []*simRule
+	byRule map[*router.Rule]*simRule
+}
+
+// match returns the rule that would serve req, or nil.
+func (t *routingTable) match(req simRequest) *simRule {
+	res, ok := t.table.MatchRequest(router.Request{
+		Method:  req.Method,
+		Host:    req.Host,
+		Path:    req.Path,
+		Headers: req.Headers,
+		Query:   req.Query,
+	})
+	if !ok {
+		return nil
+	}
+	return t.byRule[res.Rule]
+}
+
+func runSimulate(cmd *cobra.Command, args []string) error {
+	if err := prepareGeneration(cmd.Context()); err != nil {
+		return err
+	}
+	table, err := loadRoutingTable(cmd.Context())
+	if err != nil {
+		return err
+	}
+	requests, err := readTraffic(trafficFile)
+	if err != nil {
+		return err
+	}
+
+	var unmatched []simRequest
+	for _, req := range requests {
+		if r := table.match(req); r != nil {
+			r.Hits++
+		} else {
+			unmatched = append(unmatched, req)
+		}
+	}
+
+	matched := len(requests) - len(unmatched)
+	rate := 0.0
+	if len(requests) > 0 {
+		rate = 100 * float64(matched) / float64(len(requests))
+	}
+	fmt.Printf("Requests:  %d\n", len(requests))
+	fmt.Printf("Matched:   %d (%.1f%%)\n", matched, rate)
+	fmt.Printf("Unmatched: %d\n", len(unmatched))
+	for _, req := range unmatched {
+		fmt.Printf("  line %d: %s\n", req.Line, req)
+	}
+
+	fmt.Println("Rule hits:")
+	var neverHit []*simRule
+	for _, r := range table.rules {
+		fmt.Printf("  %6d  %s\n", r.Hits, r)
+		if r.Hits == 0 {
+			neverHit = append(neverHit, r)
+		}
+	}
+	fmt.Printf("Rules never hit: %d\n", len(neverHit))
+	for _, r := range neverHit {
+		fmt.Printf("  %s\n", r)
+	}
+
+	if failOnUnmatched && len(unmatched) > 0 {
+		return fmt.Errorf("%d request(s) matched no rule", len(unmatched))
+	}
+	return nil
+}
+
+func (r simRequest) String() string {
+	s := r.Method + " "
+	if r.Host != "" {
+		s += r.Host
+	}
+	s += r.Path
+	if len(r.Query) > 0 {
+		s += "?" + r.Query.Encode()
+	}
+	for _, name := range slices.Sorted(maps.Keys(r.Headers)) {
+		s += " " + name + ":" + strings.Join(r.Headers[name], ",")
+	}
+	return s
+}
+
+func (r *simRule) String() string {
+	return fmt.Sprintf("%s rule %d [%s]", r.Route, r.Index, r.matchesString())
+}
+
+// matchesString describes the matches of the rule.
+func (r *simRule) matchesString() string {
+	var matches []string
+	for _, m := range r.Rule.Matches {
+		desc := "PathPrefix /"
+		if m.Path != nil {
+			desc = m.Path.Type + " " + m.Path.Value
+		}
+		if m.Method != "" {
+			desc = m.Method + " " + desc
+		}
+		for _, h := range m.Headers {
+			desc += " " + h.Name + ":" + h.Value
+		}
+		for _, q := range m.QueryParams {
+			desc += " " + q.Name + "=" + q.Value
+		}
+		matches = append(matches, desc)
+	}
+	return strings.Join(matches, ", ")
+}
+
+// loadRoutingTable builds every route selected by --input in memory. Routes
+// are loaded through their YAML form, exactly as pkg/router users load the
+// generated files.
+func loadRoutingTable(ctx context.Context) (*routingTable, error) {
+	routes, err := buildInventory(ctx)
+	if err != nil {
+		return nil, err
+	}
+	table := router.New()
+	for _, r := range routes {
+		data, err := yaml.Marshal(r)
+		if err != nil {
+			return nil, err
+		}
+		var route router.HTTPRoute
+		if err := yaml.Unmarshal(data, &route); err != nil {
+			return nil, err
+		}
+		table.Add(route)
+	}
+
+	t := &routingTable{table: table, byRule: make(map[*router.Rule]*simRule)}
+	for _, route := range table.Routes() {
+		for i := range route.Spec.Rules {
+			r := &simRule{Route: route.Metadata.Name, Index: i, Rule: &route.Spec.Rules[i]}
+			t.rules = append(t.rules, r)
+			t.byRule[r.Rule] = r
+		}
+	}
+	return t, nil
+}
+
+// buildInventory builds every route selected by --input without writing it.
+func buildInventory(ctx context.Context) ([]HTTPRoute, error) {
+	built, err := buildInventoryRoutes(ctx)
+	if err != nil {
+		return nil, err
+	}
+	routes := make([]HTTPRoute, 0, len(built))
+	for _, gr := range built {
+		routes = append(routes, gr.Route)
+	}
+	return routes, nil
+}
+
+// buildInventoryRoutes is buildInventory keeping the endpoints of each route.
+func buildInventoryRoutes(ctx context.Context) ([]generatedRoute, error) {
+	files, _, err := inputFiles(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err := resolveDuplicatePrefixes(ctx, files); err != nil {
+		return nil, err
+	}
+	if err := resolveConflicts(ctx, files); err != nil {
+		return nil, err
+	}
+	var routes []generatedRoute
+	for _, path := range files {
+		endpoints, err := readEndpoints(ctx, path)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		if len(endpoints) == 0 {
+			continue
+		}
+		built, err := buildRoutes(path, endpoints)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		routes = append(routes, built...)
+	}
+	return routes, nil
+}
+
+func readTraffic(path string) ([]simRequest, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var requests []simRequest
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		req := simRequest{Method: "GET", Line: line}
+		fields := strings.Fields(text)
+		target := fields[0]
+		if len(fields) > 1 && !strings.HasPrefix(target, "/") && !strings.Contains(target, "://") {
+			req.Method = strings.ToUpper(fields[0])
+			target, fields = fields[1], fields[1:]
+		}
+		for _, f := range fields[1:] {
+			name, value, ok := strings.Cut(f, ":")
+			if !ok || name == "" {
+				return nil, fmt.Errorf("%s:%d: invalid header %q (want Name:value)", path, line, f)
+			}
+			if req.Headers == nil {
+				req.Headers = make(http.Header)
+			}
+			req.Headers.Add(name, value)
+		}
+		if strings.Contains(target, "://") {
+			u, err := url.Parse(target)
+			if err != nil {
+				return nil, fmt.Errorf("%s:%d: %w", path, line, err)
+			}
+			req.Host = u.Hostname()
+			target = u.EscapedPath()
+			if u.RawQuery != "" {
+				target += "?" + u.RawQuery
+			}
+		}
+		target, rawQuery, _ := strings.Cut(target, "?")
+		req.Path = target
+		if rawQuery != "" {
+			query, err := url.ParseQuery(rawQuery)
+			if err != nil {
+				return nil, fmt.Errorf("%s:%d: %w", path, line, err)
+			}
+			req.Query = query
+		}
+		if req.Path == "" {
+			req.Path = "/"
+		}
+		requests = append(requests, req)
+	}
+	return requests, scanner.Err()
+}
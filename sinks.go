@@ -0,0 +1,294 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// outputSink publishes the files generated by a run. The files are always
+// written below --output first, where signing, --push-oci and --check find
+// them; sinks take them from there once the run is complete.
+type outputSink interface {
+	// Publish receives the files written in the run, in order.
+	Publish(ctx context.Context, files []string) error
+}
+
+// sinkOpener opens a --sink given the argument after its "name:".
+type sinkOpener func(arg string) (outputSink, error)
+
+// sinkOpeners is the registry of --sink names.
+var sinkOpeners = make(map[string]sinkOpener)
+
+func registerSink(name string, open sinkOpener) {
+	if _, dup := sinkOpeners[name]; dup {
+		panic("output sink registered twice: " + name)
+	}
+	sinkOpeners[name] = open
+}
+
+func init() {
+	registerSink("files", openFilesSink)
+	registerSink("cluster", openClusterSink)
+	registerSink("stdout", openStdoutSink)
+	registerSink("archive", openArchiveSink)
+	registerSink("git", openGitSink)
+}
+
+// sinkSpecs is --sink, the destinations of the generated files as
+// name[:argument]. Without the files (or git) sink the files are staged in
+// a temporary directory that is removed after the run.
+var sinkSpecs = []string{"files"}
+
+// streamOutput is the --output that writes the generated files to standard
+// output instead of a directory.
+const streamOutput = "-"
+
+// validateStreamOutput turns --output - into the stdout sink, which stands
+// in for the files sink, so the YAML stream can be piped into kubectl apply -f -.
+func validateStreamOutput() error {
+	if outputDir != streamOutput {
+		return nil
+	}
+	var specs []string
+	for _, spec := range sinkSpecs {
+		switch name, _, _ := strings.Cut(spec, ":"); name {
+		case "files":
+		case "git":
+			return fmt.Errorf("--output - cannot be combined with --sink git, which commits the files in --output")
+		default:
+			specs = append(specs, spec)
+		}
+	}
+	if !slices.Contains(specs, "stdout") {
+		specs = append(specs, "stdout")
+	}
+	sinkSpecs = specs
+	return nil
+}
+
+// activeSinks are the sinks of the current run.
+var activeSinks []outputSink
+
+// openSinks opens the --sink destinations, with --apply adding the cluster
+// sink. Without the files sink --output is swapped for a staging directory,
+// while existing routes are still read from --output, and the lines for the
+// staged files are not printed. The returned function restores --output and
+// removes the staging directory.
+func openSinks() (func(), error) {
+	specs := slices.Clone(sinkSpecs)
+	if applyRoutes && !slices.Contains(specs, "cluster") {
+		specs = append(specs, "cluster")
+	}
+	activeSinks = nil
+	keepFiles := false
+	for _, spec := range specs {
+		name, arg, _ := strings.Cut(spec, ":")
+		open, ok := sinkOpeners[name]
+		if !ok {
+			return nil, fmt.Errorf("invalid --sink %q (must be files, cluster, stdout, archive:FILE, or git[:MESSAGE])", spec)
+		}
+		// git commits the files where they were written.
+		if name == "files" || name == "git" {
+			keepFiles = true
+		}
+		sink, err := open(arg)
+		if err != nil {
+			return nil, fmt.Errorf("invalid --sink %q: %w", spec, err)
+		}
+		activeSinks = append(activeSinks, sink)
+	}
+	if keepFiles {
+		return func() {}, nil
+	}
+
+	staging, err := os.MkdirTemp("", "csv2httproute-output-")
+	if err != nil {
+		return nil, err
+	}
+	output, existing, wasQuiet := outputDir, existingOutputDir, quiet
+	// A streamed run has no earlier output to read routes from.
+	if outputDir == streamOutput {
+		existingOutputDir = staging
+	}
+	if existingOutputDir == "" {
+		existingOutputDir = outputDir
+	}
+	outputDir, quiet = staging, true
+	return func() {
+		outputDir, existingOutputDir, quiet = output, existing, wasQuiet
+		os.RemoveAll(staging)
+	}, nil
+}
+
+// publishSinks hands the files written in this run to every sink.
+func publishSinks(ctx context.Context) error {
+	files := uniqueFiles(writtenFiles)
+	for _, sink := range activeSinks {
+		if err := sink.Publish(ctx, files); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func uniqueFiles(paths []string) []string {
+	seen := make(map[string]bool, len(paths))
+	var files []string
+	for _, path := range paths {
+		if !seen[path] {
+			seen[path] = true
+			files = append(files, path)
+		}
+	}
+	return files
+}
+
+// filesSink keeps the files in --output, where they were written.
+type filesSink struct{}
+
+func openFilesSink(arg string) (outputSink, error) {
+	if arg != "" {
+		return nil, fmt.Errorf("files takes no argument; set the directory with --output")
+	}
+	return filesSink{}, nil
+}
+
+func (filesSink) Publish(context.Context, []string) error { return nil }
+
+// clusterSink server-side applies the generated manifests, as --apply.
+type clusterSink struct{}
+
+func openClusterSink(arg string) (outputSink, error) {
+	if arg != "" {
+		return nil, fmt.Errorf("cluster takes no argument; select the clusters with --kubeconfig and --context or --contexts")
+	}
+	return clusterSink{}, nil
+}
+
+func (clusterSink) Publish(ctx context.Context, files []string) error {
+	return applyGeneratedObjects(ctx, files)
+}
+
+// stdoutSink prints the generated YAML files as one multi-document stream,
+// e.g. to pipe into kubectl apply -f -. The "Generated" lines are turned
+// off so they do not mix with the stream.
+type stdoutSink struct{}
+
+func openStdoutSink(arg string) (outputSink, error) {
+	if arg != "" {
+		return nil, fmt.Errorf("stdout takes no argument")
+	}
+	quiet = true
+	return stdoutSink{}, nil
+}
+
+func (stdoutSink) Publish(_ context.Context, files []string) error {
+	first := true
+	for _, path := range files {
+		if ext := filepath.Ext(path); ext != ".yaml" && ext != ".yml" {
+			continue
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		if !first {
+			fmt.Println("---")
+		}
+		first = false
+		os.Stdout.Write(data)
+	}
+	return nil
+}
+
+// archiveSink writes the generated files to a .tar.gz, by their paths
+// below --output.
+type archiveSink struct {
+	path string
+}
+
+func openArchiveSink(arg string) (outputSink, error) {
+	if arg == "" {
+		return nil, fmt.Errorf("archive needs a file, as archive:FILE.tgz")
+	}
+	return archiveSink{path: arg}, nil
+}
+
+func (s archiveSink) Publish(_ context.Context, files []string) error {
+	contents := make(map[string][]byte, len(files))
+	for _, path := range files {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(outputDir, path)
+		if err != nil || strings.HasPrefix(rel, "..") {
+			rel = filepath.Base(path)
+		}
+		contents[filepath.ToSlash(rel)] = data
+	}
+	if err := writeTarGz(s.path, "", contents); err != nil {
+		return fmt.Errorf("failed to write archive: %w", err)
+	}
+	if err := applyOutputPermissions(s.path); err != nil {
+		return err
+	}
+	if !quiet {
+		fmt.Printf("Generated %s\n", s.path)
+	}
+	return nil
+}
+
+// gitSink commits the generated files in the git repository containing
+// --output, for GitOps repositories.
+type gitSink struct {
+	message string
+}
+
+func openGitSink(arg string) (outputSink, error) {
+	if arg == "" {
+		arg = "Regenerate HTTPRoutes with csv2httproute " + Version
+	}
+	return gitSink{message: arg}, nil
+}
+
+// Publish commits only the files of the run, so unrelated changes in the
+// repository stay uncommitted, and skips the commit when none changed.
+func (s gitSink) Publish(ctx context.Context, files []string) error {
+	if len(files) == 0 {
+		return nil
+	}
+	if _, err := runSigner(ctx, "git", append([]string{"-C", outputDir, "add", "--"}, absPaths(files)...)...); err != nil {
+		return fmt.Errorf("git sink: %w", err)
+	}
+	if _, err := runSigner(ctx, "git", append([]string{"-C", outputDir, "diff", "--cached", "--quiet", "--"}, absPaths(files)...)...); err == nil {
+		if !quiet {
+			fmt.Println("No changes to commit")
+		}
+		return nil
+	}
+	if _, err := runSigner(ctx, "git", append([]string{"-C", outputDir, "commit", "--quiet", "-m", s.message, "--"}, absPaths(files)...)...); err != nil {
+		return fmt.Errorf("git sink: %w", err)
+	}
+	if !quiet {
+		fmt.Printf("Committed %d file(s) to git\n", len(files))
+	}
+	return nil
+}
+
+// absPaths makes paths absolute, since git -C resolves relative paths
+// against --output.
+func absPaths(paths []string) []string {
+	abs := make([]string, len(paths))
+	for i, p := range paths {
+		if a, err := filepath.Abs(p); err == nil {
+			p = a
+		}
+		abs[i] = p
+	}
+	return abs
+}
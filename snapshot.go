@@ -0,0 +1,150 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/spf13/cobra"
+)
+
+var snapshotUpdate bool
+
+func newSnapshotCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "snapshot",
+		Short: "Compare conversion output against golden files",
+		Long: `Converts the fixtures in --input and compares the result with the golden files
+in --output, printing a unified diff for every mismatch and exiting non-zero.
+Use --update to (re)write the golden files instead. Golden files are generated
+without the header comment so they do not depend on the invoking command line.`,
+		RunE: runSnapshot,
+	}
+	cmd.Flags().StringVarP(&serviceName, "service", "s", "my-service", "Default backend service name")
+	cmd.Flags().IntVarP(&servicePort, "port", "p", 80, "Default backend service port")
+	cmd.Flags().BoolVar(&snapshotUpdate, "update", false, "Rewrite the golden files from the current output")
+	addGenerateFlags(cmd.Flags(), "testdata/golden")
+	return cmd
+}
+
+func runSnapshot(cmd *cobra.Command, args []string) error {
+	goldenDir := outputDir
+	tmp, err := os.MkdirTemp("", "csv2httproute-snapshot-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmp)
+
+	outputDir = tmp
+	noHeaderComment = true
+	quiet = true
+	signTool = ""
+	if err := run(cmd, args); err != nil {
+		return err
+	}
+
+	got, err := readTree(tmp)
+	if err != nil {
+		return err
+	}
+	want, err := readTree(goldenDir)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	if snapshotUpdate {
+		return updateGolden(goldenDir, got, want)
+	}
+
+	names := make(map[string]bool)
+	for name := range got {
+		names[name] = true
+	}
+	for name := range want {
+		names[name] = true
+	}
+	sorted := make([]string, 0, len(names))
+	for name := range names {
+		sorted = append(sorted, name)
+	}
+	sort.Strings(sorted)
+
+	mismatches := 0
+	for _, name := range sorted {
+		g, inGot := got[name]
+		w, inWant := want[name]
+		switch {
+		case !inWant:
+			fmt.Printf("%s %s (no golden file)\n", colorize(ansiGreen, "NEW     "), name)
+		case !inGot:
+			fmt.Printf("%s %s (golden file not produced)\n", colorize(ansiRed, "MISSING "), name)
+		case g == w:
+			continue
+		default:
+			fmt.Printf("%s %s\n", colorize(ansiYellow, "MISMATCH"), name)
+			fmt.Print(colorDiff(unifiedDiff(filepath.Join(goldenDir, name), "generated/"+name, w, g)))
+		}
+		mismatches++
+	}
+
+	if mismatches > 0 {
+		return fmt.Errorf("%d snapshot(s) differ from %s; rerun with --update to accept", mismatches, goldenDir)
+	}
+	fmt.Printf("%d snapshot(s) match %s\n", len(got), goldenDir)
+	return nil
+}
+
+// readTree returns the contents of every regular file below dir keyed by
+// slash-separated relative path.
+func readTree(dir string) (map[string]string, error) {
+	files := make(map[string]string)
+	err := filepath.WalkDir(dir, func(path string, d os.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		files[filepath.ToSlash(rel)] = string(data)
+		return nil
+	})
+	return files, err
+}
+
+// updateGolden writes got into goldenDir and removes golden files that are no
+// longer produced.
+func updateGolden(goldenDir string, got, want map[string]string) error {
+	outputDir = goldenDir
+	if err := ensureOutputDir(goldenDir); err != nil {
+		return err
+	}
+	for name, content := range got {
+		path := filepath.Join(goldenDir, filepath.FromSlash(name))
+		if want[name] == content {
+			continue
+		}
+		if err := ensureOutputDir(filepath.Dir(path)); err != nil {
+			return err
+		}
+		if err := writeOutputFile(path, []byte(content)); err != nil {
+			return err
+		}
+		fmt.Printf("Updated %s\n", path)
+	}
+	for name := range want {
+		if _, ok := got[name]; !ok {
+			path := filepath.Join(goldenDir, filepath.FromSlash(name))
+			if err := os.Remove(path); err != nil {
+				return err
+			}
+			fmt.Printf("Removed %s\n", path)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,28 @@
+package main
+
+import (
+	"cmp"
+	"slices"
+)
+
+// sortRules is --sort-rules: build the rules of a route from its rows in a
+// canonical order rather than the order of the CSV.
+var sortRules bool
+
+// sortedEndpoints orders the rows of a route by prefix, URL, match type,
+// method, headers and query parameters. Rows equal in all of them keep
+// their order, so the first of duplicates still wins. Since rules are
+// built in order of first appearance, this orders them, and the matches
+// within them, independently of where rows sit in the file.
+func sortedEndpoints(endpoints []Endpoint) []Endpoint {
+	return slices.SortedStableFunc(slices.Values(endpoints), func(a, b Endpoint) int {
+		return cmp.Or(
+			cmp.Compare(a.Prefix, b.Prefix),
+			cmp.Compare(a.URL, b.URL),
+			cmp.Compare(a.MatchType, b.MatchType),
+			cmp.Compare(a.Method, b.Method),
+			cmp.Compare(a.Headers, b.Headers),
+			cmp.Compare(a.QueryParams, b.QueryParams),
+		)
+	})
+}
@@ -0,0 +1,374 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// inputSource provides the CSV files selected by --input. Sources other than
+// local files fetch their files into memory when opened, under names that
+// stay recognizable in messages and header comments, so the rest of the
+// pipeline reads them like local files through readSourceFile.
+type inputSource interface {
+	// Files lists the CSV files of the source. single reports a source of
+	// exactly one file, whose errors should fail the run directly.
+	Files() (files []string, single bool, err error)
+}
+
+// sourceOpener opens the source named by an --input value.
+type sourceOpener func(ctx context.Context, spec string) (inputSource, error)
+
+// sourceOpeners is the registry of --input schemes: "-" for stdin, the
+// part before "::" for forced schemes such as git::, or the URL scheme.
+// Values without a scheme are local files and directories.
+var sourceOpeners = make(map[string]sourceOpener)
+
+func registerSource(scheme string, open sourceOpener) {
+	if _, dup := sourceOpeners[scheme]; dup {
+		panic("input source registered twice: " + scheme)
+	}
+	sourceOpeners[scheme] = open
+}
+
+func init() {
+	registerSource("-", openStdinSource)
+	registerSource("http", openHTTPSource)
+	registerSource("https", openHTTPSource)
+	registerSource("s3", openBucketSource)
+	registerSource("gs", openBucketSource)
+	registerSource("git", openGitSource)
+	registerSource("configmap", openConfigMapSource)
+}
+
+// sourceTimeout bounds fetching a remote source.
+const sourceTimeout = 60 * time.Second
+
+var (
+	// openedSources caches sources by --input value, so each is fetched
+	// (and stdin read) once per run even when several passes list it.
+	openedSources = make(map[string]inputSource)
+	// fetchedFiles holds the contents of the files of remote sources.
+	fetchedFiles = make(map[string][]byte)
+)
+
+// sourceScheme returns the scheme of an --input value, or "" for local
+// paths. Single letters before ":" are Windows drive letters.
+func sourceScheme(spec string) string {
+	if spec == "-" {
+		return "-"
+	}
+	if scheme, _, ok := strings.Cut(spec, "::"); ok && !strings.ContainsAny(scheme, `/\`) {
+		return scheme
+	}
+	if scheme, _, ok := strings.Cut(spec, "://"); ok && len(scheme) > 1 && !strings.ContainsAny(scheme, `/\`) {
+		return scheme
+	}
+	return ""
+}
+
+// openSource returns the source of an --input value.
+func openSource(ctx context.Context, spec string) (inputSource, error) {
+	if src, ok := openedSources[spec]; ok {
+		return src, nil
+	}
+	var src inputSource = localSource(spec)
+	if scheme := sourceScheme(spec); scheme != "" {
+		open, ok := sourceOpeners[scheme]
+		if !ok {
+			return nil, fmt.Errorf("unsupported input source %q (scheme %s)", spec, scheme)
+		}
+		var err error
+		if src, err = open(ctx, spec); err != nil {
+			return nil, fmt.Errorf("failed to fetch input %s: %w", spec, err)
+		}
+	}
+	openedSources[spec] = src
+	return src, nil
+}
+
+// readSourceFile returns the raw contents of an input file, from memory for
+// fetched sources and from disk otherwise.
+func readSourceFile(path string) ([]byte, error) {
+	if data, ok := fetchedFiles[path]; ok {
+		return data, nil
+	}
+	return os.ReadFile(path)
+}
+
+// localSource is a CSV file, a directory of them, or a glob pattern.
+type localSource string
+
+func (s localSource) Files() ([]string, bool, error) {
+	path := string(s)
+	if isGlob(path) {
+		files, err := globFiles(path)
+		return files, false, err
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to access input: %w", err)
+	}
+	if !info.IsDir() {
+		if !isInputFile(path) {
+			return nil, false, fmt.Errorf("input file must be %s", inputFileKind())
+		}
+		return []string{path}, true, nil
+	}
+	if recursive {
+		files, err := walkInputs(path, func(string) bool { return true })
+		return files, false, err
+	}
+	entries, err := os.ReadDir(path)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to read input directory: %w", err)
+	}
+	var files []string
+	for _, entry := range entries {
+		if !entry.IsDir() && isInputFile(entry.Name()) {
+			files = append(files, filepath.Join(path, entry.Name()))
+		}
+	}
+	return files, false, nil
+}
+
+// fetchedSource is a source whose files were fetched into fetchedFiles.
+type fetchedSource struct {
+	files  []string
+	single bool
+}
+
+func (s *fetchedSource) Files() ([]string, bool, error) {
+	return s.files, s.single, nil
+}
+
+// addFetched stores the files of a fetched source under base/name, keeping
+// schema sidecars and other files next to the CSVs readable too.
+func addFetched(base string, contents map[string][]byte) *fetchedSource {
+	src := &fetchedSource{}
+	for name, data := range contents {
+		path := base + "/" + name
+		fetchedFiles[path] = data
+		if isInputFile(name) {
+			src.files = append(src.files, path)
+		}
+	}
+	sort.Strings(src.files)
+	return src
+}
+
+// openStdinSource reads one CSV from standard input, named stdin.csv, an
+// OpenAPI document or application.yaml named stdin.yaml with --input-format
+// openapi or spring-gateway, or the JSON document of the other input
+// formats, named stdin.json (stdin.config for a web.config).
+func openStdinSource(context.Context, string) (inputSource, error) {
+	data, err := io.ReadAll(os.Stdin)
+	if err != nil {
+		return nil, err
+	}
+	name := inputFileName("stdin")
+	fetchedFiles[name] = data
+	return &fetchedSource{files: []string{name}, single: true}, nil
+}
+
+// inputFileName names an input read without a file name, such as stdin, with
+// the extension of the --input-format.
+func inputFileName(base string) string {
+	switch inputFormat {
+	case formatOpenAPI, formatSpring:
+		return base + ".yaml"
+	case formatActuator, formatRails, formatDjango, formatASPNet:
+		return base + ".json"
+	case formatIIS:
+		return base + ".config"
+	}
+	return base + ".csv"
+}
+
+// openHTTPSource downloads one CSV. It is named by its URL without the query,
+// so the route is named after the last path segment.
+func openHTTPSource(ctx context.Context, spec string) (inputSource, error) {
+	u, err := url.Parse(spec)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, spec, nil)
+	if err != nil {
+		return nil, err
+	}
+	client := &http.Client{Timeout: sourceTimeout}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("GET returned %s", resp.Status)
+	}
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	name := u.Scheme + "://" + u.Host + u.Path
+	fetchedFiles[name] = data
+	return &fetchedSource{files: []string{name}, single: true}, nil
+}
+
+// openBucketSource copies one object, or the objects below a prefix, from an
+// S3 (s3://) or Google Cloud Storage (gs://) bucket with the aws or gcloud
+// CLI, which brings its usual credentials.
+func openBucketSource(ctx context.Context, spec string) (inputSource, error) {
+	if err := checkOffline("--input " + spec); err != nil {
+		return nil, err
+	}
+	dir, err := os.MkdirTemp("", "csv2httproute-input-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+
+	single := isInputFile(spec)
+	prefix := strings.TrimSuffix(spec, "/")
+	if single {
+		prefix = spec[:strings.LastIndex(spec, "/")]
+	}
+	switch {
+	case strings.HasPrefix(spec, "s3://") && single:
+		_, err = runSigner(ctx, "aws", "s3", "cp", "--only-show-errors", spec, dir+"/")
+	case strings.HasPrefix(spec, "s3://"):
+		_, err = runSigner(ctx, "aws", "s3", "cp", "--only-show-errors", "--recursive", "--exclude", "*/*", prefix+"/", dir)
+	case single:
+		_, err = runSigner(ctx, "gcloud", "storage", "cp", spec, dir)
+	default:
+		_, err = runSigner(ctx, "gcloud", "storage", "cp", prefix+"/*", dir)
+	}
+	if err != nil {
+		return nil, err
+	}
+	contents, err := readDirFiles(dir)
+	if err != nil {
+		return nil, err
+	}
+	src := addFetched(prefix, contents)
+	src.single = single
+	return src, nil
+}
+
+// openGitSource clones a repository with git. The value follows the
+// go-getter convention git::URL[//DIR][?ref=REF]: DIR is the directory (or
+// CSV file) in the repository, REF a branch or tag.
+func openGitSource(ctx context.Context, spec string) (inputSource, error) {
+	if err := checkOffline("--input " + spec); err != nil {
+		return nil, err
+	}
+	base, ref := spec, ""
+	if i := strings.LastIndex(spec, "?"); i >= 0 {
+		query, err := url.ParseQuery(spec[i+1:])
+		if err != nil {
+			return nil, err
+		}
+		base, ref = spec[:i], query.Get("ref")
+	}
+	repo := strings.TrimPrefix(base, "git::")
+	sub := ""
+	hostStart := 0
+	if i := strings.Index(repo, "://"); i >= 0 {
+		hostStart = i + len("://")
+	}
+	if i := strings.Index(repo[hostStart:], "//"); i >= 0 {
+		repo, sub = repo[:hostStart+i], repo[hostStart+i+2:]
+	}
+
+	dir, err := os.MkdirTemp("", "csv2httproute-input-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+	args := []string{"clone", "--quiet", "--depth", "1"}
+	if ref != "" {
+		args = append(args, "--branch", ref)
+	}
+	if _, err := runSigner(ctx, "git", append(args, "--", repo, dir)...); err != nil {
+		return nil, err
+	}
+
+	target := filepath.Join(dir, filepath.FromSlash(sub))
+	if isInputFile(sub) {
+		data, err := os.ReadFile(target)
+		if err != nil {
+			return nil, err
+		}
+		fetchedFiles[base] = data
+		return &fetchedSource{files: []string{base}, single: true}, nil
+	}
+	contents, err := readDirFiles(target)
+	if err != nil {
+		return nil, err
+	}
+	return addFetched(strings.TrimSuffix(base, "/"), contents), nil
+}
+
+// openConfigMapSource reads the CSVs stored in the data keys of a ConfigMap,
+// configmap://[NAMESPACE/]NAME, from the current kubeconfig context.
+func openConfigMapSource(ctx context.Context, spec string) (inputSource, error) {
+	ref := strings.TrimPrefix(spec, "configmap://")
+	ns, name, ok := strings.Cut(ref, "/")
+	client, contextNamespace, err := kubeDynamicClient()
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		ns, name = contextNamespace, ref
+	}
+	if ns == "" || name == "" || strings.Contains(name, "/") {
+		return nil, fmt.Errorf("want configmap://[namespace/]name")
+	}
+	var obj *unstructured.Unstructured
+	err = retryCluster(ctx, "ConfigMap "+ns+"/"+name, sourceTimeout, func(ctx context.Context) error {
+		var err error
+		obj, err = client.Resource(configMapsGVR).Namespace(ns).Get(ctx, name, metav1.GetOptions{})
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	data, _, err := unstructured.NestedStringMap(obj.Object, "data")
+	if err != nil {
+		return nil, err
+	}
+	contents := make(map[string][]byte, len(data))
+	for key, value := range data {
+		contents[key] = []byte(value)
+	}
+	return addFetched("configmap://"+ns+"/"+name, contents), nil
+}
+
+// readDirFiles returns the regular files directly in dir by name.
+func readDirFiles(dir string) (map[string][]byte, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	contents := make(map[string][]byte)
+	for _, entry := range entries {
+		if !entry.Type().IsRegular() {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+		contents[entry.Name()] = data
+	}
+	return contents, nil
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"fmt"
+	"maps"
+	"strconv"
+	"strings"
+)
+
+// Modes of --split-by.
+const (
+	splitFile     = "file"
+	splitPrefix   = "prefix"
+	splitEndpoint = "endpoint"
+)
+
+// splitBy is --split-by: how many HTTPRoutes the rows of a CSV become.
+var splitBy = splitFile
+
+// maxSplitSlug caps the part of a route name --split-by derives from a
+// prefix or URL, so names stay readable and well within the name limits.
+const maxSplitSlug = 40
+
+func validateSplitBy(mode string) error {
+	switch mode {
+	case splitFile, splitPrefix, splitEndpoint:
+		return nil
+	}
+	return fmt.Errorf("invalid --split-by %q (must be %s, %s, or %s)", mode, splitFile, splitPrefix, splitEndpoint)
+}
+
+// splitGroup is the endpoints of one route under --split-by, in
+// first-appearance order. Suffix is appended to the route name; it is
+// empty for the route of a whole file and for rows without a prefix.
+type splitGroup struct {
+	Suffix    string
+	Endpoints []Endpoint
+}
+
+// splitRoute splits a route built from a whole group of rows by --split-by.
+// The route is built first, so rows under one prefix are still checked
+// against each other, then its matches are moved to the route of the row
+// they came from. A prefix rule goes with the first row of its prefix, and
+// rules from no row, such as the --default-backend catch-all, with the
+// first route.
+func splitRoute(gr generatedRoute) []generatedRoute {
+	if splitBy == splitFile {
+		return []generatedRoute{gr}
+	}
+	groups := partitionBySplit(gr.Endpoints)
+	lineGroup := make(map[int]int)
+	routes := make([]generatedRoute, len(groups))
+	for i, g := range groups {
+		for _, e := range g.Endpoints {
+			lineGroup[e.Line] = i
+		}
+		route := gr.Route
+		route.Metadata.Labels = maps.Clone(gr.Route.Metadata.Labels)
+		route.Metadata.Annotations = maps.Clone(gr.Route.Metadata.Annotations)
+		if g.Suffix != "" {
+			route.Metadata.Name += "-" + g.Suffix
+		}
+		route.Spec.Rules = nil
+		routes[i] = generatedRoute{Route: route, Endpoints: g.Endpoints}
+	}
+	for _, rule := range gr.Route.Spec.Rules {
+		matches := make(map[int][]HTTPRouteMatch)
+		var order []int
+		for _, m := range rule.Matches {
+			i := 0
+			if len(m.SourceLines) > 0 {
+				i = lineGroup[m.SourceLines[0]]
+			}
+			if _, ok := matches[i]; !ok {
+				order = append(order, i)
+			}
+			matches[i] = append(matches[i], m)
+		}
+		if len(rule.Matches) == 0 {
+			order = []int{0}
+		}
+		for _, i := range order {
+			r := rule
+			r.Matches = matches[i]
+			routes[i].Route.Spec.Rules = append(routes[i].Route.Spec.Rules, r)
+		}
+	}
+	var split []generatedRoute
+	for _, r := range routes {
+		if len(r.Route.Spec.Rules) > 0 {
+			split = append(split, r)
+		}
+	}
+	return split
+}
+
+// partitionBySplit splits endpoints by --split-by: one group per prefix,
+// or per row, named after the prefix or the method and URL. Names that
+// come out the same are numbered in order of appearance, so they only
+// change when the rows do.
+func partitionBySplit(endpoints []Endpoint) []splitGroup {
+	if splitBy == splitFile {
+		return []splitGroup{{Endpoints: endpoints}}
+	}
+	var groups []splitGroup
+	index := make(map[string]int)
+	used := make(map[string]bool)
+	for _, e := range endpoints {
+		if splitBy == splitPrefix {
+			if i, ok := index[e.Prefix]; ok {
+				groups[i].Endpoints = append(groups[i].Endpoints, e)
+				continue
+			}
+			index[e.Prefix] = len(groups)
+		}
+		suffix := ""
+		switch {
+		case splitBy == splitEndpoint:
+			method := strings.ToLower(e.Method)
+			if method == "" {
+				method = "any"
+			}
+			suffix = method + "-" + pathSlug(e.URL)
+		case e.Prefix != "":
+			suffix = pathSlug(e.Prefix)
+		}
+		suffix = uniqueSuffix(suffix, used)
+		groups = append(groups, splitGroup{Suffix: suffix, Endpoints: []Endpoint{e}})
+	}
+	return groups
+}
+
+// pathSlug is the route name part of a path: "/api/v1/users" is
+// api-v1-users and "/" is root.
+func pathSlug(path string) string {
+	s := strings.Trim(nonSlugChars.ReplaceAllString(strings.ToLower(path), "-"), "-")
+	if len(s) > maxSplitSlug {
+		s = strings.TrimRight(s[:maxSplitSlug], "-")
+	}
+	if s == "" {
+		return "root"
+	}
+	return s
+}
+
+// uniqueSuffix returns suffix, numbered from 2 if it is already used, and
+// marks the result used.
+func uniqueSuffix(suffix string, used map[string]bool) string {
+	name := suffix
+	for n := 2; used[name]; n++ {
+		name = suffix + "-" + strconv.Itoa(n)
+	}
+	used[name] = true
+	return name
+}
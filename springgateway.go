@@ -0,0 +1,520 @@
+package main
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// springGatewayRoots are the properties holding Spring Cloud Gateway's
+// routes and default filters: spring.cloud.gateway, and its server.webflux
+// and server.webmvc successors of Spring Cloud Gateway 4.1.
+var springGatewayRoots = [][]string{
+	{"spring", "cloud", "gateway"},
+	{"spring", "cloud", "gateway", "server", "webflux"},
+	{"spring", "cloud", "gateway", "server", "webmvc"},
+}
+
+// springFlagArgs are the arguments of a Path predicate that are options
+// rather than patterns.
+var springFlagArgs = map[string]bool{"matchtrailingslash": true, "matchoptionaltrailingseparator": true}
+
+// springIgnoredFilters are the filters that change neither routing nor the
+// request, or do so in ways a route cannot, and are left out of the rows
+// with a warning rather than dropping their routes.
+var springIgnoredFilters = map[string]bool{
+	"PreserveHostHeader": true, "DedupeResponseHeader": true, "SaveSession": true, "SecureHeaders": true,
+	"TokenRelay": true, "CircuitBreaker": true, "Hystrix": true, "RequestRateLimiter": true,
+	"RequestSize": true, "CacheRequestBody": true, "LocalResponseCache": true, "FallbackHeaders": true,
+}
+
+// springCapture finds the named group of a RewritePath regular expression.
+var springCapture = regexp.MustCompile(`\(\?<([A-Za-z][A-Za-z0-9]*)>`)
+
+// springDef is a predicate or filter of a route, written as a shortcut
+// (Name=arg1,arg2) or as a name with args.
+type springDef struct {
+	Name string
+	Args []string
+}
+
+// parseSpringGateway turns the routes of a Spring Cloud Gateway or Netflix
+// Zuul application.yaml into endpoint rows, one per route, path pattern,
+// host and method, numbered by the line of the route:
+//
+//   - spring.cloud.gateway.routes: the Path, Method, Host, Header and Query
+//     predicates become the URLs, methods, hostname, and header and query
+//     matches of the rows, and the uri their backend. StripPrefix and
+//     RewritePath filters removing the literal start of a /** pattern
+//     become the prefix, SetPath the rewrite, RedirectTo the redirect,
+//     Retry the retries, the request and response header filters the
+//     header modifier columns, and the response-timeout metadata the
+//     timeout. Default filters apply to every route.
+//   - zuul.routes: the path below zuul.prefix becomes the URL and the url or
+//     serviceId the backend, with the prefix stripped as Zuul strips it.
+//
+// lb://orders and a serviceId are the Service of that name, and
+// http://orders.shop:8080 the orders Service on port 8080. Only the
+// documents of the default profile are read. Routes that cannot be
+// expressed, such as those with other predicates or path rewrites, are
+// left out with a warning.
+func parseSpringGateway(ctx context.Context, path string) ([]Endpoint, error) {
+	data, err := readInput(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+	var endpoints []Endpoint
+	skipped := 0
+	d := yaml.NewDecoder(bytes.NewReader(data))
+	for {
+		var doc yaml.Node
+		if err := d.Decode(&doc); errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("invalid application.yaml: %w", err)
+		}
+		if len(doc.Content) == 0 || springProfileDoc(doc.Content[0]) {
+			continue
+		}
+		rows, n, err := springDocRows(path, doc.Content[0])
+		if err != nil {
+			return nil, err
+		}
+		endpoints = append(endpoints, rows...)
+		skipped += n
+	}
+	recordSkippedRows(path, skipped)
+	return applyTagFilters(applyCutovers(endpoints)), nil
+}
+
+// springProfileDoc reports whether a document of a multi-document
+// application.yaml only applies to some profiles.
+func springProfileDoc(root *yaml.Node) bool {
+	return springLookup(root, "spring", "config", "activate", "on-profile") != nil ||
+		scalarValue(springLookup(root, "spring", "profiles")) != ""
+}
+
+// springDocRows are the rows of the Spring Cloud Gateway and Zuul routes of
+// one document, and the number of routes skipped.
+func springDocRows(path string, root *yaml.Node) ([]Endpoint, int, error) {
+	type route struct {
+		node *yaml.Node
+		name string
+		rows func(warn func(string, ...any)) ([]Endpoint, error)
+	}
+	var routes []route
+	for _, keys := range springGatewayRoots {
+		defaults, err := springDefs(springLookup(root, append(keys, "default-filters")...))
+		if err != nil {
+			return nil, 0, err
+		}
+		if list := springLookup(root, append(keys, "routes")...); list != nil && list.Kind == yaml.SequenceNode {
+			for _, r := range list.Content {
+				routes = append(routes, route{r, scalarValue(springValue(r, "id")), func(warn func(string, ...any)) ([]Endpoint, error) { return springRouteRows(r, defaults, warn) }})
+			}
+		}
+	}
+	if zuul := springValue(root, "zuul"); zuul != nil {
+		if list := springValue(zuul, "routes"); list != nil && list.Kind == yaml.MappingNode {
+			for i := 0; i+1 < len(list.Content); i += 2 {
+				key, r := list.Content[i].Value, list.Content[i+1]
+				routes = append(routes, route{r, key, func(func(string, ...any)) ([]Endpoint, error) { return zuulRouteRows(zuul, key, r) }})
+			}
+		}
+	}
+
+	var endpoints []Endpoint
+	skipped := 0
+	for _, r := range routes {
+		rows, err := r.rows(func(format string, args ...any) {
+			fmt.Fprintf(os.Stderr, "WARNING: %s:%d: route %q: %s\n", path, r.node.Line, r.name, fmt.Sprintf(format, args...))
+		})
+		var skip skippedRule
+		if errors.As(err, &skip) {
+			fmt.Fprintf(os.Stderr, "WARNING: %s:%d: route %q skipped: %v\n", path, r.node.Line, r.name, skip.error)
+			skipped++
+			continue
+		}
+		if err != nil {
+			return nil, 0, fmt.Errorf("line %d: route %q: %w", r.node.Line, r.name, err)
+		}
+		for _, e := range rows {
+			e.Line = r.node.Line
+			endpoints = append(endpoints, e)
+		}
+	}
+	return endpoints, skipped, nil
+}
+
+// springRouteRows are the rows of one Spring Cloud Gateway route.
+func springRouteRows(route *yaml.Node, defaults []springDef, warn func(string, ...any)) ([]Endpoint, error) {
+	id := scalarValue(springValue(route, "id"))
+	record := map[string]string{"comment": id}
+	if err := springBackend(scalarValue(springValue(route, "uri")), record); err != nil {
+		return nil, err
+	}
+	predicates, err := springDefs(springValue(route, "predicates"))
+	if err != nil {
+		return nil, err
+	}
+	filters, err := springDefs(springValue(route, "filters"))
+	if err != nil {
+		return nil, err
+	}
+
+	patterns, methods, hosts := []string{"/**"}, []string{""}, []string{""}
+	var headers, params []string
+	for _, p := range predicates {
+		switch p.Name {
+		case "Path":
+			patterns = p.Args
+		case "Method":
+			methods = nil
+			for _, m := range p.Args {
+				methods = append(methods, strings.ToUpper(m))
+			}
+		case "Host":
+			hosts = nil
+			for _, h := range p.Args {
+				host := strings.ToLower(h)
+				if rest, ok := strings.CutPrefix(host, "**."); ok {
+					host = "*." + rest
+				}
+				if strings.ContainsAny(strings.TrimPrefix(host, "*."), "*{?") {
+					return nil, skippedRule{fmt.Errorf("host pattern %s has no route hostname", h)}
+				}
+				hosts = append(hosts, host)
+			}
+		case "Header", "Query":
+			pair, err := springPair(p)
+			if err != nil {
+				return nil, err
+			}
+			if p.Name == "Header" {
+				headers = append(headers, pair)
+			} else {
+				params = append(params, pair)
+			}
+		default:
+			return nil, skippedRule{fmt.Errorf("%s predicate has no route equivalent", p.Name)}
+		}
+	}
+	record["headers"] = strings.Join(headers, ";")
+	record["query_params"] = strings.Join(params, ";")
+
+	prefix := ""
+	for _, f := range slices.Concat(defaults, filters) {
+		if err := springFilter(f, patterns, record, &prefix, warn); err != nil {
+			return nil, err
+		}
+	}
+	if prefix != "" && (methods[0] != "" || len(headers) > 0 || len(params) > 0) {
+		return nil, skippedRule{errors.New("the prefix rule stripping the path cannot match methods, headers or query parameters")}
+	}
+	if timeout := scalarValue(springValue(springValue(route, "metadata"), "response-timeout")); timeout != "" {
+		ms, err := strconv.Atoi(timeout)
+		if err != nil {
+			return nil, fmt.Errorf("invalid response-timeout %q (want milliseconds)", timeout)
+		}
+		if ms >= 0 {
+			record["timeout"] = strconv.Itoa(ms) + "ms"
+		}
+	}
+	record["prefix"] = prefix
+	return springRows(patterns, methods, hosts, record)
+}
+
+// springRows are the rows of every pattern, method and host of a route.
+func springRows(patterns, methods, hosts []string, record map[string]string) ([]Endpoint, error) {
+	var rows []Endpoint
+	for _, host := range hosts {
+		for _, pattern := range patterns {
+			for _, method := range methods {
+				e, err := frameworkRow(method, pattern, record)
+				if err != nil {
+					return nil, err
+				}
+				e.Hostname = host
+				rows = append(rows, e)
+			}
+		}
+	}
+	return rows, nil
+}
+
+// springBackend sets the backend cells of record from the uri of a route:
+// a Service for lb://name and http(s)://host[:port] URIs. The path of the
+// uri is ignored, as Spring Cloud Gateway ignores it.
+func springBackend(uri string, record map[string]string) error {
+	u, err := url.Parse(uri)
+	if uri == "" || err != nil {
+		return fmt.Errorf("invalid uri %q", uri)
+	}
+	switch u.Scheme {
+	case "lb":
+		record["service"] = kubeServiceName(u.Host)
+	case "http", "https", "ws", "wss":
+		backendCells(u, record)
+	default:
+		return skippedRule{fmt.Errorf("uri %s is not a service", uri)}
+	}
+	return nil
+}
+
+// springFilter applies a filter of a route to record, setting *prefix to
+// the path a StripPrefix or equivalent RewritePath removes.
+func springFilter(f springDef, patterns []string, record map[string]string, prefix *string, warn func(string, ...any)) error {
+	arg := func(i int) string {
+		if i < len(f.Args) {
+			return f.Args[i]
+		}
+		return ""
+	}
+	switch f.Name {
+	case "StripPrefix":
+		n, err := strconv.Atoi(cmp.Or(arg(0), "1"))
+		if err != nil || n < 0 {
+			return fmt.Errorf("invalid StripPrefix %q", arg(0))
+		}
+		if n == 0 {
+			return nil
+		}
+		return springStrip(patterns, func(lit string) bool { return strings.Count(lit, "/") == n }, prefix, f)
+	case "RewritePath":
+		regex, replacement := arg(0), strings.ReplaceAll(arg(1), `$\{`, "${")
+		if !strings.Contains(replacement, "$") {
+			if _, ok := regexLiteral(strings.Trim(regex, "^$")); ok && !strings.Contains(replacement, "{") {
+				record["rewrite"] = replacement
+				return nil
+			}
+		}
+		lit, ok := springRewritePrefix(regex, replacement)
+		if !ok {
+			return skippedRule{fmt.Errorf("RewritePath=%s, %s builds a new path from the request", regex, replacement)}
+		}
+		return springStrip(patterns, func(p string) bool { return p == lit }, prefix, f)
+	case "SetPath":
+		if strings.Contains(arg(0), "{") {
+			return skippedRule{fmt.Errorf("SetPath=%s builds a new path from the request", arg(0))}
+		}
+		record["rewrite"] = arg(0)
+	case "RedirectTo":
+		if arg(0) != "301" && arg(0) != "302" {
+			return skippedRule{fmt.Errorf("RedirectTo status %s is neither 301 nor 302", arg(0))}
+		}
+		record["redirect"] = arg(0) + " " + arg(1)
+	case "Retry":
+		record["retries"] = cmp.Or(arg(0), "3")
+	case "AddRequestHeader", "SetRequestHeader", "AddResponseHeader", "SetResponseHeader":
+		if strings.Contains(arg(1), "{") {
+			return skippedRule{fmt.Errorf("%s=%s, %s interpolates the request", f.Name, arg(0), arg(1))}
+		}
+		column := map[string]string{
+			"AddRequestHeader": "add_headers", "SetRequestHeader": "set_headers",
+			"AddResponseHeader": "add_response_headers", "SetResponseHeader": "set_response_headers",
+		}[f.Name]
+		record[column] = joinCell(record[column], arg(0)+"="+arg(1))
+	case "RemoveRequestHeader":
+		record["remove_headers"] = joinCell(record["remove_headers"], arg(0))
+	case "RemoveResponseHeader":
+		record["remove_response_headers"] = joinCell(record["remove_response_headers"], arg(0))
+	default:
+		if !springIgnoredFilters[f.Name] {
+			return skippedRule{fmt.Errorf("%s filter has no route equivalent", f.Name)}
+		}
+		warn("%s filter ignored", f.Name)
+	}
+	return nil
+}
+
+// springStrip sets *prefix to the literal start of the patterns removed by
+// filter f, which each pattern must end in /** below, as checked by ok.
+// Other patterns would widen to everything below the prefix rule.
+func springStrip(patterns []string, ok func(lit string) bool, prefix *string, f springDef) error {
+	for _, p := range patterns {
+		lit, wild := strings.CutSuffix(p, "/**")
+		if !wild || strings.ContainsAny(lit, "*{?") || !ok(lit) || (*prefix != "" && *prefix != lit) {
+			return skippedRule{fmt.Errorf("%s=%s of path %s has no prefix rule", f.Name, strings.Join(f.Args, ","), p)}
+		}
+		*prefix = lit
+	}
+	return nil
+}
+
+// springRewritePrefix is the literal prefix a RewritePath removes, as in
+// RewritePath=/api/(?<segment>.*), /${segment}.
+func springRewritePrefix(regex, replacement string) (string, bool) {
+	m := springCapture.FindStringSubmatch(regex)
+	if m == nil {
+		return "", false
+	}
+	group := "(?<" + m[1] + ">"
+	tails := map[string]string{group + "/?.*)": "${" + m[1] + "}", group + "/.*)": "${" + m[1] + "}", "/" + group + ".*)": "/${" + m[1] + "}"}
+	for tail, want := range tails {
+		rest, ok := strings.CutSuffix(strings.TrimPrefix(regex, "^"), tail)
+		if !ok || replacement != want {
+			continue
+		}
+		if lit, ok := regexLiteral(rest); ok && strings.HasPrefix(lit, "/") {
+			return lit, true
+		}
+	}
+	return "", false
+}
+
+// springPair is the name=value match of a Header or Query predicate, whose
+// value must be a literal.
+func springPair(p springDef) (string, error) {
+	if len(p.Args) < 2 {
+		return "", skippedRule{fmt.Errorf("%s predicate testing for presence has no exact match", p.Name)}
+	}
+	value, ok := regexLiteral(p.Args[1])
+	if !ok || strings.ContainsAny(value, ";=") {
+		return "", skippedRule{fmt.Errorf("%s=%s, %s is not an exact match", p.Name, p.Args[0], p.Args[1])}
+	}
+	return p.Args[0] + "=" + value, nil
+}
+
+// zuulRouteRows are the rows of one Zuul route: a path, or a mapping with
+// path, serviceId or url, and stripPrefix. Zuul strips the literal start of
+// the path, and zuul.prefix with zuul.strip-prefix, unless told not to.
+func zuulRouteRows(zuul *yaml.Node, key string, route *yaml.Node) ([]Endpoint, error) {
+	record := map[string]string{"comment": key}
+	path, service, target, strip := scalarValue(route), key, "", true
+	if route.Kind == yaml.MappingNode {
+		path = scalarValue(springValue(route, "path"))
+		service = cmp.Or(scalarValue(springValue(route, "serviceId")), key)
+		target = scalarValue(springValue(route, "url"))
+		strip = scalarValue(springValue(route, "stripPrefix")) != "false"
+	}
+	if path == "" {
+		path = "/" + key + "/**"
+	}
+	if target != "" {
+		if err := springBackend(target, record); err != nil {
+			return nil, err
+		}
+	} else {
+		record["service"] = kubeServiceName(service)
+	}
+
+	globalPrefix := strings.TrimSuffix(scalarValue(springValue(zuul, "prefix")), "/")
+	globalStrip := scalarValue(springValue(zuul, "strip-prefix")) != "false"
+	pattern := globalPrefix + "/" + strings.TrimPrefix(path, "/")
+	switch {
+	case strip && (globalPrefix == "" || globalStrip):
+		lit, wild := strings.CutSuffix(pattern, "/**")
+		if !wild || strings.ContainsAny(lit, "*{?") {
+			return nil, skippedRule{fmt.Errorf("stripping the prefix of path %s has no prefix rule", pattern)}
+		}
+		record["prefix"] = lit
+	case !strip && (globalPrefix == "" || !globalStrip):
+	default:
+		return nil, skippedRule{fmt.Errorf("stripping only part of the prefix of %s has no prefix rule", pattern)}
+	}
+	return springRows([]string{pattern}, []string{""}, []string{""}, record)
+}
+
+// springDefs reads a list of predicates or filters. The arguments of a
+// shortcut are split at commas, and those of the long form are taken in
+// order, so Path=/a/**,/b/** and {name: Path, args: {patterns: [/a/**,
+// /b/**]}} both have the patterns as arguments.
+func springDefs(list *yaml.Node) ([]springDef, error) {
+	if list == nil {
+		return nil, nil
+	}
+	var defs []springDef
+	for _, item := range list.Content {
+		if item.Kind == yaml.ScalarNode {
+			name, args, _ := strings.Cut(item.Value, "=")
+			d := springDef{Name: strings.TrimSpace(name)}
+			if args != "" {
+				for _, a := range strings.Split(args, ",") {
+					d.Args = append(d.Args, strings.TrimSpace(a))
+				}
+			}
+			defs = append(defs, d)
+			continue
+		}
+		d := springDef{Name: scalarValue(springValue(item, "name"))}
+		if d.Name == "" {
+			return nil, fmt.Errorf("line %d: predicate or filter without a name", item.Line)
+		}
+		if args := springValue(item, "args"); args != nil && args.Kind == yaml.MappingNode {
+			for i := 0; i+1 < len(args.Content); i += 2 {
+				if springFlagArgs[strings.ToLower(args.Content[i].Value)] {
+					continue
+				}
+				if v := args.Content[i+1]; v.Kind == yaml.SequenceNode {
+					d.Args = append(d.Args, scalarValues(v)...)
+				} else {
+					d.Args = append(d.Args, scalarValue(v))
+				}
+			}
+		}
+		defs = append(defs, d)
+	}
+	return defs, nil
+}
+
+// springValue is the value of key in a mapping node, matched with Spring
+// Boot's relaxed binding, so stripPrefix, strip-prefix and strip_prefix are
+// the same key.
+func springValue(n *yaml.Node, key string) *yaml.Node {
+	if n == nil || n.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		if springKey(n.Content[i].Value) == springKey(key) {
+			return n.Content[i+1]
+		}
+	}
+	return nil
+}
+
+func springKey(k string) string {
+	return strings.ToLower(strings.NewReplacer("-", "", "_", "").Replace(k))
+}
+
+// springLookup is the value of a property below root, written as nested
+// keys or dotted ones, such as spring: {cloud.gateway: {routes: ...}}.
+func springLookup(root *yaml.Node, keys ...string) *yaml.Node {
+	for i := len(keys); i >= 1; i-- {
+		v := springValue(root, strings.Join(keys[:i], "."))
+		if v == nil {
+			continue
+		}
+		if i == len(keys) {
+			return v
+		}
+		if r := springLookup(v, keys[i:]...); r != nil {
+			return r
+		}
+	}
+	return nil
+}
+
+// kubeServiceName is the Service of a service registry name, such as
+// orders-service for ORDERS_SERVICE.
+func kubeServiceName(name string) string {
+	return strings.ReplaceAll(strings.ToLower(name), "_", "-")
+}
+
+// joinCell appends a value to a ;-separated cell.
+func joinCell(cell, v string) string {
+	if cell == "" {
+		return v
+	}
+	return cell + ";" + v
+}
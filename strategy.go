@@ -0,0 +1,57 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/arencloud/csv2httproute/pkg/convert"
+)
+
+// Rule strategies of --strategy; see convert.Strategy.
+const (
+	strategyHybrid = string(convert.StrategyHybrid)
+	strategyPrefix = string(convert.StrategyPrefix)
+	strategyExact  = string(convert.StrategyExact)
+)
+
+var (
+	ruleStrategy string
+	// noDirectMatches is --no-direct-matches, shorthand for --strategy prefix.
+	noDirectMatches bool
+	// directMatchType is --default-match-type, the path match type of
+	// direct matches without a match_type column: PathPrefix, Exact so /user
+	// does not also cover /users, or RegularExpression.
+	directMatchType string
+)
+
+// resolveStrategy validates --strategy, --no-direct-matches and
+// --default-match-type.
+func resolveStrategy() error {
+	switch ruleStrategy {
+	case strategyHybrid, strategyPrefix, strategyExact:
+	default:
+		return fmt.Errorf("invalid --strategy %q (must be %s, %s or %s)", ruleStrategy, strategyPrefix, strategyExact, strategyHybrid)
+	}
+	if noDirectMatches {
+		if ruleStrategy == strategyExact {
+			return fmt.Errorf("--no-direct-matches conflicts with --strategy %s", strategyExact)
+		}
+		ruleStrategy = strategyPrefix
+	}
+	matchType, err := convert.NormalizeMatchType(directMatchType)
+	if err != nil {
+		return fmt.Errorf("invalid --default-match-type %q (must be %s)", directMatchType, strings.Join(convert.MatchTypes, ", "))
+	}
+	directMatchType = matchType
+	// A regular expression default is the regex path syntax, which the
+	// other syntaxes would compile into expressions of their own.
+	if directMatchType == "RegularExpression" {
+		switch pathSyntax {
+		case "plain", "regex":
+			pathSyntax = "regex"
+		default:
+			return fmt.Errorf("--default-match-type RegularExpression conflicts with --path-syntax %s", pathSyntax)
+		}
+	}
+	return nil
+}
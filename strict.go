@@ -0,0 +1,147 @@
+package main
+
+import (
+	"fmt"
+	"maps"
+	"math"
+	"reflect"
+	"slices"
+	"strings"
+)
+
+// Manifests converted back into CSVs are decoded strictly: a field the
+// route types do not know would otherwise be dropped without a trace, so
+// every unknown field and every value of the wrong type is reported by its
+// path in the document, e.g. spec.rules[0].timeouts.
+
+// strictIgnored reports whether an unknown field at path carries no routing
+// data: the status and the object metadata the API server maintains.
+func strictIgnored(path string) bool {
+	return path == "status" || strings.HasPrefix(path, "metadata.")
+}
+
+// strictProblems checks the decoded object obj against the type of v and
+// lists the fields decoding into v would drop or reject.
+func strictProblems(obj map[string]any, v any) []string {
+	var problems []string
+	checkStrict(obj, reflect.TypeOf(v), "", &problems)
+	return problems
+}
+
+func checkStrict(value any, t reflect.Type, path string, problems *[]string) {
+	if value == nil {
+		return
+	}
+	problem := func(format string, args ...any) {
+		*problems = append(*problems, path+": "+fmt.Sprintf(format, args...))
+	}
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	switch t.Kind() {
+	case reflect.Struct:
+		m, ok := value.(map[string]any)
+		if !ok {
+			problem("want a mapping, got %s", strictKind(value))
+			return
+		}
+		fields := yamlFields(t)
+		for _, key := range slices.Sorted(maps.Keys(m)) {
+			fieldPath := key
+			if path != "" {
+				fieldPath = path + "." + key
+			}
+			field, ok := fields[key]
+			if !ok {
+				if !strictIgnored(fieldPath) && !strictEmpty(m[key]) {
+					*problems = append(*problems, fieldPath+": unknown field")
+				}
+				continue
+			}
+			checkStrict(m[key], field.Type, fieldPath, problems)
+		}
+	case reflect.Slice:
+		items, ok := value.([]any)
+		if !ok {
+			problem("want a list, got %s", strictKind(value))
+			return
+		}
+		for i, item := range items {
+			checkStrict(item, t.Elem(), fmt.Sprintf("%s[%d]", path, i), problems)
+		}
+	case reflect.Map:
+		m, ok := value.(map[string]any)
+		if !ok {
+			problem("want a mapping, got %s", strictKind(value))
+			return
+		}
+		for _, key := range slices.Sorted(maps.Keys(m)) {
+			checkStrict(m[key], t.Elem(), path+"."+key, problems)
+		}
+	case reflect.String:
+		switch value.(type) {
+		case map[string]any, []any:
+			problem("want a string, got %s", strictKind(value))
+		}
+	case reflect.Int:
+		switch n := value.(type) {
+		case int, int32, int64:
+		case float64:
+			if n != math.Trunc(n) {
+				problem("want an integer, got %v", n)
+			}
+		default:
+			problem("want an integer, got %s", strictKind(value))
+		}
+	case reflect.Bool:
+		if _, ok := value.(bool); !ok {
+			problem("want true or false, got %s", strictKind(value))
+		}
+	}
+}
+
+// yamlFields maps the YAML keys of the fields of struct type t to them.
+// Fields the YAML encoding skips are left out.
+func yamlFields(t reflect.Type) map[string]reflect.StructField {
+	fields := make(map[string]reflect.StructField)
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name, _, _ := strings.Cut(f.Tag.Get("yaml"), ",")
+		switch {
+		case name == "-" || !f.IsExported():
+			continue
+		case name == "":
+			name = strings.ToLower(f.Name)
+		}
+		fields[name] = f
+	}
+	return fields
+}
+
+// strictEmpty reports whether an unknown field holds nothing to drop.
+func strictEmpty(value any) bool {
+	switch v := value.(type) {
+	case nil:
+		return true
+	case map[string]any:
+		return len(v) == 0
+	case []any:
+		return len(v) == 0
+	}
+	return false
+}
+
+// strictKind names the YAML kind of a decoded value for problems.
+func strictKind(value any) string {
+	switch value.(type) {
+	case map[string]any:
+		return "a mapping"
+	case []any:
+		return "a list"
+	case string:
+		return "a string"
+	case bool:
+		return "a boolean"
+	}
+	return fmt.Sprintf("%v", value)
+}
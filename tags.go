@@ -0,0 +1,40 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/arencloud/csv2httproute/pkg/convert"
+)
+
+// includeTags and excludeTags are --tags and --exclude-tags: the subset of
+// the inventory to generate by the tags column, e.g. only the public rows
+// for the public gateway.
+var (
+	includeTags []string
+	excludeTags []string
+)
+
+// validateTagFilters normalizes the tag filters. They cannot be combined
+// with --grace-period, whose history would take the rows left out for
+// removed ones.
+func validateTagFilters() error {
+	includeTags = convert.ParseTags(strings.Join(includeTags, ","))
+	excludeTags = convert.ParseTags(strings.Join(excludeTags, ","))
+	for _, t := range includeTags {
+		if slices.Contains(excludeTags, t) {
+			return fmt.Errorf("tag %q is given to both --tags and --exclude-tags", t)
+		}
+	}
+	if gracePeriodFlag != "" && (len(includeTags) > 0 || len(excludeTags) > 0) {
+		return fmt.Errorf("--tags and --exclude-tags cannot be combined with --grace-period")
+	}
+	return nil
+}
+
+// applyTagFilters keeps the rows of a file selected by --tags and
+// --exclude-tags.
+func applyTagFilters(endpoints []Endpoint) []Endpoint {
+	return convert.FilterTags(endpoints, includeTags, excludeTags)
+}
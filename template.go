@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"text/template"
+
+	"gopkg.in/yaml.v3"
+)
+
+// routeTemplate is the parsed --template, or nil to emit YAML.
+var routeTemplate *template.Template
+
+// templateExt is the extension of files rendered from routeTemplate.
+var templateExt string
+
+// templateData is the value a --template is executed with, once per route.
+type templateData struct {
+	Route     HTTPRoute
+	Endpoints []Endpoint
+	Source    string
+	Version   string
+}
+
+var templateFuncs = template.FuncMap{
+	"toYaml": func(v any) (string, error) {
+		out, err := yaml.Marshal(v)
+		return string(out), err
+	},
+	"join":    strings.Join,
+	"lower":   strings.ToLower,
+	"upper":   strings.ToUpper,
+	"replace": strings.ReplaceAll,
+	"indent": func(n int, s string) string {
+		pad := strings.Repeat(" ", n)
+		return pad + strings.ReplaceAll(strings.TrimRight(s, "\n"), "\n", "\n"+pad)
+	},
+}
+
+func loadTemplate(ctx context.Context, path string) error {
+	routeTemplate = nil
+	if path == "" {
+		return nil
+	}
+	data, err := readInput(ctx, path)
+	if err != nil {
+		return fmt.Errorf("failed to read template: %w", err)
+	}
+	path = plainName(path)
+	tmpl, err := template.New(filepath.Base(path)).Funcs(templateFuncs).Option("missingkey=error").Parse(string(data))
+	if err != nil {
+		return fmt.Errorf("failed to parse template: %w", err)
+	}
+	routeTemplate = tmpl
+	templateExt = templateOutputExt(path)
+	return nil
+}
+
+// templateOutputExt derives the rendered file extension from the template
+// name: "route.md.tmpl" renders to ".md"; a bare "route.tmpl" to ".txt".
+func templateOutputExt(path string) string {
+	base := filepath.Base(path)
+	for _, suffix := range []string{".tmpl", ".tpl", ".gotmpl"} {
+		if strings.HasSuffix(base, suffix) {
+			base = strings.TrimSuffix(base, suffix)
+			break
+		}
+	}
+	if ext := filepath.Ext(base); ext != "" {
+		return ext
+	}
+	return ".txt"
+}
+
+// renderTemplate executes routeTemplate for route and writes the result to
+// the output directory, returning the file path.
+func renderTemplate(route HTTPRoute, endpoints []Endpoint, source string) (string, error) {
+	outPath := outputPath(route.Metadata.Name, templateExt)
+	outFile, err := createOutputFile(outPath)
+	if err != nil {
+		return "", err
+	}
+	defer outFile.Discard()
+
+	data := templateData{
+		Route:     route,
+		Endpoints: endpoints,
+		Source:    filepath.ToSlash(source),
+		Version:   Version,
+	}
+	if err := routeTemplate.Execute(outFile, data); err != nil {
+		return "", fmt.Errorf("failed to render template: %w", err)
+	}
+	return outPath, outFile.Close()
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/arencloud/csv2httproute/pkg/convert"
+)
+
+// tierPolicy is the operational policy of an SLA tier from the tiers section
+// of the --config file. The timeouts and retries are those of the columns,
+// filled in for the rows of the tier without their own; the rate limit has
+// no Gateway API equivalent and is written per --rate-limits.
+type tierPolicy struct {
+	Timeout        string `yaml:"timeout,omitempty"`
+	BackendTimeout string `yaml:"backendTimeout,omitempty"`
+	Retries        string `yaml:"retries,omitempty"`
+	// RateLimit is requests/unit, such as 1000/minute, for each route of
+	// the tier.
+	RateLimit string `yaml:"rateLimit,omitempty"`
+}
+
+// The --rate-limits modes.
+const (
+	rateLimitsEnvoyGateway = "envoy-gateway"
+	rateLimitsNone         = "none"
+)
+
+var (
+	// rateLimits is --rate-limits: how the rate limits of the tiers are
+	// enforced.
+	rateLimits string
+	// tiers are the tiers of the --config file, by name.
+	tiers map[string]tierPolicy
+)
+
+// rateLimitUnits maps the units of a tier rate limit to those of Envoy
+// Gateway.
+var rateLimitUnits = map[string]string{"second": "Second", "minute": "Minute", "hour": "Hour", "day": "Day"}
+
+func validateRateLimits() error {
+	switch rateLimits {
+	case rateLimitsEnvoyGateway, rateLimitsNone:
+		return nil
+	}
+	return fmt.Errorf("invalid --rate-limits %q (must be %s or %s)", rateLimits, rateLimitsEnvoyGateway, rateLimitsNone)
+}
+
+// loadTiers checks the tiers of the --config file and normalizes their
+// timeouts and retries like the columns.
+func loadTiers(cfg map[string]tierPolicy) error {
+	tiers = nil
+	for name, t := range cfg {
+		if slug := ownerSlug(name); slug != name {
+			return fmt.Errorf("config file: tier name %q must be lower-case letters, digits and dashes", name)
+		}
+		var err error
+		if t.Timeout != "" {
+			if t.Timeout, err = convert.ParseTimeout(t.Timeout, "timeout"); err != nil {
+				return fmt.Errorf("config file: tier %s: %w", name, err)
+			}
+		}
+		if t.BackendTimeout != "" {
+			if t.BackendTimeout, err = convert.ParseTimeout(t.BackendTimeout, "backendTimeout"); err != nil {
+				return fmt.Errorf("config file: tier %s: %w", name, err)
+			}
+		}
+		if t.Retries != "" {
+			if t.Retries, err = convert.ParseRetries(t.Retries); err != nil {
+				return fmt.Errorf("config file: tier %s: %w", name, err)
+			}
+		}
+		if t.RateLimit != "" {
+			if _, _, err := parseRateLimit(t.RateLimit); err != nil {
+				return fmt.Errorf("config file: tier %s: %w", name, err)
+			}
+		}
+		cfg[name] = t
+	}
+	tiers = cfg
+	return nil
+}
+
+// parseRateLimit reads a tier rate limit, requests/unit, into its requests
+// and Envoy Gateway unit.
+func parseRateLimit(v string) (int, string, error) {
+	n, unit, ok := strings.Cut(v, "/")
+	requests, err := strconv.Atoi(strings.TrimSpace(n))
+	unit = rateLimitUnits[strings.ToLower(strings.TrimSpace(unit))]
+	if !ok || err != nil || requests < 1 || unit == "" {
+		return 0, "", fmt.Errorf("invalid rateLimit %q (want requests/unit with a unit of second, minute, hour or day, e.g. 1000/minute)", v)
+	}
+	return requests, unit, nil
+}
+
+// tierGroup is the endpoints of one tier, in first-appearance order, with
+// the tier's timeouts and retries filled in. Name is empty for rows
+// without a tier.
+type tierGroup struct {
+	Name      string
+	Endpoints []Endpoint
+}
+
+// partitionByTier splits endpoints by their tier column, so every route
+// carries the policy of one tier.
+func partitionByTier(endpoints []Endpoint) ([]tierGroup, error) {
+	var groups []tierGroup
+	index := make(map[string]int)
+	for _, e := range endpoints {
+		if e.Tier != "" {
+			t, ok := tiers[e.Tier]
+			if !ok {
+				return nil, fmt.Errorf("line %d: unknown tier %q", e.Line, e.Tier)
+			}
+			// The columns of the row win over its tier.
+			if e.Timeout == "" {
+				e.Timeout = t.Timeout
+			}
+			if e.BackendTimeout == "" {
+				e.BackendTimeout = t.BackendTimeout
+			}
+			if e.Retries == "" {
+				e.Retries = t.Retries
+			}
+		}
+		i, ok := index[e.Tier]
+		if !ok {
+			i = len(groups)
+			index[e.Tier] = i
+			groups = append(groups, tierGroup{Name: e.Tier})
+		}
+		groups[i].Endpoints = append(groups[i].Endpoints, e)
+	}
+	return groups, nil
+}
+
+// tierOf is the tier of the rows of a route, which partitionByTier gave a
+// single one.
+func tierOf(endpoints []Endpoint) string {
+	for _, e := range endpoints {
+		if e.Tier != "" {
+			return e.Tier
+		}
+	}
+	return ""
+}
+
+// tierRateLimit is the Envoy Gateway rateLimit of the BackendTrafficPolicy
+// of a route built from endpoints, or nil when its tier has none or
+// --rate-limits is none. The limit is local, per Envoy replica, so it needs
+// no rate limit service.
+func tierRateLimit(endpoints []Endpoint) map[string]any {
+	if rateLimits != rateLimitsEnvoyGateway {
+		return nil
+	}
+	t := tiers[tierOf(endpoints)]
+	if t.RateLimit == "" {
+		return nil
+	}
+	requests, unit, _ := parseRateLimit(t.RateLimit)
+	return map[string]any{
+		"type": "Local",
+		"local": map[string]any{
+			"rules": []map[string]any{{"limit": map[string]any{"requests": requests, "unit": unit}}},
+		},
+	}
+}
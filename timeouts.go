@@ -0,0 +1,38 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/arencloud/csv2httproute/pkg/convert"
+)
+
+var (
+	// defaultTimeout, defaultBackendTimeout and defaultRetries are
+	// --default-timeout, --default-backend-timeout and --default-retries:
+	// the timeout, backend_timeout and retries of rows without their own.
+	defaultTimeout        string
+	defaultBackendTimeout string
+	defaultRetries        string
+)
+
+// validateRulePolicy checks the default timeouts and retries and
+// normalizes them like the columns.
+func validateRulePolicy() error {
+	var err error
+	if defaultTimeout != "" {
+		if defaultTimeout, err = convert.ParseTimeout(defaultTimeout, "--default-timeout"); err != nil {
+			return err
+		}
+	}
+	if defaultBackendTimeout != "" {
+		if defaultBackendTimeout, err = convert.ParseTimeout(defaultBackendTimeout, "--default-backend-timeout"); err != nil {
+			return err
+		}
+	}
+	if defaultRetries != "" {
+		if defaultRetries, err = convert.ParseRetries(defaultRetries); err != nil {
+			return fmt.Errorf("--default-retries: %w", err)
+		}
+	}
+	return nil
+}
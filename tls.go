@@ -0,0 +1,181 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/arencloud/csv2httproute/pkg/convert"
+	"gopkg.in/yaml.v3"
+)
+
+// Rows with tls=passthrough are served by TLSRoutes: the gateway forwards
+// their connections still encrypted, choosing the backend by SNI alone, so
+// the rows of one hostname share a TLSRoute while the terminated rows stay
+// in the HTTPRoute.
+
+// tlsPassthroughListener is --tls-passthrough-listener, the sectionName of
+// the Gateway listener the TLSRoutes attach to.
+var tlsPassthroughListener string
+
+// tlsRoute is a Gateway API TLSRoute (experimental channel).
+type tlsRoute struct {
+	APIVersion string       `yaml:"apiVersion"`
+	Kind       string       `yaml:"kind"`
+	Metadata   Metadata     `yaml:"metadata"`
+	Spec       tlsRouteSpec `yaml:"spec"`
+}
+
+type tlsRouteSpec struct {
+	ParentRefs []ParentRef    `yaml:"parentRefs"`
+	Hostnames  []string       `yaml:"hostnames,omitempty"`
+	Rules      []tlsRouteRule `yaml:"rules"`
+}
+
+type tlsRouteRule struct {
+	BackendRefs []BackendRef `yaml:"backendRefs"`
+}
+
+// splitPassthrough separates the passthrough rows from the rows the gateway
+// terminates TLS for. The gateway cannot see the requests of a passthrough
+// row, so columns matching or transforming them are rejected rather than
+// silently ignored; the method and URL only document the endpoint.
+func splitPassthrough(endpoints []Endpoint) (terminated, passthrough []Endpoint, err error) {
+	for _, e := range endpoints {
+		if e.TLS != convert.TLSPassthrough {
+			terminated = append(terminated, e)
+			continue
+		}
+		var unusable []string
+		for column, set := range map[string]bool{
+			"prefix":                  e.Prefix != "",
+			"variant":                 e.Variant != "",
+			"match_type":              e.MatchType != "",
+			"headers":                 e.Headers != "",
+			"query_params":            e.QueryParams != "",
+			"accept":                  e.Accept != "",
+			"content_type":            e.ContentType != "",
+			"cookie":                  e.Cookie != "",
+			"cache_ttl":               e.CacheControl != "",
+			"scale_to_zero":           e.ScaleToZero,
+			"fallback":                e.Fallback != "",
+			"protocol":                e.Protocol == convert.RouteGRPC,
+			"redirect":                e.Redirect != "",
+			"rewrite":                 e.Rewrite != "",
+			"backends":                e.Backends != "",
+			"set_headers":             e.RequestHeaders.Set != "",
+			"add_headers":             e.RequestHeaders.Add != "",
+			"remove_headers":          e.RequestHeaders.Remove != "",
+			"set_response_headers":    e.ResponseHeaders.Set != "",
+			"add_response_headers":    e.ResponseHeaders.Add != "",
+			"remove_response_headers": e.ResponseHeaders.Remove != "",
+			"timeout":                 e.Timeout != "",
+			"backend_timeout":         e.BackendTimeout != "",
+			"retries":                 e.Retries != "",
+		} {
+			if set {
+				unusable = append(unusable, column)
+			}
+		}
+		if len(unusable) > 0 {
+			slices.Sort(unusable)
+			return nil, nil, fmt.Errorf("line %d: tls=passthrough rows are routed by hostname only and cannot set %s", e.Line, strings.Join(unusable, ", "))
+		}
+		passthrough = append(passthrough, e)
+	}
+	if len(passthrough) > 0 && gatewayChannel != channelExperimental {
+		return nil, nil, fmt.Errorf("tls=passthrough rows need TLSRoute, which is in the experimental channel; pass --channel %s", channelExperimental)
+	}
+	return terminated, passthrough, nil
+}
+
+// writeTLSRoutes writes <route>-tls.yaml for the passthrough rows of path:
+// one TLSRoute per hostname and gateway, forwarding to the backends of its
+// rows.
+func writeTLSRoutes(path string, endpoints []Endpoint) error {
+	base, err := routeBaseName(path)
+	if err != nil {
+		return err
+	}
+	for _, group := range partitionByDomain(endpoints) {
+		name := base + "-tls"
+		if group.Domain != nil {
+			name += "-" + group.Domain.slug()
+		}
+		// Every parent is attached through --tls-passthrough-listener.
+		parents := targetParents(group.Target)
+		for i := range parents {
+			parents[i].SectionName, parents[i].Port = tlsPassthroughListener, 0
+		}
+		route := tlsRoute{
+			APIVersion: "gateway.networking.k8s.io/v1alpha2",
+			Kind:       "TLSRoute",
+			Metadata:   Metadata{Name: name, Namespace: group.Target.routeNamespace()},
+			Spec: tlsRouteSpec{
+				ParentRefs: parents,
+				Rules:      []tlsRouteRule{{}},
+			},
+		}
+		route.Spec.Hostnames = routeHostnames(group.Target, group.Endpoints)
+		seen := make(map[backendKey]bool)
+		for _, e := range group.Endpoints {
+			b := backendFor(e)
+			key := backendKey{Namespace: b.Namespace, Name: b.Name, Port: b.Port}
+			if !seen[key] {
+				seen[key] = true
+				route.Spec.Rules[0].BackendRefs = append(route.Spec.Rules[0].BackendRefs, b)
+			}
+		}
+
+		if err := applyRouteMetadata(&route.Metadata, group.Endpoints); err != nil {
+			return err
+		}
+		if err := claimRouteName(&route.Metadata, path); err != nil {
+			return err
+		}
+		name = route.Metadata.Name
+		if err := lintRoute(name, route.Spec.Hostnames, path); err != nil {
+			return err
+		}
+		outPath, err := writeRouteDoc(route, name, path)
+		if err != nil {
+			return err
+		}
+		if emitModel != "" {
+			collectModelRoute(route.Kind, route.Metadata, route.Spec.Hostnames, modelParents(route.Spec.ParentRefs), group.Endpoints, path)
+		}
+		runMetrics.routes++
+		if !quiet {
+			fmt.Printf("Generated %s\n", outPath)
+		}
+	}
+	return nil
+}
+
+// writeRouteDoc writes a route of another kind than HTTPRoute, such as a
+// TLSRoute or GRPCRoute, to <name>.yaml with the generated file header.
+func writeRouteDoc(route any, name, source string) (string, error) {
+	var node yaml.Node
+	if err := node.Encode(route); err != nil {
+		return "", err
+	}
+	if !noHeaderComment {
+		header, err := headerComment(source)
+		if err != nil {
+			return "", err
+		}
+		node.HeadComment = header
+	}
+	outPath := outputPath(name, ".yaml")
+	outFile, err := createOutputFile(outPath)
+	if err != nil {
+		return "", err
+	}
+	defer outFile.Discard()
+
+	encoder := newYAMLEncoder(outFile)
+	if err := encoder.Encode(&node); err != nil {
+		return "", err
+	}
+	return outPath, outFile.Close()
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracer is used for all pipeline spans. Until setupTracing installs an
+// exporting provider it resolves to the global no-op provider.
+var tracer = otel.Tracer("csv2httproute")
+
+// setupTracing installs an OTLP/HTTP tracer provider when an endpoint is
+// configured, either via --otlp-endpoint or the standard OTEL_EXPORTER_OTLP_*
+// environment variables. The returned function flushes pending spans.
+func setupTracing(ctx context.Context) (func(context.Context) error, error) {
+	noop := func(context.Context) error { return nil }
+	if err := offlineTracingEndpoint(); err != nil {
+		return noop, err
+	}
+	if otlpEndpoint == "" && os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT") == "" && os.Getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT") == "" {
+		return noop, nil
+	}
+
+	var opts []otlptracehttp.Option
+	if otlpEndpoint != "" {
+		opts = append(opts, otlptracehttp.WithEndpointURL(otlpEndpoint))
+	}
+	exporter, err := otlptracehttp.New(ctx, opts...)
+	if err != nil {
+		return noop, fmt.Errorf("failed to create OTLP exporter: %w", err)
+	}
+
+	res := resource.NewSchemaless(
+		attribute.String("service.name", "csv2httproute"),
+		attribute.String("service.version", Version),
+	)
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+	)
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	return provider.Shutdown, nil
+}
+
+// endSpan records err on span (if any) and ends it.
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// recordError marks span as failed and returns err unchanged.
+func recordError(span trace.Span, err error) error {
+	span.RecordError(err)
+	span.SetStatus(codes.Error, err.Error())
+	return err
+}
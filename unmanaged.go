@@ -0,0 +1,170 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/dynamic"
+)
+
+// unmanagedAnnotationKey lists the indices of hand-written rules in an
+// existing route, e.g. "4,5". Those rules are kept when the route is
+// regenerated, so routes can be adopted gradually.
+const unmanagedAnnotationKey = "csv2httproute/unmanaged-rules"
+
+var unmanagedFromCluster bool
+
+// existingOutputDir is where existing routes are read from when it differs
+// from --output, as in --check.
+var existingOutputDir string
+
+var unmanagedClient dynamic.Interface
+
+// existingRoute returns the current version of route as a generic object,
+// from the output directory or, with --unmanaged-from-cluster, the cluster.
+// It returns nil when the route does not exist yet.
+func existingRoute(ctx context.Context, route HTTPRoute) (map[string]any, error) {
+	if unmanagedFromCluster {
+		if unmanagedClient == nil {
+			client, _, err := kubeDynamicClient()
+			if err != nil {
+				return nil, err
+			}
+			unmanagedClient = client
+		}
+		var obj *unstructured.Unstructured
+		err := retryCluster(ctx, "HTTPRoute "+route.Metadata.Namespace+"/"+route.Metadata.Name, 10*time.Second, func(ctx context.Context) error {
+			var err error
+			obj, err = unmanagedClient.Resource(httpRoutesGVR).Namespace(route.Metadata.Namespace).Get(ctx, route.Metadata.Name, metav1.GetOptions{})
+			return err
+		})
+		if apierrors.IsNotFound(err) {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to get HTTPRoute %s/%s: %w", route.Metadata.Namespace, route.Metadata.Name, err)
+		}
+		return obj.Object, nil
+	}
+
+	path := outputPath(route.Metadata.Name, ".yaml")
+	if existingOutputDir != "" {
+		if rel, err := filepath.Rel(outputDir, path); err == nil {
+			path = filepath.Join(existingOutputDir, rel)
+		}
+	}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var obj map[string]any
+	if err := yaml.Unmarshal(data, &obj); err != nil {
+		// Not a route we can merge with (e.g. --template output).
+		return nil, nil
+	}
+	return obj, nil
+}
+
+// unmanagedRules returns the rules of the existing version of route that its
+// unmanaged-rules annotation marks as hand-written.
+func unmanagedRules(ctx context.Context, route HTTPRoute) ([]any, error) {
+	obj, err := existingRoute(ctx, route)
+	if err != nil || obj == nil {
+		return nil, err
+	}
+	metadata, _ := obj["metadata"].(map[string]any)
+	annotations, _ := metadata["annotations"].(map[string]any)
+	value, _ := annotations[unmanagedAnnotationKey].(string)
+	if strings.TrimSpace(value) == "" {
+		return nil, nil
+	}
+	spec, _ := obj["spec"].(map[string]any)
+	rules, _ := spec["rules"].([]any)
+
+	var indices []int
+	for _, field := range strings.Split(value, ",") {
+		i, err := strconv.Atoi(strings.TrimSpace(field))
+		if err != nil || i < 0 || i >= len(rules) {
+			return nil, fmt.Errorf("route %s: invalid %s annotation %q (want comma-separated rule indices)", route.Metadata.Name, unmanagedAnnotationKey, value)
+		}
+		indices = append(indices, i)
+	}
+	sort.Ints(indices)
+	var kept []any
+	for n, i := range indices {
+		if n > 0 && indices[n-1] == i {
+			continue
+		}
+		kept = append(kept, rules[i])
+	}
+	return kept, nil
+}
+
+// mergeUnmanaged appends the hand-written rules of the existing route to the
+// encoded node of the regenerated one and points the annotation at their
+// new positions. Rules are kept as generic YAML so fields this tool does
+// not model survive.
+func mergeUnmanaged(ctx context.Context, route *HTTPRoute, encode func() (*yaml.Node, error)) (*yaml.Node, error) {
+	kept, err := unmanagedRules(ctx, *route)
+	if err != nil {
+		return nil, err
+	}
+	if len(kept) > 0 {
+		var positions []string
+		for i := range kept {
+			positions = append(positions, strconv.Itoa(len(route.Spec.Rules)+i))
+		}
+		if route.Metadata.Annotations == nil {
+			route.Metadata.Annotations = make(map[string]string)
+		}
+		route.Metadata.Annotations[unmanagedAnnotationKey] = strings.Join(positions, ",")
+	}
+	node, err := encode()
+	if err != nil || len(kept) == 0 {
+		return node, err
+	}
+	rules := mappingValue(mappingValue(node, "spec"), "rules")
+	if rules == nil {
+		return nil, fmt.Errorf("route %s: generated route has no rules to merge into", route.Metadata.Name)
+	}
+	for _, rule := range kept {
+		var n yaml.Node
+		if err := n.Encode(rule); err != nil {
+			return nil, err
+		}
+		rules.Content = append(rules.Content, &n)
+	}
+	return node, nil
+}
+
+// mappingValue returns the value node of key in a mapping node, or nil.
+func mappingValue(node *yaml.Node, key string) *yaml.Node {
+	if node == nil {
+		return nil
+	}
+	if node.Kind == yaml.DocumentNode && len(node.Content) > 0 {
+		node = node.Content[0]
+	}
+	if node.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return node.Content[i+1]
+		}
+	}
+	return nil
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	logFiles     []string
+	logWindow    time.Duration
+	failOnUnused bool
+)
+
+func newUnusedCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "unused",
+		Short: "Report rules that received no traffic according to gateway access logs",
+		Long: `Builds the routes from the CSV inventory in memory, replays the requests found
+in gateway access logs against them, and reports every rule that received zero
+traffic within --window, to guide inventory cleanup.
+
+Supported log formats (detected per line): Envoy's default text format, Common
+and Combined Log Format (nginx, Apache), and JSON lines with method/path and
+optionally authority/host and start_time/timestamp fields.`,
+		RunE: runUnused,
+	}
+	cmd.Flags().StringVarP(&serviceName, "service", "s", "my-service", "Default backend service name")
+	cmd.Flags().IntVarP(&servicePort, "port", "p", 80, "Default backend service port")
+	cmd.Flags().StringSliceVar(&logFiles, "logs", nil, "Gateway access log files to analyze (repeatable)")
+	cmd.Flags().DurationVar(&logWindow, "window", 0, "Only count log entries newer than this (e.g. 720h); 0 counts all")
+	cmd.Flags().BoolVar(&failOnUnused, "fail-on-unused", false, "Exit non-zero if any rule received no traffic")
+	addGenerateFlags(cmd.Flags(), "generated")
+	_ = cmd.MarkFlagRequired("logs")
+	return cmd
+}
+
+func runUnused(cmd *cobra.Command, args []string) error {
+	if err := prepareGeneration(cmd.Context()); err != nil {
+		return err
+	}
+	table, err := loadRoutingTable(cmd.Context())
+	if err != nil {
+		return err
+	}
+
+	var since time.Time
+	if logWindow > 0 {
+		since = time.Now().Add(-logWindow)
+	}
+
+	var total, skipped, outside, unmatched int
+	for _, path := range logFiles {
+		err := scanAccessLog(path, func(entry accessLogEntry, ok bool) {
+			total++
+			switch {
+			case !ok:
+				skipped++
+			case !since.IsZero() && !entry.Time.IsZero() && entry.Time.Before(since):
+				outside++
+			default:
+				if r := table.match(entry.Request); r != nil {
+					r.Hits++
+				} else {
+					unmatched++
+				}
+			}
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	fmt.Printf("Log entries:    %d\n", total)
+	fmt.Printf("Unparseable:    %d\n", skipped)
+	if !since.IsZero() {
+		fmt.Printf("Outside window: %d (before %s)\n", outside, since.Format(time.RFC3339))
+	}
+	fmt.Printf("Unmatched:      %d\n", unmatched)
+
+	var unused []*simRule
+	for _, r := range table.rules {
+		if r.Hits == 0 {
+			unused = append(unused, r)
+		}
+	}
+	fmt.Printf("Rules without traffic: %d of %d\n", len(unused), len(table.rules))
+	for _, r := range unused {
+		fmt.Printf("  %s\n", r)
+	}
+
+	if failOnUnused && len(unused) > 0 {
+		return fmt.Errorf("%d rule(s) received no traffic", len(unused))
+	}
+	return nil
+}
+
+// accessLogEntry is a request recovered from one access log line.
+type accessLogEntry struct {
+	Request simRequest
+	Time    time.Time
+}
+
+var (
+	logRequestRe = regexp.MustCompile(`"([A-Z]+) (\S+) HTTP/[0-9.]+"`)
+	logTimeRe    = regexp.MustCompile(`\[([^\]]+)\]`)
+)
+
+// scanAccessLog calls fn for every non-empty line of path; ok is false for
+// lines no known format could parse.
+func scanAccessLog(path string, fn func(entry accessLogEntry, ok bool)) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+		entry, ok := parseAccessLogLine(text)
+		entry.Request.Line = line
+		fn(entry, ok)
+	}
+	return scanner.Err()
+}
+
+func parseAccessLogLine(text string) (accessLogEntry, bool) {
+	if strings.HasPrefix(text, "{") {
+		return parseJSONLogLine(text)
+	}
+
+	var entry accessLogEntry
+	m := logRequestRe.FindStringSubmatch(text)
+	if m == nil {
+		return entry, false
+	}
+	entry.Request.Method = m[1]
+	entry.Request.Path, _, _ = strings.Cut(m[2], "?")
+
+	if t := logTimeRe.FindStringSubmatch(text); t != nil {
+		for _, layout := range []string{time.RFC3339Nano, "02/Jan/2006:15:04:05 -0700"} {
+			if ts, err := time.Parse(layout, t[1]); err == nil {
+				entry.Time = ts
+				break
+			}
+		}
+	}
+	return entry, true
+}
+
+func parseJSONLogLine(text string) (accessLogEntry, bool) {
+	var entry accessLogEntry
+	var fields map[string]any
+	if err := json.Unmarshal([]byte(text), &fields); err != nil {
+		return entry, false
+	}
+	str := func(keys ...string) string {
+		for _, k := range keys {
+			if v, ok := fields[k].(string); ok && v != "" && v != "-" {
+				return v
+			}
+		}
+		return ""
+	}
+
+	entry.Request.Method = strings.ToUpper(str("method", ":method", "request_method"))
+	path := str("x-envoy-origin-path", "path", ":path", "request_uri", "uri")
+	if entry.Request.Method == "" || path == "" {
+		return entry, false
+	}
+	entry.Request.Path, _, _ = strings.Cut(path, "?")
+	entry.Request.Host, _, _ = strings.Cut(str("authority", ":authority", "host"), ":")
+	if ts, err := time.Parse(time.RFC3339Nano, str("start_time", "timestamp", "time", "@timestamp")); err == nil {
+		entry.Time = ts
+	}
+	return entry, true
+}
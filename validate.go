@@ -0,0 +1,271 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"k8s.io/apimachinery/pkg/util/validation"
+
+	"github.com/arencloud/csv2httproute/pkg/convert"
+)
+
+// Checks of the validator, as reported in findings.
+const (
+	checkParse       = "parse"
+	checkMethod      = "method"
+	checkPath        = "path"
+	checkPrefix      = "prefix"
+	checkDuplicate   = "duplicate"
+	checkHostname    = "hostname"
+	checkNameLength  = "name-length"
+	checkMatchValue  = "match-value"
+	checkPortability = "portability"
+	checkGenerate    = "generate"
+)
+
+// maxResourceName is the longest name of a Kubernetes object, a DNS
+// subdomain.
+const maxResourceName = validation.DNS1123SubdomainMaxLength
+
+var (
+	// strictInputs is --strict: fail a CSV with any validation finding.
+	strictInputs   bool
+	validateFormat string
+)
+
+// validationRun collects the findings of the validate subcommand, which
+// reports them instead of failing the files they are found in. It is nil
+// outside of validate.
+var validationRun *validationReport
+
+// seenRows maps the requests of the rows of a run to the first row routing
+// them, for the duplicate check.
+var seenRows = make(map[string]finding)
+
+// finding is one problem found in an input row or a generated route.
+type finding struct {
+	File    string `json:"file"`
+	Line    int    `json:"line,omitempty"`
+	Check   string `json:"check"`
+	Message string `json:"message"`
+}
+
+func (f finding) String() string {
+	loc := f.File
+	if f.Line > 0 {
+		loc += ":" + strconv.Itoa(f.Line)
+	}
+	return fmt.Sprintf("%s: %s: %s", loc, f.Check, f.Message)
+}
+
+type validationReport struct {
+	Findings []finding `json:"findings"`
+}
+
+func newValidateCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "validate",
+		Short: "Lint the CSV inventory and the routes generated from it",
+		Long: `Parses the CSV inventory and generates its routes in memory, then reports
+every problem found instead of stopping at the first one:
+
+  parse        a file or row the parser rejects (the first one of its file)
+  method       an invalid HTTP method
+  path         a URL or prefix without a leading slash
+  prefix       a row whose URL is not below its prefix
+  duplicate    a method and path routed by an earlier row for the same target
+  hostname     a hostname that is not an RFC 1123 DNS name
+  name-length  a generated resource name longer than 253 characters
+  match-value  a generated path, header or query parameter match longer
+               than Gateway API allows, or with a control character
+  portability  with --portability, a construct whose behavior varies
+               across implementations
+  generate     any other error generating the routes of a file
+
+Findings are printed as FILE:LINE: CHECK: MESSAGE, or as JSON with
+--format json, and make the command exit non-zero. Nothing is written;
+generation with --strict fails on the same findings.`,
+		RunE: runValidate,
+		// Findings are the expected failure, and the usage would bury them.
+		SilenceUsage: true,
+	}
+	cmd.Flags().StringVarP(&serviceName, "service", "s", "my-service", "Default backend service name")
+	cmd.Flags().IntVarP(&servicePort, "port", "p", 80, "Default backend service port")
+	cmd.Flags().StringVar(&validateFormat, "format", "text", "Report format: text or json")
+	addGenerateFlags(cmd.Flags(), "generated")
+	return cmd
+}
+
+func runValidate(cmd *cobra.Command, args []string) error {
+	if validateFormat != "text" && validateFormat != "json" {
+		return fmt.Errorf("invalid --format %q (must be text or json)", validateFormat)
+	}
+	tmp, err := os.MkdirTemp("", "csv2httproute-validate-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmp)
+
+	committed := outputDir
+	outputDir = tmp
+	generateOnly()
+	metricsFile, debugBundle = "", ""
+	existingOutputDir = committed
+	validationRun = &validationReport{Findings: []finding{}}
+	defer func() { validationRun = nil }()
+	err = generate(cmd)
+	outputDir, existingOutputDir = committed, ""
+	if err != nil {
+		return err
+	}
+
+	report := validationRun
+	sort.SliceStable(report.Findings, func(i, j int) bool {
+		a, b := report.Findings[i], report.Findings[j]
+		if a.File != b.File {
+			return a.File < b.File
+		}
+		return a.Line < b.Line
+	})
+	if validateFormat == "json" {
+		data, err := json.MarshalIndent(report, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(data))
+	} else {
+		for _, f := range report.Findings {
+			fmt.Println(f)
+		}
+	}
+	if n := len(report.Findings); n > 0 {
+		return fmt.Errorf("%d problem(s) found", n)
+	}
+	return nil
+}
+
+// reportFindings hands findings to the validate report, or with --strict turns
+// them into the error of the file.
+func reportFindings(findings []finding) error {
+	if validationRun != nil {
+		validationRun.Findings = append(validationRun.Findings, findings...)
+		return nil
+	}
+	if !strictInputs || len(findings) == 0 {
+		return nil
+	}
+	msgs := make([]string, len(findings))
+	for i, f := range findings {
+		msgs[i] = f.String()
+	}
+	return fmt.Errorf("--strict: %d problem(s):\n  %s", len(findings), strings.Join(msgs, "\n  "))
+}
+
+// parseFailure marks the error of a file that could not be parsed.
+type parseFailure struct{ error }
+
+func (f parseFailure) Unwrap() error { return f.error }
+
+// fileLine is the "line N: " an error of a file starts with.
+var fileLine = regexp.MustCompile(`^line (\d+): `)
+
+// reportFileError records the error that failed path in the validate
+// report, and reports whether there is one to record in.
+func reportFileError(path string, err error) bool {
+	if validationRun == nil {
+		return false
+	}
+	f := finding{File: path, Check: checkGenerate, Message: err.Error()}
+	var methodErr *convert.MethodError
+	var parseErr parseFailure
+	if errors.As(err, &methodErr) {
+		f.Check = checkMethod
+	} else if errors.As(err, &parseErr) {
+		f.Check = checkParse
+	}
+	if m := fileLine.FindStringSubmatch(f.Message); m != nil {
+		f.Line, _ = strconv.Atoi(m[1])
+		f.Message = strings.TrimPrefix(f.Message, m[0])
+	}
+	validationRun.Findings = append(validationRun.Findings, f)
+	return true
+}
+
+// lintRows checks the rows parsed from path and remembers their requests
+// for the duplicate check of later rows.
+func lintRows(path string, endpoints []Endpoint) error {
+	if validationRun == nil && !strictInputs {
+		return nil
+	}
+	var findings []finding
+	add := func(e Endpoint, check, format string, args ...any) {
+		findings = append(findings, finding{File: path, Line: e.Line, Check: check, Message: fmt.Sprintf(format, args...)})
+	}
+	for _, e := range endpoints {
+		literal := e.MatchType != "RegularExpression" && (e.MatchType != "" || pathSyntax != "regex")
+		if literal && !strings.HasPrefix(e.URL, "/") {
+			add(e, checkPath, "url %q does not start with /", e.URL)
+		}
+		if e.Prefix != "" {
+			if !strings.HasPrefix(e.Prefix, "/") {
+				add(e, checkPath, "prefix %q does not start with /", e.Prefix)
+			} else if literal && !strings.HasPrefix(e.URL, e.Prefix) {
+				add(e, checkPrefix, "url %s is not below its prefix %s", e.URL, e.Prefix)
+			}
+		}
+
+		method := e.Method
+		if method == "" {
+			method = "*"
+		}
+		target := []string{e.Hostname, e.Gateway, e.GatewayNamespace}
+		if e.Hostname == "" && e.Gateway == "" {
+			target = []string{hostname, gatewayName, gatewayNamespace}
+		}
+		key := strings.Join(append(target, flagOr(e.Namespace, namespace), method, e.MatchType, e.URL, e.Headers, e.QueryParams, e.Accept, e.ContentType, e.Cookie), "\x00")
+		if first, ok := seenRows[key]; ok {
+			add(e, checkDuplicate, "%s %s is already routed by %s", method, e.URL, first.location())
+			continue
+		}
+		seenRows[key] = finding{File: path, Line: e.Line}
+	}
+	return reportFindings(findings)
+}
+
+func (f finding) location() string {
+	return fmt.Sprintf("%s:%d", f.File, f.Line)
+}
+
+// lintRoute checks the name and hostnames of a route generated from path.
+func lintRoute(name string, hostnames []string, path string) error {
+	if validationRun == nil && !strictInputs {
+		return nil
+	}
+	var findings []finding
+	if len(name) > maxResourceName {
+		findings = append(findings, finding{File: path, Check: checkNameLength,
+			Message: fmt.Sprintf("name %s... is %d characters, more than the %d of a Kubernetes name", name[:40], len(name), maxResourceName)})
+	}
+	for _, h := range hostnames {
+		if msg := hostnameProblem(h); msg != "" {
+			findings = append(findings, finding{File: path, Check: checkHostname, Message: fmt.Sprintf("route %s: %s", name, msg)})
+		}
+	}
+	return reportFindings(findings)
+}
+
+// hostnameProblem describes what makes h no RFC 1123 hostname. A leading
+// "*." wildcard label is allowed, as in Gateway API hostnames.
+func hostnameProblem(h string) string {
+	if len(validation.IsDNS1123Subdomain(strings.TrimPrefix(h, "*."))) == 0 {
+		return ""
+	}
+	return fmt.Sprintf("hostname %q is not a valid RFC 1123 DNS name (lower case letters, digits, - and . only)", h)
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestValidateFindingsWithoutUsage(t *testing.T) {
+	dir := t.TempDir()
+	csv := "Method,URL,Prefix\nGET,/api/v1/users,/user\n"
+	if err := os.WriteFile(filepath.Join(dir, "users.csv"), []byte(csv), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	resetRunState()
+	cmd := newRootCmd()
+	var out bytes.Buffer
+	cmd.SetOut(&out)
+	cmd.SetErr(&out)
+	cmd.SetArgs([]string{"validate", "--input", dir, "--env-file", ""})
+	if err := cmd.Execute(); err == nil {
+		t.Fatal("validate passed a row outside its prefix")
+	}
+	if strings.Contains(out.String(), "Usage:") {
+		t.Errorf("validate printed the usage with its findings:\n%s", out.String())
+	}
+}
+
+func TestExtraMethodsHTTPRoute(t *testing.T) {
+	dir := t.TempDir()
+	input := filepath.Join(dir, "endpoints")
+	if err := os.Mkdir(input, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	csv := "Method,URL\nGET,/orders\nFETCH,/orders/sync\n"
+	if err := os.WriteFile(filepath.Join(input, "orders.csv"), []byte(csv), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	err := runCommand(t, "--input", input, "--output", filepath.Join(dir, "routes"), "--extra-methods", "fetch", "--env-file", "")
+	if err == nil {
+		t.Fatal("an HTTPRoute was generated with a method its CRD rejects")
+	}
+	out := filepath.Join(dir, "virtualservices")
+	if err := runCommand(t, "--input", input, "--output", out, "--extra-methods", "fetch", "--output-kind", "virtualservice", "--env-file", ""); err != nil {
+		t.Fatalf("--output-kind virtualservice: %v", err)
+	}
+	data, err := os.ReadFile(filepath.Join(out, "orders.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), "exact: FETCH") {
+		t.Errorf("VirtualService does not match FETCH:\n%s", data)
+	}
+}
@@ -0,0 +1,267 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/arencloud/csv2httproute/pkg/convert"
+)
+
+// testVectorsFile is --test-vectors: a JSON file of test vectors for the
+// rules that transform requests or responses, for conformance harnesses
+// that check the gateway applies what was generated.
+var testVectorsFile string
+
+// testVectors collects the vectors of the generated routes during a run.
+var testVectors []testVector
+
+// vectorDoc is the document written to --test-vectors.
+type vectorDoc struct {
+	Generator string       `json:"generator"`
+	Version   string       `json:"version"`
+	Vectors   []testVector `json:"vectors"`
+}
+
+// testVector is one request a rule matches and what the gateway must make
+// of it: the request reaching the backend and the response headers.
+type testVector struct {
+	Route     string          `json:"route"`
+	Namespace string          `json:"namespace,omitempty"`
+	Rule      int             `json:"rule"`
+	Request   vectorRequest   `json:"request"`
+	Upstream  vectorUpstream  `json:"upstream"`
+	Response  *vectorMessages `json:"response,omitempty"`
+}
+
+type vectorRequest struct {
+	Method  string            `json:"method"`
+	Host    string            `json:"host,omitempty"`
+	Path    string            `json:"path"`
+	Query   map[string]string `json:"query,omitempty"`
+	Headers map[string]string `json:"headers,omitempty"`
+}
+
+// vectorUpstream is the request expected at one of Backends.
+type vectorUpstream struct {
+	Backends []string `json:"backends"`
+	Method   string   `json:"method"`
+	Path     string   `json:"path"`
+	vectorMessages
+}
+
+// vectorMessages are the headers a message must carry and must not carry.
+type vectorMessages struct {
+	Headers       map[string]string `json:"headers,omitempty"`
+	AbsentHeaders []string          `json:"absentHeaders,omitempty"`
+}
+
+// vectorSuffix is appended to the paths of prefix matches that are
+// rewritten, so the vector shows what happens to the rest of the path.
+const vectorSuffix = "vector"
+
+// collectTestVectors adds a vector for every match of the rules of route
+// that rewrite the path or modify headers. Regular expression matches get
+// none, since no request can be derived from them reliably; redirecting
+// rules never reach a backend.
+func collectTestVectors(route HTTPRoute) {
+	host := ""
+	if len(route.Spec.Hostnames) > 0 {
+		host = route.Spec.Hostnames[0]
+		if strings.HasPrefix(host, "*.") {
+			host = "www" + host[1:]
+		}
+	}
+	for i, rule := range route.Spec.Rules {
+		if !transformsMessages(rule) {
+			continue
+		}
+		matches := rule.Matches
+		if len(matches) == 0 {
+			matches = []HTTPRouteMatch{{}}
+		}
+		for _, m := range matches {
+			req, ok := vectorRequestFor(m, rule)
+			if !ok {
+				continue
+			}
+			req.Host = host
+			testVectors = append(testVectors, testVector{
+				Route:     route.Metadata.Name,
+				Namespace: route.Metadata.Namespace,
+				Rule:      i,
+				Request:   req,
+				Upstream:  vectorUpstreamFor(req, m, rule),
+				Response:  vectorResponseFor(rule),
+			})
+		}
+	}
+}
+
+// transformsMessages reports whether rule rewrites or modifies headers, and
+// forwards to a backend.
+func transformsMessages(rule HTTPRouteRule) bool {
+	transforms := false
+	for _, f := range rule.Filters {
+		switch {
+		case f.RequestRedirect != nil:
+			return false
+		case f.URLRewrite != nil, f.RequestHeaderModifier != nil, f.ResponseHeaderModifier != nil:
+			transforms = true
+		}
+	}
+	return transforms
+}
+
+// vectorRequestFor derives a request that m matches.
+func vectorRequestFor(m HTTPRouteMatch, rule HTTPRouteRule) (vectorRequest, bool) {
+	req := vectorRequest{Method: m.Method, Path: "/"}
+	if req.Method == "" {
+		req.Method = "GET"
+	}
+	if m.Path != nil {
+		switch m.Path.Type {
+		case "RegularExpression":
+			return vectorRequest{}, false
+		case "Exact":
+			req.Path = m.Path.Value
+		default:
+			req.Path = m.Path.Value
+			if rewritesPrefix(rule) {
+				req.Path = path.Join(m.Path.Value, vectorSuffix)
+			}
+		}
+	}
+	for _, h := range m.Headers {
+		value := h.Value
+		if h.Type == "RegularExpression" {
+			// A media type match is met by a request of its first type, a
+			// cookie match by a request with just the cookie
+			_, list, ok := convert.MediaTypesOf(h)
+			if cookie, isCookie := convert.CookieOf(h); isCookie {
+				list, ok = cookie, true
+			}
+			if !ok {
+				return vectorRequest{}, false
+			}
+			value, _, _ = strings.Cut(list, ",")
+		}
+		if req.Headers == nil {
+			req.Headers = make(map[string]string)
+		}
+		req.Headers[h.Name] = value
+	}
+	for _, q := range m.QueryParams {
+		if req.Query == nil {
+			req.Query = make(map[string]string)
+		}
+		req.Query[q.Name] = q.Value
+	}
+	return req, true
+}
+
+func rewritesPrefix(rule HTTPRouteRule) bool {
+	for _, f := range rule.Filters {
+		if f.URLRewrite != nil && f.URLRewrite.Path != nil && f.URLRewrite.Path.Type == "ReplacePrefixMatch" {
+			return true
+		}
+	}
+	return false
+}
+
+// vectorUpstreamFor applies the request filters of rule to req.
+func vectorUpstreamFor(req vectorRequest, m HTTPRouteMatch, rule HTTPRouteRule) vectorUpstream {
+	up := vectorUpstream{Backends: []string{}, Method: req.Method, Path: req.Path}
+	for _, b := range rule.BackendRefs {
+		if b.Standby {
+			continue
+		}
+		name := fmt.Sprintf("%s:%d", b.Name, b.Port)
+		if b.Namespace != "" {
+			name = b.Namespace + "/" + name
+		}
+		up.Backends = append(up.Backends, name)
+	}
+	for k, v := range req.Headers {
+		up.setHeader(k, v)
+	}
+	for _, f := range rule.Filters {
+		switch {
+		case f.URLRewrite != nil && f.URLRewrite.Path != nil:
+			up.Path = rewritePath(req.Path, m, *f.URLRewrite.Path)
+		case f.RequestHeaderModifier != nil:
+			up.modify(*f.RequestHeaderModifier)
+		}
+	}
+	return up
+}
+
+// vectorResponseFor is the headers the response filters of rule set, or nil.
+func vectorResponseFor(rule HTTPRouteRule) *vectorMessages {
+	var resp *vectorMessages
+	for _, f := range rule.Filters {
+		if f.ResponseHeaderModifier != nil {
+			if resp == nil {
+				resp = &vectorMessages{}
+			}
+			resp.modify(*f.ResponseHeaderModifier)
+		}
+	}
+	return resp
+}
+
+func (v *vectorMessages) setHeader(name, value string) {
+	if v.Headers == nil {
+		v.Headers = make(map[string]string)
+	}
+	v.Headers[name] = value
+}
+
+// modify applies a header filter; added headers are expected among the
+// values of the header, so they are listed like set ones.
+func (v *vectorMessages) modify(f HTTPHeaderFilter) {
+	for _, h := range f.Set {
+		v.setHeader(h.Name, h.Value)
+	}
+	for _, h := range f.Add {
+		v.setHeader(h.Name, h.Value)
+	}
+	v.AbsentHeaders = append(v.AbsentHeaders, f.Remove...)
+}
+
+// rewritePath applies a URLRewrite path modifier to p, which m matched.
+// ReplacePrefixMatch replaces the matched prefix on its segment boundary.
+func rewritePath(p string, m HTTPRouteMatch, rw PathRewrite) string {
+	if rw.Type == "ReplaceFullPath" {
+		return rw.ReplaceFullPath
+	}
+	prefix := ""
+	if m.Path != nil {
+		prefix = strings.TrimSuffix(m.Path.Value, "/")
+	}
+	rest := strings.TrimPrefix(strings.TrimPrefix(p, prefix), "/")
+	if rest == "" {
+		return rw.ReplacePrefixMatch
+	}
+	return strings.TrimSuffix(rw.ReplacePrefixMatch, "/") + "/" + rest
+}
+
+// writeTestVectors writes the vectors collected in this run.
+func writeTestVectors() error {
+	doc := vectorDoc{Generator: "csv2httproute", Version: Version, Vectors: testVectors}
+	if doc.Vectors == nil {
+		doc.Vectors = []testVector{}
+	}
+	data, err := json.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := writeOutputFile(testVectorsFile, append(data, '\n')); err != nil {
+		return err
+	}
+	if !quiet {
+		fmt.Printf("Generated %s\n", testVectorsFile)
+	}
+	return nil
+}
@@ -0,0 +1,591 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"embed"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"io/fs"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/tools/clientcmd"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+)
+
+// verify-cluster applies the generated objects to a throwaway cluster with
+// the Gateway API CRDs installed, so the OpenAPI and CEL validation of the
+// CRDs, which the generator only approximates, is run before the routes get
+// anywhere near a real cluster. The cluster is an envtest control plane
+// (etcd and kube-apiserver binaries, as installed by setup-envtest) or a
+// kind cluster.
+
+const (
+	clusterEnvtest = "envtest"
+	clusterKind    = "kind"
+
+	// gatewayAPIReleaseURL is the install manifest of a release, by version
+	// and channel.
+	gatewayAPIReleaseURL = "https://github.com/kubernetes-sigs/gateway-api/releases/download/%s/%s-install.yaml"
+
+	// envtestToken authenticates the kubeconfig of an envtest control plane
+	// as a cluster admin.
+	envtestToken = "csv2httproute-verify"
+)
+
+var (
+	// verifyClusterMode is verify-cluster --cluster, envtest or kind.
+	verifyClusterMode string
+	// envtestAssets is verify-cluster --assets, the directory with the etcd
+	// and kube-apiserver binaries of envtest.
+	envtestAssets string
+	// verifyCRDs is verify-cluster --crds, a file or URL of the CRDs to
+	// install instead of those of --gateway-api-version.
+	verifyCRDs string
+	// verifyStartTimeout is verify-cluster --start-timeout, how long the
+	// cluster and its CRDs may take to get ready.
+	verifyStartTimeout time.Duration
+)
+
+// crdsGVR is where the CRDs are installed.
+var crdsGVR = schema.GroupVersionResource{Group: "apiextensions.k8s.io", Version: "v1", Resource: "customresourcedefinitions"}
+
+func newVerifyClusterCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "verify-cluster",
+		Short: "Apply the generated routes to a throwaway cluster and report the objects it rejects",
+		Long: `Generates the routes from --input in memory, starts a throwaway cluster,
+installs the Gateway API CRDs and applies every generated object to it, so the
+validation of the CRDs, including their CEL rules, runs on the routes before
+they are applied to a real cluster. Objects the API server rejects are
+reported with its reasons, and make the command exit non-zero.
+
+With --cluster envtest (the default), the cluster is an etcd and
+kube-apiserver pair started from --assets, the binaries setup-envtest
+installs; KUBEBUILDER_ASSETS is used when --assets is not given. With
+--cluster kind, it is a kind cluster, deleted again afterwards; kind and a
+container runtime must be installed.
+
+The CRDs of the --channel of Gateway API release --gateway-api-version are
+installed, or those of --crds, a file or URL, e.g. to match the version the
+target clusters run. Releases built into the binary are installed from it,
+others are downloaded.`,
+		RunE: runVerifyCluster,
+	}
+	cmd.Flags().StringVarP(&serviceName, "service", "s", "my-service", "Default backend service name")
+	cmd.Flags().IntVarP(&servicePort, "port", "p", 80, "Default backend service port")
+	cmd.Flags().StringVar(&serviceNamespace, "service-namespace", "", "Namespace for the backend service")
+	cmd.Flags().StringVar(&verifyClusterMode, "cluster", clusterEnvtest, "Throwaway cluster to apply to: envtest or kind")
+	cmd.Flags().StringVar(&envtestAssets, "assets", "", "Directory with the etcd and kube-apiserver binaries of envtest (default $KUBEBUILDER_ASSETS)")
+	cmd.Flags().StringVar(&verifyCRDs, "crds", "", "File or URL of the Gateway API CRDs to install (default the release of --gateway-api-version)")
+	cmd.Flags().DurationVar(&verifyStartTimeout, "start-timeout", 2*time.Minute, "How long the cluster and its CRDs may take to get ready")
+	addGenerateFlags(cmd.Flags(), "generated")
+	return cmd
+}
+
+func runVerifyCluster(cmd *cobra.Command, _ []string) error {
+	if verifyClusterMode != clusterEnvtest && verifyClusterMode != clusterKind {
+		return fmt.Errorf("invalid --cluster %q (must be %s or %s)", verifyClusterMode, clusterEnvtest, clusterKind)
+	}
+	tmp, err := os.MkdirTemp("", "csv2httproute-verify-cluster-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmp)
+	generated := filepath.Join(tmp, "generated")
+
+	// As in diff, kept hand-written rules from --output are part of the
+	// routes that are verified.
+	output := outputDir
+	outputDir = generated
+	noHeaderComment = true
+	restore := generateOnlyFor()
+	existingOutputDir = output
+	err = run(cmd, nil)
+	outputDir, existingOutputDir = output, ""
+	restore()
+	if err != nil {
+		return err
+	}
+	objects, err := objectsInDir(generated)
+	if err != nil {
+		return err
+	}
+	if len(objects) == 0 {
+		return fmt.Errorf("no objects generated from the input")
+	}
+	crds, err := loadCRDs(cmd.Context(), tmp)
+	if err != nil {
+		return err
+	}
+
+	ctx := cmd.Context()
+	kubeconfig, stop, err := startCluster(ctx, tmp)
+	if stop != nil {
+		defer stop()
+	}
+	if err != nil {
+		return err
+	}
+	// Every cluster access of the run goes to the throwaway cluster.
+	savedPath, savedContext, savedUser, savedGroups := kubeconfigPath, kubeContext, impersonateUser, impersonateGroups
+	defer func() {
+		kubeconfigPath, kubeContext, impersonateUser, impersonateGroups = savedPath, savedContext, savedUser, savedGroups
+	}()
+	kubeconfigPath, kubeContext, impersonateUser, impersonateGroups = kubeconfig, "", "", nil
+	client, _, err := kubeDynamicClient()
+	if err != nil {
+		return err
+	}
+	if err := installCRDs(ctx, client, crds); err != nil {
+		return err
+	}
+	return verifyObjects(ctx, client, objects)
+}
+
+// objectsInDir returns the objects of the YAML files below dir, as applied.
+func objectsInDir(dir string) ([]*unstructured.Unstructured, error) {
+	var objects []*unstructured.Unstructured
+	err := filepath.WalkDir(dir, func(path string, d os.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		if ext := filepath.Ext(path); (ext != ".yaml" && ext != ".yml") || isPatchFile(path) {
+			return nil
+		}
+		objs, err := fileObjects(path)
+		if err != nil {
+			return err
+		}
+		objects = append(objects, objs...)
+		return nil
+	})
+	return objects, err
+}
+
+// embeddedCRDs are the install manifests of the Gateway API releases built
+// into the binary, as crds/<version>/<channel>-install.yaml, which are
+// installed instead of downloading the release.
+//
+//go:embed crds
+var embeddedCRDs embed.FS
+
+// loadCRDs reads the CRDs of --crds, or those of the Gateway API release,
+// embedded or downloaded to tmp first.
+func loadCRDs(ctx context.Context, tmp string) ([]*unstructured.Unstructured, error) {
+	source := verifyCRDs
+	var data []byte
+	if source == "" {
+		source = "crds/" + gatewayAPIVersion + "/" + gatewayChannel + "-install.yaml"
+		if data, _ = embeddedCRDs.ReadFile(source); data == nil {
+			source = fmt.Sprintf(gatewayAPIReleaseURL, gatewayAPIVersion, gatewayChannel)
+		}
+	}
+	if strings.HasPrefix(source, "http://") || strings.HasPrefix(source, "https://") {
+		if err := checkOfflineURL("downloading the CRDs", source); err != nil {
+			return nil, fmt.Errorf("%w; pass --crds, or a --gateway-api-version and --channel built in (%s)", err, embeddedCRDReleases())
+		}
+		var err error
+		if data, err = download(ctx, source); err != nil {
+			return nil, fmt.Errorf("failed to download the CRDs from %s: %w", source, err)
+		}
+	}
+	path := source
+	if data != nil {
+		path = filepath.Join(tmp, "crds.yaml")
+		if err := os.WriteFile(path, data, 0o644); err != nil {
+			return nil, err
+		}
+	}
+	objects, err := fileObjects(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the CRDs of %s: %w", source, err)
+	}
+	if !slices.ContainsFunc(objects, func(obj *unstructured.Unstructured) bool { return obj.GetKind() == "CustomResourceDefinition" }) {
+		return nil, fmt.Errorf("%s has no CustomResourceDefinitions", source)
+	}
+	return objects, nil
+}
+
+// embeddedCRDReleases lists the releases of embeddedCRDs as version/channel.
+func embeddedCRDReleases() string {
+	files, _ := fs.Glob(embeddedCRDs, "crds/*/*-install.yaml")
+	if len(files) == 0 {
+		return "none"
+	}
+	releases := make([]string, len(files))
+	for i, f := range files {
+		releases[i] = strings.TrimSuffix(strings.TrimPrefix(f, "crds/"), "-install.yaml")
+	}
+	return strings.Join(releases, ", ")
+}
+
+func download(ctx context.Context, url string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	client := &http.Client{Timeout: sourceTimeout}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("GET returned %s", resp.Status)
+	}
+	return io.ReadAll(resp.Body)
+}
+
+// startCluster starts the --cluster and returns the path of a kubeconfig
+// for it, and a function stopping it, which is to be called even when
+// starting failed.
+func startCluster(ctx context.Context, tmp string) (string, func(), error) {
+	if verifyClusterMode == clusterKind {
+		return startKind(ctx, tmp)
+	}
+	return startEnvtest(ctx, tmp)
+}
+
+// startKind creates a kind cluster named after the process, and deletes it
+// when stopped.
+func startKind(ctx context.Context, tmp string) (string, func(), error) {
+	if _, err := exec.LookPath(clusterKind); err != nil {
+		return "", nil, fmt.Errorf("--cluster kind needs the kind CLI: %w", err)
+	}
+	name := fmt.Sprintf("csv2httproute-verify-%d", os.Getpid())
+	kubeconfig := filepath.Join(tmp, "kubeconfig")
+	if !quiet {
+		fmt.Printf("Creating kind cluster %s\n", name)
+	}
+	create := exec.CommandContext(ctx, clusterKind, "create", "cluster", "--name", name,
+		"--kubeconfig", kubeconfig, "--wait", verifyStartTimeout.String())
+	out, err := create.CombinedOutput()
+	stop := func() {
+		if out, err := exec.Command(clusterKind, "delete", "cluster", "--name", name).CombinedOutput(); err != nil {
+			fmt.Fprintf(os.Stderr, "WARNING: failed to delete kind cluster %s: %v\n%s", name, err, out)
+		}
+	}
+	if err != nil {
+		return "", stop, fmt.Errorf("failed to create kind cluster: %w\n%s", err, out)
+	}
+	return kubeconfig, stop, nil
+}
+
+// startEnvtest starts etcd and kube-apiserver from the --assets, on free
+// local ports with their state in tmp, and stops them when stopped. The
+// kubeconfig authenticates with a static token of a cluster admin.
+func startEnvtest(ctx context.Context, tmp string) (string, func(), error) {
+	assets := envtestAssets
+	if assets == "" {
+		assets = os.Getenv("KUBEBUILDER_ASSETS")
+	}
+	if assets == "" {
+		return "", nil, fmt.Errorf("--cluster envtest needs --assets or KUBEBUILDER_ASSETS, the directory setup-envtest installs etcd and kube-apiserver to (e.g. $(setup-envtest use -p path))")
+	}
+	for _, bin := range []string{"etcd", "kube-apiserver"} {
+		if _, err := os.Stat(filepath.Join(assets, bin)); err != nil {
+			return "", nil, fmt.Errorf("envtest assets: %w", err)
+		}
+	}
+	ports, err := freePorts(3)
+	if err != nil {
+		return "", nil, err
+	}
+	etcdURL := "http://127.0.0.1:" + strconv.Itoa(ports[0])
+	server := "https://127.0.0.1:" + strconv.Itoa(ports[2])
+
+	tokens := filepath.Join(tmp, "tokens.csv")
+	if err := os.WriteFile(tokens, []byte(envtestToken+",admin,admin,system:masters\n"), 0o600); err != nil {
+		return "", nil, err
+	}
+	saKey, saPub, err := writeServiceAccountKeys(tmp)
+	if err != nil {
+		return "", nil, err
+	}
+
+	// exited receives the error of the first process that exits; stop
+	// kills the others and waits for all of them.
+	var procs []*exec.Cmd
+	exited := make(chan error, 2)
+	stop := func() {
+		for _, proc := range slices.Backward(procs) {
+			proc.Process.Kill()
+		}
+		for range procs {
+			<-exited
+		}
+	}
+	start := func(name string, args ...string) error {
+		log, err := os.Create(filepath.Join(tmp, name+".log"))
+		if err != nil {
+			return err
+		}
+		proc := exec.Command(filepath.Join(assets, name), args...)
+		proc.Stdout, proc.Stderr = log, log
+		if err := proc.Start(); err != nil {
+			log.Close()
+			return fmt.Errorf("failed to start %s: %w", name, err)
+		}
+		procs = append(procs, proc)
+		go func() {
+			err := proc.Wait()
+			log.Close()
+			exited <- fmt.Errorf("%s exited: %v", name, err)
+		}()
+		return nil
+	}
+	if !quiet {
+		fmt.Printf("Starting envtest control plane from %s\n", assets)
+	}
+	err = start("etcd",
+		"--data-dir", filepath.Join(tmp, "etcd"),
+		"--listen-client-urls", etcdURL,
+		"--advertise-client-urls", etcdURL,
+		"--listen-peer-urls", "http://127.0.0.1:"+strconv.Itoa(ports[1]),
+		"--unsafe-no-fsync")
+	if err == nil {
+		err = start("kube-apiserver",
+			"--etcd-servers", etcdURL,
+			"--bind-address", "127.0.0.1",
+			"--secure-port", strconv.Itoa(ports[2]),
+			"--cert-dir", filepath.Join(tmp, "certs"),
+			"--token-auth-file", tokens,
+			"--authorization-mode", "RBAC",
+			"--service-account-issuer", "https://kubernetes.default.svc",
+			"--service-account-key-file", saPub,
+			"--service-account-signing-key-file", saKey,
+			"--service-cluster-ip-range", "10.0.0.0/24",
+			"--disable-admission-plugins", "ServiceAccount",
+			"--allow-privileged")
+	}
+	if err == nil {
+		err = waitReady(ctx, server, exited)
+	}
+	if err != nil {
+		if log, _ := os.ReadFile(filepath.Join(tmp, "kube-apiserver.log")); len(log) > 0 {
+			err = fmt.Errorf("%w\nkube-apiserver log:\n%s", err, lastLines(string(log), 20))
+		}
+		return "", stop, err
+	}
+
+	kubeconfig := filepath.Join(tmp, "kubeconfig")
+	config := clientcmdapi.NewConfig()
+	config.Clusters[clusterEnvtest] = &clientcmdapi.Cluster{Server: server, InsecureSkipTLSVerify: true}
+	config.AuthInfos[clusterEnvtest] = &clientcmdapi.AuthInfo{Token: envtestToken}
+	config.Contexts[clusterEnvtest] = &clientcmdapi.Context{Cluster: clusterEnvtest, AuthInfo: clusterEnvtest}
+	config.CurrentContext = clusterEnvtest
+	if err := clientcmd.WriteToFile(*config, kubeconfig); err != nil {
+		return "", stop, err
+	}
+	return kubeconfig, stop, nil
+}
+
+// freePorts reserves n free local ports and releases them for the control
+// plane to listen on.
+func freePorts(n int) ([]int, error) {
+	var ports []int
+	for range n {
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			return nil, err
+		}
+		defer l.Close()
+		ports = append(ports, l.Addr().(*net.TCPAddr).Port)
+	}
+	return ports, nil
+}
+
+// writeServiceAccountKeys writes the key pair kube-apiserver signs and
+// verifies service account tokens with, returning the private and public
+// key files.
+func writeServiceAccountKeys(dir string) (string, string, error) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return "", "", err
+	}
+	pub, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		return "", "", err
+	}
+	keyFile, pubFile := filepath.Join(dir, "sa.key"), filepath.Join(dir, "sa.pub")
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+	if err := os.WriteFile(keyFile, keyPEM, 0o600); err != nil {
+		return "", "", err
+	}
+	if err := os.WriteFile(pubFile, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pub}), 0o644); err != nil {
+		return "", "", err
+	}
+	return keyFile, pubFile, nil
+}
+
+// waitReady polls the /readyz of the API server at server for at most
+// --start-timeout, failing early when a control plane process exits.
+func waitReady(ctx context.Context, server string, exited chan error) error {
+	client := &http.Client{
+		Timeout:   5 * time.Second,
+		Transport: &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}},
+	}
+	deadline := time.Now().Add(verifyStartTimeout)
+	for {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, server+"/readyz", nil)
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Authorization", "Bearer "+envtestToken)
+		if resp, err := client.Do(req); err == nil {
+			resp.Body.Close()
+			if resp.StatusCode == http.StatusOK {
+				return nil
+			}
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("kube-apiserver not ready after %s", verifyStartTimeout)
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case err := <-exited:
+			// stop waits for it too.
+			exited <- err
+			return err
+		case <-time.After(applyPollInterval):
+		}
+	}
+}
+
+func lastLines(s string, n int) string {
+	lines := strings.Split(strings.TrimRight(s, "\n"), "\n")
+	return strings.Join(lines[max(0, len(lines)-n):], "\n")
+}
+
+// installCRDs applies crds, and the other objects of their manifest, and
+// waits for the CRDs to be established.
+func installCRDs(ctx context.Context, client dynamic.Interface, crds []*unstructured.Unstructured) error {
+	var names []string
+	for _, obj := range crds {
+		gvr, _ := meta.UnsafeGuessKindToResource(obj.GroupVersionKind())
+		res := client.Resource(gvr).Namespace(obj.GetNamespace())
+		err := retryCluster(ctx, objectRef(obj), 30*time.Second, func(ctx context.Context) error {
+			_, err := applyObject(ctx, res, obj)
+			return err
+		})
+		if err != nil {
+			return fmt.Errorf("failed to install %s: %w", objectRef(obj), err)
+		}
+		if obj.GetKind() == "CustomResourceDefinition" {
+			names = append(names, obj.GetName())
+		}
+	}
+	deadline := time.Now().Add(verifyStartTimeout)
+	for _, name := range names {
+		for {
+			crd, err := client.Resource(crdsGVR).Get(ctx, name, metav1.GetOptions{})
+			if err != nil && !apierrors.IsNotFound(err) {
+				return err
+			}
+			if err == nil && crdEstablished(crd) {
+				break
+			}
+			if time.Now().After(deadline) {
+				return fmt.Errorf("CustomResourceDefinition %s not established after %s", name, verifyStartTimeout)
+			}
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(applyPollInterval):
+			}
+		}
+	}
+	if !quiet {
+		fmt.Printf("Installed %d CustomResourceDefinition(s)\n", len(names))
+	}
+	return nil
+}
+
+func crdEstablished(crd *unstructured.Unstructured) bool {
+	conditions, _, _ := unstructured.NestedSlice(crd.Object, "status", "conditions")
+	for _, c := range listOfMaps(conditions) {
+		if c["type"] == "Established" && c["status"] == "True" {
+			return true
+		}
+	}
+	return false
+}
+
+// verifyObjects applies objects in the stages of --apply, after creating
+// the namespaces they are in, and reports every one the API server
+// rejects, with its reason.
+func verifyObjects(ctx context.Context, client dynamic.Interface, objects []*unstructured.Unstructured) error {
+	var namespaces []string
+	for _, obj := range objects {
+		if ns := obj.GetNamespace(); ns != "" && !slices.Contains(namespaces, ns) {
+			namespaces = append(namespaces, ns)
+		}
+	}
+	for _, ns := range namespaces {
+		obj := &unstructured.Unstructured{}
+		obj.SetAPIVersion("v1")
+		obj.SetKind("Namespace")
+		obj.SetName(ns)
+		_, err := client.Resource(namespacesGVR).Create(ctx, obj, metav1.CreateOptions{})
+		if err != nil && !apierrors.IsAlreadyExists(err) {
+			return fmt.Errorf("failed to create Namespace %s: %w", ns, err)
+		}
+	}
+
+	var rejected []string
+	for _, stage := range stageObjects(objects) {
+		for _, obj := range stage {
+			ref := objectRef(obj)
+			gvr, _ := meta.UnsafeGuessKindToResource(obj.GroupVersionKind())
+			res := client.Resource(gvr).Namespace(obj.GetNamespace())
+			err := retryCluster(ctx, ref, 30*time.Second, func(ctx context.Context) error {
+				_, err := applyObject(ctx, res, obj)
+				return err
+			})
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			if err != nil {
+				reason := failureReason(err)
+				if apierrors.IsNotFound(err) {
+					// The kind has no CRD in the installed ones, such as
+					// TLSRoute outside the experimental channel.
+					reason = "NotFound"
+					err = fmt.Errorf("%s is not served by the installed CRDs", obj.GetAPIVersion()+" "+obj.GetKind())
+				}
+				fmt.Printf("%s %s: %v\n", colorize(ansiRed, "REJECTED"), ref, err)
+				rejected = append(rejected, fmt.Sprintf("%s (%s)", ref, reason))
+				continue
+			}
+			if !quiet {
+				fmt.Printf("%s %s\n", colorize(ansiGreen, "ACCEPTED"), ref)
+			}
+		}
+	}
+	fmt.Printf("%d of %d object(s) accepted\n", len(objects)-len(rejected), len(objects))
+	if len(rejected) > 0 {
+		return fmt.Errorf("%d object(s) rejected: %s", len(rejected), strings.Join(rejected, ", "))
+	}
+	return nil
+}
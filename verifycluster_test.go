@@ -0,0 +1,57 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// TestLoadEmbeddedCRDsOffline checks that verify-cluster installs the CRDs of
+// the default release from the binary, without the network.
+func TestLoadEmbeddedCRDsOffline(t *testing.T) {
+	defer func(v, channel, crds string, off bool) {
+		gatewayAPIVersion, gatewayChannel, verifyCRDs, offline = v, channel, crds, off
+	}(gatewayAPIVersion, gatewayChannel, verifyCRDs, offline)
+	gatewayAPIVersion, verifyCRDs, offline = defaultGatewayAPIVersion, "", true
+
+	for channel, kinds := range map[string][]string{
+		channelStandard:     {"HTTPRoute", "GRPCRoute", "ReferenceGrant", "Gateway", "GatewayClass"},
+		channelExperimental: {"HTTPRoute", "TLSRoute", "BackendTLSPolicy", "ReferenceGrant"},
+	} {
+		t.Run(channel, func(t *testing.T) {
+			gatewayChannel = channel
+			objects, err := loadCRDs(context.Background(), t.TempDir())
+			if err != nil {
+				t.Fatalf("loadCRDs: %v", err)
+			}
+			for _, kind := range kinds {
+				if !hasCRD(objects, kind) {
+					t.Errorf("no CRD of %s", kind)
+				}
+			}
+		})
+	}
+}
+
+func TestLoadCRDsOfflineNotEmbedded(t *testing.T) {
+	defer func(v, crds string, off bool) {
+		gatewayAPIVersion, verifyCRDs, offline = v, crds, off
+	}(gatewayAPIVersion, verifyCRDs, offline)
+	gatewayAPIVersion, verifyCRDs, offline = "v0.9.9", "", true
+	if _, err := loadCRDs(context.Background(), t.TempDir()); err == nil {
+		t.Error("loadCRDs downloaded a release that is not built in with --offline")
+	}
+}
+
+func hasCRD(objects []*unstructured.Unstructured, kind string) bool {
+	for _, obj := range objects {
+		if obj.GetKind() != "CustomResourceDefinition" {
+			continue
+		}
+		if k, _, _ := unstructured.NestedString(obj.Object, "spec", "names", "kind"); k == kind {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+var (
+	groupByVersion  bool
+	versionBackends []string
+)
+
+// versionBackendMap holds the parsed --version-backend mappings, keyed by
+// version.
+var versionBackendMap map[string]BackendRef
+
+// versionSegment matches API version path segments such as v1, v2 or
+// v1beta1 / v2alpha.
+var versionSegment = regexp.MustCompile(`^v[0-9]+((alpha|beta)[0-9]*)?$`)
+
+// apiVersion returns the first version segment of the row's URL, or "".
+func apiVersion(e Endpoint) string {
+	for _, seg := range strings.Split(e.URL, "/") {
+		if versionSegment.MatchString(seg) {
+			return seg
+		}
+	}
+	return ""
+}
+
+// loadVersionBackends parses the version=service[:port] mappings of
+// --version-backend.
+func loadVersionBackends(specs []string) error {
+	versionBackendMap = nil
+	for _, spec := range specs {
+		version, backend, ok := strings.Cut(spec, "=")
+		if !ok || !versionSegment.MatchString(version) {
+			return fmt.Errorf("invalid --version-backend %q (want version=service[:port], e.g. v2=orders-v2:8080)", spec)
+		}
+		b, err := parseBackendSpec(backend)
+		if err != nil {
+			return fmt.Errorf("invalid --version-backend %q: %w", spec, err)
+		}
+		if _, dup := versionBackendMap[version]; dup {
+			return fmt.Errorf("duplicate --version-backend for %s", version)
+		}
+		if versionBackendMap == nil {
+			versionBackendMap = make(map[string]BackendRef)
+		}
+		versionBackendMap[version] = b
+	}
+	return nil
+}
+
+// versionGroup is the endpoints of one API version, in first-appearance
+// order. Version is empty for rows without a version segment.
+type versionGroup struct {
+	Version   string
+	Endpoints []Endpoint
+}
+
+// partitionByVersion splits endpoints by API version. Without
+// --group-by-version all endpoints form one group.
+func partitionByVersion(endpoints []Endpoint) []versionGroup {
+	if !groupByVersion {
+		return []versionGroup{{Endpoints: endpoints}}
+	}
+	var groups []versionGroup
+	index := make(map[string]int)
+	for _, e := range endpoints {
+		v := apiVersion(e)
+		i, ok := index[v]
+		if !ok {
+			i = len(groups)
+			index[v] = i
+			groups = append(groups, versionGroup{Version: v})
+		}
+		groups[i].Endpoints = append(groups[i].Endpoints, e)
+	}
+	return groups
+}
@@ -0,0 +1,320 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/spf13/cobra"
+)
+
+// watchMode is --watch: keep running and regenerate whenever a CSV or a
+// file configuring the conversion changes.
+var watchMode bool
+
+// watchDebounce is how long changes must settle before a regeneration, so
+// an editor saving several files (or writing one in steps) triggers one run.
+const watchDebounce = 200 * time.Millisecond
+
+// runWatch generates once and then again after every change below --input
+// or to --config, --domain-map, --owners-file and --template. Every run
+// converts the whole inventory, since duplicate prefixes, conflicts and the
+// run-wide outputs span files, but only the output files that changed are
+// listed. With --watch-preview, every change is previewed as a diff and
+// written once confirmed. Outputs a run no longer produces, such as the
+// route of a deleted CSV, are removed once a run completes without errors,
+// so a half-edited CSV does not take its route down. The watch ends with
+// SIGINT or SIGTERM.
+func runWatch(cmd *cobra.Command, args []string) error {
+	if err := validateWatchPreview(); err != nil {
+		return err
+	}
+	if sourceScheme(inputDir) != "" || recursive || isGlob(inputDir) {
+		return fmt.Errorf("--watch needs a local --input directory or CSV file, without --recursive or glob patterns")
+	}
+	if outputDir == streamOutput || !slices.ContainsFunc(sinkSpecs, func(s string) bool { return s == "files" || strings.HasPrefix(s, "git") }) {
+		return fmt.Errorf("--watch keeps the outputs in --output and needs the files or git sink")
+	}
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("failed to start watching: %w", err)
+	}
+	defer watcher.Close()
+	watched, present, err := watchTargets(watcher)
+	if err != nil {
+		return err
+	}
+
+	ctx := cmd.Context()
+	var previous []string
+	var answers <-chan string
+	// pending is a previewed change waiting for its answer, which confirm
+	// gives with --watch-confirm-after.
+	pending := false
+	var confirm <-chan time.Time
+	preview := func() {
+		pending, confirm = false, nil
+		existing, ok, err := previewChange(cmd, previous)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Error:", err)
+			return
+		}
+		// Before the first write, the outputs on disk stand for the
+		// previous run.
+		if previous == nil {
+			previous = existing
+		}
+		pending = ok
+		if ok && watchConfirmAfter > 0 {
+			confirm = time.After(watchConfirmAfter)
+		}
+	}
+	write := func(report bool) {
+		pending, confirm = false, nil
+		files, err := regenerate(cmd, previous, report)
+		if err != nil {
+			if ctx.Err() == nil {
+				fmt.Fprintln(os.Stderr, "Error:", err)
+			}
+			return
+		}
+		previous = files
+	}
+	if watchPreview {
+		answers = watchAnswers()
+		preview()
+	} else {
+		previous, err = regenerate(cmd, nil, false)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Error:", err)
+		}
+	}
+	fmt.Printf("Watching %s for changes (Ctrl-C to stop)\n", inputDir)
+
+	changed := make(map[string]bool)
+	var settle <-chan time.Time
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case err := <-watcher.Errors:
+			fmt.Fprintln(os.Stderr, "Watch error:", err)
+		case ev := <-watcher.Events:
+			if !watched(ev.Name) {
+				continue
+			}
+			changed[filepath.Clean(ev.Name)] = true
+			settle = time.After(watchDebounce)
+		case <-settle:
+			settle = nil
+			fmt.Printf("Changed: %s\n", describeChanges(changed, present))
+			clear(changed)
+			if watchPreview {
+				preview()
+			} else {
+				write(true)
+			}
+		case answer, ok := <-answers:
+			switch {
+			case !ok:
+				answers = nil
+			case !pending:
+			case answer == "y" || answer == "yes":
+				write(true)
+			default:
+				pending, confirm = false, nil
+				fmt.Println("Discarded; the next change is previewed again")
+			}
+		case <-confirm:
+			fmt.Println()
+			write(true)
+		}
+	}
+}
+
+// watchTargets adds the directories of --input and the conversion files to
+// watcher and returns the filter for its events and the watched files that
+// exist. Directories rather than files are watched, since editors often
+// replace a file on save.
+func watchTargets(watcher *fsnotify.Watcher) (func(string) bool, map[string]bool, error) {
+	info, err := os.Stat(inputDir)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to access input: %w", err)
+	}
+	dir, only := watchDir(), ""
+	if !info.IsDir() {
+		only = filepath.Clean(inputDir)
+	}
+	dirs := []string{dir}
+	configs := make(map[string]bool)
+	for _, path := range []string{configFile, domainMapFile, ownersFile, templateFile} {
+		if path == "" {
+			continue
+		}
+		path = filepath.Clean(path)
+		configs[path] = true
+		if d := filepath.Dir(path); !slices.Contains(dirs, d) {
+			dirs = append(dirs, d)
+		}
+	}
+	for _, d := range dirs {
+		if err := watcher.Add(d); err != nil {
+			return nil, nil, fmt.Errorf("failed to watch %s: %w", d, err)
+		}
+	}
+	watched := func(name string) bool {
+		name = filepath.Clean(name)
+		if configs[name] {
+			return true
+		}
+		if filepath.Dir(name) != dir || strings.HasPrefix(filepath.Base(name), ".") {
+			return false
+		}
+		if only != "" {
+			return name == only || name == sidecarSchemaPath(only) || name == sidecarMetaPath(only)
+		}
+		return isInputFile(name) || isSidecarFile(name)
+	}
+
+	present := make(map[string]bool)
+	for _, d := range dirs {
+		entries, err := os.ReadDir(d)
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, entry := range entries {
+			if name := filepath.Join(d, entry.Name()); watched(name) {
+				present[name] = true
+			}
+		}
+	}
+	return watched, present, nil
+}
+
+// watchDir is the directory watched for CSV changes: --input, or the
+// directory of the --input file.
+func watchDir() string {
+	if info, err := os.Stat(inputDir); err == nil && !info.IsDir() {
+		return filepath.Dir(filepath.Clean(inputDir))
+	}
+	return filepath.Clean(inputDir)
+}
+
+// describeChanges lists the changed files with what happened to them, and
+// updates present, the files known to exist. The events themselves do not
+// tell, since editors save by writing a new file over the old one.
+func describeChanges(changed, present map[string]bool) string {
+	var parts []string
+	for name := range changed {
+		what := "modified"
+		_, err := os.Stat(name)
+		switch {
+		case err != nil:
+			what = "removed"
+		case !present[name]:
+			what = "added"
+		}
+		present[name] = err == nil
+		parts = append(parts, fmt.Sprintf("%s (%s)", filepath.Base(name), what))
+	}
+	sort.Strings(parts)
+	return strings.Join(parts, ", ")
+}
+
+// regenerate runs a generation from a clean state and returns the files it
+// wrote. Files of the previous run that were not written again are removed
+// when the run had no errors. With report, the per-file lines are replaced
+// by a list of the output files whose content changed.
+func regenerate(cmd *cobra.Command, previous []string, report bool) ([]string, error) {
+	resetRunState()
+	before := make(map[string][]byte)
+	for _, path := range previous {
+		if data, err := os.ReadFile(path); err == nil {
+			before[path] = data
+		}
+	}
+
+	wasQuiet := quiet
+	if report {
+		quiet = true
+	}
+	err := generateOnce(cmd)
+	quiet = wasQuiet
+	files := uniqueFiles(writtenFiles)
+	if errors.As(err, new(filesFailedError)) {
+		err = fmt.Errorf("%w, keeping the outputs of the last good run", err)
+	}
+
+	var removed []string
+	if err == nil {
+		for _, path := range previous {
+			if !slices.Contains(files, path) && os.Remove(path) == nil {
+				removed = append(removed, path)
+			}
+		}
+	} else {
+		// Keep tracking what the failed run did not rewrite, so it is
+		// removed once the inventory is fixed.
+		for _, path := range previous {
+			if !slices.Contains(files, path) {
+				files = append(files, path)
+			}
+		}
+	}
+
+	if report && !quiet {
+		updated := 0
+		for _, path := range uniqueFiles(writtenFiles) {
+			data, readErr := os.ReadFile(path)
+			if old, ok := before[path]; ok && readErr == nil && string(old) == string(data) {
+				continue
+			}
+			verb := "Updated"
+			if _, ok := before[path]; !ok {
+				verb = "Generated"
+			}
+			fmt.Printf("%s %s\n", verb, path)
+			updated++
+		}
+		for _, path := range removed {
+			fmt.Printf("Removed %s\n", path)
+		}
+		if updated == 0 && len(removed) == 0 && err == nil {
+			fmt.Println("No output changes")
+		}
+	}
+	return files, err
+}
+
+// resetRunState clears what a run collects for its run-wide outputs, so the
+// next run of a watch starts like a fresh process. Configuration is reloaded
+// by prepareGeneration.
+func resetRunState() {
+	writtenFiles = nil
+	backstageEntities = nil
+	featureReports = nil
+	testVectors = nil
+	modelRoutes = nil
+	grafanaRows = nil
+	seenRows = make(map[string]finding)
+	referencedNamespaces = make(map[string]bool)
+	errorPageNamespaces = make(map[string]bool)
+	referenceGrants = make(map[grantKey]map[grantTarget]bool)
+	hostnameGroups, hostnameIndex = nil, make(map[string]int)
+	rbacRoutes = make(map[string][]string)
+	partitionDirs = make(map[string]string)
+	importPorts = make(map[string][]int64)
+	servicePorts = make(map[string]map[string]int)
+	openedSources = make(map[string]inputSource)
+	fetchedFiles = make(map[string][]byte)
+	debugEndpoints = make(map[string][]Endpoint)
+	debugErrors = nil
+	runMetrics.routes, runMetrics.rows, runMetrics.failedFiles = 0, 0, 0
+	runMetrics.skipped = make(map[string]int)
+}
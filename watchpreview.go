@@ -0,0 +1,123 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	// watchPreview is --watch-preview: instead of writing the outputs of a
+	// change right away, print their diff and write them once confirmed.
+	watchPreview bool
+	// watchConfirmAfter is --watch-confirm-after: write a previewed change
+	// that stays unanswered and unchanged this long, 0 to wait for an
+	// answer.
+	watchConfirmAfter time.Duration
+)
+
+func validateWatchPreview() error {
+	if watchPreview && !watchMode {
+		return fmt.Errorf("--watch-preview needs --watch")
+	}
+	if watchConfirmAfter != 0 && !watchPreview {
+		return fmt.Errorf("--watch-confirm-after needs --watch-preview")
+	}
+	if watchConfirmAfter < 0 {
+		return fmt.Errorf("invalid --watch-confirm-after %s (must not be negative)", watchConfirmAfter)
+	}
+	return nil
+}
+
+// previewChange regenerates into a scratch directory, as --check does, and
+// prints the diff of every output file that would change against the output
+// directory, and the files of previous that would be removed. It returns
+// the output files the change produces that already exist, and reports
+// whether there is anything to write.
+func previewChange(cmd *cobra.Command, previous []string) ([]string, bool, error) {
+	committed := outputDir
+	tmp, err := os.MkdirTemp("", "csv2httproute-preview-")
+	if err != nil {
+		return nil, false, err
+	}
+	defer os.RemoveAll(tmp)
+
+	resetRunState()
+	restore := generateOnlyFor()
+	outputDir, existingOutputDir = tmp, committed
+	err = generate(cmd)
+	outputDir, existingOutputDir = committed, ""
+	restore()
+	if errors.As(err, new(filesFailedError)) {
+		err = fmt.Errorf("%w, nothing to write", err)
+	}
+	if err != nil {
+		return nil, false, err
+	}
+
+	got, err := readTree(tmp)
+	if err != nil {
+		return nil, false, err
+	}
+	var existing []string
+	changes := 0
+	for _, name := range slices.Sorted(maps.Keys(got)) {
+		path := filepath.Join(committed, filepath.FromSlash(name))
+		old, err := os.ReadFile(path)
+		from := path
+		if err != nil {
+			from = "/dev/null"
+		} else {
+			existing = append(existing, path)
+		}
+		diff := unifiedDiff(from, path, stripRegenerateLine(string(old)), stripRegenerateLine(got[name]))
+		if diff != "" {
+			fmt.Print(colorDiff(diff))
+			changes++
+		}
+	}
+	for _, path := range previous {
+		rel, err := filepath.Rel(committed, path)
+		if err != nil || isSignatureFile(path) {
+			continue
+		}
+		data, err := os.ReadFile(path)
+		if _, kept := got[filepath.ToSlash(rel)]; kept || err != nil || !strings.Contains(string(data), generatedMarker) {
+			continue
+		}
+		fmt.Printf("Would remove %s\n", path)
+		changes++
+	}
+	if changes == 0 {
+		fmt.Println("No output changes")
+		return existing, false, nil
+	}
+	prompt := fmt.Sprintf("Write %d changed file(s)? [y/N] ", changes)
+	if watchConfirmAfter > 0 {
+		prompt = fmt.Sprintf("Write %d changed file(s)? [y/N, written in %s unless answered or changed] ", changes, watchConfirmAfter)
+	}
+	fmt.Print(prompt)
+	return existing, true, nil
+}
+
+// watchAnswers delivers the lines typed on standard input while watching,
+// and is closed at its end.
+func watchAnswers() <-chan string {
+	lines := make(chan string)
+	go func() {
+		defer close(lines)
+		scanner := bufio.NewScanner(os.Stdin)
+		for scanner.Scan() {
+			lines <- strings.ToLower(strings.TrimSpace(scanner.Text()))
+		}
+	}()
+	return lines
+}
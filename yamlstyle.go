@@ -0,0 +1,161 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Quoting styles of --yaml-quote-paths.
+const (
+	// quotePlain quotes paths only where YAML needs it, as the encoder does
+	// for every other string.
+	quotePlain  = "plain"
+	quoteSingle = "single"
+	quoteDouble = "double"
+)
+
+var (
+	// yamlIndent is --yaml-indent, the spaces per nesting level. The
+	// defaults also apply to subcommands without the flags.
+	yamlIndent = 2
+	// yamlFlowLists is --yaml-flow-lists: lists of at most this many
+	// scalars are written in flow style, as [a, b].
+	yamlFlowLists int
+	// yamlQuotePaths is --yaml-quote-paths.
+	yamlQuotePaths = quotePlain
+)
+
+func validateYAMLStyle() error {
+	if yamlIndent < 2 || yamlIndent > 8 {
+		return fmt.Errorf("invalid --yaml-indent %d (must be 2-8)", yamlIndent)
+	}
+	if yamlFlowLists < 0 {
+		return fmt.Errorf("invalid --yaml-flow-lists %d (must be 0 or more)", yamlFlowLists)
+	}
+	switch yamlQuotePaths {
+	case quotePlain, quoteSingle, quoteDouble:
+	default:
+		return fmt.Errorf("invalid --yaml-quote-paths %q (must be %s, %s or %s)", yamlQuotePaths, quotePlain, quoteSingle, quoteDouble)
+	}
+	return nil
+}
+
+// yamlEncoder writes the documents of generated manifests in the style of
+// the --yaml-* flags. Documents never contain anchors or aliases, which
+// rules kept from hand-written routes could otherwise bring along.
+type yamlEncoder struct {
+	*yaml.Encoder
+}
+
+func newYAMLEncoder(w io.Writer) yamlEncoder {
+	encoder := yaml.NewEncoder(w)
+	encoder.SetIndent(yamlIndent)
+	return yamlEncoder{encoder}
+}
+
+// Encode writes doc, a value or a *yaml.Node, as the next document.
+func (e yamlEncoder) Encode(doc any) error {
+	node, ok := doc.(*yaml.Node)
+	if !ok {
+		node = new(yaml.Node)
+		if err := node.Encode(doc); err != nil {
+			return err
+		}
+	}
+	styleNode(node)
+	return e.Encoder.Encode(node)
+}
+
+// styleNode expands the aliases and merge keys below n, drops its anchors,
+// and applies the list and quoting styles.
+func styleNode(n *yaml.Node) {
+	if n.Kind == yaml.AliasNode && n.Alias != nil {
+		head, line, foot := n.HeadComment, n.LineComment, n.FootComment
+		*n = *copyNode(n.Alias)
+		n.HeadComment, n.LineComment, n.FootComment = head, line, foot
+	}
+	n.Anchor = ""
+	for _, c := range n.Content {
+		styleNode(c)
+	}
+	switch n.Kind {
+	case yaml.MappingNode:
+		expandMergeKeys(n)
+	case yaml.SequenceNode:
+		if yamlFlowLists > 0 && len(n.Content) > 0 && len(n.Content) <= yamlFlowLists && scalarsOnly(n.Content) {
+			n.Style |= yaml.FlowStyle
+		}
+	case yaml.ScalarNode:
+		if n.Tag == "!!str" && strings.HasPrefix(n.Value, "/") {
+			switch yamlQuotePaths {
+			case quoteSingle:
+				n.Style = yaml.SingleQuotedStyle
+			case quoteDouble:
+				n.Style = yaml.DoubleQuotedStyle
+			}
+		}
+	}
+}
+
+// copyNode copies n and everything below it, so an aliased node can be
+// styled separately at every place it is used.
+func copyNode(n *yaml.Node) *yaml.Node {
+	c := *n
+	c.Content = make([]*yaml.Node, len(n.Content))
+	for i, child := range n.Content {
+		c.Content[i] = copyNode(child)
+	}
+	return &c
+}
+
+// expandMergeKeys replaces the << merge keys of the mapping n with the
+// entries they merge that n does not set itself.
+func expandMergeKeys(n *yaml.Node) {
+	var content, merged []*yaml.Node
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		key, value := n.Content[i], n.Content[i+1]
+		if key.Tag != "!!merge" {
+			content = append(content, key, value)
+			continue
+		}
+		sources := []*yaml.Node{value}
+		if value.Kind == yaml.SequenceNode {
+			sources = value.Content
+		}
+		for _, src := range sources {
+			if src.Kind == yaml.MappingNode {
+				merged = append(merged, src.Content...)
+			}
+		}
+	}
+	if merged == nil {
+		return
+	}
+	for i := 0; i+1 < len(merged); i += 2 {
+		if !hasKey(content, merged[i].Value) {
+			content = append(content, merged[i], merged[i+1])
+		}
+	}
+	n.Content = content
+}
+
+func hasKey(content []*yaml.Node, key string) bool {
+	for i := 0; i+1 < len(content); i += 2 {
+		if content[i].Value == key {
+			return true
+		}
+	}
+	return false
+}
+
+func scalarsOnly(nodes []*yaml.Node) bool {
+	for _, n := range nodes {
+		if n.Kind != yaml.ScalarNode {
+			return false
+		}
+	}
+	return true
+}